@@ -0,0 +1,52 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// announcementNoticePrefix introduces a group announcement posted to its room.
+const announcementNoticePrefix = "📢 Group announcement:\n"
+
+// pinAnnouncement posts a group's new announcement to its room as a notice
+// from the bridge bot and pins it in place of the previous announcement.
+// Events pinned by room members stay pinned. Failures are logged.
+func (er *EventRouter) pinAnnouncement(ctx context.Context, room *database.RoomMapping, announcement string) {
+	if er.pinnedAnnouncements == nil || er.botUserID == "" {
+		return
+	}
+	eventID, err := er.matrixClient.SendMessage(ctx, room.MatrixRoomID, er.botUserID, "m.room.message", map[string]interface{}{
+		"msgtype": "m.notice",
+		"body":    announcementNoticePrefix + announcement,
+	})
+	if err != nil {
+		er.log.Warn("failed to post group announcement", "error", err, "room_id", room.MatrixRoomID)
+		return
+	}
+
+	previous, err := er.pinnedAnnouncements.Get(ctx, room.MatrixRoomID)
+	if err != nil {
+		er.log.Warn("failed to look up pinned announcement", "error", err, "room_id", room.MatrixRoomID)
+	}
+	// Rewriting the pins without knowing them would unpin everything else.
+	current, err := er.matrixClient.PinnedEvents(ctx, room.MatrixRoomID)
+	if err != nil {
+		er.log.Warn("failed to get pinned events", "error", err, "room_id", room.MatrixRoomID)
+		return
+	}
+	pinned := make([]string, 0, len(current)+1)
+	for _, id := range current {
+		if id != previous && id != eventID {
+			pinned = append(pinned, id)
+		}
+	}
+	pinned = append(pinned, eventID)
+	if err := er.matrixClient.SetPinnedEvents(ctx, room.MatrixRoomID, pinned); err != nil {
+		er.log.Warn("failed to pin group announcement", "error", err, "room_id", room.MatrixRoomID)
+		return
+	}
+	if err := er.pinnedAnnouncements.Set(ctx, room.MatrixRoomID, eventID); err != nil {
+		er.log.Warn("failed to save pinned announcement", "error", err, "room_id", room.MatrixRoomID)
+	}
+}
@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestEventRouter_SyncGroupRoomInfo_PinsAnnouncement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{pinned: map[string][]string{"!room:test": {"$user-pin", "$old-announcement"}}}
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:                 slog.Default(),
+		Puppets:             newTestPuppetManager(),
+		Provider:            provider,
+		MatrixClient:        matrix,
+		BotUserID:           "@wechatbot:test",
+		PinnedAnnouncements: database.NewPinnedAnnouncementStore(db),
+	})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT event_id FROM pinned_announcement WHERE matrix_room_id = $1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow("$old-announcement"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO pinned_announcement`)).
+		WithArgs("!room:test", "$event:test").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	room := &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!room:test", IsGroup: true, Topic: "Standup at 10"}
+	er.syncGroupRoomInfo(context.Background(), provider, room, &wechat.ContactInfo{
+		UserID: "123@chatroom", IsGroup: true, Announcement: "Standup moved to 11",
+	})
+
+	if room.Topic != "Standup moved to 11" || matrix.roomTopics["!room:test"] != "Standup moved to 11" {
+		t.Fatalf("topic = %q, room topic = %q", room.Topic, matrix.roomTopics["!room:test"])
+	}
+	if len(matrix.sent) != 1 || matrix.sent[0].sender != "@wechatbot:test" {
+		t.Fatalf("sent = %+v, want one announcement from the bot", matrix.sent)
+	}
+	content := matrix.sent[0].content.(map[string]interface{})
+	if content["msgtype"] != "m.notice" || content["body"] != announcementNoticePrefix+"Standup moved to 11" {
+		t.Fatalf("announcement = %v", content)
+	}
+	if got, want := matrix.pinned["!room:test"], []string{"$user-pin", "$event:test"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pinned = %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// An unchanged announcement is neither posted nor pinned again.
+	er.syncGroupRoomInfo(context.Background(), provider, room, &wechat.ContactInfo{
+		UserID: "123@chatroom", IsGroup: true, Announcement: "Standup moved to 11",
+	})
+	if len(matrix.sent) != 1 {
+		t.Fatalf("unchanged announcement was posted again: %+v", matrix.sent)
+	}
+}
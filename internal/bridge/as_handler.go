@@ -20,7 +20,20 @@ type ASHandler struct {
 
 // ASTransaction represents a batch of events pushed by the homeserver.
 type ASTransaction struct {
-	Events []ASEvent `json:"events"`
+	Events    []ASEvent `json:"events"`
+	Ephemeral []ASEvent `json:"ephemeral,omitempty"`
+	// MSC2409 unstable prefix used by homeservers before ephemeral events were stabilised.
+	MSC2409Ephemeral []ASEvent `json:"de.sorunome.msc2409.ephemeral,omitempty"`
+}
+
+// ephemeralEvents returns the transaction's ephemeral events. Homeservers
+// moving to the stable key may send the same events under both keys, so the
+// MSC2409 key is only read when the stable one is empty.
+func (txn *ASTransaction) ephemeralEvents() []ASEvent {
+	if len(txn.Ephemeral) > 0 {
+		return txn.Ephemeral
+	}
+	return txn.MSC2409Ephemeral
 }
 
 // ASEvent represents a single event in an AS transaction.
@@ -108,7 +121,9 @@ func (h *ASHandler) handleTransaction(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	for _, evt := range txn.Events {
+	events := append(txn.Events, txn.ephemeralEvents()...)
+
+	for _, evt := range events {
 		matrixEvt := &MatrixEvent{
 			ID:        evt.ID,
 			Type:      evt.Type,
@@ -370,3 +370,35 @@ func TestASHandler_QueryParamPrecedence(t *testing.T) {
 		t.Error("query param token should take precedence")
 	}
 }
+
+func TestASTransaction_DecodesEphemeralEvents(t *testing.T) {
+	body := `{
+		"events": [],
+		"ephemeral": [{"type": "m.receipt", "room_id": "!a:example.com", "content": {}}],
+		"de.sorunome.msc2409.ephemeral": [{"type": "m.receipt", "room_id": "!b:example.com", "content": {}}]
+	}`
+
+	var txn ASTransaction
+	if err := json.Unmarshal([]byte(body), &txn); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(txn.Ephemeral) != 1 || txn.Ephemeral[0].RoomID != "!a:example.com" {
+		t.Fatalf("unexpected ephemeral events: %+v", txn.Ephemeral)
+	}
+	if len(txn.MSC2409Ephemeral) != 1 || txn.MSC2409Ephemeral[0].Type != "m.receipt" {
+		t.Fatalf("unexpected msc2409 ephemeral events: %+v", txn.MSC2409Ephemeral)
+	}
+}
+
+func TestASTransaction_EphemeralEventsPrefersStableKey(t *testing.T) {
+	receipt := ASEvent{Type: "m.receipt", RoomID: "!a:example.com"}
+
+	both := &ASTransaction{Ephemeral: []ASEvent{receipt}, MSC2409Ephemeral: []ASEvent{receipt}}
+	if events := both.ephemeralEvents(); len(events) != 1 {
+		t.Fatalf("ephemeral events = %+v, want the stable key's only", events)
+	}
+	unstable := &ASTransaction{MSC2409Ephemeral: []ASEvent{receipt}}
+	if events := unstable.ephemeralEvents(); len(events) != 1 || events[0].RoomID != "!a:example.com" {
+		t.Fatalf("ephemeral events = %+v, want the MSC2409 key's", events)
+	}
+}
@@ -0,0 +1,136 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// uploadPuppetAvatar downloads a contact's avatar from WeChat, uploads it to
+// Matrix and sets it on the puppet, persisting the new MXC URI.
+func (er *EventRouter) uploadPuppetAvatar(ctx context.Context, provider wechat.Provider, puppet *Puppet) (string, error) {
+	avatarData, mimeType, err := provider.GetUserAvatar(ctx, puppet.WeChatID)
+	if err != nil {
+		return "", fmt.Errorf("download avatar: %w", err)
+	}
+	if processed, processedType, err := er.avatarProcessor.ProcessAvatar(ctx, avatarData, mimeType); err != nil {
+		er.log.Warn("failed to process puppet avatar, uploading original",
+			"error", err, "user_id", puppet.WeChatID)
+	} else {
+		avatarData, mimeType = processed, processedType
+	}
+
+	mxcURI, err := er.matrixClient.UploadMedia(ctx, avatarData, mimeType, "avatar")
+	if err != nil {
+		return "", fmt.Errorf("upload avatar: %w", err)
+	}
+
+	if err := er.matrixClient.SetAvatarURL(ctx, puppet.MatrixUserID, mxcURI); err != nil {
+		return "", fmt.Errorf("set puppet avatar: %w", err)
+	}
+
+	if err := er.puppets.SetAvatar(ctx, puppet, mxcURI); err != nil {
+		return "", err
+	}
+	return mxcURI, nil
+}
+
+// ResyncStaleAvatars checks every puppet avatar against the homeserver and
+// re-uploads the ones whose media no longer exists, e.g. after a media purge.
+// It returns the number of avatars checked and restored.
+func (er *EventRouter) ResyncStaleAvatars(ctx context.Context, provider wechat.Provider) (checked, restored int, err error) {
+	if er.matrixClient == nil {
+		return 0, 0, fmt.Errorf("matrixClient not configured")
+	}
+	if provider == nil {
+		return 0, 0, fmt.Errorf("no active provider")
+	}
+
+	puppets, err := er.puppets.All(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list puppets: %w", err)
+	}
+
+	for _, puppet := range puppets {
+		if puppet.AvatarMXC == "" {
+			continue
+		}
+		checked++
+
+		exists, err := er.matrixClient.MediaExists(ctx, puppet.AvatarMXC)
+		if err != nil {
+			er.log.Warn("failed to check puppet avatar",
+				"error", err, "user_id", puppet.WeChatID, "mxc", puppet.AvatarMXC)
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		stale := puppet.AvatarMXC
+		mxcURI, err := er.uploadPuppetAvatar(ctx, provider, puppet)
+		if err != nil {
+			er.log.Warn("failed to restore puppet avatar",
+				"error", err, "user_id", puppet.WeChatID, "mxc", stale)
+			continue
+		}
+		restored++
+		er.log.Info("restored purged puppet avatar",
+			"user_id", puppet.WeChatID, "old_mxc", stale, "mxc", mxcURI)
+	}
+
+	return checked, restored, nil
+}
+
+// AvatarCheckLoop periodically restores purged puppet avatars until ctx is done.
+func (er *EventRouter) AvatarCheckLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			er.resyncAllAvatars(ctx)
+		}
+	}
+}
+
+// resyncAllAvatars restores purged puppet avatars through the bridge's
+// provider, or in multi-tenant mode through each logged-in user's provider
+// in turn, so a contact only one user knows is still restored.
+func (er *EventRouter) resyncAllAvatars(ctx context.Context) {
+	if !er.multiTenant {
+		provider := er.getProvider()
+		if provider == nil {
+			er.log.Debug("skipping avatar check, no active provider")
+			return
+		}
+		if _, _, err := er.ResyncStaleAvatars(ctx, provider); err != nil {
+			er.log.Warn("periodic avatar check failed", "error", err)
+		}
+		return
+	}
+	if er.sessionManager == nil {
+		return
+	}
+
+	for _, userID := range er.sessionManager.LoggedInUsers() {
+		userCtx := context.WithValue(ctx, bridgeUserKey, userID)
+		provider, err := er.getProviderForUser(userCtx, userID)
+		if err != nil || provider == nil {
+			er.log.Debug("skipping avatar check, no active provider", "user", userID)
+			continue
+		}
+		if _, _, err := er.ResyncStaleAvatars(userCtx, provider); err != nil {
+			er.log.Warn("periodic avatar check failed", "error", err, "user", userID)
+		}
+	}
+}
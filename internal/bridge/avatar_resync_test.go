@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/config"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withStoredPuppets backs the router's puppets with a user store on db and
+// matrix, so the avatar resync sees the puppets expectPuppetRows returns.
+func withStoredPuppets(matrix *testMatrixClient) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Puppets = NewPuppetManager("example.com", "wechat_{{.}}", "{{.Nickname}} (WeChat)", database.NewUserStore(db), matrix)
+		cfg.Provider = newMockProvider("padpro", 2)
+	}
+}
+
+func expectPuppetRows(mock sqlmock.Sqlmock) {
+	now := time.Now()
+	cols := []string{
+		"wechat_id", "alias", "nickname", "avatar_url", "avatar_mxc", "gender",
+		"province", "city", "signature", "matrix_user_id", "name_set", "avatar_set",
+		"contact_info_set", "last_sync", "created_at", "updated_at",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM wechat_user ORDER BY nickname`)).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("wxid_stale", "", "Stale", "https://wx/a.jpg", "mxc://test/purged", 0,
+				"", "", "", "@wechat_wxid_stale:example.com", true, true, false, nil, now, now).
+			AddRow("wxid_fresh", "", "Fresh", "https://wx/b.jpg", "mxc://test/fine", 0,
+				"", "", "", "@wechat_wxid_fresh:example.com", true, true, false, nil, now, now).
+			AddRow("wxid_none", "", "None", "", "", 0,
+				"", "", "", "@wechat_wxid_none:example.com", true, false, false, nil, now, now))
+}
+
+func TestEventRouter_ResyncStaleAvatars_ReuploadsPurgedMedia(t *testing.T) {
+	matrix := &testMatrixClient{purgedMedia: map[string]bool{"mxc://test/purged": true}}
+	er, mock := newTestRouter(t, matrix, withStoredPuppets(matrix))
+	ctx := context.Background()
+
+	expectPuppetRows(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE wechat_user SET avatar_mxc = $2, avatar_set = $3, updated_at = NOW() WHERE wechat_id = $1`)).
+		WithArgs("wxid_stale", "mxc://test/uploaded", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	checked, restored, err := er.ResyncStaleAvatars(ctx, er.getProvider())
+	if err != nil {
+		t.Fatalf("ResyncStaleAvatars: %v", err)
+	}
+	if checked != 2 || restored != 1 {
+		t.Fatalf("checked=%d restored=%d, want 2 and 1", checked, restored)
+	}
+
+	if got := matrix.avatars["@wechat_wxid_stale:example.com"]; got != "mxc://test/uploaded" {
+		t.Fatalf("stale puppet avatar = %q", got)
+	}
+	if _, ok := matrix.avatars["@wechat_wxid_fresh:example.com"]; ok {
+		t.Fatal("valid avatar should not be re-uploaded")
+	}
+
+	puppet, err := er.puppets.GetByWeChatID(ctx, "wxid_stale")
+	if err != nil || puppet == nil {
+		t.Fatalf("GetByWeChatID: %v", err)
+	}
+	if puppet.AvatarMXC != "mxc://test/uploaded" {
+		t.Fatalf("cached AvatarMXC = %q", puppet.AvatarMXC)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_ResyncAllAvatars_MultiTenantUsesLoggedInSessions(t *testing.T) {
+	matrix := &testMatrixClient{purgedMedia: map[string]bool{"mxc://test/purged": true}}
+	er, mock := newTestRouter(t, matrix, withStoredPuppets(matrix))
+	alice := newMockProvider("padpro", 2)
+	alice.avatarData = []byte("alice")
+	bob := newMockProvider("padpro", 2)
+	bob.avatarData = []byte("bob")
+
+	sm := NewSessionManager(nil, nil, config.RiskControlConfig{}, er, "info", slog.Default())
+	sm.sessions["@alice:test"] = &UserSession{BridgeUserID: "@alice:test", Provider: alice, LoginState: wechat.LoginStateLoggedIn}
+	sm.sessions["@bob:test"] = &UserSession{BridgeUserID: "@bob:test", Provider: bob, LoginState: wechat.LoginStateQRCode}
+	er.SetSessionManager(sm)
+
+	// Only Alice is logged in, so only her provider is asked for avatars
+	expectPuppetRows(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE wechat_user SET avatar_mxc = $2`)).
+		WithArgs("wxid_stale", "mxc://test/uploaded", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	er.resyncAllAvatars(context.Background())
+
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "alice" {
+		t.Fatalf("uploads = %q, want the avatar from Alice's provider", matrix.uploads)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCommandProcessor_ResyncAvatars(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withStoredPuppets(matrix))
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    er,
+		BotUserID: "@wechatbot:example.com",
+	})
+
+	expectPuppetRows(mock)
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat resync-avatars"), true); err != nil {
+		t.Fatalf("resync-avatars: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "Checked 2 avatars, restored 0") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// AvatarProcessor transforms a puppet avatar before it is uploaded to Matrix,
+// e.g. to normalize size or shape. It returns the new data and MIME type.
+type AvatarProcessor interface {
+	ProcessAvatar(ctx context.Context, data []byte, mimeType string) ([]byte, string, error)
+}
+
+// passthroughAvatarProcessor uploads avatars unchanged. It is the default.
+type passthroughAvatarProcessor struct{}
+
+func (passthroughAvatarProcessor) ProcessAvatar(_ context.Context, data []byte, mimeType string) ([]byte, string, error) {
+	return data, mimeType, nil
+}
+
+// SquareCropAvatarProcessor crops avatars to a centered square and scales
+// them down to at most Size pixels per side (0 keeps the cropped size).
+// JPEG and PNG are supported; other formats are passed through unchanged.
+type SquareCropAvatarProcessor struct {
+	Size int
+}
+
+func (p SquareCropAvatarProcessor) ProcessAvatar(_ context.Context, data []byte, mimeType string) ([]byte, string, error) {
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return data, mimeType, nil
+	}
+	src, err := decodeImage(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode avatar: %w", err)
+	}
+
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	size := side
+	if p.Size > 0 && p.Size < side {
+		size = p.Size
+	}
+	if size == b.Dx() && size == b.Dy() {
+		return data, mimeType, nil
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	dst := scaleImage(src, image.Rect(x0, y0, x0+side, y0+side), size, size)
+
+	var buf bytes.Buffer
+	if mimeType == "image/png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("encode avatar: %w", err)
+	}
+	return buf.Bytes(), mimeType, nil
+}
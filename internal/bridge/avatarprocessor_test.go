@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+type upperAvatarProcessor struct {
+	calls int
+}
+
+func (p *upperAvatarProcessor) ProcessAvatar(_ context.Context, data []byte, _ string) ([]byte, string, error) {
+	p.calls++
+	return bytes.ToUpper(data), "image/png", nil
+}
+
+func TestEventRouter_SyncPuppetAvatar_AppliesProcessor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.avatarData = []byte("avatar")
+	processor := &upperAvatarProcessor{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:             slog.Default(),
+		Puppets:         NewPuppetManager("example.com", "wechat_{{.}}", "{{.Nickname}} (WeChat)", database.NewUserStore(db), matrix),
+		Provider:        provider,
+		MatrixClient:    matrix,
+		AvatarProcessor: processor,
+	})
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE wechat_user SET avatar_mxc = $2`)).
+		WithArgs("wxid_test", "mxc://test/uploaded", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	er.syncPuppetAvatar(context.Background(),
+		&Puppet{WeChatID: "wxid_test", MatrixUserID: "@wechat_wxid_test:example.com"},
+		&wechat.ContactInfo{UserID: "wxid_test"})
+
+	if processor.calls != 1 {
+		t.Fatalf("processor called %d times, want 1", processor.calls)
+	}
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "AVATAR" {
+		t.Fatalf("uploads = %q, want processed avatar", matrix.uploads)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSquareCropAvatarProcessor(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		w, h     int
+		wantSide int
+	}{
+		{"landscape", 0, 40, 20, 20},
+		{"portrait resized", 10, 20, 40, 10},
+		{"already square", 0, 16, 16, 16},
+	}
+	for _, tc := range tests {
+		data, mimeType, err := SquareCropAvatarProcessor{Size: tc.size}.ProcessAvatar(context.Background(), testPNG(t, tc.w, tc.h), "image/png")
+		if err != nil {
+			t.Fatalf("%s: ProcessAvatar: %v", tc.name, err)
+		}
+		if mimeType != "image/png" {
+			t.Errorf("%s: mime type = %q", tc.name, mimeType)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode result: %v", tc.name, err)
+		}
+		if cfg.Width != tc.wantSide || cfg.Height != tc.wantSide {
+			t.Errorf("%s: result is %dx%d, want %dx%d", tc.name, cfg.Width, cfg.Height, tc.wantSide, tc.wantSide)
+		}
+	}
+
+	gif := []byte("GIF89a")
+	if data, _, err := (SquareCropAvatarProcessor{}).ProcessAvatar(context.Background(), gif, "image/gif"); err != nil || !bytes.Equal(data, gif) {
+		t.Errorf("unsupported format should pass through, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// backfillsPerMinute caps how many new rooms are backfilled per minute, so
+// creating many rooms at once, e.g. while syncing chats after login, doesn't
+// fetch every chat's history in a burst that trips WeChat's risk control.
+// Rooms created beyond the limit start empty.
+const backfillsPerMinute = 20
+
+// backfillThrottle is a token bucket shared by all room backfills.
+type backfillThrottle struct {
+	mu     sync.Mutex
+	bucket *tokenBucket
+	now    func() time.Time
+}
+
+func newBackfillThrottle() *backfillThrottle {
+	return &backfillThrottle{bucket: newTokenBucket(backfillsPerMinute, time.Now()), now: time.Now}
+}
+
+// allow reports whether another room may be backfilled right now.
+func (t *backfillThrottle) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bucket.wait(t.now()) > 0 {
+		return false
+	}
+	t.bucket.take()
+	return true
+}
+
+// backfillNewRoom fills a newly created room with the chat's most recent
+// messages, if the provider can fetch them. Failures are logged so room
+// creation still succeeds.
+func (er *EventRouter) backfillNewRoom(ctx context.Context, provider wechat.Provider, room *database.RoomMapping) {
+	if er.backfillMessages <= 0 || provider == nil {
+		return
+	}
+	reader, ok := provider.(wechat.HistoryReader)
+	if !ok {
+		return
+	}
+	if !er.backfillThrottle.allow() {
+		er.log.Info("skipping backfill, too many rooms created at once", "room_id", room.MatrixRoomID)
+		return
+	}
+
+	messages, err := reader.GetRecentMessages(ctx, room.WeChatChatID, er.backfillMessages)
+	if errors.Is(err, wechat.ErrNotSupported) {
+		er.log.Debug("provider can't fetch history of chat", "chat_id", room.WeChatChatID)
+		return
+	}
+	if err != nil {
+		er.log.Warn("failed to fetch chat history for backfill", "error", err, "chat_id", room.WeChatChatID)
+		return
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp < messages[j].Timestamp
+	})
+	if err := er.BackfillRoom(ctx, room, messages); err != nil {
+		er.log.Warn("failed to backfill room", "error", err, "room_id", room.MatrixRoomID)
+	}
+}
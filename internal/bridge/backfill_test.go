@@ -0,0 +1,137 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// historyProvider is a mockProvider that can fetch chat history.
+type historyProvider struct {
+	*mockProvider
+	history []*wechat.Message
+	err     error
+	limits  []int
+}
+
+func (p *historyProvider) GetRecentMessages(_ context.Context, _ string, limit int) ([]*wechat.Message, error) {
+	p.limits = append(p.limits, limit)
+	return p.history, p.err
+}
+
+// withBackfill routes to provider with the room and message stores wired
+// and BackfillMessages set to limit.
+func withBackfill(provider wechat.Provider, limit int) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+		cfg.Provider = provider
+		cfg.Rooms = database.NewRoomMappingStore(db)
+		cfg.Messages = database.NewMessageMappingStore(db)
+		cfg.BackfillMessages = limit
+	}
+}
+
+func expectNewDirectRoom(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1`)).
+		WithArgs("wxid_bob", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestEventRouter_GetOrCreateRoom_BackfillsNewRoom(t *testing.T) {
+	now := time.Now()
+	provider := &historyProvider{
+		mockProvider: newMockProvider("padpro", 2),
+		history: []*wechat.Message{
+			{MsgID: "h2", Type: wechat.MsgText, FromUser: "wxid_bob", Content: "second", Timestamp: now.UnixMilli()},
+			{MsgID: "h1", Type: wechat.MsgText, FromUser: "wxid_bob", Content: "first", Timestamp: now.Add(-time.Minute).UnixMilli()},
+		},
+	}
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withBackfill(provider, 5))
+
+	expectNewDirectRoom(mock)
+	for _, id := range []string{"h1", "h2"} {
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id = $2`)).
+			WithArgs(id, "!room:test").
+			WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_mapping`)).
+			WithArgs(id, "$event:test", "!room:test", "wxid_bob", int(wechat.MsgText), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	if _, err := er.getOrCreateRoom(context.Background(), "wxid_bob", false, "@user:test"); err != nil {
+		t.Fatalf("getOrCreateRoom: %v", err)
+	}
+	if len(provider.limits) != 1 || provider.limits[0] != 5 {
+		t.Fatalf("history fetched with limits %v, want [5]", provider.limits)
+	}
+	if len(matrix.backfilled) != 2 {
+		t.Fatalf("backfilled %d messages, want 2", len(matrix.backfilled))
+	}
+	first, _ := matrix.backfilled[0].content.(map[string]interface{})
+	if first["body"] != "first" {
+		t.Fatalf("history should be backfilled oldest first, got %+v", matrix.backfilled)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_SkipsBackfill(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider wechat.Provider
+		limit    int
+	}{
+		{"disabled", &historyProvider{mockProvider: newMockProvider("padpro", 2), history: []*wechat.Message{{MsgID: "h1"}}}, 0},
+		{"no history support", newMockProvider("wecom", 1), 20},
+		{"history not supported for chat", &historyProvider{mockProvider: newMockProvider("padpro", 2), err: fmt.Errorf("dm history: %w", wechat.ErrNotSupported)}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matrix := &testMatrixClient{}
+			er, mock := newTestRouter(t, matrix, withBackfill(tt.provider, tt.limit))
+			expectNewDirectRoom(mock)
+
+			if _, err := er.getOrCreateRoom(context.Background(), "wxid_bob", false, "@user:test"); err != nil {
+				t.Fatalf("getOrCreateRoom: %v", err)
+			}
+			if len(matrix.backfilled) != 0 {
+				t.Fatalf("room should not be backfilled: %+v", matrix.backfilled)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackfillThrottle_LimitsBursts(t *testing.T) {
+	now := time.Now()
+	throttle := newBackfillThrottle()
+	throttle.now = func() time.Time { return now }
+
+	allowed := 0
+	for i := 0; i < backfillsPerMinute; i++ {
+		if throttle.allow() {
+			allowed++
+		}
+	}
+	if allowed == 0 || allowed == backfillsPerMinute {
+		t.Fatalf("allowed %d of %d backfills at once, want a limited burst", allowed, backfillsPerMinute)
+	}
+
+	now = now.Add(time.Minute)
+	if !throttle.allow() {
+		t.Fatal("backfill should be allowed again after a minute")
+	}
+}
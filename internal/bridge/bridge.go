@@ -15,6 +15,7 @@ import (
 
 	"github.com/n42/mautrix-wechat/internal/config"
 	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/internal/voice"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
@@ -32,6 +33,13 @@ type Bridge struct {
 	Metrics         *Metrics
 	Crypto          CryptoHelper
 
+	// Transcriber transcribes incoming voice messages; set it before Start.
+	// Nil uses NoopTranscriber, which bridges no transcripts.
+	Transcriber Transcriber
+	// Authorizer decides who may run management commands; set it before
+	// Start. Nil uses a PermissionAuthorizer over bridge.permissions.
+	Authorizer CommandAuthorizer
+
 	// Multi-tenant fields
 	SessionManager *SessionManager
 	NodePool       *NodePool
@@ -52,7 +60,14 @@ func New(cfg *config.Config, log *slog.Logger) (*Bridge, error) {
 	}
 
 	// Initialize database
-	db, err := database.New(cfg.Database.Type, cfg.Database.URI, cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns)
+	db, err := database.NewWithRetry(cfg.Database.Type, cfg.Database.URI, cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns, database.ConnectRetry{
+		Attempts: cfg.Database.ConnectAttempts,
+		Timeout:  time.Duration(cfg.Database.ConnectTimeoutS) * time.Second,
+		OnRetry: func(attempt int, wait time.Duration, err error) {
+			log.Warn("database not reachable, retrying",
+				"attempt", attempt, "of", cfg.Database.ConnectAttempts, "retry_in", wait, "error", err)
+		},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("initialize database: %w", err)
 	}
@@ -105,44 +120,216 @@ func (b *Bridge) Start(ctx context.Context) (err error) {
 		}
 	}
 
-	// Initialize puppet manager (MatrixClient will be set once we have a real implementation)
+	botUserID := fmt.Sprintf("@%s:%s", b.Config.AppService.Bot.Username, b.Config.Homeserver.Domain)
+
+	// Homeserver client shared by puppets, crypto and the event router
+	matrixClient := NewAppServiceClient(b.Config.Homeserver.Address, b.Config.AppService.ASToken, botUserID)
+	matrixClient.SetMaxConcurrentUploads(b.Config.Bridge.Media.MaxConcurrentUploads)
+	matrixClient.SetMetrics(b.Metrics)
+
+	// Initialize puppet manager
 	b.Puppets = NewPuppetManager(
 		b.Config.Homeserver.Domain,
 		b.Config.Bridge.UsernameTemplate,
 		b.Config.Bridge.DisplaynameTemplate,
 		b.DB.User,
-		nil, // MatrixClient — injected later or via a stub
+		matrixClient,
 	)
+	b.Puppets.SetOfficialAccountTemplate(b.Config.Bridge.OfficialAccountDisplaynameTemplate)
 
 	// Initialize crypto helper
 	b.Crypto = NewCryptoHelper(
 		b.Log.With("component", "crypto"),
 		b.Config.Bridge.Encryption,
 		nil, // CryptoStore — injected when E2EE store is available
-		nil, // MatrixClient
-		fmt.Sprintf("@%s:%s", b.Config.AppService.Bot.Username, b.Config.Homeserver.Domain),
+		matrixClient,
+		botUserID,
 	)
 	if err := b.Crypto.Init(ctx); err != nil {
 		b.Log.Warn("crypto helper initialization failed, E2EE disabled", "error", err)
 		b.Crypto = &noopCryptoHelper{}
 	}
 
+	doublePuppet := NewDoublePuppetManager(
+		b.Log.With("component", "double_puppet"),
+		b.DB.DoublePuppet,
+		matrixClient,
+		b.Config.Bridge.DoublePuppet.LoginSharedSecret,
+	)
+
+	clockSkewWindow := 0
+	if b.Config.Bridge.MessageHandling.ClockSkewCorrection {
+		clockSkewWindow = b.Config.Bridge.MessageHandling.ClockSkewWindow
+	}
+	largeGroupThreshold := b.Config.Bridge.MessageHandling.LargeGroupThreshold
+	if largeGroupThreshold < 0 {
+		largeGroupThreshold = 0
+	}
+	notesRoomName := b.Config.Bridge.MessageHandling.NotesRoomName
+	if notesRoomName == "none" {
+		notesRoomName = ""
+	}
+	momentsRoomName := ""
+	if b.Config.Bridge.Moments.Enabled {
+		momentsRoomName = b.Config.Bridge.Moments.RoomName
+	}
+	sendTimeout := time.Duration(0)
+	if b.Config.Providers.Failover.Enabled && b.Config.Providers.Failover.SendTimeoutS > 0 {
+		sendTimeout = time.Duration(b.Config.Providers.Failover.SendTimeoutS) * time.Second
+	}
+	backfillMessages := 0
+	if b.Config.Bridge.Backfill.MaxMessages != nil {
+		backfillMessages = *b.Config.Bridge.Backfill.MaxMessages
+	}
+	// -1 disables a rate limit, which the router takes as 0
+	messagesPerMinute := max(b.Config.Bridge.RateLimit.MessagesPerMinute, 0)
+	chatMessagesPerMinute := max(b.Config.Bridge.RateLimit.ChatMessagesPerMinute, 0)
+
+	var voiceConverter VoiceConverter
+	if b.Config.Bridge.Media.VoiceConverter == "silk2ogg" {
+		vc, err := voice.NewConverter("")
+		if err != nil {
+			b.Log.Warn("voice converter not available, voice is bridged as received", "error", err)
+		} else {
+			if !vc.CanEncode() {
+				b.Log.Warn("silk_v3_encoder not found, voice from Matrix is sent as received")
+			}
+			voiceConverter = vc
+		}
+	}
+	var avatarProcessor AvatarProcessor
+	if size := b.Config.Bridge.Media.AvatarSquareSize; size > 0 {
+		avatarProcessor = SquareCropAvatarProcessor{Size: size}
+	}
+	transcriber := b.Transcriber
+	if transcriber == nil {
+		transcriber = NoopTranscriber{}
+	}
+	imageTranscoder := JPEGTranscoder{
+		Quality:      b.Config.Bridge.Media.ImageQuality,
+		MaxDimension: b.Config.Bridge.Media.MaxImageDimension,
+	}
+	processor := &defaultMessageProcessor{
+		log:             b.Log.With("component", "processor"),
+		matrixClient:    matrixClient,
+		maxFileSize:     b.Config.Bridge.Media.MaxFileSize,
+		voiceConverter:  voiceConverter,
+		imageTranscoder: imageTranscoder,
+		transcriber:     transcriber,
+	}
+
 	// Initialize event router with metrics and crypto
 	b.EventRouter = NewEventRouter(EventRouterConfig{
 		Log:          b.Log.With("component", "event_router"),
 		Puppets:      b.Puppets,
-		Processor:    &defaultMessageProcessor{},
+		Processor:    processor,
 		Provider:     b.Provider, // nil in multi-tenant mode (per-user providers via SessionManager)
 		Rooms:        b.DB.RoomMapping,
 		Messages:     b.DB.MessageMapping,
 		BridgeUsers:  b.DB.BridgeUser,
 		GroupMembers: b.DB.GroupMember,
-		MatrixClient: nil, // Injected when real client available
+		MatrixClient: matrixClient,
 		Crypto:       b.Crypto,
 		Metrics:      b.Metrics,
 		MultiTenant:  multiTenant,
+
+		MaxTextLength:    b.Config.Bridge.MessageHandling.MaxTextLength,
+		LongTextMode:     b.Config.Bridge.MessageHandling.LongTextMode,
+		SendReadReceipts: b.Config.Bridge.MessageHandling.SendReadReceipts,
+		DeliveryReceipts: b.Config.Bridge.MessageHandling.DeliveryReceipts,
+		RevokeWindow:     time.Duration(b.Config.Bridge.MessageHandling.RevokeWindowS) * time.Second,
+		RevokeOnEdit:     b.Config.Bridge.MessageHandling.RevokeEditedMessages,
+		SyncDirectChats:  b.Config.Bridge.MessageHandling.SyncDirectChat,
+		BotUserID:        botUserID,
+		DoublePuppet:     doublePuppet,
+		FriendRequests:   b.DB.FriendRequest,
+		MemberNames:      b.DB.RoomMemberName,
+		MessageStates:    b.DB.MessageState,
+		ReactionEvents:   b.DB.ReactionEvent,
+		SendStats:        b.DB.SendStat,
+		MaxMessageAge:    time.Duration(b.Config.Bridge.MessageHandling.MaxMessageAge) * time.Second,
+		SendRetries:      b.Config.Bridge.MessageHandling.SendRetries,
+		SendRetryBackoff: time.Duration(b.Config.Bridge.MessageHandling.SendRetryBackoffMs) * time.Millisecond,
+
+		ContactSyncPageSize: b.Config.Bridge.MessageHandling.ContactSyncPageSize,
+		ContactSyncLimit:    b.Config.Bridge.MessageHandling.ContactSyncLimit,
+		GroupRemovalAction:  b.Config.Bridge.MessageHandling.GroupRemovalAction,
+		DuplicateRoomNames:  b.Config.Bridge.MessageHandling.DuplicateRoomNames,
+		PaymentRequests:     b.Config.Bridge.MessageHandling.PaymentRequests,
+		EmojiReactions:      b.Config.Bridge.MessageHandling.EmojiReactions,
+		SilentContactAdds:   b.Config.Bridge.MessageHandling.SilentContactAdds,
+		RecreatedGroups:     b.Config.Bridge.MessageHandling.RecreatedGroups,
+
+		ClockSkewWindow:    clockSkewWindow,
+		ClockSkewThreshold: time.Duration(b.Config.Bridge.MessageHandling.ClockSkewThresholdS) * time.Second,
+
+		DedupCapacity: b.Config.Bridge.MessageHandling.DedupCapacity,
+		DedupTTL:      time.Duration(b.Config.Bridge.MessageHandling.DedupTTLS) * time.Second,
+		PatAsReaction: b.Config.Bridge.PatAsReaction,
+
+		LargeGroupThreshold: largeGroupThreshold,
+		NotesRoomName:       notesRoomName,
+		MomentsRoomName:     momentsRoomName,
+		MomentsCursors:      b.DB.MomentsCursor,
+		PinnedAnnouncements: b.DB.PinnedAnnouncement,
+
+		MessagesPerMinute:     messagesPerMinute,
+		ChatMessagesPerMinute: chatMessagesPerMinute,
+		SendTimeout:           sendTimeout,
+		BackfillMessages:      backfillMessages,
+
+		ImageTranscoder: imageTranscoder,
+		VoiceConverter:  voiceConverter,
+		AvatarProcessor: avatarProcessor,
 	})
 
+	// Media is downloaded from whichever provider received the message
+	processor.providers = b.EventRouter.getProviderForContext
+
+	if err := b.EventRouter.SetRelayPrefix(
+		b.Config.Bridge.MessageHandling.RelayPrefix,
+		b.Config.Bridge.MessageHandling.KnownPrefixes,
+	); err != nil {
+		return fmt.Errorf("configure relay prefix: %w", err)
+	}
+	if err := b.EventRouter.SetOutgoingSignature(
+		b.Config.Bridge.OutgoingPrefix,
+		b.Config.Bridge.OutgoingSuffix,
+		b.Config.Bridge.OutgoingSignatureSkipRooms,
+	); err != nil {
+		return fmt.Errorf("configure outgoing signature: %w", err)
+	}
+	if err := b.EventRouter.SetChatFilter(ctx,
+		b.Config.Bridge.Filters.Allow,
+		b.Config.Bridge.Filters.Deny,
+		b.DB.ChatFilter,
+	); err != nil {
+		return fmt.Errorf("configure chat filters: %w", err)
+	}
+
+	cooldowns := make(map[string]time.Duration, len(b.Config.Bridge.Commands.Cooldowns))
+	for name, seconds := range b.Config.Bridge.Commands.Cooldowns {
+		cooldowns[name] = time.Duration(seconds) * time.Second
+	}
+	authorizer := b.Authorizer
+	if authorizer == nil {
+		permissions := NewPermissionAuthorizer(b.Config.Bridge.Permissions)
+		if multiTenant {
+			// Each user logs in and out of their own WeChat session
+			permissions.AllowUsers("login", "logout")
+		}
+		authorizer = permissions
+	}
+	b.EventRouter.SetCommandProcessor(NewCommandProcessor(CommandProcessorConfig{
+		Log:       b.Log.With("component", "commands"),
+		Router:    b.EventRouter,
+		BotUserID: botUserID,
+		Prefix:    b.Config.Bridge.Commands.Prefix,
+		Cooldowns: cooldowns,
+
+		Authorizer: authorizer,
+	}))
+
 	if multiTenant {
 		// === Multi-tenant initialization ===
 
@@ -179,6 +366,12 @@ func (b *Bridge) Start(ctx context.Context) (err error) {
 			b.Config.Logging.MinLevel,
 			b.Log.With("component", "session_manager"),
 		)
+		b.SessionManager.SetMaxMediaSize(b.Config.Bridge.Media.MaxFileSize)
+		b.SessionManager.SetCapabilityOverrides(b.Config.Providers.PadPro.Capabilities)
+		if b.Metrics != nil {
+			b.SessionManager.SetConnectionObserver(b.Metrics)
+			b.SessionManager.SetSendObserver(b.Metrics)
+		}
 
 		// 6. Inject SessionManager back into EventRouter
 		b.EventRouter.SetSessionManager(b.SessionManager)
@@ -204,6 +397,7 @@ func (b *Bridge) Start(ctx context.Context) (err error) {
 				b.Log.Info("active provider switched",
 					"name", newProvider.Name(), "tier", newProvider.Tier())
 			})
+			b.EventRouter.SetProviderErrorHook(b.ProviderManager.ReportError)
 		} else {
 			providerCfg := b.buildProviderConfig()
 			if err := b.Provider.Init(providerCfg, b.EventRouter); err != nil {
@@ -255,12 +449,20 @@ func (b *Bridge) Start(ctx context.Context) (err error) {
 			if err := b.Provider.Start(ctx); err != nil {
 				return fmt.Errorf("start provider %s: %w", b.Provider.Name(), err)
 			}
+			restoreSession(ctx, b.Log, b.Provider)
 			b.Metrics.SetConnected(b.Provider.IsRunning() && b.Provider.GetLoginState() == wechat.LoginStateLoggedIn)
 			b.Metrics.SetLoginState(int(b.Provider.GetLoginState()))
 			b.Log.Info("provider started", "name", b.Provider.Name(), "tier", b.Provider.Tier())
 		}
 	}
 
+	go b.EventRouter.AvatarCheckLoop(ctx, time.Duration(b.Config.Bridge.Media.AvatarCheckIntervalS)*time.Second)
+	go b.databaseHealthLoop(ctx, time.Duration(b.Config.Database.HealthCheckIntervalS)*time.Second,
+		time.Duration(b.Config.Database.ConnectTimeoutS)*time.Second)
+	if b.Config.Bridge.Moments.Enabled {
+		go b.EventRouter.MomentsLoop(ctx, time.Duration(b.Config.Bridge.Moments.PollIntervalS)*time.Second)
+	}
+
 	b.running = true
 	b.servePreparedServers()
 	b.Log.Info("mautrix-wechat bridge started successfully")
@@ -300,6 +502,11 @@ func (b *Bridge) Stop() error {
 		b.httpListener = nil
 	}
 
+	// Stop sending queued Matrix messages before the providers go away
+	if b.EventRouter != nil {
+		b.EventRouter.Stop()
+	}
+
 	// Stop multi-tenant components
 	if b.SessionManager != nil {
 		b.SessionManager.StopAll()
@@ -431,6 +638,8 @@ func (b *Bridge) prepareMetricsServer() error {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", b.Metrics.Handler())
 	mux.HandleFunc("/health", b.handleHealth)
+	mux.HandleFunc("/readyz", b.handleReady)
+	mux.HandleFunc("GET /status", b.handleStatus)
 
 	b.metricsServer = &http.Server{
 		Addr:         b.Config.Metrics.Listen,
@@ -514,7 +723,10 @@ func (b *Bridge) cleanupStartupLocked() {
 	b.running = false
 }
 
-// handleHealth serves a comprehensive JSON health check response.
+// handleHealth serves a comprehensive JSON health check response. It is a
+// liveness check: the status is 200 as long as the process serves requests,
+// even while WeChat is disconnected or waiting for a QR scan. Use /readyz
+// for readiness.
 func (b *Bridge) handleHealth(w http.ResponseWriter, r *http.Request) {
 	status := b.Metrics.HealthStatus()
 	if b.Provider != nil {
@@ -527,6 +739,20 @@ func (b *Bridge) handleHealth(w http.ResponseWriter, r *http.Request) {
 		status["provider_running"] = false
 	}
 
+	if b.DB != nil {
+		if h := b.DB.Health(); !h.CheckedAt.IsZero() {
+			db := map[string]interface{}{
+				"healthy":    h.Healthy,
+				"checked_at": h.CheckedAt.Unix(),
+			}
+			if !h.Healthy {
+				db["failures"] = h.Failures
+				db["error"] = h.LastError
+			}
+			status["database"] = db
+		}
+	}
+
 	// Include multi-tenant node pool info if available
 	if b.NodePool != nil {
 		status["multi_tenant"] = true
@@ -553,6 +779,7 @@ func (b *Bridge) handleHealth(w http.ResponseWriter, r *http.Request) {
 		status["active_provider"] = b.ProviderManager.ActiveName()
 		status["active_tier"] = b.ProviderManager.ActiveTier()
 		status["provider_count"] = b.ProviderManager.ProviderCount()
+		status["failover_stats"] = b.ProviderManager.Stats()
 
 		states := b.ProviderManager.GetProviderStates()
 		providerInfos := make([]map[string]interface{}, len(states))
@@ -568,21 +795,70 @@ func (b *Bridge) handleHealth(w http.ResponseWriter, r *http.Request) {
 		status["providers"] = providerInfos
 	}
 
+	data, err := json.Marshal(status)
+	if err != nil {
+		b.Log.Error("failed to marshal health status", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
 
-	connected, _ := status["connected"].(bool)
-	if !connected {
-		w.WriteHeader(http.StatusServiceUnavailable)
+// readinessPingTimeout bounds the database ping of a readiness check.
+const readinessPingTimeout = 2 * time.Second
+
+// handleReady serves the readiness check: 200 once the bridge has started
+// (migrations ran), the database answers a ping and the provider is running,
+// and, with metrics.readiness_requires_login, WeChat is logged in. Otherwise
+// it is 503 and the failed checks are listed.
+func (b *Bridge) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+
+	b.mu.Lock()
+	running := b.running
+	b.mu.Unlock()
+	if !running {
+		checks["bridge"] = "not started"
+	}
+
+	if b.DB == nil {
+		checks["database"] = "not initialized"
 	} else {
-		w.WriteHeader(http.StatusOK)
+		ctx, cancel := context.WithTimeout(r.Context(), readinessPingTimeout)
+		err := b.DB.Ping(ctx)
+		cancel()
+		if err != nil {
+			checks["database"] = err.Error()
+		}
 	}
 
-	data, err := json.Marshal(status)
+	// Multi-tenant bridges start providers per user as they log in.
+	if b.Provider != nil {
+		if !b.Provider.IsRunning() {
+			checks["provider"] = "not running"
+		} else if b.Config != nil && b.Config.Metrics.ReadinessRequiresLogin &&
+			b.Provider.GetLoginState() != wechat.LoginStateLoggedIn {
+			checks["login"] = "not logged in"
+		}
+	}
+
+	ready := len(checks) == 0
+	data, err := json.Marshal(map[string]interface{}{
+		"ready":  ready,
+		"failed": checks,
+	})
 	if err != nil {
-		b.Log.Error("failed to marshal health status", "error", err)
+		b.Log.Error("failed to marshal readiness status", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	w.Write(data)
 }
 
@@ -633,11 +909,34 @@ func (b *Bridge) initProviderManager(ctx context.Context) error {
 	return nil
 }
 
+// providerSessions returns the store the shared provider name keeps the
+// bridge user's session in, or nil without a database.
+func (b *Bridge) providerSessions(name string) wechat.SessionStore {
+	if b.DB == nil || b.DB.ProviderSession == nil {
+		return nil
+	}
+	return &providerSessionStore{
+		store:        b.DB.ProviderSession,
+		providerType: name,
+		bridgeUser: func(ctx context.Context) (string, error) {
+			if b.EventRouter == nil {
+				return "", nil
+			}
+			return b.EventRouter.sessionBridgeUser(ctx)
+		},
+	}
+}
+
 // buildProviderConfigFor builds a ProviderConfig for a specific provider.
 func (b *Bridge) buildProviderConfigFor(name string) *wechat.ProviderConfig {
 	cfg := &wechat.ProviderConfig{
-		LogLevel: b.Config.Logging.MinLevel,
-		Extra:    make(map[string]string),
+		LogLevel:     b.Config.Logging.MinLevel,
+		MaxMediaSize: b.Config.Bridge.Media.MaxFileSize,
+		Extra:        make(map[string]string),
+	}
+	if b.Metrics != nil {
+		cfg.Connection = b.Metrics
+		cfg.Sends = b.Metrics
 	}
 
 	switch name {
@@ -647,9 +946,12 @@ func (b *Bridge) buildProviderConfigFor(name string) *wechat.ProviderConfig {
 		cfg.AgentID = b.Config.Providers.WeCom.AgentID
 		cfg.Token = b.Config.Providers.WeCom.Callback.Token
 		cfg.AESKey = b.Config.Providers.WeCom.Callback.AESKey
+		cfg.Capabilities = b.Config.Providers.WeCom.Capabilities
 	case "padpro":
 		cfg.APIEndpoint = b.Config.Providers.PadPro.APIEndpoint
 		cfg.APIToken = b.Config.Providers.PadPro.AuthKey // Used as ?key= query parameter
+		cfg.Capabilities = b.Config.Providers.PadPro.Capabilities
+		cfg.Sessions = b.providerSessions(name)
 		if b.Config.Providers.PadPro.WSEndpoint != "" {
 			cfg.Extra["ws_endpoint"] = b.Config.Providers.PadPro.WSEndpoint
 		}
@@ -659,6 +961,15 @@ func (b *Bridge) buildProviderConfigFor(name string) *wechat.ProviderConfig {
 		if b.Config.Providers.PadPro.CallbackPort > 0 {
 			cfg.Extra["callback_port"] = fmt.Sprintf("%d", b.Config.Providers.PadPro.CallbackPort)
 		}
+		if b.Config.Providers.PadPro.HTTPTimeoutS > 0 {
+			cfg.Extra["http_timeout_s"] = fmt.Sprintf("%d", b.Config.Providers.PadPro.HTTPTimeoutS)
+		}
+		if b.Config.Providers.PadPro.ContactFetchConcurrency > 0 {
+			cfg.Extra["contact_fetch_concurrency"] = fmt.Sprintf("%d", b.Config.Providers.PadPro.ContactFetchConcurrency)
+		}
+		if b.Config.Providers.PadPro.ReorderWindowMs != 0 {
+			cfg.Extra["reorder_window_ms"] = fmt.Sprintf("%d", b.Config.Providers.PadPro.ReorderWindowMs)
+		}
 		// Pass risk control settings via Extra
 		rc := b.Config.Providers.PadPro.RiskControl
 		cfg.Extra["max_messages_per_day"] = fmt.Sprintf("%d", rc.MaxMessagesPerDay)
@@ -673,6 +984,14 @@ func (b *Bridge) buildProviderConfigFor(name string) *wechat.ProviderConfig {
 		cfg.APIEndpoint = b.Config.Providers.IPad.APIEndpoint
 		cfg.APIToken = b.Config.Providers.IPad.APIToken
 		cfg.CallbackURL = b.Config.Providers.IPad.CallbackURL
+		cfg.Capabilities = b.Config.Providers.IPad.Capabilities
+		if b.DB != nil && b.DB.RiskCounter != nil {
+			cfg.RiskCounters = &riskCounterStore{store: b.DB.RiskCounter}
+		}
+		cfg.Sessions = b.providerSessions(name)
+		if b.Config.Providers.IPad.HTTPTimeoutS > 0 {
+			cfg.Extra["http_timeout_s"] = fmt.Sprintf("%d", b.Config.Providers.IPad.HTTPTimeoutS)
+		}
 		// Pass risk control settings via Extra
 		rc := b.Config.Providers.IPad.RiskControl
 		cfg.Extra["max_messages_per_day"] = fmt.Sprintf("%d", rc.MaxMessagesPerDay)
@@ -685,9 +1004,13 @@ func (b *Bridge) buildProviderConfigFor(name string) *wechat.ProviderConfig {
 		}
 	case "pchook":
 		cfg.RPCPort = 19088
+		cfg.Capabilities = b.Config.Providers.PCHook.Capabilities
 		if b.Config.Providers.PCHook.RPCEndpoint != "" {
 			cfg.Extra["rpc_endpoint"] = b.Config.Providers.PCHook.RPCEndpoint
 		}
+		if b.Config.Providers.PCHook.TempMaxAgeS > 0 {
+			cfg.Extra["temp_max_age_s"] = fmt.Sprintf("%d", b.Config.Providers.PCHook.TempMaxAgeS)
+		}
 	}
 
 	return cfg
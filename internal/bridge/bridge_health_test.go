@@ -1,11 +1,17 @@
 package bridge
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/config"
+	"github.com/n42/mautrix-wechat/internal/database"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
@@ -50,7 +56,7 @@ func TestBridgeHandleHealthUsesActualProviderState(t *testing.T) {
 	}
 }
 
-func TestBridgeHandleHealthReturns503ForActualDisconnectedProvider(t *testing.T) {
+func TestBridgeHandleHealthStaysLiveForDisconnectedProvider(t *testing.T) {
 	metrics := NewMetrics()
 	metrics.SetConnected(true)
 	metrics.SetLoginState(int(wechat.LoginStateLoggedIn))
@@ -68,8 +74,8 @@ func TestBridgeHandleHealthReturns503ForActualDisconnectedProvider(t *testing.T)
 	rec := httptest.NewRecorder()
 	b.handleHealth(rec, req)
 
-	if rec.Code != http.StatusServiceUnavailable {
-		t.Fatalf("status = %d", rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 for a live process", rec.Code)
 	}
 
 	var status map[string]interface{}
@@ -84,3 +90,104 @@ func TestBridgeHandleHealthReturns503ForActualDisconnectedProvider(t *testing.T)
 		t.Fatalf("login_state = %d", got)
 	}
 }
+
+func newReadyTestBridge(t *testing.T, provider *mockProvider) (*Bridge, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &Bridge{
+		Config:   &config.Config{},
+		Log:      testBridgeLogger(),
+		DB:       database.NewFromDB(db),
+		Provider: provider,
+		running:  true,
+	}, mock
+}
+
+func serveReady(b *Bridge) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	b.handleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body
+}
+
+func TestBridgeHandleReady(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	provider.running = true
+	provider.loginState = wechat.LoginStateQRCode
+	b, mock := newReadyTestBridge(t, provider)
+
+	// Waiting for a QR scan is ready unless login is required.
+	mock.ExpectPing()
+	if code, body := serveReady(b); code != http.StatusOK || body["ready"] != true {
+		t.Fatalf("status = %d, body = %v, want ready", code, body)
+	}
+
+	b.Config.Metrics.ReadinessRequiresLogin = true
+	mock.ExpectPing()
+	code, body := serveReady(b)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 before login", code)
+	}
+	if failed, _ := body["failed"].(map[string]interface{}); failed["login"] == nil {
+		t.Fatalf("failed = %v, want login", body["failed"])
+	}
+
+	provider.loginState = wechat.LoginStateLoggedIn
+	mock.ExpectPing()
+	if code, _ := serveReady(b); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 once logged in", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestBridgeHandleReadyFailsWhenNotStartedOrDatabaseDown(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	b, mock := newReadyTestBridge(t, provider)
+	b.running = false
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	code, body := serveReady(b)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", code)
+	}
+	failed, _ := body["failed"].(map[string]interface{})
+	for _, check := range []string{"bridge", "database", "provider"} {
+		if failed[check] == nil {
+			t.Errorf("failed = %v, want %s listed", failed, check)
+		}
+	}
+}
+
+func TestBridgeHandleHealthReportsDatabaseCheck(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	b, mock := newReadyTestBridge(t, provider)
+	b.Metrics = NewMetrics()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	b.checkDatabaseHealth(context.Background(), time.Second)
+
+	rec := httptest.NewRecorder()
+	b.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 for a live process", rec.Code)
+	}
+	var status map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unmarshal health: %v", err)
+	}
+	db, _ := status["database"].(map[string]interface{})
+	if db["healthy"] != false || db["error"] != "connection refused" || db["failures"] != float64(1) {
+		t.Fatalf("database = %v", status["database"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// clockSkew estimates how far a provider's clock is off from ours by
+// comparing the timestamps of live messages with when they arrived. Once a
+// full window of samples agrees on an offset larger than the threshold, it is
+// applied to message timestamps until the samples disagree again. Samples
+// that don't agree, e.g. a backlog replayed after a reconnect, disable the
+// correction instead of skewing it.
+type clockSkew struct {
+	window    int
+	threshold time.Duration
+
+	mu        sync.Mutex
+	estimates map[string]*skewEstimate // per bridge user in multi-tenant mode
+}
+
+type skewEstimate struct {
+	samples []time.Duration // arrival time minus provider timestamp
+	next    int
+	offset  time.Duration
+}
+
+// newClockSkew returns a corrector using the last window messages. Offsets
+// are applied when larger than threshold and when all samples lie within
+// threshold of each other.
+func newClockSkew(window int, threshold time.Duration) *clockSkew {
+	return &clockSkew{
+		window:    window,
+		threshold: threshold,
+		estimates: make(map[string]*skewEstimate),
+	}
+}
+
+// observe records msg as received at received and returns the offset that
+// now applies to its provider's timestamps.
+func (c *clockSkew) observe(key string, msg *wechat.Message, received time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.estimates[key]
+	if e == nil {
+		e = &skewEstimate{}
+		c.estimates[key] = e
+	}
+	if msg.Timestamp <= 0 {
+		return e.offset
+	}
+
+	sample := received.Sub(time.UnixMilli(msg.Timestamp))
+	if len(e.samples) < c.window {
+		e.samples = append(e.samples, sample)
+	} else {
+		e.samples[e.next] = sample
+		e.next = (e.next + 1) % c.window
+	}
+	if len(e.samples) < c.window {
+		return e.offset
+	}
+
+	sorted := append([]time.Duration(nil), e.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	consistent := sorted[len(sorted)-1]-sorted[0] <= c.threshold
+	if consistent && (median > c.threshold || median < -c.threshold) {
+		e.offset = median
+	} else {
+		e.offset = 0
+	}
+	return e.offset
+}
+
+// offset returns the offset currently applied for key.
+func (c *clockSkew) offset(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.estimates[key]; e != nil {
+		return e.offset
+	}
+	return 0
+}
+
+// clockSkewKey returns the key whose provider delivered messages under ctx.
+func (er *EventRouter) clockSkewKey(ctx context.Context) string {
+	if !er.multiTenant {
+		return ""
+	}
+	key, _ := ctx.Value(bridgeUserKey).(string)
+	return key
+}
+
+// correctLiveTimestamp feeds a just received message to the clock skew
+// estimate and shifts its timestamp by the current offset.
+func (er *EventRouter) correctLiveTimestamp(ctx context.Context, msg *wechat.Message) {
+	if er.clockSkew == nil || msg.Timestamp <= 0 {
+		return
+	}
+	offset := er.clockSkew.observe(er.clockSkewKey(ctx), msg, time.Now())
+	if offset != 0 {
+		msg.Timestamp += offset.Milliseconds()
+	}
+}
+
+// correctTimestamp shifts a backfilled message's timestamp by the current
+// offset without sampling it, as its age says nothing about the clock.
+func (er *EventRouter) correctTimestamp(ctx context.Context, msg *wechat.Message) {
+	if er.clockSkew == nil || msg.Timestamp <= 0 {
+		return
+	}
+	if offset := er.clockSkew.offset(er.clockSkewKey(ctx)); offset != 0 {
+		msg.Timestamp += offset.Milliseconds()
+	}
+}
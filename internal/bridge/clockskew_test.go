@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestClockSkew_ConsistentSkewIsCorrected(t *testing.T) {
+	er := NewEventRouter(EventRouterConfig{
+		Log:                slog.Default(),
+		ClockSkewWindow:    5,
+		ClockSkewThreshold: 30 * time.Second,
+	})
+	ctx := context.Background()
+
+	// The provider's clock is ten minutes behind; delivery adds some jitter
+	const skew = 10 * time.Minute
+	for i := 0; i < 5; i++ {
+		sent := time.Now().Add(-time.Duration(i) * 200 * time.Millisecond)
+		msg := &wechat.Message{Timestamp: sent.Add(-skew).UnixMilli()}
+		er.correctLiveTimestamp(ctx, msg)
+		if i < 4 && time.Since(time.UnixMilli(msg.Timestamp)) < skew-time.Minute {
+			t.Fatalf("message %d corrected before the window was full", i)
+		}
+		if i == 4 {
+			if d := time.Since(time.UnixMilli(msg.Timestamp)); d < 0 || d > 5*time.Second {
+				t.Fatalf("live message still off by %v after correction", d)
+			}
+		}
+	}
+
+	// Backfilled messages get the same correction
+	original := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	backfilled := &wechat.Message{Timestamp: original.UnixMilli()}
+	er.correctTimestamp(ctx, backfilled)
+	if d := time.UnixMilli(backfilled.Timestamp).Sub(original) - skew; d < -2*time.Second || d > 2*time.Second {
+		t.Fatalf("backfilled timestamp shifted by %v, want about %v", time.UnixMilli(backfilled.Timestamp).Sub(original), skew)
+	}
+}
+
+func TestClockSkew_InconsistentSamplesAreIgnored(t *testing.T) {
+	c := newClockSkew(4, 30*time.Second)
+	now := time.Now()
+
+	// A backlog replayed after a reconnect: old, but not consistently so
+	for _, age := range []time.Duration{time.Hour, 40 * time.Minute, 10 * time.Minute, time.Minute} {
+		c.observe("", &wechat.Message{Timestamp: now.Add(-age).UnixMilli()}, now)
+	}
+	if off := c.offset(""); off != 0 {
+		t.Fatalf("offset = %v for inconsistent samples", off)
+	}
+
+	// Normal delivery latency is below the threshold
+	for i := 0; i < 4; i++ {
+		c.observe("", &wechat.Message{Timestamp: now.Add(-2 * time.Second).UnixMilli()}, now)
+	}
+	if off := c.offset(""); off != 0 {
+		t.Fatalf("offset = %v for normal latency", off)
+	}
+}
+
+func TestClockSkew_DisabledByDefault(t *testing.T) {
+	er := NewEventRouter(EventRouterConfig{Log: slog.Default()})
+	ts := time.Now().Add(-time.Hour).UnixMilli()
+	msg := &wechat.Message{Timestamp: ts}
+	for i := 0; i < 50; i++ {
+		er.correctLiveTimestamp(context.Background(), msg)
+	}
+	if msg.Timestamp != ts {
+		t.Fatal("timestamp changed with clock skew correction disabled")
+	}
+}
@@ -0,0 +1,533 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// CommandProcessor handles management commands that bridge users send to the
+// bridge bot, e.g. "!wechat sync". Commands are recognised by prefix in any
+// room, and without the prefix in the sender's management room.
+type CommandProcessor struct {
+	log       *slog.Logger
+	router    *EventRouter
+	botUserID string
+	prefix    string
+	commands  map[string]*CommandDefinition
+	limiter   *commandRateLimiter
+	auth      CommandAuthorizer
+}
+
+// CommandDefinition describes a single management command.
+type CommandDefinition struct {
+	Name string
+	Help string
+	// Sensitive commands need admin permission rather than user permission.
+	Sensitive bool
+	Handler   func(ctx context.Context, ce *CommandEvent) error
+}
+
+// CommandEvent carries the context of one command invocation.
+type CommandEvent struct {
+	RoomID  string
+	Sender  string
+	Command string
+	Args    []string
+
+	ctx       context.Context
+	processor *CommandProcessor
+}
+
+// Reply sends a notice from the bridge bot back to the room the command came from.
+func (ce *CommandEvent) Reply(format string, args ...interface{}) {
+	ce.processor.reply(ce.ctx, ce.RoomID, fmt.Sprintf(format, args...))
+}
+
+// CommandProcessorConfig holds configuration for the command processor.
+type CommandProcessorConfig struct {
+	Log       *slog.Logger
+	Router    *EventRouter
+	BotUserID string
+	Prefix    string
+	// Cooldowns is the minimum time between two invocations of a command by
+	// the same user, keyed by command name. Commands without an entry are
+	// not rate limited.
+	Cooldowns map[string]time.Duration
+	// Authorizer is consulted before running any command.
+	// When nil, commands are not restricted.
+	Authorizer CommandAuthorizer
+}
+
+// NewCommandProcessor creates a CommandProcessor with the built-in commands registered.
+func NewCommandProcessor(cfg CommandProcessorConfig) *CommandProcessor {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "!wechat"
+	}
+	cp := &CommandProcessor{
+		log:       cfg.Log,
+		router:    cfg.Router,
+		botUserID: cfg.BotUserID,
+		prefix:    prefix,
+		commands:  make(map[string]*CommandDefinition),
+		limiter:   newCommandRateLimiter(cfg.Cooldowns),
+		auth:      cfg.Authorizer,
+	}
+
+	cp.Register(&CommandDefinition{
+		Name:    "help",
+		Help:    "Show this help message",
+		Handler: cp.cmdHelp,
+	})
+	// Logging the bridge's single WeChat account in or out affects every
+	// user; the authorizer decides who may, depending on whether each user
+	// has their own session.
+	cp.Register(&CommandDefinition{
+		Name:      "login",
+		Help:      "Log in to WeChat by scanning a QR code",
+		Sensitive: true,
+		Handler:   cp.cmdLogin,
+	})
+	cp.Register(&CommandDefinition{
+		Name:      "logout",
+		Help:      "Log out of WeChat",
+		Sensitive: true,
+		Handler:   cp.cmdLogout,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "status",
+		Help:    "Show the WeChat login state and active provider",
+		Handler: cp.cmdStatus,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "stats",
+		Help:    "Show messages sent to WeChat per day and today's risk-control limits",
+		Handler: cp.cmdStats,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "sync",
+		Help:    "Re-sync contacts and groups from WeChat",
+		Handler: cp.cmdSync,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "search",
+		Help:    "Search contacts by nickname, remark or alias: search <query>",
+		Handler: cp.cmdSearch,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "dm",
+		Help:    "Open a direct chat with a contact: dm <wechat_id>",
+		Handler: cp.cmdDM,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "refresh",
+		Help:    "Re-fetch a chat's name and avatar from WeChat: refresh [room_id|wechat_id]",
+		Handler: cp.cmdRefresh,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "rename",
+		Help:    "Set a user's display name in the current room only: rename <user> <name>",
+		Handler: cp.cmdRename,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "msg-status",
+		Help:    "Show the delivery state of a message sent to WeChat: msg-status <event_id>",
+		Handler: cp.cmdMsgStatus,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "unbridge",
+		Help:    "Stop bridging the current room and clean up its WeChat data",
+		Handler: cp.cmdUnbridge,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "accept-invite",
+		Help:    "Join a WeChat group you were invited to: accept-invite <number>",
+		Handler: cp.cmdAcceptInvite,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "decline-invite",
+		Help:    "Decline a WeChat group invitation: decline-invite <number>",
+		Handler: cp.cmdDeclineInvite,
+	})
+	cp.Register(&CommandDefinition{
+		Name:      "filter",
+		Help:      "Exclude WeChat chats from bridging: filter list|allow|deny|remove <entry>",
+		Sensitive: true,
+		Handler:   cp.cmdFilter,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "add-friend",
+		Help:    "Send a friend request to a shared or recommended contact: add-friend <ticket> [greeting]",
+		Handler: cp.cmdAddFriend,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "friend-requests",
+		Help:    "List WeChat friend requests awaiting your approval",
+		Handler: cp.cmdFriendRequests,
+	})
+	cp.Register(&CommandDefinition{
+		Name:    "accept-friend",
+		Help:    "Accept a WeChat friend request: accept-friend <wechat_id>",
+		Handler: cp.cmdAcceptFriend,
+	})
+	cp.Register(&CommandDefinition{
+		Name:      "resync-avatars",
+		Help:      "Re-upload puppet avatars missing from the homeserver",
+		Sensitive: true,
+		Handler:   cp.cmdResyncAvatars,
+	})
+
+	return cp
+}
+
+// Register adds a command, replacing any existing command with the same name.
+func (cp *CommandProcessor) Register(cmd *CommandDefinition) {
+	cp.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// IsCommand reports whether a message body is addressed to the command processor.
+func (cp *CommandProcessor) IsCommand(body string) bool {
+	return body == cp.prefix || strings.HasPrefix(body, cp.prefix+" ")
+}
+
+// Handle parses and runs a command from a Matrix message event. When
+// requirePrefix is false (management rooms) the prefix is optional.
+func (cp *CommandProcessor) Handle(ctx context.Context, evt *MatrixEvent, requirePrefix bool) error {
+	if evt.Sender == cp.botUserID {
+		return nil
+	}
+	if msgtype, _ := evt.Content["msgtype"].(string); msgtype != "m.text" {
+		return nil
+	}
+	body, _ := evt.Content["body"].(string)
+	body = strings.TrimSpace(body)
+
+	if cp.IsCommand(body) {
+		body = strings.TrimSpace(strings.TrimPrefix(body, cp.prefix))
+	} else if requirePrefix {
+		return nil
+	}
+
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		fields = []string{"help"}
+	}
+
+	ce := &CommandEvent{
+		RoomID:    evt.RoomID,
+		Sender:    evt.Sender,
+		Command:   strings.ToLower(fields[0]),
+		Args:      fields[1:],
+		ctx:       ctx,
+		processor: cp,
+	}
+
+	cmd, ok := cp.commands[ce.Command]
+	if !ok {
+		ce.Reply("Unknown command `%s`. Use `%s help` for a list of commands.", ce.Command, cp.prefix)
+		return nil
+	}
+
+	if cp.auth != nil {
+		allowed, err := cp.auth.Authorize(ctx, ce.Sender, cmd)
+		if err != nil {
+			ce.Reply("Could not check permissions for `%s`, please try again later.", cmd.Name)
+			return fmt.Errorf("authorize command %s: %w", cmd.Name, err)
+		}
+		if !allowed {
+			cp.log.Warn("denied management command", "command", cmd.Name, "sender", ce.Sender)
+			ce.Reply("You don't have permission to run `%s`.", cmd.Name)
+			return nil
+		}
+	}
+
+	if wait := cp.limiter.allow(ce.Sender, cmd.Name, time.Now()); wait > 0 {
+		ce.Reply("Please wait %s before running `%s` again.", formatCooldown(wait), cmd.Name)
+		return nil
+	}
+
+	cp.log.Info("running management command", "command", cmd.Name, "sender", ce.Sender, "room_id", ce.RoomID)
+	if err := cmd.Handler(ctx, ce); err != nil {
+		ce.Reply("Command `%s` failed: %v", cmd.Name, err)
+		return fmt.Errorf("command %s: %w", cmd.Name, err)
+	}
+	return nil
+}
+
+func (cp *CommandProcessor) reply(ctx context.Context, roomID, text string) {
+	if cp.router == nil || cp.router.matrixClient == nil {
+		cp.log.Warn("matrix client not initialized, dropping command reply", "room_id", roomID)
+		return
+	}
+	_, err := cp.router.matrixClient.SendMessage(ctx, roomID, cp.botUserID, "m.room.message", map[string]interface{}{
+		"msgtype": "m.notice",
+		"body":    text,
+	})
+	if err != nil {
+		cp.log.Error("failed to send command reply", "error", err, "room_id", roomID)
+	}
+}
+
+// --- Built-in commands ---
+
+func (cp *CommandProcessor) cmdHelp(_ context.Context, ce *CommandEvent) error {
+	names := make([]string, 0, len(cp.commands))
+	for name := range cp.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("Available commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s %s - %s\n", cp.prefix, name, cp.commands[name].Help)
+	}
+	ce.Reply("%s", strings.TrimRight(sb.String(), "\n"))
+	return nil
+}
+
+func (cp *CommandProcessor) cmdSync(ctx context.Context, ce *CommandEvent) error {
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+
+	contacts, groups, err := cp.router.SyncContacts(ctx, provider, ce.Sender)
+	if err != nil {
+		return err
+	}
+
+	ce.Reply("Synced %d contacts and %d groups.", contacts, groups)
+	return nil
+}
+
+// maxSearchResults caps how many contacts the search command lists.
+const maxSearchResults = 20
+
+func (cp *CommandProcessor) cmdSearch(ctx context.Context, ce *CommandEvent) error {
+	query := strings.ToLower(strings.Join(ce.Args, " "))
+	if query == "" {
+		ce.Reply("Usage: `%s search <query>`", cp.prefix)
+		return nil
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	contacts, err := provider.GetContactList(ctx)
+	if err != nil {
+		return fmt.Errorf("get contact list: %w", err)
+	}
+
+	var matches []*wechat.ContactInfo
+	for _, contact := range contacts {
+		if !contact.IsGroup && contactMatches(contact, query) {
+			matches = append(matches, contact)
+		}
+	}
+	if len(matches) == 0 {
+		ce.Reply("No contacts found matching %q.", query)
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Found %d contacts:\n", len(matches))
+	for i, contact := range matches {
+		if i == maxSearchResults {
+			fmt.Fprintf(&sb, "...and %d more, refine your query to see them\n", len(matches)-maxSearchResults)
+			break
+		}
+		name := contact.Nickname
+		if contact.Remark != "" {
+			name = fmt.Sprintf("%s (%s)", contact.Remark, contact.Nickname)
+		}
+		fmt.Fprintf(&sb, "- %s: `%s`\n", name, contact.UserID)
+	}
+	fmt.Fprintf(&sb, "Use `%s dm <wechat_id>` to start a chat.", cp.prefix)
+	ce.Reply("%s", sb.String())
+	return nil
+}
+
+// contactMatches reports whether a contact's nickname, remark, alias or ID
+// contains the lower-cased query.
+func contactMatches(contact *wechat.ContactInfo, query string) bool {
+	for _, field := range []string{contact.Nickname, contact.Remark, contact.Alias, contact.UserID} {
+		if field != "" && strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *CommandProcessor) cmdDM(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) != 1 {
+		ce.Reply("Usage: `%s dm <wechat_id>`", cp.prefix)
+		return nil
+	}
+	wechatID := ce.Args[0]
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	contact, err := provider.GetContactInfo(ctx, wechatID)
+	if err != nil {
+		return fmt.Errorf("get contact info: %w", err)
+	}
+	if contact == nil {
+		ce.Reply("Contact `%s` not found.", wechatID)
+		return nil
+	}
+	if contact.IsGroup {
+		ce.Reply("`%s` is a group chat, not a contact.", wechatID)
+		return nil
+	}
+
+	room, err := cp.router.OpenDirectChat(ctx, contact, ce.Sender)
+	if err != nil {
+		return err
+	}
+
+	ce.Reply("Opened a chat with %s: %s", contactDisplayName(contact), matrixRoomLink(room.MatrixRoomID))
+	return nil
+}
+
+func (cp *CommandProcessor) cmdAcceptInvite(ctx context.Context, ce *CommandEvent) error {
+	return cp.respondGroupInvite(ctx, ce, true)
+}
+
+func (cp *CommandProcessor) cmdDeclineInvite(ctx context.Context, ce *CommandEvent) error {
+	return cp.respondGroupInvite(ctx, ce, false)
+}
+
+// respondGroupInvite answers a group invitation announced in the management room.
+func (cp *CommandProcessor) respondGroupInvite(ctx context.Context, ce *CommandEvent, accept bool) error {
+	id := 0
+	if len(ce.Args) == 1 {
+		id, _ = strconv.Atoi(ce.Args[0])
+	}
+	if id <= 0 {
+		ce.Reply("Usage: `%s %s <number>`", cp.prefix, ce.Command)
+		return nil
+	}
+	invite := cp.router.groupInvites.get(ce.Sender, id)
+	if invite == nil {
+		ce.Reply("No pending group invite #%d.", id)
+		return nil
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+	if !provider.Capabilities().GroupInvite {
+		ce.Reply("The current WeChat provider can't answer group invites.")
+		return nil
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	if err := provider.RespondGroupInvite(ctx, invite, accept); err != nil {
+		return fmt.Errorf("respond to group invite: %w", err)
+	}
+	cp.router.groupInvites.remove(ce.Sender, id)
+
+	if accept {
+		ce.Reply("Joined %s. Its room will appear once WeChat delivers the first message.", groupInviteName(invite))
+	} else {
+		ce.Reply("Declined the invitation to %s.", groupInviteName(invite))
+	}
+	return nil
+}
+
+// contactDisplayName prefers the remark the user set over the contact's nickname.
+func contactDisplayName(contact *wechat.ContactInfo) string {
+	if contact.Remark != "" {
+		return contact.Remark
+	}
+	if contact.Nickname != "" {
+		return contact.Nickname
+	}
+	return contact.UserID
+}
+
+func (cp *CommandProcessor) cmdResyncAvatars(ctx context.Context, ce *CommandEvent) error {
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	checked, restored, err := cp.router.ResyncStaleAvatars(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	ce.Reply("Checked %d avatars, restored %d.", checked, restored)
+	return nil
+}
+
+// --- Rate limiting ---
+
+// commandRateLimiter enforces a per-user cooldown for each command.
+type commandRateLimiter struct {
+	mu        sync.Mutex
+	cooldowns map[string]time.Duration
+	lastRun   map[string]time.Time // key: user + "\x00" + command
+}
+
+func newCommandRateLimiter(cooldowns map[string]time.Duration) *commandRateLimiter {
+	return &commandRateLimiter{
+		cooldowns: cooldowns,
+		lastRun:   make(map[string]time.Time),
+	}
+}
+
+// allow records an invocation and returns zero, or returns the remaining
+// cooldown without recording anything if the user ran the command too recently.
+func (l *commandRateLimiter) allow(userID, command string, now time.Time) time.Duration {
+	cooldown := l.cooldowns[command]
+	if cooldown <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := userID + "\x00" + command
+	if last, ok := l.lastRun[key]; ok {
+		if elapsed := now.Sub(last); elapsed < cooldown {
+			return cooldown - elapsed
+		}
+	}
+	l.lastRun[key] = now
+	return 0
+}
+
+func formatCooldown(d time.Duration) string {
+	if d < time.Second {
+		return "1s"
+	}
+	return d.Round(time.Second).String()
+}
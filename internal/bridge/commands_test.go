@@ -0,0 +1,373 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func newTestCommandProcessor(matrix *testMatrixClient, provider *mockProvider, cooldowns map[string]time.Duration) *CommandProcessor {
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      newTestPuppetManager(),
+		Provider:     provider,
+		MatrixClient: matrix,
+	})
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    er,
+		BotUserID: "@wechatbot:example.com",
+		Cooldowns: cooldowns,
+	})
+	er.SetCommandProcessor(cp)
+	return cp
+}
+
+func newCommandEvent(body string) *MatrixEvent {
+	return &MatrixEvent{
+		ID:      "$cmd:test",
+		Type:    "m.room.message",
+		RoomID:  "!mgmt:test",
+		Sender:  "@user:test",
+		Content: map[string]interface{}{"msgtype": "m.text", "body": body},
+	}
+}
+
+func lastReply(t *testing.T, matrix *testMatrixClient) string {
+	t.Helper()
+	if len(matrix.sent) == 0 {
+		t.Fatal("expected a command reply")
+	}
+	content, _ := matrix.sent[len(matrix.sent)-1].content.(map[string]interface{})
+	body, _ := content["body"].(string)
+	return body
+}
+
+func TestCommandProcessor_IsCommand(t *testing.T) {
+	cp := newTestCommandProcessor(&testMatrixClient{}, newMockProvider("padpro", 2), nil)
+
+	if !cp.IsCommand("!wechat sync") || !cp.IsCommand("!wechat") {
+		t.Fatal("expected prefixed bodies to be commands")
+	}
+	if cp.IsCommand("!wechatsync") || cp.IsCommand("hello") {
+		t.Fatal("unexpected command match")
+	}
+}
+
+func TestCommandProcessor_SyncRateLimited(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), map[string]time.Duration{
+		"sync": time.Minute,
+	})
+	ctx := context.Background()
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat sync"), true); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "Synced") {
+		t.Fatalf("unexpected first reply: %q", reply)
+	}
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat sync"), true); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "Please wait") || !strings.Contains(reply, "sync") {
+		t.Fatalf("expected cooldown reply, got %q", reply)
+	}
+}
+
+func TestCommandProcessor_CooldownIsPerUser(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), map[string]time.Duration{
+		"sync": time.Minute,
+	})
+	ctx := context.Background()
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat sync"), true); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	other := newCommandEvent("!wechat sync")
+	other.Sender = "@other:test"
+	if err := cp.Handle(ctx, other, true); err != nil {
+		t.Fatalf("other user sync: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "Synced") {
+		t.Fatalf("expected other user to run sync, got %q", reply)
+	}
+}
+
+func TestCommandProcessor_UnknownCommand(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat frobnicate"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "Unknown command") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestCommandProcessor_IgnoresBotAndUnprefixed(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	ctx := context.Background()
+
+	botEvt := newCommandEvent("help")
+	botEvt.Sender = "@wechatbot:example.com"
+	if err := cp.Handle(ctx, botEvt, false); err != nil {
+		t.Fatalf("Handle bot: %v", err)
+	}
+	if err := cp.Handle(ctx, newCommandEvent("hello there"), true); err != nil {
+		t.Fatalf("Handle unprefixed: %v", err)
+	}
+	if len(matrix.sent) != 0 {
+		t.Fatalf("expected no replies, got %d", len(matrix.sent))
+	}
+}
+
+func TestEventRouter_HandleMatrixEvent_RoutesCommands(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	cp := newTestCommandProcessor(matrix, provider, nil)
+
+	if err := cp.router.HandleMatrixEvent(context.Background(), newCommandEvent("!wechat help")); err != nil {
+		t.Fatalf("HandleMatrixEvent: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "!wechat sync") {
+		t.Fatalf("unexpected help reply: %q", reply)
+	}
+	if len(provider.sentTexts) != 0 {
+		t.Fatalf("command should not be bridged, sent %q", provider.sentTexts)
+	}
+}
+
+type stubAuthorizer struct {
+	allowed bool
+	checked []string
+}
+
+func (a *stubAuthorizer) Authorize(_ context.Context, userID string, cmd *CommandDefinition) (bool, error) {
+	a.checked = append(a.checked, userID+"/"+cmd.Name)
+	return a.allowed, nil
+}
+
+func TestCommandProcessor_AuthorizerDeniesSensitiveCommand(t *testing.T) {
+	matrix := &testMatrixClient{}
+	auth := &stubAuthorizer{allowed: false}
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:        slog.Default(),
+		Router:     NewEventRouter(EventRouterConfig{Log: slog.Default(), Puppets: newTestPuppetManager(), MatrixClient: matrix}),
+		BotUserID:  "@wechatbot:example.com",
+		Authorizer: auth,
+	})
+
+	ran := false
+	cp.Register(&CommandDefinition{
+		Name:      "logout",
+		Sensitive: true,
+		Handler: func(_ context.Context, _ *CommandEvent) error {
+			ran = true
+			return nil
+		},
+	})
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat logout"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if ran {
+		t.Fatal("sensitive command ran despite being denied")
+	}
+	if len(auth.checked) != 1 || auth.checked[0] != "@user:test/logout" {
+		t.Fatalf("unexpected authorizer calls: %v", auth.checked)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "permission") {
+		t.Fatalf("expected permission denied reply, got %q", reply)
+	}
+
+	// Non-sensitive commands consult the authorizer too.
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat help"), true); err != nil {
+		t.Fatalf("help: %v", err)
+	}
+	if len(auth.checked) != 2 || auth.checked[1] != "@user:test/help" {
+		t.Fatalf("authorizer not consulted for non-sensitive command: %v", auth.checked)
+	}
+}
+
+func TestCommandProcessor_PermissionsGateEveryCommand(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    NewEventRouter(EventRouterConfig{Log: slog.Default(), Puppets: newTestPuppetManager(), Provider: newMockProvider("padpro", 2), MatrixClient: matrix}),
+		BotUserID: "@wechatbot:example.com",
+		Authorizer: NewPermissionAuthorizer(map[string]string{
+			"*":    PermissionRelay,
+			"test": PermissionUser,
+		}),
+	})
+	ctx := context.Background()
+
+	stranger := newCommandEvent("!wechat sync")
+	stranger.Sender = "@eve:other.org"
+	if err := cp.Handle(ctx, stranger, true); err != nil {
+		t.Fatalf("stranger sync: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "permission") {
+		t.Fatalf("expected relay user to be refused sync, got %q", reply)
+	}
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat sync"), true); err != nil {
+		t.Fatalf("user sync: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "Synced") {
+		t.Fatalf("expected user to run sync, got %q", reply)
+	}
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat logout"), true); err != nil {
+		t.Fatalf("user logout: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "permission") {
+		t.Fatalf("expected user to be refused sensitive logout, got %q", reply)
+	}
+}
+
+func TestCommandProcessor_SearchByNicknameSubstring(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{
+		{UserID: "wxid_alice", Nickname: "Alice Wang"},
+		{UserID: "wxid_bob", Nickname: "Bob", Remark: "Bob from work"},
+		{UserID: "wxid_carol", Nickname: "Carol", Alias: "alicefan"},
+		{UserID: "123@chatroom", Nickname: "Alice's group", IsGroup: true},
+	}
+	cp := newTestCommandProcessor(matrix, provider, nil)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat search ALICE"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	reply := lastReply(t, matrix)
+	for _, want := range []string{"Found 2 contacts", "`wxid_alice`", "`wxid_carol`", "!wechat dm <wechat_id>"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply missing %q: %q", want, reply)
+		}
+	}
+	if strings.Contains(reply, "wxid_bob") || strings.Contains(reply, "@chatroom") {
+		t.Errorf("reply contains non-matching contacts: %q", reply)
+	}
+}
+
+func TestCommandProcessor_SearchDeniesNonOwner(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{{UserID: "wxid_alice", Nickname: "Alice Wang"}}
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.auth = NewPermissionAuthorizer(map[string]string{
+		"*":           PermissionRelay,
+		"@owner:test": PermissionAdmin,
+	})
+
+	other := newCommandEvent("!wechat search alice")
+	other.Sender = "@neighbour:test"
+	if err := cp.Handle(context.Background(), other, true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	reply := lastReply(t, matrix)
+	if !strings.Contains(reply, "permission") || strings.Contains(reply, "wxid_alice") {
+		t.Fatalf("expected non-owner to be denied without seeing contacts, got %q", reply)
+	}
+}
+
+func TestCommandProcessor_SearchWithoutQueryShowsUsage(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat search"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "Usage:") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestCommandProcessor_DMCreatesRoomAndJoinsPuppet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs("wxid_alice", "@user:test").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WithArgs("wxid_alice", "!room:test", "@user:test", false, "", "", "", false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{{UserID: "wxid_alice", Nickname: "Alice"}}
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+	cp.router.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice", MatrixUserID: "@wechat_wxid_alice:example.com"}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat dm wxid_alice"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(matrix.joined) != 1 || matrix.joined[0] != "@wechat_wxid_alice:example.com" {
+		t.Fatalf("joined = %v, want the contact's puppet", matrix.joined)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "Alice") || !strings.Contains(reply, "!room:test") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCommandProcessor_DMRefusesStranger(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{{UserID: "wxid_alice", Nickname: "Alice"}}
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.auth = NewPermissionAuthorizer(map[string]string{
+		"*":               PermissionRelay,
+		"@owner:test":     PermissionAdmin,
+		"@colleague:test": PermissionUser,
+	})
+
+	stranger := newCommandEvent("!wechat dm wxid_alice")
+	stranger.Sender = "@stranger:test"
+	if err := cp.Handle(context.Background(), stranger, true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "permission") {
+		t.Fatalf("expected stranger to be refused, got %q", reply)
+	}
+	if len(matrix.createdRooms) != 0 || len(matrix.joined) != 0 {
+		t.Fatalf("stranger opened a DM: rooms=%v joined=%v", matrix.createdRooms, matrix.joined)
+	}
+}
+
+func TestCommandProcessor_DMUnknownContact(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat dm wxid_nobody"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); reply != "Contact `wxid_nobody` not found." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if len(matrix.joined) != 0 {
+		t.Fatalf("unexpected joins: %v", matrix.joined)
+	}
+}
@@ -0,0 +1,182 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// contactSyncWorkers bounds how many contacts and groups are synced in
+// parallel, so a large contact list doesn't trip provider rate limits.
+const contactSyncWorkers = 4
+
+// defaultContactPageSize is used when no contact sync page size is configured.
+const defaultContactPageSize = 100
+
+// errContactSyncLimit stops contact paging once the sync limit is reached.
+var errContactSyncLimit = errors.New("contact sync limit reached")
+
+// SyncContacts fetches the bridge user's contacts and groups, creating or
+// updating a puppet for every contact and refreshing the stored members of
+// every group. When direct chat list sync is enabled, a room is also
+// created for each chat up front instead of on its first message.
+//
+// Contacts are processed one page at a time and syncing stops after the
+// configured contact limit, so a huge contact list can't exhaust memory.
+func (er *EventRouter) SyncContacts(ctx context.Context, provider wechat.Provider, bridgeUserID string) (contacts, groups int, err error) {
+	if provider == nil {
+		return 0, 0, fmt.Errorf("no active provider")
+	}
+	ctx = context.WithValue(ctx, bridgeUserKey, bridgeUserID)
+
+	groupList, err := provider.GetGroupList(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get group list: %w", err)
+	}
+
+	err = er.forEachContactPage(ctx, provider, func(page []*wechat.ContactInfo) error {
+		if er.contactSyncLimit > 0 && contacts+len(page) > er.contactSyncLimit {
+			page = page[:er.contactSyncLimit-contacts]
+		}
+		forEachBounded(page, contactSyncWorkers, func(contact *wechat.ContactInfo) {
+			er.syncContact(ctx, contact, bridgeUserID)
+		})
+		contacts += len(page)
+		if er.contactSyncLimit > 0 && contacts >= er.contactSyncLimit {
+			return errContactSyncLimit
+		}
+		return nil
+	})
+	if errors.Is(err, errContactSyncLimit) {
+		er.log.Warn("sync: contact limit reached, remaining contacts skipped",
+			"limit", er.contactSyncLimit, "bridge_user", bridgeUserID)
+	} else if err != nil {
+		return contacts, 0, fmt.Errorf("get contact list: %w", err)
+	}
+
+	forEachBounded(groupList, contactSyncWorkers, func(group *wechat.ContactInfo) {
+		er.syncGroup(ctx, provider, group, bridgeUserID)
+	})
+
+	return contacts, len(groupList), nil
+}
+
+// forEachContactPage calls fn with the provider's contacts one page at a
+// time. Providers that can't page have their full list split into pages.
+func (er *EventRouter) forEachContactPage(ctx context.Context, provider wechat.Provider, fn func([]*wechat.ContactInfo) error) error {
+	pageSize := er.contactPageSize
+	if pageSize <= 0 {
+		pageSize = defaultContactPageSize
+	}
+	if pager, ok := provider.(wechat.ContactPager); ok {
+		return pager.ForEachContactPage(ctx, pageSize, fn)
+	}
+
+	contactList, err := provider.GetContactList(ctx)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(contactList); start += pageSize {
+		end := start + pageSize
+		if end > len(contactList) {
+			end = len(contactList)
+		}
+		if err := fn(contactList[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncContact updates a contact's puppet and, when direct chat list sync is
+// enabled, makes sure the contact has a room.
+func (er *EventRouter) syncContact(ctx context.Context, contact *wechat.ContactInfo, bridgeUserID string) {
+	if contact.IsGroup {
+		return
+	}
+	if err := er.OnContactUpdate(ctx, contact); err != nil {
+		er.log.Warn("sync: failed to update contact", "error", err, "user_id", contact.UserID)
+		return
+	}
+	if er.syncDirectChats && er.matrixClient != nil {
+		if _, err := er.getOrCreateRoom(ctx, contact.UserID, false, bridgeUserID); err != nil && !errors.Is(err, errChatFiltered) {
+			er.log.Warn("sync: failed to create direct chat room", "error", err, "user_id", contact.UserID)
+		}
+	}
+}
+
+// syncGroup refreshes the stored member list of a group and, when direct
+// chat list sync is enabled, makes sure the group has a room.
+func (er *EventRouter) syncGroup(ctx context.Context, provider wechat.Provider, group *wechat.ContactInfo, bridgeUserID string) {
+	if er.groupMembers != nil {
+		members, err := provider.GetGroupMembers(ctx, group.UserID)
+		if err != nil {
+			er.log.Warn("sync: failed to get group members", "error", err, "group_id", group.UserID)
+		} else {
+			now := time.Now()
+			for _, m := range members {
+				if err := er.groupMembers.Upsert(ctx, &database.GroupMemberRow{
+					GroupID:     group.UserID,
+					WeChatID:    m.UserID,
+					DisplayName: m.DisplayName,
+					IsAdmin:     m.IsAdmin,
+					IsOwner:     m.IsOwner,
+					JoinedAt:    &now,
+				}); err != nil {
+					er.log.Error("sync: failed to upsert group member", "error", err, "group_id", group.UserID, "user_id", m.UserID)
+				}
+			}
+		}
+	}
+
+	if er.syncDirectChats && er.matrixClient != nil {
+		if _, err := er.getOrCreateRoom(ctx, group.UserID, true, bridgeUserID); err != nil && !errors.Is(err, errChatFiltered) {
+			er.log.Warn("sync: failed to create group room", "error", err, "group_id", group.UserID)
+		}
+	}
+}
+
+// syncContactsOnLogin runs SyncContacts in the background after a login.
+func (er *EventRouter) syncContactsOnLogin(bridgeUserID string) {
+	ctx := context.WithValue(context.Background(), bridgeUserKey, bridgeUserID)
+	provider, err := er.getProviderForUser(ctx, bridgeUserID)
+	if err != nil || provider == nil {
+		er.log.Warn("no provider for contact sync after login", "error", err, "bridge_user", bridgeUserID)
+		return
+	}
+
+	contacts, groups, err := er.SyncContacts(ctx, provider, bridgeUserID)
+	if err != nil {
+		er.log.Error("contact sync after login failed", "error", err, "bridge_user", bridgeUserID)
+		return
+	}
+	er.log.Info("synced contacts after login",
+		"bridge_user", bridgeUserID, "contacts", contacts, "groups", groups)
+}
+
+// forEachBounded calls fn for every contact using at most workers goroutines
+// and returns once all calls have finished.
+func forEachBounded(items []*wechat.ContactInfo, workers int, fn func(*wechat.ContactInfo)) {
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item *wechat.ContactInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(item)
+		}(item)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,177 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestEventRouter_SyncContacts_PopulatesPuppetsAndGroupMembers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{
+		{UserID: "wxid_a", Nickname: "Alice"},
+		{UserID: "wxid_b", Nickname: "Bob"},
+	}
+	provider.groups = []*wechat.ContactInfo{{UserID: "123@chatroom", Nickname: "Team", IsGroup: true}}
+	provider.groupMembers = []*wechat.GroupMember{
+		{UserID: "wxid_a", DisplayName: "Al"},
+		{UserID: "wxid_b", IsOwner: true},
+	}
+
+	pm := newTestPuppetManager()
+	pm.puppets["wxid_a"] = &Puppet{WeChatID: "wxid_a", Nickname: "Alice", MatrixUserID: "@wechat_wxid_a:example.com"}
+	pm.puppets["wxid_b"] = &Puppet{WeChatID: "wxid_b", Nickname: "Bob", MatrixUserID: "@wechat_wxid_b:example.com"}
+
+	for _, id := range []string{"wxid_a", "wxid_b"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WithArgs("123@chatroom", id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      pm,
+		Provider:     provider,
+		GroupMembers: database.NewGroupMemberStore(db),
+	})
+
+	contacts, groups, err := er.SyncContacts(context.Background(), provider, "@user:test")
+	if err != nil {
+		t.Fatalf("SyncContacts: %v", err)
+	}
+	if contacts != 2 || groups != 1 {
+		t.Fatalf("synced %d contacts and %d groups, want 2 and 1", contacts, groups)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// pagingProvider serves a large generated contact list page by page.
+type pagingProvider struct {
+	*mockProvider
+	total    int
+	pages    int
+	maxPage  int
+	fullList bool
+}
+
+func (p *pagingProvider) GetContactList(context.Context) ([]*wechat.ContactInfo, error) {
+	p.fullList = true
+	return nil, nil
+}
+
+func (p *pagingProvider) ForEachContactPage(_ context.Context, pageSize int, fn func([]*wechat.ContactInfo) error) error {
+	for start := 0; start < p.total; start += pageSize {
+		var page []*wechat.ContactInfo
+		for i := start; i < start+pageSize && i < p.total; i++ {
+			page = append(page, &wechat.ContactInfo{UserID: fmt.Sprintf("wxid_%05d", i)})
+		}
+		p.pages++
+		if len(page) > p.maxPage {
+			p.maxPage = len(page)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestEventRouter_SyncContacts_PagesAndCapsLargeContactList(t *testing.T) {
+	provider := &pagingProvider{mockProvider: newMockProvider("padpro", 2), total: 10000}
+	er := NewEventRouter(EventRouterConfig{
+		Log:                 testBridgeLogger(),
+		Puppets:             newTestPuppetManager(),
+		Provider:            provider,
+		ContactSyncPageSize: 100,
+		ContactSyncLimit:    2550,
+	})
+
+	contacts, _, err := er.SyncContacts(context.Background(), provider, "@user:test")
+	if err != nil {
+		t.Fatalf("SyncContacts: %v", err)
+	}
+	if contacts != 2550 {
+		t.Fatalf("synced %d contacts, want the 2550 limit", contacts)
+	}
+	if provider.fullList {
+		t.Fatal("the full contact list was loaded instead of paging")
+	}
+	// Pages beyond the limit are never fetched and no page exceeds the size.
+	if provider.pages != 26 || provider.maxPage != 100 {
+		t.Fatalf("fetched %d pages of at most %d contacts, want 26 of 100", provider.pages, provider.maxPage)
+	}
+}
+
+func TestEventRouter_SyncContacts_SplitsUnpagedContactList(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	for i := 0; i < 250; i++ {
+		provider.contacts = append(provider.contacts, &wechat.ContactInfo{UserID: fmt.Sprintf("wxid_%03d", i)})
+	}
+	er := NewEventRouter(EventRouterConfig{
+		Log:                 testBridgeLogger(),
+		Puppets:             newTestPuppetManager(),
+		Provider:            provider,
+		ContactSyncPageSize: 100,
+	})
+
+	var pages []int
+	err := er.forEachContactPage(context.Background(), provider, func(page []*wechat.ContactInfo) error {
+		pages = append(pages, len(page))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("forEachContactPage: %v", err)
+	}
+	if len(pages) != 3 || pages[0] != 100 || pages[2] != 50 {
+		t.Fatalf("pages = %v, want 100, 100, 50", pages)
+	}
+	contacts, _, err := er.SyncContacts(context.Background(), provider, "@user:test")
+	if err != nil || contacts != 250 {
+		t.Fatalf("SyncContacts = %d, %v; want all 250 contacts without a limit", contacts, err)
+	}
+}
+
+func TestForEachBounded_LimitsConcurrency(t *testing.T) {
+	items := make([]*wechat.ContactInfo, 20)
+	for i := range items {
+		items[i] = &wechat.ContactInfo{}
+	}
+
+	var running, peak, calls atomic.Int32
+	forEachBounded(items, 3, func(*wechat.ContactInfo) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		calls.Add(1)
+	})
+
+	if calls.Load() != 20 {
+		t.Fatalf("calls = %d, want 20", calls.Load())
+	}
+	if peak.Load() > 3 {
+		t.Fatalf("peak concurrency = %d, want at most 3", peak.Load())
+	}
+}
@@ -0,0 +1,133 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// maxContactCards bounds how many received contact cards are remembered for
+// the add-friend command. The oldest are forgotten first.
+const maxContactCards = 500
+
+// contactCards remembers received contact cards and recommendations by their
+// verification ticket, so the add-friend command can find whom to add.
+type contactCards struct {
+	mu    sync.Mutex
+	cards map[string]*wechat.ContactCard
+	order []string // tickets, oldest first
+}
+
+func newContactCards() *contactCards {
+	return &contactCards{cards: make(map[string]*wechat.ContactCard)}
+}
+
+// add remembers card under its ticket.
+func (c *contactCards) add(card *wechat.ContactCard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cards[card.Ticket]; !ok {
+		c.order = append(c.order, card.Ticket)
+	}
+	c.cards[card.Ticket] = card
+	for len(c.order) > maxContactCards {
+		delete(c.cards, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get returns the card with the given ticket, or nil.
+func (c *contactCards) get(ticket string) *wechat.ContactCard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cards[ticket]
+}
+
+// contactCardToMatrix renders a shared contact card or contact
+// recommendation as text, with the command to add the contact when WeChat
+// sent a ticket for it.
+func (er *EventRouter) contactCardToMatrix(msg *wechat.Message) *MatrixEventContent {
+	card := msg.Card
+	if card.Ticket != "" {
+		er.contactCards.add(card)
+	}
+	prefix := "!wechat"
+	if er.commands != nil {
+		prefix = er.commands.prefix
+	}
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content: map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    formatContactCard(msg.Type, card, prefix),
+		},
+	}
+}
+
+// formatContactCard renders a contact card, e.g.
+//
+//	👤 Recommended contact: Bob (WeChat ID: bob_88)
+//	Region: Guangdong Shenzhen
+//	You may know Bob from your phone contacts
+//	Add them with: !wechat add-friend v4_...
+func formatContactCard(t wechat.MsgType, card *wechat.ContactCard, prefix string) string {
+	kind := "Contact card"
+	if t == wechat.MsgRecommend {
+		kind = "Recommended contact"
+	}
+	name := card.Nickname
+	if name == "" {
+		name = card.UserID
+	}
+	lines := []string{"👤 " + kind + ": " + name}
+	if card.Alias != "" {
+		lines[0] += " (WeChat ID: " + card.Alias + ")"
+	}
+	if card.Region != "" {
+		lines = append(lines, "Region: "+card.Region)
+	}
+	if card.Reason != "" {
+		lines = append(lines, card.Reason)
+	}
+	if card.Ticket != "" {
+		lines = append(lines, "Add them with: "+prefix+" add-friend "+card.Ticket)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (cp *CommandProcessor) cmdAddFriend(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) == 0 {
+		ce.Reply("Usage: `%s add-friend <ticket> [greeting]`", cp.prefix)
+		return nil
+	}
+	card := cp.router.contactCards.get(ce.Args[0])
+	if card == nil {
+		ce.Reply("No contact card with that ticket. It may have expired; ask for the card to be shared again.")
+		return nil
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	adder, ok := provider.(wechat.FriendAdder)
+	if !ok {
+		ce.Reply("The current WeChat provider can't send friend requests.")
+		return nil
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	if err := adder.AddFriend(ctx, card, strings.Join(ce.Args[1:], " ")); err != nil {
+		return fmt.Errorf("add friend: %w", err)
+	}
+	name := card.Nickname
+	if name == "" {
+		name = card.UserID
+	}
+	ce.Reply("Sent a friend request to %s.", name)
+	return nil
+}
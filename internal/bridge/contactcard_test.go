@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// friendAddingProvider is a mockProvider that can send friend requests.
+type friendAddingProvider struct {
+	*mockProvider
+	added     []*wechat.ContactCard
+	greetings []string
+}
+
+func (p *friendAddingProvider) AddFriend(_ context.Context, card *wechat.ContactCard, greeting string) error {
+	p.added = append(p.added, card)
+	p.greetings = append(p.greetings, greeting)
+	return nil
+}
+
+func TestEventRouter_ContactRecommendationAndAddFriend(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &friendAddingProvider{mockProvider: newMockProvider("padpro", 2)}
+	cp := newTestCommandProcessor(matrix, provider.mockProvider, nil)
+	cp.router.SetProvider(provider)
+
+	content, err := cp.router.convertWeChatMessage(context.Background(), &wechat.Message{
+		MsgID: "rec1", Type: wechat.MsgRecommend, FromUser: "fmessage",
+		Card: &wechat.ContactCard{
+			UserID: "v3_bob@stranger", Nickname: "Bob", Alias: "bob_88", Region: "Guangdong Shenzhen",
+			Reason: "You may know Bob from your phone contacts", Ticket: "v4_bob@stranger", Scene: 10,
+		},
+	})
+	if err != nil {
+		t.Fatalf("convertWeChatMessage: %v", err)
+	}
+	body, _ := content.Content["body"].(string)
+	want := "👤 Recommended contact: Bob (WeChat ID: bob_88)\nRegion: Guangdong Shenzhen\n" +
+		"You may know Bob from your phone contacts\nAdd them with: !wechat add-friend v4_bob@stranger"
+	if content.Content["msgtype"] != "m.text" || body != want {
+		t.Fatalf("unexpected content: %v", content.Content)
+	}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat add-friend v4_bob@stranger Hi, it's Alice"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(provider.added) != 1 || provider.added[0].UserID != "v3_bob@stranger" || provider.greetings[0] != "Hi, it's Alice" {
+		t.Fatalf("added = %+v, greetings = %q", provider.added, provider.greetings)
+	}
+	if reply := lastReply(t, matrix); reply != "Sent a friend request to Bob." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat add-friend v4_unknown"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "No contact card with that ticket.") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestFormatContactCard_WithoutTicket(t *testing.T) {
+	got := formatContactCard(wechat.MsgContact, &wechat.ContactCard{UserID: "wxid_carol"}, "!wechat")
+	if got != "👤 Contact card: wxid_carol" {
+		t.Fatalf("formatContactCard = %q", got)
+	}
+}
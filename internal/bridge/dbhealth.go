@@ -0,0 +1,44 @@
+package bridge
+
+import (
+	"context"
+	"time"
+)
+
+// databaseHealthLoop pings the database every interval until ctx is done.
+// A failed ping drops the pool's idle connections, so the bridge reconnects
+// once the database is reachable again, e.g. after a failover. Losing and
+// regaining the database is logged once each.
+func (b *Bridge) databaseHealthLoop(ctx context.Context, interval, timeout time.Duration) {
+	if interval <= 0 || b.DB == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.checkDatabaseHealth(ctx, timeout)
+		}
+	}
+}
+
+func (b *Bridge) checkDatabaseHealth(ctx context.Context, timeout time.Duration) {
+	previous := b.DB.Health()
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := b.DB.CheckHealth(pingCtx)
+	cancel()
+
+	switch {
+	case err != nil && previous.Failures == 0:
+		b.Log.Error("database unreachable, reconnecting", "error", err)
+	case err != nil:
+		b.Log.Debug("database still unreachable", "error", err, "failures", previous.Failures+1)
+	case previous.Failures > 0:
+		b.Log.Info("database reachable again", "failed_checks", previous.Failures)
+	}
+}
@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Defaults for how many WeChat message IDs the router remembers, and for
+// how long, to drop duplicate deliveries, e.g. the same message arriving
+// via both the padpro WebSocket and its webhook.
+const (
+	recentMessageCapacity = 4096
+	recentMessageTTL      = 10 * time.Minute
+)
+
+// messageDedup is an LRU set of recently seen message keys. Keys seen within
+// ttl are never evicted, so the set may grow beyond capacity during a burst;
+// older keys are evicted once it is over capacity. A ttl of 0 makes it a
+// plain fixed-size LRU.
+type messageDedup struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // of *dedupEntry, front = most recently seen
+	items    map[string]*list.Element
+
+	now func() time.Time
+}
+
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+func newMessageDedup(capacity int, ttl time.Duration) *messageDedup {
+	return &messageDedup{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// add records key and reports whether it was new. Concurrent callers with
+// the same key see exactly one true.
+func (d *messageDedup) add(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if elem, ok := d.items[key]; ok {
+		elem.Value.(*dedupEntry).seen = now
+		d.order.MoveToFront(elem)
+		return false
+	}
+	d.items[key] = d.order.PushFront(&dedupEntry{key: key, seen: now})
+	for d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		entry := oldest.Value.(*dedupEntry)
+		if d.ttl > 0 && now.Sub(entry.seen) < d.ttl {
+			break
+		}
+		d.order.Remove(oldest)
+		delete(d.items, entry.key)
+	}
+	return true
+}
+
+// remove forgets key, so a later delivery of the same message is processed.
+func (d *messageDedup) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.items[key]; ok {
+		d.order.Remove(elem)
+		delete(d.items, key)
+	}
+}
+
+// len returns the number of remembered keys.
+func (d *messageDedup) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+// dropStaleMessage reports whether msg is older than maxMessageAge and
+// should not be bridged. Providers replay backlogs after a reconnect, so
+// drops are counted and summarised once the first fresh message arrives.
+// Messages without a timestamp are never stale.
+func (er *EventRouter) dropStaleMessage(msg *wechat.Message) bool {
+	if er.maxMessageAge <= 0 || msg.Timestamp <= 0 {
+		return false
+	}
+
+	age := time.Since(time.UnixMilli(msg.Timestamp))
+	if age > er.maxMessageAge {
+		er.staleDropped.Add(1)
+		er.log.Debug("dropping stale wechat message",
+			"msg_id", msg.MsgID, "age", age.Round(time.Second))
+		return true
+	}
+
+	if dropped := er.staleDropped.Swap(0); dropped > 0 {
+		er.log.Info("dropped stale wechat messages",
+			"count", dropped, "max_age", er.maxMessageAge)
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestMessageDedup_EvictsOldest(t *testing.T) {
+	d := newMessageDedup(2, 0)
+	if !d.add("a") || !d.add("b") {
+		t.Fatal("first additions should be new")
+	}
+	if d.add("a") {
+		t.Fatal("duplicate key reported as new")
+	}
+	d.add("c") // evicts "b", the least recently used
+	if !d.add("b") {
+		t.Fatal("evicted key should be new again")
+	}
+
+	d.remove("c")
+	if !d.add("c") {
+		t.Fatal("removed key should be new again")
+	}
+}
+
+func TestMessageDedup_KeepsKeysWithinTTL(t *testing.T) {
+	now := time.Now()
+	d := newMessageDedup(2, time.Minute)
+	d.now = func() time.Time { return now }
+
+	d.add("a")
+	d.add("b")
+	d.add("c") // over capacity, but "a" was seen within the TTL
+	if d.len() != 3 {
+		t.Fatalf("len = %d, want 3 while all keys are within the TTL", d.len())
+	}
+	if d.add("a") {
+		t.Fatal("duplicate within the TTL must be suppressed despite the capacity")
+	}
+
+	// Once older than the TTL, keys beyond the capacity are evicted oldest first
+	now = now.Add(2 * time.Minute)
+	d.add("d")
+	if d.len() != 2 {
+		t.Fatalf("len = %d, want capacity 2 after the TTL", d.len())
+	}
+	if !d.add("b") {
+		t.Fatal("expired key should be new again")
+	}
+}
+
+func TestEventRouter_OnMessage_DedupMetrics(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDMRoom)
+	expectDMRoute(mock, 3)
+	er.metrics = NewMetrics()
+
+	for i := 0; i < 3; i++ {
+		er.OnMessage(context.Background(), &wechat.Message{
+			MsgID: "dup1", Type: wechat.MsgText, FromUser: "wxid_bob", ToUser: "wxid_me", Content: "hello",
+		})
+	}
+
+	if hits, misses := er.metrics.dedupHits.Load(), er.metrics.dedupMisses.Load(); hits != 2 || misses != 1 {
+		t.Fatalf("dedup hits = %d, misses = %d; want 2 and 1", hits, misses)
+	}
+}
+
+// withDMRoom gives a test router what routing messages from wxid_bob into
+// the existing room !dm:test needs: the room stores, a provider logged in as
+// wxid_me and wxid_bob's puppet. expectDMRoute expects the lookups.
+func withDMRoom(cfg *EventRouterConfig, db *sql.DB) {
+	withRoomStores(cfg, db)
+	cfg.Provider = newMockProvider("wxid_me", 2)
+	cfg.Puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+}
+
+// expectDMRoute expects deliveries messages from wxid_bob to be routed into
+// !dm:test, in any order.
+func expectDMRoute(mock sqlmock.Sqlmock, deliveries int) {
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < deliveries; i++ {
+		expectBridgeUser(mock, "")
+		expectRoomMapping(mock, "wxid_bob", "!dm:test", "")
+	}
+}
+
+func TestEventRouter_OnMessage_ConcurrentDuplicateBridgedOnce(t *testing.T) {
+	const deliveries = 8
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDMRoom)
+	expectDMRoute(mock, deliveries)
+
+	var wg sync.WaitGroup
+	for i := 0; i < deliveries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			er.OnMessage(context.Background(), &wechat.Message{
+				MsgID: "dup1", Type: wechat.MsgText, FromUser: "wxid_bob", ToUser: "wxid_me", Content: "hello",
+			})
+		}()
+	}
+	wg.Wait()
+
+	if len(matrix.sent) != 1 {
+		t.Fatalf("message bridged %d times, want once", len(matrix.sent))
+	}
+}
+
+func TestEventRouter_OnMessage_SkipsMessageWithStoredMapping(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, func(cfg *EventRouterConfig, db *sql.DB) {
+		withDMRoom(cfg, db)
+		cfg.Messages = database.NewMessageMappingStore(db)
+	})
+	expectDMRoute(mock, 1)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testMessageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id = $2`)).
+		WithArgs("old1", "!dm:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("old1", "$old:test", "!dm:test", "wxid_bob", int(wechat.MsgText), now, now, ""))
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "old1", Type: wechat.MsgText, FromUser: "wxid_bob", ToUser: "wxid_me", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 0 {
+		t.Fatalf("already bridged message was sent again: %+v", matrix.sent)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnMessage_DropsStaleMessages(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDMRoom)
+	expectDMRoute(mock, 1)
+	er.maxMessageAge = 5 * time.Minute
+
+	now := time.Now()
+	for i, ts := range []time.Time{now.Add(-2 * time.Hour), now.Add(-10 * time.Minute), now.Add(-time.Minute)} {
+		err := er.OnMessage(context.Background(), &wechat.Message{
+			MsgID:     fmt.Sprintf("replay%d", i),
+			Type:      wechat.MsgText,
+			FromUser:  "wxid_bob",
+			ToUser:    "wxid_me",
+			Content:   "hello",
+			Timestamp: ts.UnixMilli(),
+		})
+		if err != nil {
+			t.Fatalf("OnMessage: %v", err)
+		}
+	}
+
+	if len(matrix.sent) != 1 {
+		t.Fatalf("bridged %d messages, want only the fresh one", len(matrix.sent))
+	}
+	if n := er.staleDropped.Load(); n != 0 {
+		t.Fatalf("stale drop count should reset after a fresh message, got %d", n)
+	}
+}
+
+func TestEventRouter_DropStaleMessage(t *testing.T) {
+	er := NewEventRouter(EventRouterConfig{Log: slog.Default(), MaxMessageAge: time.Minute})
+	old := time.Now().Add(-time.Hour).UnixMilli()
+
+	if !er.dropStaleMessage(&wechat.Message{Timestamp: old}) {
+		t.Fatal("hour-old message should be stale")
+	}
+	if er.dropStaleMessage(&wechat.Message{Timestamp: time.Now().UnixMilli()}) {
+		t.Fatal("current message should not be stale")
+	}
+	if er.dropStaleMessage(&wechat.Message{}) {
+		t.Fatal("message without timestamp should not be stale")
+	}
+
+	er.maxMessageAge = 0
+	if er.dropStaleMessage(&wechat.Message{Timestamp: old}) {
+		t.Fatal("no message should be stale without a max age")
+	}
+}
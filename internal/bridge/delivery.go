@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// OnSendAck records that WeChat confirmed delivering a message sent from
+// Matrix, moving its state to delivered, and marks its Matrix event as read
+// so Matrix users see it reached WeChat. Providers without
+// Capability.SendAck never call it; their sends stay sent, without a
+// receipt.
+func (er *EventRouter) OnSendAck(ctx context.Context, msgID string) error {
+	if er.messages == nil {
+		return nil
+	}
+	mapping, err := er.messages.GetLatestByWeChatMsgID(ctx, msgID)
+	if err != nil || mapping == nil {
+		er.log.Debug("ignoring send ack for unknown message", "msg_id", msgID)
+		return nil
+	}
+	er.setMessageState(ctx, &MatrixEvent{ID: mapping.MatrixEventID, RoomID: mapping.MatrixRoomID}, database.MessageStateDelivered, nil)
+
+	if !er.deliveryReceipts || er.rooms == nil {
+		return nil
+	}
+	room, err := er.rooms.GetByMatrixRoomID(ctx, mapping.MatrixRoomID)
+	if err != nil || room == nil {
+		er.log.Debug("ignoring send ack for unknown room", "msg_id", msgID, "room_id", mapping.MatrixRoomID)
+		return nil
+	}
+	er.sendDeliveryReceipt(ctx, room, mapping.MatrixEventID)
+	return nil
+}
+
+// sendDeliveryReceipt sends a read receipt for eventID on behalf of the
+// recipient: the contact's puppet in direct chats, the bridge bot in groups.
+func (er *EventRouter) sendDeliveryReceipt(ctx context.Context, room *database.RoomMapping, eventID string) {
+	if !er.deliveryReceipts || er.matrixClient == nil {
+		return
+	}
+	userID := er.botUserID
+	if !room.IsGroup {
+		puppet, err := er.puppets.GetByWeChatID(ctx, room.WeChatChatID)
+		if err != nil || puppet == nil {
+			er.log.Debug("no puppet to send delivery receipt", "chat_id", room.WeChatChatID)
+			return
+		}
+		userID = puppet.MatrixUserID
+	}
+	if userID == "" {
+		return
+	}
+	if err := er.matrixClient.SendReadReceipt(ctx, room.MatrixRoomID, eventID, userID); err != nil {
+		er.log.Warn("failed to send delivery receipt", "error", err, "room_id", room.MatrixRoomID, "event_id", eventID)
+	}
+}
@@ -0,0 +1,88 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// withDeliveryReceipts sends through provider to wxid_friend with the bot
+// sending delivery receipts.
+func withDeliveryReceipts(provider *mockProvider) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Puppets.puppets["wxid_friend"] = &Puppet{WeChatID: "wxid_friend", MatrixUserID: "@wechat_wxid_friend:example.com"}
+		cfg.Provider = provider
+		cfg.BotUserID = "@wechatbot:example.com"
+		cfg.DeliveryReceipts = true
+	}
+}
+
+func sendTestText(t *testing.T, er *EventRouter, room *database.RoomMapping) {
+	t.Helper()
+	err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+		ID:      "$event:test",
+		Type:    "m.room.message",
+		RoomID:  room.MatrixRoomID,
+		Sender:  "@user:test",
+		Content: map[string]interface{}{"msgtype": "m.text", "body": "hello"},
+	}, room)
+	if err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_NoReceiptWithoutAck(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, _ := newTestRouter(t, matrix, withDeliveryReceipts(newMockProvider("padpro", 2)))
+
+	sendTestText(t, er, &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!dm:test", BridgeUser: "@user:test"})
+	sendTestText(t, er, &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!group:test", BridgeUser: "@user:test", IsGroup: true})
+
+	if len(matrix.receipts) != 0 {
+		t.Fatalf("receipts = %+v, want none until WeChat acks the sends", matrix.receipts)
+	}
+}
+
+func TestEventRouter_OnSendAck_SendsDeliveryReceipt(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	provider.sendAcks = true
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, func(cfg *EventRouterConfig, db *sql.DB) {
+		withDeliveryReceipts(provider)(cfg, db)
+		cfg.Rooms = database.NewRoomMappingStore(db)
+		cfg.Messages = database.NewMessageMappingStore(db)
+	})
+
+	// The send itself is only mapped; the receipt waits for the ack.
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!dm:test", BridgeUser: "@user:test"}
+	sendTestText(t, er, room)
+	if len(matrix.receipts) != 0 {
+		t.Fatalf("receipt sent before the ack: %+v", matrix.receipts)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE wechat_msg_id = $1 ORDER BY created_at DESC LIMIT 1`)).
+		WithArgs("msg_padpro").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg_padpro", "$event:test", "!dm:test", "@user:test", 1, now, now, "hello"))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!dm:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("wxid_friend", "!dm:test", "@user:test", false, "", "", "", false, false, false, now))
+
+	if err := er.OnSendAck(context.Background(), "msg_padpro"); err != nil {
+		t.Fatalf("OnSendAck: %v", err)
+	}
+	if len(matrix.receipts) != 1 || matrix.receipts[0].sender != "@wechat_wxid_friend:example.com" || matrix.receipts[0].eventID != "$event:test" {
+		t.Fatalf("receipts = %+v, want one by the contact's puppet", matrix.receipts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// doublePuppetSourceKey marks events the bridge sent as a real Matrix user,
+// so they are not bridged back to WeChat when the homeserver echoes them.
+const (
+	doublePuppetSourceKey   = "fi.mau.double_puppet_source"
+	doublePuppetSourceValue = "mautrix-wechat"
+)
+
+// sharedSecretLoginer obtains access tokens via shared-secret login.
+type sharedSecretLoginer interface {
+	LoginWithSharedSecret(ctx context.Context, userID, secret string) (string, error)
+}
+
+// DoublePuppetManager provides the Matrix access tokens used to send bridge
+// users' own WeChat messages from their real Matrix accounts. Tokens are
+// cached in memory, persisted in the double_puppet table and, when a shared
+// secret is configured, obtained by logging in on demand.
+type DoublePuppetManager struct {
+	log          *slog.Logger
+	store        *database.DoublePuppetStore
+	loginer      sharedSecretLoginer
+	sharedSecret string
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewDoublePuppetManager creates a DoublePuppetManager. store and loginer
+// may be nil; without a shared secret, only stored tokens are used.
+func NewDoublePuppetManager(log *slog.Logger, store *database.DoublePuppetStore, loginer sharedSecretLoginer, sharedSecret string) *DoublePuppetManager {
+	return &DoublePuppetManager{
+		log:          log,
+		store:        store,
+		loginer:      loginer,
+		sharedSecret: sharedSecret,
+		tokens:       make(map[string]string),
+	}
+}
+
+// AccessToken returns the access token for a Matrix user, or "" if double
+// puppeting is not available for them.
+func (dp *DoublePuppetManager) AccessToken(ctx context.Context, userID string) (string, error) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	if token, ok := dp.tokens[userID]; ok {
+		return token, nil
+	}
+
+	if dp.store != nil {
+		token, err := dp.store.GetAccessToken(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			dp.tokens[userID] = token
+			return token, nil
+		}
+	}
+
+	if dp.sharedSecret == "" || dp.loginer == nil {
+		return "", nil
+	}
+	token, err := dp.loginer.LoginWithSharedSecret(ctx, userID, dp.sharedSecret)
+	if err != nil {
+		return "", fmt.Errorf("double puppet login: %w", err)
+	}
+	if dp.store != nil {
+		if err := dp.store.SetAccessToken(ctx, userID, token); err != nil {
+			dp.log.Warn("failed to persist double puppet token", "error", err, "user_id", userID)
+		}
+	}
+	dp.tokens[userID] = token
+	return token, nil
+}
+
+// Invalidate forgets a user's token, e.g. after the homeserver rejected it,
+// so the next AccessToken call logs in again.
+func (dp *DoublePuppetManager) Invalidate(ctx context.Context, userID string) {
+	dp.mu.Lock()
+	delete(dp.tokens, userID)
+	dp.mu.Unlock()
+
+	if dp.store != nil {
+		if err := dp.store.DeleteAccessToken(ctx, userID); err != nil {
+			dp.log.Warn("failed to delete double puppet token", "error", err, "user_id", userID)
+		}
+	}
+}
+
+// isDoublePuppeted reports whether a Matrix event was sent by this bridge on
+// behalf of a real user.
+func isDoublePuppeted(content map[string]interface{}) bool {
+	source, _ := content[doublePuppetSourceKey].(string)
+	return source == doublePuppetSourceValue
+}
@@ -0,0 +1,124 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+type fakeSharedSecretLoginer struct {
+	logins int
+}
+
+func (f *fakeSharedSecretLoginer) LoginWithSharedSecret(_ context.Context, userID, secret string) (string, error) {
+	f.logins++
+	return "token_for_" + userID, nil
+}
+
+func TestDoublePuppetManager_LogsInOnceAndCaches(t *testing.T) {
+	loginer := &fakeSharedSecretLoginer{}
+	dp := NewDoublePuppetManager(slog.Default(), nil, loginer, "secret")
+
+	for i := 0; i < 2; i++ {
+		token, err := dp.AccessToken(context.Background(), "@user:test")
+		if err != nil || token != "token_for_@user:test" {
+			t.Fatalf("AccessToken = %q, %v", token, err)
+		}
+	}
+	if loginer.logins != 1 {
+		t.Fatalf("logged in %d times, want 1", loginer.logins)
+	}
+
+	dp.Invalidate(context.Background(), "@user:test")
+	dp.AccessToken(context.Background(), "@user:test")
+	if loginer.logins != 2 {
+		t.Fatalf("expected a new login after Invalidate, got %d logins", loginer.logins)
+	}
+}
+
+func TestDoublePuppetManager_NoSecretNoToken(t *testing.T) {
+	dp := NewDoublePuppetManager(slog.Default(), nil, &fakeSharedSecretLoginer{}, "")
+	token, err := dp.AccessToken(context.Background(), "@user:test")
+	if err != nil || token != "" {
+		t.Fatalf("AccessToken = %q, %v; want no token", token, err)
+	}
+}
+
+// withDoublePuppet routes a self-sent DM from wxid_me to wxid_bob into the
+// existing room !dm:test like withDMRoom, with double puppeting set up.
+func withDoublePuppet(cfg *EventRouterConfig, db *sql.DB) {
+	withDMRoom(cfg, db)
+	cfg.Puppets.puppets["wxid_me"] = &Puppet{WeChatID: "wxid_me", MatrixUserID: "@wechat_wxid_me:example.com"}
+	cfg.DoublePuppet = NewDoublePuppetManager(slog.Default(), nil, &fakeSharedSecretLoginer{}, "secret")
+}
+
+func TestEventRouter_OnMessage_SelfSentUsesDoublePuppet(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDoublePuppet)
+	expectDMRoute(mock, 1)
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgText, FromUser: "wxid_me", ToUser: "wxid_bob", Content: "from my phone",
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+
+	if len(matrix.sent) != 0 {
+		t.Fatalf("message was sent via puppet: %+v", matrix.sent)
+	}
+	if len(matrix.sentAs) != 1 || matrix.sentAs[0].sender != "@user:test" || matrix.sentAs[0].roomID != "!dm:test" {
+		t.Fatalf("sentAs = %+v, want one event as @user:test in !dm:test", matrix.sentAs)
+	}
+	content := matrix.sentAs[0].content.(map[string]interface{})
+	if !isDoublePuppeted(content) {
+		t.Fatalf("double puppeted event missing source marker: %v", content)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnMessage_DoublePuppetFailureFallsBackToPuppet(t *testing.T) {
+	matrix := &testMatrixClient{sentAsErr: fmt.Errorf("forbidden")}
+	er, mock := newTestRouter(t, matrix, withDoublePuppet)
+	expectDMRoute(mock, 1)
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgText, FromUser: "wxid_me", ToUser: "wxid_bob", Content: "from my phone",
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 || matrix.sent[0].sender != "@wechat_wxid_me:example.com" {
+		t.Fatalf("sent = %+v, want fallback via the puppet", matrix.sent)
+	}
+	if isDoublePuppeted(matrix.sent[0].content.(map[string]interface{})) {
+		t.Fatal("puppet fallback should not carry the double puppet marker")
+	}
+}
+
+func TestEventRouter_HandleMatrixEvent_IgnoresDoublePuppetEcho(t *testing.T) {
+	er := NewEventRouter(EventRouterConfig{
+		Log:     slog.Default(),
+		Puppets: newTestPuppetManager(),
+	})
+
+	err := er.HandleMatrixEvent(context.Background(), &MatrixEvent{
+		Type:   "m.room.message",
+		RoomID: "!dm:test",
+		Sender: "@user:test",
+		Content: map[string]interface{}{
+			"msgtype":             "m.text",
+			"body":                "from my phone",
+			doublePuppetSourceKey: doublePuppetSourceValue,
+		},
+	})
+	if err != nil {
+		t.Fatalf("echoed double puppet event was not ignored: %v", err)
+	}
+}
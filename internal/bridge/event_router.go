@@ -2,11 +2,13 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/n42/mautrix-wechat/internal/database"
@@ -41,6 +43,148 @@ type EventRouter struct {
 	crypto       CryptoHelper
 	metrics      *Metrics
 
+	// Outgoing text length handling
+	maxTextLength int
+	longTextMode  string
+
+	// Forward Matrix read receipts to WeChat
+	sendReadReceipts bool
+
+	// Mark messages delivered to WeChat as read in Matrix
+	deliveryReceipts bool
+
+	// Redactions of messages older than revokeWindow are not sent to WeChat;
+	// botUserID posts the notice explaining why.
+	revokeWindow time.Duration
+	botUserID    string
+
+	// Recall the original WeChat message when forwarding a Matrix edit
+	revokeOnEdit bool
+
+	// Create rooms for all contacts and groups when syncing after login
+	syncDirectChats bool
+
+	// Contacts synced per page, and at most in total (0 = no limit)
+	contactPageSize  int
+	contactSyncLimit int
+
+	// Sender prefixes for text relayed on behalf of other Matrix users
+	relay *relayPrefixer
+
+	// Prefix and suffix added to all text sent to WeChat, nil for none
+	signature *outgoingSignature
+
+	// Sends the bridge user's own WeChat messages from their Matrix account
+	doublePuppet *DoublePuppetManager
+
+	// Recently bridged WeChat message IDs, to drop duplicate deliveries
+	recentMessages *messageDedup
+
+	// Incoming messages older than this are dropped (0 = no limit);
+	// staleDropped counts drops since the last fresh message
+	maxMessageAge time.Duration
+	staleDropped  atomic.Int64
+
+	// Retries failed sends in both directions
+	retrier *sendRetrier
+
+	// Group invitations awaiting the bridge user's answer
+	groupInvites *pendingGroupInvites
+
+	// Decides which chats are bridged
+	filter *chatFilter
+
+	// Received contact cards, by ticket, for the add-friend command
+	contactCards *contactCards
+
+	// Daily counts of messages sent to WeChat, for the stats command
+	sendStats *sendStats
+
+	// Friend requests awaiting the bridge user's approval
+	friendRequests *database.PendingFriendRequestStore
+
+	// Per-room puppet display names set with the rename command
+	memberNames *database.RoomMemberNameStore
+
+	// Delivery state of messages sent to WeChat, nil when not tracked
+	messageStates *database.MessageStateStore
+
+	// What happens to a group's room when the account is removed from it
+	groupRemoval string
+
+	// How a new group room is named when its name is already taken
+	duplicateNames string
+
+	// PaymentRequestsNotice or PaymentRequestsIgnore
+	paymentRequests string
+
+	// EmojiReactionsReaction, EmojiReactionsNotice or EmojiReactionsIgnore
+	emojiReactions string
+	// Matrix reactions bridged from WeChat emoji reactions, for withdrawal;
+	// nil when they aren't stored
+	reactionEvents *database.ReactionEventStore
+
+	// SilentContactAddsRoom, SilentContactAddsNotice or SilentContactAddsIgnore
+	silentContactAdds string
+
+	// RecreatedGroupsTombstone or RecreatedGroupsIgnore
+	recreatedGroups string
+
+	// Applied to puppet avatars before upload
+	avatarProcessor AvatarProcessor
+
+	// Re-encodes images sent from Matrix, nil to send them unchanged
+	imageTranscoder ImageTranscoder
+	// Converts voice sent from Matrix to silk, nil to send it unchanged
+	voiceConverter VoiceConverter
+
+	// Corrects skewed provider timestamps, nil when disabled
+	clockSkew *clockSkew
+
+	// Bridge pats as a reaction instead of a message
+	patAsReaction bool
+
+	// Groups with more members than largeGroupLimit (0 = no limit) keep
+	// their members in the database only; see isLargeGroup.
+	largeGroupLimit int
+	largeGroupsMu   sync.Mutex
+	largeGroups     map[string]bool
+
+	// Rooms where the bridge user is typing, to forward only changes
+	typingMu    sync.Mutex
+	typingRooms map[string]bool
+
+	// Name of the filehelper notes room, empty when not special-cased
+	notesRoomName string
+
+	// Name of the Moments feed room, empty when the feed isn't bridged;
+	// momentsCursors records the newest entry posted per bridge user
+	momentsRoomName string
+	momentsCursors  *database.MomentsCursorStore
+
+	// Event pinning each group room's announcement, nil to only set topics
+	pinnedAnnouncements *database.PinnedAnnouncementStore
+
+	// Spaces out messages sent to WeChat, nil when unlimited
+	sendLimiter *sendLimiter
+
+	// Messages fetched to backfill a new room (0 = no backfill)
+	backfillMessages int
+	backfillThrottle *backfillThrottle
+
+	// How long a send to WeChat may take, 0 for no limit
+	sendTimeout time.Duration
+
+	// Told about failed provider calls, e.g. to fail over; see
+	// SetProviderErrorHook. relogins holds the bridge users whose lost
+	// session is being logged in again.
+	providerErrorHook func(wechat.Provider, error)
+	reloginMu         sync.Mutex
+	relogins          map[string]bool
+
+	// Management commands sent to the bridge bot
+	commands *CommandProcessor
+
 	// Multi-tenant fields
 	sessionManager *SessionManager
 	multiTenant    bool
@@ -58,6 +202,8 @@ type MessageProcessor interface {
 type MatrixEventContent struct {
 	EventType string                 // e.g. "m.room.message"
 	Content   map[string]interface{} // Matrix event content
+	// Transcript of a voice message, bridged as a notice replying to it
+	Transcript string
 }
 
 // WeChatSendAction describes a message to be sent to WeChat.
@@ -69,7 +215,26 @@ type WeChatSendAction struct {
 	File     string
 	ReplyTo  string   // WeChat message ID to reply to
 	Mentions []string // WeChat user IDs to @mention
+	PatUser  string   // User to pat (MsgPat); Matrix ID until the EventRouter resolves it
 	Extra    map[string]interface{}
+
+	// MentionAll marks an @所有人 mention of everyone in the group, converted
+	// from a Matrix @room mention. It is sent as notify@all in the at-user
+	// list of providers that implement wechat.MentionSender.
+	MentionAll bool
+
+	// QuoteAuthor and QuoteText describe the replied-to message; text
+	// replies are sent with them as a WeChat-style quote.
+	QuoteAuthor string
+	QuoteText   string
+
+	// IsEdit marks a Matrix edit (m.replace). OriginalMsgID is the edited
+	// message (EventRouter converts the Matrix event ID to a WeChat msg ID).
+	IsEdit        bool
+	OriginalMsgID string
+
+	// sentMsgID is the last WeChat message ID the send produced, if any.
+	sentMsgID string
 }
 
 // EventRouterConfig holds configuration for the event router.
@@ -86,6 +251,165 @@ type EventRouterConfig struct {
 	Crypto       CryptoHelper
 	Metrics      *Metrics
 
+	// MaxTextLength caps the length of a single outgoing WeChat text message
+	// (0 = no limit). LongTextMode is LongTextSplit or LongTextReject.
+	MaxTextLength int
+	LongTextMode  string
+
+	// SendReadReceipts forwards Matrix m.receipt events to WeChat.
+	SendReadReceipts bool
+
+	// DeliveryReceipts marks messages sent to WeChat as read in Matrix once
+	// WeChat confirms their delivery; see OnSendAck. Providers without
+	// Capability.SendAck never confirm, so their messages get no receipt.
+	DeliveryReceipts bool
+
+	// RevokeWindow is how long after sending a message WeChat still allows
+	// it to be recalled (0 = always attempt). BotUserID sends bridge notices.
+	RevokeWindow time.Duration
+	BotUserID    string
+
+	// RevokeOnEdit recalls the original WeChat message, if still within
+	// RevokeWindow, when a Matrix edit is forwarded as a new message.
+	RevokeOnEdit bool
+
+	// SyncDirectChats pre-creates rooms for every contact and group during
+	// the contact sync that runs after login.
+	SyncDirectChats bool
+
+	// ContactSyncPageSize is how many contacts SyncContacts fetches and
+	// processes at a time; ContactSyncLimit caps the total (0 = no limit).
+	ContactSyncPageSize int
+	ContactSyncLimit    int
+
+	// DoublePuppet, when set, sends WeChat messages the bridge user sent
+	// themselves from their real Matrix account instead of a puppet.
+	DoublePuppet *DoublePuppetManager
+
+	// FriendRequests stores incoming friend requests until the bridge user
+	// accepts them with the accept-friend command.
+	FriendRequests *database.PendingFriendRequestStore
+
+	// MemberNames stores per-room puppet display names set with the rename
+	// command, re-applied whenever group membership is synced.
+	MemberNames *database.RoomMemberNameStore
+
+	// MessageStates records the delivery state of messages sent to WeChat,
+	// shown by the msg-status command. Nil disables tracking.
+	MessageStates *database.MessageStateStore
+
+	// ReactionEvents stores the Matrix reactions bridged from WeChat emoji
+	// reactions, so that they are redacted when withdrawn. Nil leaves
+	// withdrawn reactions in place.
+	ReactionEvents *database.ReactionEventStore
+
+	// SendStats stores the daily counts of messages sent to WeChat shown by
+	// the stats command. Nil keeps them in memory until the bridge restarts.
+	SendStats *database.SendStatStore
+
+	// GroupRemovalAction is GroupRemovalLeave or GroupRemovalNotice and
+	// selects what happens to a group's room once the account is removed
+	// from the WeChat group.
+	GroupRemovalAction string
+
+	// DuplicateRoomNames is DuplicateRoomNamesHash, DuplicateRoomNamesMemberCount
+	// or DuplicateRoomNamesNone and selects how a new group room is named
+	// when another of the user's rooms already has the group's name.
+	DuplicateRoomNames string
+
+	// PaymentRequests is PaymentRequestsNotice or PaymentRequestsIgnore and
+	// selects whether WeChat payment requests (收款) are posted as a notice.
+	PaymentRequests string
+
+	// EmojiReactions is EmojiReactionsReaction, EmojiReactionsNotice or
+	// EmojiReactionsIgnore and selects how WeChat emoji reactions (表情回应)
+	// are bridged.
+	EmojiReactions string
+
+	// SilentContactAdds is SilentContactAddsRoom, SilentContactAddsNotice or
+	// SilentContactAddsIgnore and selects what happens when someone is added
+	// as a contact without a friend request.
+	SilentContactAdds string
+
+	// RecreatedGroups is RecreatedGroupsTombstone or RecreatedGroupsIgnore
+	// and selects whether the room of a group WeChat re-created under a new
+	// ID is tombstoned in favour of the new group's room.
+	RecreatedGroups string
+
+	// AvatarProcessor transforms puppet avatars before they are uploaded,
+	// e.g. SquareCropAvatarProcessor. Nil uploads them unchanged.
+	AvatarProcessor AvatarProcessor
+
+	// ImageTranscoder re-encodes images sent from Matrix to WeChat, e.g. a
+	// JPEGTranscoder. Nil sends them unchanged.
+	ImageTranscoder ImageTranscoder
+
+	// VoiceConverter converts ogg/opus voice sent from Matrix to silk for
+	// WeChat. Nil sends it unchanged.
+	VoiceConverter VoiceConverter
+
+	// ClockSkewWindow enables clock skew correction: once this many live
+	// messages consistently arrive more than ClockSkewThreshold before or
+	// after their provider timestamps, the difference is added to message
+	// timestamps, e.g. for backfill. 0 disables the correction.
+	ClockSkewWindow    int
+	ClockSkewThreshold time.Duration
+
+	// DedupCapacity and DedupTTL size the set of recent message IDs used to
+	// drop duplicate deliveries; see messageDedup. 0 selects the defaults,
+	// a negative DedupTTL disables the TTL.
+	DedupCapacity int
+	DedupTTL      time.Duration
+
+	// PatAsReaction bridges WeChat pats as a 👋 reaction on the patted
+	// user's latest message. Pats with nothing to react to stay messages.
+	PatAsReaction bool
+
+	// LargeGroupThreshold is the member count above which a group's members
+	// are no longer joined to its Matrix room one by one (0 = no limit).
+	LargeGroupThreshold int
+
+	// NotesRoomName names the room of the account's notes to itself
+	// (filehelper), whose messages are all bridged as the bridge user.
+	// Empty treats filehelper like any other contact.
+	NotesRoomName string
+
+	// MomentsRoomName names the room MomentsLoop posts new Moments entries
+	// to; MomentsCursors records the newest entry posted for each bridge
+	// user. Empty disables the Moments feed.
+	MomentsRoomName string
+	MomentsCursors  *database.MomentsCursorStore
+
+	// PinnedAnnouncements records the event pinning each group room's
+	// announcement. Nil only sets announcements as room topics.
+	PinnedAnnouncements *database.PinnedAnnouncementStore
+
+	// MessagesPerMinute and ChatMessagesPerMinute limit how many messages
+	// are sent to WeChat per minute in total and to any one chat (0 = no
+	// limit). Messages over the limit are queued, not dropped.
+	MessagesPerMinute     int
+	ChatMessagesPerMinute int
+
+	// BackfillMessages is how many of a chat's recent messages are bridged
+	// into its newly created room, if the provider can fetch them (0 = no
+	// backfill).
+	BackfillMessages int
+
+	// SendTimeout bounds each send to WeChat, retries included (0 = no
+	// limit). Timed-out sends are reported to the provider error hook.
+	SendTimeout time.Duration
+
+	// MaxMessageAge drops incoming WeChat messages older than this, e.g.
+	// replayed by the provider after a reconnect (0 = no limit). BackfillRoom
+	// is not affected.
+	MaxMessageAge time.Duration
+
+	// SendRetries is how often a failed send to Matrix or WeChat is retried
+	// (0 = never), waiting SendRetryBackoff before the first retry and
+	// doubling it for each further one.
+	SendRetries      int
+	SendRetryBackoff time.Duration
+
 	// Multi-tenant fields
 	SessionManager *SessionManager
 	MultiTenant    bool
@@ -97,20 +421,77 @@ func NewEventRouter(cfg EventRouterConfig) *EventRouter {
 	if crypto == nil {
 		crypto = &noopCryptoHelper{}
 	}
+	var skew *clockSkew
+	if cfg.ClockSkewWindow > 0 {
+		skew = newClockSkew(cfg.ClockSkewWindow, cfg.ClockSkewThreshold)
+	}
+	dedupCapacity, dedupTTL := cfg.DedupCapacity, cfg.DedupTTL
+	if dedupCapacity <= 0 {
+		dedupCapacity = recentMessageCapacity
+	}
+	if dedupTTL == 0 {
+		dedupTTL = recentMessageTTL
+	}
+	avatarProcessor := cfg.AvatarProcessor
+	if avatarProcessor == nil {
+		avatarProcessor = passthroughAvatarProcessor{}
+	}
 	return &EventRouter{
-		log:            cfg.Log,
-		puppets:        cfg.Puppets,
-		processor:      cfg.Processor,
-		provider:       cfg.Provider,
-		rooms:          cfg.Rooms,
-		messages:       cfg.Messages,
-		bridgeUsers:    cfg.BridgeUsers,
-		groupMembers:   cfg.GroupMembers,
-		matrixClient:   cfg.MatrixClient,
-		crypto:         crypto,
-		metrics:        cfg.Metrics,
-		sessionManager: cfg.SessionManager,
-		multiTenant:    cfg.MultiTenant,
+		log:                 cfg.Log,
+		puppets:             cfg.Puppets,
+		processor:           cfg.Processor,
+		provider:            cfg.Provider,
+		rooms:               cfg.Rooms,
+		messages:            cfg.Messages,
+		bridgeUsers:         cfg.BridgeUsers,
+		groupMembers:        cfg.GroupMembers,
+		matrixClient:        cfg.MatrixClient,
+		crypto:              crypto,
+		metrics:             cfg.Metrics,
+		maxTextLength:       cfg.MaxTextLength,
+		longTextMode:        cfg.LongTextMode,
+		sendReadReceipts:    cfg.SendReadReceipts,
+		deliveryReceipts:    cfg.DeliveryReceipts,
+		revokeWindow:        cfg.RevokeWindow,
+		botUserID:           cfg.BotUserID,
+		revokeOnEdit:        cfg.RevokeOnEdit,
+		syncDirectChats:     cfg.SyncDirectChats,
+		contactPageSize:     cfg.ContactSyncPageSize,
+		contactSyncLimit:    cfg.ContactSyncLimit,
+		doublePuppet:        cfg.DoublePuppet,
+		maxMessageAge:       cfg.MaxMessageAge,
+		recentMessages:      newMessageDedup(dedupCapacity, dedupTTL),
+		retrier:             newSendRetrier(cfg.Log, cfg.Metrics, cfg.SendRetries, cfg.SendRetryBackoff),
+		groupInvites:        newPendingGroupInvites(),
+		contactCards:        newContactCards(),
+		sendStats:           newSendStats(cfg.SendStats),
+		filter:              &chatFilter{},
+		friendRequests:      cfg.FriendRequests,
+		memberNames:         cfg.MemberNames,
+		messageStates:       cfg.MessageStates,
+		groupRemoval:        cfg.GroupRemovalAction,
+		duplicateNames:      cfg.DuplicateRoomNames,
+		paymentRequests:     cfg.PaymentRequests,
+		emojiReactions:      cfg.EmojiReactions,
+		reactionEvents:      cfg.ReactionEvents,
+		silentContactAdds:   cfg.SilentContactAdds,
+		recreatedGroups:     cfg.RecreatedGroups,
+		avatarProcessor:     avatarProcessor,
+		imageTranscoder:     cfg.ImageTranscoder,
+		voiceConverter:      cfg.VoiceConverter,
+		clockSkew:           skew,
+		patAsReaction:       cfg.PatAsReaction,
+		largeGroupLimit:     cfg.LargeGroupThreshold,
+		notesRoomName:       cfg.NotesRoomName,
+		momentsRoomName:     cfg.MomentsRoomName,
+		momentsCursors:      cfg.MomentsCursors,
+		pinnedAnnouncements: cfg.PinnedAnnouncements,
+		sendTimeout:         cfg.SendTimeout,
+		backfillMessages:    cfg.BackfillMessages,
+		backfillThrottle:    newBackfillThrottle(),
+		sendLimiter:         newSendLimiter(cfg.Log, cfg.Metrics, cfg.MessagesPerMinute, cfg.ChatMessagesPerMinute),
+		sessionManager:      cfg.SessionManager,
+		multiTenant:         cfg.MultiTenant,
 	}
 }
 
@@ -121,6 +502,36 @@ func (er *EventRouter) SetSessionManager(sm *SessionManager) {
 	er.multiTenant = true
 }
 
+// SetCommandProcessor sets the management command processor. The processor
+// needs the router to reach providers, so it is attached after creation.
+func (er *EventRouter) SetCommandProcessor(cp *CommandProcessor) {
+	er.commands = cp
+}
+
+// SetRelayPrefix enables sender prefixes for text relayed to WeChat on
+// behalf of Matrix users other than the room's bridge user. See
+// newRelayPrefixer for the template and knownPrefixes format.
+func (er *EventRouter) SetRelayPrefix(template string, knownPrefixes []string) error {
+	rp, err := newRelayPrefixer(template, knownPrefixes)
+	if err != nil {
+		return err
+	}
+	er.relay = rp
+	return nil
+}
+
+// SetOutgoingSignature configures the prefix and suffix templates added to
+// all text sent to WeChat; see outgoingSignature. Text sent to skipRooms is
+// left alone.
+func (er *EventRouter) SetOutgoingSignature(prefix, suffix string, skipRooms []string) error {
+	s, err := newOutgoingSignature(prefix, suffix, skipRooms)
+	if err != nil {
+		return err
+	}
+	er.signature = s
+	return nil
+}
+
 // SetProvider updates the active provider (used when failover switches providers).
 func (er *EventRouter) SetProvider(p wechat.Provider) {
 	er.providerMu.Lock()
@@ -143,6 +554,16 @@ func (er *EventRouter) HandleMatrixEvent(ctx context.Context, evt *MatrixEvent)
 	if er.puppets != nil && er.puppets.IsPuppet(evt.Sender) {
 		return nil
 	}
+	if isDoublePuppeted(evt.Content) {
+		return nil
+	}
+
+	// Prefixed management commands are handled in any room and never bridged
+	if er.commands != nil && evt.Type == "m.room.message" {
+		if body, _ := evt.Content["body"].(string); er.commands.IsCommand(strings.TrimSpace(body)) {
+			return er.commands.Handle(ctx, evt, true)
+		}
+	}
 
 	// Look up the room mapping
 	if er.rooms == nil {
@@ -153,10 +574,21 @@ func (er *EventRouter) HandleMatrixEvent(ctx context.Context, evt *MatrixEvent)
 		return fmt.Errorf("look up room %s: %w", evt.RoomID, err)
 	}
 	if room == nil {
+		if er.commands != nil && evt.Type == "m.room.message" && er.isManagementRoom(ctx, evt.Sender, evt.RoomID) {
+			return er.commands.Handle(ctx, evt, false)
+		}
 		er.log.Debug("ignoring event in unmapped room", "room_id", evt.RoomID)
 		return nil
 	}
 
+	// The Moments room is a read-only feed; nothing in it goes to WeChat.
+	if er.isMomentsChat(room.WeChatChatID) {
+		switch evt.Type {
+		case "m.room.message", "m.room.redaction", "m.room.encrypted", "m.receipt", "m.typing":
+			return nil
+		}
+	}
+
 	switch evt.Type {
 	case "m.room.message":
 		return er.handleMatrixMessage(ctx, evt, room)
@@ -164,6 +596,10 @@ func (er *EventRouter) HandleMatrixEvent(ctx context.Context, evt *MatrixEvent)
 		return er.handleMatrixRedaction(ctx, evt, room)
 	case "m.room.encrypted":
 		return er.handleMatrixEncrypted(ctx, evt, room)
+	case "m.receipt":
+		return er.handleMatrixReceipt(ctx, evt, room)
+	case "m.typing":
+		return er.handleMatrixTyping(ctx, evt, room)
 	case "m.room.encryption":
 		return er.crypto.SetEncryptionForRoom(ctx, evt.RoomID)
 	case "m.room.member":
@@ -195,6 +631,8 @@ func (er *EventRouter) handleMatrixMessage(ctx context.Context, evt *MatrixEvent
 	if action == nil {
 		return nil
 	}
+	applyRoomMention(evt.Content, room, action)
+	er.resolvePat(action)
 
 	// Resolve reply-to: convert Matrix event ID → WeChat message ID
 	if action.ReplyTo != "" {
@@ -206,6 +644,7 @@ func (er *EventRouter) handleMatrixMessage(ctx context.Context, evt *MatrixEvent
 			mapping, err := er.messages.GetByMatrixEventID(ctx, action.ReplyTo)
 			if err == nil && mapping != nil {
 				action.ReplyTo = mapping.WeChatMsgID
+				er.setOutgoingQuote(ctx, room, mapping, action)
 			} else {
 				er.log.Debug("reply-to matrix event not found in mapping",
 					"event_id", action.ReplyTo)
@@ -222,20 +661,91 @@ func (er *EventRouter) handleMatrixMessage(ctx context.Context, evt *MatrixEvent
 		return fmt.Errorf("no active provider")
 	}
 
+	er.setMessageState(ctx, evt, database.MessageStateQueued, nil)
+	key := sendKey{bridgeUser: room.BridgeUser, chat: room.WeChatChatID}
+	return er.sendLimiter.submit(ctx, key, func(ctx context.Context) error {
+		er.setMessageState(ctx, evt, database.MessageStateSending, nil)
+		sendCtx := ctx
+		if er.sendTimeout > 0 {
+			var cancel context.CancelFunc
+			sendCtx, cancel = context.WithTimeout(ctx, er.sendTimeout)
+			defer cancel()
+		}
+		// Pats may go out as text, so the type is taken before sending
+		msgType := action.Type.String()
+		err := er.sendMatrixAction(sendCtx, provider, room, action, evt)
+		if er.metrics != nil {
+			er.metrics.IncrMessagesByType(retryOutbound, msgType)
+			if err != nil {
+				er.metrics.IncrMessagesFailedByType(retryOutbound, msgType)
+			}
+		}
+		switch {
+		case err != nil:
+			// A queued send is cancelled when the bridge stops
+			er.setMessageState(context.WithoutCancel(ctx), evt, database.MessageStateFailed, err)
+			er.handleProviderError(ctx, provider, room.BridgeUser, err)
+		default:
+			// Delivered and the delivery receipt wait for the provider's
+			// ack; see OnSendAck
+			er.setMessageState(ctx, evt, database.MessageStateSent, nil)
+		}
+		if err == nil {
+			er.recordSend(ctx, room.BridgeUser, provider, msgType)
+		}
+		return err
+	}, func(ctx context.Context, err error) {
+		er.setMessageState(ctx, evt, database.MessageStateFailed, err)
+	})
+}
+
+// Stop stops sending Matrix messages queued by the rate limit. Messages
+// still queued are marked failed.
+func (er *EventRouter) Stop() {
+	er.sendLimiter.stop()
+}
+
+// sendMatrixAction sends a converted Matrix message to the room's WeChat chat.
+func (er *EventRouter) sendMatrixAction(ctx context.Context, provider wechat.Provider, room *database.RoomMapping, action *WeChatSendAction, evt *MatrixEvent) error {
 	target := room.WeChatChatID
 
+	if action.Type == wechat.MsgPat {
+		if provider.Capabilities().Pat {
+			return er.sendMatrixPat(ctx, provider, target, action)
+		}
+		action.Type = wechat.MsgText
+	}
+
+	if action.Type == wechat.MsgText && room.BridgeUser != "" && evt.Sender != room.BridgeUser {
+		action.Text = er.relay.apply(evt.Sender, action.Text)
+	}
+	if action.Type == wechat.MsgText && action.QuoteAuthor != "" {
+		action.Text = formatWeChatQuote(action.QuoteAuthor, action.QuoteText, action.Text)
+	}
+	if action.Type == wechat.MsgText {
+		text, err := er.signature.apply(room, evt.Sender, action.Text)
+		if err != nil {
+			return err
+		}
+		action.Text = text
+	}
+
+	if action.IsEdit {
+		return er.sendMatrixEdit(ctx, provider, target, action, evt)
+	}
+	if action.Type == wechat.MsgText {
+		return er.sendMatrixText(ctx, provider, target, action, evt)
+	}
+
 	var msgID string
+	var err error
 	switch action.Type {
-	case wechat.MsgText:
-		msgID, err = provider.SendText(ctx, target, action.Text)
-	case wechat.MsgImage:
-		msgID, err = er.sendMatrixMedia(ctx, provider, target, action, evt.Content)
-	case wechat.MsgVideo:
-		msgID, err = er.sendMatrixMedia(ctx, provider, target, action, evt.Content)
-	case wechat.MsgVoice:
-		msgID, err = er.sendMatrixMedia(ctx, provider, target, action, evt.Content)
-	case wechat.MsgFile:
-		msgID, err = er.sendMatrixMedia(ctx, provider, target, action, evt.Content)
+	case wechat.MsgImage, wechat.MsgVideo, wechat.MsgVoice, wechat.MsgFile:
+		err = er.retrier.do(ctx, retryOutbound, func() error {
+			var sendErr error
+			msgID, sendErr = er.sendMatrixMedia(ctx, provider, target, action, evt.Content)
+			return sendErr
+		})
 	default:
 		return fmt.Errorf("unsupported wechat send type: %d", action.Type)
 	}
@@ -251,37 +761,153 @@ func (er *EventRouter) handleMatrixMessage(ctx context.Context, evt *MatrixEvent
 		er.metrics.IncrMessagesSent()
 	}
 
-	// Save message mapping
 	if msgID != "" {
-		mapping := &database.MessageMapping{
-			WeChatMsgID:   msgID,
-			MatrixEventID: evt.ID,
-			MatrixRoomID:  evt.RoomID,
-			Sender:        evt.Sender,
-			MsgType:       int(action.Type),
+		action.sentMsgID = msgID
+	}
+	er.saveOutgoingMapping(ctx, evt, msgID, action.Type)
+	return nil
+}
+
+// sendMatrixText sends a text action to WeChat, splitting it into several
+// messages when it exceeds the configured length limit. Every chunk is mapped
+// to the originating Matrix event so replies to any part resolve correctly.
+func (er *EventRouter) sendMatrixText(ctx context.Context, provider wechat.Provider, target string, action *WeChatSendAction, evt *MatrixEvent) error {
+	chunks := []string{action.Text}
+	if er.maxTextLength > 0 && len([]rune(action.Text)) > er.maxTextLength {
+		if er.longTextMode == LongTextReject {
+			if er.metrics != nil {
+				er.metrics.IncrMessagesFailed()
+			}
+			return fmt.Errorf("text message has %d characters, exceeds limit of %d",
+				len([]rune(action.Text)), er.maxTextLength)
 		}
-		if er.messages == nil {
-			er.log.Warn("message store not initialized, skipping mapping save",
-				"matrix_event", evt.ID, "wechat_msg", msgID)
-		} else if err := er.messages.Insert(ctx, mapping); err != nil {
-			er.log.Error("failed to save message mapping", "error", err)
+		chunks = splitText(action.Text, er.maxTextLength)
+		er.log.Debug("splitting long matrix message",
+			"event_id", evt.ID, "chunks", len(chunks))
+	}
+
+	for i, chunk := range chunks {
+		var msgID string
+		err := er.retrier.do(ctx, retryOutbound, func() error {
+			var sendErr error
+			msgID, sendErr = er.sendText(ctx, provider, target, chunk, action)
+			return sendErr
+		})
+		if err != nil {
+			if er.metrics != nil {
+				er.metrics.IncrMessagesFailed()
+			}
+			if len(chunks) > 1 {
+				return fmt.Errorf("send wechat message part %d/%d: %w", i+1, len(chunks), err)
+			}
+			return fmt.Errorf("send wechat message: %w", err)
+		}
+
+		if er.metrics != nil {
+			er.metrics.IncrMessagesSent()
+		}
+		if msgID != "" {
+			action.sentMsgID = msgID
+		}
+		er.saveOutgoingMapping(ctx, evt, msgID, action.Type)
+	}
+
+	return nil
+}
+
+// sendMatrixPat sends a pat. Pats produce no WeChat message ID, so no
+// mapping is saved.
+func (er *EventRouter) sendMatrixPat(ctx context.Context, provider wechat.Provider, target string, action *WeChatSendAction) error {
+	err := er.retrier.do(ctx, retryOutbound, func() error {
+		return provider.SendPat(ctx, target, action.PatUser)
+	})
+	if err != nil {
+		if er.metrics != nil {
+			er.metrics.IncrMessagesFailed()
+		}
+		return fmt.Errorf("send wechat pat: %w", err)
+	}
+	if er.metrics != nil {
+		er.metrics.IncrMessagesSent()
+	}
+	return nil
+}
+
+// sendMatrixEdit forwards a Matrix edit. WeChat has no native edits, so the
+// new content is sent as a new message marked "(edited) ", optionally
+// recalling the original when it is still within the revoke window.
+func (er *EventRouter) sendMatrixEdit(ctx context.Context, provider wechat.Provider, target string, action *WeChatSendAction, evt *MatrixEvent) error {
+	var original *database.MessageMapping
+	if er.messages != nil {
+		mapping, err := er.messages.GetByMatrixEventID(ctx, action.OriginalMsgID)
+		if err != nil {
+			er.log.Warn("failed to look up edited message", "error", err, "event_id", action.OriginalMsgID)
 		}
+		original = mapping
+	}
+	if original != nil {
+		action.OriginalMsgID = original.WeChatMsgID
+	} else {
+		er.log.Debug("edited matrix event not found in mapping", "event_id", action.OriginalMsgID)
+		action.OriginalMsgID = ""
+	}
+
+	action.Text = "(edited) " + action.Text
+	if err := er.sendMatrixText(ctx, provider, target, action, evt); err != nil {
+		return err
 	}
 
+	if original == nil || !er.revokeOnEdit {
+		return nil
+	}
+	if er.revokeWindow > 0 && !original.Timestamp.IsZero() && time.Since(original.Timestamp) > er.revokeWindow {
+		er.log.Debug("not revoking edited message outside the revoke window",
+			"wechat_msg", action.OriginalMsgID, "sent_at", original.Timestamp)
+		return nil
+	}
+	if err := provider.RevokeMessage(ctx, action.OriginalMsgID, target); err != nil {
+		er.log.Warn("failed to revoke edited message", "error", err, "wechat_msg", action.OriginalMsgID)
+	}
 	return nil
 }
 
+// saveOutgoingMapping records the WeChat message ID produced by a Matrix event.
+func (er *EventRouter) saveOutgoingMapping(ctx context.Context, evt *MatrixEvent, msgID string, msgType wechat.MsgType) {
+	if msgID == "" {
+		return
+	}
+	content := evt.Content
+	if newContent, ok := content["m.new_content"].(map[string]interface{}); ok {
+		content = newContent
+	}
+	mapping := &database.MessageMapping{
+		WeChatMsgID:   msgID,
+		MatrixEventID: evt.ID,
+		MatrixRoomID:  evt.RoomID,
+		Sender:        evt.Sender,
+		MsgType:       int(msgType),
+		Body:          mappingBody(content),
+		Timestamp:     time.Now(),
+	}
+	if er.messages == nil {
+		er.log.Warn("message store not initialized, skipping mapping save",
+			"matrix_event", evt.ID, "wechat_msg", msgID)
+	} else if err := er.messages.Insert(ctx, mapping); err != nil {
+		er.log.Error("failed to save message mapping", "error", err)
+	}
+}
+
 func (er *EventRouter) sendMatrixMedia(ctx context.Context, provider wechat.Provider, target string, action *WeChatSendAction, content map[string]interface{}) (string, error) {
 	if er.matrixClient == nil {
-		return "", fmt.Errorf("matrix client not configured, cannot download media")
+		return "", &permanentSendError{fmt.Errorf("matrix client not configured, cannot download media")}
 	}
 
 	mxcURL := matrixMediaMXCURL(action, content)
 	if mxcURL == "" {
-		return "", fmt.Errorf("matrix media event missing url")
+		return "", &permanentSendError{fmt.Errorf("matrix media event missing url")}
 	}
 
-	reader, _, err := er.matrixClient.DownloadMedia(ctx, mxcURL)
+	reader, mimeType, err := er.matrixClient.DownloadMedia(ctx, mxcURL)
 	if err != nil {
 		return "", fmt.Errorf("download matrix media %s: %w", mxcURL, err)
 	}
@@ -290,7 +916,11 @@ func (er *EventRouter) sendMatrixMedia(ctx context.Context, provider wechat.Prov
 	filename := matrixMediaFilename(action, content)
 	switch action.Type {
 	case wechat.MsgImage:
-		return provider.SendImage(ctx, target, reader, filename)
+		img, err := er.transcodeImage(reader, mimeType)
+		if err != nil {
+			return "", fmt.Errorf("read matrix image %s: %w", mxcURL, err)
+		}
+		return provider.SendImage(ctx, target, img, filename)
 	case wechat.MsgVideo:
 		var thumbReader io.ReadCloser
 		thumbURL := matrixMediaThumbnailURL(content)
@@ -306,7 +936,11 @@ func (er *EventRouter) sendMatrixMedia(ctx context.Context, provider wechat.Prov
 		}
 		return provider.SendVideo(ctx, target, reader, filename, thumbReader)
 	case wechat.MsgVoice:
-		return provider.SendVoice(ctx, target, reader, matrixMediaDurationSeconds(content))
+		audio, err := er.transcodeVoice(reader)
+		if err != nil {
+			return "", fmt.Errorf("read matrix audio %s: %w", mxcURL, err)
+		}
+		return provider.SendVoice(ctx, target, audio, matrixMediaDurationSeconds(content))
 	case wechat.MsgFile:
 		return provider.SendFile(ctx, target, reader, filename)
 	default:
@@ -411,6 +1045,23 @@ func (er *EventRouter) handleMatrixRedaction(ctx context.Context, evt *MatrixEve
 		return nil
 	}
 
+	// Redactions enforcing the room's retention policy aren't recalls
+	if er.isRetentionRedaction(evt, mapping) {
+		er.log.Debug("not revoking message redacted by retention",
+			"matrix_event", redactedEventID, "wechat_msg", mapping.WeChatMsgID, "redacted_by", evt.Sender)
+		return nil
+	}
+
+	if er.pastRevokeWindow(mapping) {
+		er.log.Info("not revoking message outside the WeChat revoke window",
+			"matrix_event", redactedEventID, "wechat_msg", mapping.WeChatMsgID,
+			"sent_at", mapping.Timestamp)
+		er.sendNotice(ctx, evt.RoomID, fmt.Sprintf(
+			"Message was not recalled on WeChat: messages can only be recalled within %s of sending.",
+			formatRevokeWindow(er.revokeWindow)))
+		return nil
+	}
+
 	provider, err := er.getProviderForRoom(ctx, room)
 	if err != nil {
 		return fmt.Errorf("get provider for redaction: %w", err)
@@ -427,6 +1078,140 @@ func (er *EventRouter) handleMatrixRedaction(ctx context.Context, evt *MatrixEve
 	return nil
 }
 
+// pastRevokeWindow reports whether WeChat no longer lets the message be
+// recalled. Mappings saved before send times were recorded have no
+// timestamp; the provider decides for those.
+func (er *EventRouter) pastRevokeWindow(mapping *database.MessageMapping) bool {
+	return er.revokeWindow > 0 && !mapping.Timestamp.IsZero() && time.Since(mapping.Timestamp) > er.revokeWindow
+}
+
+// isRetentionRedaction reports whether a redaction enforces the room's
+// message retention policy rather than recalling a message: its reason says
+// so, or it removes a message someone else sent that WeChat would no longer
+// recall anyway. Such redactions are neither revoked nor answered with a
+// notice, which would flood the room when old messages expire.
+func (er *EventRouter) isRetentionRedaction(evt *MatrixEvent, mapping *database.MessageMapping) bool {
+	reason, _ := evt.Content["reason"].(string)
+	if strings.Contains(strings.ToLower(reason), "retention") {
+		return true
+	}
+	return evt.Sender != mapping.Sender && er.pastRevokeWindow(mapping)
+}
+
+// sendNotice posts an m.notice from the bridge bot to a room.
+func (er *EventRouter) sendNotice(ctx context.Context, roomID, text string) {
+	if er.matrixClient == nil || er.botUserID == "" {
+		er.log.Warn("cannot send bridge notice", "room_id", roomID, "notice", text)
+		return
+	}
+	_, err := er.matrixClient.SendMessage(ctx, roomID, er.botUserID, "m.room.message", map[string]interface{}{
+		"msgtype": "m.notice",
+		"body":    text,
+	})
+	if err != nil {
+		er.log.Error("failed to send bridge notice", "error", err, "room_id", roomID)
+	}
+}
+
+// formatRevokeWindow renders a revoke window as "2 minutes" or "90 seconds".
+func formatRevokeWindow(d time.Duration) string {
+	if d >= time.Minute && d%time.Minute == 0 {
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
+
+// handleMatrixReceipt forwards the bridge user's m.read receipts to WeChat.
+// Receipt content maps event IDs to receipt types to user IDs:
+//
+//	{"$event": {"m.read": {"@alice:example.com": {"ts": 1700000000000}}}}
+func (er *EventRouter) handleMatrixReceipt(ctx context.Context, evt *MatrixEvent, room *database.RoomMapping) error {
+	if !er.sendReadReceipts {
+		return nil
+	}
+	if er.messages == nil {
+		er.log.Warn("message store not initialized, dropping read receipt",
+			"room_id", evt.RoomID)
+		return nil
+	}
+
+	provider, err := er.getProviderForRoom(ctx, room)
+	if err != nil {
+		return fmt.Errorf("get provider for receipt: %w", err)
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+	if !provider.Capabilities().ReadReceipt {
+		return nil
+	}
+
+	for eventID, raw := range evt.Content {
+		receipts, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		readers, ok := receipts["m.read"].(map[string]interface{})
+		if !ok || !er.receiptFromBridgeUser(readers, room) {
+			continue
+		}
+
+		mapping, err := er.messages.GetByMatrixEventID(ctx, eventID)
+		if err != nil {
+			return fmt.Errorf("look up read message: %w", err)
+		}
+		if mapping == nil {
+			er.log.Debug("ignoring read receipt for unknown message", "event_id", eventID)
+			continue
+		}
+
+		// Reading the newest bridged message (e.g. by opening the room)
+		// marks the whole WeChat chat read, so nothing stays unread on the
+		// phone that has no mapping of its own.
+		msgID := mapping.WeChatMsgID
+		if er.isLatestMapping(ctx, room, mapping) {
+			msgID = ""
+		}
+
+		if err := provider.MarkRead(ctx, room.WeChatChatID, msgID); err != nil {
+			return fmt.Errorf("mark wechat message read: %w", err)
+		}
+		er.log.Debug("forwarded Matrix read receipt to WeChat",
+			"matrix_event", eventID, "wechat_msg", mapping.WeChatMsgID, "whole_chat", msgID == "")
+	}
+
+	return nil
+}
+
+// isLatestMapping reports whether mapping is the newest message bridged into
+// the room. Lookup errors are logged and treated as false.
+func (er *EventRouter) isLatestMapping(ctx context.Context, room *database.RoomMapping, mapping *database.MessageMapping) bool {
+	last, err := er.messages.GetLastTimestamp(ctx, room.MatrixRoomID)
+	if err != nil {
+		er.log.Warn("failed to look up latest message for read receipt",
+			"room_id", room.MatrixRoomID, "error", err)
+		return false
+	}
+	return last != nil && !mapping.Timestamp.Before(*last)
+}
+
+// receiptFromBridgeUser reports whether a receipt's readers include the
+// room's bridge user. Rooms without a recorded owner accept any non-puppet.
+func (er *EventRouter) receiptFromBridgeUser(readers map[string]interface{}, room *database.RoomMapping) bool {
+	for userID := range readers {
+		if er.puppets != nil && er.puppets.IsPuppet(userID) {
+			continue
+		}
+		if room.BridgeUser == "" || room.BridgeUser == userID {
+			return true
+		}
+	}
+	return false
+}
+
 // handleMatrixEncrypted decrypts an m.room.encrypted event and processes the plaintext.
 func (er *EventRouter) handleMatrixEncrypted(ctx context.Context, evt *MatrixEvent, room *database.RoomMapping) error {
 	decryptedType, decryptedContent, err := er.crypto.Decrypt(ctx, evt.RoomID, evt.Content)
@@ -461,18 +1246,28 @@ func (er *EventRouter) handleMatrixEncrypted(ctx context.Context, evt *MatrixEve
 // === WeChat → Matrix direction (wechat.MessageHandler implementation) ===
 
 // OnMessage handles incoming WeChat messages and forwards them to Matrix.
-func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error {
+func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) (err error) {
 	startTime := time.Now()
 	er.log.Info("received wechat message",
 		"msg_id", msg.MsgID, "type", msg.Type, "from", msg.FromUser)
 
 	if er.metrics != nil {
+		msgType := msg.Type.String()
 		er.metrics.IncrMessagesReceived()
+		er.metrics.IncrMessagesByType(retryInbound, msgType)
 		defer func() {
 			er.metrics.ObserveWeChatToMatrixLatency(time.Since(startTime))
+			if err != nil {
+				er.metrics.IncrMessagesFailedByType(retryInbound, msgType)
+			}
 		}()
 	}
 
+	er.correctLiveTimestamp(ctx, msg)
+	if er.dropStaleMessage(msg) {
+		return nil
+	}
+
 	// Get or create the sender puppet
 	senderPuppet, err := er.puppets.GetOrCreate(ctx, &wechat.ContactInfo{
 		UserID:   msg.FromUser,
@@ -482,12 +1277,6 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 		return fmt.Errorf("get sender puppet: %w", err)
 	}
 
-	// Determine the chat ID (group or DM)
-	chatID := msg.FromUser
-	if msg.IsGroup {
-		chatID = msg.GroupID
-	}
-
 	// Find the bridge user for this chat
 	bridgeUser, err := er.findBridgeUser(ctx)
 	if err != nil {
@@ -498,17 +1287,101 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 		return nil
 	}
 
+	// Drop duplicate deliveries of the same message (e.g. via both WebSocket
+	// and webhook). The key is released again if bridging fails so that a
+	// redelivery can retry.
+	dedupKey := ""
+	if msg.MsgID != "" {
+		dedupKey = bridgeUser.MatrixUserID + "\x00" + msg.MsgID
+		if !er.recentMessages.add(dedupKey) {
+			if er.metrics != nil {
+				er.metrics.IncrDedupHits()
+			}
+			er.log.Debug("dropping duplicate wechat message", "msg_id", msg.MsgID)
+			return nil
+		}
+		if er.metrics != nil {
+			er.metrics.IncrDedupMisses()
+		}
+	}
+	forwarded := false
+	defer func() {
+		if dedupKey != "" && !forwarded {
+			er.recentMessages.remove(dedupKey)
+		}
+	}()
+
+	// Invitations to groups that need confirmation become a prompt in the
+	// management room instead of a link card in the inviter's DM.
+	if !msg.IsGroup {
+		if invite := parseGroupInvite(msg); invite != nil {
+			inviterName := senderPuppet.Nickname
+			if inviterName == "" {
+				inviterName = msg.FromUser
+			}
+			if er.promptGroupInvite(ctx, bridgeUser, inviterName, invite) {
+				forwarded = true
+				return nil
+			}
+		}
+	}
+
+	// Being removed from a group ends bridging of that group.
+	if groupID := parseGroupRemoval(msg); groupID != "" {
+		if err := er.handleGroupRemoval(ctx, bridgeUser, groupID); err != nil {
+			return fmt.Errorf("handle group removal: %w", err)
+		}
+		forwarded = true
+		return nil
+	}
+
+	// Determine the chat ID (group or DM). Messages the user sent from their
+	// phone belong to the chat with the recipient.
+	fromSelf := er.isFromSelf(ctx, msg, bridgeUser)
+	chatID := msg.FromUser
+	if msg.IsGroup {
+		chatID = msg.GroupID
+	} else if fromSelf && msg.ToUser != "" {
+		chatID = msg.ToUser
+	}
+	if er.isNotesMessage(msg) {
+		chatID, fromSelf = fileHelperID, true
+	}
+	if !er.chatBridged(chatID) {
+		er.log.Debug("dropping message from filtered chat", "msg_id", msg.MsgID, "chat_id", chatID)
+		forwarded = true
+		return nil
+	}
+
 	// Get or create the room
 	room, err := er.getOrCreateRoom(ctx, chatID, msg.IsGroup, bridgeUser.MatrixUserID)
 	if err != nil {
 		return fmt.Errorf("get or create room: %w", err)
 	}
 
+	// A stored mapping means the message was bridged before, e.g. by another
+	// delivery before a restart.
+	if msg.MsgID != "" && er.messages != nil {
+		existing, err := er.messages.GetByWeChatMsgID(ctx, msg.MsgID, room.MatrixRoomID)
+		if err != nil {
+			er.log.Warn("failed to check for duplicate message", "error", err, "msg_id", msg.MsgID)
+		} else if existing != nil {
+			er.log.Debug("dropping already bridged wechat message", "msg_id", msg.MsgID)
+			forwarded = true
+			return nil
+		}
+	}
+
+	if er.patAsReaction && er.bridgePatAsReaction(ctx, msg, room, bridgeUser) {
+		forwarded = true
+		return nil
+	}
+
 	// Convert the message
 	if er.processor == nil {
 		return fmt.Errorf("message processor not initialized")
 	}
-	content, err := er.processor.WeChatToMatrix(ctx, msg)
+	content, err := er.convertWeChatMessage(ctx, msg)
 	if err != nil {
 		return fmt.Errorf("convert wechat message: %w", err)
 	}
@@ -517,8 +1390,16 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 	}
 
 	// Resolve reply-to: convert WeChat msg ID → Matrix event ID
-	if msg.ReplyTo != "" {
-		er.resolveReplyTo(ctx, msg.ReplyTo, room.MatrixRoomID, content)
+	er.resolveReply(ctx, msg, room.MatrixRoomID, content)
+	body := mappingBody(content.Content)
+
+	// Highlight group messages that @-mention the bridge user
+	if msg.IsGroup && !fromSelf && mentionsSelf(msg, er.selfContact(ctx)) {
+		addUserMention(content.Content, bridgeUser.MatrixUserID)
+	}
+	// and those that @-mention everyone, as @room
+	if msg.IsGroup && mentionsAll(msg) {
+		addRoomMention(content.Content)
 	}
 
 	// Encrypt if the room has encryption enabled
@@ -537,9 +1418,23 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 			"msg_id", msg.MsgID)
 		return nil
 	}
-	eventID, err := er.matrixClient.SendMessage(ctx, room.MatrixRoomID, senderPuppet.MatrixUserID, content.Content)
-	if err != nil {
-		return fmt.Errorf("send matrix message: %w", err)
+	eventID, sent := "", false
+	if fromSelf {
+		eventID, sent = er.sendAsBridgeUser(ctx, room.MatrixRoomID, bridgeUser.MatrixUserID, content.EventType, content.Content)
+	}
+	if !sent {
+		err = er.retrier.do(ctx, retryInbound, func() error {
+			var sendErr error
+			eventID, sendErr = er.matrixClient.SendMessage(ctx, room.MatrixRoomID, senderPuppet.MatrixUserID, content.EventType, content.Content)
+			return sendErr
+		})
+		if err != nil {
+			return fmt.Errorf("send matrix message: %w", err)
+		}
+	}
+	forwarded = true
+	if content.Transcript != "" {
+		er.sendTranscript(ctx, room.MatrixRoomID, senderPuppet.MatrixUserID, eventID, content.Transcript)
 	}
 
 	// Save message mapping
@@ -549,6 +1444,8 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 		MatrixRoomID:  room.MatrixRoomID,
 		Sender:        msg.FromUser,
 		MsgType:       int(msg.Type),
+		Body:          body,
+		Timestamp:     messageTime(msg),
 	}
 	if er.messages == nil {
 		er.log.Warn("message store not initialized, skipping mapping save",
@@ -560,19 +1457,90 @@ func (er *EventRouter) OnMessage(ctx context.Context, msg *wechat.Message) error
 	return nil
 }
 
-// OnLoginEvent handles login state changes from the provider.
+// isFromSelf reports whether a WeChat message was sent by the logged-in
+// account itself, e.g. from the user's phone.
+func (er *EventRouter) isFromSelf(ctx context.Context, msg *wechat.Message, bridgeUser *database.BridgeUser) bool {
+	if self := er.selfContact(ctx); self != nil {
+		return msg.FromUser == self.UserID
+	}
+	return bridgeUser.WeChatID != "" && msg.FromUser == bridgeUser.WeChatID
+}
+
+// selfContact returns the logged-in WeChat account of the provider in
+// context, or nil if unknown.
+func (er *EventRouter) selfContact(ctx context.Context) *wechat.ContactInfo {
+	provider, err := er.getProviderForContext(ctx)
+	if err != nil || provider == nil {
+		return nil
+	}
+	if self := provider.GetSelf(); self != nil && self.UserID != "" {
+		return self
+	}
+	return nil
+}
+
+// sendAsBridgeUser sends content from the bridge user's real Matrix account
+// (double puppeting). It reports false if double puppeting is unavailable
+// or failed, in which case the caller falls back to the puppet.
+func (er *EventRouter) sendAsBridgeUser(ctx context.Context, roomID, userID, eventType string, content map[string]interface{}) (string, bool) {
+	if er.doublePuppet == nil {
+		return "", false
+	}
+	token, err := er.doublePuppet.AccessToken(ctx, userID)
+	if err != nil {
+		er.log.Warn("failed to get double puppet token", "error", err, "user_id", userID)
+		return "", false
+	}
+	if token == "" {
+		return "", false
+	}
+
+	content[doublePuppetSourceKey] = doublePuppetSourceValue
+	eventID, err := er.matrixClient.SendMessageAs(ctx, roomID, userID, token, eventType, content)
+	if err != nil {
+		delete(content, doublePuppetSourceKey)
+		var mErr *matrixError
+		if errors.As(err, &mErr) && mErr.ErrCode == "M_UNKNOWN_TOKEN" {
+			er.doublePuppet.Invalidate(ctx, userID)
+		}
+		er.log.Warn("failed to send as double puppet, falling back to puppet",
+			"error", err, "user_id", userID, "room_id", roomID)
+		return "", false
+	}
+	return eventID, true
+}
+
+// OnLoginEvent handles login state changes from the provider. The state is
+// persisted and reported to the bridge user: in the room the login command
+// was sent from, or else in their management room.
 func (er *EventRouter) OnLoginEvent(ctx context.Context, evt *wechat.LoginEvent) error {
 	if evt == nil {
 		return fmt.Errorf("login event is nil")
 	}
+
+	bridgeUser, err := er.recordLoginEvent(ctx, evt)
+
+	roomID, _ := ctx.Value(loginRoomKey).(string)
+	if roomID == "" && bridgeUser != nil {
+		roomID = bridgeUser.ManagementRoom
+	}
+	if roomID != "" {
+		er.notifyLoginEvent(ctx, roomID, evt)
+	}
+	return err
+}
+
+// recordLoginEvent stores the new login state of the bridge user and returns
+// the updated user, or nil when the event can't be attributed to one.
+func (er *EventRouter) recordLoginEvent(ctx context.Context, evt *wechat.LoginEvent) (*database.BridgeUser, error) {
 	if er.bridgeUsers == nil {
 		er.log.Warn("bridge user store not initialized, skipping login event persistence")
-		return nil
+		return nil, nil
 	}
 
-	bridgeUserID, err := er.resolveLoginEventBridgeUser(ctx)
+	bridgeUserID, err := er.resolveLoginEventBridgeUser(ctx, evt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	er.log.Info("login event",
@@ -581,13 +1549,13 @@ func (er *EventRouter) OnLoginEvent(ctx context.Context, evt *wechat.LoginEvent)
 		"wechat_id", evt.UserID)
 
 	if bridgeUserID == "" {
-		return nil
+		return nil, nil
 	}
 
-	providerType := er.loginEventProviderType()
+	providerType := er.loginEventProviderType(ctx, bridgeUserID)
 	existing, err := er.bridgeUsers.GetByMatrixID(ctx, bridgeUserID)
 	if err != nil {
-		return fmt.Errorf("get bridge user for login event: %w", err)
+		return nil, fmt.Errorf("get bridge user for login event: %w", err)
 	}
 
 	bridgeUser := &database.BridgeUser{
@@ -614,19 +1582,34 @@ func (er *EventRouter) OnLoginEvent(ctx context.Context, evt *wechat.LoginEvent)
 	}
 
 	if err := er.bridgeUsers.Upsert(ctx, bridgeUser); err != nil {
-		return fmt.Errorf("upsert bridge user for login event: %w", err)
+		return nil, fmt.Errorf("upsert bridge user for login event: %w", err)
+	}
+
+	// The account's nickname and avatar live on its puppet like any contact's
+	if evt.State == wechat.LoginStateLoggedIn && evt.UserID != "" && evt.Name != "" && er.puppets != nil {
+		if err := er.puppets.UpdateProfile(ctx, &wechat.ContactInfo{
+			UserID:    evt.UserID,
+			Nickname:  evt.Name,
+			AvatarURL: evt.Avatar,
+		}); err != nil {
+			er.log.Warn("failed to store logged in account profile", "error", err, "wechat_id", evt.UserID)
+		}
 	}
 
 	if er.multiTenant && er.sessionManager != nil {
 		er.sessionManager.UpdateSessionLoginState(bridgeUserID, evt.State)
 		if er.sessionManager.db != nil && er.sessionManager.db.NodeAssignment != nil {
 			if err := er.sessionManager.db.NodeAssignment.UpdateLoginState(ctx, bridgeUserID, int(evt.State), evt.UserID); err != nil {
-				return fmt.Errorf("update node assignment login state: %w", err)
+				return bridgeUser, fmt.Errorf("update node assignment login state: %w", err)
 			}
 		}
 	}
 
-	return nil
+	if evt.State == wechat.LoginStateLoggedIn {
+		go er.syncContactsOnLogin(bridgeUserID)
+	}
+
+	return bridgeUser, nil
 }
 
 // OnContactUpdate handles contact info updates from the provider.
@@ -651,7 +1634,11 @@ func (er *EventRouter) OnContactUpdate(ctx context.Context, contact *wechat.Cont
 }
 
 // OnGroupMemberUpdate handles group member changes.
-// It syncs WeChat group membership to Matrix room membership.
+// It syncs WeChat group membership to Matrix room membership: members who
+// joined since the last update have their puppets join the room and members
+// who left have their puppets leave it, so both show up in the timeline.
+// The first update for a group (nothing stored yet) is a full sync of members
+// already in the room since it was created, and is only recorded.
 func (er *EventRouter) OnGroupMemberUpdate(ctx context.Context, groupID string, members []*wechat.GroupMember) error {
 	er.log.Info("group member update", "group_id", groupID, "count", len(members))
 
@@ -680,6 +1667,8 @@ func (er *EventRouter) OnGroupMemberUpdate(ctx context.Context, groupID string,
 	for _, m := range existingMembers {
 		existingMap[m.WeChatID] = m
 	}
+	initialSync := len(existingMap) == 0
+	largeGroup := er.isLargeGroup(groupID, len(members))
 
 	// Build new member set
 	newMemberIDs := make(map[string]bool)
@@ -697,7 +1686,7 @@ func (er *EventRouter) OnGroupMemberUpdate(ctx context.Context, groupID string,
 		}
 
 		// If new member, invite/join to Matrix room
-		if _, exists := existingMap[m.UserID]; !exists && er.matrixClient != nil {
+		if _, exists := existingMap[m.UserID]; !exists && !initialSync && !largeGroup && er.matrixClient != nil {
 			if err := er.matrixClient.InviteToRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID); err != nil {
 				er.log.Warn("failed to invite puppet to room", "error", err, "user_id", m.UserID)
 			}
@@ -732,8 +1721,11 @@ func (er *EventRouter) OnGroupMemberUpdate(ctx context.Context, groupID string,
 		if !newMemberIDs[wechatID] {
 			puppet, _ := er.puppets.GetByWeChatID(ctx, wechatID)
 			if puppet != nil && er.matrixClient != nil {
-				if err := er.matrixClient.KickFromRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID, "removed from WeChat group"); err != nil {
-					er.log.Warn("failed to kick puppet from room", "error", err, "user_id", wechatID)
+				if err := er.matrixClient.LeaveRoom(ctx, puppet.MatrixUserID, room.MatrixRoomID); err != nil {
+					er.log.Warn("failed to leave room as puppet, kicking instead", "error", err, "user_id", wechatID)
+					if err := er.matrixClient.KickFromRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID, "left the WeChat group"); err != nil {
+						er.log.Warn("failed to kick puppet from room", "error", err, "user_id", wechatID)
+					}
 				}
 			}
 			if err := er.groupMembers.DeleteMember(ctx, groupID, member.WeChatID); err != nil {
@@ -742,6 +1734,7 @@ func (er *EventRouter) OnGroupMemberUpdate(ctx context.Context, groupID string,
 		}
 	}
 
+	er.applyMemberNames(ctx, room.MatrixRoomID, newMemberIDs)
 	return nil
 }
 
@@ -782,7 +1775,7 @@ func (er *EventRouter) OnTyping(ctx context.Context, userID string, chatID strin
 }
 
 // OnRevoke handles message revocation events (WeChat → Matrix redaction).
-func (er *EventRouter) OnRevoke(ctx context.Context, msgID string, replaceTip string) error {
+func (er *EventRouter) OnRevoke(ctx context.Context, chatID, msgID, replaceTip string) error {
 	if er.matrixClient == nil {
 		return nil
 	}
@@ -790,9 +1783,9 @@ func (er *EventRouter) OnRevoke(ctx context.Context, msgID string, replaceTip st
 		er.log.Warn("message store not initialized, cannot bridge revoke", "msg_id", msgID)
 		return nil
 	}
-	mapping, err := er.messages.GetLatestByWeChatMsgID(ctx, msgID)
+	mapping, err := er.findMessageInChat(ctx, chatID, msgID)
 	if err != nil || mapping == nil {
-		er.log.Debug("ignoring revoke for unknown message", "msg_id", msgID)
+		er.log.Debug("ignoring revoke for unknown message", "msg_id", msgID, "chat_id", chatID)
 		return nil
 	}
 
@@ -810,20 +1803,69 @@ func (er *EventRouter) OnRevoke(ctx context.Context, msgID string, replaceTip st
 	return nil
 }
 
+// findMessageInChat returns the mapping of a WeChat message in the bridge
+// user's room for chatID. The same message ID may be mapped in several
+// rooms, so the most recent mapping in any room is only used when the chat
+// is unknown: empty, or the account itself, as for recalls from the
+// account's own phone.
+func (er *EventRouter) findMessageInChat(ctx context.Context, chatID, msgID string) (*database.MessageMapping, error) {
+	if chatID != "" {
+		bridgeUser, err := er.findBridgeUser(ctx)
+		if err == nil && bridgeUser != nil && chatID != bridgeUser.WeChatID {
+			return er.messages.GetByWeChatMsgIDAndChat(ctx, msgID, chatID, bridgeUser.MatrixUserID)
+		}
+	}
+	return er.messages.GetByWeChatMsgID(ctx, msgID, "")
+}
+
 // === Reply resolution ===
 
-// resolveReplyTo converts a WeChat reply-to message ID to a Matrix m.in_reply_to reference.
-func (er *EventRouter) resolveReplyTo(ctx context.Context, wechatMsgID, matrixRoomID string, content *MatrixEventContent) {
+// resolveReply links a converted message to the Matrix event it replies to.
+// The replied-to message comes from msg.ReplyTo or, for quote replies, from
+// the quoted message, whose fallback then links to the Matrix event.
+func (er *EventRouter) resolveReply(ctx context.Context, msg *wechat.Message, matrixRoomID string, content *MatrixEventContent) {
+	quote := parseQuote(msg)
+	replyTo := msg.ReplyTo
+	if replyTo == "" && quote != nil {
+		replyTo = quote.MsgID
+	}
+	if replyTo == "" {
+		return
+	}
+
+	mapping := er.resolveReplyTo(ctx, replyTo, matrixRoomID, content)
+	if mapping == nil {
+		return
+	}
+	if quote != nil {
+		setQuoteContent(content.Content, quote, matrixEventLink(matrixRoomID, mapping.MatrixEventID))
+		return
+	}
+	setReplyFallback(content.Content, matrixRoomID, mapping, er.mappingSenderMXID(mapping.Sender))
+}
+
+// mappingSenderMXID returns the Matrix user ID of a mapped message's sender.
+// Incoming messages record the WeChat ID, which maps to its puppet.
+func (er *EventRouter) mappingSenderMXID(sender string) string {
+	if strings.HasPrefix(sender, "@") || er.puppets == nil {
+		return sender
+	}
+	return er.puppets.wechatIDToMatrixID(sender)
+}
+
+// resolveReplyTo converts a WeChat reply-to message ID to a Matrix m.in_reply_to
+// reference. It returns the mapping of the replied-to message, or nil if unknown.
+func (er *EventRouter) resolveReplyTo(ctx context.Context, wechatMsgID, matrixRoomID string, content *MatrixEventContent) *database.MessageMapping {
 	if er.messages == nil {
 		er.log.Warn("message store not initialized, cannot resolve reply",
 			"wechat_msg_id", wechatMsgID)
-		return
+		return nil
 	}
 
 	mapping, err := er.messages.GetByWeChatMsgID(ctx, wechatMsgID, matrixRoomID)
 	if err != nil || mapping == nil {
 		er.log.Debug("reply-to message not found in mapping", "wechat_msg_id", wechatMsgID)
-		return
+		return nil
 	}
 
 	// Set Matrix reply relation
@@ -832,6 +1874,7 @@ func (er *EventRouter) resolveReplyTo(ctx context.Context, wechatMsgID, matrixRo
 			"event_id": mapping.MatrixEventID,
 		},
 	}
+	return mapping
 }
 
 // === Avatar sync ===
@@ -850,28 +1893,13 @@ func (er *EventRouter) syncPuppetAvatar(ctx context.Context, puppet *Puppet, con
 			"user_id", contact.UserID)
 		return
 	}
-	avatarData, mimeType, err := provider.GetUserAvatar(ctx, contact.UserID)
-	if err != nil {
-		er.log.Warn("failed to download avatar for puppet",
-			"error", err, "user_id", contact.UserID)
-		return
-	}
 
-	mxcURI, err := er.matrixClient.UploadMedia(ctx, avatarData, mimeType, "avatar")
+	mxcURI, err := er.uploadPuppetAvatar(ctx, provider, puppet)
 	if err != nil {
-		er.log.Warn("failed to upload avatar to Matrix",
-			"error", err, "user_id", contact.UserID)
-		return
-	}
-
-	if err := er.matrixClient.SetAvatarURL(ctx, puppet.MatrixUserID, mxcURI); err != nil {
-		er.log.Warn("failed to set puppet avatar",
+		er.log.Warn("failed to sync puppet avatar",
 			"error", err, "user_id", contact.UserID)
 		return
 	}
-
-	puppet.AvatarMXC = mxcURI
-	puppet.AvatarSet = true
 	er.log.Info("synced puppet avatar", "user_id", contact.UserID, "mxc", mxcURI)
 }
 
@@ -934,6 +1962,8 @@ func (er *EventRouter) BackfillRoom(ctx context.Context, room *database.RoomMapp
 		"message_count", len(messages))
 
 	for _, msg := range messages {
+		er.correctTimestamp(ctx, msg)
+
 		// Skip already-bridged messages
 		existing, _ := er.messages.GetByWeChatMsgID(ctx, msg.MsgID, room.MatrixRoomID)
 		if existing != nil {
@@ -951,20 +1981,18 @@ func (er *EventRouter) BackfillRoom(ctx context.Context, room *database.RoomMapp
 		}
 
 		// Convert message
-		content, err := er.processor.WeChatToMatrix(ctx, msg)
+		content, err := er.convertWeChatMessage(ctx, msg)
 		if err != nil || content == nil {
 			continue
 		}
 
 		// Resolve replies
-		if msg.ReplyTo != "" {
-			er.resolveReplyTo(ctx, msg.ReplyTo, room.MatrixRoomID, content)
-		}
+		er.resolveReply(ctx, msg, room.MatrixRoomID, content)
 
 		// Send with historical timestamp
 		eventID, err := er.matrixClient.SendMessageWithTimestamp(
 			ctx, room.MatrixRoomID, senderPuppet.MatrixUserID,
-			content.Content, msg.Timestamp,
+			content.EventType, content.Content, msg.Timestamp,
 		)
 		if err != nil {
 			er.log.Error("backfill: failed to send message",
@@ -979,6 +2007,8 @@ func (er *EventRouter) BackfillRoom(ctx context.Context, room *database.RoomMapp
 			MatrixRoomID:  room.MatrixRoomID,
 			Sender:        msg.FromUser,
 			MsgType:       int(msg.Type),
+			Body:          mappingBody(content.Content),
+			Timestamp:     messageTime(msg),
 		})
 	}
 
@@ -987,6 +2017,15 @@ func (er *EventRouter) BackfillRoom(ctx context.Context, room *database.RoomMapp
 
 // === Helpers ===
 
+// messageTime returns when a WeChat message was sent, or now if the provider
+// gave no timestamp.
+func messageTime(msg *wechat.Message) time.Time {
+	if msg.Timestamp > 0 {
+		return time.UnixMilli(msg.Timestamp)
+	}
+	return time.Now()
+}
+
 // findBridgeUser returns the bridge user for the current context.
 // In multi-tenant mode, extracts bridge user ID from context (injected by userMessageHandler).
 // In single-user mode, returns the first logged-in bridge user.
@@ -1021,6 +2060,18 @@ func (er *EventRouter) findBridgeUser(ctx context.Context) (*database.BridgeUser
 
 // === Multi-tenant provider routing helpers ===
 
+// isManagementRoom reports whether roomID is the sender's management room.
+func (er *EventRouter) isManagementRoom(ctx context.Context, sender, roomID string) bool {
+	if er.bridgeUsers == nil {
+		return false
+	}
+	user, err := er.bridgeUsers.GetByMatrixID(ctx, sender)
+	if err != nil || user == nil {
+		return false
+	}
+	return user.ManagementRoom != "" && user.ManagementRoom == roomID
+}
+
 // getProviderForRoom returns the appropriate provider for a room.
 // In multi-tenant mode, it looks up the provider via the room's bridge user.
 func (er *EventRouter) getProviderForRoom(ctx context.Context, room *database.RoomMapping) (wechat.Provider, error) {
@@ -1058,34 +2109,76 @@ func (er *EventRouter) getProviderForContext(ctx context.Context) (wechat.Provid
 	return er.getProviderForUser(ctx, uid)
 }
 
-func (er *EventRouter) resolveLoginEventBridgeUser(ctx context.Context) (string, error) {
+func (er *EventRouter) resolveLoginEventBridgeUser(ctx context.Context, evt *wechat.LoginEvent) (string, error) {
+	uid, ok := BridgeUserFromContext(ctx)
 	if er.multiTenant {
-		uid, ok := BridgeUserFromContext(ctx)
 		if !ok || uid == "" {
 			return "", fmt.Errorf("multi-tenant login event missing bridge user context")
 		}
 		return uid, nil
 	}
+	// Events reported while a login command runs carry its sender
+	if uid != "" {
+		return uid, nil
+	}
 
 	bridgeUser, err := er.findBridgeUser(ctx)
-	if err != nil || bridgeUser == nil {
+	if err != nil {
+		return "", err
+	}
+	if bridgeUser != nil {
+		return bridgeUser.MatrixUserID, nil
+	}
+
+	// Nobody is logged in yet, e.g. when the provider restores a session on
+	// its own: use the user who linked this account before, or the only user.
+	if evt.UserID != "" {
+		linked, err := er.bridgeUsers.GetByWeChatID(ctx, evt.UserID)
+		if err != nil {
+			return "", err
+		}
+		if linked != nil {
+			return linked.MatrixUserID, nil
+		}
+	}
+	users, err := er.bridgeUsers.GetAll(ctx)
+	if err != nil {
 		return "", err
 	}
-	return bridgeUser.MatrixUserID, nil
+	if len(users) == 1 {
+		return users[0].MatrixUserID, nil
+	}
+	return "", nil
 }
 
-func (er *EventRouter) loginEventProviderType() string {
-	if er.multiTenant {
-		return "padpro"
+// sessionBridgeUser returns the bridge user whose session the shared
+// provider holds, found like the user of a login event, or "" if nobody is
+// linked to it yet.
+func (er *EventRouter) sessionBridgeUser(ctx context.Context) (string, error) {
+	if er.bridgeUsers == nil {
+		return "", nil
 	}
-	if provider := er.getProvider(); provider != nil {
+	return er.resolveLoginEventBridgeUser(ctx, &wechat.LoginEvent{})
+}
+
+// loginEventProviderType names the provider behind a login event: the bridge
+// user's own session in multi-tenant mode, the shared provider otherwise.
+func (er *EventRouter) loginEventProviderType(ctx context.Context, bridgeUserID string) string {
+	provider, err := er.getProviderForUser(ctx, bridgeUserID)
+	if err == nil && provider != nil {
 		return provider.Name()
 	}
+	if er.multiTenant {
+		return "padpro"
+	}
 	return ""
 }
 
 // getOrCreateRoom finds or creates a Matrix room for a WeChat chat.
 func (er *EventRouter) getOrCreateRoom(ctx context.Context, chatID string, isGroup bool, bridgeUser string) (*database.RoomMapping, error) {
+	if !er.chatBridged(chatID) {
+		return nil, errChatFiltered
+	}
 	room, err := er.rooms.GetByWeChatChat(ctx, chatID, bridgeUser)
 	if err != nil {
 		return nil, err
@@ -1104,18 +2197,41 @@ func (er *EventRouter) getOrCreateRoom(ctx context.Context, chatID string, isGro
 		Invite:   []string{bridgeUser},
 	}
 
+	if er.isNotesChat(chatID) {
+		req.Name = er.notesRoomName
+	}
+	if er.isMomentsChat(chatID) {
+		req.Name = er.momentsRoomName
+		req.IsDirect = false
+	}
+
 	provider, _ := er.getProviderForUser(ctx, bridgeUser)
+	var groupInfo *wechat.ContactInfo
 	if isGroup && provider != nil {
-		groupInfo, err := provider.GetGroupInfo(ctx, chatID)
-		if err == nil && groupInfo != nil {
-			req.Name = groupInfo.Nickname
+		info, err := provider.GetGroupInfo(ctx, chatID)
+		if err != nil {
+			er.log.Warn("failed to get group info", "error", err, "group_id", chatID)
+		} else if info != nil {
+			groupInfo = info
 		}
 	}
 
+	// Looked up before naming the room, which takes over the old room's name
+	predecessor := er.recreatedGroupRoom(ctx, provider, bridgeUser, chatID, groupInfo)
+	if predecessor != nil {
+		req.Predecessor = predecessor.MatrixRoomID
+	}
+	if groupInfo != nil {
+		req.Name = er.groupRoomName(ctx, bridgeUser, chatID, groupInfo)
+	}
+
 	matrixRoomID, err := er.matrixClient.CreateRoom(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("create matrix room: %w", err)
 	}
+	if predecessor != nil {
+		er.tombstoneRoom(ctx, predecessor, matrixRoomID)
+	}
 
 	room = &database.RoomMapping{
 		WeChatChatID: chatID,
@@ -1125,15 +2241,130 @@ func (er *EventRouter) getOrCreateRoom(ctx context.Context, chatID string, isGro
 		Name:         req.Name,
 	}
 
+	if groupInfo != nil {
+		er.syncGroupRoomInfo(ctx, provider, room, groupInfo)
+	}
+
 	if err := er.rooms.Upsert(ctx, room); err != nil {
 		return nil, fmt.Errorf("save room mapping: %w", err)
 	}
 
+	if isGroup && provider != nil {
+		er.joinGroupMembers(ctx, provider, room)
+	}
+	er.backfillNewRoom(ctx, provider, room)
+
 	// Add to user's Space
-	user, _ := er.bridgeUsers.GetByMatrixID(ctx, bridgeUser)
-	if user != nil {
-		er.AddRoomToUserSpace(ctx, user, matrixRoomID)
+	if er.bridgeUsers != nil {
+		user, _ := er.bridgeUsers.GetByMatrixID(ctx, bridgeUser)
+		if user != nil {
+			er.AddRoomToUserSpace(ctx, user, matrixRoomID)
+		}
+	}
+
+	return room, nil
+}
+
+// OpenDirectChat creates (or finds) the direct chat room with a contact
+// before any message has been exchanged, refreshing the contact's puppet and
+// making sure it has joined the room.
+func (er *EventRouter) OpenDirectChat(ctx context.Context, contact *wechat.ContactInfo, bridgeUser string) (*database.RoomMapping, error) {
+	puppet, err := er.puppets.GetOrCreate(ctx, contact)
+	if err != nil {
+		return nil, fmt.Errorf("get puppet: %w", err)
+	}
+	if err := er.OnContactUpdate(ctx, contact); err != nil {
+		er.log.Warn("failed to update contact profile", "error", err, "user_id", contact.UserID)
 	}
 
+	room, err := er.getOrCreateRoom(ctx, contact.UserID, false, bridgeUser)
+	if err != nil {
+		return nil, fmt.Errorf("get or create room: %w", err)
+	}
+
+	if err := er.matrixClient.InviteToRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID); err != nil {
+		er.log.Debug("failed to invite puppet to direct chat", "error", err, "room_id", room.MatrixRoomID)
+	}
+	if err := er.matrixClient.JoinRoom(ctx, puppet.MatrixUserID, room.MatrixRoomID); err != nil {
+		return nil, fmt.Errorf("join puppet to room: %w", err)
+	}
 	return room, nil
 }
+
+// syncGroupRoomInfo copies a group's avatar and announcement onto its Matrix
+// room. A new announcement is also posted and pinned. Failures are logged so
+// room creation still succeeds.
+func (er *EventRouter) syncGroupRoomInfo(ctx context.Context, provider wechat.Provider, room *database.RoomMapping, info *wechat.ContactInfo) {
+	avatarData, mimeType, err := provider.GetUserAvatar(ctx, room.WeChatChatID)
+	if err != nil {
+		er.log.Warn("failed to download group avatar", "error", err, "group_id", room.WeChatChatID)
+	} else if len(avatarData) > 0 {
+		mxcURI, err := er.matrixClient.UploadMedia(ctx, avatarData, mimeType, "avatar")
+		if err != nil {
+			er.log.Warn("failed to upload group avatar", "error", err, "group_id", room.WeChatChatID)
+		} else if err := er.matrixClient.SetRoomAvatar(ctx, room.MatrixRoomID, mxcURI); err != nil {
+			er.log.Warn("failed to set room avatar", "error", err, "room_id", room.MatrixRoomID)
+		} else {
+			room.AvatarMXC = mxcURI
+			room.AvatarSet = true
+		}
+	}
+
+	if info.Announcement != "" {
+		changed := info.Announcement != room.Topic
+		if err := er.matrixClient.SetRoomTopic(ctx, room.MatrixRoomID, info.Announcement); err != nil {
+			er.log.Warn("failed to set room topic", "error", err, "room_id", room.MatrixRoomID)
+		} else {
+			room.Topic = info.Announcement
+		}
+		if changed {
+			er.pinAnnouncement(ctx, room, info.Announcement)
+		}
+	}
+}
+
+// joinGroupMembers invites and joins the puppets of all current group members
+// to a newly created group room so it isn't empty until members start talking.
+func (er *EventRouter) joinGroupMembers(ctx context.Context, provider wechat.Provider, room *database.RoomMapping) {
+	members, err := provider.GetGroupMembers(ctx, room.WeChatChatID)
+	if err != nil {
+		er.log.Warn("failed to get group members", "error", err, "group_id", room.WeChatChatID)
+		return
+	}
+
+	now := time.Now()
+	largeGroup := er.isLargeGroup(room.WeChatChatID, len(members))
+	for _, m := range members {
+		if !largeGroup {
+			puppet, err := er.puppets.GetOrCreate(ctx, &wechat.ContactInfo{
+				UserID:   m.UserID,
+				Nickname: m.Nickname,
+			})
+			if err != nil {
+				er.log.Error("failed to create puppet for group member", "error", err, "user_id", m.UserID)
+				continue
+			}
+
+			if err := er.matrixClient.InviteToRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID); err != nil {
+				er.log.Warn("failed to invite puppet to room", "error", err, "user_id", m.UserID)
+			}
+			if err := er.matrixClient.JoinRoom(ctx, puppet.MatrixUserID, room.MatrixRoomID); err != nil {
+				er.log.Warn("failed to join puppet to room", "error", err, "user_id", m.UserID)
+			}
+		}
+
+		if er.groupMembers == nil {
+			continue
+		}
+		if err := er.groupMembers.Upsert(ctx, &database.GroupMemberRow{
+			GroupID:     room.WeChatChatID,
+			WeChatID:    m.UserID,
+			DisplayName: m.DisplayName,
+			IsAdmin:     m.IsAdmin,
+			IsOwner:     m.IsOwner,
+			JoinedAt:    &now,
+		}); err != nil {
+			er.log.Error("failed to upsert group member", "error", err, "group_id", room.WeChatChatID, "user_id", m.UserID)
+		}
+	}
+}
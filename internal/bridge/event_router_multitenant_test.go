@@ -384,3 +384,65 @@ func TestEventRouter_OnLoginEvent_MultiTenantPersistsState(t *testing.T) {
 		t.Fatalf("unmet SQL expectations: %v", err)
 	}
 }
+
+func TestEventRouter_OnLoginEvent_MultiTenantRecordsSessionProvider(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	bridgeUsers := database.NewBridgeUserStore(db)
+	dbWrap := &database.Database{
+		BridgeUser:     bridgeUsers,
+		NodeAssignment: database.NewNodeAssignmentStore(db),
+	}
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:         slog.Default(),
+		Puppets:     newTestPuppetManager(),
+		BridgeUsers: bridgeUsers,
+		MultiTenant: true,
+	})
+	sm := NewSessionManager(nil, dbWrap, config.RiskControlConfig{}, er, "info", slog.Default())
+	sm.mu.Lock()
+	sm.sessions["@user:example.com"] = &UserSession{
+		BridgeUserID: "@user:example.com",
+		Provider:     newMockProvider("ipad", 1),
+		LoginState:   wechat.LoginStateQRCode,
+	}
+	sm.mu.Unlock()
+	er.SetSessionManager(sm)
+
+	mock.ExpectQuery(`(?s)SELECT .* FROM bridge_user WHERE matrix_user_id = \$1`).
+		WithArgs("@user:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"matrix_user_id", "wechat_id", "provider_type", "login_state",
+			"management_room", "space_room", "last_login", "created_at",
+		}))
+	mock.ExpectExec(`(?s)INSERT INTO bridge_user .* ON CONFLICT \(matrix_user_id\) DO UPDATE SET`).
+		WithArgs(
+			"@user:example.com",
+			"wxid_test",
+			"ipad",
+			int(wechat.LoginStateLoggedIn),
+			"",
+			"",
+			sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE node_assignment`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	ctx := context.WithValue(context.Background(), bridgeUserKey, "@user:example.com")
+	err = er.OnLoginEvent(ctx, &wechat.LoginEvent{
+		State:  wechat.LoginStateLoggedIn,
+		UserID: "wxid_test",
+	})
+	if err != nil {
+		t.Fatalf("OnLoginEvent error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet SQL expectations: %v", err)
+	}
+}
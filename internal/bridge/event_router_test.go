@@ -3,22 +3,69 @@ package bridge
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"io"
 	"log/slog"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/config"
 	"github.com/n42/mautrix-wechat/internal/database"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
 type testMatrixClient struct {
+	sent       []testSentMessage
 	redactions []testRedaction
 	downloads  []string
 	mediaData  []byte
 	mediaType  string
+
+	purgedMedia  map[string]bool
+	displayNames map[string]string // puppet user ID -> display name
+	avatars      map[string]string // puppet user ID -> avatar MXC
+	roomAvatars  map[string]string // room ID -> avatar MXC
+	roomTopics   map[string]string // room ID -> topic
+	memberNames  map[string]string // room ID + "/" + user ID -> per-room name
+	joined       []string          // user IDs joined to rooms
+	left         []string          // room ID + "/" + user ID for each leave
+
+	uploads   [][]byte          // data passed to UploadMedia
+	sentAs    []testSentMessage // events sent with a real user's token
+	sentAsErr error
+
+	reactions []testReaction
+	receipts  []testReaction // read receipts, with an empty key
+
+	createdRooms []*CreateRoomRequest
+	stateEvents  []testStateEvent
+
+	backfilled []testSentMessage // events sent with a historical timestamp
+
+	pinned map[string][]string // room ID -> pinned event IDs
+}
+
+type testStateEvent struct {
+	roomID    string
+	eventType string
+	content   interface{}
+}
+
+type testReaction struct {
+	roomID  string
+	sender  string
+	eventID string
+	key     string
+}
+
+type testSentMessage struct {
+	roomID    string
+	sender    string
+	eventType string
+	content   interface{}
 }
 
 type testRedaction struct {
@@ -27,12 +74,29 @@ type testRedaction struct {
 	reason  string
 }
 
-const testMessageMappingColumns = `wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, created_at`
+const testMessageMappingColumns = `wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, created_at, body`
+
+var testMessageMappingColumnNames = []string{
+	"wechat_msg_id", "matrix_event_id", "matrix_room_id", "sender", "msg_type", "timestamp", "created_at", "body",
+}
 
-func (m *testMatrixClient) EnsureRegistered(_ context.Context, _ string) error  { return nil }
-func (m *testMatrixClient) SetDisplayName(_ context.Context, _, _ string) error { return nil }
-func (m *testMatrixClient) SetAvatarURL(_ context.Context, _, _ string) error   { return nil }
-func (m *testMatrixClient) UploadMedia(_ context.Context, _ []byte, _, _ string) (string, error) {
+func (m *testMatrixClient) EnsureRegistered(_ context.Context, _ string) error { return nil }
+func (m *testMatrixClient) SetDisplayName(_ context.Context, userID, name string) error {
+	if m.displayNames == nil {
+		m.displayNames = make(map[string]string)
+	}
+	m.displayNames[userID] = name
+	return nil
+}
+func (m *testMatrixClient) SetAvatarURL(_ context.Context, userID, mxcURI string) error {
+	if m.avatars == nil {
+		m.avatars = make(map[string]string)
+	}
+	m.avatars[userID] = mxcURI
+	return nil
+}
+func (m *testMatrixClient) UploadMedia(_ context.Context, data []byte, _, _ string) (string, error) {
+	m.uploads = append(m.uploads, data)
 	return "mxc://test/uploaded", nil
 }
 func (m *testMatrixClient) DownloadMedia(_ context.Context, mxcURI string) (io.ReadCloser, string, error) {
@@ -47,17 +111,40 @@ func (m *testMatrixClient) DownloadMedia(_ context.Context, mxcURI string) (io.R
 	}
 	return io.NopCloser(bytes.NewReader(data)), mimeType, nil
 }
-func (m *testMatrixClient) SendMessage(_ context.Context, _, _ string, _ interface{}) (string, error) {
+func (m *testMatrixClient) MediaExists(_ context.Context, mxcURI string) (bool, error) {
+	return !m.purgedMedia[mxcURI], nil
+}
+func (m *testMatrixClient) SendMessage(_ context.Context, roomID, sender, eventType string, content interface{}) (string, error) {
+	m.sent = append(m.sent, testSentMessage{roomID: roomID, sender: sender, eventType: eventType, content: content})
 	return "$event:test", nil
 }
-func (m *testMatrixClient) SendMessageWithTimestamp(_ context.Context, _, _ string, _ interface{}, _ int64) (string, error) {
+func (m *testMatrixClient) SendReaction(_ context.Context, roomID, sender, eventID, key string) (string, error) {
+	m.reactions = append(m.reactions, testReaction{roomID: roomID, sender: sender, eventID: eventID, key: key})
+	return "$reaction:test", nil
+}
+func (m *testMatrixClient) SendMessageWithTimestamp(_ context.Context, roomID, sender, eventType string, content interface{}, _ int64) (string, error) {
+	m.backfilled = append(m.backfilled, testSentMessage{roomID: roomID, sender: sender, eventType: eventType, content: content})
 	return "$event:test", nil
 }
-func (m *testMatrixClient) CreateRoom(_ context.Context, _ *CreateRoomRequest) (string, error) {
+func (m *testMatrixClient) SendMessageAs(_ context.Context, roomID, userID, _, eventType string, content interface{}) (string, error) {
+	if m.sentAsErr != nil {
+		return "", m.sentAsErr
+	}
+	m.sentAs = append(m.sentAs, testSentMessage{roomID: roomID, sender: userID, eventType: eventType, content: content})
+	return "$double:test", nil
+}
+func (m *testMatrixClient) CreateRoom(_ context.Context, req *CreateRoomRequest) (string, error) {
+	m.createdRooms = append(m.createdRooms, req)
 	return "!room:test", nil
 }
-func (m *testMatrixClient) JoinRoom(_ context.Context, _, _ string) error        { return nil }
-func (m *testMatrixClient) LeaveRoom(_ context.Context, _, _ string) error       { return nil }
+func (m *testMatrixClient) JoinRoom(_ context.Context, userID, _ string) error {
+	m.joined = append(m.joined, userID)
+	return nil
+}
+func (m *testMatrixClient) LeaveRoom(_ context.Context, userID, roomID string) error {
+	m.left = append(m.left, roomID+"/"+userID)
+	return nil
+}
 func (m *testMatrixClient) InviteToRoom(_ context.Context, _, _ string) error    { return nil }
 func (m *testMatrixClient) KickFromRoom(_ context.Context, _, _, _ string) error { return nil }
 func (m *testMatrixClient) RedactEvent(_ context.Context, roomID, eventID, reason string) error {
@@ -68,15 +155,48 @@ func (m *testMatrixClient) RedactEvent(_ context.Context, roomID, eventID, reaso
 	})
 	return nil
 }
-func (m *testMatrixClient) SendStateEvent(_ context.Context, _, _, _ string, _ interface{}) error {
+func (m *testMatrixClient) SendStateEvent(_ context.Context, roomID, eventType, _ string, content interface{}) error {
+	m.stateEvents = append(m.stateEvents, testStateEvent{roomID: roomID, eventType: eventType, content: content})
+	return nil
+}
+func (m *testMatrixClient) SetRoomName(_ context.Context, _, _ string) error { return nil }
+func (m *testMatrixClient) SetRoomAvatar(_ context.Context, roomID, mxcURI string) error {
+	if m.roomAvatars == nil {
+		m.roomAvatars = make(map[string]string)
+	}
+	m.roomAvatars[roomID] = mxcURI
+	return nil
+}
+func (m *testMatrixClient) SetRoomTopic(_ context.Context, roomID, topic string) error {
+	if m.roomTopics == nil {
+		m.roomTopics = make(map[string]string)
+	}
+	m.roomTopics[roomID] = topic
+	return nil
+}
+func (m *testMatrixClient) PinnedEvents(_ context.Context, roomID string) ([]string, error) {
+	return m.pinned[roomID], nil
+}
+func (m *testMatrixClient) SetPinnedEvents(_ context.Context, roomID string, eventIDs []string) error {
+	if m.pinned == nil {
+		m.pinned = make(map[string][]string)
+	}
+	m.pinned[roomID] = eventIDs
+	return nil
+}
+func (m *testMatrixClient) SetRoomMemberName(_ context.Context, roomID, userID, name string) error {
+	if m.memberNames == nil {
+		m.memberNames = make(map[string]string)
+	}
+	m.memberNames[roomID+"/"+userID] = name
 	return nil
 }
-func (m *testMatrixClient) SetRoomName(_ context.Context, _, _ string) error              { return nil }
-func (m *testMatrixClient) SetRoomAvatar(_ context.Context, _, _ string) error            { return nil }
-func (m *testMatrixClient) SetRoomTopic(_ context.Context, _, _ string) error             { return nil }
 func (m *testMatrixClient) SetTyping(_ context.Context, _, _ string, _ bool, _ int) error { return nil }
 func (m *testMatrixClient) SetPresence(_ context.Context, _ string, _ bool) error         { return nil }
-func (m *testMatrixClient) SendReadReceipt(_ context.Context, _, _, _ string) error       { return nil }
+func (m *testMatrixClient) SendReadReceipt(_ context.Context, roomID, eventID, userID string) error {
+	m.receipts = append(m.receipts, testReaction{roomID: roomID, sender: userID, eventID: eventID})
+	return nil
+}
 func (m *testMatrixClient) CreateSpace(_ context.Context, _ *CreateSpaceRequest) (string, error) {
 	return "!space:test", nil
 }
@@ -229,6 +349,100 @@ func TestEventRouter_OnLoginEvent_NilEvent(t *testing.T) {
 	}
 }
 
+func TestEventRouter_OnLoginEvent_SingleUserPersistsFirstLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:         slog.Default(),
+		Puppets:     newTestPuppetManager(),
+		BridgeUsers: database.NewBridgeUserStore(db),
+	})
+
+	userRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(testBridgeUserColumnNames).AddRow(
+			"@user:example.com", "wxid_test", "ipad", int(wechat.LoginStateLoggedOut),
+			"!mgmt:example.com", "", nil, time.Now(),
+		)
+	}
+
+	// Nobody is logged in, so the user who linked wxid_test gets the event
+	mock.ExpectQuery(`(?s)SELECT .* FROM bridge_user$`).WillReturnRows(userRow())
+	mock.ExpectQuery(`(?s)SELECT .* FROM bridge_user WHERE wechat_id = \$1`).
+		WithArgs("wxid_test").
+		WillReturnRows(userRow())
+	mock.ExpectQuery(`(?s)SELECT .* FROM bridge_user WHERE matrix_user_id = \$1`).
+		WithArgs("@user:example.com").
+		WillReturnRows(userRow())
+	mock.ExpectExec(`(?s)INSERT INTO bridge_user .* ON CONFLICT \(matrix_user_id\) DO UPDATE SET`).
+		WithArgs(
+			"@user:example.com",
+			"wxid_test",
+			"ipad",
+			int(wechat.LoginStateLoggedIn),
+			"!mgmt:example.com",
+			"",
+			sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = er.OnLoginEvent(context.Background(), &wechat.LoginEvent{
+		State:  wechat.LoginStateLoggedIn,
+		UserID: "wxid_test",
+		Name:   "Tester",
+	})
+	if err != nil {
+		t.Fatalf("OnLoginEvent error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnLoginEvent_SingleUserLogoutFromContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:         slog.Default(),
+		Puppets:     newTestPuppetManager(),
+		BridgeUsers: database.NewBridgeUserStore(db),
+	})
+
+	mock.ExpectQuery(`(?s)SELECT .* FROM bridge_user WHERE matrix_user_id = \$1`).
+		WithArgs("@user:example.com").
+		WillReturnRows(sqlmock.NewRows(testBridgeUserColumnNames).AddRow(
+			"@user:example.com", "wxid_test", "ipad", int(wechat.LoginStateLoggedIn),
+			"", "", time.Now(), time.Now(),
+		))
+	mock.ExpectExec(`(?s)INSERT INTO bridge_user .* ON CONFLICT \(matrix_user_id\) DO UPDATE SET`).
+		WithArgs(
+			"@user:example.com",
+			"wxid_test",
+			"ipad",
+			int(wechat.LoginStateLoggedOut),
+			"",
+			"",
+			sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	ctx := context.WithValue(context.Background(), bridgeUserKey, "@user:example.com")
+	err = er.OnLoginEvent(ctx, &wechat.LoginEvent{State: wechat.LoginStateLoggedOut})
+	if err != nil {
+		t.Fatalf("OnLoginEvent error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 func TestEventRouter_OnPresence_NilMatrixClient(t *testing.T) {
 	pm := newTestPuppetManager()
 	er := NewEventRouter(EventRouterConfig{
@@ -265,7 +479,7 @@ func TestEventRouter_OnRevoke_NilMatrixClient(t *testing.T) {
 	})
 
 	ctx := context.Background()
-	err := er.OnRevoke(ctx, "msg1", "message revoked")
+	err := er.OnRevoke(ctx, "", "msg1", "message revoked")
 	if err != nil {
 		t.Errorf("OnRevoke with nil matrixClient should return nil: %v", err)
 	}
@@ -279,7 +493,7 @@ func TestEventRouter_OnRevoke_NilMessageStore(t *testing.T) {
 		MatrixClient: &testMatrixClient{},
 	})
 
-	err := er.OnRevoke(context.Background(), "msg1", "message revoked")
+	err := er.OnRevoke(context.Background(), "", "msg1", "message revoked")
 	if err != nil {
 		t.Fatalf("OnRevoke should tolerate nil message store: %v", err)
 	}
@@ -295,9 +509,7 @@ func TestEventRouter_OnRevoke_RedactsLatestMappedEvent(t *testing.T) {
 	now := time.Now()
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE wechat_msg_id = $1 ORDER BY created_at DESC LIMIT 1`)).
 		WithArgs("msg1").
-		WillReturnRows(sqlmock.NewRows([]string{
-			"wechat_msg_id", "matrix_event_id", "matrix_room_id", "sender", "msg_type", "timestamp", "created_at",
-		}).AddRow("msg1", "$event:test", "!room:test", "@user:test", 1, now, now))
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$event:test", "!room:test", "@user:test", 1, now, now, ""))
 
 	matrix := &testMatrixClient{}
 	er := NewEventRouter(EventRouterConfig{
@@ -307,7 +519,7 @@ func TestEventRouter_OnRevoke_RedactsLatestMappedEvent(t *testing.T) {
 		Messages:     database.NewMessageMappingStore(db),
 	})
 
-	if err := er.OnRevoke(context.Background(), "msg1", "recalled"); err != nil {
+	if err := er.OnRevoke(context.Background(), "", "msg1", "recalled"); err != nil {
 		t.Fatalf("OnRevoke error: %v", err)
 	}
 
@@ -325,6 +537,40 @@ func TestEventRouter_OnRevoke_RedactsLatestMappedEvent(t *testing.T) {
 	}
 }
 
+func TestEventRouter_OnRevoke_ScopedToChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectBridgeUser(mock, "")
+	// The same message ID mapped into another room must not be redacted
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id IN (`)).
+		WithArgs("msg1", "wxid_bob", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$bob:test", "!bob:test", "wxid_bob", 1, now, now, ""))
+
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      newTestPuppetManager(),
+		MatrixClient: matrix,
+		Messages:     database.NewMessageMappingStore(db),
+		BridgeUsers:  database.NewBridgeUserStore(db),
+	})
+
+	if err := er.OnRevoke(context.Background(), "wxid_bob", "msg1", "recalled"); err != nil {
+		t.Fatalf("OnRevoke error: %v", err)
+	}
+	if len(matrix.redactions) != 1 || matrix.redactions[0].roomID != "!bob:test" || matrix.redactions[0].eventID != "$bob:test" {
+		t.Fatalf("redactions = %+v, want the event in the chat's room", matrix.redactions)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 func TestEventRouter_HandleMatrixMessage_ForwardsMedia(t *testing.T) {
 	matrix := &testMatrixClient{
 		mediaData: []byte("payload"),
@@ -509,6 +755,133 @@ func TestEventRouter_OnGroupMemberUpdate_NilFields(t *testing.T) {
 	}
 }
 
+// withGroupMembers gives a test router the stores that routing group
+// messages and syncing group members need, and puppets for wxid_alice,
+// wxid_bob and wxid_carol.
+func withGroupMembers(cfg *EventRouterConfig, db *sql.DB) {
+	withRoomStores(cfg, db)
+	cfg.Log = testBridgeLogger()
+	cfg.GroupMembers = database.NewGroupMemberStore(db)
+	for _, id := range []string{"wxid_alice", "wxid_bob", "wxid_carol"} {
+		cfg.Puppets.puppets[id] = &Puppet{WeChatID: id, MatrixUserID: "@wechat_" + id + ":example.com"}
+	}
+}
+
+// expectGroupRoom expects the group 123@chatroom of @user:test to be found
+// bridged to !room:test, with stored as its members.
+func expectGroupRoom(mock sqlmock.Sqlmock, stored ...string) {
+	expectBridgeUser(mock, "!mgmt:test")
+	expectRoomMapping(mock, "123@chatroom", "!room:test", "Team")
+	expectStoredGroupMembers(mock, stored...)
+}
+
+// expectStoredGroupMembers expects the stored members of 123@chatroom to be
+// loaded and found to be stored.
+func expectStoredGroupMembers(mock sqlmock.Sqlmock, stored ...string) {
+	rows := sqlmock.NewRows([]string{"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at"})
+	for _, id := range stored {
+		rows.AddRow("123@chatroom", id, "", false, false, time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM group_member WHERE group_id = $1`)).
+		WithArgs("123@chatroom").
+		WillReturnRows(rows)
+}
+
+func TestEventRouter_OnGroupMemberUpdate_InitialSyncOnlyRecords(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withGroupMembers)
+	expectGroupRoom(mock)
+	for _, id := range []string{"wxid_alice", "wxid_bob"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WithArgs("123@chatroom", id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	err := er.OnGroupMemberUpdate(context.Background(), "123@chatroom", []*wechat.GroupMember{
+		{UserID: "wxid_alice"},
+		{UserID: "wxid_bob"},
+	})
+	if err != nil {
+		t.Fatalf("OnGroupMemberUpdate: %v", err)
+	}
+	if len(matrix.joined) != 0 || len(matrix.left) != 0 {
+		t.Fatalf("initial sync joined %v and left %v, want no membership changes", matrix.joined, matrix.left)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnGroupMemberUpdate_JoinsAndLeaves(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withGroupMembers)
+	expectGroupRoom(mock, "wxid_alice", "wxid_bob")
+	for _, id := range []string{"wxid_alice", "wxid_carol"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WithArgs("123@chatroom", id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM group_member`)).
+		WithArgs("123@chatroom", "wxid_bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Bob left the group and Carol joined it.
+	err := er.OnGroupMemberUpdate(context.Background(), "123@chatroom", []*wechat.GroupMember{
+		{UserID: "wxid_alice"},
+		{UserID: "wxid_carol"},
+	})
+	if err != nil {
+		t.Fatalf("OnGroupMemberUpdate: %v", err)
+	}
+	if len(matrix.joined) != 1 || matrix.joined[0] != "@wechat_wxid_carol:example.com" {
+		t.Fatalf("joined = %v, want only Carol's puppet", matrix.joined)
+	}
+	if len(matrix.left) != 1 || matrix.left[0] != "!room:test/@wechat_wxid_bob:example.com" {
+		t.Fatalf("left = %v, want Bob's puppet to leave the room", matrix.left)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnGroupMemberUpdate_LargeGroupSkipsJoins(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withGroupMembers)
+	expectGroupRoom(mock, "wxid_alice")
+	er.largeGroupLimit = 1
+	metrics := NewMetrics()
+	er.metrics = metrics
+	for _, id := range []string{"wxid_alice", "wxid_bob", "wxid_carol"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WithArgs("123@chatroom", id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	err := er.OnGroupMemberUpdate(context.Background(), "123@chatroom", []*wechat.GroupMember{
+		{UserID: "wxid_alice"},
+		{UserID: "wxid_bob"},
+		{UserID: "wxid_carol"},
+	})
+	if err != nil {
+		t.Fatalf("OnGroupMemberUpdate: %v", err)
+	}
+	if len(matrix.joined) != 0 {
+		t.Fatalf("joined = %v, want no joins above the large group threshold", matrix.joined)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// The group is counted once however often it is seen.
+	er.isLargeGroup("123@chatroom", 3)
+	if got := metrics.largeGroups.Load(); got != 1 {
+		t.Fatalf("large groups = %d, want 1", got)
+	}
+	if er.isLargeGroup("456@chatroom", 1) {
+		t.Fatal("group at the threshold should not be large")
+	}
+}
+
 func TestEventRouter_SyncPuppetAvatar_NilMatrixClient(t *testing.T) {
 	er := NewEventRouter(EventRouterConfig{
 		Log:      slog.Default(),
@@ -536,3 +909,509 @@ func TestEventRouter_MetricsRecording(t *testing.T) {
 		t.Error("metrics should be stored in EventRouter")
 	}
 }
+
+func newReceiptEvent(eventID, userID string) *MatrixEvent {
+	return &MatrixEvent{
+		Type:   "m.receipt",
+		RoomID: "!room:test",
+		Content: map[string]interface{}{
+			eventID: map[string]interface{}{
+				"m.read": map[string]interface{}{
+					userID: map[string]interface{}{"ts": float64(1700000000000)},
+				},
+			},
+		},
+	}
+}
+
+// withRevokeWindow sends through provider with the message store wired and
+// a two minute revoke window.
+func withRevokeWindow(provider *mockProvider) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Provider = provider
+		cfg.Messages = database.NewMessageMappingStore(db)
+		cfg.RevokeWindow = 2 * time.Minute
+		cfg.BotUserID = "@wechatbot:example.com"
+	}
+}
+
+// expectBridgedMessage expects the message bridged as eventID to be looked
+// up and found as the WeChat message msgID, sent by @user:test at sentAt.
+func expectBridgedMessage(mock sqlmock.Sqlmock, eventID, msgID string, sentAt time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs(eventID).
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).
+			AddRow(msgID, eventID, "!room:test", "@user:test", 1, sentAt, sentAt, ""))
+}
+
+func newRedactionEvent() *MatrixEvent {
+	return &MatrixEvent{
+		ID:      "$redaction:test",
+		Type:    "m.room.redaction",
+		RoomID:  "!room:test",
+		Sender:  "@user:test",
+		Content: map[string]interface{}{"redacts": "$sent:test"},
+	}
+}
+
+func TestEventRouter_HandleMatrixRedaction_WithinRevokeWindow(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRevokeWindow(provider))
+	expectBridgedMessage(mock, "$sent:test", "msg1", time.Now().Add(-30*time.Second))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixRedaction(context.Background(), newRedactionEvent(), room); err != nil {
+		t.Fatalf("handleMatrixRedaction: %v", err)
+	}
+	if len(provider.revokeMsgs) != 1 || provider.revokeMsgs[0] != "msg1" {
+		t.Fatalf("expected msg1 to be revoked, got %v", provider.revokeMsgs)
+	}
+	if len(matrix.sent) != 0 {
+		t.Fatalf("expected no notice, got %+v", matrix.sent)
+	}
+}
+
+func TestEventRouter_HandleMatrixRedaction_PastRevokeWindowSkipsProvider(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRevokeWindow(provider))
+	expectBridgedMessage(mock, "$sent:test", "msg1", time.Now().Add(-5*time.Minute))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixRedaction(context.Background(), newRedactionEvent(), room); err != nil {
+		t.Fatalf("handleMatrixRedaction: %v", err)
+	}
+	if len(provider.revokeMsgs) != 0 {
+		t.Fatalf("expected no revoke call, got %v", provider.revokeMsgs)
+	}
+	if len(matrix.sent) != 1 || matrix.sent[0].sender != "@wechatbot:example.com" {
+		t.Fatalf("expected one bot notice, got %+v", matrix.sent)
+	}
+	content, _ := matrix.sent[0].content.(map[string]interface{})
+	if content["msgtype"] != "m.notice" || !strings.Contains(content["body"].(string), "2 minutes") {
+		t.Fatalf("unexpected notice content: %v", content)
+	}
+}
+
+func TestEventRouter_HandleMatrixRedaction_RetentionNotForwarded(t *testing.T) {
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	// Marked as retention, even within the revoke window
+	provider := newMockProvider("padpro", 2)
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRevokeWindow(provider))
+	expectBridgedMessage(mock, "$sent:test", "msg1", time.Now().Add(-30*time.Second))
+	evt := newRedactionEvent()
+	evt.Content["reason"] = "Message retention policy"
+	if err := er.handleMatrixRedaction(context.Background(), evt, room); err != nil {
+		t.Fatalf("handleMatrixRedaction: %v", err)
+	}
+	if len(provider.revokeMsgs) != 0 || len(matrix.sent) != 0 {
+		t.Fatalf("retention redaction forwarded: revokes %v, sent %+v", provider.revokeMsgs, matrix.sent)
+	}
+
+	// An expired message redacted by someone other than its sender
+	provider = newMockProvider("padpro", 2)
+	matrix = &testMatrixClient{}
+	er, mock = newTestRouter(t, matrix, withRevokeWindow(provider))
+	expectBridgedMessage(mock, "$sent:test", "msg1", time.Now().Add(-5*time.Minute))
+	evt = newRedactionEvent()
+	evt.Sender = "@retention-bot:test"
+	if err := er.handleMatrixRedaction(context.Background(), evt, room); err != nil {
+		t.Fatalf("handleMatrixRedaction: %v", err)
+	}
+	if len(provider.revokeMsgs) != 0 || len(matrix.sent) != 0 {
+		t.Fatalf("expired message redaction forwarded: revokes %v, sent %+v", provider.revokeMsgs, matrix.sent)
+	}
+}
+
+func TestFormatRevokeWindow(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Minute:      "1 minute",
+		2 * time.Minute:  "2 minutes",
+		90 * time.Second: "90 seconds",
+	}
+	for d, want := range tests {
+		if got := formatRevokeWindow(d); got != want {
+			t.Errorf("formatRevokeWindow(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestEventRouter_HandleMatrixReceipt_MarksRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs("$event:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$event:test", "!room:test", "@wechat_wxid_friend:example.com", 1, now, now, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(now.Add(time.Minute)))
+
+	provider := newMockProvider("wecom", 1)
+	provider.readMarks = true
+	er := NewEventRouter(EventRouterConfig{
+		Log:              slog.Default(),
+		Puppets:          newTestPuppetManager(),
+		Provider:         provider,
+		Messages:         database.NewMessageMappingStore(db),
+		SendReadReceipts: true,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixReceipt(context.Background(), newReceiptEvent("$event:test", "@user:test"), room); err != nil {
+		t.Fatalf("handleMatrixReceipt: %v", err)
+	}
+
+	if len(provider.markedRead) != 1 || provider.markedRead[0] != "wxid_friend/msg1" {
+		t.Fatalf("unexpected read marks: %v", provider.markedRead)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_HandleMatrixReceipt_LatestMarksWholeChatRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	// Opening the room sends a receipt for the newest event.
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs("$latest:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg9", "$latest:test", "!room:test", "@wechat_wxid_friend:example.com", 1, now, now, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(now))
+
+	provider := newMockProvider("wecom", 1)
+	provider.readMarks = true
+	er := NewEventRouter(EventRouterConfig{
+		Log:              slog.Default(),
+		Puppets:          newTestPuppetManager(),
+		Provider:         provider,
+		Messages:         database.NewMessageMappingStore(db),
+		SendReadReceipts: true,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixReceipt(context.Background(), newReceiptEvent("$latest:test", "@user:test"), room); err != nil {
+		t.Fatalf("handleMatrixReceipt: %v", err)
+	}
+
+	if len(provider.markedRead) != 1 || provider.markedRead[0] != "wxid_friend/" {
+		t.Fatalf("expected the whole chat to be marked read, got %v", provider.markedRead)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_HandleMatrixReceipt_UnsupportedProviderNoop(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:              slog.Default(),
+		Puppets:          newTestPuppetManager(),
+		Provider:         provider,
+		Messages:         database.NewMessageMappingStore(db),
+		SendReadReceipts: true,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixReceipt(context.Background(), newReceiptEvent("$event:test", "@user:test"), room); err != nil {
+		t.Fatalf("handleMatrixReceipt: %v", err)
+	}
+
+	if len(provider.markedRead) != 0 {
+		t.Fatalf("expected no read marks, got %v", provider.markedRead)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
+
+func TestEventRouter_HandleMatrixReceipt_CapabilityOverride(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs("$event:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$event:test", "!room:test", "@wechat_wxid_friend:example.com", 1, now, now, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(now.Add(time.Minute)))
+
+	// The provider doesn't claim read receipts, but the config enables them.
+	b := &Bridge{Config: &config.Config{}}
+	b.Config.Providers.PadPro.Capabilities = map[string]bool{"read_receipt": true}
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:              slog.Default(),
+		Puppets:          newTestPuppetManager(),
+		Provider:         provider,
+		Messages:         database.NewMessageMappingStore(db),
+		SendReadReceipts: true,
+	})
+	if err := provider.Init(b.buildProviderConfigFor("padpro"), er); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixReceipt(context.Background(), newReceiptEvent("$event:test", "@user:test"), room); err != nil {
+		t.Fatalf("handleMatrixReceipt: %v", err)
+	}
+
+	if len(provider.markedRead) != 1 || provider.markedRead[0] != "wxid_friend/msg1" {
+		t.Fatalf("unexpected read marks: %v", provider.markedRead)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_HandleMatrixReceipt_IgnoresOtherUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockProvider("wecom", 1)
+	provider.readMarks = true
+	er := NewEventRouter(EventRouterConfig{
+		Log:              slog.Default(),
+		Puppets:          newTestPuppetManager(),
+		Provider:         provider,
+		Messages:         database.NewMessageMappingStore(db),
+		SendReadReceipts: true,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	for _, reader := range []string{"@someone:test", "@wechat_wxid_friend:example.com"} {
+		if err := er.handleMatrixReceipt(context.Background(), newReceiptEvent("$event:test", reader), room); err != nil {
+			t.Fatalf("handleMatrixReceipt(%s): %v", reader, err)
+		}
+	}
+
+	if len(provider.markedRead) != 0 {
+		t.Fatalf("expected no read marks, got %v", provider.markedRead)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_GroupSyncsAvatarTopicAndMembers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockProvider("padpro", 2)
+	provider.groupInfo = &wechat.ContactInfo{
+		UserID:       "123@chatroom",
+		Nickname:     "Team",
+		IsGroup:      true,
+		Announcement: "Standup at 10",
+	}
+	provider.avatarData = []byte("jpeg")
+	provider.groupMembers = []*wechat.GroupMember{
+		{UserID: "wxid_a", Nickname: "Alice"},
+		{UserID: "wxid_b", Nickname: "Bob"},
+	}
+
+	pm := newTestPuppetManager()
+	pm.puppets["wxid_a"] = &Puppet{WeChatID: "wxid_a", MatrixUserID: "@wechat_wxid_a:example.com"}
+	pm.puppets["wxid_b"] = &Puppet{WeChatID: "wxid_b", MatrixUserID: "@wechat_wxid_b:example.com"}
+
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      pm,
+		Provider:     provider,
+		Rooms:        database.NewRoomMappingStore(db),
+		MatrixClient: matrix,
+	})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs("123@chatroom", "@user:test").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"wechat_chat_id", "matrix_room_id", "bridge_user", "is_group",
+			"name", "avatar_mxc", "topic", "encrypted", "name_set", "avatar_set", "created_at",
+		}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WithArgs("123@chatroom", "!room:test", "@user:test", true,
+			"Team", "mxc://test/uploaded", "Standup at 10", false, false, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	room, err := er.getOrCreateRoom(context.Background(), "123@chatroom", true, "@user:test")
+	if err != nil {
+		t.Fatalf("getOrCreateRoom: %v", err)
+	}
+	if room.AvatarMXC != "mxc://test/uploaded" || room.Topic != "Standup at 10" {
+		t.Fatalf("room = %+v, want avatar and topic set", room)
+	}
+	if got := matrix.roomAvatars["!room:test"]; got != "mxc://test/uploaded" {
+		t.Errorf("room avatar = %q", got)
+	}
+	if got := matrix.roomTopics["!room:test"]; got != "Standup at 10" {
+		t.Errorf("room topic = %q", got)
+	}
+	if len(matrix.joined) != 2 {
+		t.Errorf("joined = %v, want both group members", matrix.joined)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// withRevokeOnEdit is withRevokeWindow with revoke_edited_messages set to
+// revokeOnEdit.
+func withRevokeOnEdit(provider *mockProvider, revokeOnEdit bool) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		withRevokeWindow(provider)(cfg, db)
+		cfg.RevokeOnEdit = revokeOnEdit
+	}
+}
+
+// expectEditedMessage expects the edited $original:test, sent at sentAt, to
+// be looked up and the edit to be mapped.
+func expectEditedMessage(mock sqlmock.Sqlmock, sentAt time.Time) {
+	expectBridgedMessage(mock, "$original:test", "msg_orig", sentAt)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func newEditEvent() *MatrixEvent {
+	return &MatrixEvent{
+		ID:     "$edit:test",
+		Type:   "m.room.message",
+		RoomID: "!room:test",
+		Sender: "@user:test",
+		Content: map[string]interface{}{
+			"msgtype":       "m.text",
+			"body":          "* see you at 5",
+			"m.new_content": map[string]interface{}{"msgtype": "m.text", "body": "see you at 5"},
+			"m.relates_to":  map[string]interface{}{"rel_type": "m.replace", "event_id": "$original:test"},
+		},
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_EditSendsMarkedMessage(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er, mock := newTestRouter(t, nil, withRevokeOnEdit(provider, false))
+	expectEditedMessage(mock, time.Now().Add(-30*time.Second))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test"}
+
+	if err := er.handleMatrixMessage(context.Background(), newEditEvent(), room); err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+	if len(provider.sentTexts) != 1 || provider.sentTexts[0] != "(edited) see you at 5" {
+		t.Fatalf("sent %q", provider.sentTexts)
+	}
+	if len(provider.revokeMsgs) != 0 {
+		t.Fatalf("expected no revoke without revoke_edited_messages, got %v", provider.revokeMsgs)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_EditRevokesOriginalWithinWindow(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er, mock := newTestRouter(t, nil, withRevokeOnEdit(provider, true))
+	expectEditedMessage(mock, time.Now().Add(-30*time.Second))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test"}
+
+	if err := er.handleMatrixMessage(context.Background(), newEditEvent(), room); err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+	if len(provider.revokeMsgs) != 1 || provider.revokeMsgs[0] != "msg_orig" {
+		t.Fatalf("expected msg_orig to be revoked, got %v", provider.revokeMsgs)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_EditKeepsOriginalPastWindow(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er, mock := newTestRouter(t, nil, withRevokeOnEdit(provider, true))
+	expectEditedMessage(mock, time.Now().Add(-5*time.Minute))
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test"}
+
+	if err := er.handleMatrixMessage(context.Background(), newEditEvent(), room); err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+	if len(provider.sentTexts) != 1 {
+		t.Fatalf("sent %q", provider.sentTexts)
+	}
+	if len(provider.revokeMsgs) != 0 {
+		t.Fatalf("expected no revoke past the window, got %v", provider.revokeMsgs)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_Pat(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		supported bool
+		target    string
+		wantPat   string
+	}{
+		{"puppet", true, "@wechat_wxid_alice:example.com", "123@chatroom/wxid_alice"},
+		{"unsupported", false, "@wechat_wxid_alice:example.com", ""},
+		{"not a puppet", true, "@alice:example.com", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider("padpro", 2)
+			provider.pats = tt.supported
+			er := NewEventRouter(EventRouterConfig{
+				Log:       slog.Default(),
+				Puppets:   newTestPuppetManager(),
+				Processor: &defaultMessageProcessor{},
+				Provider:  provider,
+			})
+			room := &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!room:test"}
+
+			err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+				ID:     "$pat:test",
+				Type:   "m.room.message",
+				RoomID: room.MatrixRoomID,
+				Sender: "@user:test",
+				Content: map[string]interface{}{
+					"msgtype":    "m.emote",
+					"body":       "pat Alice",
+					"m.mentions": map[string]interface{}{"user_ids": []interface{}{tt.target}},
+				},
+			}, room)
+			if err != nil {
+				t.Fatalf("handleMatrixMessage: %v", err)
+			}
+
+			if tt.wantPat != "" {
+				if len(provider.patSent) != 1 || provider.patSent[0] != tt.wantPat {
+					t.Fatalf("pats sent = %v", provider.patSent)
+				}
+				if len(provider.sentTexts) != 0 {
+					t.Fatalf("pat should not also be sent as text: %v", provider.sentTexts)
+				}
+			} else if len(provider.patSent) != 0 || len(provider.sentTexts) != 1 || provider.sentTexts[0] != "* pat Alice" {
+				t.Fatalf("expected text fallback, got pats %v texts %v", provider.patSent, provider.sentTexts)
+			}
+		})
+	}
+}
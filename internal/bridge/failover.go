@@ -2,6 +2,7 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sort"
@@ -53,6 +54,15 @@ type ProviderState struct {
 	TotalFailures    int64
 	FailoverCount    int64
 	Active           bool
+
+	// SessionLost is set when a call reported wechat.ErrLoggedOut since the
+	// last health check, which then fails even if the provider still
+	// believes it is logged in.
+	SessionLost bool
+
+	// SendTimeouts counts sends that timed out since the last health check,
+	// which then fails as well.
+	SendTimeouts int
 }
 
 // FailoverEvent records a failover occurrence for audit/metrics.
@@ -90,6 +100,11 @@ type ProviderManager struct {
 	events   []FailoverEvent
 	eventsMu sync.Mutex
 
+	// Switch counts since start, guarded by eventsMu
+	failovers  int64
+	promotions int64
+	switches   map[string]int64 // "from->to" → count
+
 	stopCh  chan struct{}
 	running bool
 }
@@ -206,6 +221,7 @@ func (pm *ProviderManager) Stop() error {
 	if pm.metrics != nil {
 		pm.metrics.SetConnected(false)
 		pm.metrics.SetLoginState(int(wechat.LoginStateLoggedOut))
+		pm.metrics.SetActiveTier(0)
 	}
 
 	return nil
@@ -269,11 +285,70 @@ func (pm *ProviderManager) GetFailoverHistory() []FailoverEvent {
 	return events
 }
 
+// ProviderManagerStats summarizes failover activity since the manager started.
+type ProviderManagerStats struct {
+	ActiveName string           `json:"active_provider"`
+	ActiveTier int              `json:"active_tier"`
+	Failovers  int64            `json:"failovers"`
+	Promotions int64            `json:"promotions"`
+	Switches   map[string]int64 `json:"switches"` // "from->to" → count
+}
+
+// Stats returns a snapshot of failover activity. Unlike GetFailoverHistory,
+// the counts are not truncated to the most recent events.
+func (pm *ProviderManager) Stats() ProviderManagerStats {
+	stats := ProviderManagerStats{
+		ActiveName: pm.ActiveName(),
+		ActiveTier: pm.ActiveTier(),
+	}
+
+	pm.eventsMu.Lock()
+	defer pm.eventsMu.Unlock()
+
+	stats.Failovers = pm.failovers
+	stats.Promotions = pm.promotions
+	stats.Switches = make(map[string]int64, len(pm.switches))
+	for pair, n := range pm.switches {
+		stats.Switches[pair] = n
+	}
+	return stats
+}
+
+const (
+	switchKindFailover  = "failover"
+	switchKindPromotion = "promotion"
+)
+
+// recordSwitch appends event to the failover history and counts it in the
+// stats and metrics.
+func (pm *ProviderManager) recordSwitch(kind string, event FailoverEvent) {
+	pm.eventsMu.Lock()
+	pm.events = append(pm.events, event)
+	// Keep only last 100 events
+	if len(pm.events) > 100 {
+		pm.events = pm.events[len(pm.events)-100:]
+	}
+	if kind == switchKindPromotion {
+		pm.promotions++
+	} else {
+		pm.failovers++
+	}
+	if pm.switches == nil {
+		pm.switches = make(map[string]int64)
+	}
+	pm.switches[event.FromName+"->"+event.ToName]++
+	pm.eventsMu.Unlock()
+
+	if pm.metrics != nil {
+		pm.metrics.IncrProviderSwitch(kind, event.FromName, event.ToName)
+	}
+}
+
 // activateBestProvider starts the highest-priority provider that can be started.
 // Must be called with pm.mu held.
 func (pm *ProviderManager) activateBestProvider(ctx context.Context) error {
 	for i, ps := range pm.providers {
-		if err := ps.Provider.Start(ctx); err != nil {
+		if err := pm.startProvider(ctx, ps); err != nil {
 			pm.log.Warn("provider start failed",
 				"name", ps.Provider.Name(),
 				"tier", ps.Provider.Tier(),
@@ -297,6 +372,17 @@ func (pm *ProviderManager) activateBestProvider(ctx context.Context) error {
 	return fmt.Errorf("all providers failed to start")
 }
 
+// startProvider starts ps and resumes the session its service may still
+// hold, so that a provider logged in before a restart isn't seen as logged
+// out and made to log in again.
+func (pm *ProviderManager) startProvider(ctx context.Context, ps *ProviderState) error {
+	if err := ps.Provider.Start(ctx); err != nil {
+		return err
+	}
+	restoreSession(ctx, pm.log, ps.Provider)
+	return nil
+}
+
 // healthCheckLoop runs periodic health checks and handles failover/recovery.
 func (pm *ProviderManager) healthCheckLoop() {
 	healthTicker := time.NewTicker(pm.cfg.HealthCheckInterval)
@@ -334,6 +420,8 @@ func (pm *ProviderManager) checkActiveProvider() {
 	ps.TotalChecks++
 
 	healthy := pm.isProviderHealthy(ps)
+	ps.SessionLost = false
+	ps.SendTimeouts = 0
 	if pm.metrics != nil {
 		pm.updateMetricsForProvider(ps)
 	}
@@ -364,12 +452,44 @@ func (pm *ProviderManager) isProviderHealthy(ps *ProviderState) bool {
 	if !ps.Provider.IsRunning() {
 		return false
 	}
+	if ps.SessionLost {
+		return false
+	}
+	if ps.SendTimeouts > 0 {
+		return false
+	}
 	if ps.Provider.GetLoginState() != wechat.LoginStateLoggedIn {
 		return false
 	}
 	return true
 }
 
+// ReportError records a failed call to p. Only a lost session
+// (wechat.ErrLoggedOut) and a timed-out send (context.DeadlineExceeded)
+// count against p's health; rate limiting and temporary errors don't mean
+// another provider would do better.
+func (pm *ProviderManager) ReportError(p wechat.Provider, err error) {
+	sessionLost := errors.Is(err, wechat.ErrLoggedOut)
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if !sessionLost && !timedOut {
+		return
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, ps := range pm.providers {
+		if ps.Provider != p {
+			continue
+		}
+		if sessionLost {
+			ps.SessionLost = true
+		}
+		if timedOut {
+			ps.SendTimeouts++
+		}
+	}
+}
+
 // performFailover switches from the current provider to the next available one.
 // Must be called with pm.mu held.
 func (pm *ProviderManager) performFailover(failedPS *ProviderState) {
@@ -386,7 +506,7 @@ func (pm *ProviderManager) performFailover(failedPS *ProviderState) {
 	// Try each subsequent provider in tier order
 	for i := pm.activeIdx + 1; i < len(pm.providers); i++ {
 		ps := pm.providers[i]
-		if err := ps.Provider.Start(ctx); err != nil {
+		if err := pm.startProvider(ctx, ps); err != nil {
 			pm.log.Warn("failover candidate failed to start",
 				"name", ps.Provider.Name(), "error", err)
 			continue
@@ -404,14 +524,7 @@ func (pm *ProviderManager) performFailover(failedPS *ProviderState) {
 			ToTier:    ps.Provider.Tier(),
 			Reason:    fmt.Sprintf("health check failed %d times", failedPS.ConsecutiveFails),
 		}
-
-		pm.eventsMu.Lock()
-		pm.events = append(pm.events, event)
-		// Keep only last 100 events
-		if len(pm.events) > 100 {
-			pm.events = pm.events[len(pm.events)-100:]
-		}
-		pm.eventsMu.Unlock()
+		pm.recordSwitch(switchKindFailover, event)
 
 		failedPS.FailoverCount++
 		pm.activeIdx = i
@@ -458,7 +571,7 @@ func (pm *ProviderManager) checkRecovery() {
 
 		// Try to start the higher-priority provider
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		err := ps.Provider.Start(ctx)
+		err := pm.startProvider(ctx, ps)
 		cancel()
 
 		if err != nil {
@@ -514,13 +627,7 @@ func (pm *ProviderManager) performPromotion(toIdx int) {
 		ToTier:    newPS.Provider.Tier(),
 		Reason:    "higher-tier provider recovered",
 	}
-
-	pm.eventsMu.Lock()
-	pm.events = append(pm.events, event)
-	if len(pm.events) > 100 {
-		pm.events = pm.events[len(pm.events)-100:]
-	}
-	pm.eventsMu.Unlock()
+	pm.recordSwitch(switchKindPromotion, event)
 
 	pm.activeIdx = toIdx
 
@@ -563,7 +670,7 @@ func (pm *ProviderManager) ForceProvider(name string) error {
 		}
 
 		ctx := context.Background()
-		if err := ps.Provider.Start(ctx); err != nil {
+		if err := pm.startProvider(ctx, ps); err != nil {
 			return fmt.Errorf("start provider %s: %w", name, err)
 		}
 
@@ -600,9 +707,11 @@ func (pm *ProviderManager) updateMetricsForProvider(ps *ProviderState) {
 	if ps == nil {
 		pm.metrics.SetConnected(false)
 		pm.metrics.SetLoginState(int(wechat.LoginStateLoggedOut))
+		pm.metrics.SetActiveTier(0)
 		return
 	}
 
+	pm.metrics.SetActiveTier(ps.Provider.Tier())
 	loginState := ps.Provider.GetLoginState()
 	pm.metrics.SetLoginState(int(loginState))
 	pm.metrics.SetConnected(ps.Provider.IsRunning() && loginState == wechat.LoginStateLoggedIn)
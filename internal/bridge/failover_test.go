@@ -2,13 +2,17 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/n42/mautrix-wechat/internal/database"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
@@ -20,13 +24,40 @@ type mockProvider struct {
 	running    bool
 	loginState wechat.LoginState
 	initErr    error
+	cfg        *wechat.ProviderConfig
 	startErr   error
 	failCount  int
+	readMarks  bool
 	revokeMsgs []string
+	markedRead []string
+	sentTexts  []string
 	sentImages []sentMedia
 	sentFiles  []sentMedia
 	sentVideos []sentVideo
 	sentVoices []sentVoice
+
+	groupInvites    bool
+	inviteResponses []inviteResponse
+
+	pats    bool
+	patSent []string
+
+	typing     bool
+	typingSent []string
+
+	acceptedFriends []string
+
+	sendAcks bool // reports SendAck, so sends aren't acked right away
+
+	sendErr      error         // returned by SendText
+	sendHangs    bool          // SendText waits for its context to end
+	loginStarted chan struct{} // signaled by Login, if set
+
+	groupInfo    *wechat.ContactInfo
+	groupMembers []*wechat.GroupMember
+	avatarData   []byte
+	contacts     []*wechat.ContactInfo
+	groups       []*wechat.ContactInfo
 }
 
 type sentMedia struct {
@@ -42,6 +73,11 @@ type sentVideo struct {
 	thumbnail []byte
 }
 
+type inviteResponse struct {
+	invite *wechat.GroupInvite
+	accept bool
+}
+
 type sentVoice struct {
 	toUser   string
 	data     []byte
@@ -56,7 +92,8 @@ func newMockProvider(name string, tier int) *mockProvider {
 	}
 }
 
-func (m *mockProvider) Init(_ *wechat.ProviderConfig, _ wechat.MessageHandler) error {
+func (m *mockProvider) Init(cfg *wechat.ProviderConfig, _ wechat.MessageHandler) error {
+	m.cfg = cfg
 	return m.initErr
 }
 
@@ -86,10 +123,15 @@ func (m *mockProvider) IsRunning() bool {
 func (m *mockProvider) Name() string { return m.name }
 func (m *mockProvider) Tier() int    { return m.tier }
 func (m *mockProvider) Capabilities() wechat.Capability {
-	return wechat.Capability{SendText: true, ReceiveMessage: true}
+	return m.cfg.OverrideCapabilities(wechat.Capability{SendText: true, ReceiveMessage: true, ReadReceipt: m.readMarks, GroupInvite: m.groupInvites, Pat: m.pats, Typing: m.typing, SendAck: m.sendAcks})
 }
 
-func (m *mockProvider) Login(_ context.Context) error  { return nil }
+func (m *mockProvider) Login(_ context.Context) error {
+	if m.loginStarted != nil {
+		m.loginStarted <- struct{}{}
+	}
+	return nil
+}
 func (m *mockProvider) Logout(_ context.Context) error { return nil }
 func (m *mockProvider) GetLoginState() wechat.LoginState {
 	m.mu.RLock()
@@ -100,7 +142,17 @@ func (m *mockProvider) GetSelf() *wechat.ContactInfo {
 	return &wechat.ContactInfo{UserID: m.name}
 }
 
-func (m *mockProvider) SendText(_ context.Context, _ string, _ string) (string, error) {
+func (m *mockProvider) SendText(ctx context.Context, _ string, text string) (string, error) {
+	m.mu.Lock()
+	m.sentTexts = append(m.sentTexts, text)
+	m.mu.Unlock()
+	if m.sendHangs {
+		<-ctx.Done()
+		return "", fmt.Errorf("send text: %w", ctx.Err())
+	}
+	if m.sendErr != nil {
+		return "", m.sendErr
+	}
 	return "msg_" + m.name, nil
 }
 func (m *mockProvider) SendImage(_ context.Context, toUser string, data io.Reader, filename string) (string, error) {
@@ -152,25 +204,56 @@ func (m *mockProvider) RevokeMessage(_ context.Context, msgID string, _ string)
 	m.revokeMsgs = append(m.revokeMsgs, msgID)
 	return nil
 }
+func (m *mockProvider) SendPat(_ context.Context, chatID string, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patSent = append(m.patSent, chatID+"/"+userID)
+	return nil
+}
+func (m *mockProvider) MarkRead(_ context.Context, chatID string, msgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.markedRead = append(m.markedRead, chatID+"/"+msgID)
+	return nil
+}
+func (m *mockProvider) SendTyping(_ context.Context, chatID string, typing bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.typingSent = append(m.typingSent, fmt.Sprintf("%s/%t", chatID, typing))
+	return nil
+}
 func (m *mockProvider) GetContactList(_ context.Context) ([]*wechat.ContactInfo, error) {
-	return nil, nil
+	return m.contacts, nil
 }
-func (m *mockProvider) GetContactInfo(_ context.Context, _ string) (*wechat.ContactInfo, error) {
+func (m *mockProvider) GetContactInfo(_ context.Context, userID string) (*wechat.ContactInfo, error) {
+	for _, c := range m.contacts {
+		if c.UserID == userID {
+			return c, nil
+		}
+	}
 	return nil, nil
 }
 func (m *mockProvider) GetUserAvatar(_ context.Context, _ string) ([]byte, string, error) {
+	if m.avatarData != nil {
+		return m.avatarData, "image/jpeg", nil
+	}
 	return nil, "", nil
 }
-func (m *mockProvider) AcceptFriendRequest(_ context.Context, _ string) error { return nil }
+func (m *mockProvider) AcceptFriendRequest(_ context.Context, xml string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acceptedFriends = append(m.acceptedFriends, xml)
+	return nil
+}
 func (m *mockProvider) SetContactRemark(_ context.Context, _, _ string) error { return nil }
 func (m *mockProvider) GetGroupList(_ context.Context) ([]*wechat.ContactInfo, error) {
-	return nil, nil
+	return m.groups, nil
 }
 func (m *mockProvider) GetGroupMembers(_ context.Context, _ string) ([]*wechat.GroupMember, error) {
-	return nil, nil
+	return m.groupMembers, nil
 }
 func (m *mockProvider) GetGroupInfo(_ context.Context, _ string) (*wechat.ContactInfo, error) {
-	return nil, nil
+	return m.groupInfo, nil
 }
 func (m *mockProvider) CreateGroup(_ context.Context, _ string, _ []string) (string, error) {
 	return "", nil
@@ -182,6 +265,12 @@ func (m *mockProvider) RemoveFromGroup(_ context.Context, _ string, _ []string)
 func (m *mockProvider) SetGroupName(_ context.Context, _, _ string) error         { return nil }
 func (m *mockProvider) SetGroupAnnouncement(_ context.Context, _, _ string) error { return nil }
 func (m *mockProvider) LeaveGroup(_ context.Context, _ string) error              { return nil }
+func (m *mockProvider) RespondGroupInvite(_ context.Context, invite *wechat.GroupInvite, accept bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inviteResponses = append(m.inviteResponses, inviteResponse{invite: invite, accept: accept})
+	return nil
+}
 func (m *mockProvider) DownloadMedia(_ context.Context, _ *wechat.Message) (io.ReadCloser, string, error) {
 	return nil, "", nil
 }
@@ -364,6 +453,78 @@ func TestProviderManager_HealthCheck(t *testing.T) {
 	}
 }
 
+func TestProviderManager_ReportErrorFailsHealthCheck(t *testing.T) {
+	pm := NewProviderManager(slog.Default(), DefaultFailoverConfig(), nil)
+	p1 := newMockProvider("padpro", 1)
+	pm.AddProvider(p1, &wechat.ProviderConfig{})
+	pm.Start(context.Background())
+	defer pm.Stop()
+
+	// Rate limiting says nothing about the session.
+	pm.ReportError(p1, fmt.Errorf("send text: %w", wechat.ErrRateLimited))
+	pm.checkActiveProvider()
+	if fails := pm.GetProviderStates()[0].ConsecutiveFails; fails != 0 {
+		t.Fatalf("consecutive fails after rate limiting: %d", fails)
+	}
+
+	// A lost session fails the next check although the provider still
+	// reports being logged in.
+	pm.ReportError(p1, fmt.Errorf("send text: %w", wechat.WrapError(wechat.ErrLoggedOut, fmt.Errorf("HTTP 401"))))
+	pm.checkActiveProvider()
+	if fails := pm.GetProviderStates()[0].ConsecutiveFails; fails != 1 {
+		t.Fatalf("consecutive fails after lost session: %d", fails)
+	}
+
+	pm.checkActiveProvider()
+	if fails := pm.GetProviderStates()[0].ConsecutiveFails; fails != 0 {
+		t.Fatalf("lost session counted twice: %d consecutive fails", fails)
+	}
+}
+
+func TestProviderManager_SendTimeoutsTriggerFailover(t *testing.T) {
+	pm := NewProviderManager(slog.Default(), DefaultFailoverConfig(), nil)
+	p1 := newMockProvider("padpro", 1)
+	p1.sendHangs = true
+	p2 := newMockProvider("ipad", 2)
+	pm.AddProvider(p1, &wechat.ProviderConfig{})
+	pm.AddProvider(p2, &wechat.ProviderConfig{})
+	pm.Start(context.Background())
+	defer pm.Stop()
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:         slog.Default(),
+		Puppets:     newTestPuppetManager(),
+		Processor:   &defaultMessageProcessor{},
+		Provider:    p1,
+		SendTimeout: 10 * time.Millisecond,
+	})
+	er.SetProviderErrorHook(pm.ReportError)
+	room := &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	// p1 stays logged in, but every send times out until the failure
+	// threshold is reached.
+	for i := 0; i < DefaultFailoverConfig().FailureThreshold; i++ {
+		if pm.ActiveName() != "padpro" {
+			t.Fatalf("failed over after %d timed-out sends", i)
+		}
+		err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+			ID:      fmt.Sprintf("$event%d:test", i),
+			Type:    "m.room.message",
+			RoomID:  room.MatrixRoomID,
+			Sender:  "@user:test",
+			Content: map[string]interface{}{"msgtype": "m.text", "body": "hello"},
+		}, room)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("handleMatrixMessage error = %v, want a timeout", err)
+		}
+		pm.checkActiveProvider()
+	}
+
+	if pm.ActiveName() != "ipad" {
+		t.Fatalf("active provider = %s, want failover to ipad", pm.ActiveName())
+	}
+}
+
 func TestProviderManager_HealthCheckTriggersFailover(t *testing.T) {
 	log := slog.Default()
 	cfg := FailoverConfig{
@@ -513,6 +674,53 @@ func TestProviderManager_ForceProviderUpdatesMetricsAndCallback(t *testing.T) {
 	}
 }
 
+func TestProviderManager_SwitchesCountedInStatsAndMetrics(t *testing.T) {
+	log := slog.Default()
+	metrics := NewMetrics()
+	cfg := DefaultFailoverConfig()
+	cfg.RecoveryThreshold = 1
+	pm := NewProviderManager(log, cfg, metrics)
+
+	pm.AddProvider(newMockProvider("wecom", 1), &wechat.ProviderConfig{})
+	pm.AddProvider(newMockProvider("ipad", 2), &wechat.ProviderConfig{})
+	if err := pm.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer pm.Stop()
+
+	if err := pm.ForceFailover(); err != nil {
+		t.Fatalf("ForceFailover: %v", err)
+	}
+	if metrics.activeTier.Load() != 2 {
+		t.Fatalf("active tier metric after failover = %d", metrics.activeTier.Load())
+	}
+	pm.checkRecovery()
+	if metrics.activeTier.Load() != 1 {
+		t.Fatalf("active tier metric after promotion = %d", metrics.activeTier.Load())
+	}
+
+	stats := pm.Stats()
+	if stats.ActiveName != "wecom" || stats.Failovers != 1 || stats.Promotions != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.Switches["wecom->ipad"] != 1 || stats.Switches["ipad->wecom"] != 1 {
+		t.Fatalf("switches = %v", stats.Switches)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+	for _, want := range []string{
+		"mautrix_wechat_active_provider_tier 1",
+		`mautrix_wechat_provider_switches_total{kind="failover",from="wecom",to="ipad"} 1`,
+		`mautrix_wechat_provider_switches_total{kind="promotion",from="ipad",to="wecom"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s in:\n%s", want, text)
+		}
+	}
+}
+
 func TestProviderManager_HealthCheckUpdatesMetricsForUnhealthyProvider(t *testing.T) {
 	log := slog.Default()
 	metrics := NewMetrics()
@@ -0,0 +1,248 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Actions of chat filter entries.
+const (
+	chatFilterAllow = "allow"
+	chatFilterDeny  = "deny"
+)
+
+// errChatFiltered is returned by getOrCreateRoom for chats the chat filter
+// excludes from bridging.
+var errChatFiltered = errors.New("chat is excluded from bridging")
+
+// chatFilter decides which WeChat chats are bridged. A chat is bridged
+// unless it matches a deny entry; when there are allow entries, it must also
+// match one. Entries come from bridge.filters and from the filter command,
+// which persists them.
+type chatFilter struct {
+	allow []wechat.ChatFilter // from the config
+	deny  []wechat.ChatFilter
+	store *database.ChatFilterStore
+
+	mu      sync.RWMutex
+	runtime []runtimeChatFilter // added with the filter command
+}
+
+type runtimeChatFilter struct {
+	filter wechat.ChatFilter
+	action string
+}
+
+// newChatFilter parses the configured entries and loads those added at
+// runtime from store, if set.
+func newChatFilter(ctx context.Context, allow, deny []string, store *database.ChatFilterStore) (*chatFilter, error) {
+	f := &chatFilter{store: store}
+	var err error
+	if f.allow, err = parseChatFilters(allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if f.deny, err = parseChatFilters(deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	if store == nil {
+		return f, nil
+	}
+	entries, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		filter, err := wechat.ParseChatFilter(e.Entry)
+		if err != nil {
+			return nil, fmt.Errorf("stored entry: %w", err)
+		}
+		f.runtime = append(f.runtime, runtimeChatFilter{filter: filter, action: e.Action})
+	}
+	return f, nil
+}
+
+func parseChatFilters(entries []string) ([]wechat.ChatFilter, error) {
+	filters := make([]wechat.ChatFilter, 0, len(entries))
+	for _, entry := range entries {
+		f, err := wechat.ParseChatFilter(entry)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// allows reports whether the chat with the given ID is bridged. A nil
+// filter allows every chat.
+func (f *chatFilter) allows(chatID string) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, d := range f.deny {
+		if d.Matches(chatID) {
+			return false
+		}
+	}
+	hasAllow, allowed := len(f.allow) > 0, false
+	for _, a := range f.allow {
+		allowed = allowed || a.Matches(chatID)
+	}
+	for _, r := range f.runtime {
+		switch r.action {
+		case chatFilterDeny:
+			if r.filter.Matches(chatID) {
+				return false
+			}
+		case chatFilterAllow:
+			hasAllow = true
+			allowed = allowed || r.filter.Matches(chatID)
+		}
+	}
+	return !hasAllow || allowed
+}
+
+// set adds a runtime entry, or changes the action of an existing one.
+func (f *chatFilter) set(ctx context.Context, entry, action string) error {
+	filter, err := wechat.ParseChatFilter(entry)
+	if err != nil {
+		return err
+	}
+	if f.store != nil {
+		if err := f.store.Set(ctx, filter.String(), action); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, r := range f.runtime {
+		if r.filter.String() == filter.String() {
+			f.runtime[i].action = action
+			return nil
+		}
+	}
+	f.runtime = append(f.runtime, runtimeChatFilter{filter: filter, action: action})
+	return nil
+}
+
+// remove deletes a runtime entry, reporting whether it existed. Configured
+// entries can't be removed.
+func (f *chatFilter) remove(ctx context.Context, entry string) (bool, error) {
+	entry = strings.TrimSpace(entry)
+	if f.store != nil {
+		if _, err := f.store.Delete(ctx, entry); err != nil {
+			return false, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, r := range f.runtime {
+		if r.filter.String() == entry {
+			f.runtime = append(f.runtime[:i], f.runtime[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// describe lists all entries for the filter command.
+func (f *chatFilter) describe() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var lines []string
+	for _, a := range f.allow {
+		lines = append(lines, fmt.Sprintf("- allow `%s` (config)", a))
+	}
+	for _, d := range f.deny {
+		lines = append(lines, fmt.Sprintf("- deny `%s` (config)", d))
+	}
+	for _, r := range f.runtime {
+		lines = append(lines, fmt.Sprintf("- %s `%s`", r.action, r.filter))
+	}
+	if len(lines) == 0 {
+		return "No chat filters; all chats are bridged."
+	}
+	return "Chat filters:\n" + strings.Join(lines, "\n")
+}
+
+// SetChatFilter configures which chats are bridged; see chatFilter. Entries
+// added with the filter command are loaded from store, which also persists
+// new ones.
+func (er *EventRouter) SetChatFilter(ctx context.Context, allow, deny []string, store *database.ChatFilterStore) error {
+	f, err := newChatFilter(ctx, allow, deny, store)
+	if err != nil {
+		return err
+	}
+	er.filter = f
+	return nil
+}
+
+// chatBridged reports whether chatID may be bridged. The Moments feed is not
+// a WeChat chat and is always bridged.
+func (er *EventRouter) chatBridged(chatID string) bool {
+	return er.isMomentsChat(chatID) || er.filter.allows(chatID)
+}
+
+func (cp *CommandProcessor) cmdFilter(ctx context.Context, ce *CommandEvent) error {
+	usage := func() {
+		ce.Reply("Usage: `%s filter list`, `%s filter allow|deny <entry>` or `%s filter remove <entry>`. "+
+			"Entries are WeChat IDs (`wxid_abc`), ID prefixes (`gh_*`), `type:group` or `type:direct`.",
+			cp.prefix, cp.prefix, cp.prefix)
+	}
+	if len(ce.Args) == 0 {
+		usage()
+		return nil
+	}
+	f := cp.router.filter
+
+	switch ce.Args[0] {
+	case "list":
+		ce.Reply("%s", f.describe())
+	case chatFilterAllow, chatFilterDeny:
+		if len(ce.Args) != 2 {
+			usage()
+			return nil
+		}
+		if _, err := wechat.ParseChatFilter(ce.Args[1]); err != nil {
+			ce.Reply("Invalid filter: %v", err)
+			return nil
+		}
+		if err := f.set(ctx, ce.Args[1], ce.Args[0]); err != nil {
+			return fmt.Errorf("set chat filter: %w", err)
+		}
+		if ce.Args[0] == chatFilterDeny {
+			ce.Reply("Added deny filter `%s`. Rooms of matching chats stay, but no more messages are bridged to them.", ce.Args[1])
+		} else {
+			ce.Reply("Added allow filter `%s`.", ce.Args[1])
+		}
+	case "remove":
+		if len(ce.Args) != 2 {
+			usage()
+			return nil
+		}
+		removed, err := f.remove(ctx, ce.Args[1])
+		if err != nil {
+			return fmt.Errorf("remove chat filter: %w", err)
+		}
+		if !removed {
+			ce.Reply("No filter `%s` added with this command. Entries from the config can only be changed there.", ce.Args[1])
+			return nil
+		}
+		ce.Reply("Removed filter `%s`.", ce.Args[1])
+	default:
+		usage()
+	}
+	return nil
+}
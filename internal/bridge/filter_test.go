@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func TestChatFilter_Allows(t *testing.T) {
+	f, err := newChatFilter(context.Background(), []string{"type:group", "wxid_alice"}, []string{"gh_*", "spam@chatroom"}, nil)
+	if err != nil {
+		t.Fatalf("newChatFilter: %v", err)
+	}
+	for chatID, want := range map[string]bool{
+		"123@chatroom":  true,
+		"spam@chatroom": false,
+		"wxid_alice":    true,
+		"wxid_bob":      false,
+		"gh_news":       false,
+	} {
+		if got := f.allows(chatID); got != want {
+			t.Errorf("allows(%q) = %v, want %v", chatID, got, want)
+		}
+	}
+
+	// Runtime entries add to the configured ones.
+	if err := f.set(context.Background(), "wxid_bob", chatFilterAllow); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := f.set(context.Background(), "456@chatroom", chatFilterDeny); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !f.allows("wxid_bob") || f.allows("456@chatroom") {
+		t.Fatal("runtime entries not applied")
+	}
+	if removed, err := f.remove(context.Background(), "456@chatroom"); err != nil || !removed {
+		t.Fatalf("remove = %v, %v", removed, err)
+	}
+	if !f.allows("456@chatroom") {
+		t.Fatal("removed entry still applied")
+	}
+
+	var none *chatFilter
+	if !none.allows("gh_news") {
+		t.Fatal("nil filter should allow every chat")
+	}
+}
+
+func TestChatFilter_LoadsAndPersistsRuntimeEntries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT entry, action FROM chat_filter`)).
+		WillReturnRows(sqlmock.NewRows([]string{"entry", "action"}).AddRow("wxid_spammer", "deny"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO chat_filter`)).
+		WithArgs("gh_*", "allow").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	f, err := newChatFilter(context.Background(), nil, []string{"gh_*"}, database.NewChatFilterStore(db))
+	if err != nil {
+		t.Fatalf("newChatFilter: %v", err)
+	}
+	if f.allows("wxid_spammer") {
+		t.Fatal("stored deny entry not loaded")
+	}
+	if err := f.set(context.Background(), "gh_*", chatFilterAllow); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	// Deny entries from the config still win.
+	if f.allows("gh_news") {
+		t.Fatal("configured deny entry overridden")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_FilteredChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      newTestPuppetManager(),
+		MatrixClient: matrix,
+		Rooms:        database.NewRoomMappingStore(db),
+	})
+	if err := er.SetChatFilter(context.Background(), nil, []string{"gh_*"}, nil); err != nil {
+		t.Fatalf("SetChatFilter: %v", err)
+	}
+
+	if _, err := er.getOrCreateRoom(context.Background(), "gh_news", false, "@user:test"); !errors.Is(err, errChatFiltered) {
+		t.Fatalf("getOrCreateRoom error = %v, want errChatFiltered", err)
+	}
+	if len(matrix.createdRooms) != 0 {
+		t.Fatalf("created rooms for filtered chat: %+v", matrix.createdRooms)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
+
+func TestCommandProcessor_Filter(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	ctx := context.Background()
+
+	if err := cp.Handle(ctx, newCommandEvent("!wechat filter deny spam@chatroom"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if cp.router.chatBridged("spam@chatroom") {
+		t.Fatal("deny filter not applied")
+	}
+	if err := cp.Handle(ctx, newCommandEvent("!wechat filter list"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "- deny `spam@chatroom`") {
+		t.Fatalf("unexpected list: %q", reply)
+	}
+	if err := cp.Handle(ctx, newCommandEvent("!wechat filter deny type:channel"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, "Invalid filter:") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := cp.Handle(ctx, newCommandEvent("!wechat filter remove spam@chatroom"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if !cp.router.chatBridged("spam@chatroom") {
+		t.Fatal("removed filter still applied")
+	}
+}
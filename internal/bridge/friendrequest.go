@@ -0,0 +1,194 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// OnFriendRequest stores an incoming friend request and tells the bridge
+// user about it in their management room.
+func (er *EventRouter) OnFriendRequest(ctx context.Context, req *wechat.FriendRequest) error {
+	if er.friendRequests == nil {
+		er.log.Debug("friend request store not configured, ignoring request", "from", req.FromUser)
+		return nil
+	}
+	bridgeUser, err := er.findBridgeUser(ctx)
+	if err != nil || bridgeUser == nil {
+		return nil
+	}
+
+	if err := er.friendRequests.Upsert(ctx, &database.PendingFriendRequest{
+		BridgeUser: bridgeUser.MatrixUserID,
+		WeChatID:   req.FromUser,
+		Nickname:   req.Nickname,
+		Content:    req.Content,
+		XML:        req.XML,
+		Ticket:     req.Ticket,
+	}); err != nil {
+		return err
+	}
+	er.log.Info("received friend request", "from", req.FromUser)
+
+	if bridgeUser.ManagementRoom == "" {
+		return nil
+	}
+	prefix := "!wechat"
+	if er.commands != nil {
+		prefix = er.commands.prefix
+	}
+	notice := fmt.Sprintf("%s (%s) wants to add you as a WeChat friend.", req.Nickname, req.FromUser)
+	if greeting := strings.TrimSpace(req.Content); greeting != "" && !strings.HasPrefix(greeting, "<") {
+		notice += fmt.Sprintf(" Message: %q.", greeting)
+	}
+	notice += fmt.Sprintf(" Reply `%s accept-friend %s` to accept.", prefix, req.FromUser)
+	er.sendNotice(ctx, bridgeUser.ManagementRoom, notice)
+	return nil
+}
+
+// Handling of contacts added without a friend request, for
+// bridge.message_handling.silent_contact_adds.
+const (
+	SilentContactAddsRoom   = "room"
+	SilentContactAddsNotice = "notice"
+	SilentContactAddsIgnore = "ignore"
+)
+
+// OnContactAdded handles a contact added without a friend request passing
+// through the bridge, e.g. after they scanned the account's QR code. As when
+// a request is accepted, any pending request from them is dropped. The
+// contact's puppet and, unless only a notice is configured, direct chat room
+// are created right away, and the bridge user is told in their management
+// room.
+func (er *EventRouter) OnContactAdded(ctx context.Context, contact *wechat.ContactInfo) error {
+	if er.silentContactAdds == SilentContactAddsIgnore || contact.IsGroup {
+		return nil
+	}
+	bridgeUser, err := er.findBridgeUser(ctx)
+	if err != nil || bridgeUser == nil {
+		return nil
+	}
+	er.log.Info("contact added without a friend request", "user_id", contact.UserID)
+
+	if er.friendRequests != nil {
+		if err := er.friendRequests.Delete(ctx, bridgeUser.MatrixUserID, contact.UserID); err != nil {
+			er.log.Warn("failed to drop pending friend request", "error", err, "user_id", contact.UserID)
+		}
+	}
+
+	who := contact.UserID
+	if name := contactDisplayName(contact); name != contact.UserID {
+		who = fmt.Sprintf("%s (%s)", name, contact.UserID)
+	}
+	var notice string
+	if er.silentContactAdds == SilentContactAddsNotice {
+		if _, err := er.puppets.GetOrCreate(ctx, contact); err != nil {
+			return fmt.Errorf("get puppet: %w", err)
+		}
+		if err := er.OnContactUpdate(ctx, contact); err != nil {
+			er.log.Warn("failed to update contact profile", "error", err, "user_id", contact.UserID)
+		}
+		prefix := "!wechat"
+		if er.commands != nil {
+			prefix = er.commands.prefix
+		}
+		notice = fmt.Sprintf("%s is now your WeChat contact. Reply `%s dm %s` to start a chat.", who, prefix, contact.UserID)
+	} else {
+		room, err := er.OpenDirectChat(ctx, contact, bridgeUser.MatrixUserID)
+		if errors.Is(err, errChatFiltered) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("open direct chat: %w", err)
+		}
+		notice = fmt.Sprintf("%s is now your WeChat contact: %s", who, matrixRoomLink(room.MatrixRoomID))
+	}
+
+	if bridgeUser.ManagementRoom != "" {
+		er.sendNotice(ctx, bridgeUser.ManagementRoom, notice)
+	}
+	return nil
+}
+
+// friendRequestName describes the requester in command replies.
+func friendRequestName(r *database.PendingFriendRequest) string {
+	if r.Nickname != "" && r.Nickname != r.WeChatID {
+		return fmt.Sprintf("%s (%s)", r.Nickname, r.WeChatID)
+	}
+	return r.WeChatID
+}
+
+func (cp *CommandProcessor) cmdFriendRequests(ctx context.Context, ce *CommandEvent) error {
+	if cp.router.friendRequests == nil {
+		ce.Reply("Friend requests are not tracked by this bridge.")
+		return nil
+	}
+	requests, err := cp.router.friendRequests.ListByBridgeUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		ce.Reply("No pending friend requests.")
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Pending friend requests:\n")
+	for _, r := range requests {
+		fmt.Fprintf(&sb, "- %s", friendRequestName(r))
+		if greeting := strings.TrimSpace(r.Content); greeting != "" && !strings.HasPrefix(greeting, "<") {
+			fmt.Fprintf(&sb, ": %q", greeting)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "Accept one with `%s accept-friend <wechat_id>`.", cp.prefix)
+	ce.Reply("%s", sb.String())
+	return nil
+}
+
+func (cp *CommandProcessor) cmdAcceptFriend(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) != 1 {
+		ce.Reply("Usage: `%s accept-friend <wechat_id>`", cp.prefix)
+		return nil
+	}
+	if cp.router.friendRequests == nil {
+		ce.Reply("Friend requests are not tracked by this bridge.")
+		return nil
+	}
+	wechatID := ce.Args[0]
+	req, err := cp.router.friendRequests.Get(ctx, ce.Sender, wechatID)
+	if err != nil {
+		return err
+	}
+	if req == nil {
+		ce.Reply("No pending friend request from %s.", wechatID)
+		return nil
+	}
+	if req.XML == "" {
+		ce.Reply("The friend request from %s can't be accepted from Matrix; accept it in the WeChat app.", friendRequestName(req))
+		return nil
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	if err := provider.AcceptFriendRequest(ctx, req.XML); err != nil {
+		return fmt.Errorf("accept friend request: %w", err)
+	}
+	if err := cp.router.friendRequests.Delete(ctx, ce.Sender, wechatID); err != nil {
+		return err
+	}
+
+	ce.Reply("Accepted the friend request from %s.", friendRequestName(req))
+	return nil
+}
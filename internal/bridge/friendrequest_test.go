@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestFriendRequest_NotifyAndAccept(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectBridgeUser(mock, "!mgmt:test")
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO pending_friend_request`)).
+		WithArgs("@user:test", "wxid_alice", "Alice", "Hi, it's Alice", "<msg/>", "v4_ticket").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.router.bridgeUsers = database.NewBridgeUserStore(db)
+	cp.router.friendRequests = database.NewPendingFriendRequestStore(db)
+	cp.router.botUserID = "@wechatbot:example.com"
+
+	err = cp.router.OnFriendRequest(context.Background(), &wechat.FriendRequest{
+		FromUser: "wxid_alice", Nickname: "Alice", Content: "Hi, it's Alice", XML: "<msg/>", Ticket: "v4_ticket",
+	})
+	if err != nil {
+		t.Fatalf("OnFriendRequest: %v", err)
+	}
+	if len(matrix.sent) != 1 || matrix.sent[0].roomID != "!mgmt:test" {
+		t.Fatalf("sent = %+v, want one notice in the management room", matrix.sent)
+	}
+	if notice := lastReply(t, matrix); !strings.Contains(notice, "Alice (wxid_alice) wants to add you") ||
+		!strings.Contains(notice, "!wechat accept-friend wxid_alice") {
+		t.Fatalf("unexpected notice: %q", notice)
+	}
+
+	columns := []string{"bridge_user", "wechat_id", "nickname", "content", "xml", "ticket", "received_at"}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pending_friend_request WHERE bridge_user = $1 ORDER BY received_at`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("@user:test", "wxid_alice", "Alice", "Hi, it's Alice", "<msg/>", "v4_ticket", now))
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat friend-requests"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, `- Alice (wxid_alice): "Hi, it's Alice"`) {
+		t.Fatalf("unexpected list: %q", reply)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`)).
+		WithArgs("@user:test", "wxid_alice").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("@user:test", "wxid_alice", "Alice", "Hi, it's Alice", "<msg/>", "v4_ticket", now))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM pending_friend_request`)).
+		WithArgs("@user:test", "wxid_alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat accept-friend wxid_alice"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(provider.acceptedFriends) != 1 || provider.acceptedFriends[0] != "<msg/>" {
+		t.Fatalf("accepted = %v, want the stored request XML", provider.acceptedFriends)
+	}
+	if reply := lastReply(t, matrix); reply != "Accepted the friend request from Alice (wxid_alice)." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// Once accepted the request is gone.
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`)).
+		WithArgs("@user:test", "wxid_alice").
+		WillReturnRows(sqlmock.NewRows(columns))
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat accept-friend wxid_alice"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); reply != "No pending friend request from wxid_alice." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestOnContactAdded_CreatesDirectChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	expectBridgeUser(mock, "!mgmt:test")
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM pending_friend_request`)).
+		WithArgs("@user:test", "wxid_alice").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs("wxid_alice", "@user:test").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WithArgs("wxid_alice", "!room:test", "@user:test", false, "", "", "", false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{{UserID: "wxid_alice", Nickname: "Alice"}}
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.router.bridgeUsers = database.NewBridgeUserStore(db)
+	cp.router.friendRequests = database.NewPendingFriendRequestStore(db)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+	cp.router.botUserID = "@wechatbot:example.com"
+	cp.router.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice", MatrixUserID: "@wechat_wxid_alice:example.com"}
+
+	if err := cp.router.OnContactAdded(context.Background(), &wechat.ContactInfo{UserID: "wxid_alice", Nickname: "Alice"}); err != nil {
+		t.Fatalf("OnContactAdded: %v", err)
+	}
+	if len(matrix.joined) != 1 || matrix.joined[0] != "@wechat_wxid_alice:example.com" {
+		t.Fatalf("joined = %v, want the contact's puppet in the new room", matrix.joined)
+	}
+	if notice := lastReply(t, matrix); notice != "Alice (wxid_alice) is now your WeChat contact: https://matrix.to/#/!room:test" {
+		t.Fatalf("unexpected notice: %q", notice)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestOnContactAdded_Ignore(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	cp.router.silentContactAdds = SilentContactAddsIgnore
+
+	if err := cp.router.OnContactAdded(context.Background(), &wechat.ContactInfo{UserID: "wxid_alice"}); err != nil {
+		t.Fatalf("OnContactAdded: %v", err)
+	}
+	if len(matrix.sent) != 0 || len(matrix.joined) != 0 {
+		t.Fatalf("sent = %v, joined = %v; want nothing", matrix.sent, matrix.joined)
+	}
+}
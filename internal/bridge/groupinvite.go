@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// appMsgTypeGroupInvite is the <appmsg><type> of the link card WeChat sends
+// when joining a group needs the invitee's confirmation (邀请你加入群聊).
+const appMsgTypeGroupInvite = 5
+
+// groupInviteURLMarker identifies the invite link among other type 5 links.
+const groupInviteURLMarker = "addchatroombyinvite"
+
+// quotedNameRE matches a quoted name in the invite card description, e.g.
+// "Alice"邀请你加入群聊"Family" or “Alice” invited you to “Family”.
+var quotedNameRE = regexp.MustCompile(`["“]([^"”]+)["”]`)
+
+type groupInviteXML struct {
+	AppMsg struct {
+		Type int    `xml:"type"`
+		Des  string `xml:"des"`
+		URL  string `xml:"url"`
+	} `xml:"appmsg"`
+}
+
+// parseGroupInvite detects group invitation cards. Returns nil for any other
+// message.
+func parseGroupInvite(msg *wechat.Message) *wechat.GroupInvite {
+	if msg.Type != wechat.MsgLink {
+		return nil
+	}
+	raw := msg.Extra["xml"]
+	if raw == "" {
+		raw = msg.Content
+	}
+	if !strings.Contains(raw, groupInviteURLMarker) {
+		return nil
+	}
+
+	var parsed groupInviteXML
+	if err := xml.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil
+	}
+	if parsed.AppMsg.Type != appMsgTypeGroupInvite || !strings.Contains(parsed.AppMsg.URL, groupInviteURLMarker) {
+		return nil
+	}
+
+	invite := &wechat.GroupInvite{
+		InviterID: msg.FromUser,
+		URL:       strings.TrimSpace(parsed.AppMsg.URL),
+	}
+	// The description names the inviter first and the group last.
+	if names := quotedNameRE.FindAllStringSubmatch(parsed.AppMsg.Des, -1); len(names) >= 2 {
+		invite.GroupName = names[len(names)-1][1]
+	}
+	return invite
+}
+
+// pendingGroupInvites holds group invitations awaiting an answer, numbered
+// per bridge user for the accept-invite and decline-invite commands.
+type pendingGroupInvites struct {
+	mu      sync.Mutex
+	nextID  map[string]int
+	invites map[string]map[int]*wechat.GroupInvite // bridge user → number → invite
+}
+
+func newPendingGroupInvites() *pendingGroupInvites {
+	return &pendingGroupInvites{
+		nextID:  make(map[string]int),
+		invites: make(map[string]map[int]*wechat.GroupInvite),
+	}
+}
+
+// add stores an invite for bridgeUser and returns its number.
+func (p *pendingGroupInvites) add(bridgeUser string, invite *wechat.GroupInvite) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID[bridgeUser]++
+	id := p.nextID[bridgeUser]
+	if p.invites[bridgeUser] == nil {
+		p.invites[bridgeUser] = make(map[int]*wechat.GroupInvite)
+	}
+	p.invites[bridgeUser][id] = invite
+	return id
+}
+
+// get returns bridgeUser's invite with the given number, or nil.
+func (p *pendingGroupInvites) get(bridgeUser string, id int) *wechat.GroupInvite {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.invites[bridgeUser][id]
+}
+
+// remove forgets an answered invite.
+func (p *pendingGroupInvites) remove(bridgeUser string, id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.invites[bridgeUser], id)
+}
+
+// groupInviteName describes the invited group for prompts and replies.
+func groupInviteName(invite *wechat.GroupInvite) string {
+	if invite.GroupName != "" {
+		return fmt.Sprintf("%q", invite.GroupName)
+	}
+	return "a group"
+}
+
+// promptGroupInvite asks the bridge user in their management room whether to
+// join the group. It reports false when the invite can't be answered from
+// Matrix, in which case the card is bridged like any other link.
+func (er *EventRouter) promptGroupInvite(ctx context.Context, bridgeUser *database.BridgeUser, inviterName string, invite *wechat.GroupInvite) bool {
+	if bridgeUser.ManagementRoom == "" {
+		return false
+	}
+	provider, err := er.getProviderForContext(ctx)
+	if err != nil || provider == nil || !provider.Capabilities().GroupInvite {
+		return false
+	}
+
+	id := er.groupInvites.add(bridgeUser.MatrixUserID, invite)
+	er.log.Info("received group invite", "inviter", invite.InviterID, "group", invite.GroupName, "invite", id)
+
+	prefix := "!wechat"
+	if er.commands != nil {
+		prefix = er.commands.prefix
+	}
+	er.sendNotice(ctx, bridgeUser.ManagementRoom, fmt.Sprintf(
+		"%s invited you to the WeChat group %s. Reply `%s accept-invite %d` to join or `%s decline-invite %d` to decline.",
+		inviterName, groupInviteName(invite), prefix, id, prefix, id))
+	return true
+}
@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const testGroupInviteXML = `<msg><appmsg appid="" sdkver="0">` +
+	`<title>邀请你加入群聊</title>` +
+	`<des>"Alice"邀请你加入群聊"Family"，进入可查看详情。</des>` +
+	`<type>5</type>` +
+	`<url>https://support.weixin.qq.com/cgi-bin/mmsupport-bin/addchatroombyinvite?ticket=abc</url>` +
+	`</appmsg><fromusername>wxid_alice</fromusername></msg>`
+
+func TestParseGroupInvite(t *testing.T) {
+	invite := parseGroupInvite(&wechat.Message{Type: wechat.MsgLink, FromUser: "wxid_alice", Content: testGroupInviteXML})
+	if invite == nil {
+		t.Fatal("expected a group invite")
+	}
+	if invite.InviterID != "wxid_alice" || invite.GroupName != "Family" ||
+		invite.URL != "https://support.weixin.qq.com/cgi-bin/mmsupport-bin/addchatroombyinvite?ticket=abc" {
+		t.Fatalf("unexpected invite: %+v", invite)
+	}
+
+	link := `<msg><appmsg><type>5</type><url>https://example.com/article</url></appmsg></msg>`
+	if got := parseGroupInvite(&wechat.Message{Type: wechat.MsgLink, Content: link}); got != nil {
+		t.Fatalf("plain link parsed as invite: %+v", got)
+	}
+	if got := parseGroupInvite(&wechat.Message{Type: wechat.MsgText, Content: testGroupInviteXML}); got != nil {
+		t.Fatalf("text message parsed as invite: %+v", got)
+	}
+}
+
+func TestGroupInvite_PromptAndAccept(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	expectBridgeUser(mock, "!mgmt:test")
+
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.groupInvites = true
+	cp := newTestCommandProcessor(matrix, provider, nil)
+	cp.router.bridgeUsers = database.NewBridgeUserStore(db)
+	cp.router.botUserID = "@wechatbot:example.com"
+	cp.router.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice", MatrixUserID: "@wechat_wxid_alice:example.com"}
+
+	err = cp.router.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "inv1", Type: wechat.MsgLink, FromUser: "wxid_alice", ToUser: "wxid_me", Content: testGroupInviteXML,
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 || matrix.sent[0].roomID != "!mgmt:test" {
+		t.Fatalf("sent = %+v, want one prompt in the management room", matrix.sent)
+	}
+	if prompt := lastReply(t, matrix); !strings.Contains(prompt, `Alice invited you to the WeChat group "Family"`) ||
+		!strings.Contains(prompt, "!wechat accept-invite 1") {
+		t.Fatalf("unexpected prompt: %q", prompt)
+	}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat accept-invite 1"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(provider.inviteResponses) != 1 || !provider.inviteResponses[0].accept ||
+		provider.inviteResponses[0].invite.GroupName != "Family" {
+		t.Fatalf("invite responses = %+v, want one accept", provider.inviteResponses)
+	}
+	if reply := lastReply(t, matrix); !strings.HasPrefix(reply, `Joined "Family"`) {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// The invite is answered and can't be used again.
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat accept-invite 1"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); reply != "No pending group invite #1." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
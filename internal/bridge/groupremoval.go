@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Group removal actions for bridge.message_handling.group_removal_action.
+const (
+	GroupRemovalLeave  = "leave"
+	GroupRemovalNotice = "notice"
+)
+
+// groupRemovalNotice is posted to a group's room once the account has been
+// removed from the WeChat group.
+const groupRemovalNotice = "⚠️ You were removed from this WeChat group."
+
+// groupRemovalREs match the system message WeChat shows when the account is
+// removed from a group, e.g. 你被"Alice"移出群聊 or
+// You were removed from the group chat by "Alice".
+var groupRemovalREs = []*regexp.Regexp{
+	regexp.MustCompile(`^你被.*移出(了)?群聊`),
+	regexp.MustCompile(`(?i)^you (were|have been) removed from (the )?group chat`),
+	regexp.MustCompile(`(?i)\bremoved you from (the )?group chat`),
+}
+
+// parseGroupRemoval returns the ID of the group a removal notice is about,
+// or "" for any other message.
+func parseGroupRemoval(msg *wechat.Message) string {
+	if msg.Type != wechat.MsgSystem {
+		return ""
+	}
+	groupID := msg.GroupID
+	if groupID == "" && wechat.IsGroupID(msg.FromUser) {
+		groupID = msg.FromUser
+	}
+	if groupID == "" {
+		return ""
+	}
+	content := strings.TrimSpace(msg.Content)
+	for _, re := range groupRemovalREs {
+		if re.MatchString(content) {
+			return groupID
+		}
+	}
+	return ""
+}
+
+// handleGroupRemoval tells the bridge user they were removed from a group.
+// With the leave action the group's puppets and the bridge bot also leave the
+// room and the room is unlinked, so being re-added starts a fresh room.
+func (er *EventRouter) handleGroupRemoval(ctx context.Context, bridgeUser *database.BridgeUser, groupID string) error {
+	room, err := er.rooms.GetByWeChatChat(ctx, groupID, bridgeUser.MatrixUserID)
+	if err != nil {
+		return err
+	}
+	if room == nil {
+		return nil
+	}
+	er.log.Info("removed from wechat group", "group_id", groupID, "room_id", room.MatrixRoomID, "action", er.groupRemoval)
+	er.sendNotice(ctx, room.MatrixRoomID, groupRemovalNotice)
+
+	if er.groupRemoval == GroupRemovalNotice || er.matrixClient == nil {
+		return nil
+	}
+
+	if er.groupMembers != nil {
+		members, err := er.groupMembers.GetByGroup(ctx, groupID)
+		if err != nil {
+			er.log.Warn("failed to list group members for removal", "error", err, "group_id", groupID)
+		}
+		for _, m := range members {
+			puppet, err := er.puppets.GetByWeChatID(ctx, m.WeChatID)
+			if err != nil || puppet == nil {
+				continue
+			}
+			if err := er.matrixClient.LeaveRoom(ctx, puppet.MatrixUserID, room.MatrixRoomID); err != nil {
+				er.log.Warn("failed to remove puppet from room", "error", err, "user_id", m.WeChatID, "room_id", room.MatrixRoomID)
+			}
+		}
+	}
+	if er.botUserID != "" {
+		if err := er.matrixClient.LeaveRoom(ctx, er.botUserID, room.MatrixRoomID); err != nil {
+			er.log.Warn("failed to leave room", "error", err, "room_id", room.MatrixRoomID)
+		}
+	}
+	return er.rooms.Delete(ctx, groupID, bridgeUser.MatrixUserID)
+}
@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestParseGroupRemoval(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *wechat.Message
+		want string
+	}{
+		{"chinese", &wechat.Message{Type: wechat.MsgSystem, FromUser: "123@chatroom", Content: `你被"Alice"移出群聊`}, "123@chatroom"},
+		{"english", &wechat.Message{Type: wechat.MsgSystem, IsGroup: true, GroupID: "123@chatroom", Content: `You were removed from the group chat by "Alice"`}, "123@chatroom"},
+		{"other system message", &wechat.Message{Type: wechat.MsgSystem, FromUser: "123@chatroom", Content: `"Alice"邀请"Bob"加入了群聊`}, ""},
+		{"text", &wechat.Message{Type: wechat.MsgText, FromUser: "123@chatroom", Content: `你被"Alice"移出群聊`}, ""},
+		{"not a group", &wechat.Message{Type: wechat.MsgSystem, FromUser: "wxid_alice", Content: `你被"Alice"移出群聊`}, ""},
+	}
+	for _, tc := range tests {
+		if got := parseGroupRemoval(tc.msg); got != tc.want {
+			t.Errorf("%s: parseGroupRemoval = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// withGroupRemoval gives a test router the stores and puppets that handling
+// @user:test's removal from the group 123@chatroom needs, and action as
+// bridge.message_handling.group_removal_action.
+func withGroupRemoval(action string) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		withRoomStores(cfg, db)
+		cfg.Log = testBridgeLogger()
+		cfg.GroupMembers = database.NewGroupMemberStore(db)
+		cfg.BotUserID = "@wechatbot:example.com"
+		cfg.GroupRemovalAction = action
+		cfg.Puppets.puppets["123@chatroom"] = &Puppet{WeChatID: "123@chatroom", MatrixUserID: "@wechat_123:example.com"}
+		cfg.Puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+	}
+}
+
+var testGroupRemovalMessage = &wechat.Message{
+	MsgID:     "9001",
+	Type:      wechat.MsgSystem,
+	FromUser:  "123@chatroom",
+	IsGroup:   true,
+	GroupID:   "123@chatroom",
+	Content:   `你被"Alice"移出群聊`,
+	Timestamp: time.Now().UnixMilli(),
+}
+
+func TestEventRouter_OnMessage_GroupRemovalLeavesRoom(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withGroupRemoval(GroupRemovalLeave))
+	expectBridgeUser(mock, "!mgmt:test")
+	expectRoomMapping(mock, "123@chatroom", "!group:test", "Group")
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM group_member WHERE group_id = $1`)).
+		WithArgs("123@chatroom").
+		WillReturnRows(sqlmock.NewRows([]string{"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at"}).
+			AddRow("123@chatroom", "wxid_bob", "Bob", false, false, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM room_mapping`)).
+		WithArgs("123@chatroom", "@user:test").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := er.OnMessage(context.Background(), testGroupRemovalMessage); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+
+	if len(matrix.sent) != 1 || matrix.sent[0].roomID != "!group:test" {
+		t.Fatalf("sent = %+v, want one notice in the group room", matrix.sent)
+	}
+	if body := matrix.sent[0].content.(map[string]interface{})["body"]; body != groupRemovalNotice {
+		t.Fatalf("notice = %v", body)
+	}
+	want := []string{"!group:test/@wechat_wxid_bob:example.com", "!group:test/@wechatbot:example.com"}
+	if len(matrix.left) != len(want) || matrix.left[0] != want[0] || matrix.left[1] != want[1] {
+		t.Fatalf("left = %v, want %v", matrix.left, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnMessage_GroupRemovalNoticeOnly(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withGroupRemoval(GroupRemovalNotice))
+	expectBridgeUser(mock, "!mgmt:test")
+	expectRoomMapping(mock, "123@chatroom", "!group:test", "Group")
+
+	if err := er.OnMessage(context.Background(), testGroupRemovalMessage); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+
+	if len(matrix.sent) != 1 || matrix.sent[0].roomID != "!group:test" {
+		t.Fatalf("sent = %+v, want one notice in the group room", matrix.sent)
+	}
+	if len(matrix.left) != 0 {
+		t.Fatalf("left = %v, want the room kept", matrix.left)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
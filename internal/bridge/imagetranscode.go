@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxDecodePixels bounds the images decoded for transcoding and avatar
+// processing. A small file can claim huge dimensions, and decoding it would
+// allocate them all; 50 megapixels covers any real photo.
+const maxDecodePixels = 50_000_000
+
+// decodeImage decodes data after checking from its header that the image
+// isn't larger than maxDecodePixels.
+func decodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxDecodePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// ImageTranscoder re-encodes images bridged in either direction, e.g. to
+// save bandwidth. It returns the new data and MIME type; implementations
+// return the input unchanged for formats they don't handle.
+type ImageTranscoder interface {
+	TranscodeImage(data []byte, mimeType string) ([]byte, string, error)
+}
+
+// JPEGTranscoder re-encodes JPEGs at Quality (bridge.media.image_quality) and
+// scales JPEGs and PNGs down so that neither side exceeds MaxDimension
+// (bridge.media.max_image_dimension). A Quality or MaxDimension of 0 or less
+// disables that step. The re-encoded image is only used if it is smaller
+// or was scaled down.
+type JPEGTranscoder struct {
+	Quality      int
+	MaxDimension int
+}
+
+func (t JPEGTranscoder) TranscodeImage(data []byte, mimeType string) ([]byte, string, error) {
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return data, mimeType, nil
+	}
+	recompress := mimeType == "image/jpeg" && t.Quality > 0
+	if !recompress && t.MaxDimension <= 0 {
+		return data, mimeType, nil
+	}
+
+	src, err := decodeImage(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	img := src
+	b := src.Bounds()
+	scaled := false
+	if t.MaxDimension > 0 && (b.Dx() > t.MaxDimension || b.Dy() > t.MaxDimension) {
+		w, h := t.MaxDimension, t.MaxDimension
+		if b.Dx() > b.Dy() {
+			h = b.Dy() * t.MaxDimension / b.Dx()
+		} else {
+			w = b.Dx() * t.MaxDimension / b.Dy()
+		}
+		img = scaleImage(src, b, max(w, 1), max(h, 1))
+		scaled = true
+	}
+	if !recompress && !scaled {
+		return data, mimeType, nil
+	}
+
+	var buf bytes.Buffer
+	if mimeType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		quality := t.Quality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("encode image: %w", err)
+	}
+	if !scaled && buf.Len() >= len(data) {
+		return data, mimeType, nil
+	}
+	return buf.Bytes(), mimeType, nil
+}
+
+// scaleImage samples the part r of src into a new w×h image. Nearest-neighbour
+// sampling is good enough for photos and avatars.
+func scaleImage(src image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w == r.Dx() && h == r.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, r.Min, draw.Src)
+		return dst
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(r.Min.X+x*r.Dx()/w, r.Min.Y+y*r.Dy()/h))
+		}
+	}
+	return dst
+}
+
+// transcodeImage passes an image downloaded from Matrix through the image
+// transcoder. Without one, or if transcoding fails, the image is sent as is.
+func (er *EventRouter) transcodeImage(r io.Reader, mimeType string) (io.Reader, error) {
+	if er.imageTranscoder == nil {
+		return r, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	transcoded, _, err := er.imageTranscoder.TranscodeImage(data, mimeType)
+	if err != nil {
+		er.log.Warn("image transcoding failed, sending original", "error", err)
+		return bytes.NewReader(data), nil
+	}
+	return bytes.NewReader(transcoded), nil
+}
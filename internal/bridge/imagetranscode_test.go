@@ -0,0 +1,134 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// testNoisyJPEG returns a w×h JPEG of random noise at quality 100, which
+// re-encodes to something noticeably smaller at lower qualities.
+func testNoisyJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGTranscoder_RecompressesSmaller(t *testing.T) {
+	orig := testNoisyJPEG(t, 64, 48)
+
+	data, mimeType, err := JPEGTranscoder{Quality: 50}.TranscodeImage(orig, "image/jpeg")
+	if err != nil {
+		t.Fatalf("TranscodeImage: %v", err)
+	}
+	if mimeType != "image/jpeg" {
+		t.Errorf("mime type = %q", mimeType)
+	}
+	if len(data) >= len(orig) {
+		t.Fatalf("transcoded %d bytes, original %d", len(data), len(orig))
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 64 || cfg.Height != 48 {
+		t.Fatalf("transcoded image %dx%d, %v", cfg.Width, cfg.Height, err)
+	}
+}
+
+func TestJPEGTranscoder_Downscales(t *testing.T) {
+	data, _, err := JPEGTranscoder{Quality: 90, MaxDimension: 32}.TranscodeImage(testNoisyJPEG(t, 64, 48), "image/jpeg")
+	if err != nil {
+		t.Fatalf("TranscodeImage: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 32 || cfg.Height != 24 {
+		t.Fatalf("scaled image %dx%d, want 32x24 (%v)", cfg.Width, cfg.Height, err)
+	}
+
+	// PNGs are scaled but stay PNGs
+	data, mimeType, err := JPEGTranscoder{Quality: 90, MaxDimension: 8}.TranscodeImage(testPNG(t, 16, 4), "image/png")
+	if err != nil || mimeType != "image/png" {
+		t.Fatalf("TranscodeImage png: %q, %v", mimeType, err)
+	}
+	if img, _, err := image.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 8 || img.Bounds().Dy() != 2 {
+		t.Fatalf("scaled png: %v", err)
+	}
+}
+
+func TestJPEGTranscoder_RejectsOversizedImages(t *testing.T) {
+	data := testNoisyJPEG(t, 16, 16)
+	// Claim 60000x60000 pixels in the SOF0 header: FFC0, length, precision,
+	// height, width
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	if sof < 0 {
+		t.Fatal("no SOF0 marker")
+	}
+	copy(data[sof+5:], []byte{0xEA, 0x60, 0xEA, 0x60})
+
+	if _, _, err := (JPEGTranscoder{Quality: 50}).TranscodeImage(data, "image/jpeg"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("TranscodeImage error = %v, want too large", err)
+	}
+	if _, _, err := (SquareCropAvatarProcessor{Size: 64}).ProcessAvatar(context.Background(), data, "image/jpeg"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("ProcessAvatar error = %v, want too large", err)
+	}
+}
+
+func TestJPEGTranscoder_PassesThroughOtherTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transcode JPEGTranscoder
+		data      []byte
+		mimeType  string
+	}{
+		{"gif", JPEGTranscoder{Quality: 50, MaxDimension: 8}, []byte("GIF89a"), "image/gif"},
+		{"small png", JPEGTranscoder{Quality: 50, MaxDimension: 64}, testPNG(t, 16, 16), "image/png"},
+		{"disabled", JPEGTranscoder{Quality: -1, MaxDimension: -1}, []byte("not even decoded"), "image/jpeg"},
+	} {
+		data, mimeType, err := tc.transcode.TranscodeImage(tc.data, tc.mimeType)
+		if err != nil || !bytes.Equal(data, tc.data) || mimeType != tc.mimeType {
+			t.Errorf("%s: got %d bytes %q, %v; want input unchanged", tc.name, len(data), mimeType, err)
+		}
+	}
+}
+
+func TestEventRouter_SendMatrixImageIsTranscoded(t *testing.T) {
+	orig := testNoisyJPEG(t, 64, 48)
+	matrix := &testMatrixClient{mediaData: orig, mediaType: "image/jpeg"}
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:             slog.Default(),
+		Puppets:         newTestPuppetManager(),
+		Provider:        provider,
+		MatrixClient:    matrix,
+		ImageTranscoder: JPEGTranscoder{Quality: 50},
+	})
+
+	_, err := er.sendMatrixMedia(context.Background(), provider, "wxid_chat",
+		&WeChatSendAction{Type: wechat.MsgImage},
+		map[string]interface{}{"msgtype": "m.image", "body": "photo.jpg", "url": "mxc://test/photo"})
+	if err != nil {
+		t.Fatalf("sendMatrixMedia: %v", err)
+	}
+	if len(provider.sentImages) != 1 {
+		t.Fatalf("sent %d images", len(provider.sentImages))
+	}
+	if sent := provider.sentImages[0].data; len(sent) >= len(orig) {
+		t.Fatalf("sent %d bytes, original %d", len(sent), len(orig))
+	}
+}
@@ -0,0 +1,31 @@
+package bridge
+
+// isLargeGroup reports whether a group with memberCount members is above the
+// large group threshold. Joining thousands of puppets one by one floods the
+// homeserver, so the members of such groups are only kept in the database.
+// The first time a group is found to be large, a warning is logged and it is
+// counted in the large groups metric.
+func (er *EventRouter) isLargeGroup(groupID string, memberCount int) bool {
+	if er.largeGroupLimit <= 0 || memberCount <= er.largeGroupLimit {
+		return false
+	}
+
+	er.largeGroupsMu.Lock()
+	seen := er.largeGroups[groupID]
+	if !seen {
+		if er.largeGroups == nil {
+			er.largeGroups = make(map[string]bool)
+		}
+		er.largeGroups[groupID] = true
+	}
+	er.largeGroupsMu.Unlock()
+
+	if !seen {
+		er.log.Warn("large group, skipping per-member room joins",
+			"group_id", groupID, "members", memberCount, "threshold", er.largeGroupLimit)
+		if er.metrics != nil {
+			er.metrics.IncrLargeGroups()
+		}
+	}
+	return true
+}
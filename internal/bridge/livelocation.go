@@ -0,0 +1,126 @@
+package bridge
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// appMsgTypeLiveLocation is the <appmsg><type> WeChat uses for the message
+// announcing a real-time location sharing (位置共享) session.
+const appMsgTypeLiveLocation = 17
+
+// liveLocationEndPhrases match the system notice WeChat emits when a
+// location sharing session ends.
+var liveLocationEndPhrases = []string{
+	"位置共享已经结束",
+	"位置共享已结束",
+	"location sharing has ended",
+	"location sharing ended",
+}
+
+// liveLocation describes a live-location session start or stop.
+type liveLocation struct {
+	Started bool
+	// Snapshot is the sharer's position at session start, when the payload
+	// carries one. WeChat does not stream later updates to the bridge.
+	Snapshot *wechat.LocationInfo
+}
+
+type liveLocationXML struct {
+	AppMsg struct {
+		Type int `xml:"type"`
+	} `xml:"appmsg"`
+	Location *struct {
+		X       string `xml:"x,attr"`
+		Y       string `xml:"y,attr"`
+		Label   string `xml:"label,attr"`
+		PoiName string `xml:"poiname,attr"`
+	} `xml:"location"`
+}
+
+// parseLiveLocation detects live-location start (appmsg type 17) and stop
+// (system notice) messages. Returns nil for any other message.
+func parseLiveLocation(msg *wechat.Message) *liveLocation {
+	switch msg.Type {
+	case wechat.MsgLink:
+		raw := msg.Extra["xml"]
+		if raw == "" {
+			raw = msg.Content
+		}
+		if !strings.Contains(raw, "<appmsg") {
+			return nil
+		}
+
+		var parsed liveLocationXML
+		if err := xml.Unmarshal([]byte(raw), &parsed); err != nil {
+			return nil
+		}
+		if parsed.AppMsg.Type != appMsgTypeLiveLocation {
+			return nil
+		}
+
+		loc := &liveLocation{Started: true}
+		if parsed.Location != nil {
+			lat, latErr := strconv.ParseFloat(parsed.Location.X, 64)
+			lng, lngErr := strconv.ParseFloat(parsed.Location.Y, 64)
+			if latErr == nil && lngErr == nil {
+				loc.Snapshot = &wechat.LocationInfo{
+					Latitude:  lat,
+					Longitude: lng,
+					Label:     parsed.Location.Label,
+					Poiname:   parsed.Location.PoiName,
+				}
+			}
+		}
+		return loc
+
+	case wechat.MsgSystem:
+		lower := strings.ToLower(msg.Content)
+		for _, phrase := range liveLocationEndPhrases {
+			if strings.Contains(lower, phrase) {
+				return &liveLocation{Started: false}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *defaultMessageProcessor) liveLocationToMatrix(loc *liveLocation) *MatrixEventContent {
+	if !loc.Started {
+		return &MatrixEventContent{
+			EventType: "m.room.message",
+			Content: map[string]interface{}{
+				"msgtype": "m.notice",
+				"body":    "Stopped sharing live location",
+			},
+		}
+	}
+
+	body := "Started sharing live location (open WeChat to follow it)"
+	if loc.Snapshot == nil {
+		return &MatrixEventContent{
+			EventType: "m.room.message",
+			Content: map[string]interface{}{
+				"msgtype": "m.notice",
+				"body":    body,
+			},
+		}
+	}
+
+	if label := loc.Snapshot.Label; label != "" {
+		body = fmt.Sprintf("%s: %s", body, label)
+	}
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content: map[string]interface{}{
+			"msgtype": "m.location",
+			"body":    body,
+			"geo_uri": fmt.Sprintf("geo:%f,%f", loc.Snapshot.Latitude, loc.Snapshot.Longitude),
+		},
+	}
+}
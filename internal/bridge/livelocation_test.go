@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const testLiveLocationStartXML = `<msg><appmsg appid="" sdkver="0"><title><![CDATA[我发起了位置共享]]></title><des></des><type>17</type><url></url></appmsg><fromusername>wxid_sharer</fromusername></msg>`
+
+func TestParseLiveLocation_Start(t *testing.T) {
+	loc := parseLiveLocation(&wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: testLiveLocationStartXML,
+	})
+	if loc == nil {
+		t.Fatal("expected live location start to be detected")
+	}
+	if !loc.Started {
+		t.Fatal("expected Started to be true")
+	}
+	if loc.Snapshot != nil {
+		t.Fatalf("unexpected snapshot: %+v", loc.Snapshot)
+	}
+}
+
+func TestParseLiveLocation_StartWithSnapshotFromExtraXML(t *testing.T) {
+	loc := parseLiveLocation(&wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: "[位置共享]",
+		Extra: map[string]string{
+			"xml": `<msg><appmsg><type>17</type></appmsg><location x="39.9042" y="116.4074" label="Beijing" poiname="Tiananmen"/></msg>`,
+		},
+	})
+	if loc == nil || loc.Snapshot == nil {
+		t.Fatalf("expected snapshot, got %+v", loc)
+	}
+	if loc.Snapshot.Latitude != 39.9042 || loc.Snapshot.Longitude != 116.4074 || loc.Snapshot.Label != "Beijing" {
+		t.Fatalf("unexpected snapshot: %+v", loc.Snapshot)
+	}
+}
+
+func TestParseLiveLocation_Stop(t *testing.T) {
+	loc := parseLiveLocation(&wechat.Message{
+		Type:    wechat.MsgSystem,
+		Content: "位置共享已经结束",
+	})
+	if loc == nil || loc.Started {
+		t.Fatalf("expected stop event, got %+v", loc)
+	}
+}
+
+func TestParseLiveLocation_IgnoresOtherAppMessages(t *testing.T) {
+	loc := parseLiveLocation(&wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: `<msg><appmsg><title>Article</title><type>5</type></appmsg></msg>`,
+	})
+	if loc != nil {
+		t.Fatalf("expected nil, got %+v", loc)
+	}
+}
+
+func TestDefaultProcessor_LiveLocationToMatrix(t *testing.T) {
+	p := &defaultMessageProcessor{}
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: testLiveLocationStartXML,
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if content.Content["msgtype"] != "m.notice" {
+		t.Errorf("msgtype: %v", content.Content["msgtype"])
+	}
+
+	content, err = p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: `<msg><appmsg><type>17</type></appmsg><location x="31.23" y="121.47" label="Shanghai"/></msg>`,
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if content.Content["msgtype"] != "m.location" {
+		t.Errorf("msgtype: %v", content.Content["msgtype"])
+	}
+	if content.Content["geo_uri"] != "geo:31.230000,121.470000" {
+		t.Errorf("geo_uri: %v", content.Content["geo_uri"])
+	}
+}
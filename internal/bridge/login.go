@@ -0,0 +1,214 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+type loginRoomKeyType struct{}
+
+// loginRoomKey carries the room a login command was sent from, so the QR
+// code and login progress the provider reports are posted back there
+// instead of the management room.
+var loginRoomKey = loginRoomKeyType{}
+
+func (cp *CommandProcessor) cmdLogin(ctx context.Context, ce *CommandEvent) error {
+	// The provider keeps polling for the QR scan after Login returns, so it
+	// must not inherit the cancellation of the Matrix transaction.
+	ctx = context.WithoutCancel(ctx)
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+	ctx = context.WithValue(ctx, loginRoomKey, ce.RoomID)
+
+	if cp.router.multiTenant {
+		if cp.router.sessionManager == nil {
+			return fmt.Errorf("session manager not initialized")
+		}
+		if provider, ok := cp.router.sessionManager.GetProvider(ce.Sender); ok && restoreSession(ctx, cp.log, provider) {
+			ce.Reply("You are already logged in to WeChat.")
+			return nil
+		}
+		return cp.router.sessionManager.LoginUser(ctx, ce.Sender)
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+	started, err := startLogin(ctx, cp.log, provider)
+	if err != nil {
+		return fmt.Errorf("start login: %w", err)
+	}
+	if !started {
+		ce.Reply("Already logged in to WeChat.")
+	}
+	return nil
+}
+
+// restoreSession reports whether provider is logged in, first resuming a
+// session its service still holds, e.g. after the bridge restarted.
+func restoreSession(ctx context.Context, log *slog.Logger, provider wechat.Provider) bool {
+	if provider.GetLoginState() == wechat.LoginStateLoggedIn {
+		return true
+	}
+	return resumeSession(ctx, log, provider)
+}
+
+// resumeSession asks provider's service for a session it still holds,
+// whatever login state the provider last saw.
+func resumeSession(ctx context.Context, log *slog.Logger, provider wechat.Provider) bool {
+	restorer, ok := provider.(wechat.SessionRestorer)
+	if !ok {
+		return false
+	}
+	restored, err := restorer.RestoreSession(ctx)
+	if err != nil {
+		log.Warn("failed to restore wechat session", "error", err, "provider", provider.Name())
+		return false
+	}
+	if restored {
+		log.Info("restored wechat session", "provider", provider.Name())
+	}
+	return restored
+}
+
+// startLogin starts a new QR login unless provider is logged in or can
+// restore its session, since a new login can sign the existing session out.
+// It reports whether a login was started.
+func startLogin(ctx context.Context, log *slog.Logger, provider wechat.Provider) (bool, error) {
+	if restoreSession(ctx, log, provider) {
+		return false, nil
+	}
+	return true, provider.Login(ctx)
+}
+
+func (cp *CommandProcessor) cmdLogout(ctx context.Context, ce *CommandEvent) error {
+	ctx = context.WithValue(ctx, bridgeUserKey, ce.Sender)
+
+	if cp.router.multiTenant {
+		if cp.router.sessionManager == nil {
+			return fmt.Errorf("session manager not initialized")
+		}
+		if _, ok := cp.router.sessionManager.GetSession(ce.Sender); !ok {
+			ce.Reply("You are not logged in to WeChat.")
+			return nil
+		}
+		if err := cp.router.sessionManager.LogoutUser(ctx, ce.Sender); err != nil {
+			return err
+		}
+		ce.Reply("Logged out of WeChat.")
+		return nil
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return fmt.Errorf("no active provider")
+	}
+	if provider.GetLoginState() == wechat.LoginStateLoggedOut {
+		ce.Reply("Not logged in to WeChat.")
+		return nil
+	}
+	if err := provider.Logout(ctx); err != nil {
+		return fmt.Errorf("logout: %w", err)
+	}
+	ce.Reply("Logged out of WeChat.")
+	return nil
+}
+
+func (cp *CommandProcessor) cmdStatus(ctx context.Context, ce *CommandEvent) error {
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil || provider == nil {
+		ce.Reply("Not logged in to WeChat: no active provider.")
+		return nil
+	}
+
+	state := provider.GetLoginState()
+	status := fmt.Sprintf("Login state: %s\nProvider: %s (tier %d)", state, provider.Name(), provider.Tier())
+	if state == wechat.LoginStateLoggedIn {
+		if self := provider.GetSelf(); self != nil {
+			name := self.UserID
+			if self.Nickname != "" {
+				name = fmt.Sprintf("%s (%s)", self.Nickname, self.UserID)
+			}
+			status += "\nLogged in as: " + name
+		}
+	}
+	ce.Reply("%s", status)
+	return nil
+}
+
+// notifyLoginEvent reports a login state change to the bridge user.
+func (er *EventRouter) notifyLoginEvent(ctx context.Context, roomID string, evt *wechat.LoginEvent) {
+	switch evt.State {
+	case wechat.LoginStateQRCode:
+		er.sendLoginQR(ctx, roomID, evt)
+	case wechat.LoginStateConfirming:
+		er.sendNotice(ctx, roomID, "QR code scanned. Confirm the login in the WeChat app on your phone.")
+	case wechat.LoginStateLoggedIn:
+		name := evt.UserID
+		if evt.Name != "" {
+			name = fmt.Sprintf("%s (%s)", evt.Name, evt.UserID)
+		}
+		er.sendNotice(ctx, roomID, fmt.Sprintf("Logged in to WeChat as %s.", name))
+	case wechat.LoginStateError:
+		reason := evt.Error
+		if reason == "" {
+			reason = "unknown error"
+		}
+		er.sendNotice(ctx, roomID, "WeChat login failed: "+reason)
+	case wechat.LoginStateLoggedOut:
+		// Only logouts WeChat explains, such as a login on another device,
+		// are worth a notice; the user asked for the others.
+		if evt.Error != "" {
+			er.sendNotice(ctx, roomID, "Logged out of WeChat: "+evt.Error+". Send `login` to log in again.")
+		}
+	case wechat.LoginStateBanned:
+		reason := evt.Error
+		if reason == "" {
+			reason = "no reason given"
+		}
+		er.sendNotice(ctx, roomID, "WeChat has banned this account ("+reason+"). The bridge won't reconnect it; "+
+			"unblock the account in the WeChat app, then send `login` to log in again.")
+	}
+}
+
+// sendLoginQR posts a login QR code to a room as an image, falling back to
+// the QR link when the provider didn't supply image data.
+func (er *EventRouter) sendLoginQR(ctx context.Context, roomID string, evt *wechat.LoginEvent) {
+	const caption = "Scan this QR code with the WeChat app to log in."
+	if len(evt.QRCode) == 0 || er.matrixClient == nil || er.botUserID == "" {
+		if evt.QRURL != "" {
+			er.sendNotice(ctx, roomID, caption+" "+evt.QRURL)
+		}
+		return
+	}
+
+	mxcURI, err := er.matrixClient.UploadMedia(ctx, evt.QRCode, "image/png", "wechat-login-qr.png")
+	if err != nil {
+		er.log.Error("failed to upload login QR code", "error", err, "room_id", roomID)
+		if evt.QRURL != "" {
+			er.sendNotice(ctx, roomID, caption+" "+evt.QRURL)
+		}
+		return
+	}
+	_, err = er.matrixClient.SendMessage(ctx, roomID, er.botUserID, "m.room.message", map[string]interface{}{
+		"msgtype": "m.image",
+		"body":    caption,
+		"url":     mxcURI,
+		"info": map[string]interface{}{
+			"mimetype": "image/png",
+			"size":     len(evt.QRCode),
+		},
+	})
+	if err != nil {
+		er.log.Error("failed to send login QR code", "error", err, "room_id", roomID)
+	}
+}
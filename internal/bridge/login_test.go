@@ -0,0 +1,260 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// qrLoginProvider emits a QR code login event from Login, like padpro.
+type qrLoginProvider struct {
+	*mockProvider
+	handler   wechat.MessageHandler
+	loginCtx  context.Context
+	loggedOut bool
+}
+
+func (p *qrLoginProvider) Login(ctx context.Context) error {
+	p.loginCtx = ctx
+	return p.handler.OnLoginEvent(ctx, &wechat.LoginEvent{
+		State:  wechat.LoginStateQRCode,
+		QRCode: []byte("\x89PNG qr"),
+		QRURL:  "https://login.weixin.qq.com/l/abc",
+	})
+}
+
+func (p *qrLoginProvider) Logout(context.Context) error {
+	p.loggedOut = true
+	return nil
+}
+
+func newLoginTestCommandProcessor(matrix *testMatrixClient, provider *qrLoginProvider) *CommandProcessor {
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      newTestPuppetManager(),
+		Provider:     provider,
+		MatrixClient: matrix,
+		BotUserID:    "@wechatbot:example.com",
+	})
+	provider.handler = er
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    er,
+		BotUserID: "@wechatbot:example.com",
+	})
+	er.SetCommandProcessor(cp)
+	return cp
+}
+
+func TestCommandProcessor_LoginPostsQRCodeImage(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &qrLoginProvider{mockProvider: newMockProvider("padpro", 2)}
+	provider.loginState = wechat.LoginStateLoggedOut
+	cp := newLoginTestCommandProcessor(matrix, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := cp.Handle(ctx, newCommandEvent("!wechat login"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	cancel()
+
+	if len(matrix.sent) != 1 || matrix.sent[0].roomID != "!mgmt:test" || matrix.sent[0].sender != "@wechatbot:example.com" {
+		t.Fatalf("sent = %+v, want the QR code in the command room", matrix.sent)
+	}
+	content := matrix.sent[0].content.(map[string]interface{})
+	if content["msgtype"] != "m.image" || content["url"] != "mxc://test/uploaded" {
+		t.Fatalf("unexpected QR message: %+v", content)
+	}
+	// Login status polling outlives the command.
+	if provider.loginCtx.Err() != nil {
+		t.Fatal("login context was cancelled with the command")
+	}
+}
+
+func TestCommandProcessor_LoginWhenLoggedIn(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &qrLoginProvider{mockProvider: newMockProvider("padpro", 2)}
+	cp := newLoginTestCommandProcessor(matrix, provider)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat login"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if provider.loginCtx != nil {
+		t.Fatal("Login called while already logged in")
+	}
+	if reply := lastReply(t, matrix); reply != "Already logged in to WeChat." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+// restoringProvider is logged out until its session is restored, like a
+// padpro provider the bridge just restarted.
+type restoringProvider struct {
+	*qrLoginProvider
+	restores int
+}
+
+func (p *restoringProvider) RestoreSession(context.Context) (bool, error) {
+	p.restores++
+	p.mu.Lock()
+	p.loginState = wechat.LoginStateLoggedIn
+	p.mu.Unlock()
+	return true, nil
+}
+
+func TestCommandProcessor_LoginRestoresSessionInsteadOfNewLogin(t *testing.T) {
+	matrix := &testMatrixClient{}
+	qr := &qrLoginProvider{mockProvider: newMockProvider("padpro", 2)}
+	qr.loginState = wechat.LoginStateLoggedOut
+	provider := &restoringProvider{qrLoginProvider: qr}
+	cp := newLoginTestCommandProcessor(matrix, qr)
+	cp.router.SetProvider(provider)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat login"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if qr.loginCtx != nil {
+		t.Fatal("new login started although the session could be restored")
+	}
+	if provider.restores != 1 || provider.GetLoginState() != wechat.LoginStateLoggedIn {
+		t.Fatalf("restores = %d, state = %v", provider.restores, provider.GetLoginState())
+	}
+	if reply := lastReply(t, matrix); reply != "Already logged in to WeChat." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestProviderManager_StartRestoresSession(t *testing.T) {
+	qr := &qrLoginProvider{mockProvider: newMockProvider("padpro", 2)}
+	qr.loginState = wechat.LoginStateLoggedOut
+	provider := &restoringProvider{qrLoginProvider: qr}
+
+	pm := NewProviderManager(slog.Default(), DefaultFailoverConfig(), nil)
+	pm.AddProvider(provider, &wechat.ProviderConfig{})
+	if err := pm.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer pm.Stop()
+
+	if provider.restores != 1 || provider.GetLoginState() != wechat.LoginStateLoggedIn {
+		t.Fatalf("restores = %d, state = %v", provider.restores, provider.GetLoginState())
+	}
+	if qr.loginCtx != nil {
+		t.Fatal("new login started at startup")
+	}
+}
+
+func TestCommandProcessor_StatusAndLogout(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &qrLoginProvider{mockProvider: newMockProvider("padpro", 2)}
+	cp := newLoginTestCommandProcessor(matrix, provider)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat status"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "Login state: logged_in") ||
+		!strings.Contains(reply, "Provider: padpro (tier 2)") || !strings.Contains(reply, "Logged in as: padpro") {
+		t.Fatalf("unexpected status: %q", reply)
+	}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat logout"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if !provider.loggedOut {
+		t.Fatal("provider was not logged out")
+	}
+	if reply := lastReply(t, matrix); reply != "Logged out of WeChat." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestEventRouter_OnLoginEvent_ReportsToManagementRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          testBridgeLogger(),
+		Puppets:      newTestPuppetManager(),
+		BridgeUsers:  database.NewBridgeUserStore(db),
+		MatrixClient: matrix,
+		BotUserID:    "@wechatbot:example.com",
+		MultiTenant:  true,
+	})
+	ctx := context.WithValue(context.Background(), bridgeUserKey, "@user:test")
+
+	events := []*wechat.LoginEvent{
+		{State: wechat.LoginStateQRCode, QRCode: []byte("\x89PNG qr")},
+		{State: wechat.LoginStateConfirming},
+		{State: wechat.LoginStateLoggedIn, UserID: "wxid_me", Name: "Me"},
+	}
+	for _, evt := range events {
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM bridge_user WHERE matrix_user_id = $1`)).
+			WithArgs("@user:test").
+			WillReturnRows(sqlmock.NewRows(testBridgeUserColumnNames).AddRow("@user:test", "", "padpro", int(wechat.LoginStateLoggedOut), "!mgmt:test", "", nil, time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO bridge_user`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		if err := er.OnLoginEvent(ctx, evt); err != nil {
+			t.Fatalf("OnLoginEvent(%s): %v", evt.State, err)
+		}
+	}
+
+	if len(matrix.sent) != 3 {
+		t.Fatalf("sent %d messages, want one per login event", len(matrix.sent))
+	}
+	for _, sent := range matrix.sent {
+		if sent.roomID != "!mgmt:test" || sent.sender != "@wechatbot:example.com" {
+			t.Fatalf("sent %+v, want bot messages in the management room", sent)
+		}
+	}
+	if content := matrix.sent[0].content.(map[string]interface{}); content["msgtype"] != "m.image" {
+		t.Fatalf("QR code sent as %v, want m.image", content["msgtype"])
+	}
+	if body := matrix.sent[1].content.(map[string]interface{})["body"]; !strings.Contains(body.(string), "Confirm the login") {
+		t.Fatalf("unexpected confirming notice: %q", body)
+	}
+	if reply := lastReply(t, matrix); reply != "Logged in to WeChat as Me (wxid_me)." {
+		t.Fatalf("unexpected logged in notice: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_NotifyLoginEvent_SessionEnded(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          testBridgeLogger(),
+		MatrixClient: matrix,
+		BotUserID:    "@wechatbot:example.com",
+	})
+	ctx := context.Background()
+
+	er.notifyLoginEvent(ctx, "!mgmt:test", &wechat.LoginEvent{State: wechat.LoginStateLoggedOut})
+	if len(matrix.sent) != 0 {
+		t.Fatalf("sent %d notices for a logout without a reason, want none", len(matrix.sent))
+	}
+
+	er.notifyLoginEvent(ctx, "!mgmt:test", &wechat.LoginEvent{
+		State: wechat.LoginStateLoggedOut,
+		Error: "logged in on another device",
+	})
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "logged in on another device") {
+		t.Fatalf("unexpected logout notice: %q", reply)
+	}
+
+	er.notifyLoginEvent(ctx, "!mgmt:test", &wechat.LoginEvent{State: wechat.LoginStateBanned, Error: "account frozen"})
+	if reply := lastReply(t, matrix); !strings.Contains(reply, "banned") || !strings.Contains(reply, "account frozen") {
+		t.Fatalf("unexpected banned notice: %q", reply)
+	}
+}
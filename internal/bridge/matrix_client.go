@@ -0,0 +1,736 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMatrixHTTPTimeout applies to every homeserver request.
+const defaultMatrixHTTPTimeout = 60 * time.Second
+
+// Requests the homeserver rate limits (429 M_LIMIT_EXCEEDED) are retried up
+// to maxRateLimitRetries times after the retry_after_ms it asks for, or
+// defaultRateLimitDelay, doubled on each retry, when it doesn't say. Waits
+// longer than maxRateLimitDelay aren't sat out; the error is returned.
+const (
+	maxRateLimitRetries   = 5
+	defaultRateLimitDelay = time.Second
+	maxRateLimitDelay     = time.Minute
+)
+
+// AppServiceClient implements MatrixClient against the homeserver's
+// client-server API using the appservice as_token. Requests made on behalf
+// of puppets assert the user via the ?user_id= query parameter, so no
+// per-user access tokens are needed.
+type AppServiceClient struct {
+	baseURL   string
+	asToken   string
+	botUserID string
+	httpCli   *http.Client
+
+	txnPrefix  string
+	txnCounter uint64
+
+	mu         sync.Mutex
+	registered map[string]bool
+
+	// Slots for media uploads in progress, nil when unlimited; see
+	// SetMaxConcurrentUploads
+	uploadSlots chan struct{}
+
+	// Counts rate-limited requests; may be nil
+	metrics *Metrics
+}
+
+var _ MatrixClient = (*AppServiceClient)(nil)
+
+// matrixError is the standard error body returned by the homeserver.
+type matrixError struct {
+	StatusCode int    `json:"-"`
+	ErrCode    string `json:"errcode"`
+	Message    string `json:"error"`
+
+	// RetryAfterMs is how long M_LIMIT_EXCEEDED asks to wait, if it says
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s: %s", e.StatusCode, e.ErrCode, e.Message)
+}
+
+// NewAppServiceClient creates a MatrixClient for the homeserver at
+// homeserverURL. botUserID is used for requests not tied to a puppet,
+// such as room creation and media upload.
+func NewAppServiceClient(homeserverURL, asToken, botUserID string) *AppServiceClient {
+	return &AppServiceClient{
+		baseURL:    strings.TrimRight(homeserverURL, "/"),
+		asToken:    asToken,
+		botUserID:  botUserID,
+		httpCli:    &http.Client{Timeout: defaultMatrixHTTPTimeout},
+		txnPrefix:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		registered: make(map[string]bool),
+	}
+}
+
+// buildURL joins path segments (escaping each) onto the client API root and
+// asserts userID when set.
+func (c *AppServiceClient) buildURL(prefix string, segments []string, userID string, query url.Values) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	u := c.baseURL + prefix + "/" + strings.Join(escaped, "/")
+	if query == nil {
+		query = url.Values{}
+	}
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// doJSON sends body as JSON with the as_token and decodes the response
+// into out (if non-nil).
+func (c *AppServiceClient) doJSON(ctx context.Context, method, reqURL string, body, out interface{}) error {
+	return c.doJSONWithToken(ctx, method, reqURL, c.asToken, body, out)
+}
+
+// doJSONWithToken is doJSON authenticated with token instead of the
+// as_token. An empty token sends the request unauthenticated.
+func (c *AppServiceClient) doJSONWithToken(ctx context.Context, method, reqURL, token string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+// do authenticates req with the as_token and executes it.
+func (c *AppServiceClient) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.asToken)
+	return c.send(req)
+}
+
+// send executes req, turning non-2xx responses into a *matrixError. Rate
+// limited requests are retried; see maxRateLimitRetries. On success the
+// caller must close the response body.
+func (c *AppServiceClient) send(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpCli.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP request failed: %w", err)
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		mErr := readMatrixError(resp)
+		if mErr.StatusCode != http.StatusTooManyRequests && mErr.ErrCode != "M_LIMIT_EXCEEDED" {
+			return nil, mErr
+		}
+
+		if c.metrics != nil {
+			c.metrics.IncrHomeserverRateLimited()
+		}
+		delay := defaultRateLimitDelay << attempt
+		if mErr.RetryAfterMs > 0 {
+			delay = time.Duration(mErr.RetryAfterMs) * time.Millisecond
+		}
+		// Streamed bodies can't be sent again
+		if attempt >= maxRateLimitRetries || delay > maxRateLimitDelay || (req.Body != nil && req.GetBody == nil) {
+			return nil, mErr
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, mErr
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, mErr
+			}
+			req.Body = body
+		}
+	}
+}
+
+// readMatrixError reads a non-2xx response into a *matrixError and closes
+// its body.
+func readMatrixError(resp *http.Response) *matrixError {
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	mErr := &matrixError{StatusCode: resp.StatusCode}
+	if err := json.Unmarshal(data, mErr); err != nil || mErr.ErrCode == "" {
+		mErr.ErrCode = "M_UNKNOWN"
+		mErr.Message = string(data)
+	}
+	return mErr
+}
+
+func (c *AppServiceClient) clientURL(segments []string, userID string, query url.Values) string {
+	return c.buildURL("/_matrix/client/v3", segments, userID, query)
+}
+
+// nextTxnID returns a transaction ID unique to this process.
+func (c *AppServiceClient) nextTxnID() string {
+	return fmt.Sprintf("mwc_%s_%d", c.txnPrefix, atomic.AddUint64(&c.txnCounter, 1))
+}
+
+// EnsureRegistered registers a puppet user, treating M_USER_IN_USE as success.
+func (c *AppServiceClient) EnsureRegistered(ctx context.Context, userID string) error {
+	c.mu.Lock()
+	done := c.registered[userID]
+	c.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"type":     "m.login.application_service",
+		"username": matrixLocalpart(userID),
+	}
+	err := c.doJSON(ctx, http.MethodPost, c.clientURL([]string{"register"}, "", nil), body, nil)
+	if mErr, ok := err.(*matrixError); ok && mErr.ErrCode == "M_USER_IN_USE" {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("register %s: %w", userID, err)
+	}
+
+	c.mu.Lock()
+	c.registered[userID] = true
+	c.mu.Unlock()
+	return nil
+}
+
+// SetDisplayName sets the display name of a puppet user.
+func (c *AppServiceClient) SetDisplayName(ctx context.Context, userID, name string) error {
+	u := c.clientURL([]string{"profile", userID, "displayname"}, userID, nil)
+	if err := c.doJSON(ctx, http.MethodPut, u, map[string]string{"displayname": name}, nil); err != nil {
+		return fmt.Errorf("set displayname: %w", err)
+	}
+	return nil
+}
+
+// SetAvatarURL sets the avatar of a puppet user.
+func (c *AppServiceClient) SetAvatarURL(ctx context.Context, userID, mxcURI string) error {
+	u := c.clientURL([]string{"profile", userID, "avatar_url"}, userID, nil)
+	if err := c.doJSON(ctx, http.MethodPut, u, map[string]string{"avatar_url": mxcURI}, nil); err != nil {
+		return fmt.Errorf("set avatar url: %w", err)
+	}
+	return nil
+}
+
+// MediaStreamUploader is optionally implemented by MatrixClients that can
+// upload media from a reader without holding it in memory first.
+type MediaStreamUploader interface {
+	UploadMediaStream(ctx context.Context, r io.Reader, mimeType, fileName string) (string, error)
+}
+
+// UploadMedia uploads data as the bridge bot and returns its MXC URI.
+func (c *AppServiceClient) UploadMedia(ctx context.Context, data []byte, mimeType, fileName string) (string, error) {
+	return c.UploadMediaStream(ctx, bytes.NewReader(data), mimeType, fileName)
+}
+
+// SetMaxConcurrentUploads limits how many media uploads run at once, so a
+// burst of incoming media doesn't overwhelm the homeserver's media
+// repository. Further uploads queue until a slot frees up. n <= 0 removes
+// the limit. It must be called before the client is used.
+func (c *AppServiceClient) SetMaxConcurrentUploads(n int) {
+	if n <= 0 {
+		c.uploadSlots = nil
+		return
+	}
+	c.uploadSlots = make(chan struct{}, n)
+}
+
+// SetMetrics sets the metrics homeserver rate limiting is counted in. It
+// must be called before the client is used.
+func (c *AppServiceClient) SetMetrics(m *Metrics) {
+	c.metrics = m
+}
+
+// UploadMediaStream uploads media read from r as the bridge bot and returns
+// its MXC URI. Readers of unknown length are sent chunked.
+func (c *AppServiceClient) UploadMediaStream(ctx context.Context, r io.Reader, mimeType, fileName string) (string, error) {
+	if c.uploadSlots != nil {
+		select {
+		case c.uploadSlots <- struct{}{}:
+			defer func() { <-c.uploadSlots }()
+		case <-ctx.Done():
+			return "", fmt.Errorf("upload media: %w", ctx.Err())
+		}
+	}
+
+	query := url.Values{}
+	if fileName != "" {
+		query.Set("filename", fileName)
+	}
+	u := c.baseURL + "/_matrix/media/v3/upload?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, r)
+	if err != nil {
+		return "", err
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", mimeType)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload media: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("parse upload response: %w", err)
+	}
+	return result.ContentURI, nil
+}
+
+// parseMXC splits "mxc://server/mediaID" into its parts.
+func parseMXC(mxcURI string) (server, mediaID string, err error) {
+	rest := strings.TrimPrefix(mxcURI, "mxc://")
+	idx := strings.IndexByte(rest, '/')
+	if rest == mxcURI || idx <= 0 || idx == len(rest)-1 {
+		return "", "", fmt.Errorf("invalid mxc uri %q", mxcURI)
+	}
+	return rest[:idx], rest[idx+1:], nil
+}
+
+// mediaRequest issues an authenticated media request for an MXC URI.
+func (c *AppServiceClient) mediaRequest(ctx context.Context, method, mxcURI string) (*http.Response, error) {
+	server, mediaID, err := parseMXC(mxcURI)
+	if err != nil {
+		return nil, err
+	}
+	u := c.buildURL("/_matrix/client/v1/media/download", []string{server, mediaID}, "", nil)
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// DownloadMedia downloads media by MXC URI. The caller closes the reader.
+func (c *AppServiceClient) DownloadMedia(ctx context.Context, mxcURI string) (io.ReadCloser, string, error) {
+	resp, err := c.mediaRequest(ctx, http.MethodGet, mxcURI)
+	if err != nil {
+		return nil, "", fmt.Errorf("download media: %w", err)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// MediaExists reports whether an MXC URI still resolves. Purged or unknown
+// media (404) yields false without an error.
+func (c *AppServiceClient) MediaExists(ctx context.Context, mxcURI string) (bool, error) {
+	resp, err := c.mediaRequest(ctx, http.MethodHead, mxcURI)
+	if mErr, ok := err.(*matrixError); ok && mErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check media: %w", err)
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+func (c *AppServiceClient) sendEvent(ctx context.Context, roomID, senderUserID, eventType string, content interface{}, query url.Values) (string, error) {
+	u := c.clientURL([]string{"rooms", roomID, "send", eventType, c.nextTxnID()}, senderUserID, query)
+	var result struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPut, u, content, &result); err != nil {
+		return "", fmt.Errorf("send event to %s: %w", roomID, err)
+	}
+	return result.EventID, nil
+}
+
+// SendMessage sends an event of type eventType to a room as senderUserID.
+func (c *AppServiceClient) SendMessage(ctx context.Context, roomID, senderUserID, eventType string, content interface{}) (string, error) {
+	return c.sendEvent(ctx, roomID, senderUserID, eventType, content, nil)
+}
+
+// SendMessageWithTimestamp sends an event with an appservice-massaged
+// origin_server_ts (timestamp in milliseconds).
+func (c *AppServiceClient) SendMessageWithTimestamp(ctx context.Context, roomID, senderUserID, eventType string, content interface{}, timestamp int64) (string, error) {
+	query := url.Values{}
+	if timestamp > 0 {
+		query.Set("ts", strconv.FormatInt(timestamp, 10))
+	}
+	return c.sendEvent(ctx, roomID, senderUserID, eventType, content, query)
+}
+
+// SendReaction sends an m.reaction annotating eventID with key as
+// senderUserID.
+func (c *AppServiceClient) SendReaction(ctx context.Context, roomID, senderUserID, eventID, key string) (string, error) {
+	content := map[string]interface{}{
+		"m.relates_to": map[string]interface{}{
+			"rel_type": "m.annotation",
+			"event_id": eventID,
+			"key":      key,
+		},
+	}
+	u := c.clientURL([]string{"rooms", roomID, "send", "m.reaction", c.nextTxnID()}, senderUserID, nil)
+	var result struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPut, u, content, &result); err != nil {
+		return "", fmt.Errorf("send reaction to %s: %w", roomID, err)
+	}
+	return result.EventID, nil
+}
+
+// SendMessageAs sends an event with a real user's access token. If the user
+// is not in the room yet (e.g. only invited), it joins and retries once.
+func (c *AppServiceClient) SendMessageAs(ctx context.Context, roomID, userID, accessToken, eventType string, content interface{}) (string, error) {
+	send := func() (string, error) {
+		u := c.clientURL([]string{"rooms", roomID, "send", eventType, c.nextTxnID()}, "", nil)
+		var result struct {
+			EventID string `json:"event_id"`
+		}
+		err := c.doJSONWithToken(ctx, http.MethodPut, u, accessToken, content, &result)
+		return result.EventID, err
+	}
+
+	eventID, err := send()
+	if mErr, ok := err.(*matrixError); ok && mErr.ErrCode == "M_FORBIDDEN" {
+		joinURL := c.clientURL([]string{"join", roomID}, "", nil)
+		if joinErr := c.doJSONWithToken(ctx, http.MethodPost, joinURL, accessToken, struct{}{}, nil); joinErr != nil {
+			return "", fmt.Errorf("join %s as %s: %w", roomID, userID, joinErr)
+		}
+		eventID, err = send()
+	}
+	if err != nil {
+		return "", fmt.Errorf("send event to %s as %s: %w", roomID, userID, err)
+	}
+	return eventID, nil
+}
+
+// LoginWithSharedSecret logs in as userID using the homeserver's
+// shared-secret auth (the password is HMAC-SHA512 of the user ID) and
+// returns the new access token.
+func (c *AppServiceClient) LoginWithSharedSecret(ctx context.Context, userID, secret string) (string, error) {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(userID))
+	body := map[string]interface{}{
+		"type":                        "m.login.password",
+		"identifier":                  map[string]string{"type": "m.id.user", "user": userID},
+		"password":                    hex.EncodeToString(mac.Sum(nil)),
+		"initial_device_display_name": "WeChat Bridge",
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.doJSONWithToken(ctx, http.MethodPost, c.clientURL([]string{"login"}, "", nil), "", body, &result); err != nil {
+		return "", fmt.Errorf("login as %s: %w", userID, err)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("login as %s: no access token in response", userID)
+	}
+	return result.AccessToken, nil
+}
+
+func (c *AppServiceClient) createRoom(ctx context.Context, body map[string]interface{}) (string, error) {
+	var result struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, c.clientURL([]string{"createRoom"}, c.botUserID, nil), body, &result); err != nil {
+		return "", err
+	}
+	return result.RoomID, nil
+}
+
+// CreateRoom creates a room owned by the bridge bot.
+func (c *AppServiceClient) CreateRoom(ctx context.Context, req *CreateRoomRequest) (string, error) {
+	body := map[string]interface{}{
+		"preset":    "private_chat",
+		"is_direct": req.IsDirect,
+	}
+	if req.Name != "" {
+		body["name"] = req.Name
+	}
+	if req.Topic != "" {
+		body["topic"] = req.Topic
+	}
+	if len(req.Invite) > 0 {
+		body["invite"] = req.Invite
+	}
+
+	var initialState []map[string]interface{}
+	if req.AvatarMXC != "" {
+		initialState = append(initialState, map[string]interface{}{
+			"type": "m.room.avatar", "state_key": "", "content": map[string]string{"url": req.AvatarMXC},
+		})
+	}
+	if req.IsEncrypted {
+		initialState = append(initialState, map[string]interface{}{
+			"type": "m.room.encryption", "state_key": "", "content": map[string]string{"algorithm": "m.megolm.v1.aes-sha2"},
+		})
+	}
+	if len(initialState) > 0 {
+		body["initial_state"] = initialState
+	}
+	if req.Predecessor != "" {
+		body["creation_content"] = map[string]interface{}{
+			"predecessor": map[string]string{"room_id": req.Predecessor},
+		}
+	}
+
+	roomID, err := c.createRoom(ctx, body)
+	if err != nil {
+		return "", fmt.Errorf("create room: %w", err)
+	}
+	if req.SpaceID != "" {
+		if err := c.AddRoomToSpace(ctx, req.SpaceID, roomID); err != nil {
+			return roomID, err
+		}
+	}
+	return roomID, nil
+}
+
+// JoinRoom makes userID join roomID.
+func (c *AppServiceClient) JoinRoom(ctx context.Context, userID, roomID string) error {
+	if err := c.doJSON(ctx, http.MethodPost, c.clientURL([]string{"join", roomID}, userID, nil), struct{}{}, nil); err != nil {
+		return fmt.Errorf("join %s: %w", roomID, err)
+	}
+	return nil
+}
+
+// LeaveRoom makes userID leave roomID.
+func (c *AppServiceClient) LeaveRoom(ctx context.Context, userID, roomID string) error {
+	if err := c.doJSON(ctx, http.MethodPost, c.clientURL([]string{"rooms", roomID, "leave"}, userID, nil), struct{}{}, nil); err != nil {
+		return fmt.Errorf("leave %s: %w", roomID, err)
+	}
+	return nil
+}
+
+// InviteToRoom invites userID to roomID as the bridge bot.
+func (c *AppServiceClient) InviteToRoom(ctx context.Context, roomID, userID string) error {
+	u := c.clientURL([]string{"rooms", roomID, "invite"}, c.botUserID, nil)
+	if err := c.doJSON(ctx, http.MethodPost, u, map[string]string{"user_id": userID}, nil); err != nil {
+		return fmt.Errorf("invite %s to %s: %w", userID, roomID, err)
+	}
+	return nil
+}
+
+// KickFromRoom kicks userID from roomID as the bridge bot.
+func (c *AppServiceClient) KickFromRoom(ctx context.Context, roomID, userID, reason string) error {
+	body := map[string]string{"user_id": userID}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	if err := c.doJSON(ctx, http.MethodPost, c.clientURL([]string{"rooms", roomID, "kick"}, c.botUserID, nil), body, nil); err != nil {
+		return fmt.Errorf("kick %s from %s: %w", userID, roomID, err)
+	}
+	return nil
+}
+
+// RedactEvent redacts an event as the bridge bot.
+func (c *AppServiceClient) RedactEvent(ctx context.Context, roomID, eventID, reason string) error {
+	body := map[string]string{}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	u := c.clientURL([]string{"rooms", roomID, "redact", eventID, c.nextTxnID()}, c.botUserID, nil)
+	if err := c.doJSON(ctx, http.MethodPut, u, body, nil); err != nil {
+		return fmt.Errorf("redact %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// SendStateEvent sends a state event as the bridge bot.
+func (c *AppServiceClient) SendStateEvent(ctx context.Context, roomID, eventType, stateKey string, content interface{}) error {
+	u := c.clientURL([]string{"rooms", roomID, "state", eventType, stateKey}, c.botUserID, nil)
+	if err := c.doJSON(ctx, http.MethodPut, u, content, nil); err != nil {
+		return fmt.Errorf("send %s state to %s: %w", eventType, roomID, err)
+	}
+	return nil
+}
+
+// SetRoomName sets the m.room.name of a room.
+func (c *AppServiceClient) SetRoomName(ctx context.Context, roomID, name string) error {
+	return c.SendStateEvent(ctx, roomID, "m.room.name", "", map[string]string{"name": name})
+}
+
+// SetRoomAvatar sets the m.room.avatar of a room.
+func (c *AppServiceClient) SetRoomAvatar(ctx context.Context, roomID, mxcURI string) error {
+	return c.SendStateEvent(ctx, roomID, "m.room.avatar", "", map[string]string{"url": mxcURI})
+}
+
+// SetRoomTopic sets the m.room.topic of a room.
+func (c *AppServiceClient) SetRoomTopic(ctx context.Context, roomID, topic string) error {
+	return c.SendStateEvent(ctx, roomID, "m.room.topic", "", map[string]string{"topic": topic})
+}
+
+// PinnedEvents reads the m.room.pinned_events of a room. A room nothing was
+// ever pinned in has no pins.
+func (c *AppServiceClient) PinnedEvents(ctx context.Context, roomID string) ([]string, error) {
+	var content struct {
+		Pinned []string `json:"pinned"`
+	}
+	u := c.clientURL([]string{"rooms", roomID, "state", "m.room.pinned_events", ""}, c.botUserID, nil)
+	err := c.doJSON(ctx, http.MethodGet, u, nil, &content)
+	if mErr, ok := err.(*matrixError); ok && mErr.ErrCode == "M_NOT_FOUND" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pinned events of %s: %w", roomID, err)
+	}
+	return content.Pinned, nil
+}
+
+// SetPinnedEvents sets the m.room.pinned_events of a room.
+func (c *AppServiceClient) SetPinnedEvents(ctx context.Context, roomID string, eventIDs []string) error {
+	if eventIDs == nil {
+		eventIDs = []string{}
+	}
+	return c.SendStateEvent(ctx, roomID, "m.room.pinned_events", "", map[string][]string{"pinned": eventIDs})
+}
+
+// SetRoomMemberName overrides userID's display name in roomID by updating
+// their own m.room.member event, keeping the rest of the membership content.
+func (c *AppServiceClient) SetRoomMemberName(ctx context.Context, roomID, userID, name string) error {
+	u := c.clientURL([]string{"rooms", roomID, "state", "m.room.member", userID}, userID, nil)
+	member := map[string]interface{}{}
+	if err := c.doJSON(ctx, http.MethodGet, u, nil, &member); err != nil {
+		member = map[string]interface{}{}
+	}
+	member["membership"] = "join"
+	member["displayname"] = name
+	if err := c.doJSON(ctx, http.MethodPut, u, member, nil); err != nil {
+		return fmt.Errorf("set member name in %s: %w", roomID, err)
+	}
+	return nil
+}
+
+// SetTyping sets userID's typing state in roomID.
+func (c *AppServiceClient) SetTyping(ctx context.Context, roomID, userID string, typing bool, timeoutMs int) error {
+	body := map[string]interface{}{"typing": typing}
+	if typing {
+		body["timeout"] = timeoutMs
+	}
+	if err := c.doJSON(ctx, http.MethodPut, c.clientURL([]string{"rooms", roomID, "typing", userID}, userID, nil), body, nil); err != nil {
+		return fmt.Errorf("set typing: %w", err)
+	}
+	return nil
+}
+
+// SetPresence sets userID online or offline.
+func (c *AppServiceClient) SetPresence(ctx context.Context, userID string, online bool) error {
+	presence := "offline"
+	if online {
+		presence = "online"
+	}
+	u := c.clientURL([]string{"presence", userID, "status"}, userID, nil)
+	if err := c.doJSON(ctx, http.MethodPut, u, map[string]string{"presence": presence}, nil); err != nil {
+		return fmt.Errorf("set presence: %w", err)
+	}
+	return nil
+}
+
+// SendReadReceipt marks eventID as read by userID.
+func (c *AppServiceClient) SendReadReceipt(ctx context.Context, roomID, eventID, userID string) error {
+	u := c.clientURL([]string{"rooms", roomID, "receipt", "m.read", eventID}, userID, nil)
+	if err := c.doJSON(ctx, http.MethodPost, u, struct{}{}, nil); err != nil {
+		return fmt.Errorf("send read receipt: %w", err)
+	}
+	return nil
+}
+
+// CreateSpace creates a Matrix Space owned by the bridge bot.
+func (c *AppServiceClient) CreateSpace(ctx context.Context, req *CreateSpaceRequest) (string, error) {
+	body := map[string]interface{}{
+		"preset":           "private_chat",
+		"creation_content": map[string]string{"type": "m.space"},
+	}
+	if req.Name != "" {
+		body["name"] = req.Name
+	}
+	if req.Topic != "" {
+		body["topic"] = req.Topic
+	}
+	if len(req.Invite) > 0 {
+		body["invite"] = req.Invite
+	}
+	if req.AvatarMXC != "" {
+		body["initial_state"] = []map[string]interface{}{{
+			"type": "m.room.avatar", "state_key": "", "content": map[string]string{"url": req.AvatarMXC},
+		}}
+	}
+
+	spaceID, err := c.createRoom(ctx, body)
+	if err != nil {
+		return "", fmt.Errorf("create space: %w", err)
+	}
+	return spaceID, nil
+}
+
+// AddRoomToSpace links roomID into spaceID with m.space.child and
+// m.space.parent state events.
+func (c *AppServiceClient) AddRoomToSpace(ctx context.Context, spaceID, roomID string) error {
+	via := []string{c.serverName()}
+	if err := c.SendStateEvent(ctx, spaceID, "m.space.child", roomID, map[string]interface{}{"via": via}); err != nil {
+		return fmt.Errorf("add room to space: %w", err)
+	}
+	if err := c.SendStateEvent(ctx, roomID, "m.space.parent", spaceID, map[string]interface{}{"via": via, "canonical": true}); err != nil {
+		return fmt.Errorf("set space parent: %w", err)
+	}
+	return nil
+}
+
+// serverName returns the server part of the bot's user ID.
+func (c *AppServiceClient) serverName() string {
+	if idx := strings.IndexByte(c.botUserID, ':'); idx >= 0 {
+		return c.botUserID[idx+1:]
+	}
+	return ""
+}
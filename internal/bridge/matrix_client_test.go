@@ -0,0 +1,444 @@
+package bridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedRequest is one request seen by the fake homeserver.
+type recordedRequest struct {
+	Method string
+	Path   string
+	UserID string
+	TS     string
+	Auth   string
+	Body   map[string]interface{}
+}
+
+// newFakeHomeserver records every request and answers with handler.
+func newFakeHomeserver(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*AppServiceClient, *[]recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordedRequest{
+			Method: r.Method,
+			Path:   r.URL.EscapedPath(),
+			UserID: r.URL.Query().Get("user_id"),
+			TS:     r.URL.Query().Get("ts"),
+			Auth:   r.Header.Get("Authorization"),
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			json.NewDecoder(r.Body).Decode(&rec.Body)
+		}
+		mu.Lock()
+		reqs = append(reqs, rec)
+		mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return NewAppServiceClient(srv.URL+"/", "as_secret", "@wechatbot:example.com"), &reqs
+}
+
+func TestAppServiceClient_SendMessageAsPuppet(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event_id":"$evt1"}`))
+	})
+
+	eventID, err := client.SendMessageWithTimestamp(context.Background(), "!room:example.com", "@wechat_alice:example.com", "m.room.message",
+		map[string]interface{}{"msgtype": "m.text", "body": "hi"}, 1700000000000)
+	if err != nil {
+		t.Fatalf("SendMessageWithTimestamp: %v", err)
+	}
+	if eventID != "$evt1" {
+		t.Fatalf("event ID = %q", eventID)
+	}
+
+	req := (*reqs)[0]
+	if req.Method != http.MethodPut ||
+		!strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/mwc_") {
+		t.Fatalf("unexpected request %s %s", req.Method, req.Path)
+	}
+	if req.Auth != "Bearer as_secret" || req.UserID != "@wechat_alice:example.com" || req.TS != "1700000000000" {
+		t.Fatalf("unexpected auth/user/ts: %+v", req)
+	}
+	if req.Body["body"] != "hi" {
+		t.Fatalf("body = %v", req.Body)
+	}
+}
+
+func TestAppServiceClient_SendMessageSticker(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event_id":"$sticker1"}`))
+	})
+
+	_, err := client.SendMessage(context.Background(), "!room:example.com", "@wechat_alice:example.com", "m.sticker",
+		map[string]interface{}{"body": "sticker", "url": "mxc://example.com/abc", "info": map[string]interface{}{"w": 120, "h": 120}})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if path := (*reqs)[0].Path; !strings.HasPrefix(path, "/_matrix/client/v3/rooms/%21room:example.com/send/m.sticker/") {
+		t.Fatalf("unexpected path %s", path)
+	}
+}
+
+func TestAppServiceClient_SendReaction(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event_id":"$react1"}`))
+	})
+
+	eventID, err := client.SendReaction(context.Background(), "!room:example.com", "@wechat_alice:example.com", "$target", "👋")
+	if err != nil {
+		t.Fatalf("SendReaction: %v", err)
+	}
+	if eventID != "$react1" {
+		t.Fatalf("event ID = %q", eventID)
+	}
+
+	req := (*reqs)[0]
+	if req.Method != http.MethodPut ||
+		!strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/%21room:example.com/send/m.reaction/") ||
+		req.UserID != "@wechat_alice:example.com" {
+		t.Fatalf("unexpected request %s %s as %s", req.Method, req.Path, req.UserID)
+	}
+	relatesTo, _ := req.Body["m.relates_to"].(map[string]interface{})
+	if relatesTo["rel_type"] != "m.annotation" || relatesTo["event_id"] != "$target" || relatesTo["key"] != "👋" {
+		t.Fatalf("m.relates_to = %v", req.Body["m.relates_to"])
+	}
+}
+
+func TestAppServiceClient_SetRoomMemberNameKeepsAvatar(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"membership":"join","displayname":"Alice (WeChat)","avatar_url":"mxc://example.com/alice"}`))
+			return
+		}
+		w.Write([]byte(`{"event_id":"$member"}`))
+	})
+
+	err := client.SetRoomMemberName(context.Background(), "!room:example.com", "@wechat_alice:example.com", "Alice from work")
+	if err != nil {
+		t.Fatalf("SetRoomMemberName: %v", err)
+	}
+	if len(*reqs) != 2 {
+		t.Fatalf("got %d requests, want a GET and a PUT", len(*reqs))
+	}
+	req := (*reqs)[1]
+	if req.Method != http.MethodPut || req.UserID != "@wechat_alice:example.com" ||
+		req.Path != "/_matrix/client/v3/rooms/%21room:example.com/state/m.room.member/@wechat_alice:example.com" {
+		t.Fatalf("unexpected request %s %s as %s", req.Method, req.Path, req.UserID)
+	}
+	if req.Body["displayname"] != "Alice from work" || req.Body["avatar_url"] != "mxc://example.com/alice" || req.Body["membership"] != "join" {
+		t.Fatalf("body = %v", req.Body)
+	}
+}
+
+func TestAppServiceClient_EnsureRegisteredToleratesUserInUse(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errcode":"M_USER_IN_USE","error":"User ID already taken."}`))
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := client.EnsureRegistered(context.Background(), "@wechat_alice:example.com"); err != nil {
+			t.Fatalf("EnsureRegistered: %v", err)
+		}
+	}
+	if len(*reqs) != 1 {
+		t.Fatalf("expected one register request, got %d", len(*reqs))
+	}
+	req := (*reqs)[0]
+	if req.Path != "/_matrix/client/v3/register" || req.Body["username"] != "wechat_alice" ||
+		req.Body["type"] != "m.login.application_service" {
+		t.Fatalf("unexpected register request: %+v", req)
+	}
+}
+
+func TestAppServiceClient_CreateRoomEncryptedInSpace(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"room_id":"!new:example.com"}`))
+	})
+
+	roomID, err := client.CreateRoom(context.Background(), &CreateRoomRequest{
+		Name:        "Alice",
+		IsDirect:    true,
+		Invite:      []string{"@user:example.com"},
+		IsEncrypted: true,
+		SpaceID:     "!space:example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if roomID != "!new:example.com" {
+		t.Fatalf("room ID = %q", roomID)
+	}
+	if len(*reqs) != 3 {
+		t.Fatalf("expected createRoom plus two space state events, got %d requests", len(*reqs))
+	}
+
+	create := (*reqs)[0]
+	if create.UserID != "@wechatbot:example.com" || create.Body["is_direct"] != true || create.Body["name"] != "Alice" {
+		t.Fatalf("unexpected createRoom request: %+v", create)
+	}
+	state, _ := create.Body["initial_state"].([]interface{})
+	if len(state) != 1 || state[0].(map[string]interface{})["type"] != "m.room.encryption" {
+		t.Fatalf("initial_state = %v", create.Body["initial_state"])
+	}
+	if (*reqs)[1].Path != "/_matrix/client/v3/rooms/%21space:example.com/state/m.space.child/%21new:example.com" {
+		t.Fatalf("space child path = %s", (*reqs)[1].Path)
+	}
+	if (*reqs)[2].Path != "/_matrix/client/v3/rooms/%21new:example.com/state/m.space.parent/%21space:example.com" {
+		t.Fatalf("space parent path = %s", (*reqs)[2].Path)
+	}
+}
+
+func TestAppServiceClient_CreateRoomWithPredecessor(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"room_id":"!new:example.com"}`))
+	})
+
+	if _, err := client.CreateRoom(context.Background(), &CreateRoomRequest{Name: "Team", Predecessor: "!old:example.com"}); err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	creation, _ := (*reqs)[0].Body["creation_content"].(map[string]interface{})
+	predecessor, _ := creation["predecessor"].(map[string]interface{})
+	if predecessor["room_id"] != "!old:example.com" {
+		t.Fatalf("creation_content = %v", (*reqs)[0].Body["creation_content"])
+	}
+}
+
+func TestAppServiceClient_MediaExists(t *testing.T) {
+	client, _ := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/purged") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Not found"}`))
+			return
+		}
+	})
+
+	ok, err := client.MediaExists(context.Background(), "mxc://example.com/present")
+	if err != nil || !ok {
+		t.Fatalf("MediaExists(present) = %v, %v", ok, err)
+	}
+	ok, err = client.MediaExists(context.Background(), "mxc://example.com/purged")
+	if err != nil || ok {
+		t.Fatalf("MediaExists(purged) = %v, %v", ok, err)
+	}
+	if _, err := client.MediaExists(context.Background(), "https://example.com/x"); err == nil {
+		t.Fatal("expected error for non-mxc URI")
+	}
+}
+
+func TestAppServiceClient_PinnedEvents(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "unpinned") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Event not found"}`))
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"pinned":["$a","$b"]}`))
+			return
+		}
+		w.Write([]byte(`{"event_id":"$state"}`))
+	})
+
+	pinned, err := client.PinnedEvents(context.Background(), "!room:example.com")
+	if err != nil || len(pinned) != 2 || pinned[0] != "$a" || pinned[1] != "$b" {
+		t.Fatalf("PinnedEvents = %v, %v", pinned, err)
+	}
+	if pinned, err := client.PinnedEvents(context.Background(), "!unpinned:example.com"); err != nil || len(pinned) != 0 {
+		t.Fatalf("PinnedEvents of unpinned room = %v, %v", pinned, err)
+	}
+
+	if err := client.SetPinnedEvents(context.Background(), "!room:example.com", []string{"$b", "$c"}); err != nil {
+		t.Fatalf("SetPinnedEvents: %v", err)
+	}
+	req := (*reqs)[len(*reqs)-1]
+	if req.Method != http.MethodPut || req.Path != "/_matrix/client/v3/rooms/%21room:example.com/state/m.room.pinned_events/" {
+		t.Fatalf("unexpected request %s %s", req.Method, req.Path)
+	}
+	if got, _ := req.Body["pinned"].([]interface{}); len(got) != 2 || got[0] != "$b" || got[1] != "$c" {
+		t.Fatalf("body = %v", req.Body)
+	}
+}
+
+func TestAppServiceClient_SendMessageAsJoinsWhenForbidden(t *testing.T) {
+	joined := false
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/join/"):
+			joined = true
+			w.Write([]byte(`{"room_id":"!room:example.com"}`))
+		case !joined:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"User not in room"}`))
+		default:
+			w.Write([]byte(`{"event_id":"$mine"}`))
+		}
+	})
+
+	eventID, err := client.SendMessageAs(context.Background(), "!room:example.com", "@user:example.com", "user_token", "m.room.message",
+		map[string]interface{}{"msgtype": "m.text", "body": "hi"})
+	if err != nil {
+		t.Fatalf("SendMessageAs: %v", err)
+	}
+	if eventID != "$mine" || len(*reqs) != 3 {
+		t.Fatalf("eventID = %q after %d requests, want $mine after send, join, send", eventID, len(*reqs))
+	}
+	for _, req := range *reqs {
+		if req.Auth != "Bearer user_token" || req.UserID != "" {
+			t.Fatalf("request not authenticated as the user: %+v", req)
+		}
+	}
+}
+
+func TestAppServiceClient_LoginWithSharedSecret(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"syt_new","user_id":"@user:example.com"}`))
+	})
+
+	token, err := client.LoginWithSharedSecret(context.Background(), "@user:example.com", "secret")
+	if err != nil || token != "syt_new" {
+		t.Fatalf("LoginWithSharedSecret = %q, %v", token, err)
+	}
+	req := (*reqs)[0]
+	mac := hmac.New(sha512.New, []byte("secret"))
+	mac.Write([]byte("@user:example.com"))
+	if req.Path != "/_matrix/client/v3/login" || req.Auth != "" || req.Body["password"] != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("unexpected login request: %+v", req)
+	}
+}
+
+func TestAppServiceClient_UploadMediaConcurrencyIsCapped(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	release := make(chan struct{})
+	client, _ := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(`{"content_uri":"mxc://example.com/media"}`))
+	})
+	client.SetMaxConcurrentUploads(2)
+
+	const burst = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, burst)
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.UploadMedia(context.Background(), []byte("data"), "image/png", "a.png")
+			errs <- err
+		}()
+	}
+	// Let the burst queue up, then let the uploads finish one by one.
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < burst; i++ {
+		release <- struct{}{}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UploadMedia: %v", err)
+		}
+	}
+	if maxInFlight != 2 {
+		t.Fatalf("max concurrent uploads = %d, want 2", maxInFlight)
+	}
+}
+
+func TestAppServiceClient_QueuedUploadHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"content_uri":"mxc://example.com/media"}`))
+	})
+	client.SetMaxConcurrentUploads(1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.UploadMedia(context.Background(), []byte("data"), "image/png", "a.png")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.UploadMedia(ctx, []byte("data"), "image/png", "b.png"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("queued upload error = %v, want deadline exceeded", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+}
+
+func TestAppServiceClient_RetriesRateLimitedRequests(t *testing.T) {
+	var calls int
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":150}`))
+			return
+		}
+		w.Write([]byte(`{"event_id":"$evt1"}`))
+	})
+	metrics := NewMetrics()
+	client.SetMetrics(metrics)
+
+	start := time.Now()
+	eventID, err := client.SendMessage(context.Background(), "!room:example.com", "@wechat_alice:example.com", "m.room.message",
+		map[string]interface{}{"msgtype": "m.text", "body": "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if eventID != "$evt1" {
+		t.Fatalf("event ID = %q", eventID)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("retried after %v, want at least retry_after_ms", elapsed)
+	}
+	if len(*reqs) != 2 || (*reqs)[1].Body["body"] != "hi" || (*reqs)[0].Path != (*reqs)[1].Path {
+		t.Fatalf("requests = %+v, want the same request sent twice", *reqs)
+	}
+	if got := metrics.homeserverRateLimited.Load(); got != 1 {
+		t.Fatalf("rate limited count = %d, want 1", got)
+	}
+}
+
+func TestAppServiceClient_RateLimitTooLongIsReturned(t *testing.T) {
+	client, reqs := newFakeHomeserver(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":3600000}`))
+	})
+
+	err := client.InviteToRoom(context.Background(), "!room:example.com", "@wechat_alice:example.com")
+	var mErr *matrixError
+	if !errors.As(err, &mErr) || mErr.ErrCode != "M_LIMIT_EXCEEDED" || mErr.RetryAfterMs != 3600000 {
+		t.Fatalf("err = %v, want M_LIMIT_EXCEEDED", err)
+	}
+	if len(*reqs) != 1 {
+		t.Fatalf("requests = %d, want no retry", len(*reqs))
+	}
+}
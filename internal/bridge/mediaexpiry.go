@@ -0,0 +1,36 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const mediaExpiredNotice = "📎 media expired on WeChat and can no longer be retrieved"
+
+// convertWeChatMessage converts msg with the message processor. Media that
+// WeChat no longer serves becomes a notice in place of the message instead
+// of a failed conversion. Payment requests are rendered here, or dropped
+// with a nil result when configured to be ignored.
+func (er *EventRouter) convertWeChatMessage(ctx context.Context, msg *wechat.Message) (*MatrixEventContent, error) {
+	// Payment requests name the requester, which the processor doesn't know
+	if pay := parsePayment(msg); pay != nil && pay.Request {
+		return er.paymentRequestToMatrix(ctx, msg, pay), nil
+	}
+	if msg.Card != nil {
+		return er.contactCardToMatrix(msg), nil
+	}
+	content, err := er.processor.WeChatToMatrix(ctx, msg)
+	if errors.Is(err, wechat.ErrMediaExpired) {
+		er.log.Info("wechat media expired", "msg_id", msg.MsgID, "type", msg.Type)
+		return &MatrixEventContent{
+			EventType: "m.room.message",
+			Content: map[string]interface{}{
+				"msgtype": "m.notice",
+				"body":    mediaExpiredNotice,
+			},
+		}, nil
+	}
+	return content, err
+}
@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// expiredMediaProvider fails every media download like a provider whose
+// WeChat media URL expired.
+type expiredMediaProvider struct {
+	*mockProvider
+}
+
+func (p *expiredMediaProvider) DownloadMedia(context.Context, *wechat.Message) (io.ReadCloser, string, error) {
+	return nil, "", fmt.Errorf("download media: %w", wechat.ErrMediaExpired)
+}
+
+// refetchingMediaProvider is an expiredMediaProvider that can refetch media
+// by message.
+type refetchingMediaProvider struct {
+	expiredMediaProvider
+	refetchErr error
+	refetched  []string
+}
+
+func (p *refetchingMediaProvider) RefetchMedia(_ context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
+	p.refetched = append(p.refetched, msg.MsgID)
+	if p.refetchErr != nil {
+		return nil, "", p.refetchErr
+	}
+	return io.NopCloser(bytes.NewReader([]byte("fresh image"))), "image/png", nil
+}
+
+// withMediaProvider routes messages from wxid_bob like withDMRoom, but
+// through the wired message processor, downloading media from provider.
+func withMediaProvider(matrix *testMatrixClient, provider wechat.Provider) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		withDMRoom(cfg, db)
+		cfg.Provider = provider
+		cfg.Processor = &defaultMessageProcessor{
+			log:          slog.Default(),
+			matrixClient: matrix,
+			providers:    func(context.Context) (wechat.Provider, error) { return provider, nil },
+		}
+	}
+}
+
+func expiredImage() *wechat.Message {
+	return &wechat.Message{
+		MsgID: "img1", Type: wechat.MsgImage, FromUser: "wxid_bob", ToUser: "wxid_me",
+		MediaURL: "https://cdn.example.com/expired",
+	}
+}
+
+func TestEventRouter_OnMessage_ExpiredMediaPostsNotice(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, &expiredMediaProvider{newMockProvider("wxid_me", 2)}))
+	expectDMRoute(mock, 1)
+
+	if err := er.OnMessage(context.Background(), expiredImage()); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d events, want the expiry notice", len(matrix.sent))
+	}
+	sent := matrix.sent[0]
+	content := sent.content.(map[string]interface{})
+	if content["msgtype"] != "m.notice" || content["body"] != mediaExpiredNotice {
+		t.Fatalf("sent %v", content)
+	}
+	if sent.sender != "@wechat_wxid_bob:example.com" {
+		t.Fatalf("notice sent by %s, want the puppet", sent.sender)
+	}
+	if len(matrix.uploads) != 0 {
+		t.Fatalf("uploaded %d files", len(matrix.uploads))
+	}
+}
+
+func TestEventRouter_OnMessage_ExpiredMediaIsRefetched(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &refetchingMediaProvider{expiredMediaProvider: expiredMediaProvider{newMockProvider("wxid_me", 2)}}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, provider))
+	expectDMRoute(mock, 1)
+
+	if err := er.OnMessage(context.Background(), expiredImage()); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(provider.refetched) != 1 || provider.refetched[0] != "img1" {
+		t.Fatalf("refetched %v", provider.refetched)
+	}
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "fresh image" {
+		t.Fatalf("uploads %q", matrix.uploads)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d events", len(matrix.sent))
+	}
+	content := matrix.sent[0].content.(map[string]interface{})
+	if content["msgtype"] != "m.image" || content["url"] != "mxc://test/uploaded" {
+		t.Fatalf("sent %v", content)
+	}
+	if info, _ := content["info"].(map[string]interface{}); info["mimetype"] != "image/png" {
+		t.Fatalf("info %v", content["info"])
+	}
+}
+
+func TestEventRouter_OnMessage_RefetchFailurePostsNotice(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &refetchingMediaProvider{
+		expiredMediaProvider: expiredMediaProvider{newMockProvider("wxid_me", 2)},
+		refetchErr:           errors.New("message no longer on the server"),
+	}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, provider))
+	expectDMRoute(mock, 1)
+
+	if err := er.OnMessage(context.Background(), expiredImage()); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(provider.refetched) != 1 {
+		t.Fatalf("refetched %v", provider.refetched)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d events, want the expiry notice", len(matrix.sent))
+	}
+	if content := matrix.sent[0].content.(map[string]interface{}); content["body"] != mediaExpiredNotice {
+		t.Fatalf("sent %v", content)
+	}
+}
@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func (cp *CommandProcessor) cmdRename(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) < 2 {
+		ce.Reply("Usage: `%s rename <user> <name>`", cp.prefix)
+		return nil
+	}
+	if cp.router.memberNames == nil || cp.router.rooms == nil {
+		ce.Reply("Per-room names are not supported by this bridge.")
+		return nil
+	}
+	room, err := cp.router.rooms.GetByMatrixRoomID(ctx, ce.RoomID)
+	if err != nil {
+		return err
+	}
+	if room == nil || room.BridgeUser != ce.Sender {
+		ce.Reply("Use `%s rename` in one of your bridged WeChat rooms.", cp.prefix)
+		return nil
+	}
+
+	// The user is given as a puppet's Matrix ID or as a WeChat ID.
+	wechatID := ce.Args[0]
+	if strings.HasPrefix(wechatID, "@") {
+		wechatID = cp.router.puppets.matrixIDToWeChatID(wechatID)
+	}
+	puppet, err := cp.router.puppets.GetByWeChatID(ctx, wechatID)
+	if err != nil {
+		return err
+	}
+	if wechatID == "" || puppet == nil {
+		ce.Reply("%s is not a WeChat user known to the bridge.", ce.Args[0])
+		return nil
+	}
+
+	name := strings.Join(ce.Args[1:], " ")
+	if err := cp.router.memberNames.Set(ctx, room.MatrixRoomID, wechatID, name); err != nil {
+		return err
+	}
+	if err := cp.router.matrixClient.SetRoomMemberName(ctx, room.MatrixRoomID, puppet.MatrixUserID, name); err != nil {
+		return fmt.Errorf("set room member name: %w", err)
+	}
+	ce.Reply("%s is now shown as %q in this room.", wechatID, name)
+	return nil
+}
+
+// applyMemberNames re-applies the per-room names set with the rename command
+// to the puppets present in a room. Joins and global profile changes reset
+// a member's room display name, so this runs on every membership resync.
+func (er *EventRouter) applyMemberNames(ctx context.Context, roomID string, present map[string]bool) {
+	if er.memberNames == nil || er.matrixClient == nil {
+		return
+	}
+	names, err := er.memberNames.GetByRoom(ctx, roomID)
+	if err != nil {
+		er.log.Warn("failed to load room member names", "error", err, "room_id", roomID)
+		return
+	}
+	for wechatID, name := range names {
+		if !present[wechatID] {
+			continue
+		}
+		puppet, err := er.puppets.GetByWeChatID(ctx, wechatID)
+		if err != nil || puppet == nil {
+			continue
+		}
+		if err := er.matrixClient.SetRoomMemberName(ctx, roomID, puppet.MatrixUserID, name); err != nil {
+			er.log.Warn("failed to apply room member name", "error", err, "room_id", roomID, "user_id", wechatID)
+		}
+	}
+}
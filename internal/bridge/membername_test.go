@@ -0,0 +1,162 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+var testRoomMappingColumnNames = []string{
+	"wechat_chat_id", "matrix_room_id", "bridge_user", "is_group",
+	"name", "avatar_mxc", "topic", "encrypted", "name_set", "avatar_set", "created_at",
+}
+
+var testBridgeUserColumnNames = []string{
+	"matrix_user_id", "wechat_id", "provider_type", "login_state",
+	"management_room", "space_room", "last_login", "created_at",
+}
+
+// newTestDB returns a sqlmock database that is closed when the test ends.
+func newTestDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, mock
+}
+
+// newTestRouter returns an EventRouter on a sqlmock database, with a test
+// puppet manager, the default message processor and matrix as its Matrix
+// client. configure fills in the rest of the config, e.g. the stores the
+// test needs from db.
+func newTestRouter(t *testing.T, matrix *testMatrixClient, configure func(cfg *EventRouterConfig, db *sql.DB)) (*EventRouter, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := newTestDB(t)
+	cfg := EventRouterConfig{
+		Log:       slog.Default(),
+		Puppets:   newTestPuppetManager(),
+		Processor: &defaultMessageProcessor{},
+	}
+	if matrix != nil {
+		cfg.MatrixClient = matrix
+	}
+	if configure != nil {
+		configure(&cfg, db)
+	}
+	return NewEventRouter(cfg), mock
+}
+
+// withRoomStores gives a test router its room mapping and bridge user
+// stores, which routing a WeChat chat into its room needs.
+func withRoomStores(cfg *EventRouterConfig, db *sql.DB) {
+	cfg.Rooms = database.NewRoomMappingStore(db)
+	cfg.BridgeUsers = database.NewBridgeUserStore(db)
+}
+
+// expectBridgeUser expects the bridge user @user:test, logged in to WeChat
+// as wxid_me, to be looked up.
+func expectBridgeUser(mock sqlmock.Sqlmock, managementRoom string) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM bridge_user`)).
+		WillReturnRows(sqlmock.NewRows(testBridgeUserColumnNames).
+			AddRow("@user:test", "wxid_me", "padpro", int(wechat.LoginStateLoggedIn), managementRoom, "", now, now))
+}
+
+// expectRoomMapping expects the room of @user:test's chat chatID to be
+// looked up and found as roomID. Group rooms are named name.
+func expectRoomMapping(mock sqlmock.Sqlmock, chatID, roomID, name string) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs(chatID, "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow(chatID, roomID, "@user:test", strings.HasSuffix(chatID, "@chatroom"), name, "", "", false, name != "", false, time.Now()))
+}
+
+func TestCommandProcessor_RenameSetsRoomMemberName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!mgmt:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("123@chatroom", "!mgmt:test", "@user:test", true, "Team", "", "", false, true, false, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_member_name`)).
+		WithArgs("!mgmt:test", "wxid_alice", "Alice from work").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+	cp.router.memberNames = database.NewRoomMemberNameStore(db)
+	cp.router.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "xX_al_Xx", MatrixUserID: "@wechat_wxid_alice:example.com"}
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat rename @wechat_wxid_alice:example.com Alice from work"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got := matrix.memberNames["!mgmt:test/@wechat_wxid_alice:example.com"]; got != "Alice from work" {
+		t.Fatalf("room member name = %q, want the override", got)
+	}
+	if reply := lastReply(t, matrix); reply != `wxid_alice is now shown as "Alice from work" in this room.` {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_MemberNameSurvivesMembershipResync(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, func(cfg *EventRouterConfig, db *sql.DB) {
+		withRoomStores(cfg, db)
+		cfg.Log = testBridgeLogger()
+		cfg.GroupMembers = database.NewGroupMemberStore(db)
+		cfg.MemberNames = database.NewRoomMemberNameStore(db)
+	})
+	er.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "xX_al_Xx", MatrixUserID: "@wechat_wxid_alice:example.com"}
+	er.puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", Nickname: "Bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+
+	expectBridgeUser(mock, "!mgmt:test")
+	expectRoomMapping(mock, "123@chatroom", "!room:test", "Team")
+	// Alice left and rejoined, so she is not among the stored members.
+	expectStoredGroupMembers(mock, "wxid_bob")
+	for _, id := range []string{"wxid_alice", "wxid_bob"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WithArgs("123@chatroom", id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_id, displayname FROM room_member_name WHERE matrix_room_id = $1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_id", "displayname"}).
+			AddRow("wxid_alice", "Alice from work").
+			AddRow("wxid_carol", "Carol"))
+
+	err := er.OnGroupMemberUpdate(context.Background(), "123@chatroom", []*wechat.GroupMember{
+		{UserID: "wxid_alice", Nickname: "xX_al_Xx"},
+		{UserID: "wxid_bob", Nickname: "Bob"},
+	})
+	if err != nil {
+		t.Fatalf("OnGroupMemberUpdate: %v", err)
+	}
+	if got := matrix.memberNames["!room:test/@wechat_wxid_alice:example.com"]; got != "Alice from work" {
+		t.Fatalf("room member name after resync = %q, want the override", got)
+	}
+	// Overrides of users no longer in the group are left alone.
+	if len(matrix.memberNames) != 1 {
+		t.Fatalf("member names = %v, want only Alice's", matrix.memberNames)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
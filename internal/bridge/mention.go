@@ -0,0 +1,171 @@
+package bridge
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// WeChat writes an @-mention of everyone in a group (@所有人) as
+// wechatMentionAll in the text and notifyAllID in msg_source's at-user list.
+const (
+	wechatMentionAll = "@所有人"
+	notifyAllID      = "notify@all"
+)
+
+// matrixRoomMentionRE matches the @room mention in a Matrix message body.
+var matrixRoomMentionRE = regexp.MustCompile(`@room\b`)
+
+// atUserListRE extracts the comma-separated wxids a group message
+// @-mentions from its msg_source XML, e.g.
+// <atuserlist><![CDATA[,wxid_a,wxid_b]]></atuserlist>.
+var atUserListRE = regexp.MustCompile(`<atuserlist>(?:<!\[CDATA\[)?([^<\]]*)`)
+
+// mentionedWeChatIDs returns the wxids listed in a message's msg_source.
+func mentionedWeChatIDs(msg *wechat.Message) []string {
+	match := atUserListRE.FindStringSubmatch(msg.Extra["msg_source"])
+	if match == nil {
+		return nil
+	}
+	var ids []string
+	for _, id := range strings.Split(match[1], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// mentionsSelf reports whether a group message @-mentions the logged-in
+// account, either in msg_source's at-user list or, for providers that don't
+// supply one, as "@nickname" in the text.
+func mentionsSelf(msg *wechat.Message, self *wechat.ContactInfo) bool {
+	if self == nil || self.UserID == "" {
+		return false
+	}
+	if ids := mentionedWeChatIDs(msg); ids != nil {
+		for _, id := range ids {
+			if id == self.UserID {
+				return true
+			}
+		}
+		return false
+	}
+	if msg.Type != wechat.MsgText || self.Nickname == "" {
+		return false
+	}
+	mention := "@" + self.Nickname
+	for text := msg.Content; ; {
+		idx := strings.Index(text, mention)
+		if idx < 0 {
+			return false
+		}
+		// WeChat ends a mention with U+2005 (four-per-em space)
+		rest := text[idx+len(mention):]
+		if rest == "" || strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\u2005") {
+			return true
+		}
+		text = rest
+	}
+}
+
+// mentionsAll reports whether a group message @-mentions everyone in the
+// group. Only notifyAllID in the at-user list counts: anyone can type
+// @所有人, but WeChat lists notify@all only for owners and admins, whose
+// mention notifies the whole group.
+func mentionsAll(msg *wechat.Message) bool {
+	for _, id := range mentionedWeChatIDs(msg) {
+		if id == notifyAllID {
+			return true
+		}
+	}
+	return false
+}
+
+// addRoomMention sets the content's m.mentions.room so members' clients
+// notify them, and writes @所有人 as @room for clients that only look at the
+// body.
+func addRoomMention(content map[string]interface{}) {
+	mentions, _ := content["m.mentions"].(map[string]interface{})
+	if mentions == nil {
+		mentions = map[string]interface{}{}
+		content["m.mentions"] = mentions
+	}
+	mentions["room"] = true
+	for _, key := range []string{"body", "formatted_body"} {
+		if text, ok := content[key].(string); ok {
+			content[key] = strings.ReplaceAll(text, wechatMentionAll, "@room")
+		}
+	}
+}
+
+// mentionsRoom reports whether a Matrix message mentions the whole room.
+// Messages with m.mentions say so with its room flag; for clients without
+// m.mentions support, @room in the body counts.
+func mentionsRoom(content map[string]interface{}) bool {
+	if mentions, ok := content["m.mentions"].(map[string]interface{}); ok {
+		room, _ := mentions["room"].(bool)
+		return room
+	}
+	body, _ := content["body"].(string)
+	return matrixRoomMentionRE.MatchString(body)
+}
+
+// applyRoomMention turns an @room mention in a Matrix message to a group
+// into WeChat's @所有人, sent with notifyAllID in its at-user list by
+// providers that implement wechat.MentionSender. WeChat only notifies
+// everyone when the group owner or an admin sends it; from others it is
+// plain text. Edits are sent with their text unchanged and notify no one.
+func applyRoomMention(content map[string]interface{}, room *database.RoomMapping, action *WeChatSendAction) {
+	if !room.IsGroup || action.Type != wechat.MsgText || action.IsEdit || !mentionsRoom(content) {
+		return
+	}
+	action.MentionAll = true
+	if matrixRoomMentionRE.MatchString(action.Text) {
+		action.Text = matrixRoomMentionRE.ReplaceAllString(action.Text, wechatMentionAll)
+	} else {
+		action.Text = wechatMentionAll + " " + action.Text
+	}
+}
+
+// sendText sends one text message of action. The message holding the
+// @所有人 of a MentionAll action lists notifyAllID in its at-user list, when
+// the provider can send one.
+func (er *EventRouter) sendText(ctx context.Context, provider wechat.Provider, target, text string, action *WeChatSendAction) (string, error) {
+	if action.MentionAll && strings.Contains(text, wechatMentionAll) {
+		if sender, ok := provider.(wechat.MentionSender); ok {
+			return sender.SendTextMentions(ctx, target, text, []string{notifyAllID})
+		}
+	}
+	return provider.SendText(ctx, target, text)
+}
+
+// addUserMention adds userID to the content's m.mentions.user_ids so the
+// user's client highlights the event.
+func addUserMention(content map[string]interface{}, userID string) {
+	mentions, _ := content["m.mentions"].(map[string]interface{})
+	if mentions == nil {
+		mentions = map[string]interface{}{}
+		content["m.mentions"] = mentions
+	}
+	var userIDs []string
+	switch ids := mentions["user_ids"].(type) {
+	case []string:
+		userIDs = ids
+	case []interface{}:
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				userIDs = append(userIDs, s)
+			}
+		}
+	}
+	for _, id := range userIDs {
+		if id == userID {
+			return
+		}
+	}
+	mentions["user_ids"] = append(userIDs, userID)
+}
@@ -0,0 +1,173 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestMentionsSelf(t *testing.T) {
+	self := &wechat.ContactInfo{UserID: "wxid_me", Nickname: "Me"}
+	tests := []struct {
+		name string
+		msg  *wechat.Message
+		want bool
+	}{
+		{"at user list", &wechat.Message{Type: wechat.MsgText, Content: "@Someone hi",
+			Extra: map[string]string{"msg_source": "<msgsource><atuserlist><![CDATA[,wxid_a,wxid_me]]></atuserlist></msgsource>"}}, true},
+		{"at user list without self", &wechat.Message{Type: wechat.MsgText, Content: "@Me hi",
+			Extra: map[string]string{"msg_source": "<msgsource><atuserlist>wxid_a</atuserlist></msgsource>"}}, false},
+		{"nickname in text", &wechat.Message{Type: wechat.MsgText, Content: "hey @Me lunch?"}, true},
+		{"longer nickname", &wechat.Message{Type: wechat.MsgText, Content: "hey @Meg lunch?"}, false},
+		{"no mention", &wechat.Message{Type: wechat.MsgText, Content: "hello"}, false},
+	}
+	for _, tt := range tests {
+		if got := mentionsSelf(tt.msg, self); got != tt.want {
+			t.Errorf("%s: mentionsSelf = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMentionsAll(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *wechat.Message
+		want bool
+	}{
+		{"notify all in at user list", &wechat.Message{Type: wechat.MsgText, Content: "@所有人\u2005meeting at 3",
+			Extra: map[string]string{"msg_source": "<msgsource><atuserlist><![CDATA[notify@all]]></atuserlist></msgsource>"}}, true},
+		{"text only", &wechat.Message{Type: wechat.MsgText, Content: "@所有人 meeting at 3"}, false},
+		{"single mention", &wechat.Message{Type: wechat.MsgText, Content: "@Bob hi",
+			Extra: map[string]string{"msg_source": "<msgsource><atuserlist>wxid_bob</atuserlist></msgsource>"}}, false},
+	}
+	for _, tt := range tests {
+		if got := mentionsAll(tt.msg); got != tt.want {
+			t.Errorf("%s: mentionsAll = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddRoomMention(t *testing.T) {
+	content := map[string]interface{}{"msgtype": "m.text", "body": "@所有人 meeting at 3"}
+	addRoomMention(content)
+	if content["body"] != "@room meeting at 3" {
+		t.Fatalf("body = %q", content["body"])
+	}
+	if mentions, _ := content["m.mentions"].(map[string]interface{}); mentions["room"] != true {
+		t.Fatalf("m.mentions = %v, want room", content["m.mentions"])
+	}
+}
+
+func TestApplyRoomMention(t *testing.T) {
+	group := &database.RoomMapping{WeChatChatID: "123@chatroom", IsGroup: true}
+	tests := []struct {
+		name     string
+		content  map[string]interface{}
+		room     *database.RoomMapping
+		text     string
+		isEdit   bool
+		wantText string
+		wantAll  bool
+	}{
+		{"room pill in body", map[string]interface{}{"body": "@room meeting at 3"}, group,
+			"@room meeting at 3", false, "@所有人 meeting at 3", true},
+		{"m.mentions room without pill", map[string]interface{}{"body": "meeting at 3", "m.mentions": map[string]interface{}{"room": true}}, group,
+			"meeting at 3", false, "@所有人 meeting at 3", true},
+		{"m.mentions without room", map[string]interface{}{"body": "@room meeting at 3", "m.mentions": map[string]interface{}{}}, group,
+			"@room meeting at 3", false, "@room meeting at 3", false},
+		{"direct chat", map[string]interface{}{"body": "@room hi"}, &database.RoomMapping{WeChatChatID: "wxid_bob"},
+			"@room hi", false, "@room hi", false},
+		{"edit", map[string]interface{}{"body": "@room meeting at 4"}, group,
+			"@room meeting at 4", true, "@room meeting at 4", false},
+		{"roomy", map[string]interface{}{"body": "@roomy hi"}, group,
+			"@roomy hi", false, "@roomy hi", false},
+	}
+	for _, tt := range tests {
+		action := &WeChatSendAction{Type: wechat.MsgText, Text: tt.text, IsEdit: tt.isEdit}
+		applyRoomMention(tt.content, tt.room, action)
+		if action.Text != tt.wantText || action.MentionAll != tt.wantAll {
+			t.Errorf("%s: text = %q, all = %v; want %q, %v", tt.name, action.Text, action.MentionAll, tt.wantText, tt.wantAll)
+		}
+	}
+}
+
+// mentionProvider records the at-user lists of texts sent with mentions.
+type mentionProvider struct {
+	*mockProvider
+	atUsers [][]string
+}
+
+func (p *mentionProvider) SendTextMentions(ctx context.Context, groupID string, text string, userIDs []string) (string, error) {
+	p.atUsers = append(p.atUsers, userIDs)
+	return p.SendText(ctx, groupID, text)
+}
+
+func TestEventRouter_HandleMatrixMessage_RoomMentionNotifiesAll(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		room *database.RoomMapping
+		body string
+		want [][]string
+	}{
+		{"group @room", &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!group:test", IsGroup: true}, "@room meeting at 3", [][]string{{notifyAllID}}},
+		{"group without mention", &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!group:test", IsGroup: true}, "meeting at 3", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mentionProvider{mockProvider: newMockProvider("padpro", 2)}
+			er := NewEventRouter(EventRouterConfig{
+				Log:       testBridgeLogger(),
+				Puppets:   newTestPuppetManager(),
+				Processor: &defaultMessageProcessor{},
+				Provider:  provider,
+			})
+
+			err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+				ID:      "$event:test",
+				Type:    "m.room.message",
+				RoomID:  tt.room.MatrixRoomID,
+				Sender:  "@user:test",
+				Content: map[string]interface{}{"msgtype": "m.text", "body": tt.body},
+			}, tt.room)
+			if err != nil {
+				t.Fatalf("handleMatrixMessage: %v", err)
+			}
+			if len(provider.sentTexts) != 1 {
+				t.Fatalf("sent %v", provider.sentTexts)
+			}
+			if len(provider.atUsers) != len(tt.want) || (len(tt.want) > 0 && provider.atUsers[0][0] != tt.want[0][0]) {
+				t.Fatalf("at-user lists = %v, want %v", provider.atUsers, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventRouter_OnMessage_GroupSelfMentionHighlightsBridgeUser(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDMRoom)
+	expectBridgeUser(mock, "")
+	expectRoomMapping(mock, "123@chatroom", "!group:test", "")
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID:    "g1",
+		Type:     wechat.MsgText,
+		FromUser: "wxid_bob",
+		IsGroup:  true,
+		GroupID:  "123@chatroom",
+		Content:  "@wxid_me are you coming?",
+		Extra:    map[string]string{"msg_source": "<msgsource><atuserlist>wxid_me</atuserlist></msgsource>"},
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(matrix.sent))
+	}
+	content := matrix.sent[0].content.(map[string]interface{})
+	mentions, _ := content["m.mentions"].(map[string]interface{})
+	userIDs, _ := mentions["user_ids"].([]string)
+	if len(userIDs) != 1 || userIDs[0] != "@user:test" {
+		t.Fatalf("m.mentions = %v, want highlight for @user:test", content["m.mentions"])
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
 // Metrics collects bridge performance metrics for Prometheus exposition.
@@ -35,17 +37,56 @@ type Metrics struct {
 	reconnectAttempts  atomic.Int64
 	reconnectSuccesses atomic.Int64
 
+	// Duplicate delivery detection
+	dedupHits   atomic.Int64
+	dedupMisses atomic.Int64
+
+	// Groups above the large group threshold
+	largeGroups atomic.Int64
+
+	// Messages to WeChat waiting for the send rate limit
+	outgoingQueued atomic.Int64
+
+	// Homeserver requests answered with M_LIMIT_EXCEEDED
+	homeserverRateLimited atomic.Int64
+
+	// Provider WebSocket health
+	wsConnected  atomic.Int64 // open connections
+	wsReconnects atomic.Int64
+
 	// Gauges
 	activeUsers    atomic.Int64
 	connectedState atomic.Int64 // 1=connected, 0=disconnected
 	loginState     atomic.Int64 // maps to wechat.LoginState enum
+	activeTier     atomic.Int64 // tier of the active provider, 0=none
 
 	// Latency histograms (manual implementation, no external deps)
 	wechatToMatrixLatency *histogram
 	matrixToWechatLatency *histogram
 
-	// Per-type message counters
-	messagesByType sync.Map // map[string]*atomic.Int64
+	// Time Matrix to WeChat sends spend waiting on risk control, and the
+	// provider send itself, so a throttled account can be told apart from
+	// a slow network
+	riskControlDelay   *histogram
+	wechatSendDuration *histogram
+
+	// Send retries by direction, and how long retried sends stayed queued
+	sendRetries        sync.Map // map[string]*atomic.Int64
+	sendRetryExhausted sync.Map // map[string]*atomic.Int64
+	sendRetryQueueAge  *histogram
+
+	// Per-type message counters, keyed "direction:msgType"
+	messagesByType       sync.Map // map[string]*atomic.Int64
+	messagesFailedByType sync.Map // map[string]*atomic.Int64
+
+	// Provider switches by kind and (from, to) pair
+	providerSwitches sync.Map // map[providerSwitchKey]*atomic.Int64
+
+	// Messages sent to WeChat, keyed "provider:msgType"
+	outgoingByProvider sync.Map // map[string]*atomic.Int64
+	// Today's risk-control usage reported by each provider, keyed
+	// "provider:bridgeUser"
+	riskLimits sync.Map // map[string][]wechat.RiskLimit
 
 	startTime time.Time
 }
@@ -54,8 +95,11 @@ type Metrics struct {
 func NewMetrics() *Metrics {
 	return &Metrics{
 		startTime:             time.Now(),
-		wechatToMatrixLatency: newHistogram(defaultBuckets),
-		matrixToWechatLatency: newHistogram(defaultBuckets),
+		wechatToMatrixLatency: newHistogram(latencyBuckets),
+		matrixToWechatLatency: newHistogram(latencyBuckets),
+		riskControlDelay:      newHistogram(latencyBuckets),
+		wechatSendDuration:    newHistogram(latencyBuckets),
+		sendRetryQueueAge:     newHistogram(retryQueueAgeBuckets),
 	}
 }
 
@@ -84,6 +128,75 @@ func (m *Metrics) IncrMessagesByType(direction, msgType string) {
 	val.(*atomic.Int64).Add(1)
 }
 
+// IncrMessagesFailedByType increments the failure counter for a specific
+// message type label.
+func (m *Metrics) IncrMessagesFailedByType(direction, msgType string) {
+	val, _ := m.messagesFailedByType.LoadOrStore(direction+":"+msgType, &atomic.Int64{})
+	val.(*atomic.Int64).Add(1)
+}
+
+// providerSwitchKey labels a provider switch counter.
+type providerSwitchKey struct {
+	Kind string // "failover" or "promotion"
+	From string
+	To   string
+}
+
+// IncrProviderSwitch counts a switch of the active provider, so operators can
+// alert on flapping between a pair of providers.
+func (m *Metrics) IncrProviderSwitch(kind, from, to string) {
+	val, _ := m.providerSwitches.LoadOrStore(providerSwitchKey{Kind: kind, From: from, To: to}, &atomic.Int64{})
+	val.(*atomic.Int64).Add(1)
+}
+
+// IncrOutgoingByProvider counts a message of msgType sent to WeChat with
+// the named provider.
+func (m *Metrics) IncrOutgoingByProvider(provider, msgType string) {
+	val, _ := m.outgoingByProvider.LoadOrStore(provider+":"+msgType, &atomic.Int64{})
+	val.(*atomic.Int64).Add(1)
+}
+
+// SetRiskLimits records the latest risk-control usage of the named provider
+// of a bridge user. Multi-tenant bridges run a provider per bridge user;
+// bridgeUser is empty otherwise.
+func (m *Metrics) SetRiskLimits(provider, bridgeUser string, limits []wechat.RiskLimit) {
+	m.riskLimits.Store(provider+":"+bridgeUser, limits)
+}
+
+// IncrSendRetries counts one retry of a failed send in the given direction.
+func (m *Metrics) IncrSendRetries(direction string) {
+	val, _ := m.sendRetries.LoadOrStore(direction, &atomic.Int64{})
+	val.(*atomic.Int64).Add(1)
+}
+
+// IncrSendRetryExhausted counts a send dropped after its last retry failed.
+func (m *Metrics) IncrSendRetryExhausted(direction string) {
+	val, _ := m.sendRetryExhausted.LoadOrStore(direction, &atomic.Int64{})
+	val.(*atomic.Int64).Add(1)
+}
+
+// IncrDedupHits counts incoming messages dropped as duplicates, and
+// IncrDedupMisses those seen for the first time.
+func (m *Metrics) IncrDedupHits()   { m.dedupHits.Add(1) }
+func (m *Metrics) IncrDedupMisses() { m.dedupMisses.Add(1) }
+
+// IncrLargeGroups counts a group found to be above the large group threshold.
+func (m *Metrics) IncrLargeGroups() { m.largeGroups.Add(1) }
+
+// AddOutgoingQueued adjusts the number of messages to WeChat queued by the
+// send rate limit.
+func (m *Metrics) AddOutgoingQueued(delta int) { m.outgoingQueued.Add(int64(delta)) }
+
+// IncrHomeserverRateLimited counts a homeserver request that was rate
+// limited.
+func (m *Metrics) IncrHomeserverRateLimited() { m.homeserverRateLimited.Add(1) }
+
+// WebSocketConnected, WebSocketDisconnected and WebSocketReconnecting
+// implement wechat.ConnectionObserver.
+func (m *Metrics) WebSocketConnected()    { m.wsConnected.Add(1) }
+func (m *Metrics) WebSocketDisconnected() { m.wsConnected.Add(-1) }
+func (m *Metrics) WebSocketReconnecting() { m.wsReconnects.Add(1) }
+
 // --- Gauge setters ---
 
 func (m *Metrics) SetActiveUsers(n int64)    { m.activeUsers.Store(n) }
@@ -95,6 +208,7 @@ func (m *Metrics) SetConnected(connected bool) {
 	}
 }
 func (m *Metrics) SetLoginState(state int) { m.loginState.Store(int64(state)) }
+func (m *Metrics) SetActiveTier(tier int)  { m.activeTier.Store(int64(tier)) }
 
 // --- Latency observations ---
 
@@ -108,6 +222,22 @@ func (m *Metrics) ObserveMatrixToWeChatLatency(d time.Duration) {
 	m.matrixToWechatLatency.observe(d.Seconds())
 }
 
+// ObserveRiskControlDelay and ObserveWeChatSend implement
+// wechat.SendObserver.
+func (m *Metrics) ObserveRiskControlDelay(d time.Duration) {
+	m.riskControlDelay.observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveWeChatSend(d time.Duration) {
+	m.wechatSendDuration.observe(d.Seconds())
+}
+
+// ObserveSendRetryQueueAge records how long a retried send waited before it
+// was delivered or dropped.
+func (m *Metrics) ObserveSendRetryQueueAge(d time.Duration) {
+	m.sendRetryQueueAge.observe(d.Seconds())
+}
+
 // --- Health ---
 
 // HealthStatus returns a structured health status.
@@ -151,7 +281,8 @@ func (m *Metrics) writeMetrics(w http.ResponseWriter) {
 
 	// Connection state
 	writeGauge(w, "mautrix_wechat_connected", "Whether the bridge is connected to WeChat (1=yes, 0=no)", float64(m.connectedState.Load()))
-	writeGauge(w, "mautrix_wechat_login_state", "Current login state (0=logged_out, 1=qr_code, 2=confirming, 3=logged_in, 4=error)", float64(m.loginState.Load()))
+	writeGauge(w, "mautrix_wechat_login_state", "Current login state (0=logged_out, 1=qr_code, 2=confirming, 3=logged_in, 4=error, 5=banned)", float64(m.loginState.Load()))
+	writeGauge(w, "mautrix_wechat_active_provider_tier", "Tier of the active provider (0=none)", float64(m.activeTier.Load()))
 
 	// Message counters
 	writeCounter(w, "mautrix_wechat_messages_received_total", "Total messages received from WeChat", float64(m.messagesReceived.Load()))
@@ -179,27 +310,118 @@ func (m *Metrics) writeMetrics(w http.ResponseWriter) {
 	writeCounter(w, "mautrix_wechat_reconnect_attempts_total", "Total reconnection attempts", float64(m.reconnectAttempts.Load()))
 	writeCounter(w, "mautrix_wechat_reconnect_successes_total", "Total successful reconnections", float64(m.reconnectSuccesses.Load()))
 
+	// Duplicate delivery detection
+	writeCounter(w, "mautrix_wechat_dedup_hits_total", "Incoming messages dropped as duplicate deliveries", float64(m.dedupHits.Load()))
+	writeCounter(w, "mautrix_wechat_dedup_misses_total", "Incoming messages not seen recently", float64(m.dedupMisses.Load()))
+
+	// Large groups
+	writeCounter(w, "mautrix_wechat_large_groups_total", "Groups found with more members than the large group threshold", float64(m.largeGroups.Load()))
+
+	// Send rate limit
+	writeGauge(w, "mautrix_wechat_outgoing_queue_depth", "Messages to WeChat queued by the send rate limit", float64(m.outgoingQueued.Load()))
+
+	// Homeserver rate limiting
+	writeCounter(w, "mautrix_wechat_homeserver_rate_limited_total", "Homeserver requests rejected with M_LIMIT_EXCEEDED", float64(m.homeserverRateLimited.Load()))
+
+	// Provider WebSocket health
+	writeGauge(w, "mautrix_wechat_ws_connected", "Number of open provider WebSocket connections", float64(m.wsConnected.Load()))
+	writeCounter(w, "mautrix_wechat_ws_reconnects_total", "Total provider WebSocket reconnection attempts", float64(m.wsReconnects.Load()))
+
 	// Latency histograms
 	m.wechatToMatrixLatency.writePrometheus(w, "mautrix_wechat_wechat_to_matrix_latency_seconds", "Message bridging latency from WeChat to Matrix")
 	m.matrixToWechatLatency.writePrometheus(w, "mautrix_wechat_matrix_to_wechat_latency_seconds", "Message bridging latency from Matrix to WeChat")
+	m.riskControlDelay.writePrometheus(w, "mautrix_wechat_risk_control_delay_seconds", "Time sends to WeChat were delayed by risk control")
+	m.wechatSendDuration.writePrometheus(w, "mautrix_wechat_wechat_send_duration_seconds", "Time taken by the provider to send a message to WeChat, excluding risk control delay")
+
+	// Send retries
+	writeDirectionCounter(w, "mautrix_wechat_send_retries_total", "Retries of failed message sends by direction", &m.sendRetries)
+	writeDirectionCounter(w, "mautrix_wechat_send_retry_exhausted_total", "Message sends dropped after exhausting retries by direction", &m.sendRetryExhausted)
+	m.sendRetryQueueAge.writePrometheus(w, "mautrix_wechat_send_retry_queue_age_seconds", "Time retried sends waited before delivery or giving up")
 
 	// Per-type message counters
-	var typeKeys []string
-	m.messagesByType.Range(func(key, _ interface{}) bool {
-		typeKeys = append(typeKeys, key.(string))
+	writeTypeCounter(w, "mautrix_wechat_messages_by_type_total", "Messages by direction and type", &m.messagesByType)
+	writeTypeCounter(w, "mautrix_wechat_messages_failed_by_type_total", "Failed message deliveries by direction and type", &m.messagesFailedByType)
+
+	// Per-provider sends and risk-control usage
+	m.writeOutgoingByProvider(w)
+	m.writeRiskLimits(w)
+
+	// Provider switch counters
+	var switchKeys []providerSwitchKey
+	m.providerSwitches.Range(func(key, _ interface{}) bool {
+		switchKeys = append(switchKeys, key.(providerSwitchKey))
+		return true
+	})
+	sort.Slice(switchKeys, func(i, j int) bool {
+		a, b := switchKeys[i], switchKeys[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+
+	if len(switchKeys) > 0 {
+		fmt.Fprintf(w, "# HELP mautrix_wechat_provider_switches_total Active provider switches by kind and provider pair\n")
+		fmt.Fprintf(w, "# TYPE mautrix_wechat_provider_switches_total counter\n")
+		for _, key := range switchKeys {
+			val, _ := m.providerSwitches.Load(key)
+			fmt.Fprintf(w, "mautrix_wechat_provider_switches_total{kind=%q,from=%q,to=%q} %d\n", key.Kind, key.From, key.To, val.(*atomic.Int64).Load())
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (m *Metrics) writeOutgoingByProvider(w http.ResponseWriter) {
+	var keys []string
+	m.outgoingByProvider.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	const name = "mautrix_wechat_outgoing_messages_total"
+	fmt.Fprintf(w, "# HELP %s Messages sent to WeChat by provider and type\n", name)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, key := range keys {
+		val, _ := m.outgoingByProvider.Load(key)
+		provider, msgType := splitTypeKey(key)
+		fmt.Fprintf(w, "%s{provider=%q,msg_type=%q} %d\n", name, provider, msgType, val.(*atomic.Int64).Load())
+	}
+	fmt.Fprintln(w)
+}
+
+func (m *Metrics) writeRiskLimits(w http.ResponseWriter) {
+	var keys []string
+	m.riskLimits.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(string))
 		return true
 	})
-	sort.Strings(typeKeys)
-
-	if len(typeKeys) > 0 {
-		fmt.Fprintf(w, "# HELP mautrix_wechat_messages_by_type_total Messages by direction and type\n")
-		fmt.Fprintf(w, "# TYPE mautrix_wechat_messages_by_type_total counter\n")
-		for _, key := range typeKeys {
-			val, _ := m.messagesByType.Load(key)
-			count := val.(*atomic.Int64).Load()
-			// key format: "direction:msgType"
-			direction, msgType := splitTypeKey(key)
-			fmt.Fprintf(w, "mautrix_wechat_messages_by_type_total{direction=%q,msg_type=%q} %d\n", direction, msgType, count)
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	for _, metric := range []struct {
+		name, help string
+		value      func(wechat.RiskLimit) int
+	}{
+		{"mautrix_wechat_risk_control_used", "Operations counted against each daily risk-control limit today", func(l wechat.RiskLimit) int { return l.Used }},
+		{"mautrix_wechat_risk_control_limit", "Daily risk-control limits", func(l wechat.RiskLimit) int { return l.Limit }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
+		for _, key := range keys {
+			val, _ := m.riskLimits.Load(key)
+			provider, bridgeUser := splitTypeKey(key)
+			for _, l := range val.([]wechat.RiskLimit) {
+				fmt.Fprintf(w, "%s{provider=%q,bridge_user=%q,limit=%q} %d\n", metric.name, provider, bridgeUser, l.Name, metric.value(l))
+			}
 		}
 		fmt.Fprintln(w)
 	}
@@ -219,6 +441,52 @@ func writeGauge(w http.ResponseWriter, name, help string, value float64) {
 	fmt.Fprintf(w, "%s %g\n\n", name, value)
 }
 
+// writeDirectionCounter writes a counter labelled by direction. Nothing is
+// written until the first increment.
+func writeDirectionCounter(w http.ResponseWriter, name, help string, counters *sync.Map) {
+	var directions []string
+	counters.Range(func(key, _ interface{}) bool {
+		directions = append(directions, key.(string))
+		return true
+	})
+	if len(directions) == 0 {
+		return
+	}
+	sort.Strings(directions)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, direction := range directions {
+		val, _ := counters.Load(direction)
+		fmt.Fprintf(w, "%s{direction=%q} %d\n", name, direction, val.(*atomic.Int64).Load())
+	}
+	fmt.Fprintln(w)
+}
+
+// writeTypeCounter writes a counter labelled by direction and message type
+// from "direction:msgType" keys. Nothing is written until the first
+// increment.
+func writeTypeCounter(w http.ResponseWriter, name, help string, counters *sync.Map) {
+	var keys []string
+	counters.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, key := range keys {
+		val, _ := counters.Load(key)
+		direction, msgType := splitTypeKey(key)
+		fmt.Fprintf(w, "%s{direction=%q,msg_type=%q} %d\n", name, direction, msgType, val.(*atomic.Int64).Load())
+	}
+	fmt.Fprintln(w)
+}
+
 func splitTypeKey(key string) (string, string) {
 	for i, c := range key {
 		if c == ':' {
@@ -230,8 +498,12 @@ func splitTypeKey(key string) (string, string) {
 
 // --- Histogram (lightweight, no external deps) ---
 
-// Default latency buckets in seconds: 10ms, 25ms, 50ms, 100ms, 250ms, 500ms, 1s, 2.5s, 5s, 10s
-var defaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0}
+// Latency buckets in seconds: 10ms up to 30s. Risk control alone can delay a
+// send by several seconds, so the buckets reach well past 10s.
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 20.0, 30.0}
+
+// Retry queue age buckets in seconds: 0.5s up to 2 minutes
+var retryQueueAgeBuckets = []float64{0.5, 1.0, 2.5, 5.0, 10.0, 30.0, 60.0, 120.0}
 
 type histogram struct {
 	mu      sync.Mutex
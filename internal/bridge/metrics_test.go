@@ -1,12 +1,17 @@
 package bridge
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
 func TestMetrics_NewMetrics(t *testing.T) {
@@ -107,6 +112,63 @@ func TestMetrics_MessagesByType(t *testing.T) {
 	}
 }
 
+func TestMetrics_MessagesFailedByTypeExposition(t *testing.T) {
+	m := NewMetrics()
+	m.IncrMessagesByType("matrix_to_wechat", "voice")
+	m.IncrMessagesFailedByType("matrix_to_wechat", "voice")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+
+	for _, want := range []string{
+		`mautrix_wechat_messages_by_type_total{direction="matrix_to_wechat",msg_type="voice"} 1`,
+		`mautrix_wechat_messages_failed_by_type_total{direction="matrix_to_wechat",msg_type="voice"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s\n\nFull output:\n%s", want, text)
+		}
+	}
+}
+
+func TestEventRouter_OnMessage_CountsMessagesByType(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withDMRoom)
+	expectDMRoute(mock, 2)
+	er.metrics = NewMetrics()
+
+	if err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgText, FromUser: "wxid_bob", ToUser: "wxid_me", Content: "hello",
+	}); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	er.processor = nil
+	if err := er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "m2", Type: wechat.MsgVoice, FromUser: "wxid_bob", ToUser: "wxid_me",
+	}); err == nil {
+		t.Fatal("expected an error without a processor")
+	}
+
+	load := func(counters *sync.Map, key string) int64 {
+		if val, ok := counters.Load(key); ok {
+			return val.(*atomic.Int64).Load()
+		}
+		return 0
+	}
+	if got := load(&er.metrics.messagesByType, "wechat_to_matrix:text"); got != 1 {
+		t.Errorf("text received = %d, want 1", got)
+	}
+	if got := load(&er.metrics.messagesByType, "wechat_to_matrix:voice"); got != 1 {
+		t.Errorf("voice received = %d, want 1", got)
+	}
+	if got := load(&er.metrics.messagesFailedByType, "wechat_to_matrix:voice"); got != 1 {
+		t.Errorf("voice failed = %d, want 1", got)
+	}
+	if got := load(&er.metrics.messagesFailedByType, "wechat_to_matrix:text"); got != 0 {
+		t.Errorf("text failed = %d, want 0", got)
+	}
+}
+
 func TestMetrics_LatencyHistogram(t *testing.T) {
 	m := NewMetrics()
 
@@ -125,6 +187,32 @@ func TestMetrics_LatencyHistogram(t *testing.T) {
 	}
 }
 
+func TestMetrics_SendObserver(t *testing.T) {
+	m := NewMetrics()
+	var _ wechat.SendObserver = m
+
+	m.ObserveRiskControlDelay(15 * time.Second)
+	m.ObserveWeChatSend(80 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+
+	checks := []string{
+		`mautrix_wechat_risk_control_delay_seconds_bucket{le="10"} 0`,
+		`mautrix_wechat_risk_control_delay_seconds_bucket{le="20"} 1`,
+		`mautrix_wechat_risk_control_delay_seconds_count 1`,
+		`mautrix_wechat_wechat_send_duration_seconds_bucket{le="0.05"} 0`,
+		`mautrix_wechat_wechat_send_duration_seconds_bucket{le="0.1"} 1`,
+		`mautrix_wechat_matrix_to_wechat_latency_seconds_bucket{le="30"} 0`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(text, check) {
+			t.Errorf("missing %s\n\nFull output:\n%s", check, text)
+		}
+	}
+}
+
 func TestMetrics_HealthStatus(t *testing.T) {
 	m := NewMetrics()
 
@@ -161,6 +249,10 @@ func TestMetrics_PrometheusHandler(t *testing.T) {
 	m.SetActiveUsers(2)
 	m.ObserveWeChatToMatrixLatency(50 * time.Millisecond)
 	m.IncrMessagesByType("wechat_to_matrix", "text")
+	m.WebSocketConnected()
+	m.WebSocketConnected()
+	m.WebSocketDisconnected()
+	m.WebSocketReconnecting()
 
 	handler := m.Handler()
 	req := httptest.NewRequest("GET", "/metrics", nil)
@@ -195,6 +287,8 @@ func TestMetrics_PrometheusHandler(t *testing.T) {
 		"mautrix_wechat_wechat_to_matrix_latency_seconds_count 1",
 		"mautrix_wechat_messages_by_type_total",
 		"wechat_to_matrix",
+		"mautrix_wechat_ws_connected 1",
+		"mautrix_wechat_ws_reconnects_total 1",
 	}
 
 	for _, check := range checks {
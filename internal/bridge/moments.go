@@ -0,0 +1,292 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// momentsChatID is the chat ID the Moments room is mapped to. The @ keeps it
+// from clashing with a real WeChat ID.
+const momentsChatID = "sns@moments"
+
+// isMomentsChat reports whether chatID is the Moments feed and the feed is
+// bridged.
+func (er *EventRouter) isMomentsChat(chatID string) bool {
+	return er.momentsRoomName != "" && chatID == momentsChatID
+}
+
+// momentAfter reports whether entry was posted after the cursor's entry.
+// Entries posted at the same time are ordered by their numeric IDs.
+func momentAfter(entry *wechat.MomentEntry, cursor *database.MomentsCursor) bool {
+	if entry.Timestamp != cursor.LastTimestamp {
+		return entry.Timestamp > cursor.LastTimestamp
+	}
+	return compareMomentIDs(entry.MomentID, cursor.LastMomentID) > 0
+}
+
+// compareMomentIDs compares two decimal Moments IDs without parsing them,
+// as they may not fit an int64.
+func compareMomentIDs(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// SyncMoments posts the entries of a bridge user's Moments feed that are
+// newer than the last one posted to the Moments room, oldest first, each as
+// its author's puppet. The first sync only records where the feed stands so
+// the room doesn't start with the whole timeline. It returns the number of
+// entries posted.
+func (er *EventRouter) SyncMoments(ctx context.Context, provider wechat.Provider, bridgeUser string) (int, error) {
+	if er.momentsRoomName == "" || er.momentsCursors == nil {
+		return 0, nil
+	}
+	reader, ok := provider.(wechat.MomentsReader)
+	if !ok || !provider.Capabilities().MomentRead {
+		return 0, nil
+	}
+
+	entries, err := reader.GetMoments(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get moments: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Timestamp != entries[j].Timestamp {
+			return entries[i].Timestamp < entries[j].Timestamp
+		}
+		return compareMomentIDs(entries[i].MomentID, entries[j].MomentID) < 0
+	})
+
+	cursor, err := er.momentsCursors.Get(ctx, bridgeUser)
+	if err != nil {
+		return 0, err
+	}
+	if cursor == nil {
+		if len(entries) == 0 {
+			return 0, nil
+		}
+		newest := entries[len(entries)-1]
+		return 0, er.momentsCursors.Set(ctx, &database.MomentsCursor{
+			BridgeUser:    bridgeUser,
+			LastMomentID:  newest.MomentID,
+			LastTimestamp: newest.Timestamp,
+		})
+	}
+
+	posted := 0
+	var room *database.RoomMapping
+	for _, entry := range entries {
+		if !momentAfter(entry, cursor) {
+			continue
+		}
+		if room == nil {
+			if room, err = er.getOrCreateRoom(ctx, momentsChatID, false, bridgeUser); err != nil {
+				return posted, fmt.Errorf("get or create moments room: %w", err)
+			}
+		}
+		if err := er.postMoment(ctx, provider, room, entry); err != nil {
+			return posted, err
+		}
+
+		cursor = &database.MomentsCursor{
+			BridgeUser:    bridgeUser,
+			LastMomentID:  entry.MomentID,
+			LastTimestamp: entry.Timestamp,
+		}
+		if err := er.momentsCursors.Set(ctx, cursor); err != nil {
+			return posted, err
+		}
+		posted++
+	}
+	return posted, nil
+}
+
+// postMoment sends a Moments entry to the Moments room as its author: the
+// text, location and link as one formatted message, then each image.
+// Images that can't be fetched are skipped.
+func (er *EventRouter) postMoment(ctx context.Context, provider wechat.Provider, room *database.RoomMapping, entry *wechat.MomentEntry) error {
+	if er.matrixClient == nil {
+		return fmt.Errorf("matrixClient not configured")
+	}
+	puppet, err := er.puppets.GetOrCreate(ctx, &wechat.ContactInfo{
+		UserID:   entry.UserID,
+		Nickname: entry.Nickname,
+	})
+	if err != nil {
+		return fmt.Errorf("get moment author puppet: %w", err)
+	}
+	if err := er.matrixClient.InviteToRoom(ctx, room.MatrixRoomID, puppet.MatrixUserID); err != nil {
+		er.log.Debug("failed to invite puppet to moments room", "error", err, "room_id", room.MatrixRoomID)
+	}
+	if err := er.matrixClient.JoinRoom(ctx, puppet.MatrixUserID, room.MatrixRoomID); err != nil {
+		return fmt.Errorf("join puppet to moments room: %w", err)
+	}
+
+	if err := er.sendMomentEvent(ctx, room, puppet, momentContent(entry)); err != nil {
+		return err
+	}
+	for i, url := range entry.MediaURLs {
+		content, err := er.uploadMomentImage(ctx, provider, url, fmt.Sprintf("moment_%s_%d.jpg", entry.MomentID, i+1))
+		if err != nil {
+			er.log.Warn("failed to bridge moment image", "error", err, "moment_id", entry.MomentID, "url", url)
+			continue
+		}
+		if err := er.sendMomentEvent(ctx, room, puppet, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (er *EventRouter) sendMomentEvent(ctx context.Context, room *database.RoomMapping, puppet *Puppet, content map[string]interface{}) error {
+	eventType := "m.room.message"
+	encType, encrypted, err := er.crypto.Encrypt(ctx, room.MatrixRoomID, eventType, content)
+	if err != nil {
+		er.log.Warn("failed to encrypt event, sending unencrypted", "error", err, "room_id", room.MatrixRoomID)
+	} else {
+		eventType, content = encType, encrypted
+	}
+	if _, err := er.matrixClient.SendMessage(ctx, room.MatrixRoomID, puppet.MatrixUserID, eventType, content); err != nil {
+		return fmt.Errorf("send moment: %w", err)
+	}
+	return nil
+}
+
+// momentContent renders the text part of a Moments entry.
+func momentContent(entry *wechat.MomentEntry) map[string]interface{} {
+	var lines, htmlLines []string
+	if entry.Content != "" {
+		lines = append(lines, entry.Content)
+		htmlLines = append(htmlLines, strings.ReplaceAll(html.EscapeString(entry.Content), "\n", "<br/>"))
+	}
+	if loc := entry.Location; loc != nil && (loc.Poiname != "" || loc.Label != "") {
+		name := loc.Poiname
+		if name == "" {
+			name = loc.Label
+		}
+		lines = append(lines, "📍 "+name)
+		htmlLines = append(htmlLines, "📍 "+html.EscapeString(name))
+	}
+	if link := entry.LinkInfo; link != nil && link.URL != "" {
+		title := link.Title
+		if title == "" {
+			title = link.URL
+		}
+		lines = append(lines, fmt.Sprintf("🔗 %s: %s", title, link.URL))
+		htmlLines = append(htmlLines, fmt.Sprintf(`🔗 <a href="%s">%s</a>`, html.EscapeString(link.URL), html.EscapeString(title)))
+	}
+	if len(lines) == 0 {
+		lines = []string{fmt.Sprintf("[%d images]", len(entry.MediaURLs))}
+		htmlLines = lines
+	}
+
+	return map[string]interface{}{
+		"msgtype":        "m.text",
+		"body":           "📷 Moments\n" + strings.Join(lines, "\n"),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": "<p><b>📷 Moments</b></p><p>" + strings.Join(htmlLines, "<br/>") + "</p>",
+	}
+}
+
+// uploadMomentImage fetches an image of a Moments entry through the
+// provider and uploads it to Matrix.
+func (er *EventRouter) uploadMomentImage(ctx context.Context, provider wechat.Provider, url, fileName string) (map[string]interface{}, error) {
+	rc, mimeType, err := provider.DownloadMedia(ctx, &wechat.Message{Type: wechat.MsgImage, MediaURL: url})
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+
+	mxcURI, err := er.matrixClient.UploadMedia(ctx, data, mimeType, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("upload image: %w", err)
+	}
+	return map[string]interface{}{
+		"msgtype": "m.image",
+		"body":    fileName,
+		"url":     mxcURI,
+		"info": map[string]interface{}{
+			"mimetype": mimeType,
+			"size":     len(data),
+		},
+	}, nil
+}
+
+// MomentsLoop polls the Moments feed of every logged-in bridge user and
+// posts new entries until ctx is done.
+func (er *EventRouter) MomentsLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || er.momentsRoomName == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			er.syncAllMoments(ctx)
+		}
+	}
+}
+
+func (er *EventRouter) syncAllMoments(ctx context.Context) {
+	var users []*database.BridgeUser
+	if er.multiTenant {
+		if er.bridgeUsers == nil {
+			return
+		}
+		all, err := er.bridgeUsers.GetAll(ctx)
+		if err != nil {
+			er.log.Warn("failed to list bridge users for moments", "error", err)
+			return
+		}
+		for _, u := range all {
+			if u.LoginState == int(wechat.LoginStateLoggedIn) {
+				users = append(users, u)
+			}
+		}
+	} else {
+		// The single account belongs to the first logged-in user.
+		user, err := er.findBridgeUser(ctx)
+		if err != nil || user == nil {
+			er.log.Debug("skipping moments sync, no logged-in bridge user")
+			return
+		}
+		users = []*database.BridgeUser{user}
+	}
+
+	for _, user := range users {
+		userCtx := context.WithValue(ctx, bridgeUserKey, user.MatrixUserID)
+		provider, err := er.getProviderForUser(userCtx, user.MatrixUserID)
+		if err != nil || provider == nil {
+			er.log.Debug("skipping moments sync, no active provider", "user", user.MatrixUserID)
+			continue
+		}
+		posted, err := er.SyncMoments(userCtx, provider, user.MatrixUserID)
+		if err != nil {
+			er.log.Warn("moments sync failed", "error", err, "user", user.MatrixUserID)
+		}
+		if posted > 0 {
+			er.log.Info("posted new moments", "count", posted, "user", user.MatrixUserID)
+		}
+	}
+}
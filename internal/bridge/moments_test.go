@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// momentsProvider is a mockProvider that can read the Moments feed.
+type momentsProvider struct {
+	*mockProvider
+	moments []*wechat.MomentEntry
+}
+
+func (p *momentsProvider) GetMoments(_ context.Context) ([]*wechat.MomentEntry, error) {
+	return p.moments, nil
+}
+
+func (p *momentsProvider) DownloadMedia(_ context.Context, _ *wechat.Message) (io.ReadCloser, string, error) {
+	return io.NopCloser(bytes.NewReader([]byte("jpeg"))), "image/jpeg", nil
+}
+
+// newMomentsProvider returns a provider whose Moments feed can be read.
+func newMomentsProvider() *momentsProvider {
+	provider := &momentsProvider{mockProvider: newMockProvider("padpro", 2)}
+	provider.cfg = &wechat.ProviderConfig{Capabilities: map[string]bool{"moment_read": true}}
+	return provider
+}
+
+// withMoments posts provider's Moments by wxid_bob and wxid_carol into the
+// Moments room, with the room and cursor stores wired.
+func withMoments(provider *momentsProvider) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Provider = provider
+		cfg.Rooms = database.NewRoomMappingStore(db)
+		cfg.MomentsRoomName = "WeChat Moments"
+		cfg.MomentsCursors = database.NewMomentsCursorStore(db)
+		for _, id := range []string{"wxid_bob", "wxid_carol"} {
+			cfg.Puppets.puppets[id] = &Puppet{WeChatID: id, MatrixUserID: "@wechat_" + id + ":example.com"}
+		}
+	}
+}
+
+func expectMomentsCursor(mock sqlmock.Sqlmock, id string, ts int64) {
+	rows := sqlmock.NewRows([]string{"bridge_user", "last_moment_id", "last_timestamp"})
+	if id != "" {
+		rows.AddRow("@user:test", id, ts)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM moments_cursor WHERE bridge_user = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(rows)
+}
+
+func TestEventRouter_SyncMoments_FirstSyncOnlyRecordsCursor(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMomentsProvider()
+	er, mock := newTestRouter(t, matrix, withMoments(provider))
+	provider.moments = []*wechat.MomentEntry{
+		{MomentID: "200", UserID: "wxid_bob", Content: "newer", Timestamp: 2000},
+		{MomentID: "100", UserID: "wxid_bob", Content: "older", Timestamp: 1000},
+	}
+
+	expectMomentsCursor(mock, "", 0)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO moments_cursor`)).
+		WithArgs("@user:test", "200", int64(2000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	posted, err := er.SyncMoments(context.Background(), provider, "@user:test")
+	if err != nil {
+		t.Fatalf("SyncMoments: %v", err)
+	}
+	if posted != 0 || len(matrix.sent) != 0 {
+		t.Fatalf("posted = %d, sent = %d, want nothing posted on the first sync", posted, len(matrix.sent))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_SyncMoments_PostsNewEntriesAsAuthor(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMomentsProvider()
+	er, mock := newTestRouter(t, matrix, withMoments(provider))
+	provider.moments = []*wechat.MomentEntry{
+		{MomentID: "300", UserID: "wxid_carol", Nickname: "Carol", Content: "third", MediaURLs: []string{"http://img/1"}, Timestamp: 3000},
+		{MomentID: "200", UserID: "wxid_bob", Nickname: "Bob", Content: "second", Timestamp: 2000},
+		{MomentID: "100", UserID: "wxid_bob", Nickname: "Bob", Content: "already posted", Timestamp: 2000},
+	}
+
+	expectMomentsCursor(mock, "100", 2000)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs(momentsChatID, "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow(momentsChatID, "!moments:test", "@user:test", false, "WeChat Moments", "", "", false, true, false, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO moments_cursor`)).
+		WithArgs("@user:test", "200", int64(2000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO moments_cursor`)).
+		WithArgs("@user:test", "300", int64(3000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	posted, err := er.SyncMoments(context.Background(), provider, "@user:test")
+	if err != nil {
+		t.Fatalf("SyncMoments: %v", err)
+	}
+	if posted != 2 {
+		t.Fatalf("posted = %d, want 2", posted)
+	}
+	if len(matrix.sent) != 3 {
+		t.Fatalf("sent %d events, want 3", len(matrix.sent))
+	}
+
+	first := matrix.sent[0].content.(map[string]interface{})
+	if matrix.sent[0].sender != "@wechat_wxid_bob:example.com" || !strings.Contains(first["body"].(string), "second") {
+		t.Fatalf("first event = %+v, want Bob's entry", matrix.sent[0])
+	}
+	image := matrix.sent[2].content.(map[string]interface{})
+	if matrix.sent[2].sender != "@wechat_wxid_carol:example.com" || image["msgtype"] != "m.image" {
+		t.Fatalf("last event = %+v, want Carol's image", matrix.sent[2])
+	}
+	for _, sent := range matrix.sent {
+		if sent.roomID != "!moments:test" {
+			t.Fatalf("sent to %s, want the Moments room", sent.roomID)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCompareMomentIDs(t *testing.T) {
+	if compareMomentIDs("99", "100") >= 0 {
+		t.Error("expected 99 < 100")
+	}
+	if compareMomentIDs("13978312849127418212", "13978312849127418211") <= 0 {
+		t.Error("expected IDs beyond int64 to compare numerically")
+	}
+	if compareMomentIDs("42", "42") != 0 {
+		t.Error("expected equal IDs to compare equal")
+	}
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// setMessageState records the delivery state of a Matrix message sent to
+// WeChat. Failing to record it is logged and doesn't affect the send.
+func (er *EventRouter) setMessageState(ctx context.Context, evt *MatrixEvent, state string, sendErr error) {
+	if er.messageStates == nil {
+		return
+	}
+	errMsg := ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+	if err := er.messageStates.Set(ctx, evt.ID, evt.RoomID, state, errMsg); err != nil {
+		er.log.Warn("failed to record message state", "error", err, "event_id", evt.ID, "state", state)
+	}
+}
+
+func (cp *CommandProcessor) cmdMsgStatus(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) != 1 {
+		ce.Reply("Usage: `%s msg-status <event_id>`", cp.prefix)
+		return nil
+	}
+	if cp.router.messageStates == nil {
+		ce.Reply("Message delivery states are not tracked by this bridge.")
+		return nil
+	}
+	eventID := ce.Args[0]
+	state, err := cp.router.messageStates.Get(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if state != nil && cp.router.rooms != nil {
+		// Only show the states of messages in the user's own rooms.
+		room, err := cp.router.rooms.GetByMatrixRoomID(ctx, state.MatrixRoomID)
+		if err != nil {
+			return err
+		}
+		if room == nil || room.BridgeUser != ce.Sender {
+			state = nil
+		}
+	}
+	if state == nil {
+		ce.Reply("No message %s was sent to WeChat.", eventID)
+		return nil
+	}
+
+	reply := "Message " + eventID + " is " + state.State
+	if state.State == database.MessageStateFailed && state.Error != "" {
+		reply += ": " + state.Error
+	}
+	if (state.State == database.MessageStateSent || state.State == database.MessageStateDelivered) && cp.router.messages != nil {
+		mapping, err := cp.router.messages.GetByMatrixEventID(ctx, eventID)
+		if err == nil && mapping != nil {
+			reply += " (WeChat message " + mapping.WeChatMsgID + ")"
+		}
+	}
+	ce.Reply("%s, as of %s.", reply, state.UpdatedAt.UTC().Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func expectMessageState(mock sqlmock.Sqlmock, state, errMsg string) {
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_state`)).
+		WithArgs("$event:test", "!room:test", state, errMsg).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestEventRouter_HandleMatrixMessage_RecordsStates(t *testing.T) {
+	tests := []struct {
+		name    string
+		sendErr error
+		want    []string
+	}{
+		{"sent", nil, []string{database.MessageStateQueued, database.MessageStateSending, database.MessageStateSent}},
+		{"failed", &permanentSendError{errors.New("blocked")}, []string{database.MessageStateQueued, database.MessageStateSending, database.MessageStateFailed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+			for _, state := range tt.want {
+				errMsg := ""
+				if state == database.MessageStateFailed {
+					errMsg = "send wechat message: blocked"
+				}
+				expectMessageState(mock, state, errMsg)
+			}
+
+			provider := newMockProvider("padpro", 2)
+			provider.sendErr = tt.sendErr
+			er := NewEventRouter(EventRouterConfig{
+				Log:           slog.Default(),
+				Puppets:       newTestPuppetManager(),
+				Processor:     &defaultMessageProcessor{},
+				Provider:      provider,
+				MessageStates: database.NewMessageStateStore(db),
+			})
+			room := &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+			err = er.handleMatrixMessage(context.Background(), &MatrixEvent{
+				ID:      "$event:test",
+				Type:    "m.room.message",
+				RoomID:  room.MatrixRoomID,
+				Sender:  "@user:test",
+				Content: map[string]interface{}{"msgtype": "m.text", "body": "hello"},
+			}, room)
+			if (err != nil) != (tt.sendErr != nil) {
+				t.Fatalf("handleMatrixMessage error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestEventRouter_OnSendAck_RecordsDelivered(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:           slog.Default(),
+		Puppets:       newTestPuppetManager(),
+		Processor:     &defaultMessageProcessor{},
+		Provider:      newMockProvider("padpro", 2),
+		Messages:      database.NewMessageMappingStore(db),
+		MessageStates: database.NewMessageStateStore(db),
+	})
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE wechat_msg_id = $1 ORDER BY created_at DESC LIMIT 1`)).
+		WithArgs("msg_padpro").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg_padpro", "$event:test", "!room:test", "@user:test", 1, now, now, "hello"))
+	expectMessageState(mock, database.MessageStateDelivered, "")
+
+	if err := er.OnSendAck(context.Background(), "msg_padpro"); err != nil {
+		t.Fatalf("OnSendAck: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCommandProcessor_MsgStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_state WHERE matrix_event_id = $1`)).
+		WithArgs("$event:test").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id", "matrix_room_id", "state", "error", "updated_at"}).
+			AddRow("$event:test", "!room:test", database.MessageStateDelivered, "", updated))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!room:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("wxid_chat", "!room:test", "@user:test", false, "Chat", "", "", false, true, false, updated))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs("$event:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$event:test", "!room:test", "@user:test", 1, updated, updated, "hello"))
+
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+	cp.router.messages = database.NewMessageMappingStore(db)
+	cp.router.messageStates = database.NewMessageStateStore(db)
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat msg-status $event:test"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	want := "Message $event:test is delivered (WeChat message msg1), as of 2024-05-01T12:00:00Z."
+	if reply := lastReply(t, matrix); reply != want {
+		t.Fatalf("reply = %q, want %q", reply, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
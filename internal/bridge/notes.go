@@ -0,0 +1,20 @@
+package bridge
+
+import "github.com/n42/mautrix-wechat/pkg/wechat"
+
+// fileHelperID is WeChat's File Transfer (文件传输助手) chat, which the
+// account uses to send notes and files to itself.
+const fileHelperID = "filehelper"
+
+// isNotesChat reports whether chatID is the notes chat and notes get their
+// own room.
+func (er *EventRouter) isNotesChat(chatID string) bool {
+	return er.notesRoomName != "" && chatID == fileHelperID
+}
+
+// isNotesMessage reports whether msg belongs to the notes chat. Providers
+// report notes as sent to filehelper or, for files sent from another
+// device, as sent by it; either way the note is the user's own.
+func (er *EventRouter) isNotesMessage(msg *wechat.Message) bool {
+	return !msg.IsGroup && (er.isNotesChat(msg.FromUser) || er.isNotesChat(msg.ToUser))
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestEventRouter_OnMessage_FileHelperGoesToNotesRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	bridgeUserRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(testBridgeUserColumnNames).AddRow("@user:test", "wxid_me", "padpro", int(wechat.LoginStateLoggedIn), "", "", now, now)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM bridge_user`)).WillReturnRows(bridgeUserRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2`)).
+		WithArgs("filehelper", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WithArgs("filehelper", "!room:test", "@user:test", false, "WeChat Notes", "", "", false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM bridge_user WHERE matrix_user_id = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(testBridgeUserColumnNames))
+
+	pm := newTestPuppetManager()
+	pm.puppets["filehelper"] = &Puppet{WeChatID: "filehelper", MatrixUserID: "@wechat_filehelper:example.com"}
+
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:           slog.Default(),
+		Puppets:       pm,
+		Processor:     &defaultMessageProcessor{},
+		Provider:      newMockProvider("wxid_me", 2),
+		Rooms:         database.NewRoomMappingStore(db),
+		BridgeUsers:   database.NewBridgeUserStore(db),
+		MatrixClient:  matrix,
+		DoublePuppet:  NewDoublePuppetManager(slog.Default(), nil, &fakeSharedSecretLoginer{}, "secret"),
+		NotesRoomName: "WeChat Notes",
+	})
+
+	// A note sent from another device arrives from filehelper itself.
+	err = er.OnMessage(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgText, FromUser: "filehelper", ToUser: "wxid_me", Content: "buy milk",
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+
+	if len(matrix.sent) != 0 {
+		t.Fatalf("note was sent via a puppet: %+v", matrix.sent)
+	}
+	if len(matrix.sentAs) != 1 || matrix.sentAs[0].sender != "@user:test" || matrix.sentAs[0].roomID != "!room:test" {
+		t.Fatalf("sentAs = %+v, want the note as @user:test in the notes room", matrix.sentAs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// maxOutgoingQuoteLength caps the quoted text of a reply sent to WeChat, in
+// runes. WeChat clients only show the start of a quote anyway.
+const maxOutgoingQuoteLength = 100
+
+// wechatQuoteSeparator is the line WeChat clients put between a quote and
+// the reply when a quote is copied as text.
+const wechatQuoteSeparator = "- - - - - - - - - - - - - - -"
+
+// setOutgoingQuote fills in the quote of a Matrix reply from the mapping of
+// the replied-to message. The Matrix reply fallback is dropped from the text
+// since the quote replaces it.
+func (er *EventRouter) setOutgoingQuote(ctx context.Context, room *database.RoomMapping, replyTo *database.MessageMapping, action *WeChatSendAction) {
+	if action.Type != wechat.MsgText || action.IsEdit {
+		return
+	}
+	quoted := replyTo.Body
+	if desc := quotedMediaDescription(wechat.MsgType(replyTo.MsgType)); desc != "" {
+		quoted = "[" + desc + "]"
+	}
+	if quoted == "" {
+		return
+	}
+	if runes := []rune(quoted); len(runes) > maxOutgoingQuoteLength {
+		quoted = string(runes[:maxOutgoingQuoteLength]) + "…"
+	}
+
+	action.QuoteAuthor = er.quoteAuthorName(ctx, room, replyTo.Sender)
+	action.QuoteText = quoted
+	action.Text = stripReplyFallback(action.Text)
+}
+
+// quoteAuthorName returns the name WeChat users know the sender of a mapped
+// message by. sender is a WeChat ID for messages from WeChat and a Matrix
+// user ID for messages sent from Matrix.
+func (er *EventRouter) quoteAuthorName(ctx context.Context, room *database.RoomMapping, sender string) string {
+	wechatID := sender
+	if strings.HasPrefix(sender, "@") {
+		wechatID = ""
+		if er.puppets != nil {
+			wechatID = er.puppets.matrixIDToWeChatID(sender)
+		}
+		// The bridge user's own messages went out from their WeChat account
+		if wechatID == "" && sender == room.BridgeUser && er.bridgeUsers != nil {
+			if user, err := er.bridgeUsers.GetByMatrixID(ctx, sender); err == nil && user != nil {
+				wechatID = user.WeChatID
+			}
+		}
+		if wechatID == "" {
+			return matrixLocalpart(sender)
+		}
+	}
+
+	if room.IsGroup && er.groupMembers != nil {
+		members, err := er.groupMembers.GetByGroup(ctx, room.WeChatChatID)
+		if err != nil {
+			er.log.Debug("failed to look up group members for quote", "error", err, "group_id", room.WeChatChatID)
+		}
+		for _, m := range members {
+			if m.WeChatID == wechatID && m.DisplayName != "" {
+				return m.DisplayName
+			}
+		}
+	}
+	if er.puppets != nil {
+		if p, err := er.puppets.GetByWeChatID(ctx, wechatID); err == nil && p != nil && p.Nickname != "" {
+			return p.Nickname
+		}
+	}
+	return wechatID
+}
+
+// formatWeChatQuote renders a reply the way WeChat shows a copied quote.
+func formatWeChatQuote(author, quoted, text string) string {
+	return fmt.Sprintf("「%s：%s」\n%s\n%s", author, quoted, wechatQuoteSeparator, text)
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withReplies sends through provider with the message store wired and
+// wxid_alice known as Alice.
+func withReplies(provider *mockProvider) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Provider = provider
+		cfg.Messages = database.NewMessageMappingStore(db)
+		cfg.Puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice"}
+	}
+}
+
+// expectQuotedMessage expects the replied-to $orig:test, a msgType message
+// from sender, to be looked up and the reply to be mapped.
+func expectQuotedMessage(mock sqlmock.Sqlmock, sender string, msgType wechat.MsgType, body string) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
+		WithArgs("$orig:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg_orig", "$orig:test", "!room:test", sender, int(msgType), now, now, body))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func newReplyEvent(body string) *MatrixEvent {
+	return &MatrixEvent{
+		ID:     "$reply:test",
+		Type:   "m.room.message",
+		RoomID: "!room:test",
+		Sender: "@user:test",
+		Content: map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    body,
+			"m.relates_to": map[string]interface{}{
+				"m.in_reply_to": map[string]interface{}{"event_id": "$orig:test"},
+			},
+		},
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_ReplyQuotesAuthorName(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er, mock := newTestRouter(t, nil, withReplies(provider))
+	expectQuotedMessage(mock, "wxid_alice", wechat.MsgText, "dinner at 7?")
+	room := &database.RoomMapping{WeChatChatID: "wxid_alice", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	evt := newReplyEvent("> <@wechat_wxid_alice:test> dinner at 7?\n\n7 works")
+	if err := er.handleMatrixMessage(context.Background(), evt, room); err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+	want := "「Alice：dinner at 7?」\n" + wechatQuoteSeparator + "\n7 works"
+	if len(provider.sentTexts) != 1 || provider.sentTexts[0] != want {
+		t.Fatalf("sent %q, want %q", provider.sentTexts, want)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_ReplyQuotesMediaAndUnknownSender(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er, mock := newTestRouter(t, nil, withReplies(provider))
+	expectQuotedMessage(mock, "wxid_carol", wechat.MsgImage, "")
+	room := &database.RoomMapping{WeChatChatID: "wxid_carol", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixMessage(context.Background(), newReplyEvent("nice"), room); err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+	want := "「wxid_carol：[an image]」\n" + wechatQuoteSeparator + "\nnice"
+	if len(provider.sentTexts) != 1 || provider.sentTexts[0] != want {
+		t.Fatalf("sent %q, want %q", provider.sentTexts, want)
+	}
+}
+
+func TestEventRouter_QuoteAuthorName_GroupMemberAndMatrixUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT group_id, wechat_id, display_name`).
+		WithArgs("123@chatroom").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at",
+		}).AddRow("123@chatroom", "wxid_alice", "Alice in group", false, false, nil))
+
+	pm := newTestPuppetManager()
+	pm.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice"}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      pm,
+		GroupMembers: database.NewGroupMemberStore(db),
+	})
+	room := &database.RoomMapping{WeChatChatID: "123@chatroom", IsGroup: true, BridgeUser: "@user:test"}
+
+	if name := er.quoteAuthorName(context.Background(), room, "wxid_alice"); name != "Alice in group" {
+		t.Fatalf("group member name = %q", name)
+	}
+	if name := er.quoteAuthorName(context.Background(), room, "@bob:example.com"); name != "bob" {
+		t.Fatalf("matrix user name = %q", name)
+	}
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// patReactionKey is the reaction a pat becomes with bridge.pat_as_reaction.
+const patReactionKey = "👋"
+
+// patEmoteRE matches an outgoing "pat @user" emote and captures the target.
+var patEmoteRE = regexp.MustCompile(`^(?i)pat\s+(.+?)\s*$`)
+
+type patXML struct {
+	Type string `xml:"type,attr"`
+	Pat  struct {
+		FromUsername   string `xml:"fromusername"`
+		PattedUsername string `xml:"pattedusername"`
+	} `xml:"pat"`
+}
+
+// parsePat returns who patted whom for a pat (拍一拍) system message, or
+// empty strings for any other message.
+func parsePat(msg *wechat.Message) (patter, patted string) {
+	if msg.Type != wechat.MsgSystem {
+		return "", ""
+	}
+	// Group system messages may carry a "chatroom:\n" prefix
+	raw := msg.Content
+	start := strings.Index(raw, "<sysmsg")
+	if start < 0 {
+		return "", ""
+	}
+
+	var parsed patXML
+	if err := xml.Unmarshal([]byte(raw[start:]), &parsed); err != nil || parsed.Type != "pat" {
+		return "", ""
+	}
+	return parsed.Pat.FromUsername, parsed.Pat.PattedUsername
+}
+
+// bridgePatAsReaction reacts with patReactionKey, as the patter, to the
+// latest message of the patted user in the room. It reports false when the
+// message is not a pat or there is nothing to react to, so that the pat is
+// bridged as a message instead.
+func (er *EventRouter) bridgePatAsReaction(ctx context.Context, msg *wechat.Message, room *database.RoomMapping, bridgeUser *database.BridgeUser) bool {
+	patter, patted := parsePat(msg)
+	if patter == "" || patted == "" || er.messages == nil || er.matrixClient == nil {
+		return false
+	}
+	// Pats from the user's own phone have no puppet to react as
+	if patter == bridgeUser.WeChatID {
+		return false
+	}
+
+	target, err := er.messages.GetLastBySender(ctx, room.MatrixRoomID, patted)
+	if err == nil && target == nil && patted == bridgeUser.WeChatID {
+		// Messages sent from Matrix are stored under the Matrix user
+		target, err = er.messages.GetLastBySender(ctx, room.MatrixRoomID, bridgeUser.MatrixUserID)
+	}
+	if err != nil {
+		er.log.Warn("failed to find patted user's last message", "error", err, "patted", patted)
+		return false
+	}
+	if target == nil {
+		return false
+	}
+
+	patterPuppet, err := er.puppets.GetOrCreate(ctx, &wechat.ContactInfo{
+		UserID:   patter,
+		Nickname: patter,
+	})
+	if err != nil {
+		er.log.Warn("failed to get puppet for pat", "error", err, "patter", patter)
+		return false
+	}
+	if _, err := er.matrixClient.SendReaction(ctx, room.MatrixRoomID, patterPuppet.MatrixUserID, target.MatrixEventID, patReactionKey); err != nil {
+		er.log.Warn("failed to send pat reaction", "error", err, "room_id", room.MatrixRoomID)
+		return false
+	}
+	return true
+}
+
+// patTarget returns the Matrix user a "pat @user" emote is aimed at, or ""
+// if the emote isn't a pat. The target is the first user the emote
+// mentions (a pill), otherwise a Matrix user ID in the plain body.
+func patTarget(content map[string]interface{}) string {
+	body, _ := content["body"].(string)
+	match := patEmoteRE.FindStringSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	if mentions, ok := content["m.mentions"].(map[string]interface{}); ok {
+		if userIDs, ok := mentions["user_ids"].([]interface{}); ok && len(userIDs) > 0 {
+			userID, _ := userIDs[0].(string)
+			return userID
+		}
+	}
+	if strings.HasPrefix(match[1], "@") && strings.Contains(match[1], ":") {
+		return match[1]
+	}
+	return ""
+}
+
+// resolvePat resolves the Matrix user a pat action is aimed at to the
+// WeChat user it puppets. Pats of users who aren't puppets go out as the
+// emote text.
+func (er *EventRouter) resolvePat(action *WeChatSendAction) {
+	if action.Type != wechat.MsgPat {
+		return
+	}
+	var wechatID string
+	if er.puppets != nil {
+		wechatID = er.puppets.matrixIDToWeChatID(action.PatUser)
+	}
+	if wechatID == "" {
+		action.Type = wechat.MsgText
+		action.PatUser = ""
+		return
+	}
+	action.PatUser = wechatID
+}
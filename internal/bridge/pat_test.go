@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const testPatXML = `<sysmsg type="pat"><pat><fromusername>wxid_bob</fromusername><chatusername>wxid_me</chatusername><pattedusername>wxid_me</pattedusername><template><![CDATA["${wxid_bob}" 拍了拍我]]></template></pat></sysmsg>`
+
+func TestParsePat(t *testing.T) {
+	patter, patted := parsePat(&wechat.Message{Type: wechat.MsgSystem, Content: "123@chatroom:\n" + testPatXML})
+	if patter != "wxid_bob" || patted != "wxid_me" {
+		t.Fatalf("parsePat = %q, %q", patter, patted)
+	}
+	if patter, _ := parsePat(&wechat.Message{Type: wechat.MsgSystem, Content: `<sysmsg type="revokemsg"></sysmsg>`}); patter != "" {
+		t.Fatalf("revoke parsed as pat from %q", patter)
+	}
+	if patter, _ := parsePat(&wechat.Message{Type: wechat.MsgText, Content: testPatXML}); patter != "" {
+		t.Fatalf("text message parsed as pat from %q", patter)
+	}
+}
+
+func TestEventRouter_OnMessage_PatAsReaction(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, func(cfg *EventRouterConfig, db *sql.DB) {
+		withDMRoom(cfg, db)
+		cfg.Messages = database.NewMessageMappingStore(db)
+	})
+	expectDMRoute(mock, 1)
+	er.patAsReaction = true
+
+	now := time.Now()
+	lastBySender := regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE matrix_room_id = $1 AND sender = $2 ORDER BY timestamp DESC LIMIT 1`)
+	mock.ExpectQuery(lastBySender).
+		WithArgs("!dm:test", "wxid_me").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames))
+	mock.ExpectQuery(lastBySender).
+		WithArgs("!dm:test", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg_1", "$mine:test", "!dm:test", "@user:test", int(wechat.MsgText), now, now, "hi"))
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		Type: wechat.MsgSystem, FromUser: "wxid_bob", ToUser: "wxid_me", Content: testPatXML,
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+
+	if len(matrix.sent) != 0 {
+		t.Fatalf("pat was also sent as a message: %+v", matrix.sent)
+	}
+	want := testReaction{roomID: "!dm:test", sender: "@wechat_wxid_bob:example.com", eventID: "$mine:test", key: patReactionKey}
+	if len(matrix.reactions) != 1 || matrix.reactions[0] != want {
+		t.Fatalf("reactions = %+v, want %+v", matrix.reactions, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnMessage_PatWithoutTargetSentAsMessage(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, func(cfg *EventRouterConfig, db *sql.DB) {
+		withDMRoom(cfg, db)
+		cfg.Messages = database.NewMessageMappingStore(db)
+	})
+	expectDMRoute(mock, 1)
+	er.patAsReaction = true
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_mapping WHERE matrix_room_id = $1 AND sender = $2`)).
+		WithArgs("!dm:test", "wxid_me").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_mapping WHERE matrix_room_id = $1 AND sender = $2`)).
+		WithArgs("!dm:test", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := er.OnMessage(context.Background(), &wechat.Message{
+		Type: wechat.MsgSystem, FromUser: "wxid_bob", ToUser: "wxid_me", Content: testPatXML,
+	})
+	if err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.reactions) != 0 || len(matrix.sent) != 1 {
+		t.Fatalf("reactions = %+v, sent = %d; want the pat sent as a message", matrix.reactions, len(matrix.sent))
+	}
+}
@@ -0,0 +1,184 @@
+package bridge
+
+import (
+	"context"
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// appMsgTypeTransfer and appMsgTypeRedPacket are the <appmsg><type> WeChat
+// uses for money transfers (转账) and red packets (红包).
+const (
+	appMsgTypeTransfer  = 2000
+	appMsgTypeRedPacket = 2001
+)
+
+// Transfer <paysubtype> values for a transfer that was accepted or returned.
+// Other values announce a new transfer.
+const (
+	transferAccepted = 3
+	transferReturned = 4
+)
+
+// Payment request handling for bridge.message_handling.payment_requests.
+const (
+	PaymentRequestsNotice = "notice"
+	PaymentRequestsIgnore = "ignore"
+)
+
+// payment describes a transfer, red packet or payment request. None can be
+// paid or claimed from Matrix, so the bridge only tells the room about it.
+type payment struct {
+	RedPacket bool
+	Request   bool   // a payment request (收款), e.g. a group collection
+	Amount    string // e.g. "￥50.00", transfers and requests only
+	Memo      string
+	SubType   int // transfers only, see transferAccepted
+}
+
+type paymentXML struct {
+	AppMsg struct {
+		Type  int    `xml:"type"`
+		Des   string `xml:"des"`
+		WCPay struct {
+			PaySubType    int    `xml:"paysubtype"`
+			FeeDesc       string `xml:"feedesc"`
+			PayMemo       string `xml:"pay_memo"`
+			SenderTitle   string `xml:"sendertitle"`
+			ReceiverTitle string `xml:"receivertitle"`
+			// Present only on payment requests
+			NewAA *struct{} `xml:"newaa"`
+		} `xml:"wcpayinfo"`
+	} `xml:"appmsg"`
+}
+
+// paymentAmountRE finds an amount such as "¥25.00" in a description.
+var paymentAmountRE = regexp.MustCompile(`[¥￥]\s*\d+(?:\.\d+)?`)
+
+// parsePayment detects transfers (appmsg type 2000) and red packets (appmsg
+// type 2001). Providers deliver them as link messages or, lacking a better
+// type, under the raw appmsg type, so the type of msg isn't checked. Returns
+// nil for any other message.
+func parsePayment(msg *wechat.Message) *payment {
+	raw := msg.Extra["xml"]
+	if raw == "" {
+		raw = msg.Content
+	}
+	if !strings.Contains(raw, "<wcpayinfo") {
+		return nil
+	}
+
+	var parsed paymentXML
+	if err := xml.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil
+	}
+	wcpay := parsed.AppMsg.WCPay
+	switch parsed.AppMsg.Type {
+	case appMsgTypeTransfer:
+		return &payment{
+			Amount:  strings.TrimSpace(wcpay.FeeDesc),
+			Memo:    strings.TrimSpace(wcpay.PayMemo),
+			SubType: wcpay.PaySubType,
+		}
+	case appMsgTypeRedPacket:
+		// Payment requests share the red packet type but carry <newaa>
+		if wcpay.NewAA != nil {
+			amount := strings.TrimSpace(wcpay.FeeDesc)
+			if amount == "" {
+				amount = strings.ReplaceAll(paymentAmountRE.FindString(parsed.AppMsg.Des), " ", "")
+			}
+			return &payment{
+				Request: true,
+				Amount:  amount,
+				Memo:    strings.TrimSpace(wcpay.ReceiverTitle),
+			}
+		}
+		memo := strings.TrimSpace(wcpay.ReceiverTitle)
+		if memo == "" {
+			memo = strings.TrimSpace(wcpay.SenderTitle)
+		}
+		return &payment{RedPacket: true, Memo: memo}
+	}
+	return nil
+}
+
+func (p *defaultMessageProcessor) paymentToMatrix(pay *payment) *MatrixEventContent {
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content: map[string]interface{}{
+			"msgtype": "m.notice",
+			"body":    formatPayment(pay),
+		},
+	}
+}
+
+// paymentRequestToMatrix renders a payment request as a notice naming the
+// requester, or returns nil when payment requests are ignored.
+func (er *EventRouter) paymentRequestToMatrix(ctx context.Context, msg *wechat.Message, pay *payment) *MatrixEventContent {
+	if er.paymentRequests == PaymentRequestsIgnore {
+		return nil
+	}
+	name := msg.FromUser
+	if puppet, err := er.puppets.GetByWeChatID(ctx, msg.FromUser); err == nil && puppet != nil && puppet.Nickname != "" {
+		name = puppet.Nickname
+	}
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content: map[string]interface{}{
+			"msgtype": "m.notice",
+			"body":    formatPaymentRequest(name, pay),
+		},
+	}
+}
+
+// formatPaymentRequest renders a payment request, e.g.
+// "💵 Alice requested a payment: dinner (￥25.00)".
+func formatPaymentRequest(name string, pay *payment) string {
+	text := "💵 " + name + " requested a payment"
+	switch {
+	case pay.Memo != "" && pay.Amount != "":
+		text += ": " + pay.Memo + " (" + pay.Amount + ")"
+	case pay.Memo != "":
+		text += ": " + pay.Memo
+	case pay.Amount != "":
+		text += " of " + pay.Amount
+	}
+	return text
+}
+
+// formatPayment renders a payment as a one-line notice, e.g.
+// "[Transfer] ￥50.00 (lunch) — open in WeChat app".
+func formatPayment(pay *payment) string {
+	if pay.Request {
+		return formatPaymentRequest("Someone", pay)
+	}
+	var sb strings.Builder
+	if pay.RedPacket {
+		sb.WriteString("[Red Packet]")
+	} else {
+		sb.WriteString("[Transfer]")
+		if pay.Amount != "" {
+			sb.WriteString(" " + pay.Amount)
+		}
+	}
+	if pay.Memo != "" {
+		if pay.RedPacket {
+			sb.WriteString(" " + pay.Memo)
+		} else {
+			sb.WriteString(" (" + pay.Memo + ")")
+		}
+	}
+
+	switch {
+	case !pay.RedPacket && pay.SubType == transferAccepted:
+		sb.WriteString(" — accepted")
+	case !pay.RedPacket && pay.SubType == transferReturned:
+		sb.WriteString(" — returned")
+	default:
+		sb.WriteString(" — open in WeChat app")
+	}
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const testTransferXML = `<msg><appmsg appid="" sdkver=""><title><![CDATA[微信转账]]></title><des><![CDATA[收到转账50.00元]]></des><type>2000</type><wcpayinfo><paysubtype>1</paysubtype><feedesc><![CDATA[￥50.00]]></feedesc><transcationid>1000050001</transcationid><pay_memo><![CDATA[lunch]]></pay_memo></wcpayinfo></appmsg></msg>`
+
+const testRedPacketXML = `<msg><appmsg appid="" sdkver=""><title><![CDATA[微信红包]]></title><des><![CDATA[我给你发了一个红包，赶紧去拆!]]></des><type>2001</type><wcpayinfo><sendertitle><![CDATA[Best wishes]]></sendertitle><receivertitle><![CDATA[Best wishes]]></receivertitle></wcpayinfo></appmsg></msg>`
+
+const testPaymentRequestXML = `<msg><appmsg appid="" sdkver=""><title><![CDATA[群收款]]></title><des><![CDATA[每人需支付¥25.00]]></des><type>2001</type><wcpayinfo><receivertitle><![CDATA[dinner]]></receivertitle><newaa><billno>1000039901</billno><newaatype>1</newaatype><launcherusername>wxid_alice</launcherusername></newaa></wcpayinfo></appmsg></msg>`
+
+func TestParsePayment(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *wechat.Message
+		want string
+	}{
+		{"transfer", &wechat.Message{Type: wechat.MsgLink, Content: testTransferXML}, "[Transfer] ￥50.00 (lunch) — open in WeChat app"},
+		{"red packet", &wechat.Message{Type: wechat.MsgLink, Content: testRedPacketXML}, "[Red Packet] Best wishes — open in WeChat app"},
+		{"raw appmsg type", &wechat.Message{Type: wechat.MsgType(2001), Content: "[红包]", Extra: map[string]string{"xml": testRedPacketXML}}, "[Red Packet] Best wishes — open in WeChat app"},
+		{"accepted transfer", &wechat.Message{Type: wechat.MsgLink, Content: `<msg><appmsg><type>2000</type><wcpayinfo><paysubtype>3</paysubtype><feedesc>￥8.80</feedesc></wcpayinfo></appmsg></msg>`}, "[Transfer] ￥8.80 — accepted"},
+	}
+	for _, tc := range tests {
+		pay := parsePayment(tc.msg)
+		if pay == nil {
+			t.Fatalf("%s: payment not detected", tc.name)
+		}
+		if got := formatPayment(pay); got != tc.want {
+			t.Errorf("%s: formatPayment = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParsePayment_IgnoresOtherAppMessages(t *testing.T) {
+	if pay := parsePayment(&wechat.Message{Type: wechat.MsgLink, Content: testLiveLocationStartXML}); pay != nil {
+		t.Fatalf("expected nil, got %+v", pay)
+	}
+}
+
+func TestDefaultProcessor_PaymentAsNotice(t *testing.T) {
+	p := &defaultMessageProcessor{}
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{Type: wechat.MsgLink, Content: testRedPacketXML})
+	if err != nil {
+		t.Fatalf("WeChatToMatrix: %v", err)
+	}
+	if content.Content["msgtype"] != "m.notice" || content.Content["body"] != "[Red Packet] Best wishes — open in WeChat app" {
+		t.Fatalf("unexpected content: %+v", content.Content)
+	}
+}
+
+func TestParsePayment_PaymentRequest(t *testing.T) {
+	pay := parsePayment(&wechat.Message{Type: wechat.MsgLink, Content: testPaymentRequestXML})
+	if pay == nil || !pay.Request || pay.RedPacket {
+		t.Fatalf("expected a payment request, got %+v", pay)
+	}
+	if pay.Amount != "¥25.00" || pay.Memo != "dinner" {
+		t.Fatalf("amount = %q, memo = %q", pay.Amount, pay.Memo)
+	}
+	if got, want := formatPaymentRequest("Alice", pay), "💵 Alice requested a payment: dinner (¥25.00)"; got != want {
+		t.Fatalf("formatPaymentRequest = %q, want %q", got, want)
+	}
+}
+
+func TestEventRouter_PaymentRequestNamesRequester(t *testing.T) {
+	er := NewEventRouter(EventRouterConfig{
+		Log:       slog.Default(),
+		Puppets:   newTestPuppetManager(),
+		Processor: &defaultMessageProcessor{},
+	})
+	er.puppets.puppets["wxid_alice"] = &Puppet{WeChatID: "wxid_alice", Nickname: "Alice"}
+	msg := &wechat.Message{Type: wechat.MsgLink, FromUser: "wxid_alice", Content: testPaymentRequestXML}
+
+	content, err := er.convertWeChatMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("convertWeChatMessage: %v", err)
+	}
+	if content.Content["msgtype"] != "m.notice" || content.Content["body"] != "💵 Alice requested a payment: dinner (¥25.00)" {
+		t.Fatalf("unexpected content: %+v", content.Content)
+	}
+
+	er.paymentRequests = PaymentRequestsIgnore
+	if content, err := er.convertWeChatMessage(context.Background(), msg); err != nil || content != nil {
+		t.Fatalf("ignored request = %+v, %v, want nothing", content, err)
+	}
+}
@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+)
+
+// Permission levels from bridge.permissions, least to most privileged.
+const (
+	PermissionRelay = "relay"
+	PermissionUser  = "user"
+	PermissionAdmin = "admin"
+)
+
+var permissionRank = map[string]int{
+	PermissionRelay: 1,
+	PermissionUser:  2,
+	PermissionAdmin: 3,
+}
+
+// CommandAuthorizer decides whether a user may run a management command.
+// It is consulted for every command, sensitive or not. Deployments that need
+// external authorization can supply their own implementation;
+// PermissionAuthorizer is the config-based default. There is no failover
+// command to authorize: provider failover is automatic and not exposed as a
+// management command.
+type CommandAuthorizer interface {
+	Authorize(ctx context.Context, userID string, cmd *CommandDefinition) (bool, error)
+}
+
+// PermissionAuthorizer authorizes commands for users with user permission in
+// bridge.permissions, and sensitive commands only for users with admin
+// permission. Keys are full user IDs, homeserver domains, or "*"; the most
+// specific match wins.
+type PermissionAuthorizer struct {
+	permissions  map[string]string
+	userCommands map[string]bool // also allowed with user permission
+}
+
+// NewPermissionAuthorizer creates a PermissionAuthorizer from bridge.permissions.
+func NewPermissionAuthorizer(permissions map[string]string) *PermissionAuthorizer {
+	return &PermissionAuthorizer{permissions: permissions}
+}
+
+// Level returns the permission level configured for a user, or "" if none applies.
+func (a *PermissionAuthorizer) Level(userID string) string {
+	if level, ok := a.permissions[userID]; ok {
+		return level
+	}
+	if idx := strings.IndexByte(userID, ':'); idx >= 0 {
+		if level, ok := a.permissions[userID[idx+1:]]; ok {
+			return level
+		}
+	}
+	return a.permissions["*"]
+}
+
+// AllowUsers lets users with user permission run the given sensitive
+// commands too, e.g. login and logout when every user has their own WeChat
+// session instead of sharing the bridge's account.
+func (a *PermissionAuthorizer) AllowUsers(commands ...string) {
+	if a.userCommands == nil {
+		a.userCommands = make(map[string]bool, len(commands))
+	}
+	for _, command := range commands {
+		a.userCommands[command] = true
+	}
+}
+
+// Authorize implements CommandAuthorizer.
+func (a *PermissionAuthorizer) Authorize(_ context.Context, userID string, cmd *CommandDefinition) (bool, error) {
+	required := PermissionUser
+	if cmd.Sensitive && !a.userCommands[cmd.Name] {
+		required = PermissionAdmin
+	}
+	return permissionRank[a.Level(userID)] >= permissionRank[required], nil
+}
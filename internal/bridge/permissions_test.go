@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPermissionAuthorizer_Level(t *testing.T) {
+	auth := NewPermissionAuthorizer(map[string]string{
+		"*":                   PermissionRelay,
+		"example.com":         PermissionUser,
+		"@admin:example.com":  PermissionAdmin,
+		"@banned:example.com": "",
+	})
+
+	tests := map[string]string{
+		"@admin:example.com":  PermissionAdmin,
+		"@alice:example.com":  PermissionUser,
+		"@bob:other.org":      PermissionRelay,
+		"@banned:example.com": "",
+	}
+	for userID, want := range tests {
+		if got := auth.Level(userID); got != want {
+			t.Errorf("Level(%s) = %q, want %q", userID, got, want)
+		}
+	}
+}
+
+func TestPermissionAuthorizer_Authorize(t *testing.T) {
+	auth := NewPermissionAuthorizer(map[string]string{
+		"example.com":        PermissionUser,
+		"@admin:example.com": PermissionAdmin,
+	})
+	ctx := context.Background()
+
+	logout := &CommandDefinition{Name: "logout", Sensitive: true}
+	sync := &CommandDefinition{Name: "sync"}
+
+	if ok, err := auth.Authorize(ctx, "@admin:example.com", logout); err != nil || !ok {
+		t.Fatalf("admin should be authorized: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := auth.Authorize(ctx, "@alice:example.com", logout); ok {
+		t.Fatal("user-level permission should not authorize sensitive commands")
+	}
+	if ok, _ := auth.Authorize(ctx, "@alice:example.com", sync); !ok {
+		t.Fatal("user-level permission should authorize other commands")
+	}
+	if ok, _ := auth.Authorize(ctx, "@eve:other.org", sync); ok {
+		t.Fatal("unknown users should not be authorized")
+	}
+}
+
+func TestPermissionAuthorizer_AllowUsers(t *testing.T) {
+	auth := NewPermissionAuthorizer(map[string]string{
+		"*":           PermissionRelay,
+		"example.com": PermissionUser,
+	})
+	auth.AllowUsers("login", "logout")
+	ctx := context.Background()
+
+	if ok, _ := auth.Authorize(ctx, "@alice:example.com", &CommandDefinition{Name: "logout", Sensitive: true}); !ok {
+		t.Fatal("user-level permission should authorize commands allowed for users")
+	}
+	if ok, _ := auth.Authorize(ctx, "@alice:example.com", &CommandDefinition{Name: "filter", Sensitive: true}); ok {
+		t.Fatal("other sensitive commands should still need admin permission")
+	}
+	if ok, _ := auth.Authorize(ctx, "@eve:other.org", &CommandDefinition{Name: "login", Sensitive: true}); ok {
+		t.Fatal("relay-level permission should not authorize login")
+	}
+}
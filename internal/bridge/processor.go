@@ -3,6 +3,8 @@ package bridge
 import (
 	"context"
 	"fmt"
+	"html"
+	"log/slog"
 	"strings"
 
 	"github.com/n42/mautrix-wechat/pkg/wechat"
@@ -11,29 +13,56 @@ import (
 // defaultMessageProcessor provides a basic bidirectional message conversion
 // between WeChat and Matrix formats. It handles text, image, file, redaction,
 // and other common message types.
-type defaultMessageProcessor struct{}
+type defaultMessageProcessor struct {
+	log *slog.Logger
+	// Uploads media to Matrix; nil passes WeChat media URLs through
+	matrixClient MatrixClient
+	// Resolves the provider that received a message, to download its media
+	providers func(ctx context.Context) (wechat.Provider, error)
+	// Largest media bridged to Matrix in bytes, 0 for no limit
+	maxFileSize int64
+	// Transcodes silk and AMR voice to ogg/opus, nil to upload it as received
+	voiceConverter VoiceConverter
+	// Re-encodes images before upload, nil to upload them as received
+	imageTranscoder ImageTranscoder
+	// Transcribes voice messages, nil for no transcripts
+	transcriber Transcriber
+}
 
 var _ MessageProcessor = (*defaultMessageProcessor)(nil)
 
 // WeChatToMatrix converts a WeChat message to Matrix event content.
-func (p *defaultMessageProcessor) WeChatToMatrix(_ context.Context, msg *wechat.Message) (*MatrixEventContent, error) {
+func (p *defaultMessageProcessor) WeChatToMatrix(ctx context.Context, msg *wechat.Message) (*MatrixEventContent, error) {
+	if loc := parseLiveLocation(msg); loc != nil {
+		return p.liveLocationToMatrix(loc), nil
+	}
+	if q := parseQuote(msg); q != nil {
+		return p.quoteToMatrix(q), nil
+	}
+	if pay := parsePayment(msg); pay != nil {
+		return p.paymentToMatrix(pay), nil
+	}
+
 	switch msg.Type {
 	case wechat.MsgText:
 		return p.textToMatrix(msg), nil
 	case wechat.MsgImage:
-		return p.imageToMatrix(msg), nil
+		return p.withMedia(ctx, msg, p.imageToMatrix(msg))
 	case wechat.MsgVideo:
-		return p.videoToMatrix(msg), nil
+		return p.withMedia(ctx, msg, p.videoToMatrix(msg))
 	case wechat.MsgVoice:
-		return p.voiceToMatrix(msg), nil
+		return p.voiceWithMedia(ctx, msg, p.voiceToMatrix(msg))
 	case wechat.MsgFile:
-		return p.fileToMatrix(msg), nil
+		return p.withMedia(ctx, msg, p.fileToMatrix(msg))
 	case wechat.MsgLocation:
 		return p.locationToMatrix(msg), nil
 	case wechat.MsgLink:
+		if msg.Channels != nil {
+			return p.channelsToMatrix(ctx, msg), nil
+		}
 		return p.linkToMatrix(msg), nil
 	case wechat.MsgEmoji:
-		return p.emojiToMatrix(msg), nil
+		return p.withMedia(ctx, msg, p.emojiToMatrix(msg))
 	case wechat.MsgRevoke:
 		// Revoke is handled via OnRevoke callback, not via OnMessage
 		return nil, nil
@@ -58,13 +87,28 @@ func (p *defaultMessageProcessor) MatrixToWeChat(_ context.Context, evt *MatrixE
 	switch msgtype {
 	case "m.text", "m.notice":
 		body, _ := evt.Content["body"].(string)
+
+		// Edits carry the replacement text in m.new_content; the top-level
+		// body is only a "* " fallback for clients without edit support.
+		var editOf string
+		if relatesTo, ok := evt.Content["m.relates_to"].(map[string]interface{}); ok {
+			if relType, _ := relatesTo["rel_type"].(string); relType == "m.replace" {
+				editOf, _ = relatesTo["event_id"].(string)
+				if newContent, ok := evt.Content["m.new_content"].(map[string]interface{}); ok {
+					body, _ = newContent["body"].(string)
+				}
+			}
+		}
+
 		if body == "" {
 			return nil, nil
 		}
 
 		action := &WeChatSendAction{
-			Type: wechat.MsgText,
-			Text: body,
+			Type:          wechat.MsgText,
+			Text:          body,
+			IsEdit:        editOf != "",
+			OriginalMsgID: editOf,
 		}
 
 		// Check for reply
@@ -115,10 +159,17 @@ func (p *defaultMessageProcessor) MatrixToWeChat(_ context.Context, evt *MatrixE
 
 	case "m.emote":
 		body, _ := evt.Content["body"].(string)
-		return &WeChatSendAction{
+		action := &WeChatSendAction{
 			Type: wechat.MsgText,
 			Text: "* " + body,
-		}, nil
+		}
+		// "/me pat @user" becomes a WeChat pat (拍一拍). Text stays set so the
+		// EventRouter can fall back to it when the pat can't be sent.
+		if target := patTarget(evt.Content); target != "" {
+			action.Type = wechat.MsgPat
+			action.PatUser = target
+		}
+		return action, nil
 
 	default:
 		return nil, nil
@@ -204,13 +255,18 @@ func (p *defaultMessageProcessor) fileToMatrix(msg *wechat.Message) *MatrixEvent
 
 func (p *defaultMessageProcessor) locationToMatrix(msg *wechat.Message) *MatrixEventContent {
 	body := "Location"
-	geoURI := ""
-	if msg.Location != nil {
-		if msg.Location.Label != "" {
-			body = msg.Location.Label
-		}
-		if msg.Location.Latitude != 0 || msg.Location.Longitude != 0 {
-			geoURI = fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude)
+	if msg.Location != nil && msg.Location.Label != "" {
+		body = msg.Location.Label
+	}
+	// Without usable coordinates a pin would point nowhere, so only the
+	// label is sent.
+	if msg.Location == nil || !msg.Location.HasValidCoordinates() {
+		return &MatrixEventContent{
+			EventType: "m.room.message",
+			Content: map[string]interface{}{
+				"msgtype": "m.text",
+				"body":    body,
+			},
 		}
 	}
 	return &MatrixEventContent{
@@ -218,7 +274,7 @@ func (p *defaultMessageProcessor) locationToMatrix(msg *wechat.Message) *MatrixE
 		Content: map[string]interface{}{
 			"msgtype": "m.location",
 			"body":    body,
-			"geo_uri": geoURI,
+			"geo_uri": fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude),
 		},
 	}
 }
@@ -250,16 +306,72 @@ func (p *defaultMessageProcessor) linkToMatrix(msg *wechat.Message) *MatrixEvent
 	}
 }
 
+// channelsToMatrix renders a shared Channels (视频号) video as a card with
+// its title, author and cover. The video itself isn't bridged; Channels
+// playback URLs only work inside WeChat. Shares without a title are named
+// after their author or description.
+func (p *defaultMessageProcessor) channelsToMatrix(ctx context.Context, msg *wechat.Message) *MatrixEventContent {
+	video := msg.Channels
+	title := video.Title
+	switch {
+	case title != "":
+	case video.AuthorName != "":
+		title = video.AuthorName
+	case video.Description != "":
+		title = video.Description
+	default:
+		title = "Channels video"
+	}
+
+	lines := []string{"[Channels] " + title}
+	htmlBody := fmt.Sprintf(`<blockquote><em>[Channels]</em> <strong>%s</strong>`, html.EscapeString(title))
+	if video.AuthorName != "" && video.AuthorName != title {
+		lines = append(lines, video.AuthorName)
+		htmlBody += "<br/>" + html.EscapeString(video.AuthorName)
+	}
+	if video.Description != "" && video.Description != title {
+		lines = append(lines, video.Description)
+		htmlBody += "<br/>" + strings.ReplaceAll(html.EscapeString(video.Description), "\n", "<br/>")
+	}
+
+	if video.CoverURL != "" && p.matrixClient != nil {
+		cover := &wechat.Message{
+			MsgID:    msg.MsgID,
+			Type:     wechat.MsgImage,
+			MediaURL: video.CoverURL,
+			FileName: "cover.jpg",
+		}
+		if mxcURI, _, _, err := p.uploadMedia(ctx, cover); err != nil {
+			p.log.Warn("failed to bridge channels cover", "error", err, "msg_id", msg.MsgID)
+		} else {
+			htmlBody += fmt.Sprintf(`<br/><img src="%s" alt="%s" height="240"/>`, html.EscapeString(mxcURI), html.EscapeString(title))
+		}
+	}
+	htmlBody += "</blockquote>"
+
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content: map[string]interface{}{
+			"msgtype":        "m.text",
+			"body":           strings.Join(lines, "\n"),
+			"format":         "org.matrix.custom.html",
+			"formatted_body": htmlBody,
+		},
+	}
+}
+
+// emojiToMatrix converts a custom sticker to an m.sticker event, which
+// clients render sticker-sized rather than as a full-size image.
 func (p *defaultMessageProcessor) emojiToMatrix(msg *wechat.Message) *MatrixEventContent {
 	content := map[string]interface{}{
-		"msgtype": "m.image",
-		"body":    "sticker",
+		"body": "sticker",
+		"info": map[string]interface{}{},
 	}
 	if msg.MediaURL != "" {
 		content["url"] = msg.MediaURL
 	}
 	return &MatrixEventContent{
-		EventType: "m.room.message",
+		EventType: "m.sticker",
 		Content:   content,
 	}
 }
@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // sticker dimensions
+	"io"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withMedia uploads the media of msg to Matrix and points content at it.
+// Without a Matrix client the WeChat URL set by the converter is kept as
+// received. Media WeChat no longer serves fails with wechat.ErrMediaExpired,
+// which the EventRouter turns into a notice.
+func (p *defaultMessageProcessor) withMedia(ctx context.Context, msg *wechat.Message, content *MatrixEventContent) (*MatrixEventContent, error) {
+	if p.matrixClient == nil || (len(msg.MediaData) == 0 && msg.MediaURL == "") {
+		return content, nil
+	}
+	info, _ := content.Content["info"].(map[string]interface{})
+	if info == nil {
+		info = map[string]interface{}{}
+	}
+	var mxcURI, mimeType string
+	var size int64
+	var err error
+	if msg.Type == wechat.MsgImage || msg.Type == wechat.MsgEmoji {
+		mxcURI, mimeType, size, err = p.uploadImage(ctx, msg, info)
+	} else {
+		mxcURI, mimeType, size, err = p.uploadMedia(ctx, msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: %w", mediaKind(msg.Type), err)
+	}
+
+	content.Content["url"] = mxcURI
+	info["mimetype"] = mimeType
+	if size > 0 {
+		info["size"] = size
+	}
+	content.Content["info"] = info
+	return content, nil
+}
+
+// uploadMedia uploads inline media data, or downloads the media from the
+// provider that received msg and streams it to Matrix when the client
+// supports that. It returns the MXC URI, mimetype and size, which is 0 when
+// unknown.
+func (p *defaultMessageProcessor) uploadMedia(ctx context.Context, msg *wechat.Message) (string, string, int64, error) {
+	fileName := msg.FileName
+	if fileName == "" {
+		fileName = mediaKind(msg.Type)
+	}
+
+	if len(msg.MediaData) > 0 {
+		if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxFileSize); err != nil {
+			return "", "", 0, err
+		}
+		mimeType := mediaMimeType(msg.Type)
+		mxcURI, err := p.matrixClient.UploadMedia(ctx, msg.MediaData, mimeType, fileName)
+		if err != nil {
+			return "", "", 0, err
+		}
+		return mxcURI, mimeType, int64(len(msg.MediaData)), nil
+	}
+
+	if err := wechat.CheckMediaSize(msg.FileSize, p.maxFileSize); err != nil {
+		return "", "", 0, err
+	}
+	rc, mimeType, err := p.downloadMedia(ctx, msg)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("download media: %w", err)
+	}
+	body := wechat.LimitMedia(rc, p.maxFileSize)
+	defer body.Close()
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = mediaMimeType(msg.Type)
+	}
+
+	if uploader, ok := p.matrixClient.(MediaStreamUploader); ok {
+		mxcURI, err := uploader.UploadMediaStream(ctx, body, mimeType, fileName)
+		if err != nil {
+			return "", "", 0, err
+		}
+		return mxcURI, mimeType, msg.FileSize, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("read media: %w", err)
+	}
+	mxcURI, err := p.matrixClient.UploadMedia(ctx, data, mimeType, fileName)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return mxcURI, mimeType, int64(len(data)), nil
+}
+
+// uploadImage uploads an image or sticker whole instead of streaming it,
+// so that images can be transcoded and the width and height read from the
+// image header into info.
+func (p *defaultMessageProcessor) uploadImage(ctx context.Context, msg *wechat.Message, info map[string]interface{}) (string, string, int64, error) {
+	data, mimeType, err := p.readMedia(ctx, msg)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if msg.Type == wechat.MsgImage && p.imageTranscoder != nil {
+		transcoded, transcodedType, err := p.imageTranscoder.TranscodeImage(data, mimeType)
+		if err != nil {
+			p.log.Warn("image transcoding failed, uploading original", "error", err, "msg_id", msg.MsgID)
+		} else {
+			data, mimeType = transcoded, transcodedType
+		}
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info["w"] = cfg.Width
+		info["h"] = cfg.Height
+	}
+
+	fileName := msg.FileName
+	if fileName == "" {
+		fileName = mediaKind(msg.Type)
+	}
+	mxcURI, err := p.matrixClient.UploadMedia(ctx, data, mimeType, fileName)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return mxcURI, mimeType, int64(len(data)), nil
+}
+
+// readMedia returns the inline media data of msg, or downloads it from the
+// provider that received msg, and its mimetype.
+func (p *defaultMessageProcessor) readMedia(ctx context.Context, msg *wechat.Message) ([]byte, string, error) {
+	if len(msg.MediaData) > 0 {
+		if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxFileSize); err != nil {
+			return nil, "", err
+		}
+		return msg.MediaData, mediaMimeType(msg.Type), nil
+	}
+	if err := wechat.CheckMediaSize(msg.FileSize, p.maxFileSize); err != nil {
+		return nil, "", err
+	}
+	rc, mimeType, err := p.downloadMedia(ctx, msg)
+	if err != nil {
+		return nil, "", fmt.Errorf("download media: %w", err)
+	}
+	defer rc.Close()
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = mediaMimeType(msg.Type)
+	}
+	data, err := wechat.ReadMedia(rc, p.maxFileSize)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, mimeType, nil
+}
+
+// downloadMedia downloads the media of msg from the provider that received
+// it. Media whose URL expired is refetched by message from providers that
+// support it; if that fails too the media is gone.
+func (p *defaultMessageProcessor) downloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
+	if p.providers == nil {
+		return nil, "", fmt.Errorf("no provider to download media from")
+	}
+	provider, err := p.providers(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if provider == nil {
+		return nil, "", fmt.Errorf("no provider to download media from")
+	}
+
+	rc, mimeType, err := provider.DownloadMedia(ctx, msg)
+	if !errors.Is(err, wechat.ErrMediaExpired) {
+		return rc, mimeType, err
+	}
+	refetcher, ok := provider.(wechat.MediaRefetcher)
+	if !ok {
+		return nil, "", err
+	}
+	rc, mimeType, refetchErr := refetcher.RefetchMedia(ctx, msg)
+	if refetchErr != nil {
+		p.log.Debug("refetching expired media failed", "error", refetchErr, "msg_id", msg.MsgID)
+		return nil, "", err
+	}
+	return rc, mimeType, nil
+}
+
+// mediaKind names a media message type in file names and errors.
+func mediaKind(t wechat.MsgType) string {
+	switch t {
+	case wechat.MsgImage:
+		return "image"
+	case wechat.MsgVideo:
+		return "video"
+	case wechat.MsgVoice:
+		return "voice"
+	case wechat.MsgEmoji:
+		return "sticker"
+	default:
+		return "file"
+	}
+}
+
+// mediaMimeType is the mimetype assumed for media of type t when the
+// provider doesn't report one.
+func mediaMimeType(t wechat.MsgType) string {
+	switch t {
+	case wechat.MsgImage:
+		return "image/jpeg"
+	case wechat.MsgVideo:
+		return "video/mp4"
+	case wechat.MsgVoice:
+		return "audio/ogg"
+	case wechat.MsgEmoji:
+		return "image/gif"
+	default:
+		return "application/octet-stream"
+	}
+}
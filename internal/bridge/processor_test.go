@@ -1,7 +1,16 @@
 package bridge
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/n42/mautrix-wechat/pkg/wechat"
@@ -52,6 +61,104 @@ func TestDefaultProcessor_ImageToMatrix(t *testing.T) {
 	}
 }
 
+func TestDefaultProcessor_UploadsInlineMedia(t *testing.T) {
+	matrix := &testMatrixClient{}
+	p := &defaultMessageProcessor{matrixClient: matrix, maxFileSize: 4}
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgFile,
+		FileName:  "a.txt",
+		MediaData: []byte("abc"),
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if content.Content["url"] != "mxc://test/uploaded" || len(matrix.uploads) != 1 {
+		t.Fatalf("url %v, %d uploads", content.Content["url"], len(matrix.uploads))
+	}
+	info := content.Content["info"].(map[string]interface{})
+	if info["size"] != int64(3) || info["mimetype"] != "application/octet-stream" {
+		t.Fatalf("info %v", info)
+	}
+
+	_, err = p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgFile,
+		MediaData: []byte("too large"),
+	})
+	if !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("err = %v, want ErrMediaTooLarge", err)
+	}
+}
+
+// coverProvider serves every media download from a fixed URL.
+type coverProvider struct {
+	*mockProvider
+	urls []string
+}
+
+func (p *coverProvider) DownloadMedia(_ context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
+	p.urls = append(p.urls, msg.MediaURL)
+	return io.NopCloser(bytes.NewReader([]byte("cover"))), "image/jpeg", nil
+}
+
+func TestDefaultProcessor_ChannelsShare(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &coverProvider{mockProvider: newMockProvider("padpro", 1)}
+	p := &defaultMessageProcessor{
+		log:          slog.Default(),
+		matrixClient: matrix,
+		providers:    func(context.Context) (wechat.Provider, error) { return provider, nil },
+	}
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID: "msg010",
+		Type:  wechat.MsgLink,
+		Channels: &wechat.ChannelsVideo{
+			Title:       "Sunset at the pier",
+			AuthorName:  "Travel Diary",
+			Description: "Sunset at the pier",
+			CoverURL:    "https://finder.example.com/cover.jpg",
+		},
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if body := content.Content["body"]; body != "[Channels] Sunset at the pier\nTravel Diary" {
+		t.Fatalf("body: %q", body)
+	}
+	if len(provider.urls) != 1 || provider.urls[0] != "https://finder.example.com/cover.jpg" {
+		t.Fatalf("downloads: %v", provider.urls)
+	}
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "cover" {
+		t.Fatalf("uploads: %q", matrix.uploads)
+	}
+	formatted, _ := content.Content["formatted_body"].(string)
+	if !strings.Contains(formatted, `<img src="mxc://test/uploaded"`) || !strings.Contains(formatted, "Travel Diary") {
+		t.Fatalf("formatted_body: %s", formatted)
+	}
+}
+
+func TestDefaultProcessor_ChannelsShareWithoutTitle(t *testing.T) {
+	p := &defaultMessageProcessor{}
+
+	for _, tt := range []struct {
+		video *wechat.ChannelsVideo
+		want  string
+	}{
+		{&wechat.ChannelsVideo{AuthorName: "Travel Diary", Description: "Sunset"}, "[Channels] Travel Diary\nSunset"},
+		{&wechat.ChannelsVideo{Description: "Sunset"}, "[Channels] Sunset"},
+		{&wechat.ChannelsVideo{}, "[Channels] Channels video"},
+	} {
+		content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{Type: wechat.MsgLink, Channels: tt.video})
+		if err != nil {
+			t.Fatalf("convert: %v", err)
+		}
+		if body := content.Content["body"]; body != tt.want {
+			t.Errorf("body %q, want %q", body, tt.want)
+		}
+	}
+}
+
 func TestDefaultProcessor_LocationToMatrix(t *testing.T) {
 	p := &defaultMessageProcessor{}
 	msg := &wechat.Message{
@@ -79,6 +186,34 @@ func TestDefaultProcessor_LocationToMatrix(t *testing.T) {
 	}
 }
 
+func TestDefaultProcessor_LocationToMatrixInvalidCoordinates(t *testing.T) {
+	p := &defaultMessageProcessor{}
+	tests := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{"zero", 0, 0},
+		{"latitude out of range", 91, 116.3},
+		{"longitude out of range", 39.9, -180.5},
+	}
+	for _, tc := range tests {
+		msg := &wechat.Message{
+			Type:     wechat.MsgLocation,
+			Location: &wechat.LocationInfo{Latitude: tc.lat, Longitude: tc.lng, Label: "Beijing"},
+		}
+		content, err := p.WeChatToMatrix(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("%s: convert: %v", tc.name, err)
+		}
+		if content.Content["msgtype"] != "m.text" || content.Content["body"] != "Beijing" {
+			t.Errorf("%s: content = %v, want the label as text", tc.name, content.Content)
+		}
+		if _, ok := content.Content["geo_uri"]; ok {
+			t.Errorf("%s: unexpected geo_uri", tc.name)
+		}
+	}
+}
+
 func TestDefaultProcessor_LinkToMatrix(t *testing.T) {
 	p := &defaultMessageProcessor{}
 	msg := &wechat.Message{
@@ -166,6 +301,35 @@ func TestDefaultProcessor_MatrixTextToWeChat(t *testing.T) {
 	}
 }
 
+func TestDefaultProcessor_MatrixTextEdit(t *testing.T) {
+	p := &defaultMessageProcessor{}
+	evt := &MatrixEvent{
+		Content: map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    "* fixed typo",
+			"m.new_content": map[string]interface{}{
+				"msgtype": "m.text",
+				"body":    "fixed typo",
+			},
+			"m.relates_to": map[string]interface{}{
+				"rel_type": "m.replace",
+				"event_id": "$original",
+			},
+		},
+	}
+
+	action, err := p.MatrixToWeChat(context.Background(), evt)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if !action.IsEdit || action.OriginalMsgID != "$original" {
+		t.Errorf("edit: %v %q", action.IsEdit, action.OriginalMsgID)
+	}
+	if action.Text != "fixed typo" {
+		t.Errorf("text: %s", action.Text)
+	}
+}
+
 func TestDefaultProcessor_MatrixTextWithReply(t *testing.T) {
 	p := &defaultMessageProcessor{}
 	evt := &MatrixEvent{
@@ -207,6 +371,58 @@ func TestDefaultProcessor_MatrixEmoteToWeChat(t *testing.T) {
 	}
 }
 
+func TestDefaultProcessor_MatrixEmotePat(t *testing.T) {
+	p := &defaultMessageProcessor{}
+
+	for _, tt := range []struct {
+		name    string
+		content map[string]interface{}
+		patUser string
+	}{
+		{
+			name: "pill",
+			content: map[string]interface{}{
+				"msgtype":    "m.emote",
+				"body":       "pat Alice (WeChat)",
+				"m.mentions": map[string]interface{}{"user_ids": []interface{}{"@wechat_alice:example.com"}},
+			},
+			patUser: "@wechat_alice:example.com",
+		},
+		{
+			name:    "plain user ID",
+			content: map[string]interface{}{"msgtype": "m.emote", "body": "Pat @wechat_alice:example.com"},
+			patUser: "@wechat_alice:example.com",
+		},
+		{
+			name:    "no target",
+			content: map[string]interface{}{"msgtype": "m.emote", "body": "pat Alice"},
+		},
+		{
+			name:    "not a pat",
+			content: map[string]interface{}{"msgtype": "m.emote", "body": "pats @wechat_alice:example.com"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := p.MatrixToWeChat(context.Background(), &MatrixEvent{Content: tt.content})
+			if err != nil {
+				t.Fatalf("convert: %v", err)
+			}
+			if action.Text != "* "+tt.content["body"].(string) {
+				t.Fatalf("fallback text: %q", action.Text)
+			}
+			if tt.patUser == "" {
+				if action.Type != wechat.MsgText || action.PatUser != "" {
+					t.Fatalf("expected a text emote, got %+v", action)
+				}
+				return
+			}
+			if action.Type != wechat.MsgPat || action.PatUser != tt.patUser {
+				t.Fatalf("expected pat of %s, got %+v", tt.patUser, action)
+			}
+		})
+	}
+}
+
 func TestDefaultProcessor_MatrixImageToWeChat(t *testing.T) {
 	p := &defaultMessageProcessor{}
 	evt := &MatrixEvent{
@@ -372,8 +588,101 @@ func TestDefaultProcessor_EmojiToMatrix(t *testing.T) {
 	if err != nil {
 		t.Fatalf("convert: %v", err)
 	}
-	if content.Content["msgtype"] != "m.image" {
-		t.Errorf("msgtype: %v", content.Content["msgtype"])
+	if content.EventType != "m.sticker" {
+		t.Errorf("event type: %v", content.EventType)
+	}
+	if _, ok := content.Content["msgtype"]; ok {
+		t.Errorf("sticker has a msgtype: %v", content.Content["msgtype"])
+	}
+}
+
+func TestDefaultProcessor_ImageAndStickerDimensions(t *testing.T) {
+	var gifData, pngData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 120, 80), palette.Plan9), nil); err != nil {
+		t.Fatalf("encode gif: %v", err)
+	}
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 30, 40))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	p := &defaultMessageProcessor{matrixClient: &testMatrixClient{}}
+
+	for _, tc := range []struct {
+		msgType   wechat.MsgType
+		data      []byte
+		eventType string
+		w, h      int
+	}{
+		{wechat.MsgEmoji, gifData.Bytes(), "m.sticker", 120, 80},
+		{wechat.MsgImage, pngData.Bytes(), "m.room.message", 30, 40},
+	} {
+		content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{Type: tc.msgType, MediaData: tc.data})
+		if err != nil {
+			t.Fatalf("convert %s: %v", tc.eventType, err)
+		}
+		info := content.Content["info"].(map[string]interface{})
+		if content.EventType != tc.eventType || info["w"] != tc.w || info["h"] != tc.h {
+			t.Errorf("%s info = %v, want %dx%d", content.EventType, info, tc.w, tc.h)
+		}
+	}
+}
+
+type shrinkingTranscoder struct{}
+
+func (shrinkingTranscoder) TranscodeImage(data []byte, _ string) ([]byte, string, error) {
+	return data[:len(data)/2], "image/jpeg", nil
+}
+
+func TestDefaultProcessor_ImageIsTranscoded(t *testing.T) {
+	matrix := &testMatrixClient{}
+	p := &defaultMessageProcessor{log: slog.Default(), matrixClient: matrix, imageTranscoder: shrinkingTranscoder{}}
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgImage,
+		MediaData: []byte("12345678"),
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "1234" {
+		t.Fatalf("uploads: %q", matrix.uploads)
+	}
+	if info := content.Content["info"].(map[string]interface{}); info["size"] != int64(4) {
+		t.Fatalf("size: %v", info["size"])
+	}
+
+	// Stickers keep their animation and are uploaded as received.
+	if _, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgEmoji,
+		MediaData: []byte("GIF89a.."),
+	}); err != nil {
+		t.Fatalf("convert sticker: %v", err)
+	}
+	if string(matrix.uploads[1]) != "GIF89a.." {
+		t.Fatalf("sticker upload: %q", matrix.uploads[1])
+	}
+}
+
+func TestEventRouter_OnMessage_SendsStickerEvent(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, newMockProvider("wxid_me", 2)))
+	expectDMRoute(mock, 1)
+
+	msg := &wechat.Message{
+		MsgID: "emoji1", Type: wechat.MsgEmoji, FromUser: "wxid_bob", ToUser: "wxid_me",
+		MediaData: []byte("GIF89a"),
+	}
+	if err := er.OnMessage(context.Background(), msg); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d events", len(matrix.sent))
+	}
+	sent := matrix.sent[0]
+	if sent.eventType != "m.sticker" {
+		t.Fatalf("event type = %q, want m.sticker", sent.eventType)
+	}
+	if content := sent.content.(map[string]interface{}); content["url"] != "mxc://test/uploaded" {
+		t.Fatalf("sticker %v", content)
 	}
 }
 
@@ -0,0 +1,60 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// providerSessionStore exposes a bridge user's provider_session row to the
+// provider serving them as a wechat.SessionStore.
+type providerSessionStore struct {
+	store        *database.ProviderSessionStore
+	providerType string
+	// bridgeUser returns the Matrix ID of the user the provider serves, or
+	// "" while nobody is linked to it yet.
+	bridgeUser func(ctx context.Context) (string, error)
+}
+
+// fixedBridgeUser is a providerSessionStore.bridgeUser for providers that
+// serve one user, as in multi-tenant mode.
+func fixedBridgeUser(userID string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) { return userID, nil }
+}
+
+func (s *providerSessionStore) LoadSession(ctx context.Context) (json.RawMessage, error) {
+	userID, err := s.bridgeUser(ctx)
+	if err != nil || userID == "" {
+		return nil, err
+	}
+	sess, err := s.store.Get(ctx, userID)
+	if err != nil || sess == nil || sess.ProviderType != s.providerType {
+		return nil, err
+	}
+	return sess.SessionData, nil
+}
+
+func (s *providerSessionStore) SaveSession(ctx context.Context, data json.RawMessage) error {
+	userID, err := s.bridgeUser(ctx)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return fmt.Errorf("no bridge user to save the %s session for", s.providerType)
+	}
+	return s.store.Upsert(ctx, &database.ProviderSessionRow{
+		BridgeUser:   userID,
+		ProviderType: s.providerType,
+		SessionData:  data,
+	})
+}
+
+func (s *providerSessionStore) DeleteSession(ctx context.Context) error {
+	userID, err := s.bridgeUser(ctx)
+	if err != nil || userID == "" {
+		return err
+	}
+	return s.store.Delete(ctx, userID)
+}
@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func TestProviderSessionStore_KeyedByBridgeUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	rows := func(providerType string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"bridge_user", "provider_type", "session_data", "cookies", "device_info", "updated_at"}).
+			AddRow("@alice:test", providerType, []byte(`{"user_name":"wxid_a"}`), nil, nil, time.Now())
+	}
+	store := &providerSessionStore{
+		store:        database.NewFromDB(db).ProviderSession,
+		providerType: "padpro",
+		bridgeUser:   fixedBridgeUser("@alice:test"),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM provider_session WHERE bridge_user = $1`)).
+		WithArgs("@alice:test").
+		WillReturnRows(rows("padpro"))
+	if data, err := store.LoadSession(ctx); err != nil || string(data) != `{"user_name":"wxid_a"}` {
+		t.Fatalf("LoadSession = %s, %v", data, err)
+	}
+
+	// A session another provider saved is of no use
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM provider_session WHERE bridge_user = $1`)).
+		WithArgs("@alice:test").
+		WillReturnRows(rows("ipad"))
+	if data, err := store.LoadSession(ctx); err != nil || data != nil {
+		t.Fatalf("LoadSession of ipad session = %s, %v", data, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO provider_session`)).
+		WithArgs("@alice:test", "padpro", []byte(`{"user_name":"wxid_b"}`), nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.SaveSession(ctx, []byte(`{"user_name":"wxid_b"}`)); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+
+	// Until an account is linked to a bridge user there is nowhere to save
+	store.bridgeUser = fixedBridgeUser("")
+	if err := store.SaveSession(ctx, []byte(`{}`)); err == nil {
+		t.Fatal("SaveSession without a bridge user succeeded")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
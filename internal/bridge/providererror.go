@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// SetProviderErrorHook registers fn to be told about failed provider calls,
+// e.g. ProviderManager.ReportError so that a lost session fails the next
+// health check.
+func (er *EventRouter) SetProviderErrorHook(fn func(wechat.Provider, error)) {
+	er.providerErrorHook = fn
+}
+
+// handleProviderError reacts to a failed provider call made for bridgeUserID.
+// A lost session starts a new login, which posts the QR code to the bridge
+// user's management room. Rate limiting and temporary errors were already
+// handled by the send retrier.
+func (er *EventRouter) handleProviderError(ctx context.Context, provider wechat.Provider, bridgeUserID string, err error) {
+	if er.providerErrorHook != nil {
+		er.providerErrorHook(provider, err)
+	}
+	if errors.Is(err, wechat.ErrLoggedOut) {
+		er.relogin(ctx, provider, bridgeUserID)
+	}
+}
+
+// relogin starts a new login for a provider whose session is gone, unless
+// one is already in progress.
+func (er *EventRouter) relogin(ctx context.Context, provider wechat.Provider, bridgeUserID string) {
+	switch provider.GetLoginState() {
+	case wechat.LoginStateQRCode, wechat.LoginStateConfirming:
+		return
+	}
+
+	er.reloginMu.Lock()
+	if er.relogins[bridgeUserID] {
+		er.reloginMu.Unlock()
+		return
+	}
+	if er.relogins == nil {
+		er.relogins = make(map[string]bool)
+	}
+	er.relogins[bridgeUserID] = true
+	er.reloginMu.Unlock()
+
+	er.log.Warn("wechat session lost, starting a new login", "provider", provider.Name(), "bridge_user", bridgeUserID)
+
+	// Like the login command, the login outlives the Matrix event that
+	// noticed the lost session.
+	ctx = context.WithValue(context.WithoutCancel(ctx), bridgeUserKey, bridgeUserID)
+	go func() {
+		defer func() {
+			er.reloginMu.Lock()
+			delete(er.relogins, bridgeUserID)
+			er.reloginMu.Unlock()
+		}()
+
+		var err error
+		if er.multiTenant && er.sessionManager != nil {
+			err = er.sessionManager.LoginUser(ctx, bridgeUserID)
+		} else if !resumeSession(ctx, er.log, provider) {
+			// The provider's login state may still say logged in.
+			err = provider.Login(ctx)
+		}
+		if err != nil {
+			er.log.Error("failed to start login after lost session", "error", err, "bridge_user", bridgeUserID)
+		}
+	}()
+}
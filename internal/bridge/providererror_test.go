@@ -0,0 +1,65 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestEventRouter_HandleMatrixMessage_LoggedOutStartsLogin(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	provider.sendErr = wechat.WrapError(wechat.ErrLoggedOut, fmt.Errorf("HTTP 401: session expired"))
+	// Unbuffered, so the first login stays in progress until received.
+	provider.loginStarted = make(chan struct{})
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:       slog.Default(),
+		Puppets:   newTestPuppetManager(),
+		Processor: &defaultMessageProcessor{},
+		Provider:  provider,
+	})
+	var reported []error
+	er.SetProviderErrorHook(func(p wechat.Provider, err error) {
+		if p == provider {
+			reported = append(reported, err)
+		}
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	for i := 0; i < 2; i++ {
+		err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+			ID:      fmt.Sprintf("$event%d:test", i),
+			Type:    "m.room.message",
+			RoomID:  room.MatrixRoomID,
+			Sender:  "@user:test",
+			Content: map[string]interface{}{"msgtype": "m.text", "body": "hello"},
+		}, room)
+		if !errors.Is(err, wechat.ErrLoggedOut) {
+			t.Fatalf("handleMatrixMessage error = %v, want ErrLoggedOut", err)
+		}
+	}
+
+	select {
+	case <-provider.loginStarted:
+	case <-time.After(time.Second):
+		t.Fatal("no login started after the session was lost")
+	}
+	select {
+	case <-provider.loginStarted:
+		t.Fatal("login started twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if len(provider.sentTexts) != 2 {
+		t.Fatalf("sent %d texts, want no retries of a logged-out send", len(provider.sentTexts))
+	}
+	if len(reported) != 2 {
+		t.Fatalf("reported %d errors to the hook, want 2", len(reported))
+	}
+}
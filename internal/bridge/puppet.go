@@ -6,6 +6,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"text/template"
 
 	"github.com/n42/mautrix-wechat/internal/database"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
@@ -17,8 +18,9 @@ type PuppetManager struct {
 	mu       sync.RWMutex
 	puppets  map[string]*Puppet // keyed by WeChat ID
 	domain   string
-	template string // username template, e.g. "wechat_{{.}}"
-	dnTempl  string // display name template
+	template string             // username template, e.g. "wechat_{{.}}"
+	dnTempl  *template.Template // display name template
+	oaTempl  *template.Template // display name template for official accounts
 	db       *database.UserStore
 	intent   MatrixClient // bot intent for creating puppet users
 }
@@ -47,10 +49,18 @@ type MatrixClient interface {
 	UploadMedia(ctx context.Context, data []byte, mimeType, fileName string) (string, error)
 	// DownloadMedia downloads Matrix media by MXC URI.
 	DownloadMedia(ctx context.Context, mxcURI string) (io.ReadCloser, string, error)
-	// SendMessage sends a Matrix event to a room on behalf of a user.
-	SendMessage(ctx context.Context, roomID, senderUserID string, content interface{}) (string, error)
+	// MediaExists reports whether an MXC URI still resolves on the homeserver,
+	// e.g. via a HEAD request on its thumbnail. It returns false for purged media.
+	MediaExists(ctx context.Context, mxcURI string) (bool, error)
+	// SendMessage sends a Matrix event of type eventType, e.g. m.room.message
+	// or m.sticker, to a room on behalf of a user.
+	SendMessage(ctx context.Context, roomID, senderUserID, eventType string, content interface{}) (string, error)
 	// SendMessageWithTimestamp sends a Matrix event with a specified timestamp (for backfill).
-	SendMessageWithTimestamp(ctx context.Context, roomID, senderUserID string, content interface{}, timestamp int64) (string, error)
+	SendMessageWithTimestamp(ctx context.Context, roomID, senderUserID, eventType string, content interface{}, timestamp int64) (string, error)
+	// SendMessageAs sends a Matrix event as a real (non-puppet) user with that
+	// user's own access token, joining the room first if needed. Used for
+	// double puppeting.
+	SendMessageAs(ctx context.Context, roomID, userID, accessToken, eventType string, content interface{}) (string, error)
 	// CreateRoom creates a new Matrix room and returns the room ID.
 	CreateRoom(ctx context.Context, req *CreateRoomRequest) (string, error)
 	// JoinRoom makes a user join a room.
@@ -71,10 +81,19 @@ type MatrixClient interface {
 	SetRoomAvatar(ctx context.Context, roomID, mxcURI string) error
 	// SetRoomTopic sets the topic of a room.
 	SetRoomTopic(ctx context.Context, roomID, topic string) error
+	// PinnedEvents returns the event IDs pinned in a room, oldest first.
+	PinnedEvents(ctx context.Context, roomID string) ([]string, error)
+	// SetPinnedEvents replaces the events pinned in a room.
+	SetPinnedEvents(ctx context.Context, roomID string, eventIDs []string) error
+	// SetRoomMemberName sets a user's display name in one room only,
+	// leaving their global profile untouched.
+	SetRoomMemberName(ctx context.Context, roomID, userID, name string) error
 	// SetTyping sends a typing indicator for a user in a room.
 	SetTyping(ctx context.Context, roomID, userID string, typing bool, timeoutMs int) error
 	// SetPresence sets the presence status of a user.
 	SetPresence(ctx context.Context, userID string, online bool) error
+	// SendReaction annotates eventID with key (an m.reaction) as senderUserID.
+	SendReaction(ctx context.Context, roomID, senderUserID, eventID, key string) (string, error)
 	// SendReadReceipt sends a read receipt for an event.
 	SendReadReceipt(ctx context.Context, roomID, eventID, userID string) error
 	// CreateSpace creates a Matrix Space and returns the room ID.
@@ -92,6 +111,7 @@ type CreateRoomRequest struct {
 	AvatarMXC   string
 	IsEncrypted bool
 	SpaceID     string // parent Space ID
+	Predecessor string // room this one replaces, e.g. a tombstoned room
 }
 
 // CreateSpaceRequest describes a Space to be created.
@@ -108,7 +128,7 @@ func NewPuppetManager(domain, usernameTemplate, displaynameTemplate string, db *
 		puppets:  make(map[string]*Puppet),
 		domain:   domain,
 		template: usernameTemplate,
-		dnTempl:  displaynameTemplate,
+		dnTempl:  parseDisplayNameTemplate(displaynameTemplate),
 		db:       db,
 		intent:   intent,
 	}
@@ -197,6 +217,17 @@ func (pm *PuppetManager) GetOrCreate(ctx context.Context, contact *wechat.Contac
 
 // UpdateProfile updates a puppet's display name and avatar if they have changed.
 func (pm *PuppetManager) UpdateProfile(ctx context.Context, contact *wechat.ContactInfo) error {
+	return pm.updateProfile(ctx, contact, false)
+}
+
+// RefreshProfile sets a puppet's display name again and marks its avatar for
+// re-upload even when the stored profile matches the contact, for puppets
+// whose Matrix profile went stale.
+func (pm *PuppetManager) RefreshProfile(ctx context.Context, contact *wechat.ContactInfo) error {
+	return pm.updateProfile(ctx, contact, true)
+}
+
+func (pm *PuppetManager) updateProfile(ctx context.Context, contact *wechat.ContactInfo, force bool) error {
 	p, err := pm.GetOrCreate(ctx, contact)
 	if err != nil {
 		return err
@@ -208,7 +239,7 @@ func (pm *PuppetManager) UpdateProfile(ctx context.Context, contact *wechat.Cont
 	changed := false
 
 	// Update display name
-	if contact.Nickname != p.Nickname {
+	if force || contact.Nickname != p.Nickname {
 		if pm.intent == nil {
 			return fmt.Errorf("matrix client not initialized")
 		}
@@ -222,7 +253,7 @@ func (pm *PuppetManager) UpdateProfile(ctx context.Context, contact *wechat.Cont
 	}
 
 	// Update avatar
-	if contact.AvatarURL != "" && contact.AvatarURL != p.AvatarURL {
+	if contact.AvatarURL != "" && (force || contact.AvatarURL != p.AvatarURL) {
 		p.AvatarURL = contact.AvatarURL
 		p.AvatarSet = false
 		changed = true
@@ -279,6 +310,48 @@ func (pm *PuppetManager) GetByWeChatID(ctx context.Context, wechatID string) (*P
 	return p, nil
 }
 
+// All returns every known puppet, loading them from the database.
+// Puppets already in the cache are returned as the cached instance.
+func (pm *PuppetManager) All(ctx context.Context) ([]*Puppet, error) {
+	if pm.db == nil {
+		return nil, fmt.Errorf("puppet database store not initialized")
+	}
+	dbUsers, err := pm.db.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	puppets := make([]*Puppet, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		p, ok := pm.puppets[dbUser.WeChatID]
+		if !ok {
+			p = puppetFromDBUser(dbUser)
+			pm.puppets[dbUser.WeChatID] = p
+		}
+		puppets = append(puppets, p)
+	}
+	return puppets, nil
+}
+
+// SetAvatar records a newly uploaded avatar for a puppet and persists it.
+func (pm *PuppetManager) SetAvatar(ctx context.Context, p *Puppet, mxcURI string) error {
+	pm.mu.Lock()
+	p.AvatarMXC = mxcURI
+	p.AvatarSet = true
+	pm.mu.Unlock()
+
+	if pm.db == nil {
+		return nil
+	}
+	if err := pm.db.UpdateAvatar(ctx, p.WeChatID, mxcURI, true); err != nil {
+		return fmt.Errorf("save puppet avatar: %w", err)
+	}
+	return nil
+}
+
 // GetByMatrixID returns a puppet by Matrix user ID.
 func (pm *PuppetManager) GetByMatrixID(ctx context.Context, matrixID string) (*Puppet, error) {
 	wechatID := pm.matrixIDToWeChatID(matrixID)
@@ -306,13 +379,69 @@ func (pm *PuppetManager) matrixIDToWeChatID(matrixID string) string {
 	return matrixID[len(prefix) : len(matrixID)-len(suffix)]
 }
 
+// SetOfficialAccountTemplate sets the display name template used for
+// official account (gh_) puppets. Empty uses the regular template.
+func (pm *PuppetManager) SetOfficialAccountTemplate(tmpl string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.oaTempl = parseDisplayNameTemplate(tmpl)
+}
+
+// displayNameData is what display name templates are executed with. Nickname
+// is the contact's own nickname, never the remark; it falls back to Wxid, and
+// Remark to Nickname, when empty, so "{{.Remark}}" names a contact the way
+// the user sees them in WeChat. Configs with the old "{{.Nickname}} (WeChat)"
+// default are migrated to that by config.Validate.
+type displayNameData struct {
+	Nickname string
+	Remark   string
+	Alias    string
+	City     string
+	Wxid     string
+}
+
+// parseDisplayNameTemplate parses a display name template. It returns nil for
+// an empty or invalid template; config.Validate rejects invalid ones.
+func parseDisplayNameTemplate(tmpl string) *template.Template {
+	if tmpl == "" {
+		return nil
+	}
+	t, err := template.New("displayname").Parse(tmpl)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
 // formatDisplayName formats the display name for a puppet using the template.
+// Official accounts use their own template so they stand out from contacts.
 func (pm *PuppetManager) formatDisplayName(contact *wechat.ContactInfo) string {
-	name := contact.Nickname
-	if contact.Remark != "" {
-		name = contact.Remark
+	data := displayNameData{
+		Nickname: contact.Nickname,
+		Remark:   contact.Remark,
+		Alias:    contact.Alias,
+		City:     contact.City,
+		Wxid:     contact.UserID,
+	}
+	if data.Nickname == "" {
+		data.Nickname = data.Wxid
+	}
+	if data.Remark == "" {
+		data.Remark = data.Nickname
+	}
+
+	tmpl := pm.dnTempl
+	if wechat.IsOfficialAccountID(contact.UserID) && pm.oaTempl != nil {
+		tmpl = pm.oaTempl
+	}
+	if tmpl == nil {
+		return data.Remark
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return data.Remark
 	}
-	return strings.ReplaceAll(pm.dnTempl, "{{.Nickname}}", name)
+	return sb.String()
 }
 
 // IsPuppet returns true if the Matrix user ID corresponds to a puppet user.
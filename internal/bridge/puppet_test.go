@@ -14,7 +14,7 @@ func newTestPuppetManager() *PuppetManager {
 	return NewPuppetManager(
 		"example.com",
 		"wechat_{{.}}",
-		"{{.Nickname}} (WeChat)",
+		"{{.Remark}} (WeChat)",
 		nil,
 		nil,
 	)
@@ -112,6 +112,59 @@ func TestPuppetManager_FormatDisplayName(t *testing.T) {
 	}
 }
 
+func TestPuppetManager_FormatDisplayName_OfficialAccount(t *testing.T) {
+	pm := newTestPuppetManager()
+	pm.SetOfficialAccountTemplate("{{.Nickname}} (Official Account)")
+
+	tests := []struct {
+		userID   string
+		nickname string
+		expected string
+	}{
+		{"gh_3dfda90e39d6", "China Daily", "China Daily (Official Account)"},
+		{"gh_3dfda90e39d6", "", "gh_3dfda90e39d6 (Official Account)"},
+		{"wxid_alice", "Alice", "Alice (WeChat)"},
+	}
+
+	for _, tc := range tests {
+		result := pm.formatDisplayName(&wechat.ContactInfo{UserID: tc.userID, Nickname: tc.nickname})
+		if result != tc.expected {
+			t.Errorf("formatDisplayName(id=%q, nick=%q) = %q, want %q",
+				tc.userID, tc.nickname, result, tc.expected)
+		}
+	}
+}
+
+func TestPuppetManager_FormatDisplayName_ContactFields(t *testing.T) {
+	pm := NewPuppetManager("example.com", "wechat_{{.}}", "{{.Remark}} ({{.Nickname}})", nil, nil)
+
+	tests := []struct {
+		contact  wechat.ContactInfo
+		expected string
+	}{
+		{wechat.ContactInfo{UserID: "wxid_a", Nickname: "Tom", Remark: "Tom from work"}, "Tom from work (Tom)"},
+		{wechat.ContactInfo{UserID: "wxid_b", Nickname: "Tom"}, "Tom (Tom)"},
+		{wechat.ContactInfo{UserID: "wxid_c"}, "wxid_c (wxid_c)"},
+	}
+	for _, tc := range tests {
+		if result := pm.formatDisplayName(&tc.contact); result != tc.expected {
+			t.Errorf("formatDisplayName(%+v) = %q, want %q", tc.contact, result, tc.expected)
+		}
+	}
+
+	pm = NewPuppetManager("example.com", "wechat_{{.}}", "{{.Nickname}} [{{.Alias}}, {{.City}}] {{.Wxid}}", nil, nil)
+	contact := &wechat.ContactInfo{UserID: "wxid_d", Nickname: "Tom", Alias: "tom88", City: "Shenzhen"}
+	if result := pm.formatDisplayName(contact); result != "Tom [tom88, Shenzhen] wxid_d" {
+		t.Errorf("formatDisplayName with all fields = %q", result)
+	}
+
+	// A template that fails to execute falls back to the remark or nickname.
+	pm = NewPuppetManager("example.com", "wechat_{{.}}", "{{.Missing}}", nil, nil)
+	if result := pm.formatDisplayName(contact); result != "Tom" {
+		t.Errorf("formatDisplayName with a broken template = %q, want %q", result, "Tom")
+	}
+}
+
 func TestPuppetManager_CustomTemplate(t *testing.T) {
 	pm := NewPuppetManager(
 		"m.si46.world",
@@ -172,8 +225,8 @@ func TestPuppetManager_NewPuppetManager(t *testing.T) {
 	if pm.template != "wechat_{{.}}" {
 		t.Errorf("template: %s", pm.template)
 	}
-	if pm.dnTempl != "{{.Nickname}} (WeChat)" {
-		t.Errorf("dnTempl: %s", pm.dnTempl)
+	if pm.dnTempl == nil || pm.dnTempl.Root.String() != "{{.Remark}} (WeChat)" {
+		t.Errorf("dnTempl: %v", pm.dnTempl)
 	}
 	if pm.puppets == nil {
 		t.Error("puppets map should be initialized")
@@ -0,0 +1,231 @@
+package bridge
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// maxMappingBodyLength caps the body stored with a message mapping, in runes.
+// Reply fallbacks only need the start of the replied-to message.
+const maxMappingBodyLength = 500
+
+// appMsgTypeQuote is the <appmsg><type> WeChat uses for a reply that quotes
+// an earlier message (引用).
+const appMsgTypeQuote = 57
+
+// quotedMessage describes a WeChat quote reply and the message it quotes.
+type quotedMessage struct {
+	Text string // the reply itself
+
+	MsgID      string         // server ID of the quoted message
+	Type       wechat.MsgType // type of the quoted message
+	SenderName string
+	Content    string // quoted text, only meaningful for text messages
+}
+
+type quoteXML struct {
+	AppMsg struct {
+		Title    string `xml:"title"`
+		Type     int    `xml:"type"`
+		ReferMsg *struct {
+			Type        int    `xml:"type"`
+			SvrID       string `xml:"svrid"`
+			FromUsr     string `xml:"fromusr"`
+			DisplayName string `xml:"displayname"`
+			Content     string `xml:"content"`
+		} `xml:"refermsg"`
+	} `xml:"appmsg"`
+}
+
+// parseQuote detects quote replies (appmsg type 57). Returns nil for any
+// other message.
+func parseQuote(msg *wechat.Message) *quotedMessage {
+	if msg.Type != wechat.MsgLink {
+		return nil
+	}
+	raw := msg.Extra["xml"]
+	if raw == "" {
+		raw = msg.Content
+	}
+	if !strings.Contains(raw, "<refermsg") {
+		return nil
+	}
+
+	var parsed quoteXML
+	if err := xml.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil
+	}
+	if parsed.AppMsg.Type != appMsgTypeQuote || parsed.AppMsg.ReferMsg == nil {
+		return nil
+	}
+
+	ref := parsed.AppMsg.ReferMsg
+	sender := ref.DisplayName
+	if sender == "" {
+		sender = ref.FromUsr
+	}
+	return &quotedMessage{
+		Text:       parsed.AppMsg.Title,
+		MsgID:      ref.SvrID,
+		Type:       wechat.MsgType(ref.Type),
+		SenderName: sender,
+		Content:    ref.Content,
+	}
+}
+
+// quotedMediaDescription describes a quoted non-text message, e.g. "an image".
+// Returns "" for text and unknown types.
+func quotedMediaDescription(t wechat.MsgType) string {
+	switch t {
+	case wechat.MsgImage:
+		return "an image"
+	case wechat.MsgVoice:
+		return "a voice message"
+	case wechat.MsgVideo:
+		return "a video"
+	case wechat.MsgEmoji:
+		return "a sticker"
+	case wechat.MsgLocation:
+		return "a location"
+	case wechat.MsgFile:
+		return "a file"
+	case wechat.MsgLink:
+		return "an attachment"
+	case wechat.MsgContact, wechat.MsgRecommend:
+		return "a contact card"
+	}
+	return ""
+}
+
+// summary is the description of the quoted message used in
+// reply fallbacks, e.g. "Alice sent an image" or "Alice: hello".
+func (q *quotedMessage) summary() string {
+	sender := q.SenderName
+	if sender == "" {
+		sender = "Someone"
+	}
+	if desc := quotedMediaDescription(q.Type); desc != "" {
+		return fmt.Sprintf("%s sent %s", sender, desc)
+	}
+	return fmt.Sprintf("%s: %s", sender, q.Content)
+}
+
+// setQuoteContent renders a quote reply into Matrix message content with a
+// reply fallback. When eventLink is set, the fallback links to the quoted
+// Matrix event.
+func setQuoteContent(content map[string]interface{}, q *quotedMessage, eventLink string) {
+	summary := q.summary()
+
+	var quoted []string
+	for _, line := range strings.Split(summary, "\n") {
+		quoted = append(quoted, "> "+line)
+	}
+	content["msgtype"] = "m.text"
+	content["body"] = strings.Join(quoted, "\n") + "\n\n" + q.Text
+
+	htmlSummary := strings.ReplaceAll(html.EscapeString(summary), "\n", "<br/>")
+	if eventLink != "" {
+		htmlSummary = fmt.Sprintf(`<a href="%s">In reply to</a> %s`, html.EscapeString(eventLink), htmlSummary)
+	}
+	content["format"] = "org.matrix.custom.html"
+	content["formatted_body"] = fmt.Sprintf("<mx-reply><blockquote>%s</blockquote></mx-reply>%s",
+		htmlSummary, strings.ReplaceAll(html.EscapeString(q.Text), "\n", "<br/>"))
+}
+
+// setReplyFallback adds a rich reply fallback quoting the replied-to message
+// to text content, so clients that don't fetch the referenced event still
+// show what is being answered. Nothing is added for media content or when
+// nothing is known about the replied-to message.
+func setReplyFallback(content map[string]interface{}, roomID string, replyTo *database.MessageMapping, senderMXID string) {
+	switch content["msgtype"] {
+	case "m.text", "m.notice", "m.emote":
+	default:
+		return
+	}
+	quoted := replyTo.Body
+	if desc := quotedMediaDescription(wechat.MsgType(replyTo.MsgType)); desc != "" {
+		quoted = "sent " + desc
+	}
+	if quoted == "" {
+		return
+	}
+
+	body, _ := content["body"].(string)
+	htmlBody, _ := content["formatted_body"].(string)
+	if format, _ := content["format"].(string); format != "org.matrix.custom.html" || htmlBody == "" {
+		htmlBody = strings.ReplaceAll(html.EscapeString(body), "\n", "<br/>")
+	}
+
+	lines := strings.Split(quoted, "\n")
+	lines[0] = fmt.Sprintf("<%s> %s", senderMXID, lines[0])
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	content["body"] = strings.Join(lines, "\n") + "\n\n" + body
+	content["format"] = "org.matrix.custom.html"
+	content["formatted_body"] = fmt.Sprintf(
+		`<mx-reply><blockquote><a href="%s">In reply to</a> <a href="%s">%s</a><br/>%s</blockquote></mx-reply>%s`,
+		html.EscapeString(matrixEventLink(roomID, replyTo.MatrixEventID)),
+		html.EscapeString(matrixUserLink(senderMXID)), html.EscapeString(senderMXID),
+		strings.ReplaceAll(html.EscapeString(quoted), "\n", "<br/>"), htmlBody)
+}
+
+// mappingBody returns the body to store with a message mapping: the plain
+// text without the reply fallback of a reply, truncated to
+// maxMappingBodyLength.
+func mappingBody(content map[string]interface{}) string {
+	body, _ := content["body"].(string)
+	if relatesTo, ok := content["m.relates_to"].(map[string]interface{}); ok && relatesTo["m.in_reply_to"] != nil {
+		body = stripReplyFallback(body)
+	}
+	if runes := []rune(body); len(runes) > maxMappingBodyLength {
+		body = string(runes[:maxMappingBodyLength]) + "…"
+	}
+	return body
+}
+
+// stripReplyFallback removes the quoted "> " lines and the blank line that
+// start the body of a reply.
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	return strings.Join(lines[i:], "\n")
+}
+
+func (p *defaultMessageProcessor) quoteToMatrix(q *quotedMessage) *MatrixEventContent {
+	content := map[string]interface{}{}
+	setQuoteContent(content, q, "")
+	return &MatrixEventContent{
+		EventType: "m.room.message",
+		Content:   content,
+	}
+}
+
+// matrixEventLink returns a matrix.to permalink to an event.
+func matrixEventLink(roomID, eventID string) string {
+	return fmt.Sprintf("https://matrix.to/#/%s/%s", roomID, eventID)
+}
+
+// matrixUserLink returns a matrix.to permalink to a user.
+func matrixUserLink(userID string) string {
+	return fmt.Sprintf("https://matrix.to/#/%s", userID)
+}
+
+// matrixRoomLink returns a matrix.to permalink to a room.
+func matrixRoomLink(roomID string) string {
+	return fmt.Sprintf("https://matrix.to/#/%s", roomID)
+}
@@ -0,0 +1,161 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+const testQuoteImageXML = `<msg><appmsg appid="" sdkver="0"><title>nice photo</title><type>57</type><refermsg><type>3</type><svrid>7001</svrid><fromusr>wxid_alice</fromusr><displayname>Alice</displayname><content>&lt;msg&gt;&lt;img length="1024"/&gt;&lt;/msg&gt;</content></refermsg></appmsg></msg>`
+
+func TestParseQuote_Image(t *testing.T) {
+	q := parseQuote(&wechat.Message{Type: wechat.MsgLink, Content: testQuoteImageXML})
+	if q == nil {
+		t.Fatal("expected quote to be detected")
+	}
+	if q.Text != "nice photo" || q.MsgID != "7001" || q.Type != wechat.MsgImage || q.SenderName != "Alice" {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+}
+
+func TestParseQuote_IgnoresOtherAppMsgs(t *testing.T) {
+	if q := parseQuote(&wechat.Message{Type: wechat.MsgLink, Content: testLiveLocationStartXML}); q != nil {
+		t.Fatalf("unexpected quote: %+v", q)
+	}
+	if q := parseQuote(&wechat.Message{Type: wechat.MsgText, Content: testQuoteImageXML}); q != nil {
+		t.Fatalf("text message parsed as quote: %+v", q)
+	}
+}
+
+func TestDefaultProcessor_QuotedImage(t *testing.T) {
+	p := &defaultMessageProcessor{}
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: testQuoteImageXML,
+	})
+	if err != nil {
+		t.Fatalf("WeChatToMatrix: %v", err)
+	}
+	if body := content.Content["body"]; body != "> Alice sent an image\n\nnice photo" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestDefaultProcessor_QuotedText(t *testing.T) {
+	p := &defaultMessageProcessor{}
+	content, _ := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:    wechat.MsgLink,
+		Content: `<msg><appmsg><title>agreed</title><type>57</type><refermsg><type>1</type><svrid>7002</svrid><displayname>Bob</displayname><content>lunch at noon?</content></refermsg></appmsg></msg>`,
+	})
+	if body := content.Content["body"]; body != "> Bob: lunch at noon?\n\nagreed" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestEventRouter_ResolveReply_QuotedImageLinksMatrixEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testMessageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id = $2`)).
+		WithArgs("7001", "!room:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("7001", "$image:test", "!room:test", "wxid_alice", int(wechat.MsgImage), now, now, ""))
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:      slog.Default(),
+		Puppets:  newTestPuppetManager(),
+		Messages: database.NewMessageMappingStore(db),
+	})
+
+	msg := &wechat.Message{Type: wechat.MsgLink, Content: testQuoteImageXML}
+	content, _ := (&defaultMessageProcessor{}).WeChatToMatrix(context.Background(), msg)
+	er.resolveReply(context.Background(), msg, "!room:test", content)
+
+	relatesTo, _ := content.Content["m.relates_to"].(map[string]interface{})
+	inReplyTo, _ := relatesTo["m.in_reply_to"].(map[string]interface{})
+	if inReplyTo["event_id"] != "$image:test" {
+		t.Fatalf("m.relates_to = %v, want reply to $image:test", content.Content["m.relates_to"])
+	}
+	formatted, _ := content.Content["formatted_body"].(string)
+	if !strings.Contains(formatted, `href="https://matrix.to/#/!room:test/$image:test"`) ||
+		!strings.Contains(formatted, "Alice sent an image") {
+		t.Fatalf("formatted_body = %q", formatted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_ResolveReply_AddsRichReplyFallback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testMessageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id = $2`)).
+		WithArgs("7003", "!room:test").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("7003", "$orig:test", "!room:test", "wxid_bob", int(wechat.MsgText), now, now, "dinner <b>at</b> 7?\nor 8"))
+
+	er := NewEventRouter(EventRouterConfig{
+		Log:      slog.Default(),
+		Puppets:  newTestPuppetManager(),
+		Messages: database.NewMessageMappingStore(db),
+	})
+
+	msg := &wechat.Message{Type: wechat.MsgText, Content: "7 works", ReplyTo: "7003"}
+	content, _ := (&defaultMessageProcessor{}).WeChatToMatrix(context.Background(), msg)
+	er.resolveReply(context.Background(), msg, "!room:test", content)
+
+	sender := er.puppets.wechatIDToMatrixID("wxid_bob")
+	wantBody := "> <" + sender + "> dinner <b>at</b> 7?\n> or 8\n\n7 works"
+	if body := content.Content["body"]; body != wantBody {
+		t.Fatalf("body = %q, want %q", body, wantBody)
+	}
+	wantHTML := `<mx-reply><blockquote><a href="https://matrix.to/#/!room:test/$orig:test">In reply to</a> ` +
+		`<a href="https://matrix.to/#/` + sender + `">` + sender + `</a><br/>dinner &lt;b&gt;at&lt;/b&gt; 7?<br/>or 8</blockquote></mx-reply>7 works`
+	if formatted := content.Content["formatted_body"]; formatted != wantHTML {
+		t.Fatalf("formatted_body = %q, want %q", formatted, wantHTML)
+	}
+	if mappingBody(content.Content) != "7 works" {
+		t.Fatalf("stored body should not include the fallback: %q", mappingBody(content.Content))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMappingBody(t *testing.T) {
+	long := strings.Repeat("字", maxMappingBodyLength+10)
+	reply := map[string]interface{}{"m.in_reply_to": map[string]interface{}{"event_id": "$orig:test"}}
+	tests := []struct {
+		body      string
+		relatesTo map[string]interface{}
+		want      string
+	}{
+		{"hello", nil, "hello"},
+		{"> <@a:test> hi\n> there\n\nreply", reply, "reply"},
+		{"> quoted by hand\n\ncomment", nil, "> quoted by hand\n\ncomment"},
+		{long, nil, string([]rune(long)[:maxMappingBodyLength]) + "…"},
+	}
+	for _, tt := range tests {
+		content := map[string]interface{}{"body": tt.body}
+		if tt.relatesTo != nil {
+			content["m.relates_to"] = tt.relatesTo
+		}
+		if got := mappingBody(content); got != tt.want {
+			t.Errorf("mappingBody(%.20q) = %.20q, want %.20q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Emoji reaction handling for bridge.message_handling.emoji_reactions.
+const (
+	EmojiReactionsReaction = "reaction"
+	EmojiReactionsNotice   = "notice"
+	EmojiReactionsIgnore   = "ignore"
+)
+
+// OnMessageReaction bridges a WeChat emoji reaction (表情回应) to the Matrix
+// event of the message reacted to, as an m.reaction by the reacting user's
+// puppet or as a notice, and redacts the m.reaction when it is withdrawn.
+// Pats are handled as messages; see bridgePatAsReaction.
+func (er *EventRouter) OnMessageReaction(ctx context.Context, reaction *wechat.MessageReaction) error {
+	if er.emojiReactions == EmojiReactionsIgnore || reaction.Emoji == "" {
+		return nil
+	}
+	if reaction.ChatID != "" && !er.chatBridged(reaction.ChatID) {
+		return nil
+	}
+	if er.messages == nil {
+		er.log.Warn("message store not initialized, cannot bridge reaction", "msg_id", reaction.MsgID)
+		return nil
+	}
+
+	target, err := er.findMessageInChat(ctx, reaction.ChatID, reaction.MsgID)
+	if err != nil {
+		return fmt.Errorf("find reacted message: %w", err)
+	}
+	if target == nil {
+		er.log.Debug("ignoring reaction to unknown message", "msg_id", reaction.MsgID)
+		return nil
+	}
+	if reaction.Removed {
+		return er.redactReaction(ctx, target.MatrixRoomID, reaction)
+	}
+	// Reactions from the user's own phone have no puppet to react as
+	if bridgeUser, err := er.findBridgeUser(ctx); err == nil && bridgeUser != nil && bridgeUser.WeChatID == reaction.UserID {
+		return nil
+	}
+	puppet, err := er.puppets.GetOrCreate(ctx, &wechat.ContactInfo{
+		UserID:   reaction.UserID,
+		Nickname: reaction.UserID,
+	})
+	if err != nil {
+		return fmt.Errorf("get puppet for reaction: %w", err)
+	}
+
+	if er.emojiReactions == EmojiReactionsNotice {
+		content := map[string]interface{}{
+			"msgtype": "m.notice",
+			"body":    "Reacted with " + reaction.Emoji,
+			"m.relates_to": map[string]interface{}{
+				"m.in_reply_to": map[string]interface{}{
+					"event_id": target.MatrixEventID,
+				},
+			},
+		}
+		setReplyFallback(content, target.MatrixRoomID, target, er.mappingSenderMXID(target.Sender))
+		if _, err := er.matrixClient.SendMessage(ctx, target.MatrixRoomID, puppet.MatrixUserID, "m.room.message", content); err != nil {
+			return fmt.Errorf("send reaction notice: %w", err)
+		}
+		return nil
+	}
+
+	eventID, err := er.matrixClient.SendReaction(ctx, target.MatrixRoomID, puppet.MatrixUserID, target.MatrixEventID, reaction.Emoji)
+	if err != nil {
+		return fmt.Errorf("send matrix reaction: %w", err)
+	}
+	if er.reactionEvents != nil {
+		if err := er.reactionEvents.Put(ctx, &database.ReactionEvent{
+			MatrixRoomID:  target.MatrixRoomID,
+			WeChatMsgID:   reaction.MsgID,
+			WeChatUserID:  reaction.UserID,
+			Emoji:         reaction.Emoji,
+			MatrixEventID: eventID,
+		}); err != nil {
+			er.log.Warn("failed to store bridged reaction", "error", err, "msg_id", reaction.MsgID)
+		}
+	}
+	er.log.Debug("forwarded WeChat reaction to Matrix", "msg_id", reaction.MsgID, "matrix_event", eventID)
+	return nil
+}
+
+// redactReaction redacts the Matrix reaction bridged from a withdrawn WeChat
+// emoji reaction in roomID.
+func (er *EventRouter) redactReaction(ctx context.Context, roomID string, reaction *wechat.MessageReaction) error {
+	if er.reactionEvents == nil {
+		return nil
+	}
+	evt, err := er.reactionEvents.Take(ctx, roomID, reaction.MsgID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return fmt.Errorf("find withdrawn reaction: %w", err)
+	}
+	if evt == nil {
+		er.log.Debug("ignoring withdrawal of unknown reaction", "msg_id", reaction.MsgID, "user_id", reaction.UserID)
+		return nil
+	}
+	if err := er.matrixClient.RedactEvent(ctx, roomID, evt.MatrixEventID, "reaction withdrawn"); err != nil {
+		return fmt.Errorf("redact matrix reaction: %w", err)
+	}
+	return nil
+}
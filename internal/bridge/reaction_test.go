@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withReactions bridges wxid_bob's reactions, with the message and
+// reaction event stores wired.
+func withReactions(cfg *EventRouterConfig, db *sql.DB) {
+	cfg.Puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+	cfg.Messages = database.NewMessageMappingStore(db)
+	cfg.ReactionEvents = database.NewReactionEventStore(db)
+}
+
+// expectReactedMessage expects the lookup of the message msg1 reacted to.
+func expectReactedMessage(mock sqlmock.Sqlmock) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + testMessageMappingColumns + ` FROM message_mapping WHERE wechat_msg_id = $1 ORDER BY created_at DESC LIMIT 1`)).
+		WithArgs("msg1").
+		WillReturnRows(sqlmock.NewRows(testMessageMappingColumnNames).AddRow("msg1", "$event:test", "!room:test", "@user:test", int(wechat.MsgText), now, now, "dinner at 7?"))
+}
+
+func TestEventRouter_OnMessageReaction_SendsAndRedactsReaction(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withReactions)
+	expectReactedMessage(mock)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍", "$reaction:test").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	reaction := &wechat.MessageReaction{MsgID: "msg1", ChatID: "wxid_bob", UserID: "wxid_bob", Emoji: "👍"}
+	if err := er.OnMessageReaction(ctx, reaction); err != nil {
+		t.Fatalf("OnMessageReaction: %v", err)
+	}
+	want := testReaction{roomID: "!room:test", sender: "@wechat_wxid_bob:example.com", eventID: "$event:test", key: "👍"}
+	if len(matrix.reactions) != 1 || matrix.reactions[0] != want {
+		t.Fatalf("reactions = %+v, want %+v", matrix.reactions, want)
+	}
+
+	// The reaction is redacted from the stored event, so also after a restart
+	expectReactedMessage(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT matrix_event_id FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id"}).AddRow("$reaction:test"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	withdrawn := *reaction
+	withdrawn.Removed = true
+	if err := er.OnMessageReaction(ctx, &withdrawn); err != nil {
+		t.Fatalf("OnMessageReaction (withdrawn): %v", err)
+	}
+	if len(matrix.redactions) != 1 || matrix.redactions[0].roomID != "!room:test" || matrix.redactions[0].eventID != "$reaction:test" {
+		t.Fatalf("redactions = %+v, want the reaction redacted", matrix.redactions)
+	}
+
+	// Withdrawing it again has nothing left to redact
+	expectReactedMessage(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT matrix_event_id FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id"}))
+	if err := er.OnMessageReaction(ctx, &withdrawn); err != nil {
+		t.Fatalf("OnMessageReaction (withdrawn again): %v", err)
+	}
+	if len(matrix.redactions) != 1 {
+		t.Fatalf("redactions = %+v, want one", matrix.redactions)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_OnMessageReaction_Notice(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withReactions)
+	expectReactedMessage(mock)
+	er.emojiReactions = EmojiReactionsNotice
+
+	reaction := &wechat.MessageReaction{MsgID: "msg1", ChatID: "wxid_bob", UserID: "wxid_bob", Emoji: "❤️"}
+	if err := er.OnMessageReaction(context.Background(), reaction); err != nil {
+		t.Fatalf("OnMessageReaction: %v", err)
+	}
+	if len(matrix.reactions) != 0 || len(matrix.sent) != 1 {
+		t.Fatalf("reactions = %+v, sent = %d; want a notice", matrix.reactions, len(matrix.sent))
+	}
+	content := matrix.sent[0].content.(map[string]interface{})
+	if content["msgtype"] != "m.notice" || matrix.sent[0].sender != "@wechat_wxid_bob:example.com" {
+		t.Fatalf("unexpected notice: %+v", matrix.sent[0])
+	}
+	if got, want := content["body"], "> <@user:test> dinner at 7?\n\nReacted with ❤️"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+}
+
+func TestEventRouter_OnMessageReaction_Ignore(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er := NewEventRouter(EventRouterConfig{
+		Log:            slog.Default(),
+		Puppets:        newTestPuppetManager(),
+		MatrixClient:   matrix,
+		EmojiReactions: EmojiReactionsIgnore,
+	})
+
+	reaction := &wechat.MessageReaction{MsgID: "msg1", UserID: "wxid_bob", Emoji: "👍"}
+	if err := er.OnMessageReaction(context.Background(), reaction); err != nil {
+		t.Fatalf("OnMessageReaction: %v", err)
+	}
+	if len(matrix.reactions) != 0 || len(matrix.sent) != 0 {
+		t.Fatalf("ignored reaction was bridged: reactions = %+v, sent = %d", matrix.reactions, len(matrix.sent))
+	}
+}
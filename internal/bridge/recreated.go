@@ -0,0 +1,115 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Re-created group handling for bridge.message_handling.recreated_groups.
+const (
+	RecreatedGroupsTombstone = "tombstone"
+	RecreatedGroupsIgnore    = "ignore"
+)
+
+// recreatedGroupTombstoneBody is the message of the tombstone left in the
+// room of a group WeChat re-created under a new ID.
+const recreatedGroupTombstoneBody = "This WeChat group was re-created. The conversation continues in a new room."
+
+// recreatedGroupRoom returns the bridge user's room of the group chatID
+// replaces, when WeChat re-created the group under a new ID and the old
+// group was bridged. It returns nil otherwise, or if re-created groups are
+// ignored.
+//
+// Providers may name the old ID in info.PreviousID; none of the current ones
+// can, so the old group is otherwise recognised by its room: a group room of
+// the same name whose last known members are exactly the new group's
+// members. info.PreviousID is then set to the old group's ID.
+func (er *EventRouter) recreatedGroupRoom(ctx context.Context, provider wechat.Provider, bridgeUser, chatID string, info *wechat.ContactInfo) *database.RoomMapping {
+	if info == nil || info.PreviousID == chatID || er.recreatedGroups == RecreatedGroupsIgnore {
+		return nil
+	}
+	if info.PreviousID == "" {
+		room := er.findRecreatedGroupRoom(ctx, provider, bridgeUser, chatID, info.Nickname)
+		if room != nil {
+			info.PreviousID = room.WeChatChatID
+		}
+		return room
+	}
+	room, err := er.rooms.GetByWeChatChat(ctx, info.PreviousID, bridgeUser)
+	if err != nil {
+		er.log.Warn("failed to look up room of re-created group", "error", err, "group_id", chatID, "previous_id", info.PreviousID)
+		return nil
+	}
+	return room
+}
+
+// findRecreatedGroupRoom looks for the room of the group chatID was
+// re-created from: another group room of the bridge user named name, whose
+// stored members are the members chatID has now. Groups of fewer than
+// three members are never matched, nor is a name shared by several rooms.
+func (er *EventRouter) findRecreatedGroupRoom(ctx context.Context, provider wechat.Provider, bridgeUser, chatID, name string) *database.RoomMapping {
+	if name == "" || provider == nil || er.groupMembers == nil {
+		return nil
+	}
+	rooms, err := er.rooms.GetAllForUser(ctx, bridgeUser)
+	if err != nil {
+		er.log.Warn("failed to list rooms for re-created group check", "error", err, "user", bridgeUser)
+		return nil
+	}
+	var candidate *database.RoomMapping
+	for _, r := range rooms {
+		if !r.IsGroup || r.WeChatChatID == chatID || r.Name != name {
+			continue
+		}
+		if candidate != nil {
+			return nil
+		}
+		candidate = r
+	}
+	if candidate == nil {
+		return nil
+	}
+
+	oldMembers, err := er.groupMembers.GetByGroup(ctx, candidate.WeChatChatID)
+	if err != nil {
+		er.log.Warn("failed to list members of possibly re-created group", "error", err, "group_id", candidate.WeChatChatID)
+		return nil
+	}
+	newMembers, err := provider.GetGroupMembers(ctx, chatID)
+	if err != nil {
+		er.log.Warn("failed to get group members", "error", err, "group_id", chatID)
+		return nil
+	}
+	if len(oldMembers) < 3 || len(oldMembers) != len(newMembers) {
+		return nil
+	}
+	current := make(map[string]bool, len(newMembers))
+	for _, m := range newMembers {
+		current[m.UserID] = true
+	}
+	for _, m := range oldMembers {
+		if !current[m.WeChatID] {
+			return nil
+		}
+	}
+	er.log.Info("group looks re-created from a bridged group",
+		"group_id", chatID, "previous_id", candidate.WeChatChatID, "room_id", candidate.MatrixRoomID)
+	return candidate
+}
+
+// tombstoneRoom points old to its replacement room with an m.room.tombstone,
+// so Matrix clients link the two and offer to follow the conversation.
+func (er *EventRouter) tombstoneRoom(ctx context.Context, old *database.RoomMapping, replacementRoomID string) {
+	err := er.matrixClient.SendStateEvent(ctx, old.MatrixRoomID, "m.room.tombstone", "", map[string]interface{}{
+		"body":             recreatedGroupTombstoneBody,
+		"replacement_room": replacementRoomID,
+	})
+	if err != nil {
+		er.log.Warn("failed to tombstone room", "error", err, "room_id", old.MatrixRoomID)
+		return
+	}
+	er.log.Info("tombstoned room of re-created group",
+		"room_id", old.MatrixRoomID, "replacement_room", replacementRoomID, "previous_id", old.WeChatChatID)
+}
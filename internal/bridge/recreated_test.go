@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withRecreatedGroup reports 456@chatroom as the recreation of 123@chatroom
+// and handles it per mode, with the room and group member stores wired.
+func withRecreatedGroup(mode string) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		provider := newMockProvider("padpro", 2)
+		provider.groupInfo = &wechat.ContactInfo{UserID: "456@chatroom", Nickname: "Team", IsGroup: true, PreviousID: "123@chatroom"}
+		cfg.Provider = provider
+		cfg.Rooms = database.NewRoomMappingStore(db)
+		cfg.GroupMembers = database.NewGroupMemberStore(db)
+		cfg.RecreatedGroups = mode
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_TombstonesRecreatedGroup(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRecreatedGroup(RecreatedGroupsTombstone))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1`)).
+		WithArgs("456@chatroom", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1`)).
+		WithArgs("123@chatroom", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("123@chatroom", "!old:test", "@user:test", true, "Team", "", "", false, true, false, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WithArgs("456@chatroom", "!room:test", "@user:test", true, "Team", "", "", false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	room, err := er.getOrCreateRoom(context.Background(), "456@chatroom", true, "@user:test")
+	if err != nil {
+		t.Fatalf("getOrCreateRoom: %v", err)
+	}
+	if room.MatrixRoomID != "!room:test" {
+		t.Fatalf("room = %+v", room)
+	}
+	if len(matrix.createdRooms) != 1 || matrix.createdRooms[0].Predecessor != "!old:test" {
+		t.Fatalf("new room should name !old:test as its predecessor: %+v", matrix.createdRooms)
+	}
+	if len(matrix.stateEvents) != 1 {
+		t.Fatalf("state events = %+v, want one tombstone", matrix.stateEvents)
+	}
+	tombstone := matrix.stateEvents[0]
+	content, _ := tombstone.content.(map[string]interface{})
+	if tombstone.roomID != "!old:test" || tombstone.eventType != "m.room.tombstone" || content["replacement_room"] != "!room:test" {
+		t.Fatalf("unexpected tombstone: %+v", tombstone)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_IgnoresRecreatedGroup(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRecreatedGroup(RecreatedGroupsIgnore))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1`)).
+		WithArgs("456@chatroom", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := er.getOrCreateRoom(context.Background(), "456@chatroom", true, "@user:test"); err != nil {
+		t.Fatalf("getOrCreateRoom: %v", err)
+	}
+	if matrix.createdRooms[0].Predecessor != "" || len(matrix.stateEvents) != 0 {
+		t.Fatalf("re-created group should be ignored: %+v, %+v", matrix.createdRooms[0], matrix.stateEvents)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_GetOrCreateRoom_RecognisesRecreatedGroupByMembers(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRecreatedGroup(RecreatedGroupsTombstone))
+	provider := er.provider.(*mockProvider)
+	provider.groupInfo.PreviousID = ""
+	provider.groupMembers = []*wechat.GroupMember{{UserID: "wxid_me"}, {UserID: "wxid_alice"}, {UserID: "wxid_bob"}}
+	for _, m := range provider.groupMembers {
+		er.puppets.puppets[m.UserID] = &Puppet{WeChatID: m.UserID, MatrixUserID: "@wechat_" + m.UserID + ":example.com"}
+	}
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE wechat_chat_id = $1`)).
+		WithArgs("456@chatroom", "@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE bridge_user = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("123@chatroom", "!old:test", "@user:test", true, "Team", "", "", false, true, false, now).
+			AddRow("789@chatroom", "!other:test", "@user:test", true, "Other", "", "", false, true, false, now))
+	members := sqlmock.NewRows([]string{"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at"})
+	for _, id := range []string{"wxid_bob", "wxid_me", "wxid_alice"} {
+		members.AddRow("123@chatroom", id, "", false, false, now)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM group_member WHERE group_id = $1`)).
+		WithArgs("123@chatroom").
+		WillReturnRows(members)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_mapping`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for range provider.groupMembers {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO group_member`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	if _, err := er.getOrCreateRoom(context.Background(), "456@chatroom", true, "@user:test"); err != nil {
+		t.Fatalf("getOrCreateRoom: %v", err)
+	}
+	if len(matrix.createdRooms) != 1 || matrix.createdRooms[0].Predecessor != "!old:test" || matrix.createdRooms[0].Name != "Team" {
+		t.Fatalf("new room should succeed !old:test under its name: %+v", matrix.createdRooms)
+	}
+	if len(matrix.stateEvents) != 1 || matrix.stateEvents[0].roomID != "!old:test" || matrix.stateEvents[0].eventType != "m.room.tombstone" {
+		t.Fatalf("state events = %+v, want a tombstone in !old:test", matrix.stateEvents)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEventRouter_FindRecreatedGroupRoom_RequiresSameMembers(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withRecreatedGroup(RecreatedGroupsTombstone))
+	provider := er.provider.(*mockProvider)
+	provider.groupMembers = []*wechat.GroupMember{{UserID: "wxid_me"}, {UserID: "wxid_alice"}, {UserID: "wxid_carol"}}
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE bridge_user = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("123@chatroom", "!old:test", "@user:test", true, "Team", "", "", false, true, false, now))
+	members := sqlmock.NewRows([]string{"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at"})
+	for _, id := range []string{"wxid_me", "wxid_alice", "wxid_bob"} {
+		members.AddRow("123@chatroom", id, "", false, false, now)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM group_member WHERE group_id = $1`)).
+		WithArgs("123@chatroom").
+		WillReturnRows(members)
+
+	if room := er.findRecreatedGroupRoom(context.Background(), provider, "@user:test", "456@chatroom", "Team"); room != nil {
+		t.Fatalf("a same-named group with other members should not replace %s", room.MatrixRoomID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
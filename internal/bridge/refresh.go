@@ -0,0 +1,119 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// RefreshChat re-fetches a single chat's info from WeChat and pushes it to
+// Matrix even if the bridge thinks it is current: a contact's puppet gets its
+// display name and avatar set again, a group's room its name, avatar and
+// topic. It returns the chat's info, or nil if WeChat doesn't know the chat.
+func (er *EventRouter) RefreshChat(ctx context.Context, provider wechat.Provider, bridgeUser, chatID string) (*wechat.ContactInfo, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("no active provider")
+	}
+	ctx = context.WithValue(ctx, bridgeUserKey, bridgeUser)
+
+	if wechat.IsGroupID(chatID) {
+		return er.refreshGroup(ctx, provider, bridgeUser, chatID)
+	}
+
+	contact, err := provider.GetContactInfo(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("get contact info: %w", err)
+	}
+	if contact == nil {
+		return nil, nil
+	}
+	if err := er.puppets.RefreshProfile(ctx, contact); err != nil {
+		return nil, fmt.Errorf("refresh puppet: %w", err)
+	}
+	if contact.AvatarURL != "" {
+		if puppet, err := er.puppets.GetByWeChatID(ctx, contact.UserID); err == nil && puppet != nil {
+			er.syncPuppetAvatar(ctx, puppet, contact)
+		}
+	}
+	return contact, nil
+}
+
+func (er *EventRouter) refreshGroup(ctx context.Context, provider wechat.Provider, bridgeUser, groupID string) (*wechat.ContactInfo, error) {
+	info, err := provider.GetGroupInfo(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group info: %w", err)
+	}
+	if info == nil {
+		return nil, nil
+	}
+
+	room, err := er.rooms.GetByWeChatChat(ctx, groupID, bridgeUser)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil || er.matrixClient == nil {
+		return info, nil
+	}
+
+	if name := er.groupRoomName(ctx, bridgeUser, groupID, info); name != "" {
+		if err := er.matrixClient.SetRoomName(ctx, room.MatrixRoomID, name); err != nil {
+			er.log.Warn("failed to set room name", "error", err, "room_id", room.MatrixRoomID)
+		} else {
+			room.Name = name
+		}
+	}
+	er.syncGroupRoomInfo(ctx, provider, room, info)
+
+	if err := er.rooms.Upsert(ctx, room); err != nil {
+		return nil, fmt.Errorf("save room mapping: %w", err)
+	}
+	return info, nil
+}
+
+func (cp *CommandProcessor) cmdRefresh(ctx context.Context, ce *CommandEvent) error {
+	if len(ce.Args) > 1 {
+		ce.Reply("Usage: `%s refresh [room_id|wechat_id]`", cp.prefix)
+		return nil
+	}
+
+	// Without an argument, or given a Matrix room ID, refresh the room's chat.
+	chatID := ""
+	if len(ce.Args) == 1 && !strings.HasPrefix(ce.Args[0], "!") {
+		chatID = ce.Args[0]
+	} else {
+		roomID := ce.RoomID
+		if len(ce.Args) == 1 {
+			roomID = ce.Args[0]
+		}
+		if cp.router.rooms == nil {
+			return fmt.Errorf("room store not configured")
+		}
+		room, err := cp.router.rooms.GetByMatrixRoomID(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		if room == nil || room.BridgeUser != ce.Sender {
+			ce.Reply("%s is not one of your bridged WeChat rooms.", roomID)
+			return nil
+		}
+		chatID = room.WeChatChatID
+	}
+
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil {
+		return err
+	}
+	info, err := cp.router.RefreshChat(ctx, provider, ce.Sender, chatID)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		ce.Reply("Chat `%s` not found.", chatID)
+		return nil
+	}
+
+	ce.Reply("Refreshed %s.", contactDisplayName(info))
+	return nil
+}
@@ -0,0 +1,84 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func newRefreshTestCommandProcessor(t *testing.T, matrix *testMatrixClient, provider *mockProvider) (*CommandProcessor, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pm := NewPuppetManager("example.com", "wechat_{{.}}", "{{.Nickname}} (WeChat)", database.NewUserStore(db), matrix)
+	pm.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com", Nickname: "Old Bob", NameSet: true}
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      pm,
+		Provider:     provider,
+		MatrixClient: matrix,
+		Rooms:        database.NewRoomMappingStore(db),
+	})
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    er,
+		BotUserID: "@wechatbot:example.com",
+	})
+	return cp, mock
+}
+
+func TestCommandProcessor_RefreshUpdatesStalePuppetName(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := newMockProvider("padpro", 2)
+	provider.contacts = []*wechat.ContactInfo{{UserID: "wxid_bob", Nickname: "Bob"}}
+	cp, mock := newRefreshTestCommandProcessor(t, matrix, provider)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO wechat_user`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat refresh wxid_bob"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got := matrix.displayNames["@wechat_wxid_bob:example.com"]; got != "Bob (WeChat)" {
+		t.Fatalf("display name = %q, want %q", got, "Bob (WeChat)")
+	}
+	if reply := lastReply(t, matrix); reply != "Refreshed Bob." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCommandProcessor_RefreshCurrentRoomRequiresOwnRoom(t *testing.T) {
+	matrix := &testMatrixClient{}
+	cp, mock := newRefreshTestCommandProcessor(t, matrix, newMockProvider("padpro", 2))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!mgmt:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("wxid_bob", "!mgmt:test", "@other:test", false, "Bob", "", "", false, true, false, time.Now()))
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat refresh"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); reply != "!mgmt:test is not one of your bridged WeChat rooms." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if len(matrix.displayNames) != 0 {
+		t.Fatalf("display names = %v, want none set", matrix.displayNames)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
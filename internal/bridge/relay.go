@@ -0,0 +1,64 @@
+package bridge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// relayPrefixer labels text relayed to WeChat on behalf of Matrix users
+// other than the room's bridge user, e.g. "[alice] hello". Text that already
+// starts with a sender prefix, whether our own (an echo looping back through
+// another bridge) or one added by another bridge, is left alone.
+type relayPrefixer struct {
+	template string
+	known    []*regexp.Regexp
+}
+
+// newRelayPrefixer creates a relayPrefixer. template may contain "{{.}}",
+// which is replaced by the sender's localpart; an empty template disables
+// prefixing. knownPrefixes are regular expressions matching the prefixes
+// of other bridges.
+func newRelayPrefixer(template string, knownPrefixes []string) (*relayPrefixer, error) {
+	rp := &relayPrefixer{template: template}
+	if template != "" {
+		own := "^" + strings.ReplaceAll(regexp.QuoteMeta(template), regexp.QuoteMeta("{{.}}"), `\S+?`)
+		rp.known = append(rp.known, regexp.MustCompile(own))
+	}
+	for i, pattern := range knownPrefixes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("known prefix %d: %w", i, err)
+		}
+		rp.known = append(rp.known, re)
+	}
+	return rp, nil
+}
+
+// hasPrefix reports whether text already starts with a known sender prefix.
+func (rp *relayPrefixer) hasPrefix(text string) bool {
+	for _, re := range rp.known {
+		if loc := re.FindStringIndex(text); loc != nil && loc[0] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// apply prefixes text with the sender's localpart unless it already carries
+// a known prefix.
+func (rp *relayPrefixer) apply(sender, text string) string {
+	if rp == nil || rp.template == "" || rp.hasPrefix(text) {
+		return text
+	}
+	return strings.ReplaceAll(rp.template, "{{.}}", matrixLocalpart(sender)) + text
+}
+
+// matrixLocalpart returns "alice" for "@alice:example.com".
+func matrixLocalpart(userID string) string {
+	localpart := strings.TrimPrefix(userID, "@")
+	if idx := strings.IndexByte(localpart, ':'); idx >= 0 {
+		localpart = localpart[:idx]
+	}
+	return localpart
+}
@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func TestRelayPrefixer_Apply(t *testing.T) {
+	rp, err := newRelayPrefixer("[{{.}}] ", []string{`^<[^>]+> `})
+	if err != nil {
+		t.Fatalf("newRelayPrefixer: %v", err)
+	}
+
+	tests := []struct {
+		text, want string
+	}{
+		{"hello", "[alice] hello"},
+		{"[bob] hello", "[bob] hello"},     // our own prefix echoed back
+		{"<carol> hello", "<carol> hello"}, // another bridge's prefix
+		{"hello [alice] again", "[alice] hello [alice] again"},
+	}
+	for _, tt := range tests {
+		if got := rp.apply("@alice:example.com", tt.text); got != tt.want {
+			t.Errorf("apply(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRelayPrefixer_Disabled(t *testing.T) {
+	var rp *relayPrefixer
+	if got := rp.apply("@alice:example.com", "hello"); got != "hello" {
+		t.Fatalf("nil prefixer changed text: %q", got)
+	}
+	rp, _ = newRelayPrefixer("", nil)
+	if got := rp.apply("@alice:example.com", "hello"); got != "hello" {
+		t.Fatalf("empty template changed text: %q", got)
+	}
+}
+
+func TestNewRelayPrefixer_InvalidPattern(t *testing.T) {
+	if _, err := newRelayPrefixer("[{{.}}] ", []string{"("}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_KnownPrefixNotRePrefixed(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:       slog.Default(),
+		Puppets:   newTestPuppetManager(),
+		Processor: &defaultMessageProcessor{},
+		Provider:  provider,
+	})
+	if err := er.SetRelayPrefix("[{{.}}] ", []string{`^\[[^\]\n]{1,64}\] `}); err != nil {
+		t.Fatalf("SetRelayPrefix: %v", err)
+	}
+	room := &database.RoomMapping{WeChatChatID: "123@chatroom", MatrixRoomID: "!room:test", BridgeUser: "@owner:test"}
+
+	for _, body := range []string{"[telegram/dave] hi from telegram", "plain"} {
+		err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+			ID:      "$event:test",
+			Type:    "m.room.message",
+			RoomID:  room.MatrixRoomID,
+			Sender:  "@relaybot:test",
+			Content: map[string]interface{}{"msgtype": "m.text", "body": body},
+		}, room)
+		if err != nil {
+			t.Fatalf("handleMatrixMessage: %v", err)
+		}
+	}
+	err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+		ID:      "$own:test",
+		Type:    "m.room.message",
+		RoomID:  room.MatrixRoomID,
+		Sender:  "@owner:test",
+		Content: map[string]interface{}{"msgtype": "m.text", "body": "from owner"},
+	}, room)
+	if err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+
+	want := []string{"[telegram/dave] hi from telegram", "[relaybot] plain", "from owner"}
+	if len(provider.sentTexts) != len(want) {
+		t.Fatalf("sent %q, want %q", provider.sentTexts, want)
+	}
+	for i := range want {
+		if provider.sentTexts[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, provider.sentTexts[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Retry directions, used as the metrics label.
+const (
+	retryInbound  = "wechat_to_matrix"
+	retryOutbound = "matrix_to_wechat"
+)
+
+// sendRetrier retries a failed send a bounded number of times with
+// exponential backoff, recording retries and give-ups in metrics.
+type sendRetrier struct {
+	log        *slog.Logger
+	metrics    *Metrics
+	maxRetries int
+	backoff    time.Duration
+
+	// sleep waits between attempts; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newSendRetrier(log *slog.Logger, metrics *Metrics, maxRetries int, backoff time.Duration) *sendRetrier {
+	if log == nil {
+		log = slog.Default()
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	return &sendRetrier{
+		log:        log,
+		metrics:    metrics,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		sleep:      sleepContext,
+	}
+}
+
+// do runs send until it succeeds, returns a permanent error, or has been
+// retried maxRetries times. The last error is returned.
+func (r *sendRetrier) do(ctx context.Context, direction string, send func() error) error {
+	err := send()
+	if err == nil || r == nil || r.maxRetries == 0 || !isRetryableSendError(err) {
+		return err
+	}
+
+	// Queue age is how long a send waited in the retry loop before it
+	// succeeded or was dropped.
+	start := time.Now()
+	if r.metrics != nil {
+		defer func() { r.metrics.ObserveSendRetryQueueAge(time.Since(start)) }()
+	}
+
+	backoff := r.backoff
+	for retry := 1; retry <= r.maxRetries; retry++ {
+		if r.sleep(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+
+		if r.metrics != nil {
+			r.metrics.IncrSendRetries(direction)
+		}
+		r.log.Debug("retrying failed send", "direction", direction, "retry", retry, "error", err)
+		if err = send(); err == nil {
+			return nil
+		}
+		if !isRetryableSendError(err) {
+			return err
+		}
+	}
+
+	if r.metrics != nil {
+		r.metrics.IncrSendRetryExhausted(direction)
+	}
+	r.log.Warn("giving up on failed send", "direction", direction, "retries", r.maxRetries, "error", err)
+	return err
+}
+
+// permanentSendError marks a send failure that retrying cannot fix, such as
+// a malformed event.
+type permanentSendError struct {
+	err error
+}
+
+func (e *permanentSendError) Error() string { return e.err.Error() }
+func (e *permanentSendError) Unwrap() error { return e.err }
+
+// isRetryableSendError reports whether a send might succeed when repeated.
+// Cancellation, permanent errors, Matrix client errors other than rate
+// limiting and WeChat provider errors other than temporary ones are final.
+// WeChat rate limiting is final too: retrying only deepens the risk control.
+func isRetryableSendError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, wechat.ErrRateLimited) || errors.Is(err, wechat.ErrLoggedOut) || errors.Is(err, wechat.ErrNotSupported) ||
+		errors.Is(err, wechat.ErrMediaTooLarge) {
+		return false
+	}
+	if errors.Is(err, wechat.ErrTransient) {
+		return true
+	}
+	var pErr *permanentSendError
+	if errors.As(err, &pErr) {
+		return false
+	}
+	var mErr *matrixError
+	if errors.As(err, &mErr) {
+		return mErr.StatusCode >= 500 || mErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
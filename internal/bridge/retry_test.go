@@ -0,0 +1,101 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func newTestSendRetrier(metrics *Metrics, maxRetries int) (*sendRetrier, *[]time.Duration) {
+	r := newSendRetrier(slog.Default(), metrics, maxRetries, 100*time.Millisecond)
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return r, &waits
+}
+
+func TestSendRetrier_ExhaustedAfterMaxRetries(t *testing.T) {
+	metrics := NewMetrics()
+	r, waits := newTestSendRetrier(metrics, 3)
+
+	attempts := 0
+	err := r.do(context.Background(), retryOutbound, func() error {
+		attempts++
+		return fmt.Errorf("provider unavailable")
+	})
+	if err == nil || err.Error() != "provider unavailable" {
+		t.Fatalf("err = %v, want the last send error", err)
+	}
+	if attempts != 4 {
+		t.Fatalf("attempts = %d, want the first try plus 3 retries", attempts)
+	}
+	if fmt.Sprint(*waits) != "[100ms 200ms 400ms]" {
+		t.Fatalf("backoff = %v", *waits)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+	for _, want := range []string{
+		`mautrix_wechat_send_retries_total{direction="matrix_to_wechat"} 3`,
+		`mautrix_wechat_send_retry_exhausted_total{direction="matrix_to_wechat"} 1`,
+		"mautrix_wechat_send_retry_queue_age_seconds_count 1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s in:\n%s", want, text)
+		}
+	}
+}
+
+func TestSendRetrier_SucceedsOnRetry(t *testing.T) {
+	metrics := NewMetrics()
+	r, _ := newTestSendRetrier(metrics, 3)
+
+	attempts := 0
+	err := r.do(context.Background(), retryInbound, func() error {
+		attempts++
+		if attempts < 2 {
+			return &matrixError{StatusCode: 502, ErrCode: "M_UNKNOWN"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("err = %v after %d attempts, want success on the first retry", err, attempts)
+	}
+	if _, exhausted := metrics.sendRetryExhausted.Load(retryInbound); exhausted {
+		t.Fatal("exhausted counter incremented for a send that succeeded")
+	}
+}
+
+func TestSendRetrier_PermanentErrorsNotRetried(t *testing.T) {
+	for name, sendErr := range map[string]error{
+		"forbidden": &matrixError{StatusCode: 403, ErrCode: "M_FORBIDDEN"},
+		"permanent": &permanentSendError{fmt.Errorf("matrix media event missing url")},
+		"canceled":  fmt.Errorf("send: %w", context.Canceled),
+
+		"wechat rate limited":  fmt.Errorf("send text: %w (0/500 today)", wechat.ErrRateLimited),
+		"wechat logged out":    wechat.WrapError(wechat.ErrLoggedOut, fmt.Errorf("HTTP 401")),
+		"wechat not supported": fmt.Errorf("pchook: voice sending %w", wechat.ErrNotSupported),
+		"media too large":      fmt.Errorf("read video: %w", wechat.ErrMediaTooLarge),
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, _ := newTestSendRetrier(NewMetrics(), 3)
+			attempts := 0
+			r.do(context.Background(), retryInbound, func() error {
+				attempts++
+				return sendErr
+			})
+			if attempts != 1 {
+				t.Fatalf("attempts = %d, want no retries", attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// riskCounterStore exposes the database risk_counter table to providers
+// as a wechat.RiskCounterStore.
+type riskCounterStore struct {
+	store *database.RiskCounterStore
+}
+
+func (s *riskCounterStore) LoadRiskCounters(ctx context.Context, key string) (*wechat.RiskCounters, error) {
+	c, err := s.store.Get(ctx, key)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	// DATE columns come back as UTC midnight; rebuild the same calendar day locally.
+	y, m, d := c.CounterDate.Date()
+	return &wechat.RiskCounters{
+		Date:     time.Date(y, m, d, 0, 0, 0, 0, time.Local),
+		Messages: c.MessageCount,
+		Groups:   c.GroupCount,
+		Friends:  c.FriendCount,
+	}, nil
+}
+
+func (s *riskCounterStore) SaveRiskCounters(ctx context.Context, key string, counters *wechat.RiskCounters) error {
+	return s.store.Upsert(ctx, &database.RiskCounter{
+		Account:      key,
+		CounterDate:  counters.Date,
+		MessageCount: counters.Messages,
+		GroupCount:   counters.Groups,
+		FriendCount:  counters.Friends,
+	})
+}
@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// Duplicate room name handling for bridge.message_handling.duplicate_room_names.
+const (
+	DuplicateRoomNamesHash        = "hash"
+	DuplicateRoomNamesMemberCount = "member_count"
+	DuplicateRoomNamesNone        = "none"
+)
+
+// groupRoomName returns the name for a new group room. When another of the
+// bridge user's rooms already uses the group's name, a suffix is appended so
+// the rooms can be told apart.
+func (er *EventRouter) groupRoomName(ctx context.Context, bridgeUser, chatID string, info *wechat.ContactInfo) string {
+	name := info.Nickname
+	if name == "" || er.duplicateNames == "" || er.duplicateNames == DuplicateRoomNamesNone {
+		return name
+	}
+
+	rooms, err := er.rooms.GetAllForUser(ctx, bridgeUser)
+	if err != nil {
+		er.log.Warn("failed to list rooms for name check", "error", err, "user", bridgeUser)
+		return name
+	}
+	taken := false
+	for _, r := range rooms {
+		// A re-created group takes over its old room's name
+		if r.WeChatChatID == chatID || (info.PreviousID != "" && r.WeChatChatID == info.PreviousID) {
+			continue
+		}
+		// Earlier duplicates carry a suffix already
+		if r.Name == name || strings.HasPrefix(r.Name, name+" (") {
+			taken = true
+			break
+		}
+	}
+	if !taken {
+		return name
+	}
+
+	if er.duplicateNames == DuplicateRoomNamesMemberCount && info.MemberCount > 0 {
+		return fmt.Sprintf("%s (%d members)", name, info.MemberCount)
+	}
+	sum := sha256.Sum256([]byte(chatID))
+	return fmt.Sprintf("%s (%s)", name, hex.EncodeToString(sum[:2]))
+}
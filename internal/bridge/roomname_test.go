@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// withDuplicateRoomNames names same-named group rooms per mode, with the
+// room store wired.
+func withDuplicateRoomNames(mode string) func(*EventRouterConfig, *sql.DB) {
+	return func(cfg *EventRouterConfig, db *sql.DB) {
+		cfg.Log = testBridgeLogger()
+		cfg.Rooms = database.NewRoomMappingStore(db)
+		cfg.DuplicateRoomNames = mode
+	}
+}
+
+func TestGroupRoomName_SameNamedGroupsGetDistinctNames(t *testing.T) {
+	er, mock := newTestRouter(t, nil, withDuplicateRoomNames(DuplicateRoomNamesHash))
+	ctx := context.Background()
+
+	// First group: no other rooms yet
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE bridge_user = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames))
+	first := er.groupRoomName(ctx, "@user:test", "111@chatroom", &wechat.ContactInfo{UserID: "111@chatroom", Nickname: "Family"})
+
+	// Second group with the same name: the first room now exists
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE bridge_user = $1`)).
+		WithArgs("@user:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("111@chatroom", "!family1:test", "@user:test", true, first, "", "", false, false, false, time.Now()))
+	second := er.groupRoomName(ctx, "@user:test", "222@chatroom", &wechat.ContactInfo{UserID: "222@chatroom", Nickname: "Family"})
+
+	if first != "Family" {
+		t.Errorf("first room name = %q, want %q", first, "Family")
+	}
+	if second == first || !regexp.MustCompile(`^Family \([0-9a-f]{4}\)$`).MatchString(second) {
+		t.Errorf("second room name = %q, want Family with a hash suffix", second)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGroupRoomName_MemberCount(t *testing.T) {
+	er, mock := newTestRouter(t, nil, withDuplicateRoomNames(DuplicateRoomNamesMemberCount))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE bridge_user = $1`)).
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("111@chatroom", "!family1:test", "@user:test", true, "Family", "", "", false, false, false, time.Now()))
+
+	name := er.groupRoomName(context.Background(), "@user:test", "222@chatroom",
+		&wechat.ContactInfo{UserID: "222@chatroom", Nickname: "Family", MemberCount: 12})
+	if name != "Family (12 members)" {
+		t.Errorf("room name = %q, want %q", name, "Family (12 members)")
+	}
+}
+
+func TestGroupRoomName_None(t *testing.T) {
+	er, mock := newTestRouter(t, nil, withDuplicateRoomNames(DuplicateRoomNamesNone))
+
+	name := er.groupRoomName(context.Background(), "@user:test", "222@chatroom",
+		&wechat.ContactInfo{UserID: "222@chatroom", Nickname: "Family"})
+	if name != "Family" {
+		t.Errorf("room name = %q, want %q", name, "Family")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
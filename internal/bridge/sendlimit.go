@@ -0,0 +1,253 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows perMinute events per minute on average, in bursts of at
+// most burst events.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	burst := math.Ceil(float64(perMinute) / 10)
+	return &tokenBucket{
+		rate:   float64(perMinute) / 60,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// wait returns how long until a token is available, 0 if one is right now.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take uses up a token. Only call it after wait returned 0.
+func (b *tokenBucket) take() { b.tokens-- }
+
+// maxQueuedSends is how many messages to one chat of a bridge user may wait
+// for the rate limit. Sends beyond it fail instead of piling up in memory.
+const maxQueuedSends = 100
+
+var (
+	errSendQueueFull      = errors.New("too many messages queued for this chat")
+	errSendLimiterStopped = errors.New("bridge is shutting down")
+)
+
+// sendKey identifies the rate limit and queue of one bridge user's chat.
+type sendKey struct {
+	bridgeUser string
+	chat       string
+}
+
+// queuedSend is a send waiting for the rate limit.
+type queuedSend struct {
+	ctx    context.Context
+	send   func(context.Context) error
+	failed func(context.Context, error)
+}
+
+// sendLimiter spaces out messages sent to WeChat with one token bucket for
+// all chats and one per chat of each bridge user, so bursts from Matrix
+// don't trip WeChat's spam protection. Sends that exceed either bucket are
+// queued per chat and sent in order as soon as both allow it; later sends
+// to the same chat queue behind them. Queued sends that never go out, because
+// the queue is full or the bridge stops, are reported to their failed
+// callback.
+type sendLimiter struct {
+	log     *slog.Logger
+	metrics *Metrics
+
+	// ctx is cancelled by stop, which aborts queued sends
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	global    *tokenBucket // nil = no global limit
+	chatLimit int          // per chat per minute, 0 = no limit
+	maxQueued int
+	chats     map[sendKey]*tokenBucket
+	queues    map[sendKey][]queuedSend
+	now       func() time.Time
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// newSendLimiter returns a limiter allowing globalPerMinute messages per
+// minute over all chats and chatPerMinute to any one chat; 0 disables either
+// limit. It returns nil when both are disabled.
+func newSendLimiter(log *slog.Logger, metrics *Metrics, globalPerMinute, chatPerMinute int) *sendLimiter {
+	if globalPerMinute <= 0 && chatPerMinute <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &sendLimiter{
+		log:       log,
+		metrics:   metrics,
+		ctx:       ctx,
+		cancel:    cancel,
+		chatLimit: max(chatPerMinute, 0),
+		maxQueued: maxQueuedSends,
+		chats:     make(map[sendKey]*tokenBucket),
+		queues:    make(map[sendKey][]queuedSend),
+		now:       time.Now,
+		sleep:     sleepContext,
+	}
+	if globalPerMinute > 0 {
+		l.global = newTokenBucket(globalPerMinute, l.now())
+	}
+	return l
+}
+
+// submit runs send right away if the limits allow and nothing is queued for
+// key, returning its error. Otherwise send is queued and run later with ctx
+// minus its cancellation, and submit returns nil. When the queue is full or
+// the limiter stopped, failed is called and submit returns the error.
+func (l *sendLimiter) submit(ctx context.Context, key sendKey, send func(context.Context) error, failed func(context.Context, error)) error {
+	if l == nil {
+		return send(ctx)
+	}
+
+	l.mu.Lock()
+	var err error
+	switch {
+	case l.ctx.Err() != nil:
+		err = errSendLimiterStopped
+	case len(l.queues[key]) == 0 && l.waitLocked(key) == 0:
+		l.takeLocked(key)
+		l.mu.Unlock()
+		return send(ctx)
+	case len(l.queues[key]) >= l.maxQueued:
+		err = errSendQueueFull
+	}
+	if err != nil {
+		l.mu.Unlock()
+		failed(ctx, err)
+		return err
+	}
+
+	l.queues[key] = append(l.queues[key], queuedSend{
+		ctx:    context.WithoutCancel(ctx),
+		send:   send,
+		failed: failed,
+	})
+	startWorker := len(l.queues[key]) == 1
+	if startWorker {
+		l.wg.Add(1)
+	}
+	l.mu.Unlock()
+
+	if l.metrics != nil {
+		l.metrics.AddOutgoingQueued(1)
+	}
+	if startWorker {
+		go l.drain(key)
+	}
+	return nil
+}
+
+// drain sends the messages queued for key in order, waiting for the token
+// buckets before each, until the queue is empty or the limiter stops.
+func (l *sendLimiter) drain(key sendKey) {
+	defer l.wg.Done()
+	for {
+		l.mu.Lock()
+		if l.ctx.Err() != nil {
+			pending := l.queues[key]
+			delete(l.queues, key)
+			l.mu.Unlock()
+			for _, q := range pending {
+				q.failed(q.ctx, errSendLimiterStopped)
+			}
+			if l.metrics != nil {
+				l.metrics.AddOutgoingQueued(-len(pending))
+			}
+			return
+		}
+		wait := l.waitLocked(key)
+		if wait > 0 {
+			l.mu.Unlock()
+			// A stop is noticed at the top of the loop
+			_ = l.sleep(l.ctx, wait)
+			continue
+		}
+		l.takeLocked(key)
+		q := l.queues[key][0]
+		l.mu.Unlock()
+
+		sendCtx, cancel := context.WithCancel(q.ctx)
+		stopCancel := context.AfterFunc(l.ctx, cancel)
+		if err := q.send(sendCtx); err != nil {
+			l.log.Error("failed to send queued message to wechat", "error", err, "chat", key.chat, "bridge_user", key.bridgeUser)
+		}
+		stopCancel()
+		cancel()
+		if l.metrics != nil {
+			l.metrics.AddOutgoingQueued(-1)
+		}
+
+		l.mu.Lock()
+		l.queues[key] = l.queues[key][1:]
+		if len(l.queues[key]) == 0 {
+			delete(l.queues, key)
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+	}
+}
+
+// stop aborts the sends in progress and fails those still queued, then
+// waits for the queues to empty.
+func (l *sendLimiter) stop() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.cancel()
+	l.mu.Unlock()
+	l.wg.Wait()
+}
+
+// waitLocked returns how long until both buckets for key have a token.
+func (l *sendLimiter) waitLocked(key sendKey) time.Duration {
+	now := l.now()
+	var wait time.Duration
+	if l.global != nil {
+		wait = l.global.wait(now)
+	}
+	if l.chatLimit > 0 {
+		b := l.chats[key]
+		if b == nil {
+			b = newTokenBucket(l.chatLimit, now)
+			l.chats[key] = b
+		}
+		wait = max(wait, b.wait(now))
+	}
+	return wait
+}
+
+func (l *sendLimiter) takeLocked(key sendKey) {
+	if l.global != nil {
+		l.global.take()
+	}
+	if b := l.chats[key]; b != nil {
+		b.take()
+	}
+}
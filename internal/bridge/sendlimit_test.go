@@ -0,0 +1,196 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_BurstAndRefill(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	b := newTokenBucket(30, start) // burst 3, one token every 2s
+
+	for i := 0; i < 3; i++ {
+		if wait := b.wait(start); wait != 0 {
+			t.Fatalf("send %d: wait = %v, want a token from the burst", i+1, wait)
+		}
+		b.take()
+	}
+	if wait := b.wait(start); wait != 2*time.Second {
+		t.Fatalf("wait after burst = %v, want 2s", wait)
+	}
+	if wait := b.wait(start.Add(2 * time.Second)); wait != 0 {
+		t.Fatalf("wait after refill = %v, want 0", wait)
+	}
+}
+
+func TestNewSendLimiter_Disabled(t *testing.T) {
+	if l := newSendLimiter(testBridgeLogger(), nil, 0, 0); l != nil {
+		t.Fatal("expected no limiter when both limits are disabled")
+	}
+
+	var l *sendLimiter
+	called := false
+	if err := l.submit(context.Background(), sendKey{chat: "chat"}, func(context.Context) error { called = true; return nil }, nil); err != nil || !called {
+		t.Fatalf("nil limiter should send right away, called=%v err=%v", called, err)
+	}
+}
+
+var bobKey = sendKey{bridgeUser: "@alice:test", chat: "wxid_bob"}
+
+// failOnDrop is a submit failed callback for sends that must not be dropped.
+func failOnDrop(t *testing.T) func(context.Context, error) {
+	return func(_ context.Context, err error) { t.Errorf("send dropped: %v", err) }
+}
+
+// blockedSendLimiter returns a limiter whose clock never advances, so that
+// everything past the first send to a chat stays queued until stop.
+func blockedSendLimiter() *sendLimiter {
+	l := newSendLimiter(testBridgeLogger(), nil, 0, 10) // burst 1 per chat
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	l.sleep = sleepContext
+	return l
+}
+
+func TestSendLimiter_QueuesInOrder(t *testing.T) {
+	metrics := NewMetrics()
+	l := newSendLimiter(testBridgeLogger(), metrics, 0, 10) // burst 1 per chat
+	now := time.Unix(1700000000, 0)
+	var mu sync.Mutex
+	l.now = func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	l.sleep = func(_ context.Context, d time.Duration) error { mu.Lock(); now = now.Add(d); mu.Unlock(); return nil }
+
+	var sentMu sync.Mutex
+	var sent []string
+	done := make(chan struct{})
+	send := func(text string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			sentMu.Lock()
+			sent = append(sent, text)
+			n := len(sent)
+			sentMu.Unlock()
+			if n == 4 {
+				close(done)
+			}
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, text := range []string{"one", "two", "three"} {
+		if err := l.submit(ctx, bobKey, send(text), failOnDrop(t)); err != nil {
+			t.Fatalf("submit %s: %v", text, err)
+		}
+	}
+	// Another chat has its own bucket and isn't held up by the queue.
+	if err := l.submit(ctx, sendKey{bridgeUser: "@alice:test", chat: "wxid_carol"}, send("other chat"), failOnDrop(t)); err != nil {
+		t.Fatalf("submit to other chat: %v", err)
+	}
+	sentMu.Lock()
+	if sent[0] != "one" || !slices.Contains(sent, "other chat") {
+		t.Fatalf("sent = %v, want the first message and the other chat's sent right away", sent)
+	}
+	sentMu.Unlock()
+	// Queued messages still go out after the Matrix transaction is done.
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued messages were not sent")
+	}
+
+	sentMu.Lock()
+	var bob []string
+	for _, text := range sent {
+		if text != "other chat" {
+			bob = append(bob, text)
+		}
+	}
+	sentMu.Unlock()
+	if len(bob) != 3 || bob[0] != "one" || bob[1] != "two" || bob[2] != "three" {
+		t.Fatalf("sent to wxid_bob = %v, want one, two, three in order", bob)
+	}
+	deadline := time.Now().Add(time.Second)
+	for metrics.outgoingQueued.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if depth := metrics.outgoingQueued.Load(); depth != 0 {
+		t.Fatalf("queue depth = %d after draining, want 0", depth)
+	}
+}
+
+func TestSendLimiter_KeyedByBridgeUser(t *testing.T) {
+	l := blockedSendLimiter()
+	defer l.stop()
+
+	var sent []string
+	send := func(user string) func(context.Context) error {
+		return func(context.Context) error { sent = append(sent, user); return nil }
+	}
+	for _, user := range []string{"@alice:test", "@bob:test"} {
+		if err := l.submit(context.Background(), sendKey{bridgeUser: user, chat: "123@chatroom"}, send(user), failOnDrop(t)); err != nil {
+			t.Fatalf("submit for %s: %v", user, err)
+		}
+	}
+	if len(sent) != 2 {
+		t.Fatalf("sent = %v, want both users' first message sent right away", sent)
+	}
+}
+
+func TestSendLimiter_QueueBounded(t *testing.T) {
+	l := blockedSendLimiter()
+	defer l.stop()
+	l.maxQueued = 2
+	send := func(context.Context) error { return nil }
+
+	for i := 0; i < 3; i++ { // one sent, two queued
+		if err := l.submit(context.Background(), bobKey, send, func(context.Context, error) {}); err != nil {
+			t.Fatalf("submit %d: %v", i+1, err)
+		}
+	}
+	var dropped error
+	err := l.submit(context.Background(), bobKey, send, func(_ context.Context, err error) { dropped = err })
+	if !errors.Is(err, errSendQueueFull) || !errors.Is(dropped, errSendQueueFull) {
+		t.Fatalf("err = %v, dropped = %v, want errSendQueueFull", err, dropped)
+	}
+}
+
+func TestSendLimiter_StopFailsQueuedSends(t *testing.T) {
+	metrics := NewMetrics()
+	l := blockedSendLimiter()
+	l.metrics = metrics
+
+	var mu sync.Mutex
+	var dropped []error
+	failed := func(_ context.Context, err error) { mu.Lock(); dropped = append(dropped, err); mu.Unlock() }
+	var sent int
+	send := func(context.Context) error { mu.Lock(); sent++; mu.Unlock(); return nil }
+	for i := 0; i < 3; i++ {
+		if err := l.submit(context.Background(), bobKey, send, failed); err != nil {
+			t.Fatalf("submit %d: %v", i+1, err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() { l.stop(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stop did not stop the queue")
+	}
+
+	if sent != 1 || len(dropped) != 2 || !errors.Is(dropped[0], errSendLimiterStopped) {
+		t.Fatalf("sent %d, dropped %v, want the queued two failed", sent, dropped)
+	}
+	if depth := metrics.outgoingQueued.Load(); depth != 0 {
+		t.Fatalf("queue depth = %d after stop, want 0", depth)
+	}
+	if err := l.submit(context.Background(), bobKey, send, failed); !errors.Is(err, errSendLimiterStopped) {
+		t.Fatalf("submit after stop: %v", err)
+	}
+}
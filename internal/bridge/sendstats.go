@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// sendStatsDays is how many days of outgoing message counts are kept for the
+// stats command, today included.
+const sendStatsDays = 7
+
+// sendStatsKey identifies whose messages, sent with which provider, a count
+// belongs to. The bridge user is empty unless the bridge is multi-tenant.
+type sendStatsKey struct {
+	bridgeUser string
+	provider   string
+}
+
+// sendStats counts the messages sent to WeChat per day and message type, so
+// users can see how close they run to the risk-control limits before tuning
+// them. Counts are saved in the send_stat table, so they survive restarts
+// like the risk-control counters; without a store they are kept in memory.
+type sendStats struct {
+	store *database.SendStatStore
+
+	mu     sync.Mutex
+	days   map[string]map[sendStatsKey]map[string]int // date → key → msg type → count
+	pruned string                                     // day the store was last pruned on
+}
+
+func newSendStats(store *database.SendStatStore) *sendStats {
+	return &sendStats{store: store, days: make(map[string]map[sendStatsKey]map[string]int)}
+}
+
+// oldestSendStatsDay returns the oldest day counts are kept for at the
+// given time.
+func oldestSendStatsDay(at time.Time) string {
+	return at.AddDate(0, 0, 1-sendStatsDays).Format(time.DateOnly)
+}
+
+// record counts one message of msgType sent at the given time, and forgets
+// days older than sendStatsDays.
+func (s *sendStats) record(ctx context.Context, key sendStatsKey, msgType string, at time.Time) error {
+	date := at.Format(time.DateOnly)
+	if s.store != nil {
+		if err := s.store.Increment(ctx, key.bridgeUser, key.provider, date, msgType); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		prune := s.pruned != date
+		s.pruned = date
+		s.mu.Unlock()
+		if prune {
+			return s.store.DeleteBefore(ctx, oldestSendStatsDay(at))
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := s.days[date]
+	if day == nil {
+		day = make(map[sendStatsKey]map[string]int)
+		s.days[date] = day
+	}
+	if day[key] == nil {
+		day[key] = make(map[string]int)
+	}
+	day[key][msgType]++
+
+	oldest := oldestSendStatsDay(at)
+	for d := range s.days {
+		if d < oldest {
+			delete(s.days, d)
+		}
+	}
+	return nil
+}
+
+// dailySends is one day's count of messages sent to WeChat.
+type dailySends struct {
+	date   string
+	total  int
+	byType map[string]int
+}
+
+// history returns the daily counts of key for the sendStatsDays up to now,
+// newest first. Days without sends are left out.
+func (s *sendStats) history(ctx context.Context, key sendStatsKey, now time.Time) ([]dailySends, error) {
+	oldest := oldestSendStatsDay(now)
+	byDate := make(map[string]map[string]int)
+	if s.store != nil {
+		stats, err := s.store.List(ctx, key.bridgeUser, key.provider, oldest)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range stats {
+			if byDate[st.Date] == nil {
+				byDate[st.Date] = make(map[string]int)
+			}
+			byDate[st.Date][st.MsgType] += st.Count
+		}
+	} else {
+		s.mu.Lock()
+		for date, day := range s.days {
+			if date < oldest || len(day[key]) == 0 {
+				continue
+			}
+			byDate[date] = make(map[string]int, len(day[key]))
+			for msgType, n := range day[key] {
+				byDate[date][msgType] = n
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	days := make([]dailySends, 0, len(byDate))
+	for date, counts := range byDate {
+		d := dailySends{date: date, byType: counts}
+		for _, n := range counts {
+			d.total += n
+		}
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].date > days[j].date })
+	return days, nil
+}
+
+// sendStatsKeyFor returns the key the bridge user's messages sent with
+// provider are counted under.
+func (er *EventRouter) sendStatsKeyFor(bridgeUser string, provider wechat.Provider) sendStatsKey {
+	key := sendStatsKey{provider: provider.Name()}
+	if er.multiTenant {
+		key.bridgeUser = bridgeUser
+	}
+	return key
+}
+
+// recordSend counts a message sent to WeChat for the stats command and the
+// metrics, along with the provider's risk-control usage after it. A failure
+// to save the count only loses it, so it is logged.
+func (er *EventRouter) recordSend(ctx context.Context, bridgeUser string, provider wechat.Provider, msgType string) {
+	key := er.sendStatsKeyFor(bridgeUser, provider)
+	if err := er.sendStats.record(ctx, key, msgType, time.Now()); err != nil {
+		er.log.Warn("failed to record send stats", "error", err, "provider", provider.Name())
+	}
+	if er.metrics == nil {
+		return
+	}
+	er.metrics.IncrOutgoingByProvider(provider.Name(), msgType)
+	if reporter, ok := provider.(wechat.RiskLimitReporter); ok {
+		er.metrics.SetRiskLimits(provider.Name(), key.bridgeUser, reporter.RiskLimits())
+	}
+}
+
+func (cp *CommandProcessor) cmdStats(ctx context.Context, ce *CommandEvent) error {
+	provider, err := cp.router.getProviderForUser(ctx, ce.Sender)
+	if err != nil || provider == nil {
+		ce.Reply("Not logged in to WeChat: no active provider.")
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Messages sent to WeChat with %s:", provider.Name())
+	if reporter, ok := provider.(wechat.RiskLimitReporter); ok {
+		b.WriteString("\n\nToday's risk-control limits:")
+		for _, l := range reporter.RiskLimits() {
+			fmt.Fprintf(&b, "\n- %s: %d/%d", l.Name, l.Used, l.Limit)
+			if l.Limit > 0 {
+				fmt.Fprintf(&b, " (%d%%)", l.Used*100/l.Limit)
+			}
+		}
+	}
+
+	days, err := cp.router.sendStats.history(ctx, cp.router.sendStatsKeyFor(ce.Sender, provider), time.Now())
+	switch {
+	case err != nil:
+		cp.log.Warn("failed to load send stats", "error", err)
+		b.WriteString("\n\nFailed to load the daily message counts.")
+	case len(days) == 0:
+		fmt.Fprintf(&b, "\n\nNo messages sent in the last %d days.", sendStatsDays)
+	default:
+		fmt.Fprintf(&b, "\n\nPer day (last %d days):", sendStatsDays)
+		for _, d := range days {
+			types := make([]string, 0, len(d.byType))
+			for msgType := range d.byType {
+				types = append(types, msgType)
+			}
+			sort.Strings(types)
+			parts := make([]string, len(types))
+			for i, msgType := range types {
+				parts[i] = fmt.Sprintf("%s %d", msgType, d.byType[msgType])
+			}
+			fmt.Fprintf(&b, "\n- %s: %d (%s)", d.date, d.total, strings.Join(parts, ", "))
+		}
+	}
+	ce.Reply("%s", b.String())
+	return nil
+}
@@ -0,0 +1,152 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestSendStats_AccumulatesPerDay(t *testing.T) {
+	ctx := context.Background()
+	s := newSendStats(nil)
+	padpro := sendStatsKey{provider: "padpro"}
+	day1 := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+	day2 := day1.Add(24 * time.Hour)
+
+	for i := 0; i < 3; i++ {
+		_ = s.record(ctx, padpro, "text", day1)
+	}
+	_ = s.record(ctx, padpro, "image", day1.Add(10*time.Hour))
+	_ = s.record(ctx, padpro, "text", day2)
+	_ = s.record(ctx, sendStatsKey{provider: "ipad"}, "text", day2)
+
+	days, _ := s.history(ctx, padpro, day2)
+	if len(days) != 2 {
+		t.Fatalf("history = %+v, want two days", days)
+	}
+	if days[0].date != "2026-03-02" || days[0].total != 1 {
+		t.Fatalf("newest day = %+v, want 2026-03-02 with 1 message", days[0])
+	}
+	if days[1].date != "2026-03-01" || days[1].total != 4 || days[1].byType["text"] != 3 || days[1].byType["image"] != 1 {
+		t.Fatalf("oldest day = %+v, want 2026-03-01 with 3 text and 1 image", days[1])
+	}
+
+	// Days older than sendStatsDays are forgotten
+	later := day1.AddDate(0, 0, sendStatsDays)
+	_ = s.record(ctx, padpro, "text", later)
+	days, _ = s.history(ctx, padpro, later)
+	if len(days) != 2 || days[len(days)-1].date != "2026-03-02" {
+		t.Fatalf("history = %+v, want 2026-03-01 forgotten", days)
+	}
+}
+
+func TestSendStats_SavesCountsInStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	s := newSendStats(database.NewSendStatStore(db))
+	key := sendStatsKey{bridgeUser: "@alice:test", provider: "padpro"}
+	now := time.Date(2026, 3, 8, 9, 0, 0, 0, time.Local)
+
+	// Days before the window are pruned once a day
+	mock.ExpectExec("INSERT INTO send_stat").
+		WithArgs("@alice:test", "padpro", "2026-03-08", "text").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM send_stat").
+		WithArgs("2026-03-02").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO send_stat").
+		WithArgs("@alice:test", "padpro", "2026-03-08", "image").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := s.record(ctx, key, "text", now); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := s.record(ctx, key, "image", now.Add(time.Hour)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	mock.ExpectQuery("FROM send_stat").
+		WithArgs("@alice:test", "padpro", "2026-03-02").
+		WillReturnRows(sqlmock.NewRows([]string{"bridge_user", "provider", "send_date", "msg_type", "message_count"}).
+			AddRow("@alice:test", "padpro", "2026-03-08", "image", 1).
+			AddRow("@alice:test", "padpro", "2026-03-08", "text", 5).
+			AddRow("@alice:test", "padpro", "2026-03-05", "text", 2))
+	days, err := s.history(ctx, key, now)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(days) != 2 || days[0].date != "2026-03-08" || days[0].total != 6 || days[1].date != "2026-03-05" || days[1].total != 2 {
+		t.Fatalf("history = %+v", days)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+type riskLimitProvider struct {
+	*mockProvider
+	limits []wechat.RiskLimit
+}
+
+func (p *riskLimitProvider) RiskLimits() []wechat.RiskLimit { return p.limits }
+
+func TestCommandProcessor_Stats(t *testing.T) {
+	matrix := &testMatrixClient{}
+	provider := &riskLimitProvider{
+		mockProvider: newMockProvider("padpro", 2),
+		limits:       []wechat.RiskLimit{{Name: "messages", Used: 400, Limit: 500}},
+	}
+	metrics := NewMetrics()
+	er := NewEventRouter(EventRouterConfig{
+		Log:          slog.Default(),
+		Puppets:      newTestPuppetManager(),
+		Provider:     provider,
+		MatrixClient: matrix,
+		Metrics:      metrics,
+		BotUserID:    "@wechatbot:example.com",
+	})
+	cp := NewCommandProcessor(CommandProcessorConfig{
+		Log:       slog.Default(),
+		Router:    er,
+		BotUserID: "@wechatbot:example.com",
+	})
+
+	er.recordSend(context.Background(), "@user:test", provider, "text")
+	er.recordSend(context.Background(), "@user:test", provider, "text")
+	er.recordSend(context.Background(), "@user:test", provider, "image")
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat stats"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	reply := lastReply(t, matrix)
+	today := time.Now().Format(time.DateOnly)
+	for _, want := range []string{"- messages: 400/500 (80%)", "- " + today + ": 3 (image 1, text 2)"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("stats reply %q missing %q", reply, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`mautrix_wechat_outgoing_messages_total{provider="padpro",msg_type="text"} 2`,
+		`mautrix_wechat_risk_control_used{provider="padpro",bridge_user="",limit="messages"} 400`,
+		`mautrix_wechat_risk_control_limit{provider="padpro",bridge_user="",limit="messages"} 500`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
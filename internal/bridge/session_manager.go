@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 
 	"github.com/n42/mautrix-wechat/internal/config"
@@ -42,6 +43,15 @@ type SessionManager struct {
 	log      *slog.Logger
 	logLevel string
 
+	// Passed to each session's provider as ProviderConfig.MaxMediaSize
+	maxMediaSize int64
+	// Passed to each session's provider as ProviderConfig.Connection
+	connObserver wechat.ConnectionObserver
+	// Passed to each session's provider as ProviderConfig.Sends
+	sendObserver wechat.SendObserver
+	// Passed to each session's provider as ProviderConfig.Capabilities
+	capabilities map[string]bool
+
 	providerFactory func() (wechat.Provider, error)
 }
 
@@ -68,6 +78,30 @@ func NewSessionManager(
 	}
 }
 
+// SetMaxMediaSize sets the media size limit, in bytes, given to the providers
+// of sessions created afterwards. 0 disables the limit.
+func (sm *SessionManager) SetMaxMediaSize(n int64) {
+	sm.maxMediaSize = n
+}
+
+// SetCapabilityOverrides sets the capability overrides given to the
+// providers of sessions created afterwards.
+func (sm *SessionManager) SetCapabilityOverrides(overrides map[string]bool) {
+	sm.capabilities = overrides
+}
+
+// SetConnectionObserver sets the observer told about the WebSocket
+// connections of sessions created afterwards.
+func (sm *SessionManager) SetConnectionObserver(o wechat.ConnectionObserver) {
+	sm.connObserver = o
+}
+
+// SetSendObserver sets the observer told how long the sends of sessions
+// created afterwards take.
+func (sm *SessionManager) SetSendObserver(o wechat.SendObserver) {
+	sm.sendObserver = o
+}
+
 // GetOrCreateSession returns an existing session or creates a new one for the bridge user.
 func (sm *SessionManager) GetOrCreateSession(ctx context.Context, bridgeUserID string) (*UserSession, error) {
 	if sm.nodePool == nil {
@@ -108,7 +142,7 @@ func (sm *SessionManager) GetOrCreateSession(ctx context.Context, bridgeUserID s
 	}
 
 	// Build per-node config
-	providerCfg := sm.buildNodeProviderConfig(node)
+	providerCfg := sm.buildNodeProviderConfig(node, bridgeUserID)
 
 	// Create a handler wrapper that injects bridge user ID into context
 	wrappedHandler := &userMessageHandler{
@@ -168,6 +202,12 @@ func (sm *SessionManager) LoginUser(ctx context.Context, bridgeUserID string) er
 		return err
 	}
 
+	// Callers only log in users they found logged out, e.g. after the
+	// session was lost, so the provider's own login state isn't trusted.
+	if resumeSession(ctx, sm.log, session.Provider) {
+		session.LoginState = wechat.LoginStateLoggedIn
+		return nil
+	}
 	if err := session.Provider.Login(ctx); err != nil {
 		return fmt.Errorf("login for %s: %w", bridgeUserID, err)
 	}
@@ -241,7 +281,7 @@ func (sm *SessionManager) RestoreSessions(ctx context.Context) error {
 			continue
 		}
 
-		providerCfg := sm.buildNodeProviderConfig(node)
+		providerCfg := sm.buildNodeProviderConfig(node, a.BridgeUser)
 		wrappedHandler := &userMessageHandler{
 			bridgeUserID: a.BridgeUser,
 			inner:        sm.handler,
@@ -262,12 +302,23 @@ func (sm *SessionManager) RestoreSessions(ctx context.Context) error {
 			continue
 		}
 
+		// The node may have lost the session while the bridge was down.
+		// Keep it assigned so that logging in again reuses it.
+		loginState := wechat.LoginStateLoggedIn
+		if _, ok := provider.(wechat.SessionRestorer); ok && !restoreSession(ctx, sm.log, provider) {
+			sm.log.Warn("restored session is logged out", "bridge_user", a.BridgeUser, "node", a.NodeID)
+			loginState = wechat.LoginStateLoggedOut
+			if err := sm.db.NodeAssignment.UpdateLoginState(ctx, a.BridgeUser, int(loginState), a.WeChatID); err != nil {
+				sm.log.Error("failed to update login state", "error", err, "bridge_user", a.BridgeUser)
+			}
+		}
+
 		sm.mu.Lock()
 		sm.sessions[a.BridgeUser] = &UserSession{
 			BridgeUserID: a.BridgeUser,
 			NodeID:       a.NodeID,
 			Provider:     provider,
-			LoginState:   wechat.LoginStateLoggedIn,
+			LoginState:   loginState,
 		}
 		sm.mu.Unlock()
 
@@ -305,6 +356,21 @@ func (sm *SessionManager) SessionCount() int {
 	return len(sm.sessions)
 }
 
+// LoggedInUsers returns the bridge users whose session is logged in to
+// WeChat, sorted.
+func (sm *SessionManager) LoggedInUsers() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var users []string
+	for userID, session := range sm.sessions {
+		if session.LoginState == wechat.LoginStateLoggedIn {
+			users = append(users, userID)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
 // UpdateSessionLoginState updates the in-memory login state for an active session.
 func (sm *SessionManager) UpdateSessionLoginState(bridgeUserID string, state wechat.LoginState) {
 	sm.mu.Lock()
@@ -314,18 +380,30 @@ func (sm *SessionManager) UpdateSessionLoginState(bridgeUserID string, state wec
 	}
 }
 
-// buildNodeProviderConfig creates a ProviderConfig for a specific node.
-func (sm *SessionManager) buildNodeProviderConfig(node *NodeState) *wechat.ProviderConfig {
+// buildNodeProviderConfig creates a ProviderConfig for a specific node,
+// serving bridgeUserID.
+func (sm *SessionManager) buildNodeProviderConfig(node *NodeState, bridgeUserID string) *wechat.ProviderConfig {
 	cfg := &wechat.ProviderConfig{
-		LogLevel:    sm.logLevel,
-		APIEndpoint: node.Config.APIEndpoint,
-		APIToken:    node.Config.AuthKey,
-		Extra:       make(map[string]string),
+		LogLevel:     sm.logLevel,
+		APIEndpoint:  node.Config.APIEndpoint,
+		APIToken:     node.Config.AuthKey,
+		MaxMediaSize: sm.maxMediaSize,
+		Connection:   sm.connObserver,
+		Sends:        sm.sendObserver,
+		Capabilities: sm.capabilities,
+		Extra:        make(map[string]string),
 	}
 
 	if node.Config.WSEndpoint != "" {
 		cfg.Extra["ws_endpoint"] = node.Config.WSEndpoint
 	}
+	if sm.db != nil && sm.db.ProviderSession != nil {
+		cfg.Sessions = &providerSessionStore{
+			store:        sm.db.ProviderSession,
+			providerType: "padpro",
+			bridgeUser:   fixedBridgeUser(bridgeUserID),
+		}
+	}
 
 	// Apply risk control settings
 	rc := sm.riskCfg
@@ -396,7 +474,27 @@ func (h *userMessageHandler) OnTyping(ctx context.Context, userID string, chatID
 	return h.inner.OnTyping(ctx, userID, chatID)
 }
 
-func (h *userMessageHandler) OnRevoke(ctx context.Context, msgID string, replaceTip string) error {
+func (h *userMessageHandler) OnRevoke(ctx context.Context, chatID, msgID, replaceTip string) error {
+	ctx = context.WithValue(ctx, bridgeUserKey, h.bridgeUserID)
+	return h.inner.OnRevoke(ctx, chatID, msgID, replaceTip)
+}
+
+func (h *userMessageHandler) OnFriendRequest(ctx context.Context, req *wechat.FriendRequest) error {
+	ctx = context.WithValue(ctx, bridgeUserKey, h.bridgeUserID)
+	return h.inner.OnFriendRequest(ctx, req)
+}
+
+func (h *userMessageHandler) OnContactAdded(ctx context.Context, contact *wechat.ContactInfo) error {
+	ctx = context.WithValue(ctx, bridgeUserKey, h.bridgeUserID)
+	return h.inner.OnContactAdded(ctx, contact)
+}
+
+func (h *userMessageHandler) OnSendAck(ctx context.Context, msgID string) error {
+	ctx = context.WithValue(ctx, bridgeUserKey, h.bridgeUserID)
+	return h.inner.OnSendAck(ctx, msgID)
+}
+
+func (h *userMessageHandler) OnMessageReaction(ctx context.Context, reaction *wechat.MessageReaction) error {
 	ctx = context.WithValue(ctx, bridgeUserKey, h.bridgeUserID)
-	return h.inner.OnRevoke(ctx, msgID, replaceTip)
+	return h.inner.OnMessageReaction(ctx, reaction)
 }
@@ -183,7 +183,7 @@ func TestSessionManager_BuildNodeProviderConfig(t *testing.T) {
 		},
 	}
 
-	cfg := sm.buildNodeProviderConfig(node)
+	cfg := sm.buildNodeProviderConfig(node, "@alice:example.com")
 
 	if cfg.APIEndpoint != "http://10.0.1.1:1239" {
 		t.Errorf("APIEndpoint: %s", cfg.APIEndpoint)
@@ -215,7 +215,7 @@ func TestSessionManager_BuildNodeProviderConfig_NoWSEndpoint(t *testing.T) {
 		},
 	}
 
-	cfg := sm.buildNodeProviderConfig(node)
+	cfg := sm.buildNodeProviderConfig(node, "@alice:example.com")
 	if _, ok := cfg.Extra["ws_endpoint"]; ok {
 		t.Error("ws_endpoint should not be set when empty")
 	}
@@ -235,7 +235,7 @@ func TestSessionManager_BuildNodeProviderConfig_NoRandomDelay(t *testing.T) {
 		},
 	}
 
-	cfg := sm.buildNodeProviderConfig(node)
+	cfg := sm.buildNodeProviderConfig(node, "@alice:example.com")
 	if _, ok := cfg.Extra["random_delay"]; ok {
 		t.Error("random_delay should not be set when false")
 	}
@@ -357,7 +357,9 @@ func TestUserMessageHandler_AllMethods(t *testing.T) {
 	_ = handler.OnLoginEvent(ctx, &wechat.LoginEvent{State: wechat.LoginStateLoggedIn})
 	_ = handler.OnPresence(ctx, "wxid_test", true)
 	_ = handler.OnTyping(ctx, "wxid_test", "wxid_chat")
-	_ = handler.OnRevoke(ctx, "msg1", "revoked")
+	_ = handler.OnRevoke(ctx, "wxid_chat", "msg1", "revoked")
+	_ = handler.OnMessageReaction(ctx, &wechat.MessageReaction{MsgID: "msg1", UserID: "wxid_test", Emoji: "👍"})
+	_ = handler.OnContactAdded(ctx, &wechat.ContactInfo{UserID: "wxid_test"})
 
 	// ContactUpdate should not panic (puppets is available)
 	_ = handler.OnContactUpdate(ctx, &wechat.ContactInfo{UserID: "wxid_test"})
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// outgoingSignature adds a configured prefix and suffix, e.g. a compliance
+// disclaimer such as "[Bridged] ", to all text sent to WeChat. Media is sent
+// unchanged.
+type outgoingSignature struct {
+	prefix *template.Template
+	suffix *template.Template
+	skip   map[string]bool // Matrix room or WeChat chat IDs sent unsigned
+}
+
+// signatureData is what the outgoing prefix and suffix templates are
+// executed with. Sender is the Matrix sender's localpart, Room the room's
+// name.
+type signatureData struct {
+	Sender string
+	Room   string
+}
+
+// newOutgoingSignature parses the prefix and suffix templates. Text sent to
+// the rooms in skipRooms, given as Matrix room or WeChat chat IDs, is left
+// alone. It returns nil when both templates are empty.
+func newOutgoingSignature(prefix, suffix string, skipRooms []string) (*outgoingSignature, error) {
+	if prefix == "" && suffix == "" {
+		return nil, nil
+	}
+	s := &outgoingSignature{skip: make(map[string]bool, len(skipRooms))}
+	var err error
+	if s.prefix, err = parseSignatureTemplate("prefix", prefix); err != nil {
+		return nil, err
+	}
+	if s.suffix, err = parseSignatureTemplate("suffix", suffix); err != nil {
+		return nil, err
+	}
+	for _, room := range skipRooms {
+		s.skip[room] = true
+	}
+	return s, nil
+}
+
+func parseSignatureTemplate(name, tmpl string) (*template.Template, error) {
+	if tmpl == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("outgoing %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// apply signs text sent by sender to room's chat.
+func (s *outgoingSignature) apply(room *database.RoomMapping, sender, text string) (string, error) {
+	if s == nil || s.skip[room.MatrixRoomID] || s.skip[room.WeChatChatID] {
+		return text, nil
+	}
+	data := signatureData{Sender: matrixLocalpart(sender), Room: room.Name}
+	var b strings.Builder
+	if s.prefix != nil {
+		if err := s.prefix.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("outgoing prefix: %w", err)
+		}
+	}
+	b.WriteString(text)
+	if s.suffix != nil {
+		if err := s.suffix.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("outgoing suffix: %w", err)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func TestOutgoingSignature_Apply(t *testing.T) {
+	s, err := newOutgoingSignature("[Bridged] ", " -- {{.Sender}} via {{.Room}}", []string{"!skip:test", "wxid_skip"})
+	if err != nil {
+		t.Fatalf("newOutgoingSignature: %v", err)
+	}
+
+	tests := []struct {
+		room *database.RoomMapping
+		want string
+	}{
+		{&database.RoomMapping{MatrixRoomID: "!room:test", WeChatChatID: "123@chatroom", Name: "Team"}, "[Bridged] hello -- alice via Team"},
+		{&database.RoomMapping{MatrixRoomID: "!skip:test", WeChatChatID: "456@chatroom"}, "hello"},
+		{&database.RoomMapping{MatrixRoomID: "!dm:test", WeChatChatID: "wxid_skip"}, "hello"},
+	}
+	for _, tt := range tests {
+		got, err := s.apply(tt.room, "@alice:example.com", "hello")
+		if err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("apply in %s = %q, want %q", tt.room.MatrixRoomID, got, tt.want)
+		}
+	}
+}
+
+func TestOutgoingSignature_Disabled(t *testing.T) {
+	s, err := newOutgoingSignature("", "", nil)
+	if err != nil || s != nil {
+		t.Fatalf("empty templates should disable signing: %v, %v", s, err)
+	}
+	got, err := s.apply(&database.RoomMapping{}, "@alice:example.com", "hello")
+	if err != nil || got != "hello" {
+		t.Fatalf("nil signature changed text: %q, %v", got, err)
+	}
+}
+
+func TestNewOutgoingSignature_InvalidTemplate(t *testing.T) {
+	if _, err := newOutgoingSignature("{{.Sender", "", nil); err == nil {
+		t.Fatal("expected error for invalid prefix template")
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_SignsOutgoingText(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:       slog.Default(),
+		Puppets:   newTestPuppetManager(),
+		Processor: &defaultMessageProcessor{},
+		Provider:  provider,
+	})
+	if err := er.SetOutgoingSignature("[Bridged] ", " (sent from Matrix)", []string{"!unsigned:test"}); err != nil {
+		t.Fatalf("SetOutgoingSignature: %v", err)
+	}
+
+	for _, room := range []*database.RoomMapping{
+		{WeChatChatID: "123@chatroom", MatrixRoomID: "!room:test", BridgeUser: "@owner:test"},
+		{WeChatChatID: "456@chatroom", MatrixRoomID: "!unsigned:test", BridgeUser: "@owner:test"},
+	} {
+		err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+			ID:      "$event:test",
+			Type:    "m.room.message",
+			RoomID:  room.MatrixRoomID,
+			Sender:  "@owner:test",
+			Content: map[string]interface{}{"msgtype": "m.text", "body": "hello"},
+		}, room)
+		if err != nil {
+			t.Fatalf("handleMatrixMessage: %v", err)
+		}
+	}
+
+	want := []string{"[Bridged] hello (sent from Matrix)", "hello"}
+	if len(provider.sentTexts) != len(want) {
+		t.Fatalf("sent %q, want %q", provider.sentTexts, want)
+	}
+	for i := range want {
+		if provider.sentTexts[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, provider.sentTexts[i], want[i])
+		}
+	}
+}
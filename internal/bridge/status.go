@@ -0,0 +1,126 @@
+package bridge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStatusPageSize = 100
+	maxStatusPageSize     = 500
+)
+
+// roomStatus is one entry of the /status response.
+type roomStatus struct {
+	MatrixRoomID  string     `json:"matrix_room_id"`
+	WeChatChatID  string     `json:"wechat_chat_id"`
+	BridgeUser    string     `json:"bridge_user"`
+	IsGroup       bool       `json:"is_group"`
+	MemberCount   int        `json:"member_count"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+}
+
+// handleStatus lists mapped rooms and their sync state for operators.
+// Results are paginated by Matrix room ID: pass ?limit=N and ?after=<next>
+// from the previous response to fetch the following page.
+func (b *Bridge) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !b.authenticateAdmin(r) {
+		writeStatusError(w, http.StatusForbidden, "bad token")
+		return
+	}
+	if b.DB == nil || b.DB.RoomMapping == nil {
+		writeStatusError(w, http.StatusServiceUnavailable, "database not initialized")
+		return
+	}
+
+	limit := defaultStatusPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeStatusError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxStatusPageSize)
+	}
+	after := r.URL.Query().Get("after")
+
+	ctx := r.Context()
+	rooms, err := b.DB.RoomMapping.ListPage(ctx, after, limit)
+	if err != nil {
+		b.Log.Error("status: failed to list rooms", "error", err)
+		writeStatusError(w, http.StatusInternalServerError, "failed to list rooms")
+		return
+	}
+
+	entries := make([]roomStatus, 0, len(rooms))
+	for _, room := range rooms {
+		entry := roomStatus{
+			MatrixRoomID: room.MatrixRoomID,
+			WeChatChatID: room.WeChatChatID,
+			BridgeUser:   room.BridgeUser,
+			IsGroup:      room.IsGroup,
+		}
+		if room.IsGroup && b.DB.GroupMember != nil {
+			if count, err := b.DB.GroupMember.CountByGroup(ctx, room.WeChatChatID); err == nil {
+				entry.MemberCount = count
+			} else {
+				b.Log.Warn("status: failed to count members", "error", err, "group_id", room.WeChatChatID)
+			}
+		}
+		if b.DB.MessageMapping != nil {
+			if last, err := b.DB.MessageMapping.GetLastTimestamp(ctx, room.MatrixRoomID); err == nil {
+				entry.LastMessageAt = last
+			} else {
+				b.Log.Warn("status: failed to get last message", "error", err, "room_id", room.MatrixRoomID)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	resp := map[string]interface{}{
+		"rooms": entries,
+	}
+	if len(rooms) == limit {
+		resp["next"] = rooms[len(rooms)-1].MatrixRoomID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// authenticateAdmin checks the bearer token (or access_token query parameter)
+// against the configured admin token, falling back to the hs_token.
+func (b *Bridge) authenticateAdmin(r *http.Request) bool {
+	if b.Config == nil {
+		return false
+	}
+	expected := b.Config.Metrics.AdminToken
+	if expected == "" {
+		expected = b.Config.AppService.HSToken
+	}
+	if expected == "" {
+		return false
+	}
+
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func writeStatusError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,137 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/config"
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+const testRoomMappingColumns = `wechat_chat_id, matrix_room_id, bridge_user, is_group,
+	name, avatar_mxc, topic, encrypted, name_set, avatar_set, created_at`
+
+func newStatusTestBridge(t *testing.T) (*Bridge, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.AppService.HSToken = "hs_secret"
+	cfg.Metrics.AdminToken = "admin_secret"
+
+	return &Bridge{
+		Config: cfg,
+		Log:    testBridgeLogger(),
+		DB: &database.Database{
+			RoomMapping:    database.NewRoomMappingStore(db),
+			MessageMapping: database.NewMessageMappingStore(db),
+			GroupMember:    database.NewGroupMemberStore(db),
+		},
+	}, mock
+}
+
+func TestBridgeHandleStatus_RequiresAdminToken(t *testing.T) {
+	b, _ := newStatusTestBridge(t)
+
+	for _, token := range []string{"", "hs_secret", "wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		b.handleStatus(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("token %q: status = %d, want 403", token, rec.Code)
+		}
+	}
+}
+
+func TestBridgeHandleStatus_ListsRoomsWithPagination(t *testing.T) {
+	b, mock := newStatusTestBridge(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE matrix_room_id > $1 ORDER BY matrix_room_id LIMIT $2`)).
+		WithArgs("", 2).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"wechat_chat_id", "matrix_room_id", "bridge_user", "is_group",
+			"name", "avatar_mxc", "topic", "encrypted", "name_set", "avatar_set", "created_at",
+		}).
+			AddRow("123@chatroom", "!a:test", "@user:test", true, "Group", "", "", false, true, false, now).
+			AddRow("wxid_friend", "!b:test", "@user:test", false, "Friend", "", "", false, true, false, now))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM group_member WHERE group_id = $1")).
+		WithArgs("123@chatroom").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1")).
+		WithArgs("!a:test").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(now))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1")).
+		WithArgs("!b:test").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/status?limit=2", nil)
+	req.Header.Set("Authorization", "Bearer admin_secret")
+	rec := httptest.NewRecorder()
+	b.handleStatus(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Rooms []roomStatus `json:"rooms"`
+		Next  string       `json:"next"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Rooms) != 2 {
+		t.Fatalf("rooms = %d", len(resp.Rooms))
+	}
+	if resp.Rooms[0].MemberCount != 42 || !resp.Rooms[0].IsGroup {
+		t.Fatalf("unexpected group room: %+v", resp.Rooms[0])
+	}
+	if resp.Rooms[0].LastMessageAt == nil || !resp.Rooms[0].LastMessageAt.Equal(now) {
+		t.Fatalf("last_message_at = %v", resp.Rooms[0].LastMessageAt)
+	}
+	if resp.Rooms[1].LastMessageAt != nil {
+		t.Fatalf("expected nil last_message_at, got %v", resp.Rooms[1].LastMessageAt)
+	}
+	if resp.Next != "!b:test" {
+		t.Fatalf("next = %q", resp.Next)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBridgeHandleStatus_FallsBackToHSToken(t *testing.T) {
+	b, mock := newStatusTestBridge(t)
+	b.Config.Metrics.AdminToken = ""
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+testRoomMappingColumns+` FROM room_mapping WHERE matrix_room_id > $1 ORDER BY matrix_room_id LIMIT $2`)).
+		WithArgs("!x:test", defaultStatusPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"wechat_chat_id", "matrix_room_id", "bridge_user", "is_group",
+			"name", "avatar_mxc", "topic", "encrypted", "name_set", "avatar_set", "created_at",
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/status?after=!x:test&access_token=hs_secret", nil)
+	rec := httptest.NewRecorder()
+	b.handleStatus(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package bridge
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Long text handling modes for bridge.message_handling.long_text_mode.
+const (
+	LongTextSplit  = "split"
+	LongTextReject = "reject"
+)
+
+// sentenceTerminators are the runes after which a message may be split when
+// no line break is available. Both ASCII and full-width CJK punctuation count.
+const sentenceTerminators = ".!?。！？；;"
+
+// splitText breaks text into chunks of at most limit runes, preserving order.
+// Cuts prefer line breaks, then sentence ends, then whitespace, and only fall
+// back to a hard cut when a chunk has none of those in its second half.
+// Whitespace at chunk boundaries is dropped. A non-positive limit disables
+// splitting.
+func splitText(text string, limit int) []string {
+	if limit <= 0 || len([]rune(text)) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := findSplitPoint(runes[:limit])
+		chunk := strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace)
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = []rune(strings.TrimLeftFunc(string(runes[cut:]), unicode.IsSpace))
+	}
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
+
+// findSplitPoint returns the index just past the best boundary in window.
+func findSplitPoint(window []rune) int {
+	minCut := len(window) / 2
+
+	for i := len(window) - 1; i >= minCut; i-- {
+		if window[i] == '\n' {
+			return i + 1
+		}
+	}
+	for i := len(window) - 1; i >= minCut; i-- {
+		if strings.ContainsRune(sentenceTerminators, window[i]) {
+			return i + 1
+		}
+	}
+	for i := len(window) - 1; i >= minCut; i-- {
+		if unicode.IsSpace(window[i]) {
+			return i + 1
+		}
+	}
+	return len(window)
+}
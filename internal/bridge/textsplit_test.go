@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func TestSplitText_ShortTextUnchanged(t *testing.T) {
+	chunks := splitText("hello", 10)
+	if len(chunks) != 1 || chunks[0] != "hello" {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+}
+
+func TestSplitText_PrefersLineBreaks(t *testing.T) {
+	text := "first line here\nsecond line here\nthird line here"
+
+	chunks := splitText(text, 20)
+	want := []string{"first line here", "second line here", "third line here"}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks %q, want %q", len(chunks), chunks, want)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Fatalf("chunk %d = %q, want %q", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestSplitText_SentenceBoundaryCJK(t *testing.T) {
+	text := "今天天气很好。我们去公园散步吧！好的"
+
+	chunks := splitText(text, 10)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks: %q", len(chunks), chunks)
+	}
+	if chunks[0] != "今天天气很好。" || chunks[1] != "我们去公园散步吧！" || chunks[2] != "好的" {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+}
+
+func TestSplitText_HardCutWithoutBoundaries(t *testing.T) {
+	text := strings.Repeat("a", 25)
+
+	chunks := splitText(text, 10)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks: %q", len(chunks), chunks)
+	}
+	if strings.Join(chunks, "") != text {
+		t.Fatalf("chunks do not reassemble: %q", chunks)
+	}
+	for _, c := range chunks {
+		if len([]rune(c)) > 10 {
+			t.Fatalf("chunk exceeds limit: %q", c)
+		}
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_SplitsLongText(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:           slog.Default(),
+		Puppets:       newTestPuppetManager(),
+		Processor:     &defaultMessageProcessor{},
+		Provider:      provider,
+		MaxTextLength: 12,
+		LongTextMode:  LongTextSplit,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test"}
+
+	err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+		ID:     "$event:test",
+		Type:   "m.room.message",
+		RoomID: room.MatrixRoomID,
+		Sender: "@user:test",
+		Content: map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    "one two three. four five six. seven",
+		},
+	}, room)
+	if err != nil {
+		t.Fatalf("handleMatrixMessage: %v", err)
+	}
+
+	want := []string{"one two", "three. four", "five six.", "seven"}
+	if len(provider.sentTexts) != len(want) {
+		t.Fatalf("sent %q, want %q", provider.sentTexts, want)
+	}
+	for i := range want {
+		if provider.sentTexts[i] != want[i] {
+			t.Fatalf("part %d = %q, want %q", i, provider.sentTexts[i], want[i])
+		}
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_RejectsLongText(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:           slog.Default(),
+		Puppets:       newTestPuppetManager(),
+		Processor:     &defaultMessageProcessor{},
+		Provider:      provider,
+		MaxTextLength: 5,
+		LongTextMode:  LongTextReject,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test"}
+
+	err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+		ID:      "$event:test",
+		Type:    "m.room.message",
+		RoomID:  room.MatrixRoomID,
+		Sender:  "@user:test",
+		Content: map[string]interface{}{"msgtype": "m.text", "body": "too long for wechat"},
+	}, room)
+	if err == nil {
+		t.Fatal("expected error for over-length text")
+	}
+	if len(provider.sentTexts) != 0 {
+		t.Fatalf("expected nothing sent, got %q", provider.sentTexts)
+	}
+}
@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+)
+
+// Transcriber turns the speech in a voice message into text. WeChat doesn't
+// transcribe personal voice messages, so backends are user-provided through
+// Bridge.Transcriber; the transcript is bridged as a notice replying to the
+// audio.
+type Transcriber interface {
+	// Transcribe returns the text spoken in audio, or "" if there is none.
+	Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error)
+}
+
+// NoopTranscriber is the default Transcriber. It never returns a transcript.
+type NoopTranscriber struct{}
+
+// Transcribe implements Transcriber.
+func (NoopTranscriber) Transcribe(context.Context, []byte, string) (string, error) {
+	return "", nil
+}
+
+// transcribeVoice runs the transcriber on voice audio. Failures are logged
+// and leave the voice message without a transcript.
+func (p *defaultMessageProcessor) transcribeVoice(ctx context.Context, msgID string, audio []byte, mimeType string) string {
+	if p.transcriber == nil {
+		return ""
+	}
+	transcript, err := p.transcriber.Transcribe(ctx, audio, mimeType)
+	if err != nil {
+		p.log.Warn("voice transcription failed", "error", err, "msg_id", msgID)
+		return ""
+	}
+	return strings.TrimSpace(transcript)
+}
+
+// sendTranscript posts the transcript of a bridged voice message as a notice
+// replying to it, from the sender of the audio. A failure only loses the
+// transcript, so it is logged.
+func (er *EventRouter) sendTranscript(ctx context.Context, roomID, sender, audioEventID, transcript string) {
+	content := map[string]interface{}{
+		"msgtype": "m.notice",
+		"body":    "🎤 " + transcript,
+		"m.relates_to": map[string]interface{}{
+			"m.in_reply_to": map[string]interface{}{
+				"event_id": audioEventID,
+			},
+		},
+	}
+	eventType := "m.room.message"
+	if encType, encContent, err := er.crypto.Encrypt(ctx, roomID, eventType, content); err != nil {
+		er.log.Warn("failed to encrypt transcript, sending unencrypted", "error", err, "room_id", roomID)
+	} else {
+		eventType, content = encType, encContent
+	}
+	if _, err := er.matrixClient.SendMessage(ctx, roomID, sender, eventType, content); err != nil {
+		er.log.Warn("failed to send voice transcript", "error", err, "room_id", roomID, "event_id", audioEventID)
+	}
+}
@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+type stubTranscriber struct {
+	transcript string
+	err        error
+	mimeType   string
+}
+
+func (s *stubTranscriber) Transcribe(_ context.Context, _ []byte, mimeType string) (string, error) {
+	s.mimeType = mimeType
+	return s.transcript, s.err
+}
+
+func voiceMessage() *wechat.Message {
+	return &wechat.Message{
+		MsgID: "voice1", Type: wechat.MsgVoice, FromUser: "wxid_bob", ToUser: "wxid_me",
+		MediaData: []byte("OggS voice"), FileName: "voice.ogg",
+	}
+}
+
+func TestEventRouter_OnMessage_VoiceTranscriptRepliesToAudio(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, newMockProvider("wxid_me", 2)))
+	expectDMRoute(mock, 1)
+	transcriber := &stubTranscriber{transcript: " See you at eight \n"}
+	er.processor.(*defaultMessageProcessor).transcriber = transcriber
+
+	if err := er.OnMessage(context.Background(), voiceMessage()); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 2 {
+		t.Fatalf("sent %d events, want the audio and its transcript", len(matrix.sent))
+	}
+	audio := matrix.sent[0].content.(map[string]interface{})
+	if audio["msgtype"] != "m.audio" || audio["body"] != "voice message" || audio["url"] != "mxc://test/uploaded" {
+		t.Fatalf("audio %v", audio)
+	}
+	notice := matrix.sent[1]
+	content := notice.content.(map[string]interface{})
+	if content["msgtype"] != "m.notice" || content["body"] != "🎤 See you at eight" {
+		t.Fatalf("transcript %v", content)
+	}
+	replyTo := content["m.relates_to"].(map[string]interface{})["m.in_reply_to"].(map[string]interface{})
+	if replyTo["event_id"] != "$event:test" {
+		t.Fatalf("transcript replies to %v, want the audio", replyTo["event_id"])
+	}
+	if notice.sender != "@wechat_wxid_bob:example.com" {
+		t.Fatalf("transcript sent by %s, want the puppet", notice.sender)
+	}
+	if transcriber.mimeType != "audio/ogg" {
+		t.Fatalf("transcriber got %q", transcriber.mimeType)
+	}
+}
+
+func TestEventRouter_OnMessage_TranscriptionFailureKeepsAudio(t *testing.T) {
+	matrix := &testMatrixClient{}
+	er, mock := newTestRouter(t, matrix, withMediaProvider(matrix, newMockProvider("wxid_me", 2)))
+	expectDMRoute(mock, 1)
+	er.processor.(*defaultMessageProcessor).transcriber = &stubTranscriber{err: errors.New("backend down")}
+
+	if err := er.OnMessage(context.Background(), voiceMessage()); err != nil {
+		t.Fatalf("OnMessage: %v", err)
+	}
+	if len(matrix.sent) != 1 {
+		t.Fatalf("sent %d events, want only the audio", len(matrix.sent))
+	}
+	if content := matrix.sent[0].content.(map[string]interface{}); content["msgtype"] != "m.audio" {
+		t.Fatalf("sent %v", content)
+	}
+}
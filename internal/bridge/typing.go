@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+// handleMatrixTyping forwards the bridge user's typing indicator to WeChat.
+// An m.typing event lists everyone typing in the room, so the indicator is
+// only sent when the bridge user starts or stops typing.
+//
+// This is plumbing only for now: none of the bundled providers can send a
+// typing indicator (WeChatPadPro, the iPad protocol, the PC hook and WeCom
+// have no API for it), so they all report Capabilities().Typing false and
+// nothing reaches WeChat.
+func (er *EventRouter) handleMatrixTyping(ctx context.Context, evt *MatrixEvent, room *database.RoomMapping) error {
+	typing := er.typingFromBridgeUser(evt.Content, room)
+
+	er.typingMu.Lock()
+	changed := er.typingRooms[room.MatrixRoomID] != typing
+	if changed {
+		if er.typingRooms == nil {
+			er.typingRooms = make(map[string]bool)
+		}
+		if typing {
+			er.typingRooms[room.MatrixRoomID] = true
+		} else {
+			delete(er.typingRooms, room.MatrixRoomID)
+		}
+	}
+	er.typingMu.Unlock()
+	if !changed {
+		return nil
+	}
+
+	provider, err := er.getProviderForRoom(ctx, room)
+	if err != nil {
+		return fmt.Errorf("get provider for typing: %w", err)
+	}
+	if provider == nil || !provider.Capabilities().Typing {
+		return nil
+	}
+	if err := provider.SendTyping(ctx, room.WeChatChatID, typing); err != nil {
+		return fmt.Errorf("send wechat typing: %w", err)
+	}
+	er.log.Debug("forwarded Matrix typing to WeChat", "chat_id", room.WeChatChatID, "typing", typing)
+	return nil
+}
+
+// typingFromBridgeUser reports whether an m.typing event's user_ids include
+// the room's bridge user. Rooms without a recorded owner accept any
+// non-puppet.
+func (er *EventRouter) typingFromBridgeUser(content map[string]interface{}, room *database.RoomMapping) bool {
+	userIDs, _ := content["user_ids"].([]interface{})
+	for _, raw := range userIDs {
+		userID, _ := raw.(string)
+		if userID == "" || (er.puppets != nil && er.puppets.IsPuppet(userID)) {
+			continue
+		}
+		if room.BridgeUser == "" || room.BridgeUser == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func newTypingEvent(userIDs ...string) *MatrixEvent {
+	ids := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = id
+	}
+	return &MatrixEvent{
+		Type:    "m.typing",
+		RoomID:  "!room:test",
+		Content: map[string]interface{}{"user_ids": ids},
+	}
+}
+
+func TestEventRouter_HandleMatrixTyping_ForwardsChanges(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	provider.typing = true
+	er := NewEventRouter(EventRouterConfig{
+		Log:      slog.Default(),
+		Puppets:  newTestPuppetManager(),
+		Provider: provider,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+	ctx := context.Background()
+
+	for _, evt := range []*MatrixEvent{
+		newTypingEvent("@user:test"),
+		newTypingEvent("@user:test", "@other:test"), // still typing
+		newTypingEvent("@other:test"),
+		newTypingEvent(),
+	} {
+		if err := er.handleMatrixTyping(ctx, evt, room); err != nil {
+			t.Fatalf("handleMatrixTyping: %v", err)
+		}
+	}
+
+	want := []string{"wxid_friend/true", "wxid_friend/false"}
+	if !reflect.DeepEqual(provider.typingSent, want) {
+		t.Fatalf("typing sent = %v, want %v", provider.typingSent, want)
+	}
+}
+
+func TestEventRouter_HandleMatrixTyping_UnsupportedProviderNoop(t *testing.T) {
+	provider := newMockProvider("padpro", 2)
+	er := NewEventRouter(EventRouterConfig{
+		Log:      slog.Default(),
+		Puppets:  newTestPuppetManager(),
+		Provider: provider,
+	})
+	room := &database.RoomMapping{WeChatChatID: "wxid_friend", MatrixRoomID: "!room:test", BridgeUser: "@user:test"}
+
+	if err := er.handleMatrixTyping(context.Background(), newTypingEvent("@user:test"), room); err != nil {
+		t.Fatalf("handleMatrixTyping: %v", err)
+	}
+	if len(provider.typingSent) != 0 {
+		t.Fatalf("expected no typing, got %v", provider.typingSent)
+	}
+}
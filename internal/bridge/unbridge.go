@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"context"
+)
+
+// UnbridgeRoom stops bridging a Matrix room: its mapping, message mappings
+// and, unless another room still bridges the group, group members are
+// deleted, then the chat's puppets and the bridge bot leave the room. It
+// reports false if the room isn't bridged.
+func (er *EventRouter) UnbridgeRoom(ctx context.Context, matrixRoomID string) (bool, error) {
+	room, err := er.rooms.GetByMatrixRoomID(ctx, matrixRoomID)
+	if err != nil {
+		return false, err
+	}
+	if room == nil {
+		return false, nil
+	}
+
+	// The members are gone from the database once the room is deleted.
+	wechatIDs := []string{room.WeChatChatID}
+	if room.IsGroup {
+		wechatIDs = nil
+		if er.groupMembers != nil {
+			members, err := er.groupMembers.GetByGroup(ctx, room.WeChatChatID)
+			if err != nil {
+				er.log.Warn("failed to list group members for unbridging", "error", err, "group_id", room.WeChatChatID)
+			}
+			for _, m := range members {
+				wechatIDs = append(wechatIDs, m.WeChatID)
+			}
+		}
+	}
+
+	deleted, err := er.rooms.DeleteWithCascade(ctx, matrixRoomID)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	er.log.Info("unbridged room", "room_id", matrixRoomID, "chat_id", room.WeChatChatID, "bridge_user", room.BridgeUser)
+
+	if er.matrixClient == nil {
+		return true, nil
+	}
+	for _, wechatID := range wechatIDs {
+		puppet, err := er.puppets.GetByWeChatID(ctx, wechatID)
+		if err != nil || puppet == nil {
+			continue
+		}
+		if err := er.matrixClient.LeaveRoom(ctx, puppet.MatrixUserID, matrixRoomID); err != nil {
+			er.log.Warn("failed to remove puppet from room", "error", err, "user_id", wechatID, "room_id", matrixRoomID)
+		}
+	}
+	if er.botUserID != "" {
+		if err := er.matrixClient.LeaveRoom(ctx, er.botUserID, matrixRoomID); err != nil {
+			er.log.Warn("failed to leave room", "error", err, "room_id", matrixRoomID)
+		}
+	}
+	return true, nil
+}
+
+func (cp *CommandProcessor) cmdUnbridge(ctx context.Context, ce *CommandEvent) error {
+	if cp.router.rooms == nil {
+		ce.Reply("Unbridging rooms is not supported by this bridge.")
+		return nil
+	}
+	room, err := cp.router.rooms.GetByMatrixRoomID(ctx, ce.RoomID)
+	if err != nil {
+		return err
+	}
+	if room == nil || room.BridgeUser != ce.Sender {
+		ce.Reply("Use `%s unbridge` in one of your bridged WeChat rooms.", cp.prefix)
+		return nil
+	}
+
+	// The bridge bot leaves the room, so the reply has to come first.
+	ce.Reply("Unbridging this room from WeChat. Messages will no longer be bridged.")
+	_, err = cp.router.UnbridgeRoom(ctx, ce.RoomID)
+	return err
+}
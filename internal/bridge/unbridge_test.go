@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/n42/mautrix-wechat/internal/database"
+)
+
+func expectUnbridge(mock sqlmock.Sqlmock, roomID, chatID string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_chat_id FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs(roomID).
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_chat_id"}).AddRow(chatID))
+	for _, table := range []string{"message_mapping", "message_state", "room_member_name", "pinned_announcement", "group_member", "room_mapping"} {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM ` + table)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestCommandProcessor_UnbridgeLeavesRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+	cp.router.groupMembers = database.NewGroupMemberStore(db)
+	cp.router.botUserID = "@wechatbot:example.com"
+	cp.router.puppets.puppets["wxid_bob"] = &Puppet{WeChatID: "wxid_bob", MatrixUserID: "@wechat_wxid_bob:example.com"}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+			WithArgs("!mgmt:test").
+			WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+				AddRow("123@chatroom", "!mgmt:test", "@user:test", true, "Team", "", "", false, true, false, now))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM group_member WHERE group_id = $1`)).
+		WithArgs("123@chatroom").
+		WillReturnRows(sqlmock.NewRows([]string{"group_id", "wechat_id", "display_name", "is_admin", "is_owner", "joined_at"}).
+			AddRow("123@chatroom", "wxid_bob", "Bob", false, false, now))
+	expectUnbridge(mock, "!mgmt:test", "123@chatroom")
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat unbridge"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	want := []string{"!mgmt:test/@wechat_wxid_bob:example.com", "!mgmt:test/@wechatbot:example.com"}
+	if len(matrix.left) != len(want) || matrix.left[0] != want[0] || matrix.left[1] != want[1] {
+		t.Fatalf("left = %v, want %v", matrix.left, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCommandProcessor_UnbridgeRequiresOwnRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	matrix := &testMatrixClient{}
+	cp := newTestCommandProcessor(matrix, newMockProvider("padpro", 2), nil)
+	cp.router.rooms = database.NewRoomMappingStore(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!mgmt:test").
+		WillReturnRows(sqlmock.NewRows(testRoomMappingColumnNames).
+			AddRow("wxid_alice", "!mgmt:test", "@other:test", false, "Alice", "", "", false, true, false, time.Now()))
+
+	if err := cp.Handle(context.Background(), newCommandEvent("!wechat unbridge"), true); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if reply := lastReply(t, matrix); reply != "Use `!wechat unbridge` in one of your bridged WeChat rooms." {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if len(matrix.left) != 0 {
+		t.Fatalf("left = %v, want the room kept", matrix.left)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/internal/voice"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// VoiceConverter transcodes voice messages between WeChat's silk and AMR
+// formats and the ogg/opus Matrix clients play. voice.Converter implements
+// it; media.voice_converter: silk2ogg enables it.
+type VoiceConverter interface {
+	SilkToOgg(silkData io.Reader) ([]byte, error)
+	AmrToOgg(amrData io.Reader) ([]byte, error)
+	OggToSilk(oggData io.Reader) ([]byte, error)
+	// CanEncode reports whether OggToSilk is available.
+	CanEncode() bool
+}
+
+// voiceWithMedia uploads a voice message, transcoding silk and AMR audio to
+// ogg/opus first when a converter is set, and transcribes it. Audio that
+// fails to convert is uploaded as received.
+func (p *defaultMessageProcessor) voiceWithMedia(ctx context.Context, msg *wechat.Message, content *MatrixEventContent) (*MatrixEventContent, error) {
+	if p.matrixClient == nil || (len(msg.MediaData) == 0 && msg.MediaURL == "") {
+		return p.withMedia(ctx, msg, content)
+	}
+	data, _, err := p.readMedia(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("upload voice: %w", err)
+	}
+
+	mimeType := voice.DetectMimeType(data)
+	durationMs := msg.Duration * 1000
+	if durationMs == 0 {
+		durationMs = voice.DurationMs(data, mimeType)
+	}
+	fileName := msg.FileName
+	if fileName == "" {
+		fileName = "voice"
+	}
+	if converted := p.transcodeVoice(msg.MsgID, data, mimeType); converted != nil {
+		data, mimeType = converted, voice.MimeOgg
+		fileName = strings.TrimSuffix(fileName, path.Ext(fileName)) + ".ogg"
+	}
+
+	mxcURI, err := p.matrixClient.UploadMedia(ctx, data, mimeType, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("upload voice: %w", err)
+	}
+	content.Content["url"] = mxcURI
+	content.Content["info"] = map[string]interface{}{
+		"mimetype": mimeType,
+		"duration": durationMs,
+		"size":     len(data),
+	}
+	// Marks the audio as a voice message (MSC3245)
+	content.Content["org.matrix.msc3245.voice"] = map[string]interface{}{}
+	content.Transcript = p.transcribeVoice(ctx, msg.MsgID, data, mimeType)
+	return content, nil
+}
+
+// transcodeVoice converts silk or AMR audio to ogg/opus. It returns nil
+// without a converter, for other audio or when conversion fails, so the
+// caller uploads the original.
+func (p *defaultMessageProcessor) transcodeVoice(msgID string, data []byte, mimeType string) []byte {
+	if p.voiceConverter == nil {
+		return nil
+	}
+	var converted []byte
+	var err error
+	switch mimeType {
+	case voice.MimeSilk:
+		converted, err = p.voiceConverter.SilkToOgg(bytes.NewReader(data))
+	case voice.MimeAMR:
+		converted, err = p.voiceConverter.AmrToOgg(bytes.NewReader(data))
+	default:
+		return nil
+	}
+	if err != nil || len(converted) == 0 {
+		p.log.Warn("voice transcoding failed, uploading original audio",
+			"error", err, "mimetype", mimeType, "msg_id", msgID)
+		return nil
+	}
+	return converted
+}
+
+// transcodeVoice converts ogg/opus audio downloaded from Matrix to silk,
+// which WeChat plays voice messages in. Without a converter able to encode
+// silk, or if conversion fails, the audio is sent as is.
+func (er *EventRouter) transcodeVoice(r io.Reader) (io.Reader, error) {
+	if er.voiceConverter == nil || !er.voiceConverter.CanEncode() {
+		return r, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if voice.DetectMimeType(data) != voice.MimeOgg {
+		return bytes.NewReader(data), nil
+	}
+	silk, err := er.voiceConverter.OggToSilk(bytes.NewReader(data))
+	if err != nil {
+		er.log.Warn("voice transcoding failed, sending original", "error", err)
+		return bytes.NewReader(data), nil
+	}
+	return bytes.NewReader(silk), nil
+}
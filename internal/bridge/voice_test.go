@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/internal/database"
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+type fakeVoiceConverter struct {
+	err        error
+	cantEncode bool
+	calls      []string
+}
+
+func (c *fakeVoiceConverter) convert(kind string) ([]byte, error) {
+	c.calls = append(c.calls, kind)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return []byte("converted-from-" + kind), nil
+}
+
+func (c *fakeVoiceConverter) SilkToOgg(io.Reader) ([]byte, error) { return c.convert("silk") }
+func (c *fakeVoiceConverter) AmrToOgg(io.Reader) ([]byte, error)  { return c.convert("amr") }
+func (c *fakeVoiceConverter) OggToSilk(io.Reader) ([]byte, error) { return c.convert("ogg") }
+func (c *fakeVoiceConverter) CanEncode() bool                     { return !c.cantEncode }
+
+// testSilkData builds a WeChat-style silk stream with the given number of
+// 20ms frames.
+func testSilkData(frames int) []byte {
+	data := append([]byte{0x02}, "#!SILK_V3"...)
+	for i := 0; i < frames; i++ {
+		data = append(data, 0x03, 0x00, 0xAA, 0xBB, 0xCC)
+	}
+	return append(data, 0xFF, 0xFF)
+}
+
+func TestDefaultProcessor_VoiceTranscodesSilk(t *testing.T) {
+	matrix := &testMatrixClient{}
+	vc := &fakeVoiceConverter{}
+	p := &defaultMessageProcessor{log: slog.Default(), matrixClient: matrix, voiceConverter: vc}
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID:     "voice1",
+		Type:      wechat.MsgVoice,
+		MediaData: testSilkData(100),
+		FileName:  "voice.silk",
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if len(vc.calls) != 1 || vc.calls[0] != "silk" {
+		t.Fatalf("converter calls %v", vc.calls)
+	}
+	if len(matrix.uploads) != 1 || string(matrix.uploads[0]) != "converted-from-silk" {
+		t.Fatalf("uploads %q", matrix.uploads)
+	}
+	if content.Content["msgtype"] != "m.audio" || content.Content["url"] != "mxc://test/uploaded" {
+		t.Fatalf("content %v", content.Content)
+	}
+	info := content.Content["info"].(map[string]interface{})
+	if info["mimetype"] != "audio/ogg" || info["duration"] != 2000 || info["size"] != len("converted-from-silk") {
+		t.Fatalf("info %v", info)
+	}
+	if _, ok := content.Content["org.matrix.msc3245.voice"]; !ok {
+		t.Fatal("voice message flag missing")
+	}
+}
+
+func TestDefaultProcessor_VoiceFallsBackWhenConversionFails(t *testing.T) {
+	matrix := &testMatrixClient{}
+	p := &defaultMessageProcessor{
+		log:            slog.Default(),
+		matrixClient:   matrix,
+		voiceConverter: &fakeVoiceConverter{err: errors.New("ffmpeg not found")},
+	}
+
+	amr := append([]byte("#!AMR\n"), 0x3C)
+	amr = append(amr, make([]byte, 31)...)
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID:     "voice2",
+		Type:      wechat.MsgVoice,
+		MediaData: amr,
+		Duration:  3,
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if len(matrix.uploads) != 1 || !bytes.Equal(matrix.uploads[0], amr) {
+		t.Fatal("expected the original audio to be uploaded")
+	}
+	info := content.Content["info"].(map[string]interface{})
+	if info["mimetype"] != "audio/amr" || info["duration"] != 3000 {
+		t.Fatalf("info %v", info)
+	}
+}
+
+func TestEventRouter_HandleMatrixMessage_ConvertsVoiceToSilk(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		vc   *fakeVoiceConverter
+		want string
+	}{
+		{"converted", &fakeVoiceConverter{}, "converted-from-ogg"},
+		{"no encoder", &fakeVoiceConverter{cantEncode: true}, "OggS voice"},
+		{"conversion fails", &fakeVoiceConverter{err: errors.New("bad audio")}, "OggS voice"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			matrix := &testMatrixClient{mediaData: []byte("OggS voice"), mediaType: "audio/ogg"}
+			provider := newMockProvider("padpro", 2)
+			er := NewEventRouter(EventRouterConfig{
+				Log:            slog.Default(),
+				Puppets:        newTestPuppetManager(),
+				Processor:      &defaultMessageProcessor{},
+				Provider:       provider,
+				MatrixClient:   matrix,
+				VoiceConverter: tt.vc,
+			})
+
+			err := er.handleMatrixMessage(context.Background(), &MatrixEvent{
+				ID:     "$voice:test",
+				Type:   "m.room.message",
+				RoomID: "!room:test",
+				Sender: "@user:test",
+				Content: map[string]interface{}{
+					"msgtype": "m.audio",
+					"body":    "voice.ogg",
+					"url":     "mxc://test/voice",
+				},
+			}, &database.RoomMapping{WeChatChatID: "wxid_chat", MatrixRoomID: "!room:test"})
+			if err != nil {
+				t.Fatalf("handleMatrixMessage: %v", err)
+			}
+			if len(provider.sentVoices) != 1 || string(provider.sentVoices[0].data) != tt.want {
+				t.Fatalf("sent voices %+v, want %q", provider.sentVoices, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"text/template"
 
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 	"gopkg.in/yaml.v3"
 )
 
@@ -50,25 +52,162 @@ type DatabaseConfig struct {
 	URI          string `yaml:"uri"`
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
+
+	// ConnectAttempts is how often startup tries to reach the database
+	// before giving up, waiting 1s, 2s, 4s, ... in between. Default 5.
+	// ConnectTimeoutS is the timeout of each attempt in seconds. Default 10.
+	ConnectAttempts int `yaml:"connect_attempts"`
+	ConnectTimeoutS int `yaml:"connect_timeout_s"`
+
+	// HealthCheckIntervalS is how often the running bridge pings the
+	// database, in seconds, dropping idle connections after a failed ping so
+	// the pool reconnects. Default 30; -1 disables.
+	HealthCheckIntervalS int `yaml:"health_check_interval_s"`
 }
 
+// legacyDisplaynameTemplate is the displayname_template default from before
+// the template had a Remark field. Validate replaces it with the current
+// default, which names contacts the same way.
+const legacyDisplaynameTemplate = "{{.Nickname}} (WeChat)"
+
 // BridgeConfig contains bridge-specific settings.
 type BridgeConfig struct {
 	Permissions         map[string]string     `yaml:"permissions"`
 	UsernameTemplate    string                `yaml:"username_template"`
-	DisplaynameTemplate string                `yaml:"displayname_template"`
+	DisplaynameTemplate string                `yaml:"displayname_template"` // Go template over Nickname, Remark, Alias, City and Wxid
 	MessageHandling     MessageHandlingConfig `yaml:"message_handling"`
 	Encryption          EncryptionConfig      `yaml:"encryption"`
 	RateLimit           RateLimitConfig       `yaml:"rate_limit"`
 	Media               MediaConfig           `yaml:"media"`
+	Commands            CommandsConfig        `yaml:"commands"`
+	DoublePuppet        DoublePuppetConfig    `yaml:"double_puppet"`
+	Moments             MomentsConfig         `yaml:"moments"`
+	Backfill            BackfillConfig        `yaml:"backfill"`
+	Filters             FiltersConfig         `yaml:"filters"`
+
+	// OfficialAccountDisplaynameTemplate names official account (gh_)
+	// puppets. Default "{{.Nickname}} (Official Account)".
+	OfficialAccountDisplaynameTemplate string `yaml:"official_account_displayname_template"`
+
+	// PatAsReaction bridges WeChat pats (拍一拍) as a 👋 reaction on the
+	// patted user's latest message instead of a notice.
+	PatAsReaction bool `yaml:"pat_as_reaction"`
+
+	// OutgoingPrefix and OutgoingSuffix are Go templates over Sender (the
+	// Matrix sender's localpart) and Room (the room name) added to all text
+	// sent to WeChat, e.g. a compliance disclaimer. Media is sent unchanged.
+	// Text sent to OutgoingSignatureSkipRooms, given as Matrix room or
+	// WeChat chat IDs, gets neither.
+	OutgoingPrefix             string   `yaml:"outgoing_prefix"`
+	OutgoingSuffix             string   `yaml:"outgoing_suffix"`
+	OutgoingSignatureSkipRooms []string `yaml:"outgoing_signature_skip_rooms"`
 }
 
 // MessageHandlingConfig controls message processing behavior.
 type MessageHandlingConfig struct {
+	// MaxMessageAge drops incoming WeChat messages older than this many
+	// seconds, e.g. replayed after a reconnect. Default 300; -1 disables.
+	// Explicit backfill is not affected.
 	MaxMessageAge    int  `yaml:"max_message_age"`
 	DeliveryReceipts bool `yaml:"delivery_receipts"`
 	SendReadReceipts bool `yaml:"send_read_receipts"`
 	SyncDirectChat   bool `yaml:"sync_direct_chat_list"`
+
+	// MaxTextLength is the maximum number of characters sent to WeChat in a
+	// single text message. LongTextMode selects what happens to longer text:
+	// "split" sends it as several ordered messages, "reject" fails the send.
+	MaxTextLength int    `yaml:"max_text_length"`
+	LongTextMode  string `yaml:"long_text_mode"`
+
+	// RevokeWindowS is how many seconds after sending WeChat still accepts a
+	// recall. Older Matrix redactions get a notice instead. Default 120.
+	RevokeWindowS int `yaml:"revoke_window_s"`
+	// RevokeEditedMessages recalls the original WeChat message when a Matrix
+	// edit is sent as a new "(edited)" message within the revoke window.
+	RevokeEditedMessages bool `yaml:"revoke_edited_messages"`
+
+	// RelayPrefix is prepended to text sent to WeChat for Matrix users other
+	// than the room's bridge user; "{{.}}" is replaced by the sender's
+	// localpart. Empty disables relay prefixes. KnownPrefixes are regular
+	// expressions for prefixes added by other bridges: text already starting
+	// with one of those, or with RelayPrefix, is not prefixed again.
+	RelayPrefix   string   `yaml:"relay_prefix"`
+	KnownPrefixes []string `yaml:"known_prefixes"`
+
+	// SendRetries is how often a failed send to Matrix or WeChat is retried,
+	// default 2; -1 disables retries. SendRetryBackoffMs is the delay before
+	// the first retry, doubled for each further one, default 500.
+	SendRetries        int `yaml:"send_retries"`
+	SendRetryBackoffMs int `yaml:"send_retry_backoff_ms"`
+
+	// ContactSyncPageSize is how many contacts the contact sync fetches and
+	// processes at a time, default 100. ContactSyncLimit caps the number of
+	// contacts synced, default 5000; -1 disables the cap.
+	ContactSyncPageSize int `yaml:"contact_sync_page_size"`
+	ContactSyncLimit    int `yaml:"contact_sync_limit"`
+
+	// GroupRemovalAction selects what happens to a group's room when the
+	// account is removed from the WeChat group: "leave" (default) posts a
+	// notice, removes the bridge from the room and unlinks it, "notice" only
+	// posts the notice.
+	GroupRemovalAction string `yaml:"group_removal_action"`
+
+	// DuplicateRoomNames selects the suffix added to a new group room's
+	// name when another of the user's rooms already has that name: "hash"
+	// (default) appends a short hash of the chat ID, "member_count" the
+	// group's member count, "none" leaves the name unchanged.
+	DuplicateRoomNames string `yaml:"duplicate_room_names"`
+
+	// PaymentRequests selects what happens to WeChat payment requests (收款),
+	// such as group collections: "notice" (default) posts who requested how
+	// much and what for, "ignore" drops them.
+	PaymentRequests string `yaml:"payment_requests"`
+
+	// EmojiReactions selects what happens to emoji reactions (表情回应) to
+	// bridged messages: "reaction" (default) bridges them as Matrix
+	// reactions, removed again when withdrawn, "notice" posts a notice
+	// replying to the message, "ignore" drops them.
+	EmojiReactions string `yaml:"emoji_reactions"`
+
+	// SilentContactAdds selects what happens when someone is added as a
+	// contact without a friend request, e.g. after scanning the account's
+	// QR code: "room" (default) creates the direct chat room and announces
+	// it in the management room, "notice" only announces the contact,
+	// "ignore" waits for the first message as usual.
+	SilentContactAdds string `yaml:"silent_contact_adds"`
+
+	// RecreatedGroups selects what happens to the room of a group WeChat
+	// re-created under a new ID: "tombstone" (default) points the old room
+	// to the new group's room with an m.room.tombstone, "ignore" leaves the
+	// old room as it is.
+	RecreatedGroups string `yaml:"recreated_groups"`
+
+	// ClockSkewCorrection corrects message timestamps from a provider whose
+	// clock is off. When the last ClockSkewWindow live messages (default 20)
+	// all arrived within ClockSkewThresholdS seconds (default 30) of the same
+	// offset, and that offset is larger than the threshold, it is applied to
+	// message timestamps, including backfilled ones. Off by default.
+	ClockSkewCorrection bool `yaml:"clock_skew_correction"`
+	ClockSkewWindow     int  `yaml:"clock_skew_window"`
+	ClockSkewThresholdS int  `yaml:"clock_skew_threshold_s"`
+
+	// DedupCapacity is how many recent WeChat message IDs are remembered to
+	// drop duplicate deliveries (default 4096). IDs seen in the last
+	// DedupTTLS seconds (default 600) are kept even beyond the capacity;
+	// -1 disables the TTL so that only the capacity applies.
+	DedupCapacity int `yaml:"dedup_capacity"`
+	DedupTTLS     int `yaml:"dedup_ttl_s"`
+
+	// LargeGroupThreshold is the member count above which a group's members
+	// are only stored, not joined to its Matrix room one by one (default
+	// 500, -1 disables).
+	LargeGroupThreshold int `yaml:"large_group_threshold"`
+
+	// NotesRoomName names the room for WeChat's File Transfer (filehelper)
+	// chat, the account's notes to itself, default "WeChat Notes". Every
+	// message in it is bridged as the user's own. "none" treats filehelper
+	// like any other contact.
+	NotesRoomName string `yaml:"notes_room_name"`
 }
 
 // EncryptionConfig controls end-to-end encryption settings.
@@ -85,14 +224,90 @@ type RateLimitConfig struct {
 	MessagesPerMinute int `yaml:"messages_per_minute"`
 	MediaPerMinute    int `yaml:"media_per_minute"`
 	APICallsPerMinute int `yaml:"api_calls_per_minute"`
+
+	// MessagesPerMinute (default 30) and ChatMessagesPerMinute (default 10)
+	// limit messages sent to WeChat in total and to any one chat; messages
+	// over the limit are queued in order. -1 disables either limit.
+	ChatMessagesPerMinute int `yaml:"chat_messages_per_minute"`
+}
+
+// CommandsConfig controls management commands sent to the bridge bot.
+type CommandsConfig struct {
+	Prefix string `yaml:"prefix"`
+	// Cooldowns is the per-user minimum interval in seconds between two runs
+	// of the same command, keyed by command name. 0 disables the limit.
+	Cooldowns map[string]int `yaml:"cooldowns"`
+}
+
+// DoublePuppetConfig controls double puppeting: WeChat messages the bridge
+// user sent from their phone are sent from their real Matrix account instead
+// of a puppet.
+type DoublePuppetConfig struct {
+	// LoginSharedSecret is the homeserver's shared-secret auth secret, used to
+	// log in as bridge users and obtain access tokens. When empty, only tokens
+	// already in the double_puppet table are used.
+	LoginSharedSecret string `yaml:"login_shared_secret"`
+}
+
+// MomentsConfig controls posting the Moments (朋友圈) feed to a Matrix room.
+// Only providers that can read Moments, currently padpro, support it.
+type MomentsConfig struct {
+	// Enabled polls each bridge user's Moments feed every PollIntervalS
+	// seconds (default 600) and posts new entries, as their authors, to a
+	// room named RoomName (default "WeChat Moments").
+	Enabled       bool   `yaml:"enabled"`
+	PollIntervalS int    `yaml:"poll_interval_s"`
+	RoomName      string `yaml:"room_name"`
+}
+
+// BackfillConfig controls bridging a chat's history into its new room.
+type BackfillConfig struct {
+	// MaxMessages is how many of a chat's most recent messages are bridged
+	// into its Matrix room when the room is created, default 20; 0 disables
+	// backfill. Only providers that can fetch history, currently padpro,
+	// support it.
+	MaxMessages *int `yaml:"max_messages"`
+}
+
+// FiltersConfig decides which WeChat chats are bridged. Entries are exact
+// IDs ("wxid_abc"), ID prefixes ("gh_*") or chat types ("type:group",
+// "type:direct"). The filter command adds more at runtime.
+type FiltersConfig struct {
+	// Allow, when not empty, bridges only chats matching one of its entries.
+	Allow []string `yaml:"allow"`
+	// Deny never bridges chats matching one of its entries. Unset, it skips
+	// WeChat's own service accounts: weixin, official accounts (gh_*) and,
+	// when the notes room is disabled, filehelper.
+	Deny []string `yaml:"deny"`
 }
 
 // MediaConfig controls media processing settings.
 type MediaConfig struct {
-	MaxFileSize    int64  `yaml:"max_file_size"`
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// VoiceConverter is "silk2ogg" (default) to transcode voice between
+	// WeChat's silk/AMR and ogg/opus with ffmpeg, or "none" to bridge voice
+	// as received.
 	VoiceConverter string `yaml:"voice_converter"`
-	ImageQuality   int    `yaml:"image_quality"`
-	VideoThumbnail bool   `yaml:"video_thumbnail"`
+	// ImageQuality is the JPEG quality images are re-encoded at when bridged,
+	// default 90; -1 disables re-encoding.
+	ImageQuality   int  `yaml:"image_quality"`
+	VideoThumbnail bool `yaml:"video_thumbnail"`
+
+	// AvatarCheckIntervalS is how often puppet avatars are checked against the
+	// homeserver and re-uploaded if their media was purged. Default 86400.
+	AvatarCheckIntervalS int `yaml:"avatar_check_interval_s"`
+	// AvatarSquareSize crops puppet avatars to a centered square and scales
+	// them down to at most this many pixels per side, default 640; -1
+	// uploads avatars unchanged.
+	AvatarSquareSize int `yaml:"avatar_square_size"`
+
+	// MaxImageDimension scales bridged JPEG and PNG images down so neither
+	// side is larger, default 4096; -1 disables scaling.
+	MaxImageDimension int `yaml:"max_image_dimension"`
+
+	// MaxConcurrentUploads caps how many media uploads to the homeserver
+	// run at once; more wait their turn. Default 4; -1 disables the limit.
+	MaxConcurrentUploads int `yaml:"max_concurrent_uploads"`
 }
 
 // ProvidersConfig holds configuration for all provider types.
@@ -111,6 +326,12 @@ type FailoverConfig struct {
 	FailureThreshold       int  `yaml:"failure_threshold"`
 	RecoveryCheckIntervalS int  `yaml:"recovery_check_interval_s"`
 	RecoveryThreshold      int  `yaml:"recovery_threshold"`
+
+	// SendTimeoutS is how many seconds a send to WeChat may take. A send
+	// that times out fails the active provider's next health check, so
+	// providers that stay logged in but stop delivering are failed over
+	// too. Default 30; -1 disables.
+	SendTimeoutS int `yaml:"send_timeout_s"`
 }
 
 // WeComProviderConfig holds WeCom (enterprise WeChat) settings.
@@ -120,6 +341,10 @@ type WeComProviderConfig struct {
 	AppSecret string              `yaml:"app_secret"`
 	AgentID   int                 `yaml:"agent_id"`
 	Callback  WeComCallbackConfig `yaml:"callback"`
+
+	// Capabilities overrides the provider's default capabilities; see
+	// PadProProviderConfig.Capabilities.
+	Capabilities map[string]bool `yaml:"capabilities"`
 }
 
 // WeComCallbackConfig holds WeCom callback verification settings.
@@ -138,13 +363,28 @@ type WeComCallbackConfig struct {
 //	Dependencies: MySQL 8.0 + Redis 6
 type PadProProviderConfig struct {
 	Enabled      bool              `yaml:"enabled"`
-	APIEndpoint  string            `yaml:"api_endpoint"`  // e.g. http://wechatpadpro:1239
-	AuthKey      string            `yaml:"auth_key"`      // API auth key (used as ?key= parameter)
-	WSEndpoint   string            `yaml:"ws_endpoint"`   // optional, derived from api_endpoint if empty
-	WebhookURL   string            `yaml:"webhook_url"`   // optional webhook callback URL
-	CallbackPort int               `yaml:"callback_port"` // local port for webhook callback server
+	APIEndpoint  string            `yaml:"api_endpoint"`   // e.g. http://wechatpadpro:1239
+	AuthKey      string            `yaml:"auth_key"`       // API auth key (used as ?key= parameter)
+	WSEndpoint   string            `yaml:"ws_endpoint"`    // optional, derived from api_endpoint if empty
+	WebhookURL   string            `yaml:"webhook_url"`    // optional webhook callback URL
+	CallbackPort int               `yaml:"callback_port"`  // local port for webhook callback server
+	HTTPTimeoutS int               `yaml:"http_timeout_s"` // REST API and media download timeout, default 30
 	RiskControl  RiskControlConfig `yaml:"risk_control"`
 
+	// ContactFetchConcurrency bounds how many contact detail batches are
+	// fetched in parallel when syncing the address book, default 3.
+	ContactFetchConcurrency int `yaml:"contact_fetch_concurrency"`
+
+	// ReorderWindowMs is how long messages pushed over the WebSocket or
+	// webhook are held so they can be delivered in timestamp order, default
+	// 300; -1 disables reordering.
+	ReorderWindowMs int `yaml:"reorder_window_ms"`
+
+	// Capabilities overrides the provider's default capabilities by
+	// snake_case name, e.g. "reaction: true" for a backend that supports
+	// reactions although the provider doesn't claim it.
+	Capabilities map[string]bool `yaml:"capabilities"`
+
 	// Multi-tenant settings: each n42chat user logs in with their own WeChat account,
 	// distributed across multiple PadPro server nodes to reduce ban risk.
 	MultiTenant     bool               `yaml:"multi_tenant"`
@@ -170,7 +410,12 @@ type IPadProviderConfig struct {
 	APIToken     string            `yaml:"api_token"`
 	CallbackURL  string            `yaml:"callback_url"`
 	CallbackPort int               `yaml:"callback_port"`
+	HTTPTimeoutS int               `yaml:"http_timeout_s"`
 	RiskControl  RiskControlConfig `yaml:"risk_control"`
+
+	// Capabilities overrides the provider's default capabilities; see
+	// PadProProviderConfig.Capabilities.
+	Capabilities map[string]bool `yaml:"capabilities"`
 }
 
 // RiskControlConfig holds anti-ban risk control settings for the iPad protocol.
@@ -188,6 +433,11 @@ type PCHookProviderConfig struct {
 	Enabled       bool   `yaml:"enabled"`
 	RPCEndpoint   string `yaml:"rpc_endpoint"`
 	WeChatVersion string `yaml:"wechat_version"`
+	TempMaxAgeS   int    `yaml:"temp_max_age_s"` // age after which temp media files are deleted, default 3600
+
+	// Capabilities overrides the provider's default capabilities; see
+	// PadProProviderConfig.Capabilities.
+	Capabilities map[string]bool `yaml:"capabilities"`
 }
 
 // LoggingConfig controls logging output.
@@ -210,6 +460,11 @@ type LoggerWriter struct {
 type MetricsConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Listen  string `yaml:"listen"`
+	// AdminToken guards the /status endpoint. Falls back to the hs_token when empty.
+	AdminToken string `yaml:"admin_token"`
+	// ReadinessRequiresLogin makes /readyz report not ready until the
+	// WeChat account is logged in.
+	ReadinessRequiresLogin bool `yaml:"readiness_requires_login"`
 }
 
 // Load reads and parses a YAML configuration file.
@@ -269,17 +524,49 @@ func (c *Config) Validate() error {
 	if c.Database.MaxIdleConns == 0 {
 		c.Database.MaxIdleConns = 5
 	}
+	if c.Database.ConnectAttempts == 0 {
+		c.Database.ConnectAttempts = 5
+	}
+	if c.Database.ConnectTimeoutS == 0 {
+		c.Database.ConnectTimeoutS = 10
+	}
+	if c.Database.HealthCheckIntervalS == 0 {
+		c.Database.HealthCheckIntervalS = 30
+	}
 
 	// Bridge defaults
 	if c.Bridge.UsernameTemplate == "" {
 		c.Bridge.UsernameTemplate = "wechat_{{.}}"
 	}
 	if c.Bridge.DisplaynameTemplate == "" {
-		c.Bridge.DisplaynameTemplate = "{{.Nickname}} (WeChat)"
+		c.Bridge.DisplaynameTemplate = "{{.Remark}} (WeChat)"
+	}
+	// {{.Nickname}} used to be replaced by the remark when there was one;
+	// the old default keeps naming contacts that way.
+	if c.Bridge.DisplaynameTemplate == legacyDisplaynameTemplate {
+		c.Bridge.DisplaynameTemplate = "{{.Remark}} (WeChat)"
+	}
+	if c.Bridge.OfficialAccountDisplaynameTemplate == "" {
+		c.Bridge.OfficialAccountDisplaynameTemplate = "{{.Nickname}} (Official Account)"
+	}
+	if _, err := template.New("").Parse(c.Bridge.DisplaynameTemplate); err != nil {
+		return fmt.Errorf("bridge.displayname_template: %w", err)
+	}
+	if _, err := template.New("").Parse(c.Bridge.OfficialAccountDisplaynameTemplate); err != nil {
+		return fmt.Errorf("bridge.official_account_displayname_template: %w", err)
+	}
+	if _, err := template.New("").Parse(c.Bridge.OutgoingPrefix); err != nil {
+		return fmt.Errorf("bridge.outgoing_prefix: %w", err)
+	}
+	if _, err := template.New("").Parse(c.Bridge.OutgoingSuffix); err != nil {
+		return fmt.Errorf("bridge.outgoing_suffix: %w", err)
 	}
 	if c.Bridge.RateLimit.MessagesPerMinute == 0 {
 		c.Bridge.RateLimit.MessagesPerMinute = 30
 	}
+	if c.Bridge.RateLimit.ChatMessagesPerMinute == 0 {
+		c.Bridge.RateLimit.ChatMessagesPerMinute = 10
+	}
 	if c.Bridge.RateLimit.MediaPerMinute == 0 {
 		c.Bridge.RateLimit.MediaPerMinute = 10
 	}
@@ -289,15 +576,180 @@ func (c *Config) Validate() error {
 	if c.Bridge.Media.MaxFileSize == 0 {
 		c.Bridge.Media.MaxFileSize = 100 * 1024 * 1024 // 100MB
 	}
+	switch c.Bridge.Media.VoiceConverter {
+	case "":
+		c.Bridge.Media.VoiceConverter = "silk2ogg"
+	case "silk2ogg", "none":
+	default:
+		return fmt.Errorf("bridge.media.voice_converter must be \"silk2ogg\" or \"none\"")
+	}
 	if c.Bridge.Media.ImageQuality == 0 {
 		c.Bridge.Media.ImageQuality = 90
 	}
+	if c.Bridge.Media.ImageQuality > 100 {
+		return fmt.Errorf("bridge.media.image_quality must be at most 100")
+	}
+	if c.Bridge.Media.MaxImageDimension == 0 {
+		c.Bridge.Media.MaxImageDimension = 4096
+	}
+	if c.Bridge.Media.AvatarCheckIntervalS == 0 {
+		c.Bridge.Media.AvatarCheckIntervalS = 86400
+	}
+	if c.Bridge.Media.AvatarSquareSize == 0 {
+		c.Bridge.Media.AvatarSquareSize = 640
+	}
+	if c.Bridge.Media.MaxConcurrentUploads == 0 {
+		c.Bridge.Media.MaxConcurrentUploads = 4
+	}
 	if c.Bridge.MessageHandling.MaxMessageAge == 0 {
 		c.Bridge.MessageHandling.MaxMessageAge = 300
 	}
+	if c.Bridge.Commands.Prefix == "" {
+		c.Bridge.Commands.Prefix = "!wechat"
+	}
+	if c.Bridge.Commands.Cooldowns == nil {
+		c.Bridge.Commands.Cooldowns = make(map[string]int)
+	}
+	if _, ok := c.Bridge.Commands.Cooldowns["sync"]; !ok {
+		c.Bridge.Commands.Cooldowns["sync"] = 60
+	}
+	if _, ok := c.Bridge.Commands.Cooldowns["resync-avatars"]; !ok {
+		c.Bridge.Commands.Cooldowns["resync-avatars"] = 300
+	}
+	if c.Bridge.MessageHandling.MaxTextLength == 0 {
+		c.Bridge.MessageHandling.MaxTextLength = 2000
+	}
+	if c.Bridge.MessageHandling.RevokeWindowS == 0 {
+		c.Bridge.MessageHandling.RevokeWindowS = 120
+	}
+	if c.Bridge.MessageHandling.SendRetries == 0 {
+		c.Bridge.MessageHandling.SendRetries = 2
+	}
+	if c.Bridge.MessageHandling.SendRetryBackoffMs == 0 {
+		c.Bridge.MessageHandling.SendRetryBackoffMs = 500
+	}
+	if c.Bridge.MessageHandling.ContactSyncPageSize == 0 {
+		c.Bridge.MessageHandling.ContactSyncPageSize = 100
+	}
+	if c.Bridge.MessageHandling.ContactSyncLimit == 0 {
+		c.Bridge.MessageHandling.ContactSyncLimit = 5000
+	}
+	switch c.Bridge.MessageHandling.LongTextMode {
+	case "":
+		c.Bridge.MessageHandling.LongTextMode = "split"
+	case "split", "reject":
+	default:
+		return fmt.Errorf("bridge.message_handling.long_text_mode must be \"split\" or \"reject\"")
+	}
+	switch c.Bridge.MessageHandling.GroupRemovalAction {
+	case "":
+		c.Bridge.MessageHandling.GroupRemovalAction = "leave"
+	case "leave", "notice":
+	default:
+		return fmt.Errorf("bridge.message_handling.group_removal_action must be \"leave\" or \"notice\"")
+	}
+	if c.Bridge.MessageHandling.ClockSkewWindow == 0 {
+		c.Bridge.MessageHandling.ClockSkewWindow = 20
+	}
+	if c.Bridge.MessageHandling.ClockSkewThresholdS == 0 {
+		c.Bridge.MessageHandling.ClockSkewThresholdS = 30
+	}
+	if c.Bridge.MessageHandling.DedupCapacity == 0 {
+		c.Bridge.MessageHandling.DedupCapacity = 4096
+	}
+	if c.Bridge.MessageHandling.DedupTTLS == 0 {
+		c.Bridge.MessageHandling.DedupTTLS = 600
+	}
+	if c.Bridge.MessageHandling.LargeGroupThreshold == 0 {
+		c.Bridge.MessageHandling.LargeGroupThreshold = 500
+	}
+	if c.Bridge.MessageHandling.NotesRoomName == "" {
+		c.Bridge.MessageHandling.NotesRoomName = "WeChat Notes"
+	}
+	if c.Bridge.Filters.Deny == nil {
+		c.Bridge.Filters.Deny = []string{"weixin", "gh_*"}
+		if c.Bridge.MessageHandling.NotesRoomName == "none" {
+			c.Bridge.Filters.Deny = append(c.Bridge.Filters.Deny, "filehelper")
+		}
+	}
+	for i, entry := range c.Bridge.Filters.Allow {
+		if _, err := wechat.ParseChatFilter(entry); err != nil {
+			return fmt.Errorf("bridge.filters.allow[%d]: %w", i, err)
+		}
+	}
+	for i, entry := range c.Bridge.Filters.Deny {
+		if _, err := wechat.ParseChatFilter(entry); err != nil {
+			return fmt.Errorf("bridge.filters.deny[%d]: %w", i, err)
+		}
+	}
+	if c.Bridge.Moments.PollIntervalS == 0 {
+		c.Bridge.Moments.PollIntervalS = 600
+	}
+	if c.Bridge.Moments.PollIntervalS < 0 {
+		return fmt.Errorf("bridge.moments.poll_interval_s must be positive")
+	}
+	if c.Bridge.Moments.RoomName == "" {
+		c.Bridge.Moments.RoomName = "WeChat Moments"
+	}
+	if c.Bridge.Backfill.MaxMessages == nil {
+		maxMessages := 20
+		c.Bridge.Backfill.MaxMessages = &maxMessages
+	}
+	if *c.Bridge.Backfill.MaxMessages < 0 {
+		return fmt.Errorf("bridge.backfill.max_messages must not be negative")
+	}
+	switch c.Bridge.MessageHandling.DuplicateRoomNames {
+	case "":
+		c.Bridge.MessageHandling.DuplicateRoomNames = "hash"
+	case "hash", "member_count", "none":
+	default:
+		return fmt.Errorf("bridge.message_handling.duplicate_room_names must be \"hash\", \"member_count\" or \"none\"")
+	}
+	switch c.Bridge.MessageHandling.PaymentRequests {
+	case "":
+		c.Bridge.MessageHandling.PaymentRequests = "notice"
+	case "notice", "ignore":
+	default:
+		return fmt.Errorf("bridge.message_handling.payment_requests must be \"notice\" or \"ignore\"")
+	}
+	switch c.Bridge.MessageHandling.EmojiReactions {
+	case "":
+		c.Bridge.MessageHandling.EmojiReactions = "reaction"
+	case "reaction", "notice", "ignore":
+	default:
+		return fmt.Errorf("bridge.message_handling.emoji_reactions must be \"reaction\", \"notice\" or \"ignore\"")
+	}
+	switch c.Bridge.MessageHandling.SilentContactAdds {
+	case "":
+		c.Bridge.MessageHandling.SilentContactAdds = "room"
+	case "room", "notice", "ignore":
+	default:
+		return fmt.Errorf("bridge.message_handling.silent_contact_adds must be \"room\", \"notice\" or \"ignore\"")
+	}
+	switch c.Bridge.MessageHandling.RecreatedGroups {
+	case "":
+		c.Bridge.MessageHandling.RecreatedGroups = "tombstone"
+	case "tombstone", "ignore":
+	default:
+		return fmt.Errorf("bridge.message_handling.recreated_groups must be \"tombstone\" or \"ignore\"")
+	}
+	for i, pattern := range c.Bridge.MessageHandling.KnownPrefixes {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("bridge.message_handling.known_prefixes[%d]: %w", i, err)
+		}
+	}
 
 	// PadPro risk control defaults
 	if c.Providers.PadPro.Enabled {
+		if c.Providers.PadPro.HTTPTimeoutS == 0 {
+			c.Providers.PadPro.HTTPTimeoutS = 30
+		}
+		if c.Providers.PadPro.ContactFetchConcurrency == 0 {
+			c.Providers.PadPro.ContactFetchConcurrency = 3
+		}
+		if c.Providers.PadPro.ReorderWindowMs == 0 {
+			c.Providers.PadPro.ReorderWindowMs = 300
+		}
 		rc := &c.Providers.PadPro.RiskControl
 		if rc.NewAccountSilenceDays == 0 {
 			rc.NewAccountSilenceDays = 3
@@ -318,6 +770,9 @@ func (c *Config) Validate() error {
 
 	// iPad risk control defaults (deprecated provider)
 	if c.Providers.IPad.Enabled {
+		if c.Providers.IPad.HTTPTimeoutS == 0 {
+			c.Providers.IPad.HTTPTimeoutS = 30
+		}
 		rc := &c.Providers.IPad.RiskControl
 		if rc.NewAccountSilenceDays == 0 {
 			rc.NewAccountSilenceDays = 3
@@ -336,6 +791,11 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// PC Hook temp media defaults
+	if c.Providers.PCHook.Enabled && c.Providers.PCHook.TempMaxAgeS == 0 {
+		c.Providers.PCHook.TempMaxAgeS = 3600
+	}
+
 	// Failover defaults
 	if c.Providers.Failover.Enabled {
 		fo := &c.Providers.Failover
@@ -351,6 +811,9 @@ func (c *Config) Validate() error {
 		if fo.RecoveryThreshold == 0 {
 			fo.RecoveryThreshold = 3
 		}
+		if fo.SendTimeoutS == 0 {
+			fo.SendTimeoutS = 30
+		}
 	}
 
 	// Logging defaults
@@ -429,6 +892,19 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for provider, overrides := range map[string]map[string]bool{
+		"wecom":  c.Providers.WeCom.Capabilities,
+		"padpro": c.Providers.PadPro.Capabilities,
+		"ipad":   c.Providers.IPad.Capabilities,
+		"pchook": c.Providers.PCHook.Capabilities,
+	} {
+		for name := range overrides {
+			if !wechat.IsCapabilityName(name) {
+				return fmt.Errorf("providers.%s.capabilities: unknown capability %q", provider, name)
+			}
+		}
+	}
+
 	return nil
 }
 
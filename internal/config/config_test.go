@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -38,6 +39,34 @@ func TestValidate_MinimalValid(t *testing.T) {
 	}
 }
 
+func TestValidate_InvalidDisplaynameTemplate(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.DisplaynameTemplate = "{{.Remark"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for unparsable displayname_template")
+	}
+}
+
+func TestValidate_MigratesLegacyDisplaynameTemplate(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.DisplaynameTemplate = "{{.Nickname}} (WeChat)"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if cfg.Bridge.DisplaynameTemplate != "{{.Remark}} (WeChat)" {
+		t.Errorf("legacy displayname template not migrated, got %s", cfg.Bridge.DisplaynameTemplate)
+	}
+
+	cfg = validMinimalConfig()
+	cfg.Bridge.DisplaynameTemplate = "{{.Nickname}} [WX]"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if cfg.Bridge.DisplaynameTemplate != "{{.Nickname}} [WX]" {
+		t.Errorf("custom displayname template changed to %s", cfg.Bridge.DisplaynameTemplate)
+	}
+}
+
 func TestValidate_Defaults(t *testing.T) {
 	cfg := validMinimalConfig()
 	if err := cfg.Validate(); err != nil {
@@ -70,9 +99,15 @@ func TestValidate_Defaults(t *testing.T) {
 	if cfg.Bridge.UsernameTemplate != "wechat_{{.}}" {
 		t.Errorf("expected default username template, got %s", cfg.Bridge.UsernameTemplate)
 	}
-	if cfg.Bridge.DisplaynameTemplate != "{{.Nickname}} (WeChat)" {
+	if cfg.Bridge.DisplaynameTemplate != "{{.Remark}} (WeChat)" {
 		t.Errorf("expected default displayname template, got %s", cfg.Bridge.DisplaynameTemplate)
 	}
+	if cfg.Bridge.OfficialAccountDisplaynameTemplate != "{{.Nickname}} (Official Account)" {
+		t.Errorf("expected default official account displayname template, got %s", cfg.Bridge.OfficialAccountDisplaynameTemplate)
+	}
+	if cfg.Bridge.PatAsReaction {
+		t.Error("expected pat_as_reaction to default to false")
+	}
 	if cfg.Bridge.RateLimit.MessagesPerMinute != 30 {
 		t.Errorf("expected default messages_per_minute 30, got %d", cfg.Bridge.RateLimit.MessagesPerMinute)
 	}
@@ -88,9 +123,102 @@ func TestValidate_Defaults(t *testing.T) {
 	if cfg.Bridge.Media.ImageQuality != 90 {
 		t.Errorf("expected default image_quality 90, got %d", cfg.Bridge.Media.ImageQuality)
 	}
+	if cfg.Bridge.Media.MaxImageDimension != 4096 {
+		t.Errorf("expected default max_image_dimension 4096, got %d", cfg.Bridge.Media.MaxImageDimension)
+	}
+	if cfg.Bridge.Media.AvatarCheckIntervalS != 86400 {
+		t.Errorf("expected default avatar_check_interval_s 86400, got %d", cfg.Bridge.Media.AvatarCheckIntervalS)
+	}
+	if cfg.Bridge.Media.AvatarSquareSize != 640 {
+		t.Errorf("expected default avatar_square_size 640, got %d", cfg.Bridge.Media.AvatarSquareSize)
+	}
+	if cfg.Bridge.Media.MaxConcurrentUploads != 4 {
+		t.Errorf("expected default max_concurrent_uploads 4, got %d", cfg.Bridge.Media.MaxConcurrentUploads)
+	}
+	if cfg.Database.ConnectAttempts != 5 || cfg.Database.ConnectTimeoutS != 10 {
+		t.Errorf("expected default connect_attempts 5 and connect_timeout_s 10, got %d and %d",
+			cfg.Database.ConnectAttempts, cfg.Database.ConnectTimeoutS)
+	}
+	if cfg.Database.HealthCheckIntervalS != 30 {
+		t.Errorf("expected default health_check_interval_s 30, got %d", cfg.Database.HealthCheckIntervalS)
+	}
 	if cfg.Bridge.MessageHandling.MaxMessageAge != 300 {
 		t.Errorf("expected default max_message_age 300, got %d", cfg.Bridge.MessageHandling.MaxMessageAge)
 	}
+	if cfg.Bridge.MessageHandling.ContactSyncPageSize != 100 {
+		t.Errorf("expected default contact_sync_page_size 100, got %d", cfg.Bridge.MessageHandling.ContactSyncPageSize)
+	}
+	if cfg.Bridge.MessageHandling.ContactSyncLimit != 5000 {
+		t.Errorf("expected default contact_sync_limit 5000, got %d", cfg.Bridge.MessageHandling.ContactSyncLimit)
+	}
+	if cfg.Bridge.MessageHandling.MaxTextLength != 2000 {
+		t.Errorf("expected default max_text_length 2000, got %d", cfg.Bridge.MessageHandling.MaxTextLength)
+	}
+	if cfg.Bridge.MessageHandling.RevokeWindowS != 120 {
+		t.Errorf("expected default revoke_window_s 120, got %d", cfg.Bridge.MessageHandling.RevokeWindowS)
+	}
+	if cfg.Bridge.MessageHandling.LongTextMode != "split" {
+		t.Errorf("expected default long_text_mode 'split', got %s", cfg.Bridge.MessageHandling.LongTextMode)
+	}
+	if cfg.Bridge.Media.VoiceConverter != "silk2ogg" {
+		t.Errorf("expected default voice_converter 'silk2ogg', got %s", cfg.Bridge.Media.VoiceConverter)
+	}
+	if cfg.Bridge.MessageHandling.GroupRemovalAction != "leave" {
+		t.Errorf("expected default group_removal_action 'leave', got %s", cfg.Bridge.MessageHandling.GroupRemovalAction)
+	}
+	if cfg.Bridge.MessageHandling.ClockSkewCorrection {
+		t.Error("expected clock_skew_correction to be off by default")
+	}
+	if cfg.Bridge.MessageHandling.ClockSkewWindow != 20 || cfg.Bridge.MessageHandling.ClockSkewThresholdS != 30 {
+		t.Errorf("expected default clock skew window 20 and threshold 30s, got %d and %d",
+			cfg.Bridge.MessageHandling.ClockSkewWindow, cfg.Bridge.MessageHandling.ClockSkewThresholdS)
+	}
+	if cfg.Bridge.MessageHandling.DedupCapacity != 4096 || cfg.Bridge.MessageHandling.DedupTTLS != 600 {
+		t.Errorf("expected default dedup capacity 4096 and TTL 600s, got %d and %d",
+			cfg.Bridge.MessageHandling.DedupCapacity, cfg.Bridge.MessageHandling.DedupTTLS)
+	}
+	if cfg.Bridge.RateLimit.ChatMessagesPerMinute != 10 {
+		t.Errorf("expected default chat_messages_per_minute 10, got %d", cfg.Bridge.RateLimit.ChatMessagesPerMinute)
+	}
+	if cfg.Bridge.MessageHandling.LargeGroupThreshold != 500 {
+		t.Errorf("expected default large_group_threshold 500, got %d", cfg.Bridge.MessageHandling.LargeGroupThreshold)
+	}
+	if cfg.Bridge.MessageHandling.NotesRoomName != "WeChat Notes" {
+		t.Errorf("expected default notes_room_name 'WeChat Notes', got %s", cfg.Bridge.MessageHandling.NotesRoomName)
+	}
+	if cfg.Bridge.Moments.Enabled || cfg.Bridge.Moments.PollIntervalS != 600 || cfg.Bridge.Moments.RoomName != "WeChat Moments" {
+		t.Errorf("unexpected moments defaults: %+v", cfg.Bridge.Moments)
+	}
+	if cfg.Bridge.Backfill.MaxMessages == nil || *cfg.Bridge.Backfill.MaxMessages != 20 {
+		t.Errorf("expected default backfill max_messages 20, got %v", cfg.Bridge.Backfill.MaxMessages)
+	}
+	if !reflect.DeepEqual(cfg.Bridge.Filters.Deny, []string{"weixin", "gh_*"}) || len(cfg.Bridge.Filters.Allow) != 0 {
+		t.Errorf("unexpected filters defaults: %+v", cfg.Bridge.Filters)
+	}
+	if cfg.Bridge.MessageHandling.DuplicateRoomNames != "hash" {
+		t.Errorf("expected default duplicate_room_names 'hash', got %s", cfg.Bridge.MessageHandling.DuplicateRoomNames)
+	}
+	if cfg.Bridge.MessageHandling.PaymentRequests != "notice" {
+		t.Errorf("expected default payment_requests 'notice', got %s", cfg.Bridge.MessageHandling.PaymentRequests)
+	}
+	if cfg.Bridge.MessageHandling.EmojiReactions != "reaction" {
+		t.Errorf("expected default emoji_reactions 'reaction', got %s", cfg.Bridge.MessageHandling.EmojiReactions)
+	}
+	if cfg.Bridge.MessageHandling.SilentContactAdds != "room" {
+		t.Errorf("expected default silent_contact_adds 'room', got %s", cfg.Bridge.MessageHandling.SilentContactAdds)
+	}
+	if cfg.Bridge.MessageHandling.RecreatedGroups != "tombstone" {
+		t.Errorf("expected default recreated_groups 'tombstone', got %s", cfg.Bridge.MessageHandling.RecreatedGroups)
+	}
+	if cfg.Bridge.Commands.Prefix != "!wechat" {
+		t.Errorf("expected default command prefix '!wechat', got %s", cfg.Bridge.Commands.Prefix)
+	}
+	if cfg.Bridge.Commands.Cooldowns["sync"] != 60 {
+		t.Errorf("expected default sync cooldown 60, got %d", cfg.Bridge.Commands.Cooldowns["sync"])
+	}
+	if cfg.Bridge.Commands.Cooldowns["resync-avatars"] != 300 {
+		t.Errorf("expected default resync-avatars cooldown 300, got %d", cfg.Bridge.Commands.Cooldowns["resync-avatars"])
+	}
 
 	// Logging defaults
 	if cfg.Logging.MinLevel != "info" {
@@ -136,6 +264,149 @@ func TestValidate_CustomValuesNotOverwritten(t *testing.T) {
 	}
 }
 
+func TestValidate_InvalidLongTextMode(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.LongTextMode = "truncate"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid long_text_mode")
+	}
+}
+
+func TestValidate_InvalidVoiceConverter(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.Media.VoiceConverter = "mp3"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid voice_converter")
+	}
+}
+
+func TestValidate_InvalidGroupRemovalAction(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.GroupRemovalAction = "archive"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid group_removal_action")
+	}
+}
+
+func TestValidate_InvalidDuplicateRoomNames(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.DuplicateRoomNames = "random"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid duplicate_room_names")
+	}
+}
+
+func TestValidate_InvalidPaymentRequests(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.PaymentRequests = "bounce"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid payment_requests")
+	}
+}
+
+func TestValidate_InvalidEmojiReactions(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.EmojiReactions = "emoji"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid emoji_reactions")
+	}
+}
+
+func TestValidate_InvalidSilentContactAdds(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.SilentContactAdds = "dm"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid silent_contact_adds")
+	}
+}
+
+func TestValidate_InvalidRecreatedGroups(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.RecreatedGroups = "merge"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid recreated_groups")
+	}
+}
+
+func TestValidate_NegativeBackfillMaxMessages(t *testing.T) {
+	cfg := validMinimalConfig()
+	maxMessages := -1
+	cfg.Bridge.Backfill.MaxMessages = &maxMessages
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for negative backfill max_messages")
+	}
+}
+
+func TestValidate_InvalidOutgoingPrefix(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.OutgoingPrefix = "{{.Sender"
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid outgoing_prefix template")
+	}
+}
+
+func TestValidate_InvalidImageQuality(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.Media.ImageQuality = 101
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for image_quality above 100")
+	}
+}
+
+func TestValidate_InvalidKnownPrefix(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.KnownPrefixes = []string{"[unclosed"}
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid known_prefixes pattern")
+	}
+}
+
+func TestValidate_FiltersDenyFileHelperWithoutNotesRoom(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.MessageHandling.NotesRoomName = "none"
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Bridge.Filters.Deny, []string{"weixin", "gh_*", "filehelper"}) {
+		t.Fatalf("deny = %v, want filehelper skipped too", cfg.Bridge.Filters.Deny)
+	}
+}
+
+func TestValidate_InvalidFilterEntry(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Bridge.Filters.Allow = []string{"type:channel"}
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid filters.allow entry")
+	}
+}
+
+func TestValidate_UnknownCapability(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Providers.WeCom.Capabilities = map[string]bool{"reaction": true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate known capability override: %v", err)
+	}
+
+	cfg.Providers.WeCom.Capabilities = map[string]bool{"reactions": true}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for unknown capability override")
+	}
+}
+
 func TestValidate_MissingHomeserverAddress(t *testing.T) {
 	cfg := validMinimalConfig()
 	cfg.Homeserver.Address = ""
@@ -255,6 +526,29 @@ func TestValidate_IPadMissingAPIEndpoint(t *testing.T) {
 	}
 }
 
+func TestValidate_PadProDefaults(t *testing.T) {
+	cfg := validMinimalConfig()
+	cfg.Providers.PadPro = PadProProviderConfig{
+		Enabled:     true,
+		APIEndpoint: "http://localhost:1239",
+		AuthKey:     "key",
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	if cfg.Providers.PadPro.HTTPTimeoutS != 30 {
+		t.Errorf("expected default http_timeout_s 30, got %d", cfg.Providers.PadPro.HTTPTimeoutS)
+	}
+	if cfg.Providers.PadPro.ContactFetchConcurrency != 3 {
+		t.Errorf("expected default contact_fetch_concurrency 3, got %d", cfg.Providers.PadPro.ContactFetchConcurrency)
+	}
+	if cfg.Providers.PadPro.ReorderWindowMs != 300 {
+		t.Errorf("expected default reorder_window_ms 300, got %d", cfg.Providers.PadPro.ReorderWindowMs)
+	}
+}
+
 func TestValidate_IPadRiskControlDefaults(t *testing.T) {
 	cfg := validMinimalConfig()
 	cfg.Providers.IPad = IPadProviderConfig{
@@ -266,6 +560,10 @@ func TestValidate_IPadRiskControlDefaults(t *testing.T) {
 		t.Fatalf("validate: %v", err)
 	}
 
+	if cfg.Providers.IPad.HTTPTimeoutS != 30 {
+		t.Errorf("expected default http_timeout_s 30, got %d", cfg.Providers.IPad.HTTPTimeoutS)
+	}
+
 	rc := cfg.Providers.IPad.RiskControl
 	if rc.NewAccountSilenceDays != 3 {
 		t.Errorf("expected default new_account_silence_days 3, got %d", rc.NewAccountSilenceDays)
@@ -307,6 +605,9 @@ func TestValidate_FailoverDefaults(t *testing.T) {
 	if fo.RecoveryThreshold != 3 {
 		t.Errorf("expected default recovery_threshold 3, got %d", fo.RecoveryThreshold)
 	}
+	if fo.SendTimeoutS != 30 {
+		t.Errorf("expected default send_timeout_s 30, got %d", fo.SendTimeoutS)
+	}
 }
 
 func TestValidate_MultipleProvidersEnabled(t *testing.T) {
@@ -347,6 +648,9 @@ func TestValidate_OnlyPCHookEnabled(t *testing.T) {
 	if err := cfg.Validate(); err != nil {
 		t.Fatalf("validate pchook-only config: %v", err)
 	}
+	if cfg.Providers.PCHook.TempMaxAgeS != 3600 {
+		t.Errorf("expected default temp_max_age_s 3600, got %d", cfg.Providers.PCHook.TempMaxAgeS)
+	}
 }
 
 func TestGenerateRegistration(t *testing.T) {
@@ -474,6 +778,38 @@ providers:
 	}
 }
 
+func TestLoad_BackfillDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+homeserver:
+  address: https://m.example.com
+  domain: example.com
+appservice:
+  as_token: "test_as_token"
+  hs_token: "test_hs_token"
+database:
+  uri: "postgres://localhost/test"
+bridge:
+  backfill:
+    max_messages: 0
+providers:
+  wecom:
+    enabled: true
+    corp_id: "corp123"
+    app_secret: "secret456"
+`
+	os.WriteFile(path, []byte(content), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if *cfg.Bridge.Backfill.MaxMessages != 0 {
+		t.Errorf("explicit max_messages 0 should disable backfill, got %d", *cfg.Bridge.Backfill.MaxMessages)
+	}
+}
+
 func TestLoad_EnvVarExpansion(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "config.yaml")
@@ -18,7 +18,7 @@ func bridgeUserMockRows() *sqlmock.Rows {
 }
 
 func TestBridgeUserStore_UpsertAndGetByMatrixID(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -73,7 +73,7 @@ func TestBridgeUserStore_UpsertAndGetByMatrixID(t *testing.T) {
 }
 
 func TestBridgeUserStore_GetByWeChatIDAndGetAll(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -110,7 +110,7 @@ func TestBridgeUserStore_GetByWeChatIDAndGetAll(t *testing.T) {
 }
 
 func TestBridgeUserStore_UpdateLoginStateAndDelete(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
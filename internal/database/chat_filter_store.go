@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ChatFilterEntry is a chat filter entry added at runtime. Action is "allow"
+// or "deny".
+type ChatFilterEntry struct {
+	Entry  string
+	Action string
+}
+
+// ChatFilterStore persists chat filter entries added with the filter
+// command.
+type ChatFilterStore struct {
+	db *sql.DB
+}
+
+// NewChatFilterStore creates a ChatFilterStore from an existing sql.DB.
+func NewChatFilterStore(db *sql.DB) *ChatFilterStore {
+	return &ChatFilterStore{db: db}
+}
+
+// List returns all entries, oldest first.
+func (s *ChatFilterStore) List(ctx context.Context) ([]*ChatFilterEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT entry, action FROM chat_filter ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list chat filter: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ChatFilterEntry
+	for rows.Next() {
+		e := &ChatFilterEntry{}
+		if err := rows.Scan(&e.Entry, &e.Action); err != nil {
+			return nil, fmt.Errorf("scan chat filter entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Set adds an entry, or changes the action of an existing one.
+func (s *ChatFilterStore) Set(ctx context.Context, entry, action string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO chat_filter (entry, action, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (entry) DO UPDATE SET action = EXCLUDED.action
+	`, entry, action)
+	if err != nil {
+		return fmt.Errorf("set chat filter entry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an entry, reporting whether it existed.
+func (s *ChatFilterStore) Delete(ctx context.Context, entry string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM chat_filter WHERE entry = $1`, entry)
+	if err != nil {
+		return false, fmt.Errorf("delete chat filter entry: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete chat filter entry: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestChatFilterStore_SetListDelete(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewChatFilterStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO chat_filter`)).
+		WithArgs("gh_*", "deny").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Set(ctx, "gh_*", "deny"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT entry, action FROM chat_filter ORDER BY created_at`)).
+		WillReturnRows(sqlmock.NewRows([]string{"entry", "action"}).
+			AddRow("gh_*", "deny").
+			AddRow("type:group", "allow"))
+	entries, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Entry != "gh_*" || entries[1].Action != "allow" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM chat_filter WHERE entry = $1`)).
+		WithArgs("gh_*").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM chat_filter WHERE entry = $1`)).
+		WithArgs("wxid_missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if ok, err := store.Delete(ctx, "gh_*"); err != nil || !ok {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if ok, err := store.Delete(ctx, "wxid_missing"); err != nil || ok {
+		t.Fatalf("Delete of missing entry = %v, %v", ok, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 //go:embed migrations/*.sql
@@ -15,40 +17,99 @@ var migrationFS embed.FS
 
 // Database wraps the SQL database connection and provides typed query methods.
 type Database struct {
-	db *sql.DB
-
-	User            *UserStore
-	BridgeUser      *BridgeUserStore
-	RoomMapping     *RoomMappingStore
-	MessageMapping  *MessageMappingStore
-	GroupMember     *GroupMemberStore
-	MediaCache      *MediaCacheStore
-	ProviderSession *ProviderSessionStore
-	AuditLog        *AuditLogStore
-	RateLimit       *RateLimitStore
-	NodeAssignment  *NodeAssignmentStore
+	db      *sql.DB
+	maxIdle int // restored after CheckHealth drops idle connections
+
+	healthMu sync.Mutex
+	health   HealthStatus
+
+	User               *UserStore
+	BridgeUser         *BridgeUserStore
+	RoomMapping        *RoomMappingStore
+	MessageMapping     *MessageMappingStore
+	GroupMember        *GroupMemberStore
+	MediaCache         *MediaCacheStore
+	ProviderSession    *ProviderSessionStore
+	AuditLog           *AuditLogStore
+	RateLimit          *RateLimitStore
+	NodeAssignment     *NodeAssignmentStore
+	RiskCounter        *RiskCounterStore
+	DoublePuppet       *DoublePuppetStore
+	FriendRequest      *PendingFriendRequestStore
+	RoomMemberName     *RoomMemberNameStore
+	MessageState       *MessageStateStore
+	MomentsCursor      *MomentsCursorStore
+	PinnedAnnouncement *PinnedAnnouncementStore
+	ChatFilter         *ChatFilterStore
+	ReactionEvent      *ReactionEventStore
+	SendStat           *SendStatStore
+}
+
+// ConnectRetry controls how NewWithRetry waits for a database that is not
+// reachable yet, e.g. while Postgres restarts alongside the bridge.
+type ConnectRetry struct {
+	Attempts int           // Total connection attempts (minimum 1)
+	Timeout  time.Duration // Ping timeout per attempt
+	Backoff  time.Duration // Wait before the second attempt, doubled after each failure
+
+	// OnRetry, if set, is called after a failed attempt before waiting.
+	OnRetry func(attempt int, wait time.Duration, err error)
 }
 
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultConnectBackoff = time.Second
+
+	// defaultMaxIdleConns is database/sql's own default.
+	defaultMaxIdleConns = 2
+)
+
 // New creates a new Database instance and initializes typed stores.
 // Call RunMigrations separately after startup wiring is complete.
 func New(driverName, dataSourceName string, maxOpen, maxIdle int) (*Database, error) {
+	return NewWithRetry(driverName, dataSourceName, maxOpen, maxIdle, ConnectRetry{Attempts: 1})
+}
+
+// NewWithRetry is like New but retries the initial connection with
+// exponential backoff, so a database that comes up a few seconds after the
+// bridge doesn't fail startup.
+func NewWithRetry(driverName, dataSourceName string, maxOpen, maxIdle int, retry ConnectRetry) (*Database, error) {
+	dialect := DialectForDriver(driverName)
+	if dialect == DialectSQLite {
+		// The bundled modernc.org/sqlite driver registers as "sqlite" only
+		driverName = "sqlite"
+	}
 	db, err := sql.Open(driverName, dataSourceName)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
+	if dialect != DialectPostgres {
+		drv := db.Driver()
+		_ = db.Close()
+		db = sql.OpenDB(&rewritingConnector{drv: drv, dsn: dataSourceName, dialect: dialect})
+		// SQLite allows a single writer; more connections only produce
+		// "database is locked" errors.
+		maxOpen, maxIdle = 1, 1
+	}
 
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
 	db.SetConnMaxLifetime(30 * time.Minute)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := db.PingContext(ctx); err != nil {
+	if err := pingWithRetry(db, retry); err != nil {
 		_ = db.Close()
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	d := &Database{db: db}
+	d := NewFromDB(db)
+	d.maxIdle = maxIdle
+	return d, nil
+}
+
+// NewFromDB wraps an already opened sql.DB and initializes typed stores on
+// it.
+func NewFromDB(db *sql.DB) *Database {
+	d := &Database{db: db, maxIdle: defaultMaxIdleConns}
 	d.User = NewUserStore(db)
 	d.BridgeUser = NewBridgeUserStore(db)
 	d.RoomMapping = &RoomMappingStore{db: db}
@@ -59,8 +120,50 @@ func New(driverName, dataSourceName string, maxOpen, maxIdle int) (*Database, er
 	d.AuditLog = &AuditLogStore{db: db}
 	d.RateLimit = &RateLimitStore{db: db}
 	d.NodeAssignment = NewNodeAssignmentStore(db)
+	d.RiskCounter = NewRiskCounterStore(db)
+	d.DoublePuppet = NewDoublePuppetStore(db)
+	d.FriendRequest = NewPendingFriendRequestStore(db)
+	d.RoomMemberName = NewRoomMemberNameStore(db)
+	d.MessageState = NewMessageStateStore(db)
+	d.MomentsCursor = NewMomentsCursorStore(db)
+	d.PinnedAnnouncement = NewPinnedAnnouncementStore(db)
+	d.ChatFilter = NewChatFilterStore(db)
+	d.ReactionEvent = NewReactionEventStore(db)
+	d.SendStat = NewSendStatStore(db)
+	return d
+}
 
-	return d, nil
+// pingWithRetry pings db until it answers or retry.Attempts is used up,
+// returning the last error.
+func pingWithRetry(db *sql.DB, retry ConnectRetry) error {
+	attempts := retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	timeout := retry.Timeout
+	if timeout <= 0 {
+		timeout = defaultConnectTimeout
+	}
+	wait := retry.Backoff
+	if wait <= 0 {
+		wait = defaultConnectBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		if retry.OnRetry != nil {
+			retry.OnRetry(attempt, wait, err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
 }
 
 // RunMigrations executes all pending database migrations.
@@ -136,6 +239,55 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
+// Ping checks that the database is still reachable.
+func (d *Database) Ping(ctx context.Context) error {
+	if d.db == nil {
+		return fmt.Errorf("database not open")
+	}
+	return d.db.PingContext(ctx)
+}
+
+// HealthStatus is the outcome of the most recent CheckHealth.
+type HealthStatus struct {
+	Healthy   bool
+	CheckedAt time.Time // zero until the first check
+	Failures  int       // consecutive failed checks
+	LastError string
+}
+
+// CheckHealth pings the database and records the outcome for Health. After
+// a failed ping the pool's idle connections are closed, so the next query or
+// check dials a fresh connection instead of reusing one to a server that went
+// away, e.g. in a database failover.
+func (d *Database) CheckHealth(ctx context.Context) error {
+	err := d.Ping(ctx)
+
+	d.healthMu.Lock()
+	d.health.CheckedAt = time.Now()
+	d.health.Healthy = err == nil
+	if err != nil {
+		d.health.Failures++
+		d.health.LastError = err.Error()
+	} else {
+		d.health.Failures = 0
+		d.health.LastError = ""
+	}
+	d.healthMu.Unlock()
+
+	if err != nil && d.db != nil {
+		d.db.SetMaxIdleConns(0)
+		d.db.SetMaxIdleConns(d.maxIdle)
+	}
+	return err
+}
+
+// Health returns the outcome of the most recent CheckHealth.
+func (d *Database) Health() HealthStatus {
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+	return d.health
+}
+
 // DB returns the underlying *sql.DB for advanced usage.
 func (d *Database) DB() *sql.DB {
 	return d.db
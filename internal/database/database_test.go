@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"regexp"
@@ -77,7 +78,7 @@ func TestNewClosesHandleWhenPingFails(t *testing.T) {
 }
 
 func TestRunMigrationsAppliesPendingVersions(t *testing.T) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	db, mock, err := newExactMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -101,6 +102,17 @@ func TestRunMigrationsAppliesPendingVersions(t *testing.T) {
 	}{
 		{version: 1, file: "migrations/0001_initial_schema.sql"},
 		{version: 2, file: "migrations/0002_multi_tenant.sql"},
+		{version: 3, file: "migrations/0003_risk_counters.sql"},
+		{version: 4, file: "migrations/0004_double_puppet.sql"},
+		{version: 5, file: "migrations/0005_message_body.sql"},
+		{version: 6, file: "migrations/0006_pending_friend_request.sql"},
+		{version: 7, file: "migrations/0007_room_member_name.sql"},
+		{version: 8, file: "migrations/0008_message_state.sql"},
+		{version: 9, file: "migrations/0009_moments_cursor.sql"},
+		{version: 10, file: "migrations/0010_pinned_announcement.sql"},
+		{version: 11, file: "migrations/0011_chat_filter.sql"},
+		{version: 12, file: "migrations/0012_reaction_event.sql"},
+		{version: 13, file: "migrations/0013_send_stat.sql"},
 	} {
 		data, readErr := migrationFS.ReadFile(migration.file)
 		if readErr != nil {
@@ -125,7 +137,7 @@ func TestRunMigrationsAppliesPendingVersions(t *testing.T) {
 }
 
 func TestRunMigrationsSkipsAlreadyAppliedVersions(t *testing.T) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	db, mock, err := newExactMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -140,7 +152,7 @@ func TestRunMigrationsSkipsAlreadyAppliedVersions(t *testing.T) {
 		)
 	`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectQuery(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).
-		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(13))
 
 	if err := d.RunMigrations(context.Background()); err != nil {
 		t.Fatalf("RunMigrations error: %v", err)
@@ -152,7 +164,7 @@ func TestRunMigrationsSkipsAlreadyAppliedVersions(t *testing.T) {
 }
 
 func TestRunMigrationsRollsBackOnMigrationFailure(t *testing.T) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	db, mock, err := newExactMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -185,3 +197,99 @@ func TestRunMigrationsRollsBackOnMigrationFailure(t *testing.T) {
 		t.Fatalf("unmet SQL expectations: %v", err)
 	}
 }
+
+func TestNewWithRetryWaitsForDatabase(t *testing.T) {
+	dsn := fmt.Sprintf("sqlmock_database_retry_%d", time.Now().UnixNano())
+	seedDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock.NewWithDSN: %v", err)
+	}
+	defer seedDB.Close()
+
+	// The database is still starting for the first two attempts.
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	var waits []time.Duration
+	db, err := NewWithRetry("sqlmock", dsn, 5, 2, ConnectRetry{
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+		OnRetry: func(attempt int, wait time.Duration, err error) {
+			waits = append(waits, wait)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithRetry error: %v", err)
+	}
+	if db.BridgeUser == nil {
+		t.Fatal("expected typed stores to be initialized")
+	}
+	if len(waits) != 2 || waits[0] != time.Millisecond || waits[1] != 2*time.Millisecond {
+		t.Fatalf("retry waits = %v", waits)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet SQL expectations: %v", err)
+	}
+}
+
+func TestNewWithRetryGivesUpAfterAttempts(t *testing.T) {
+	dsn := fmt.Sprintf("sqlmock_database_retry_fail_%d", time.Now().UnixNano())
+	seedDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock.NewWithDSN: %v", err)
+	}
+	defer seedDB.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("still down"))
+	mock.ExpectClose()
+
+	db, err := NewWithRetry("sqlmock", dsn, 5, 2, ConnectRetry{Attempts: 2, Backoff: time.Millisecond})
+	if err == nil || !regexp.MustCompile(`ping database: still down`).MatchString(err.Error()) {
+		t.Fatalf("NewWithRetry error = %v, db = %+v", err, db)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet SQL expectations: %v", err)
+	}
+}
+
+func TestCheckHealthRecoversAfterDroppedConnection(t *testing.T) {
+	dsn := fmt.Sprintf("sqlmock_database_health_%d", time.Now().UnixNano())
+	seedDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock.NewWithDSN: %v", err)
+	}
+	defer seedDB.Close()
+	db, err := sql.Open("sqlmock", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+	d := NewFromDB(db)
+
+	if h := d.Health(); !h.CheckedAt.IsZero() {
+		t.Fatalf("health before the first check = %+v", h)
+	}
+
+	// The connection drops, then the next ping reaches the database again.
+	mock.ExpectPing().WillReturnError(errors.New("connection reset by peer"))
+	mock.ExpectPing()
+
+	if err := d.CheckHealth(context.Background()); err == nil {
+		t.Fatal("expected the first check to fail")
+	}
+	if h := d.Health(); h.Healthy || h.Failures != 1 || h.LastError != "connection reset by peer" {
+		t.Fatalf("health after the failed check = %+v", h)
+	}
+
+	if err := d.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth after recovery: %v", err)
+	}
+	if h := d.Health(); !h.Healthy || h.Failures != 0 || h.LastError != "" {
+		t.Fatalf("health after recovery = %+v", h)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet SQL expectations: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+)
+
+// Dialect is the SQL flavour of the database. Stores and migrations are
+// written for Postgres; for other dialects every statement is rewritten
+// just before it reaches the driver.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+
+	// DialectSQLite is served by the bundled modernc.org/sqlite driver,
+	// which is recent enough for ON CONFLICT upserts and RETURNING.
+	DialectSQLite Dialect = "sqlite"
+)
+
+// DialectForDriver returns the dialect spoken by a database/sql driver.
+// Unknown drivers are assumed to speak Postgres.
+func DialectForDriver(driverName string) Dialect {
+	switch driverName {
+	case "sqlite", "sqlite3":
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+type rewriteRule struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// sqliteRules translate the Postgres used by stores and migrations.
+var sqliteRules = []rewriteRule{
+	{regexp.MustCompile(`\$(\d+)`), `?$1`},
+	{regexp.MustCompile(`\bNOW\(\)`), `CURRENT_TIMESTAMP`},
+	{regexp.MustCompile(`::\w+`), ``},
+	{regexp.MustCompile(`\bBIGSERIAL PRIMARY KEY\b`), `INTEGER PRIMARY KEY AUTOINCREMENT`},
+	{regexp.MustCompile(`\bTIMESTAMP WITH TIME ZONE\b`), `TIMESTAMP`},
+	{regexp.MustCompile(`\b(JSONB|INET)\b`), `TEXT`},
+	{regexp.MustCompile(`\bBYTEA\b`), `BLOB`},
+	{regexp.MustCompile(`\bADD COLUMN IF NOT EXISTS\b`), `ADD COLUMN`},
+}
+
+// Rewrite translates a Postgres statement to the dialect. Numbered
+// placeholders become SQLite's ?NNN so that arguments still bind by
+// number, whatever order they appear in. String literals, quoted
+// identifiers and comments are left as they are.
+func (d Dialect) Rewrite(query string) string {
+	if d != DialectSQLite {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query))
+	for len(query) > 0 {
+		code, verbatim, rest := splitVerbatim(query)
+		for _, rule := range sqliteRules {
+			code = rule.pattern.ReplaceAllString(code, rule.replace)
+		}
+		b.WriteString(code)
+		b.WriteString(verbatim)
+		query = rest
+	}
+	return b.String()
+}
+
+// splitVerbatim splits query at its first string literal, quoted identifier
+// or -- comment: code comes before it, verbatim is the literal or comment
+// itself, and rest follows it. Doubled quotes inside a literal escape the
+// quote and don't end it.
+func splitVerbatim(query string) (code, verbatim, rest string) {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(query) {
+				if query[end] == c {
+					if end+1 < len(query) && query[end+1] == c {
+						end += 2
+						continue
+					}
+					end++
+					return query[:i], query[i:end], query[end:]
+				}
+				end++
+			}
+			return query[:i], query[i:], ""
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return query[:i], query[i:], ""
+			}
+			return query[:i], query[i : i+end], query[i+end:]
+		}
+	}
+	return query, "", ""
+}
+
+// rewritingConnector opens connections of drv that pass every statement
+// through dialect.Rewrite, so the stores can stay dialect-agnostic.
+type rewritingConnector struct {
+	drv     driver.Driver
+	dsn     string
+	dialect Dialect
+}
+
+func (c *rewritingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &rewritingConn{Conn: conn, dialect: c.dialect}, nil
+}
+
+func (c *rewritingConnector) Driver() driver.Driver { return c.drv }
+
+// rewritingConn rewrites statements before handing them to Conn. The
+// optional driver interfaces are passed through when Conn implements them;
+// otherwise driver.ErrSkip makes database/sql fall back to Prepare.
+type rewritingConn struct {
+	driver.Conn
+	dialect Dialect
+}
+
+func (c *rewritingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.dialect.Rewrite(query))
+}
+
+func (c *rewritingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = c.dialect.Rewrite(query)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *rewritingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, c.dialect.Rewrite(query), args)
+}
+
+func (c *rewritingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, c.dialect.Rewrite(query), args)
+}
+
+func (c *rewritingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *rewritingConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rewritingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *rewritingConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// testDialect is the dialect the store tests run against. TestMain runs
+// every test once per dialect; the expected SQL is written for Postgres and
+// rewritten like the statements themselves.
+var testDialect = DialectPostgres
+
+func TestMain(m *testing.M) {
+	for _, dialect := range []Dialect{DialectPostgres, DialectSQLite} {
+		testDialect = dialect
+		if code := m.Run(); code != 0 {
+			fmt.Printf("database tests failed with dialect %s\n", dialect)
+			os.Exit(code)
+		}
+	}
+	os.Exit(0)
+}
+
+var mockDSNs atomic.Int64
+
+// newMock returns a sqlmock database for testDialect matching expectations
+// as regular expressions, quoted with regexp.QuoteMeta.
+func newMock() (*sql.DB, sqlmock.Sqlmock, error) {
+	return newDialectMock(sqlmock.QueryMatcherRegexp, true)
+}
+
+// newExactMock is like newMock but matches expectations verbatim.
+func newExactMock() (*sql.DB, sqlmock.Sqlmock, error) {
+	return newDialectMock(sqlmock.QueryMatcherEqual, false)
+}
+
+func newDialectMock(matcher sqlmock.QueryMatcher, quoted bool) (*sql.DB, sqlmock.Sqlmock, error) {
+	if testDialect == DialectPostgres {
+		return sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	}
+
+	dsn := fmt.Sprintf("dialect_test_%d", mockDSNs.Add(1))
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.QueryMatcherOption(rewritingMatcher(matcher, quoted)))
+	if err != nil {
+		return nil, nil, err
+	}
+	db := sql.OpenDB(&rewritingConnector{drv: mockDB.Driver(), dsn: dsn, dialect: testDialect})
+	return db, mock, nil
+}
+
+var quotedMeta = regexp.MustCompile(`\\([\\.+*?()|\[\]{}^$])`)
+
+// rewritingMatcher rewrites the Postgres an expectation was written for
+// before matching. Quoted expectations are unquoted first and quoted again
+// after rewriting.
+func rewritingMatcher(matcher sqlmock.QueryMatcher, quoted bool) sqlmock.QueryMatcher {
+	return sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+		if quoted {
+			expectedSQL = quotedMeta.ReplaceAllString(expectedSQL, "$1")
+			expectedSQL = regexp.QuoteMeta(testDialect.Rewrite(expectedSQL))
+		} else {
+			expectedSQL = testDialect.Rewrite(expectedSQL)
+		}
+		return matcher.Match(expectedSQL, actualSQL)
+	})
+}
+
+func TestDialectForDriver(t *testing.T) {
+	for driverName, want := range map[string]Dialect{
+		"postgres": DialectPostgres,
+		"pgx":      DialectPostgres,
+		"sqlite":   DialectSQLite,
+		"sqlite3":  DialectSQLite,
+	} {
+		if got := DialectForDriver(driverName); got != want {
+			t.Errorf("DialectForDriver(%q) = %s, want %s", driverName, got, want)
+		}
+	}
+}
+
+func TestDialectRewrite_SQLite(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{
+			`UPDATE wechat_user SET avatar_mxc = $2, updated_at = NOW() WHERE wechat_id = $1`,
+			`UPDATE wechat_user SET avatar_mxc = ?2, updated_at = CURRENT_TIMESTAMP WHERE wechat_id = ?1`,
+		},
+		{`VALUES ($1, $2, $3, $4, $5::inet)`, `VALUES (?1, ?2, ?3, ?4, ?5)`},
+		{`id BIGSERIAL PRIMARY KEY,`, `id INTEGER PRIMARY KEY AUTOINCREMENT,`},
+		{`created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()`, `created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP`},
+		{`session_data JSONB NOT NULL, cookies BYTEA, ip_address INET`, `session_data TEXT NOT NULL, cookies BLOB, ip_address TEXT`},
+		{`ALTER TABLE t ADD COLUMN IF NOT EXISTS body TEXT`, `ALTER TABLE t ADD COLUMN body TEXT`},
+		// Literals, quoted identifiers and comments are kept verbatim
+		{`SELECT 'costs $1, it''s NOW()' || $1`, `SELECT 'costs $1, it''s NOW()' || ?1`},
+		{`SELECT "NOW()" FROM t WHERE a = $2`, `SELECT "NOW()" FROM t WHERE a = ?2`},
+		{"-- don't use NOW() here\nSELECT NOW()", "-- don't use NOW() here\nSELECT CURRENT_TIMESTAMP"},
+		{`SELECT 'unterminated $1`, `SELECT 'unterminated $1`},
+	}
+	for _, tt := range tests {
+		if got := DialectSQLite.Rewrite(tt.in); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := DialectPostgres.Rewrite(tt.in); got != tt.in {
+			t.Errorf("Postgres Rewrite(%q) = %q, want it unchanged", tt.in, got)
+		}
+	}
+}
+
+func TestDialectRewrite_MigrationsLeaveNoPostgresSyntax(t *testing.T) {
+	postgresOnly := regexp.MustCompile(`\$\d|NOW\(\)|::|BIGSERIAL|WITH TIME ZONE|JSONB|BYTEA|\bINET\b|ADD COLUMN IF NOT EXISTS`)
+
+	entries, err := migrationFS.ReadDir("migrations")
+	if err != nil {
+		t.Fatalf("read migrations: %v", err)
+	}
+	for _, entry := range entries {
+		data, err := migrationFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			t.Fatalf("read %s: %v", entry.Name(), err)
+		}
+		for i, line := range strings.Split(DialectSQLite.Rewrite(string(data)), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "--") {
+				continue
+			}
+			if match := postgresOnly.FindString(line); match != "" {
+				t.Errorf("%s:%d: %q left in SQLite schema", entry.Name(), i+1, match)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DoublePuppetStore persists the Matrix access tokens used to send events
+// as bridge users' real Matrix accounts.
+type DoublePuppetStore struct {
+	db *sql.DB
+}
+
+// NewDoublePuppetStore creates a DoublePuppetStore from an existing sql.DB.
+func NewDoublePuppetStore(db *sql.DB) *DoublePuppetStore {
+	return &DoublePuppetStore{db: db}
+}
+
+// GetAccessToken returns the stored access token for a Matrix user, or ""
+// if none is stored.
+func (s *DoublePuppetStore) GetAccessToken(ctx context.Context, matrixUserID string) (string, error) {
+	var token string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT access_token FROM double_puppet WHERE matrix_user_id = $1`, matrixUserID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get double puppet token: %w", err)
+	}
+	return token, nil
+}
+
+// SetAccessToken stores or replaces the access token for a Matrix user.
+func (s *DoublePuppetStore) SetAccessToken(ctx context.Context, matrixUserID, token string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO double_puppet (matrix_user_id, access_token, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (matrix_user_id) DO UPDATE SET
+			access_token = EXCLUDED.access_token,
+			updated_at = NOW()
+	`, matrixUserID, token)
+	if err != nil {
+		return fmt.Errorf("set double puppet token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccessToken removes the stored access token for a Matrix user.
+func (s *DoublePuppetStore) DeleteAccessToken(ctx context.Context, matrixUserID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM double_puppet WHERE matrix_user_id = $1`, matrixUserID)
+	if err != nil {
+		return fmt.Errorf("delete double puppet token: %w", err)
+	}
+	return nil
+}
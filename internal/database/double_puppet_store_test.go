@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDoublePuppetStore_SetGetDelete(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewDoublePuppetStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO double_puppet`)).
+		WithArgs("@alice:example.com", "syt_token").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.SetAccessToken(ctx, "@alice:example.com", "syt_token"); err != nil {
+		t.Fatalf("SetAccessToken error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT access_token FROM double_puppet WHERE matrix_user_id = $1`)).
+		WithArgs("@alice:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"access_token"}).AddRow("syt_token"))
+	token, err := store.GetAccessToken(ctx, "@alice:example.com")
+	if err != nil || token != "syt_token" {
+		t.Fatalf("GetAccessToken = %q, %v", token, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT access_token FROM double_puppet WHERE matrix_user_id = $1`)).
+		WithArgs("@bob:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"access_token"}))
+	token, err = store.GetAccessToken(ctx, "@bob:example.com")
+	if err != nil || token != "" {
+		t.Fatalf("expected no token for unknown user, got %q err=%v", token, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM double_puppet WHERE matrix_user_id = $1`)).
+		WithArgs("@alice:example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.DeleteAccessToken(ctx, "@alice:example.com"); err != nil {
+		t.Fatalf("DeleteAccessToken error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
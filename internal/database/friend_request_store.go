@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PendingFriendRequest is a WeChat friend request the bridge user has not
+// answered yet.
+type PendingFriendRequest struct {
+	BridgeUser string
+	WeChatID   string
+	Nickname   string
+	Content    string // greeting the requester wrote
+	XML        string // raw request payload, needed to accept it
+	Ticket     string
+	ReceivedAt time.Time
+}
+
+// PendingFriendRequestStore persists friend requests until they are accepted.
+type PendingFriendRequestStore struct {
+	db *sql.DB
+}
+
+// NewPendingFriendRequestStore creates a PendingFriendRequestStore from an existing sql.DB.
+func NewPendingFriendRequestStore(db *sql.DB) *PendingFriendRequestStore {
+	return &PendingFriendRequestStore{db: db}
+}
+
+const pendingFriendRequestColumns = `bridge_user, wechat_id, nickname, content, xml, ticket, received_at`
+
+// Upsert stores a friend request. A repeated request from the same user
+// replaces the earlier one.
+func (s *PendingFriendRequestStore) Upsert(ctx context.Context, r *PendingFriendRequest) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO pending_friend_request (`+pendingFriendRequestColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (bridge_user, wechat_id) DO UPDATE SET
+			nickname = EXCLUDED.nickname,
+			content = EXCLUDED.content,
+			xml = EXCLUDED.xml,
+			ticket = EXCLUDED.ticket,
+			received_at = NOW()
+	`, r.BridgeUser, r.WeChatID, r.Nickname, r.Content, r.XML, r.Ticket)
+	if err != nil {
+		return fmt.Errorf("upsert pending friend request: %w", err)
+	}
+	return nil
+}
+
+// Get returns the pending request from wechatID to bridgeUser, or nil.
+func (s *PendingFriendRequestStore) Get(ctx context.Context, bridgeUser, wechatID string) (*PendingFriendRequest, error) {
+	r := &PendingFriendRequest{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+pendingFriendRequestColumns+` FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`,
+		bridgeUser, wechatID).Scan(
+		&r.BridgeUser, &r.WeChatID, &r.Nickname, &r.Content, &r.XML, &r.Ticket, &r.ReceivedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pending friend request: %w", err)
+	}
+	return r, nil
+}
+
+// ListByBridgeUser returns a bridge user's pending requests, oldest first.
+func (s *PendingFriendRequestStore) ListByBridgeUser(ctx context.Context, bridgeUser string) ([]*PendingFriendRequest, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+pendingFriendRequestColumns+` FROM pending_friend_request WHERE bridge_user = $1 ORDER BY received_at`,
+		bridgeUser)
+	if err != nil {
+		return nil, fmt.Errorf("list pending friend requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []*PendingFriendRequest
+	for rows.Next() {
+		r := &PendingFriendRequest{}
+		if err := rows.Scan(&r.BridgeUser, &r.WeChatID, &r.Nickname, &r.Content, &r.XML, &r.Ticket, &r.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("scan pending friend request: %w", err)
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// Delete removes an answered request.
+func (s *PendingFriendRequestStore) Delete(ctx context.Context, bridgeUser, wechatID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`,
+		bridgeUser, wechatID)
+	if err != nil {
+		return fmt.Errorf("delete pending friend request: %w", err)
+	}
+	return nil
+}
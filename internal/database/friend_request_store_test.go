@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPendingFriendRequestStore_UpsertListDelete(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewPendingFriendRequestStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO pending_friend_request`)).
+		WithArgs("@alice:example.com", "wxid_bob", "Bob", "hello", "<msg/>", "v4_ticket").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	err = store.Upsert(ctx, &PendingFriendRequest{
+		BridgeUser: "@alice:example.com", WeChatID: "wxid_bob", Nickname: "Bob",
+		Content: "hello", XML: "<msg/>", Ticket: "v4_ticket",
+	})
+	if err != nil {
+		t.Fatalf("Upsert error: %v", err)
+	}
+
+	columns := []string{"bridge_user", "wechat_id", "nickname", "content", "xml", "ticket", "received_at"}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pending_friend_request WHERE bridge_user = $1 ORDER BY received_at`)).
+		WithArgs("@alice:example.com").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("@alice:example.com", "wxid_bob", "Bob", "hello", "<msg/>", "v4_ticket", now).
+			AddRow("@alice:example.com", "wxid_carol", "Carol", "", "<msg/>", "", now))
+	requests, err := store.ListByBridgeUser(ctx, "@alice:example.com")
+	if err != nil {
+		t.Fatalf("ListByBridgeUser error: %v", err)
+	}
+	if len(requests) != 2 || requests[0].WeChatID != "wxid_bob" || requests[0].XML != "<msg/>" || requests[1].Nickname != "Carol" {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`)).
+		WithArgs("@alice:example.com", "wxid_dave").
+		WillReturnRows(sqlmock.NewRows(columns))
+	req, err := store.Get(ctx, "@alice:example.com", "wxid_dave")
+	if err != nil || req != nil {
+		t.Fatalf("expected no request for unknown user, got %+v err=%v", req, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM pending_friend_request WHERE bridge_user = $1 AND wechat_id = $2`)).
+		WithArgs("@alice:example.com", "wxid_bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(ctx, "@alice:example.com", "wxid_bob"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
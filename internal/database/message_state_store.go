@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Delivery states of a message sent from Matrix to WeChat. A message is
+// queued until the send rate limit lets it through, then sending until the
+// provider answers. It is sent once the provider accepted it, and delivered
+// only when a provider with Capability.SendAck acknowledges that WeChat
+// delivered it; failed means it was given up.
+const (
+	MessageStateQueued    = "queued"
+	MessageStateSending   = "sending"
+	MessageStateSent      = "sent"
+	MessageStateDelivered = "delivered"
+	MessageStateFailed    = "failed"
+)
+
+// MessageState is the delivery state of a message sent from Matrix.
+type MessageState struct {
+	MatrixEventID string
+	MatrixRoomID  string
+	State         string
+	Error         string // why sending failed, when State is MessageStateFailed
+	UpdatedAt     time.Time
+}
+
+// MessageStateStore persists the delivery state of messages sent from Matrix.
+type MessageStateStore struct {
+	db *sql.DB
+}
+
+// NewMessageStateStore creates a MessageStateStore from an existing sql.DB.
+func NewMessageStateStore(db *sql.DB) *MessageStateStore {
+	return &MessageStateStore{db: db}
+}
+
+// Set records the state of a message, replacing its previous one.
+func (s *MessageStateStore) Set(ctx context.Context, eventID, roomID, state, errMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO message_state (matrix_event_id, matrix_room_id, state, error, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (matrix_event_id) DO UPDATE SET
+			state = EXCLUDED.state,
+			error = EXCLUDED.error,
+			updated_at = NOW()
+	`, eventID, roomID, state, errMsg)
+	if err != nil {
+		return fmt.Errorf("set message state: %w", err)
+	}
+	return nil
+}
+
+// Get returns the state of a message, or nil if none was recorded.
+func (s *MessageStateStore) Get(ctx context.Context, eventID string) (*MessageState, error) {
+	m := &MessageState{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT matrix_event_id, matrix_room_id, state, error, updated_at FROM message_state WHERE matrix_event_id = $1`,
+		eventID,
+	).Scan(&m.MatrixEventID, &m.MatrixRoomID, &m.State, &m.Error, &m.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message state: %w", err)
+	}
+	return m, nil
+}
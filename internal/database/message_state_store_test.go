@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMessageStateStore_SetGet(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewMessageStateStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_state`)).
+		WithArgs("$evt", "!room:example.com", MessageStateFailed, "rate limited").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Set(ctx, "$evt", "!room:example.com", MessageStateFailed, "rate limited"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_state WHERE matrix_event_id = $1`)).
+		WithArgs("$evt").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id", "matrix_room_id", "state", "error", "updated_at"}).
+			AddRow("$evt", "!room:example.com", MessageStateFailed, "rate limited", now))
+	state, err := store.Get(ctx, "$evt")
+	if err != nil || state == nil || state.State != MessageStateFailed || state.Error != "rate limited" {
+		t.Fatalf("Get = %+v, %v", state, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM message_state WHERE matrix_event_id = $1`)).
+		WithArgs("$unknown").
+		WillReturnError(sql.ErrNoRows)
+	if state, err := store.Get(ctx, "$unknown"); state != nil || err != nil {
+		t.Fatalf("Get unknown = %+v, %v, want nil, nil", state, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
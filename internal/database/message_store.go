@@ -14,6 +14,7 @@ type MessageMapping struct {
 	MatrixRoomID  string
 	Sender        string
 	MsgType       int
+	Body          string // plain-text body, for reply fallbacks
 	Timestamp     time.Time
 	CreatedAt     time.Time
 }
@@ -31,10 +32,10 @@ func NewMessageMappingStore(db *sql.DB) *MessageMappingStore {
 // Insert creates a new message mapping.
 func (s *MessageMappingStore) Insert(ctx context.Context, m *MessageMapping) error {
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO message_mapping (wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO message_mapping (wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (wechat_msg_id, matrix_room_id) DO NOTHING
-	`, m.WeChatMsgID, m.MatrixEventID, m.MatrixRoomID, m.Sender, m.MsgType, m.Timestamp)
+	`, m.WeChatMsgID, m.MatrixEventID, m.MatrixRoomID, m.Sender, m.MsgType, m.Timestamp, m.Body)
 	if err != nil {
 		return fmt.Errorf("insert message mapping: %w", err)
 	}
@@ -42,18 +43,25 @@ func (s *MessageMappingStore) Insert(ctx context.Context, m *MessageMapping) err
 }
 
 // messageMappingColumns is the column list shared by all message mapping queries.
-const messageMappingColumns = `wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, created_at`
+const messageMappingColumns = `wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, created_at, body`
 
 // scanMessageMapping scans a row into a MessageMapping struct.
 func scanMessageMapping(scanner interface{ Scan(...interface{}) error }, m *MessageMapping) error {
 	return scanner.Scan(
 		&m.WeChatMsgID, &m.MatrixEventID, &m.MatrixRoomID, &m.Sender,
-		&m.MsgType, &m.Timestamp, &m.CreatedAt,
+		&m.MsgType, &m.Timestamp, &m.CreatedAt, &m.Body,
 	)
 }
 
 // GetByWeChatMsgID looks up a message mapping by WeChat message ID and room.
+// The same WeChat message may be mapped into several rooms, e.g. a group
+// shared by two bridge users; without a room ID the most recently inserted
+// mapping is returned. Use GetByWeChatMsgIDAndChat when only the chat is
+// known.
 func (s *MessageMappingStore) GetByWeChatMsgID(ctx context.Context, msgID, roomID string) (*MessageMapping, error) {
+	if roomID == "" {
+		return s.GetLatestByWeChatMsgID(ctx, msgID)
+	}
 	m := &MessageMapping{}
 	err := scanMessageMapping(s.db.QueryRowContext(ctx,
 		`SELECT `+messageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id = $2`,
@@ -83,6 +91,23 @@ func (s *MessageMappingStore) GetLatestByWeChatMsgID(ctx context.Context, msgID
 	return m, nil
 }
 
+// GetByWeChatMsgIDAndChat looks up the mapping of a WeChat message in the
+// bridge user's room for a WeChat chat.
+func (s *MessageMappingStore) GetByWeChatMsgIDAndChat(ctx context.Context, msgID, chatID, bridgeUser string) (*MessageMapping, error) {
+	m := &MessageMapping{}
+	err := scanMessageMapping(s.db.QueryRowContext(ctx,
+		`SELECT `+messageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id IN (
+			SELECT matrix_room_id FROM room_mapping WHERE wechat_chat_id = $2 AND bridge_user = $3)`,
+		msgID, chatID, bridgeUser), m)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message by wechat id and chat: %w", err)
+	}
+	return m, nil
+}
+
 // GetByMatrixEventID looks up a message mapping by Matrix event ID.
 func (s *MessageMappingStore) GetByMatrixEventID(ctx context.Context, eventID string) (*MessageMapping, error) {
 	m := &MessageMapping{}
@@ -98,6 +123,40 @@ func (s *MessageMappingStore) GetByMatrixEventID(ctx context.Context, eventID st
 	return m, nil
 }
 
+// GetLastTimestamp returns the timestamp of the newest message mapped into a room,
+// or nil if the room has no mapped messages.
+func (s *MessageMappingStore) GetLastTimestamp(ctx context.Context, roomID string) (*time.Time, error) {
+	// Not MAX(timestamp): SQLite loses the column type in aggregates and
+	// returns the timestamp as text.
+	var ts time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`,
+		roomID).Scan(&ts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get last message timestamp: %w", err)
+	}
+	return &ts, nil
+}
+
+// GetLastBySender returns the most recent message sender sent in a room, or
+// nil if there is none.
+func (s *MessageMappingStore) GetLastBySender(ctx context.Context, roomID, sender string) (*MessageMapping, error) {
+	m := &MessageMapping{}
+	err := scanMessageMapping(s.db.QueryRowContext(ctx,
+		`SELECT `+messageMappingColumns+` FROM message_mapping WHERE matrix_room_id = $1 AND sender = $2 ORDER BY timestamp DESC LIMIT 1`,
+		roomID, sender), m)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get last message by sender: %w", err)
+	}
+	return m, nil
+}
+
 // DeleteByRoom deletes all message mappings for a room.
 func (s *MessageMappingStore) DeleteByRoom(ctx context.Context, roomID string) error {
 	_, err := s.db.ExecContext(ctx,
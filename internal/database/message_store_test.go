@@ -12,12 +12,12 @@ import (
 func messageMappingMockRows() *sqlmock.Rows {
 	now := time.Now()
 	return sqlmock.NewRows([]string{
-		"wechat_msg_id", "matrix_event_id", "matrix_room_id", "sender", "msg_type", "timestamp", "created_at",
-	}).AddRow("wxmsg1", "$event1", "!room:example.com", "@user:example.com", 1, now, now)
+		"wechat_msg_id", "matrix_event_id", "matrix_room_id", "sender", "msg_type", "timestamp", "created_at", "body",
+	}).AddRow("wxmsg1", "$event1", "!room:example.com", "@user:example.com", 1, now, now, "hello")
 }
 
 func TestMessageMappingStore_CRUD(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -26,11 +26,11 @@ func TestMessageMappingStore_CRUD(t *testing.T) {
 	store := &MessageMappingStore{db: db}
 	now := time.Now()
 	mock.ExpectExec(regexp.QuoteMeta(`
-		INSERT INTO message_mapping (wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO message_mapping (wechat_msg_id, matrix_event_id, matrix_room_id, sender, msg_type, timestamp, body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (wechat_msg_id, matrix_room_id) DO NOTHING
 	`)).
-		WithArgs("wxmsg1", "$event1", "!room:example.com", "@user:example.com", 1, now).
+		WithArgs("wxmsg1", "$event1", "!room:example.com", "@user:example.com", 1, now, "hello").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	if err := store.Insert(context.Background(), &MessageMapping{
 		WeChatMsgID:   "wxmsg1",
@@ -38,6 +38,7 @@ func TestMessageMappingStore_CRUD(t *testing.T) {
 		MatrixRoomID:  "!room:example.com",
 		Sender:        "@user:example.com",
 		MsgType:       1,
+		Body:          "hello",
 		Timestamp:     now,
 	}); err != nil {
 		t.Fatalf("Insert error: %v", err)
@@ -51,6 +52,24 @@ func TestMessageMappingStore_CRUD(t *testing.T) {
 		t.Fatalf("GetByWeChatMsgID error=%v mapping=%+v", err, mapping)
 	}
 
+	// Without a room the most recent mapping is returned
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + messageMappingColumns + ` FROM message_mapping WHERE wechat_msg_id = $1 ORDER BY created_at DESC LIMIT 1`)).
+		WithArgs("wxmsg1").
+		WillReturnRows(messageMappingMockRows())
+	mapping, err = store.GetByWeChatMsgID(context.Background(), "wxmsg1", "")
+	if err != nil || mapping == nil {
+		t.Fatalf("GetByWeChatMsgID (no room) error=%v mapping=%+v", err, mapping)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+messageMappingColumns+` FROM message_mapping WHERE wechat_msg_id = $1 AND matrix_room_id IN (
+			SELECT matrix_room_id FROM room_mapping WHERE wechat_chat_id = $2 AND bridge_user = $3)`)).
+		WithArgs("wxmsg1", "wxid_bob", "@user:example.com").
+		WillReturnRows(messageMappingMockRows())
+	mapping, err = store.GetByWeChatMsgIDAndChat(context.Background(), "wxmsg1", "wxid_bob", "@user:example.com")
+	if err != nil || mapping == nil || mapping.MatrixRoomID != "!room:example.com" {
+		t.Fatalf("GetByWeChatMsgIDAndChat error=%v mapping=%+v", err, mapping)
+	}
+
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + messageMappingColumns + ` FROM message_mapping WHERE matrix_event_id = $1`)).
 		WithArgs("$event1").
 		WillReturnRows(messageMappingMockRows())
@@ -67,6 +86,30 @@ func TestMessageMappingStore_CRUD(t *testing.T) {
 		t.Fatalf("GetLatestByWeChatMsgID error=%v mapping=%+v", err, mapping)
 	}
 
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+messageMappingColumns+` FROM message_mapping WHERE matrix_room_id = $1 AND sender = $2 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!room:example.com", "@user:example.com").
+		WillReturnRows(messageMappingMockRows())
+	mapping, err = store.GetLastBySender(context.Background(), "!room:example.com", "@user:example.com")
+	if err != nil || mapping == nil || mapping.MatrixEventID != "$event1" {
+		t.Fatalf("GetLastBySender error=%v mapping=%+v", err, mapping)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!room:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(now))
+	last, err := store.GetLastTimestamp(context.Background(), "!room:example.com")
+	if err != nil || last == nil || !last.Equal(now) {
+		t.Fatalf("GetLastTimestamp error=%v last=%v", err, last)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT timestamp FROM message_mapping WHERE matrix_room_id = $1 ORDER BY timestamp DESC LIMIT 1`)).
+		WithArgs("!empty:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}))
+	last, err = store.GetLastTimestamp(context.Background(), "!empty:example.com")
+	if err != nil || last != nil {
+		t.Fatalf("GetLastTimestamp (empty) error=%v last=%v", err, last)
+	}
+
 	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM message_mapping WHERE matrix_room_id = $1")).
 		WithArgs("!room:example.com").
 		WillReturnResult(sqlmock.NewResult(1, 1))
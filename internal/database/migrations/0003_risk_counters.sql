@@ -0,0 +1,9 @@
+-- Daily risk-control counters, persisted so a restart does not reset them.
+CREATE TABLE IF NOT EXISTS risk_counter (
+    account       TEXT PRIMARY KEY,
+    counter_date  DATE NOT NULL,
+    message_count INT NOT NULL DEFAULT 0,
+    group_count   INT NOT NULL DEFAULT 0,
+    friend_count  INT NOT NULL DEFAULT 0,
+    updated_at    TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Matrix access tokens of bridge users, used to send their own WeChat
+-- messages from their real Matrix account (double puppeting).
+CREATE TABLE IF NOT EXISTS double_puppet (
+    matrix_user_id TEXT PRIMARY KEY,
+    access_token   TEXT NOT NULL,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Plain-text body of each bridged message, used to render reply fallbacks
+-- without fetching the replied-to event.
+ALTER TABLE message_mapping ADD COLUMN IF NOT EXISTS body TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Incoming WeChat friend requests awaiting the bridge user's approval.
+CREATE TABLE IF NOT EXISTS pending_friend_request (
+    bridge_user TEXT NOT NULL,
+    wechat_id   TEXT NOT NULL,
+    nickname    TEXT NOT NULL DEFAULT '',
+    content     TEXT NOT NULL DEFAULT '',
+    xml         TEXT NOT NULL DEFAULT '',
+    ticket      TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (bridge_user, wechat_id)
+);
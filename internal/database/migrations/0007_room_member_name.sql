@@ -0,0 +1,8 @@
+-- Per-room display names bridge users set for puppets with the rename command.
+CREATE TABLE IF NOT EXISTS room_member_name (
+    matrix_room_id TEXT NOT NULL,
+    wechat_id      TEXT NOT NULL,
+    displayname    TEXT NOT NULL,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (matrix_room_id, wechat_id)
+);
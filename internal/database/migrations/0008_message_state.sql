@@ -0,0 +1,9 @@
+-- Delivery state of messages sent from Matrix to WeChat, for the msg-status
+-- command. Rows exist before the WeChat message ID (message_mapping) does.
+CREATE TABLE IF NOT EXISTS message_state (
+    matrix_event_id TEXT PRIMARY KEY,
+    matrix_room_id  TEXT NOT NULL,
+    state           TEXT NOT NULL,
+    error           TEXT NOT NULL DEFAULT '',
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,8 @@
+-- Newest Moments (朋友圈) entry posted to each bridge user's Moments room,
+-- so that polling the feed doesn't post an entry twice.
+CREATE TABLE IF NOT EXISTS moments_cursor (
+    bridge_user    TEXT PRIMARY KEY,
+    last_moment_id TEXT NOT NULL,
+    last_timestamp BIGINT NOT NULL,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Event of the group announcement currently pinned in each room, so that it
+-- can be unpinned when the announcement changes.
+CREATE TABLE IF NOT EXISTS pinned_announcement (
+    matrix_room_id TEXT PRIMARY KEY,
+    event_id       TEXT NOT NULL,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
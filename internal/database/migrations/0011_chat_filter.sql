@@ -0,0 +1,7 @@
+-- Chat filter entries added at runtime with the filter command, on top of
+-- bridge.filters in the config. action is "allow" or "deny".
+CREATE TABLE IF NOT EXISTS chat_filter (
+    entry      TEXT PRIMARY KEY,
+    action     TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- Matrix reactions bridged from WeChat emoji reactions (表情回应), so that
+-- they can be redacted when the reaction is withdrawn, also after a restart.
+CREATE TABLE IF NOT EXISTS reaction_event (
+    matrix_room_id  TEXT NOT NULL,
+    wechat_msg_id   TEXT NOT NULL,
+    wechat_user_id  TEXT NOT NULL,
+    emoji           TEXT NOT NULL,
+    matrix_event_id TEXT NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (matrix_room_id, wechat_msg_id, wechat_user_id, emoji)
+);
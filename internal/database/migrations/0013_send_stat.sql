@@ -0,0 +1,11 @@
+-- Daily counts of the messages sent to WeChat, by bridge user, provider and
+-- message type, for the stats command. send_date is the calendar day
+-- (YYYY-MM-DD) in the bridge's time zone.
+CREATE TABLE IF NOT EXISTS send_stat (
+    bridge_user   TEXT NOT NULL DEFAULT '',
+    provider      TEXT NOT NULL,
+    send_date     TEXT NOT NULL,
+    msg_type      TEXT NOT NULL,
+    message_count INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bridge_user, provider, send_date, msg_type)
+);
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MomentsCursor is the newest Moments entry posted for a bridge user.
+type MomentsCursor struct {
+	BridgeUser    string
+	LastMomentID  string
+	LastTimestamp int64 // post time of the entry, in milliseconds
+}
+
+// MomentsCursorStore persists how far each bridge user's Moments feed has
+// been posted.
+type MomentsCursorStore struct {
+	db *sql.DB
+}
+
+// NewMomentsCursorStore creates a MomentsCursorStore from an existing sql.DB.
+func NewMomentsCursorStore(db *sql.DB) *MomentsCursorStore {
+	return &MomentsCursorStore{db: db}
+}
+
+// Get returns a bridge user's cursor, or nil if their feed was never polled.
+func (s *MomentsCursorStore) Get(ctx context.Context, bridgeUser string) (*MomentsCursor, error) {
+	c := &MomentsCursor{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT bridge_user, last_moment_id, last_timestamp FROM moments_cursor WHERE bridge_user = $1`,
+		bridgeUser,
+	).Scan(&c.BridgeUser, &c.LastMomentID, &c.LastTimestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get moments cursor: %w", err)
+	}
+	return c, nil
+}
+
+// Set moves a bridge user's cursor to the given entry.
+func (s *MomentsCursorStore) Set(ctx context.Context, c *MomentsCursor) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO moments_cursor (bridge_user, last_moment_id, last_timestamp, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (bridge_user) DO UPDATE SET
+			last_moment_id = EXCLUDED.last_moment_id,
+			last_timestamp = EXCLUDED.last_timestamp,
+			updated_at = NOW()
+	`, c.BridgeUser, c.LastMomentID, c.LastTimestamp)
+	if err != nil {
+		return fmt.Errorf("set moments cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMomentsCursorStore_SetGet(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewMomentsCursorStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT bridge_user, last_moment_id, last_timestamp FROM moments_cursor WHERE bridge_user = $1`)).
+		WithArgs("@user:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"bridge_user", "last_moment_id", "last_timestamp"}))
+	if c, err := store.Get(ctx, "@user:example.com"); err != nil || c != nil {
+		t.Fatalf("Get before Set = %+v, %v", c, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO moments_cursor`)).
+		WithArgs("@user:example.com", "13920000001", int64(1700000000000)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Set(ctx, &MomentsCursor{BridgeUser: "@user:example.com", LastMomentID: "13920000001", LastTimestamp: 1700000000000}); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM moments_cursor WHERE bridge_user = $1`)).
+		WithArgs("@user:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"bridge_user", "last_moment_id", "last_timestamp"}).
+			AddRow("@user:example.com", "13920000001", int64(1700000000000)))
+	c, err := store.Get(ctx, "@user:example.com")
+	if err != nil || c == nil || c.LastMomentID != "13920000001" || c.LastTimestamp != 1700000000000 {
+		t.Fatalf("Get = %+v, %v", c, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func TestNewNodeAssignmentStore(t *testing.T) {
-	db, _, err := sqlmock.New()
+	db, _, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -22,7 +22,7 @@ func TestNewNodeAssignmentStore(t *testing.T) {
 }
 
 func TestNodeAssignmentStore_GetByBridgeUser_NotFound(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -52,7 +52,7 @@ func TestNodeAssignmentStore_GetByBridgeUser_NotFound(t *testing.T) {
 }
 
 func TestNodeAssignmentStore_DeleteExceptLoginState(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
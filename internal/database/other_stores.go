@@ -25,6 +25,11 @@ type GroupMemberStore struct {
 	db *sql.DB
 }
 
+// NewGroupMemberStore creates a GroupMemberStore from an existing sql.DB.
+func NewGroupMemberStore(db *sql.DB) *GroupMemberStore {
+	return &GroupMemberStore{db: db}
+}
+
 // Upsert inserts or updates a group member.
 func (s *GroupMemberStore) Upsert(ctx context.Context, m *GroupMemberRow) error {
 	_, err := s.db.ExecContext(ctx, `
@@ -63,6 +68,17 @@ func (s *GroupMemberStore) GetByGroup(ctx context.Context, groupID string) ([]*G
 	return members, rows.Err()
 }
 
+// CountByGroup returns the number of known members of a group.
+func (s *GroupMemberStore) CountByGroup(ctx context.Context, groupID string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM group_member WHERE group_id = $1", groupID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count group members: %w", err)
+	}
+	return count, nil
+}
+
 // DeleteMember removes a member from a group.
 func (s *GroupMemberStore) DeleteMember(ctx context.Context, groupID, wechatID string) error {
 	_, err := s.db.ExecContext(ctx,
@@ -156,7 +172,7 @@ func (s *ProviderSessionStore) Upsert(ctx context.Context, sess *ProviderSession
 			cookies = EXCLUDED.cookies,
 			device_info = EXCLUDED.device_info,
 			updated_at = NOW()
-	`, sess.BridgeUser, sess.ProviderType, sess.SessionData, sess.Cookies, sess.DeviceInfo)
+	`, sess.BridgeUser, sess.ProviderType, sess.SessionData, nullBytes(sess.Cookies), nullBytes(sess.DeviceInfo))
 	if err != nil {
 		return fmt.Errorf("upsert provider session: %w", err)
 	}
@@ -166,12 +182,14 @@ func (s *ProviderSessionStore) Upsert(ctx context.Context, sess *ProviderSession
 // Get retrieves a provider session for a bridge user.
 func (s *ProviderSessionStore) Get(ctx context.Context, bridgeUser string) (*ProviderSessionRow, error) {
 	sess := &ProviderSessionRow{}
+	// json.RawMessage can't be scanned from NULL; []byte can.
+	var sessionData, deviceInfo []byte
 	err := s.db.QueryRowContext(ctx, `
 		SELECT bridge_user, provider_type, session_data, cookies, device_info, updated_at
 		FROM provider_session WHERE bridge_user = $1
 	`, bridgeUser).Scan(
-		&sess.BridgeUser, &sess.ProviderType, &sess.SessionData,
-		&sess.Cookies, &sess.DeviceInfo, &sess.UpdatedAt,
+		&sess.BridgeUser, &sess.ProviderType, &sessionData,
+		&sess.Cookies, &deviceInfo, &sess.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -179,6 +197,7 @@ func (s *ProviderSessionStore) Get(ctx context.Context, bridgeUser string) (*Pro
 	if err != nil {
 		return nil, fmt.Errorf("get provider session: %w", err)
 	}
+	sess.SessionData, sess.DeviceInfo = sessionData, deviceInfo
 	return sess, nil
 }
 
@@ -234,11 +253,13 @@ func (s *AuditLogStore) Recent(ctx context.Context, bridgeUser string, limit int
 	var entries []*AuditLogEntry
 	for rows.Next() {
 		e := &AuditLogEntry{}
+		var details []byte
 		var ip sql.NullString
 		if err := rows.Scan(&e.ID, &e.BridgeUser, &e.Action, &e.ProviderType,
-			&e.Details, &ip, &e.CreatedAt); err != nil {
+			&details, &ip, &e.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan audit log: %w", err)
 		}
+		e.Details = details
 		e.IPAddress = ip.String
 		entries = append(entries, e)
 	}
@@ -316,3 +337,12 @@ func nullString(s string) interface{} {
 	}
 	return s
 }
+
+// nullBytes stores empty cookies and device info as NULL; an empty JSONB
+// value would be invalid.
+func nullBytes(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
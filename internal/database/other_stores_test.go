@@ -11,7 +11,7 @@ import (
 )
 
 func TestGroupMemberStore_CRUD(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -49,6 +49,14 @@ func TestGroupMemberStore_CRUD(t *testing.T) {
 		t.Fatalf("GetByGroup error=%v len=%d", err, len(rows))
 	}
 
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM group_member WHERE group_id = $1")).
+		WithArgs("group1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	count, err := store.CountByGroup(context.Background(), "group1")
+	if err != nil || count != 3 {
+		t.Fatalf("CountByGroup error=%v count=%d", err, count)
+	}
+
 	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM group_member WHERE group_id = $1 AND wechat_id = $2")).
 		WithArgs("group1", "wxid1").
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -69,7 +77,7 @@ func TestGroupMemberStore_CRUD(t *testing.T) {
 }
 
 func TestMediaCacheProviderSessionAuditRateLimitStores(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// PinnedAnnouncementStore persists which event pins each group room's
+// current announcement.
+type PinnedAnnouncementStore struct {
+	db *sql.DB
+}
+
+// NewPinnedAnnouncementStore creates a PinnedAnnouncementStore from an
+// existing sql.DB.
+func NewPinnedAnnouncementStore(db *sql.DB) *PinnedAnnouncementStore {
+	return &PinnedAnnouncementStore{db: db}
+}
+
+// Get returns the event ID of a room's pinned announcement, or "" if none
+// was pinned.
+func (s *PinnedAnnouncementStore) Get(ctx context.Context, matrixRoomID string) (string, error) {
+	var eventID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT event_id FROM pinned_announcement WHERE matrix_room_id = $1`,
+		matrixRoomID,
+	).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get pinned announcement: %w", err)
+	}
+	return eventID, nil
+}
+
+// Set records eventID as a room's pinned announcement.
+func (s *PinnedAnnouncementStore) Set(ctx context.Context, matrixRoomID, eventID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO pinned_announcement (matrix_room_id, event_id, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (matrix_room_id) DO UPDATE SET
+			event_id = EXCLUDED.event_id,
+			updated_at = NOW()
+	`, matrixRoomID, eventID)
+	if err != nil {
+		return fmt.Errorf("set pinned announcement: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPinnedAnnouncementStore_SetGet(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewPinnedAnnouncementStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT event_id FROM pinned_announcement WHERE matrix_room_id = $1`)).
+		WithArgs("!room:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}))
+	if id, err := store.Get(ctx, "!room:example.com"); err != nil || id != "" {
+		t.Fatalf("Get before Set = %q, %v", id, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO pinned_announcement`)).
+		WithArgs("!room:example.com", "$announcement").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Set(ctx, "!room:example.com", "$announcement"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pinned_announcement WHERE matrix_room_id = $1`)).
+		WithArgs("!room:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow("$announcement"))
+	if id, err := store.Get(ctx, "!room:example.com"); err != nil || id != "$announcement" {
+		t.Fatalf("Get = %q, %v", id, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ReactionEvent is the Matrix reaction a WeChat emoji reaction was bridged
+// to: the reaction of WeChatUserID with Emoji to the message WeChatMsgID,
+// in MatrixRoomID.
+type ReactionEvent struct {
+	MatrixRoomID  string
+	WeChatMsgID   string
+	WeChatUserID  string
+	Emoji         string
+	MatrixEventID string
+}
+
+// ReactionEventStore persists the Matrix reactions of WeChat emoji
+// reactions, so that they can be redacted when withdrawn.
+type ReactionEventStore struct {
+	db *sql.DB
+}
+
+// NewReactionEventStore creates a ReactionEventStore from an existing sql.DB.
+func NewReactionEventStore(db *sql.DB) *ReactionEventStore {
+	return &ReactionEventStore{db: db}
+}
+
+// Put records a bridged reaction, replacing an earlier one with the same
+// room, message, user and emoji.
+func (s *ReactionEventStore) Put(ctx context.Context, r *ReactionEvent) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO reaction_event (matrix_room_id, wechat_msg_id, wechat_user_id, emoji, matrix_event_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (matrix_room_id, wechat_msg_id, wechat_user_id, emoji) DO UPDATE SET
+			matrix_event_id = EXCLUDED.matrix_event_id,
+			created_at = NOW()
+	`, r.MatrixRoomID, r.WeChatMsgID, r.WeChatUserID, r.Emoji, r.MatrixEventID)
+	if err != nil {
+		return fmt.Errorf("put reaction event: %w", err)
+	}
+	return nil
+}
+
+// Take returns and deletes a bridged reaction, or returns nil if none was
+// recorded.
+func (s *ReactionEventStore) Take(ctx context.Context, roomID, msgID, userID, emoji string) (*ReactionEvent, error) {
+	r := &ReactionEvent{MatrixRoomID: roomID, WeChatMsgID: msgID, WeChatUserID: userID, Emoji: emoji}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT matrix_event_id FROM reaction_event
+		WHERE matrix_room_id = $1 AND wechat_msg_id = $2 AND wechat_user_id = $3 AND emoji = $4
+	`, roomID, msgID, userID, emoji).Scan(&r.MatrixEventID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get reaction event: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM reaction_event
+		WHERE matrix_room_id = $1 AND wechat_msg_id = $2 AND wechat_user_id = $3 AND emoji = $4
+	`, roomID, msgID, userID, emoji)
+	if err != nil {
+		return nil, fmt.Errorf("delete reaction event: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReactionEventStore_PutTake(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewReactionEventStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍", "$reaction").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Put(ctx, &ReactionEvent{
+		MatrixRoomID: "!room:test", WeChatMsgID: "msg1", WeChatUserID: "wxid_bob", Emoji: "👍", MatrixEventID: "$reaction",
+	}); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT matrix_event_id FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id"}).AddRow("$reaction"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	r, err := store.Take(ctx, "!room:test", "msg1", "wxid_bob", "👍")
+	if err != nil {
+		t.Fatalf("Take error: %v", err)
+	}
+	if r == nil || r.MatrixEventID != "$reaction" {
+		t.Fatalf("Take = %+v", r)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT matrix_event_id FROM reaction_event`)).
+		WithArgs("!room:test", "msg1", "wxid_bob", "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"matrix_event_id"}))
+	if r, err := store.Take(ctx, "!room:test", "msg1", "wxid_bob", "👍"); err != nil || r != nil {
+		t.Fatalf("Take of taken reaction = %+v, %v", r, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RiskCounter represents a row in the risk_counter table: one account's
+// risk-control counters for a single day.
+type RiskCounter struct {
+	Account      string
+	CounterDate  time.Time
+	MessageCount int
+	GroupCount   int
+	FriendCount  int
+}
+
+// RiskCounterStore persists daily risk-control counters.
+type RiskCounterStore struct {
+	db *sql.DB
+}
+
+// NewRiskCounterStore creates a RiskCounterStore from an existing sql.DB.
+func NewRiskCounterStore(db *sql.DB) *RiskCounterStore {
+	return &RiskCounterStore{db: db}
+}
+
+// Get returns the saved counters for an account, or nil if none exist.
+func (s *RiskCounterStore) Get(ctx context.Context, account string) (*RiskCounter, error) {
+	c := &RiskCounter{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT account, counter_date, message_count, group_count, friend_count
+		FROM risk_counter WHERE account = $1
+	`, account).Scan(&c.Account, &c.CounterDate, &c.MessageCount, &c.GroupCount, &c.FriendCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get risk counter: %w", err)
+	}
+	return c, nil
+}
+
+// Upsert saves the counters for an account, replacing the previous day's values.
+// The date is stored as a calendar day so it survives time zone conversion.
+func (s *RiskCounterStore) Upsert(ctx context.Context, c *RiskCounter) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO risk_counter (account, counter_date, message_count, group_count, friend_count, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (account) DO UPDATE SET
+			counter_date = EXCLUDED.counter_date,
+			message_count = EXCLUDED.message_count,
+			group_count = EXCLUDED.group_count,
+			friend_count = EXCLUDED.friend_count,
+			updated_at = NOW()
+	`, c.Account, c.CounterDate.Format("2006-01-02"), c.MessageCount, c.GroupCount, c.FriendCount)
+	if err != nil {
+		return fmt.Errorf("upsert risk counter: %w", err)
+	}
+	return nil
+}
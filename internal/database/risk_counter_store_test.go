@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRiskCounterStore_UpsertAndGet(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewRiskCounterStore(db)
+	day := time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO risk_counter`)).
+		WithArgs("ipad", "2024-03-09", 12, 1, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Upsert(context.Background(), &RiskCounter{
+		Account:      "ipad",
+		CounterDate:  day,
+		MessageCount: 12,
+		GroupCount:   1,
+		FriendCount:  2,
+	}); err != nil {
+		t.Fatalf("Upsert error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM risk_counter WHERE account = $1`)).
+		WithArgs("ipad").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account", "counter_date", "message_count", "group_count", "friend_count",
+		}).AddRow("ipad", day, 12, 1, 2))
+	c, err := store.Get(context.Background(), "ipad")
+	if err != nil || c == nil {
+		t.Fatalf("Get error=%v counter=%v", err, c)
+	}
+	if c.MessageCount != 12 || c.GroupCount != 1 || c.FriendCount != 2 {
+		t.Fatalf("unexpected counter: %+v", c)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM risk_counter WHERE account = $1`)).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account", "counter_date", "message_count", "group_count", "friend_count",
+		}))
+	c, err = store.Get(context.Background(), "missing")
+	if err != nil || c != nil {
+		t.Fatalf("expected nil counter for missing account, got %+v err=%v", c, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
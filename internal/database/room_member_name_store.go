@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// RoomMemberNameStore persists per-room display name overrides for puppets.
+type RoomMemberNameStore struct {
+	db *sql.DB
+}
+
+// NewRoomMemberNameStore creates a RoomMemberNameStore from an existing sql.DB.
+func NewRoomMemberNameStore(db *sql.DB) *RoomMemberNameStore {
+	return &RoomMemberNameStore{db: db}
+}
+
+// Set stores the display name of a puppet in a room, replacing any earlier one.
+func (s *RoomMemberNameStore) Set(ctx context.Context, roomID, wechatID, name string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO room_member_name (matrix_room_id, wechat_id, displayname, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (matrix_room_id, wechat_id) DO UPDATE SET
+			displayname = EXCLUDED.displayname,
+			updated_at = NOW()
+	`, roomID, wechatID, name)
+	if err != nil {
+		return fmt.Errorf("set room member name: %w", err)
+	}
+	return nil
+}
+
+// GetByRoom returns the overridden display names in a room, keyed by WeChat ID.
+func (s *RoomMemberNameStore) GetByRoom(ctx context.Context, roomID string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT wechat_id, displayname FROM room_member_name WHERE matrix_room_id = $1`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("query room member names: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var wechatID, name string
+		if err := rows.Scan(&wechatID, &name); err != nil {
+			return nil, fmt.Errorf("scan room member name: %w", err)
+		}
+		names[wechatID] = name
+	}
+	return names, rows.Err()
+}
+
+// Delete removes a puppet's display name override in a room.
+func (s *RoomMemberNameStore) Delete(ctx context.Context, roomID, wechatID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM room_member_name WHERE matrix_room_id = $1 AND wechat_id = $2`, roomID, wechatID)
+	if err != nil {
+		return fmt.Errorf("delete room member name: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRoomMemberNameStore_SetGetDelete(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewRoomMemberNameStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO room_member_name`)).
+		WithArgs("!room:example.com", "wxid_alice", "Alice from work").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Set(ctx, "!room:example.com", "wxid_alice", "Alice from work"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_id, displayname FROM room_member_name WHERE matrix_room_id = $1`)).
+		WithArgs("!room:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_id", "displayname"}).AddRow("wxid_alice", "Alice from work"))
+	names, err := store.GetByRoom(ctx, "!room:example.com")
+	if err != nil || len(names) != 1 || names["wxid_alice"] != "Alice from work" {
+		t.Fatalf("GetByRoom = %v, %v", names, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM room_member_name WHERE matrix_room_id = $1 AND wechat_id = $2`)).
+		WithArgs("!room:example.com", "wxid_alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(ctx, "!room:example.com", "wxid_alice"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -27,6 +27,11 @@ type RoomMappingStore struct {
 	db *sql.DB
 }
 
+// NewRoomMappingStore creates a RoomMappingStore from an existing sql.DB.
+func NewRoomMappingStore(db *sql.DB) *RoomMappingStore {
+	return &RoomMappingStore{db: db}
+}
+
 // Upsert inserts or updates a room mapping.
 func (s *RoomMappingStore) Upsert(ctx context.Context, r *RoomMapping) error {
 	_, err := s.db.ExecContext(ctx, `
@@ -112,6 +117,85 @@ func (s *RoomMappingStore) GetAllForUser(ctx context.Context, bridgeUser string)
 	return rooms, rows.Err()
 }
 
+// ListPage returns up to limit room mappings ordered by Matrix room ID,
+// starting after the given room ID. Pass an empty afterRoomID for the first page.
+func (s *RoomMappingStore) ListPage(ctx context.Context, afterRoomID string, limit int) ([]*RoomMapping, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+roomMappingColumns+` FROM room_mapping WHERE matrix_room_id > $1 ORDER BY matrix_room_id LIMIT $2`,
+		afterRoomID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list rooms: %w", err)
+	}
+	defer rows.Close()
+
+	var rooms []*RoomMapping
+	for rows.Next() {
+		r := &RoomMapping{}
+		if err := scanRoomMapping(rows, r); err != nil {
+			return nil, fmt.Errorf("scan room mapping: %w", err)
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms, rows.Err()
+}
+
+// roomCascadeDeletes remove everything recorded about a room before its
+// mapping, so that foreign keys added later can't be violated midway. A
+// group's members are shared by every bridge user in the group and are
+// only removed together with the last room bridging it.
+// $1 is the Matrix room ID and, for byChat queries, $2 the WeChat chat ID.
+var roomCascadeDeletes = []struct {
+	what   string
+	query  string
+	byChat bool
+}{
+	{"message mappings", "DELETE FROM message_mapping WHERE matrix_room_id = $1", false},
+	{"message states", "DELETE FROM message_state WHERE matrix_room_id = $1", false},
+	{"room member names", "DELETE FROM room_member_name WHERE matrix_room_id = $1", false},
+	{"pinned announcement", "DELETE FROM pinned_announcement WHERE matrix_room_id = $1", false},
+	{"group members", `DELETE FROM group_member WHERE group_id = $2 AND NOT EXISTS (
+		SELECT 1 FROM room_mapping WHERE wechat_chat_id = $2 AND matrix_room_id <> $1)`, true},
+	{"room mapping", "DELETE FROM room_mapping WHERE matrix_room_id = $1", false},
+}
+
+// DeleteWithCascade removes the mapping of a Matrix room together with its
+// message mappings, message states, room member names, pinned announcement
+// and, unless another room still bridges the chat, group members, all in one
+// transaction. It reports false if the room isn't bridged.
+func (s *RoomMappingStore) DeleteWithCascade(ctx context.Context, matrixRoomID string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin room deletion: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var chatID string
+	err = tx.QueryRowContext(ctx,
+		"SELECT wechat_chat_id FROM room_mapping WHERE matrix_room_id = $1", matrixRoomID,
+	).Scan(&chatID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get room mapping for deletion: %w", err)
+	}
+
+	for _, del := range roomCascadeDeletes {
+		args := []interface{}{matrixRoomID}
+		if del.byChat {
+			args = append(args, chatID)
+		}
+		if _, err := tx.ExecContext(ctx, del.query, args...); err != nil {
+			return false, fmt.Errorf("delete %s: %w", del.what, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit room deletion: %w", err)
+	}
+	return true, nil
+}
+
 // Delete removes a room mapping.
 func (s *RoomMappingStore) Delete(ctx context.Context, wechatChatID, bridgeUser string) error {
 	_, err := s.db.ExecContext(ctx,
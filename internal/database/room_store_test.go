@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
@@ -18,7 +19,7 @@ func roomMappingMockRows() *sqlmock.Rows {
 }
 
 func TestRoomMappingStore_CRUD(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -80,6 +81,14 @@ func TestRoomMappingStore_CRUD(t *testing.T) {
 		t.Fatalf("GetAllForUser error=%v rooms=%d", err, len(rooms))
 	}
 
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+roomMappingColumns+` FROM room_mapping WHERE matrix_room_id > $1 ORDER BY matrix_room_id LIMIT $2`)).
+		WithArgs("!a:example.com", 50).
+		WillReturnRows(roomMappingMockRows())
+	rooms, err = store.ListPage(context.Background(), "!a:example.com", 50)
+	if err != nil || len(rooms) != 1 {
+		t.Fatalf("ListPage error=%v rooms=%d", err, len(rooms))
+	}
+
 	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM room_mapping WHERE wechat_chat_id = $1 AND bridge_user = $2")).
 		WithArgs("group1", "@user:example.com").
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -91,3 +100,73 @@ func TestRoomMappingStore_CRUD(t *testing.T) {
 		t.Fatalf("unmet expectations: %v", err)
 	}
 }
+
+func TestRoomMappingStore_DeleteWithCascade(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := &RoomMappingStore{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_chat_id FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!room:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_chat_id"}).AddRow("group1"))
+	for _, table := range []string{"message_mapping", "message_state", "room_member_name", "pinned_announcement"} {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM ` + table + ` WHERE matrix_room_id = $1`)).
+			WithArgs("!room:example.com").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM group_member WHERE group_id = $2 AND NOT EXISTS`)).
+		WithArgs("!room:example.com", "group1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!room:example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if deleted, err := store.DeleteWithCascade(ctx, "!room:example.com"); err != nil || !deleted {
+		t.Fatalf("DeleteWithCascade = %v, %v", deleted, err)
+	}
+
+	// Nothing is deleted for a room that isn't bridged.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_chat_id FROM room_mapping WHERE matrix_room_id = $1`)).
+		WithArgs("!other:example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_chat_id"}))
+	mock.ExpectRollback()
+
+	if deleted, err := store.DeleteWithCascade(ctx, "!other:example.com"); err != nil || deleted {
+		t.Fatalf("DeleteWithCascade of unbridged room = %v, %v", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRoomMappingStore_DeleteWithCascadeRollsBack(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT wechat_chat_id FROM room_mapping WHERE matrix_room_id = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"wechat_chat_id"}).AddRow("group1"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM message_mapping`)).
+		WillReturnError(errors.New("boom"))
+	mock.ExpectRollback()
+
+	store := &RoomMappingStore{db: db}
+	if _, err := store.DeleteWithCascade(context.Background(), "!room:example.com"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
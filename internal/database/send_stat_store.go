@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SendStat represents a row in the send_stat table: how many messages of
+// MsgType a bridge user sent to WeChat with a provider on one day. Date is
+// formatted YYYY-MM-DD; BridgeUser is empty unless the bridge is
+// multi-tenant.
+type SendStat struct {
+	BridgeUser string
+	Provider   string
+	Date       string
+	MsgType    string
+	Count      int
+}
+
+// SendStatStore persists daily counts of the messages sent to WeChat.
+type SendStatStore struct {
+	db *sql.DB
+}
+
+// NewSendStatStore creates a SendStatStore from an existing sql.DB.
+func NewSendStatStore(db *sql.DB) *SendStatStore {
+	return &SendStatStore{db: db}
+}
+
+// Increment counts one message of msgType sent on date.
+func (s *SendStatStore) Increment(ctx context.Context, bridgeUser, provider, date, msgType string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO send_stat (bridge_user, provider, send_date, msg_type, message_count)
+		VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (bridge_user, provider, send_date, msg_type) DO UPDATE SET
+			message_count = send_stat.message_count + 1
+	`, bridgeUser, provider, date, msgType)
+	if err != nil {
+		return fmt.Errorf("increment send stat: %w", err)
+	}
+	return nil
+}
+
+// List returns the counts of a bridge user and provider from date since on,
+// newest day first.
+func (s *SendStatStore) List(ctx context.Context, bridgeUser, provider, since string) ([]*SendStat, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bridge_user, provider, send_date, msg_type, message_count
+		FROM send_stat
+		WHERE bridge_user = $1 AND provider = $2 AND send_date >= $3
+		ORDER BY send_date DESC, msg_type
+	`, bridgeUser, provider, since)
+	if err != nil {
+		return nil, fmt.Errorf("list send stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*SendStat
+	for rows.Next() {
+		st := &SendStat{}
+		if err := rows.Scan(&st.BridgeUser, &st.Provider, &st.Date, &st.MsgType, &st.Count); err != nil {
+			return nil, fmt.Errorf("scan send stat: %w", err)
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// DeleteBefore deletes the counts of days before date.
+func (s *SendStatStore) DeleteBefore(ctx context.Context, date string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM send_stat WHERE send_date < $1`, date)
+	if err != nil {
+		return fmt.Errorf("delete old send stats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSendStatStore_IncrementList(t *testing.T) {
+	db, mock, err := newMock()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewSendStatStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO send_stat`)).
+		WithArgs("@alice:test", "padpro", "2026-03-01", "text").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Increment(ctx, "@alice:test", "padpro", "2026-03-01", "text"); err != nil {
+		t.Fatalf("Increment error: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM send_stat`)).
+		WithArgs("@alice:test", "padpro", "2026-02-24").
+		WillReturnRows(sqlmock.NewRows([]string{"bridge_user", "provider", "send_date", "msg_type", "message_count"}).
+			AddRow("@alice:test", "padpro", "2026-03-01", "image", 1).
+			AddRow("@alice:test", "padpro", "2026-03-01", "text", 3))
+	stats, err := store.List(ctx, "@alice:test", "padpro", "2026-02-24")
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(stats) != 2 || stats[1].MsgType != "text" || stats[1].Count != 3 {
+		t.Fatalf("List = %+v", stats)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM send_stat WHERE send_date < $1`)).
+		WithArgs("2026-02-24").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	if err := store.DeleteBefore(ctx, "2026-02-24"); err != nil {
+		t.Fatalf("DeleteBefore error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
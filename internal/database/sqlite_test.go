@@ -0,0 +1,369 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var sqliteDBs atomic.Int64
+
+// newSQLite returns a migrated in-memory SQLite database, opened the way the
+// bridge opens database.type: sqlite.
+func newSQLite(t *testing.T) *Database {
+	t.Helper()
+	if testDialect != DialectSQLite {
+		t.Skip("runs against a real SQLite engine in the sqlite pass only")
+	}
+	dsn := fmt.Sprintf("file:sqlite_test_%d?mode=memory&cache=shared", sqliteDBs.Add(1))
+	d, err := New("sqlite", dsn, 10, 5)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if err := d.RunMigrations(context.Background()); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return d
+}
+
+func TestSQLite_MigrationsAreIdempotent(t *testing.T) {
+	d := newSQLite(t)
+	if err := d.RunMigrations(context.Background()); err != nil {
+		t.Fatalf("second RunMigrations: %v", err)
+	}
+	var version int
+	if err := d.DB().QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatalf("read schema version: %v", err)
+	}
+	if version != 13 {
+		t.Fatalf("schema version = %d, want 13", version)
+	}
+}
+
+func TestSQLite_RewriteKeepsStringLiterals(t *testing.T) {
+	d := newSQLite(t)
+	var got string
+	if err := d.DB().QueryRow(`SELECT 'costs $1, NOW()' || $1`, "!").Scan(&got); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got != "costs $1, NOW()!" {
+		t.Fatalf("literal = %q, want it unchanged", got)
+	}
+}
+
+func TestSQLite_UserStores(t *testing.T) {
+	d := newSQLite(t)
+	ctx := context.Background()
+
+	if err := d.User.Upsert(ctx, &WeChatUser{WeChatID: "wxid_a", Nickname: "Alice", MatrixUserID: "@wechat_a:test"}); err != nil {
+		t.Fatalf("User.Upsert: %v", err)
+	}
+	if err := d.User.Upsert(ctx, &WeChatUser{WeChatID: "wxid_a", Nickname: "Alice B", MatrixUserID: "@wechat_a:test"}); err != nil {
+		t.Fatalf("User.Upsert (update): %v", err)
+	}
+	if err := d.User.UpdateAvatar(ctx, "wxid_a", "mxc://test/a", true); err != nil {
+		t.Fatalf("User.UpdateAvatar: %v", err)
+	}
+	u, err := d.User.GetByWeChatID(ctx, "wxid_a")
+	if err != nil || u == nil || u.Nickname != "Alice B" || u.AvatarMXC != "mxc://test/a" || u.CreatedAt.IsZero() {
+		t.Fatalf("User.GetByWeChatID = %+v, %v", u, err)
+	}
+	if u, err := d.User.GetByMatrixID(ctx, "@wechat_a:test"); err != nil || u == nil {
+		t.Fatalf("User.GetByMatrixID = %+v, %v", u, err)
+	}
+	if all, err := d.User.GetAll(ctx); err != nil || len(all) != 1 {
+		t.Fatalf("User.GetAll = %d, %v", len(all), err)
+	}
+	if err := d.User.Delete(ctx, "wxid_a"); err != nil {
+		t.Fatalf("User.Delete: %v", err)
+	}
+
+	now := time.Now()
+	if err := d.BridgeUser.Upsert(ctx, &BridgeUser{MatrixUserID: "@alice:test", WeChatID: "wxid_self", ProviderType: "padpro", LastLogin: &now}); err != nil {
+		t.Fatalf("BridgeUser.Upsert: %v", err)
+	}
+	if err := d.BridgeUser.UpdateLoginState(ctx, "@alice:test", 2); err != nil {
+		t.Fatalf("BridgeUser.UpdateLoginState: %v", err)
+	}
+	bu, err := d.BridgeUser.GetByMatrixID(ctx, "@alice:test")
+	if err != nil || bu == nil || bu.LoginState != 2 || bu.LastLogin == nil {
+		t.Fatalf("BridgeUser.GetByMatrixID = %+v, %v", bu, err)
+	}
+	if bu, err := d.BridgeUser.GetByWeChatID(ctx, "wxid_self"); err != nil || bu == nil {
+		t.Fatalf("BridgeUser.GetByWeChatID = %+v, %v", bu, err)
+	}
+	if all, err := d.BridgeUser.GetAll(ctx); err != nil || len(all) != 1 {
+		t.Fatalf("BridgeUser.GetAll = %d, %v", len(all), err)
+	}
+
+	if err := d.DoublePuppet.SetAccessToken(ctx, "@alice:test", "syt_1"); err != nil {
+		t.Fatalf("DoublePuppet.SetAccessToken: %v", err)
+	}
+	if token, err := d.DoublePuppet.GetAccessToken(ctx, "@alice:test"); err != nil || token != "syt_1" {
+		t.Fatalf("DoublePuppet.GetAccessToken = %q, %v", token, err)
+	}
+	if err := d.DoublePuppet.DeleteAccessToken(ctx, "@alice:test"); err != nil {
+		t.Fatalf("DoublePuppet.DeleteAccessToken: %v", err)
+	}
+
+	if err := d.BridgeUser.Delete(ctx, "@alice:test"); err != nil {
+		t.Fatalf("BridgeUser.Delete: %v", err)
+	}
+}
+
+func TestSQLite_RoomAndMessageStores(t *testing.T) {
+	d := newSQLite(t)
+	ctx := context.Background()
+
+	for _, r := range []*RoomMapping{
+		{WeChatChatID: "wxid_b", MatrixRoomID: "!b:test", Name: "Bob"},
+		{WeChatChatID: "123@chatroom", MatrixRoomID: "!g:test", IsGroup: true, Name: "Group"},
+	} {
+		if err := d.RoomMapping.Upsert(ctx, r); err != nil {
+			t.Fatalf("RoomMapping.Upsert: %v", err)
+		}
+	}
+	if r, err := d.RoomMapping.GetByMatrixRoomID(ctx, "!g:test"); err != nil || r == nil || !r.IsGroup || r.CreatedAt.IsZero() {
+		t.Fatalf("RoomMapping.GetByMatrixRoomID = %+v, %v", r, err)
+	}
+	if r, err := d.RoomMapping.GetByWeChatChat(ctx, "wxid_b", ""); err != nil || r == nil {
+		t.Fatalf("RoomMapping.GetByWeChatChat = %+v, %v", r, err)
+	}
+	if rooms, err := d.RoomMapping.GetAllForUser(ctx, ""); err != nil || len(rooms) != 2 {
+		t.Fatalf("RoomMapping.GetAllForUser = %d, %v", len(rooms), err)
+	}
+	if page, err := d.RoomMapping.ListPage(ctx, "", 1); err != nil || len(page) != 1 {
+		t.Fatalf("RoomMapping.ListPage = %d, %v", len(page), err)
+	}
+
+	ts := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := d.MessageMapping.Insert(ctx, &MessageMapping{
+		WeChatMsgID: "msg1", MatrixEventID: "$e1", MatrixRoomID: "!b:test",
+		Sender: "wxid_b", MsgType: 1, Body: "hi", Timestamp: ts,
+	}); err != nil {
+		t.Fatalf("MessageMapping.Insert: %v", err)
+	}
+	m, err := d.MessageMapping.GetByWeChatMsgID(ctx, "msg1", "!b:test")
+	if err != nil || m == nil || m.Body != "hi" || !m.Timestamp.Equal(ts) {
+		t.Fatalf("MessageMapping.GetByWeChatMsgID = %+v, %v", m, err)
+	}
+	if m, err := d.MessageMapping.GetLatestByWeChatMsgID(ctx, "msg1"); err != nil || m == nil {
+		t.Fatalf("MessageMapping.GetLatestByWeChatMsgID = %+v, %v", m, err)
+	}
+	if m, err := d.MessageMapping.GetByWeChatMsgIDAndChat(ctx, "msg1", "wxid_b", ""); err != nil || m == nil {
+		t.Fatalf("MessageMapping.GetByWeChatMsgIDAndChat = %+v, %v", m, err)
+	}
+	if m, err := d.MessageMapping.GetByMatrixEventID(ctx, "$e1"); err != nil || m == nil {
+		t.Fatalf("MessageMapping.GetByMatrixEventID = %+v, %v", m, err)
+	}
+	if last, err := d.MessageMapping.GetLastTimestamp(ctx, "!b:test"); err != nil || last == nil || !last.Equal(ts) {
+		t.Fatalf("MessageMapping.GetLastTimestamp = %v, %v", last, err)
+	}
+	if m, err := d.MessageMapping.GetLastBySender(ctx, "!b:test", "wxid_b"); err != nil || m == nil {
+		t.Fatalf("MessageMapping.GetLastBySender = %+v, %v", m, err)
+	}
+
+	if err := d.MessageState.Set(ctx, "$e1", "!b:test", MessageStateSent, ""); err != nil {
+		t.Fatalf("MessageState.Set: %v", err)
+	}
+	if s, err := d.MessageState.Get(ctx, "$e1"); err != nil || s == nil || s.State != MessageStateSent || s.UpdatedAt.IsZero() {
+		t.Fatalf("MessageState.Get = %+v, %v", s, err)
+	}
+
+	if err := d.RoomMemberName.Set(ctx, "!g:test", "wxid_b", "Bobby"); err != nil {
+		t.Fatalf("RoomMemberName.Set: %v", err)
+	}
+	if names, err := d.RoomMemberName.GetByRoom(ctx, "!g:test"); err != nil || names["wxid_b"] != "Bobby" {
+		t.Fatalf("RoomMemberName.GetByRoom = %v, %v", names, err)
+	}
+	if err := d.RoomMemberName.Delete(ctx, "!g:test", "wxid_b"); err != nil {
+		t.Fatalf("RoomMemberName.Delete: %v", err)
+	}
+
+	if err := d.PinnedAnnouncement.Set(ctx, "!g:test", "$pin"); err != nil {
+		t.Fatalf("PinnedAnnouncement.Set: %v", err)
+	}
+	if id, err := d.PinnedAnnouncement.Get(ctx, "!g:test"); err != nil || id != "$pin" {
+		t.Fatalf("PinnedAnnouncement.Get = %q, %v", id, err)
+	}
+
+	joined := time.Now()
+	if err := d.GroupMember.Upsert(ctx, &GroupMemberRow{GroupID: "123@chatroom", WeChatID: "wxid_b", DisplayName: "Bob", JoinedAt: &joined}); err != nil {
+		t.Fatalf("GroupMember.Upsert: %v", err)
+	}
+	if members, err := d.GroupMember.GetByGroup(ctx, "123@chatroom"); err != nil || len(members) != 1 || members[0].JoinedAt == nil {
+		t.Fatalf("GroupMember.GetByGroup = %+v, %v", members, err)
+	}
+	if n, err := d.GroupMember.CountByGroup(ctx, "123@chatroom"); err != nil || n != 1 {
+		t.Fatalf("GroupMember.CountByGroup = %d, %v", n, err)
+	}
+	if err := d.GroupMember.DeleteMember(ctx, "123@chatroom", "wxid_b"); err != nil {
+		t.Fatalf("GroupMember.DeleteMember: %v", err)
+	}
+	if err := d.GroupMember.DeleteGroup(ctx, "123@chatroom"); err != nil {
+		t.Fatalf("GroupMember.DeleteGroup: %v", err)
+	}
+
+	if deleted, err := d.RoomMapping.DeleteWithCascade(ctx, "!b:test"); err != nil || !deleted {
+		t.Fatalf("RoomMapping.DeleteWithCascade = %v, %v", deleted, err)
+	}
+	if m, err := d.MessageMapping.GetByMatrixEventID(ctx, "$e1"); err != nil || m != nil {
+		t.Fatalf("message mapping survived room deletion: %+v, %v", m, err)
+	}
+	if err := d.MessageMapping.DeleteByRoom(ctx, "!g:test"); err != nil {
+		t.Fatalf("MessageMapping.DeleteByRoom: %v", err)
+	}
+	if err := d.RoomMapping.Delete(ctx, "123@chatroom", ""); err != nil {
+		t.Fatalf("RoomMapping.Delete: %v", err)
+	}
+}
+
+func TestSQLite_ProviderStores(t *testing.T) {
+	d := newSQLite(t)
+	ctx := context.Background()
+
+	if err := d.MediaCache.Put(ctx, &MediaCacheEntry{WeChatMediaID: "m1", MatrixMXC: "mxc://test/m1", MimeType: "image/png", FileSize: 3}); err != nil {
+		t.Fatalf("MediaCache.Put: %v", err)
+	}
+	if e, err := d.MediaCache.Get(ctx, "m1"); err != nil || e == nil || e.MatrixMXC != "mxc://test/m1" || e.CachedAt.IsZero() {
+		t.Fatalf("MediaCache.Get = %+v, %v", e, err)
+	}
+
+	if err := d.ProviderSession.Upsert(ctx, &ProviderSessionRow{
+		BridgeUser: "@alice:test", ProviderType: "ipad", SessionData: json.RawMessage(`{"token":"tok"}`),
+	}); err != nil {
+		t.Fatalf("ProviderSession.Upsert: %v", err)
+	}
+	if s, err := d.ProviderSession.Get(ctx, "@alice:test"); err != nil || s == nil || string(s.SessionData) != `{"token":"tok"}` {
+		t.Fatalf("ProviderSession.Get = %+v, %v", s, err)
+	}
+	if err := d.ProviderSession.Delete(ctx, "@alice:test"); err != nil {
+		t.Fatalf("ProviderSession.Delete: %v", err)
+	}
+
+	if err := d.AuditLog.Log(ctx, &AuditLogEntry{BridgeUser: "@alice:test", Action: "login", ProviderType: "ipad", Details: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("AuditLog.Log: %v", err)
+	}
+	if err := d.AuditLog.Log(ctx, &AuditLogEntry{BridgeUser: "@alice:test", Action: "logout", ProviderType: "ipad"}); err != nil {
+		t.Fatalf("AuditLog.Log without details: %v", err)
+	}
+	if entries, err := d.AuditLog.Recent(ctx, "@alice:test", 10); err != nil || len(entries) != 2 || entries[0].CreatedAt.IsZero() {
+		t.Fatalf("AuditLog.Recent = %+v, %v", entries, err)
+	}
+
+	e, err := d.RateLimit.Increment(ctx, "@alice:test", 1, 0, 2)
+	if err != nil || e == nil || e.MessageCount != 1 || e.APICallCount != 2 {
+		t.Fatalf("RateLimit.Increment = %+v, %v", e, err)
+	}
+	if e, err = d.RateLimit.Increment(ctx, "@alice:test", 1, 1, 0); err != nil || e.MessageCount != 2 || e.MediaCount != 1 {
+		t.Fatalf("RateLimit.Increment (again) = %+v, %v", e, err)
+	}
+	if e, err := d.RateLimit.GetCurrent(ctx, "@alice:test"); err != nil || e == nil || e.MessageCount != 2 {
+		t.Fatalf("RateLimit.GetCurrent = %+v, %v", e, err)
+	}
+	if err := d.RateLimit.Cleanup(ctx, time.Hour); err != nil {
+		t.Fatalf("RateLimit.Cleanup: %v", err)
+	}
+
+	if err := d.NodeAssignment.Upsert(ctx, &NodeAssignment{BridgeUser: "@alice:test", NodeID: "node1"}); err != nil {
+		t.Fatalf("NodeAssignment.Upsert: %v", err)
+	}
+	if err := d.NodeAssignment.UpdateLoginState(ctx, "@alice:test", 2, "wxid_self"); err != nil {
+		t.Fatalf("NodeAssignment.UpdateLoginState: %v", err)
+	}
+	if err := d.NodeAssignment.UpdateLastActive(ctx, "@alice:test"); err != nil {
+		t.Fatalf("NodeAssignment.UpdateLastActive: %v", err)
+	}
+	if a, err := d.NodeAssignment.GetByBridgeUser(ctx, "@alice:test"); err != nil || a == nil || a.WeChatID != "wxid_self" || a.LastActive.IsZero() {
+		t.Fatalf("NodeAssignment.GetByBridgeUser = %+v, %v", a, err)
+	}
+	if n, err := d.NodeAssignment.CountByNodeID(ctx, "node1"); err != nil || n != 1 {
+		t.Fatalf("NodeAssignment.CountByNodeID = %d, %v", n, err)
+	}
+	if all, err := d.NodeAssignment.GetAllByLoginState(ctx, 2); err != nil || len(all) != 1 {
+		t.Fatalf("NodeAssignment.GetAllByLoginState = %d, %v", len(all), err)
+	}
+	if all, err := d.NodeAssignment.GetAll(ctx); err != nil || len(all) != 1 {
+		t.Fatalf("NodeAssignment.GetAll = %d, %v", len(all), err)
+	}
+	if n, err := d.NodeAssignment.DeleteExceptLoginState(ctx, 2); err != nil || n != 0 {
+		t.Fatalf("NodeAssignment.DeleteExceptLoginState = %d, %v", n, err)
+	}
+	if err := d.NodeAssignment.Delete(ctx, "@alice:test"); err != nil {
+		t.Fatalf("NodeAssignment.Delete: %v", err)
+	}
+
+	day := time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local)
+	if err := d.RiskCounter.Upsert(ctx, &RiskCounter{Account: "ipad", CounterDate: day, MessageCount: 12}); err != nil {
+		t.Fatalf("RiskCounter.Upsert: %v", err)
+	}
+	if c, err := d.RiskCounter.Get(ctx, "ipad"); err != nil || c == nil || c.MessageCount != 12 || c.CounterDate.Format("2006-01-02") != "2024-03-09" {
+		t.Fatalf("RiskCounter.Get = %+v, %v", c, err)
+	}
+}
+
+func TestSQLite_BridgeFeatureStores(t *testing.T) {
+	d := newSQLite(t)
+	ctx := context.Background()
+
+	if err := d.FriendRequest.Upsert(ctx, &PendingFriendRequest{BridgeUser: "", WeChatID: "wxid_c", Nickname: "Carol", Content: "hi", XML: "<msg/>", Ticket: "t"}); err != nil {
+		t.Fatalf("FriendRequest.Upsert: %v", err)
+	}
+	if r, err := d.FriendRequest.Get(ctx, "", "wxid_c"); err != nil || r == nil || r.Ticket != "t" || r.ReceivedAt.IsZero() {
+		t.Fatalf("FriendRequest.Get = %+v, %v", r, err)
+	}
+	if all, err := d.FriendRequest.ListByBridgeUser(ctx, ""); err != nil || len(all) != 1 {
+		t.Fatalf("FriendRequest.ListByBridgeUser = %d, %v", len(all), err)
+	}
+	if err := d.FriendRequest.Delete(ctx, "", "wxid_c"); err != nil {
+		t.Fatalf("FriendRequest.Delete: %v", err)
+	}
+
+	if err := d.MomentsCursor.Set(ctx, &MomentsCursor{BridgeUser: "", LastMomentID: "m9", LastTimestamp: 1700000000000}); err != nil {
+		t.Fatalf("MomentsCursor.Set: %v", err)
+	}
+	if c, err := d.MomentsCursor.Get(ctx, ""); err != nil || c == nil || c.LastMomentID != "m9" || c.LastTimestamp != 1700000000000 {
+		t.Fatalf("MomentsCursor.Get = %+v, %v", c, err)
+	}
+
+	if err := d.ChatFilter.Set(ctx, "gh_*", "deny"); err != nil {
+		t.Fatalf("ChatFilter.Set: %v", err)
+	}
+	if entries, err := d.ChatFilter.List(ctx); err != nil || len(entries) != 1 {
+		t.Fatalf("ChatFilter.List = %+v, %v", entries, err)
+	}
+	if ok, err := d.ChatFilter.Delete(ctx, "gh_*"); err != nil || !ok {
+		t.Fatalf("ChatFilter.Delete = %v, %v", ok, err)
+	}
+
+	reaction := &ReactionEvent{MatrixRoomID: "!r:test", WeChatMsgID: "m1", WeChatUserID: "wxid_b", Emoji: "👍", MatrixEventID: "$a"}
+	if err := d.ReactionEvent.Put(ctx, reaction); err != nil {
+		t.Fatalf("ReactionEvent.Put: %v", err)
+	}
+	reaction.MatrixEventID = "$b"
+	if err := d.ReactionEvent.Put(ctx, reaction); err != nil {
+		t.Fatalf("ReactionEvent.Put again: %v", err)
+	}
+	if r, err := d.ReactionEvent.Take(ctx, "!r:test", "m1", "wxid_b", "👍"); err != nil || r == nil || r.MatrixEventID != "$b" {
+		t.Fatalf("ReactionEvent.Take = %+v, %v", r, err)
+	}
+	if r, err := d.ReactionEvent.Take(ctx, "!r:test", "m1", "wxid_b", "👍"); err != nil || r != nil {
+		t.Fatalf("ReactionEvent.Take again = %+v, %v", r, err)
+	}
+
+	for _, date := range []string{"2024-03-01", "2024-03-09", "2024-03-09"} {
+		if err := d.SendStat.Increment(ctx, "", "padpro", date, "text"); err != nil {
+			t.Fatalf("SendStat.Increment: %v", err)
+		}
+	}
+	if err := d.SendStat.DeleteBefore(ctx, "2024-03-03"); err != nil {
+		t.Fatalf("SendStat.DeleteBefore: %v", err)
+	}
+	if stats, err := d.SendStat.List(ctx, "", "padpro", "2024-02-01"); err != nil || len(stats) != 1 || stats[0].Date != "2024-03-09" || stats[0].Count != 2 {
+		t.Fatalf("SendStat.List = %+v, %v", stats, err)
+	}
+}
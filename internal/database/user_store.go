@@ -128,6 +128,18 @@ func (s *UserStore) GetAll(ctx context.Context) ([]*WeChatUser, error) {
 	return users, rows.Err()
 }
 
+// UpdateAvatar records the Matrix avatar state for a WeChat user without
+// touching the rest of the profile.
+func (s *UserStore) UpdateAvatar(ctx context.Context, wechatID, avatarMXC string, avatarSet bool) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wechat_user SET avatar_mxc = $2, avatar_set = $3, updated_at = NOW() WHERE wechat_id = $1`,
+		wechatID, avatarMXC, avatarSet)
+	if err != nil {
+		return fmt.Errorf("update wechat user avatar: %w", err)
+	}
+	return nil
+}
+
 // Delete removes a WeChat user record.
 func (s *UserStore) Delete(ctx context.Context, wechatID string) error {
 	_, err := s.db.ExecContext(ctx, "DELETE FROM wechat_user WHERE wechat_id = $1", wechatID)
@@ -20,7 +20,7 @@ func wechatUserMockRows() *sqlmock.Rows {
 }
 
 func TestUserStore_UpsertAndLookups(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := newMock()
 	if err != nil {
 		t.Fatalf("sqlmock.New: %v", err)
 	}
@@ -98,6 +98,13 @@ func TestUserStore_UpsertAndLookups(t *testing.T) {
 		t.Fatalf("users len = %d, want 1", len(users))
 	}
 
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE wechat_user SET avatar_mxc = $2, avatar_set = $3, updated_at = NOW() WHERE wechat_id = $1`)).
+		WithArgs("wxid_test", "mxc://new", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.UpdateAvatar(context.Background(), "wxid_test", "mxc://new", true); err != nil {
+		t.Fatalf("UpdateAvatar error: %v", err)
+	}
+
 	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM wechat_user WHERE wechat_id = $1")).
 		WithArgs("wxid_test").
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -0,0 +1,56 @@
+package message
+
+import (
+	"bytes"
+	"image"
+	// Register the formats imageDimensions can read.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// imageHeaderLimit is how much of a streamed image is kept for
+// imageDimensions. JPEG puts its size after the EXIF block, which can be
+// tens of kilobytes.
+const imageHeaderLimit = 128 << 10
+
+// imageDimensions returns the width and height of a JPEG, PNG or GIF image
+// from its header. data needn't hold the whole image.
+func imageDimensions(data []byte) (int, int, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// imageInfo builds the info block of an image event, with the image's
+// dimensions when data holds a readable header.
+func imageInfo(mimeType string, size int64, data []byte) map[string]interface{} {
+	info := map[string]interface{}{
+		"mimetype": mimeType,
+		"size":     size,
+	}
+	if w, h, ok := imageDimensions(data); ok {
+		info["w"] = w
+		info["h"] = h
+	}
+	return info
+}
+
+// headBuffer keeps the first limit bytes written to it and discards the
+// rest, so the header of a streamed upload can be inspected afterwards.
+type headBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - len(b.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		b.buf = append(b.buf, p[:n]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,88 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageDimensions(t *testing.T) {
+	for _, format := range []string{"jpeg", "png", "gif"} {
+		w, h, ok := imageDimensions(encodeTestImage(t, format, 40, 30))
+		if !ok || w != 40 || h != 30 {
+			t.Errorf("%s: got %dx%d ok=%v, want 40x30", format, w, h, ok)
+		}
+	}
+	if _, _, ok := imageDimensions([]byte("not an image")); ok {
+		t.Error("expected no dimensions for garbage data")
+	}
+}
+
+func TestProcessor_ImageInfoHasDimensions(t *testing.T) {
+	p := NewProcessor(testLog, &mockMatrixClient{})
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgImage,
+		MediaData: encodeTestImage(t, "png", 64, 48),
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	info := content.Content["info"].(map[string]interface{})
+	if info["w"] != 64 || info["h"] != 48 {
+		t.Fatalf("info: %v", info)
+	}
+}
+
+func TestProcessor_EmojiIsSticker(t *testing.T) {
+	client := &streamingMatrixClient{}
+	p := NewProcessor(testLog, client)
+	p.SetMediaDownloader(&mockMediaDownloader{data: encodeTestImage(t, "gif", 120, 100)})
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:     wechat.MsgEmoji,
+		MediaURL: "https://cdn.example.com/emoji",
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if content.EventType != "m.sticker" {
+		t.Fatalf("event type = %q, want m.sticker", content.EventType)
+	}
+	if _, ok := content.Content["msgtype"]; ok {
+		t.Fatalf("sticker should have no msgtype: %v", content.Content)
+	}
+	if content.Content["url"] != "mxc://test/streamed" || content.Content["body"] != "sticker" {
+		t.Fatalf("content: %v", content.Content)
+	}
+	info := content.Content["info"].(map[string]interface{})
+	if info["w"] != 120 || info["h"] != 100 {
+		t.Fatalf("info: %v", info)
+	}
+}
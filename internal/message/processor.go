@@ -2,12 +2,15 @@ package message
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html"
+	"io"
 	"log/slog"
 	"strings"
 
 	"github.com/n42/mautrix-wechat/internal/bridge"
+	"github.com/n42/mautrix-wechat/internal/voice"
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
@@ -15,6 +18,8 @@ import (
 // The EventRouter provides this based on PuppetManager lookups.
 type MentionResolver interface {
 	// ResolveWeChatMention maps a WeChat nickname to (matrixUserID, displayName).
+	// The bridge user's own nickname should map to their real Matrix ID so
+	// that mentions of them are highlighted.
 	ResolveWeChatMention(nickname string) (matrixID, displayName string)
 	// ResolveMatrixMention maps a Matrix user ID to (wechatID, nickname).
 	ResolveMatrixMention(matrixID string) (wechatID, nickname string)
@@ -26,6 +31,17 @@ type Processor struct {
 	log             *slog.Logger
 	matrixClient    bridge.MatrixClient
 	mentionResolver MentionResolver
+
+	// Fetches media that arrived as a URL instead of inline data
+	mediaDownloader MediaDownloader
+	// Largest media bridged to Matrix in bytes, 0 for no limit
+	maxFileSize int64
+}
+
+// MediaDownloader fetches the media of a message that carries a MediaURL
+// instead of MediaData. wechat.Provider implements it.
+type MediaDownloader interface {
+	DownloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error)
 }
 
 // Ensure Processor implements bridge.MessageProcessor.
@@ -44,6 +60,18 @@ func (p *Processor) SetMentionResolver(resolver MentionResolver) {
 	p.mentionResolver = resolver
 }
 
+// SetMediaDownloader sets where media that is not inline in a message is
+// downloaded from. It is streamed to Matrix when the client supports it.
+func (p *Processor) SetMediaDownloader(d MediaDownloader) {
+	p.mediaDownloader = d
+}
+
+// SetMaxFileSize sets the largest media, in bytes, that is uploaded to
+// Matrix (bridge.media.max_file_size). 0 disables the limit.
+func (p *Processor) SetMaxFileSize(n int64) {
+	p.maxFileSize = n
+}
+
 // WeChatToMatrix converts a WeChat message to Matrix event content.
 func (p *Processor) WeChatToMatrix(ctx context.Context, msg *wechat.Message) (*bridge.MatrixEventContent, error) {
 	switch msg.Type {
@@ -115,13 +143,14 @@ func (p *Processor) convertText(msg *wechat.Message) (*bridge.MatrixEventContent
 
 	// Convert WeChat @mentions to Matrix HTML pills
 	if p.mentionResolver != nil && strings.Contains(msg.Content, "@") {
-		plainText, htmlText, _ := ConvertWeChatMentionsToMatrix(
+		plainText, htmlText, mentioned := ConvertWeChatMentionsToMatrix(
 			msg.Content, p.mentionResolver.ResolveWeChatMention,
 		)
 		if htmlText != "" {
 			content["body"] = plainText
 			content["format"] = "org.matrix.custom.html"
 			content["formatted_body"] = htmlText
+			content["m.mentions"] = map[string]interface{}{"user_ids": mentioned}
 		}
 	}
 
@@ -135,7 +164,7 @@ func (p *Processor) convertText(msg *wechat.Message) (*bridge.MatrixEventContent
 }
 
 func (p *Processor) convertImage(ctx context.Context, msg *wechat.Message) (*bridge.MatrixEventContent, error) {
-	mxcURI, mimeType, err := p.uploadMedia(ctx, msg)
+	mxcURI, info, err := p.uploadImage(ctx, msg)
 	if err != nil {
 		return nil, fmt.Errorf("upload image: %w", err)
 	}
@@ -144,10 +173,7 @@ func (p *Processor) convertImage(ctx context.Context, msg *wechat.Message) (*bri
 		"msgtype": "m.image",
 		"body":    fileNameOrDefault(msg.FileName, "image.jpg"),
 		"url":     mxcURI,
-		"info": map[string]interface{}{
-			"mimetype": mimeType,
-			"size":     msg.FileSize,
-		},
+		"info":    info,
 	}
 
 	return &bridge.MatrixEventContent{
@@ -157,19 +183,34 @@ func (p *Processor) convertImage(ctx context.Context, msg *wechat.Message) (*bri
 }
 
 func (p *Processor) convertVoice(ctx context.Context, msg *wechat.Message) (*bridge.MatrixEventContent, error) {
-	mxcURI, mimeType, err := p.uploadMedia(ctx, msg)
+	if len(msg.MediaData) == 0 {
+		return nil, fmt.Errorf("upload voice: no media data")
+	}
+	if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxFileSize); err != nil {
+		return nil, fmt.Errorf("upload voice: %w", err)
+	}
+
+	data := msg.MediaData
+	mimeType := voice.DetectMimeType(data)
+	durationMs := msg.Duration * 1000 // seconds to ms
+	if durationMs == 0 {
+		durationMs = voice.DurationMs(data, mimeType)
+	}
+	fileName := fileNameOrDefault(msg.FileName, "voice.ogg")
+
+	mxcURI, err := p.uploadData(ctx, data, mimeType, fileName)
 	if err != nil {
 		return nil, fmt.Errorf("upload voice: %w", err)
 	}
 
 	content := map[string]interface{}{
 		"msgtype": "m.audio",
-		"body":    fileNameOrDefault(msg.FileName, "voice.ogg"),
+		"body":    fileName,
 		"url":     mxcURI,
 		"info": map[string]interface{}{
 			"mimetype": mimeType,
-			"duration": msg.Duration * 1000, // seconds to ms
-			"size":     msg.FileSize,
+			"duration": durationMs,
+			"size":     len(data),
 		},
 	}
 
@@ -219,9 +260,21 @@ func (p *Processor) convertVideo(ctx context.Context, msg *wechat.Message) (*bri
 }
 
 func (p *Processor) convertEmoji(ctx context.Context, msg *wechat.Message) (*bridge.MatrixEventContent, error) {
-	// Custom stickers are sent as images
+	// Custom stickers are sent as m.sticker events, which clients render
+	// sticker-sized from the info block's dimensions
 	if len(msg.MediaData) > 0 || msg.MediaURL != "" {
-		return p.convertImage(ctx, msg)
+		mxcURI, info, err := p.uploadImage(ctx, msg)
+		if err != nil {
+			return nil, fmt.Errorf("upload sticker: %w", err)
+		}
+		return &bridge.MatrixEventContent{
+			EventType: "m.sticker",
+			Content: map[string]interface{}{
+				"body": fileNameOrDefault(msg.FileName, "sticker"),
+				"url":  mxcURI,
+				"info": info,
+			},
+		}, nil
 	}
 
 	// Fallback to text emoji
@@ -233,16 +286,30 @@ func (p *Processor) convertLocation(msg *wechat.Message) (*bridge.MatrixEventCon
 		return nil, fmt.Errorf("location info is nil")
 	}
 
-	geoURI := fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude)
 	body := msg.Location.Label
 	if msg.Location.Poiname != "" {
 		body = msg.Location.Poiname + " - " + body
 	}
 
+	// Out-of-range or missing (0,0) coordinates would produce a broken
+	// pin; fall back to the label as text.
+	if !msg.Location.HasValidCoordinates() {
+		if body == "" {
+			body = "[Location]"
+		}
+		return &bridge.MatrixEventContent{
+			EventType: "m.room.message",
+			Content: map[string]interface{}{
+				"msgtype": "m.text",
+				"body":    body,
+			},
+		}, nil
+	}
+
 	content := map[string]interface{}{
 		"msgtype": "m.location",
 		"body":    body,
-		"geo_uri": geoURI,
+		"geo_uri": fmt.Sprintf("geo:%f,%f", msg.Location.Latitude, msg.Location.Longitude),
 	}
 
 	return &bridge.MatrixEventContent{
@@ -368,16 +435,28 @@ func (p *Processor) convertContact(msg *wechat.Message) (*bridge.MatrixEventCont
 // --- Matrix -> WeChat converters ---
 
 func (p *Processor) matrixTextToWeChat(evt *bridge.MatrixEvent) (*bridge.WeChatSendAction, error) {
-	body, _ := evt.Content["body"].(string)
-	action := &bridge.WeChatSendAction{
-		Type: wechat.MsgText,
-		Text: body,
+	content := evt.Content
+	action := &bridge.WeChatSendAction{Type: wechat.MsgText}
+
+	// Edits carry the replacement in m.new_content (EventRouter converts the
+	// edited Matrix event ID to a WeChat msg ID)
+	if relatesTo, ok := evt.Content["m.relates_to"].(map[string]interface{}); ok {
+		if relType, _ := relatesTo["rel_type"].(string); relType == "m.replace" {
+			if newContent, ok := evt.Content["m.new_content"].(map[string]interface{}); ok {
+				content = newContent
+			}
+			action.OriginalMsgID, _ = relatesTo["event_id"].(string)
+			action.IsEdit = action.OriginalMsgID != ""
+		}
 	}
 
+	body, _ := content["body"].(string)
+	action.Text = body
+
 	// Convert Matrix HTML pill @mentions to WeChat @mentions
 	if p.mentionResolver != nil {
-		formattedBody, _ := evt.Content["formatted_body"].(string)
-		format, _ := evt.Content["format"].(string)
+		formattedBody, _ := content["formatted_body"].(string)
+		format, _ := content["format"].(string)
 		if format == "org.matrix.custom.html" && formattedBody != "" {
 			text, mentionedIDs := ConvertMatrixMentionsToWeChat(
 				formattedBody, body, p.mentionResolver.ResolveMatrixMention,
@@ -439,13 +518,19 @@ func (p *Processor) uploadMedia(ctx context.Context, msg *wechat.Message) (strin
 		return "", "", fmt.Errorf("matrix client not configured")
 	}
 	if len(msg.MediaData) == 0 {
+		if msg.MediaURL != "" && p.mediaDownloader != nil {
+			return p.uploadRemoteMedia(ctx, msg)
+		}
 		return "", "", fmt.Errorf("no media data")
 	}
+	if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxFileSize); err != nil {
+		return "", "", err
+	}
 
 	mimeType := guessMimeType(msg)
 	fileName := fileNameOrDefault(msg.FileName, "media")
 
-	mxcURI, err := p.matrixClient.UploadMedia(ctx, msg.MediaData, mimeType, fileName)
+	mxcURI, err := p.uploadData(ctx, msg.MediaData, mimeType, fileName)
 	if err != nil {
 		return "", "", err
 	}
@@ -453,6 +538,95 @@ func (p *Processor) uploadMedia(ctx context.Context, msg *wechat.Message) (strin
 	return mxcURI, mimeType, nil
 }
 
+// uploadImage uploads an image. It returns the event's info block, which has
+// the image's dimensions when its header could be read.
+func (p *Processor) uploadImage(ctx context.Context, msg *wechat.Message) (string, map[string]interface{}, error) {
+	if len(msg.MediaData) == 0 {
+		if p.matrixClient == nil {
+			return "", nil, fmt.Errorf("matrix client not configured")
+		}
+		if msg.MediaURL == "" || p.mediaDownloader == nil {
+			return "", nil, fmt.Errorf("no media data")
+		}
+		mxcURI, mimeType, head, err := p.uploadRemoteMediaHead(ctx, msg)
+		if err != nil {
+			return "", nil, err
+		}
+		return mxcURI, imageInfo(mimeType, msg.FileSize, head), nil
+	}
+	mxcURI, mimeType, err := p.uploadMedia(ctx, msg)
+	if err != nil {
+		return "", nil, err
+	}
+	return mxcURI, imageInfo(mimeType, msg.FileSize, msg.MediaData), nil
+}
+
+// uploadRemoteMedia downloads a message's media from the provider and
+// uploads it to Matrix, streaming it through when the Matrix client supports
+// that. Media over the size limit fails with wechat.ErrMediaTooLarge.
+func (p *Processor) uploadRemoteMedia(ctx context.Context, msg *wechat.Message) (string, string, error) {
+	mxcURI, mimeType, _, err := p.uploadRemoteMediaHead(ctx, msg)
+	return mxcURI, mimeType, err
+}
+
+// uploadRemoteMediaHead is uploadRemoteMedia that also returns the first
+// imageHeaderLimit bytes of the media, for reading image dimensions.
+func (p *Processor) uploadRemoteMediaHead(ctx context.Context, msg *wechat.Message) (string, string, []byte, error) {
+	if err := wechat.CheckMediaSize(msg.FileSize, p.maxFileSize); err != nil {
+		return "", "", nil, err
+	}
+	rc, mimeType, err := p.mediaDownloader.DownloadMedia(ctx, msg)
+	if errors.Is(err, wechat.ErrMediaExpired) {
+		// The URL expired; the provider may still have the media by ID
+		if refetcher, ok := p.mediaDownloader.(wechat.MediaRefetcher); ok {
+			if refetched, refetchedType, refetchErr := refetcher.RefetchMedia(ctx, msg); refetchErr == nil {
+				rc, mimeType, err = refetched, refetchedType, nil
+			} else {
+				p.log.Debug("refetching expired media failed", "error", refetchErr, "msg_id", msg.MsgID)
+			}
+		}
+	}
+	if err != nil {
+		return "", "", nil, fmt.Errorf("download media: %w", err)
+	}
+	body := wechat.LimitMedia(rc, p.maxFileSize)
+	defer body.Close()
+
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = guessMimeType(msg)
+	}
+	fileName := fileNameOrDefault(msg.FileName, "media")
+
+	if uploader, ok := p.matrixClient.(bridge.MediaStreamUploader); ok {
+		head := &headBuffer{limit: imageHeaderLimit}
+		mxcURI, err := uploader.UploadMediaStream(ctx, io.TeeReader(body, head), mimeType, fileName)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return mxcURI, mimeType, head.buf, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("read media: %w", err)
+	}
+	mxcURI, err := p.uploadData(ctx, data, mimeType, fileName)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if len(data) > imageHeaderLimit {
+		data = data[:imageHeaderLimit]
+	}
+	return mxcURI, mimeType, data, nil
+}
+
+func (p *Processor) uploadData(ctx context.Context, data []byte, mimeType, fileName string) (string, error) {
+	if p.matrixClient == nil {
+		return "", fmt.Errorf("matrix client not configured")
+	}
+	return p.matrixClient.UploadMedia(ctx, data, mimeType, fileName)
+}
+
 func fileNameOrDefault(name, fallback string) string {
 	if name != "" {
 		return name
@@ -3,6 +3,8 @@ package message
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -36,10 +38,16 @@ func (m *mockMatrixClient) UploadMedia(_ context.Context, data []byte, mimeType,
 func (m *mockMatrixClient) DownloadMedia(_ context.Context, _ string) (io.ReadCloser, string, error) {
 	return io.NopCloser(bytes.NewReader([]byte("media"))), "application/octet-stream", nil
 }
-func (m *mockMatrixClient) SendMessage(_ context.Context, _, _ string, _ interface{}) (string, error) {
+func (m *mockMatrixClient) MediaExists(_ context.Context, _ string) (bool, error) {
+	return true, nil
+}
+func (m *mockMatrixClient) SendMessage(_ context.Context, _, _, _ string, _ interface{}) (string, error) {
+	return "$event:test", nil
+}
+func (m *mockMatrixClient) SendMessageWithTimestamp(_ context.Context, _, _, _ string, _ interface{}, _ int64) (string, error) {
 	return "$event:test", nil
 }
-func (m *mockMatrixClient) SendMessageWithTimestamp(_ context.Context, _, _ string, _ interface{}, _ int64) (string, error) {
+func (m *mockMatrixClient) SendMessageAs(_ context.Context, _, _, _, _ string, _ interface{}) (string, error) {
 	return "$event:test", nil
 }
 func (m *mockMatrixClient) CreateRoom(_ context.Context, _ *bridge.CreateRoomRequest) (string, error) {
@@ -56,6 +64,18 @@ func (m *mockMatrixClient) SendStateEvent(_ context.Context, _, _, _ string, _ i
 func (m *mockMatrixClient) SetRoomName(_ context.Context, _, _ string) error   { return nil }
 func (m *mockMatrixClient) SetRoomAvatar(_ context.Context, _, _ string) error { return nil }
 func (m *mockMatrixClient) SetRoomTopic(_ context.Context, _, _ string) error  { return nil }
+func (m *mockMatrixClient) PinnedEvents(_ context.Context, _ string) ([]string, error) {
+	return nil, nil
+}
+func (m *mockMatrixClient) SetPinnedEvents(_ context.Context, _ string, _ []string) error {
+	return nil
+}
+func (m *mockMatrixClient) SetRoomMemberName(_ context.Context, _, _, _ string) error {
+	return nil
+}
+func (m *mockMatrixClient) SendReaction(_ context.Context, _, _, _, _ string) (string, error) {
+	return "$reaction", nil
+}
 func (m *mockMatrixClient) SetTyping(_ context.Context, _, _ string, _ bool, _ int) error {
 	return nil
 }
@@ -148,6 +168,31 @@ func TestProcessor_TextMessageWithMentions(t *testing.T) {
 	}
 }
 
+func TestProcessor_TextMessageMentioningSelfSetsMentions(t *testing.T) {
+	p := NewProcessor(testLog, &mockMatrixClient{})
+	p.SetMentionResolver(&mockMentionResolver{
+		wechatToMatrix: map[string][2]string{
+			"Me": {"@user:example.com", "Me"},
+		},
+	})
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID:   "msg004",
+		Type:    wechat.MsgText,
+		Content: "@Me are you coming?",
+		IsGroup: true,
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+
+	mentions, _ := content.Content["m.mentions"].(map[string]interface{})
+	userIDs, _ := mentions["user_ids"].([]string)
+	if len(userIDs) != 1 || userIDs[0] != "@user:example.com" {
+		t.Fatalf("m.mentions = %v, want the bridge user's Matrix ID", content.Content["m.mentions"])
+	}
+}
+
 func TestProcessor_TextMessageWithMentions_NoResolver(t *testing.T) {
 	p := NewProcessor(testLog, &mockMatrixClient{})
 	// No mention resolver set
@@ -169,6 +214,128 @@ func TestProcessor_TextMessageWithMentions_NoResolver(t *testing.T) {
 	}
 }
 
+type streamingMatrixClient struct {
+	mockMatrixClient
+	streamed []byte
+}
+
+func (m *streamingMatrixClient) UploadMediaStream(_ context.Context, r io.Reader, _, _ string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	m.streamed = data
+	return "mxc://test/streamed", nil
+}
+
+type mockMediaDownloader struct {
+	data []byte
+}
+
+func (d *mockMediaDownloader) DownloadMedia(_ context.Context, _ *wechat.Message) (io.ReadCloser, string, error) {
+	return io.NopCloser(bytes.NewReader(d.data)), "image/png", nil
+}
+
+func TestProcessor_RemoteMediaIsStreamed(t *testing.T) {
+	client := &streamingMatrixClient{}
+	p := NewProcessor(testLog, client)
+	p.SetMediaDownloader(&mockMediaDownloader{data: []byte("remote image")})
+	p.SetMaxFileSize(1024)
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:     wechat.MsgImage,
+		MediaURL: "https://cdn.example.com/img",
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if content.Content["url"] != "mxc://test/streamed" {
+		t.Fatalf("url: %v", content.Content["url"])
+	}
+	if string(client.streamed) != "remote image" || len(client.uploaded) != 0 {
+		t.Fatalf("streamed %q, buffered uploads %d", client.streamed, len(client.uploaded))
+	}
+	if info := content.Content["info"].(map[string]interface{}); info["mimetype"] != "image/png" {
+		t.Fatalf("mimetype: %v", info["mimetype"])
+	}
+}
+
+type expiredMediaDownloader struct {
+	refetched []byte
+	refetches int
+}
+
+func (d *expiredMediaDownloader) DownloadMedia(_ context.Context, _ *wechat.Message) (io.ReadCloser, string, error) {
+	return nil, "", fmt.Errorf("download media HTTP 404: %w", wechat.ErrMediaExpired)
+}
+
+func (d *expiredMediaDownloader) RefetchMedia(_ context.Context, _ *wechat.Message) (io.ReadCloser, string, error) {
+	d.refetches++
+	if d.refetched == nil {
+		return nil, "", fmt.Errorf("refetch media: %w", wechat.ErrNotSupported)
+	}
+	return io.NopCloser(bytes.NewReader(d.refetched)), "image/jpeg", nil
+}
+
+func TestProcessor_ExpiredMediaIsRefetched(t *testing.T) {
+	client := &mockMatrixClient{}
+	p := NewProcessor(testLog, client)
+	downloader := &expiredMediaDownloader{refetched: []byte("refetched image")}
+	p.SetMediaDownloader(downloader)
+
+	content, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgImage, MediaURL: "https://cdn.example.com/expired",
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if downloader.refetches != 1 || len(client.uploaded) != 1 || string(client.uploaded[0].data) != "refetched image" {
+		t.Fatalf("refetches %d, uploads %+v", downloader.refetches, client.uploaded)
+	}
+	if content.Content["url"] != "mxc://test/uploaded" {
+		t.Fatalf("url: %v", content.Content["url"])
+	}
+}
+
+func TestProcessor_ExpiredMediaRefetchFails(t *testing.T) {
+	p := NewProcessor(testLog, &mockMatrixClient{})
+	downloader := &expiredMediaDownloader{}
+	p.SetMediaDownloader(downloader)
+
+	_, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		MsgID: "m1", Type: wechat.MsgFile, MediaURL: "https://cdn.example.com/expired",
+	})
+	if !errors.Is(err, wechat.ErrMediaExpired) || downloader.refetches != 1 {
+		t.Fatalf("error = %v after %d refetches, want ErrMediaExpired after one", err, downloader.refetches)
+	}
+}
+
+func TestProcessor_MediaOverSizeLimit(t *testing.T) {
+	client := &mockMatrixClient{}
+	p := NewProcessor(testLog, client)
+	p.SetMediaDownloader(&mockMediaDownloader{data: bytes.Repeat([]byte("x"), 100)})
+	p.SetMaxFileSize(10)
+
+	_, err := p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:      wechat.MsgFile,
+		MediaData: bytes.Repeat([]byte("x"), 11),
+	})
+	if !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("inline media error = %v, want ErrMediaTooLarge", err)
+	}
+
+	_, err = p.WeChatToMatrix(context.Background(), &wechat.Message{
+		Type:     wechat.MsgFile,
+		MediaURL: "https://cdn.example.com/file",
+	})
+	if !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("remote media error = %v, want ErrMediaTooLarge", err)
+	}
+	if len(client.uploaded) != 0 {
+		t.Fatalf("oversized media was uploaded %d times", len(client.uploaded))
+	}
+}
+
 func TestProcessor_ImageMessage(t *testing.T) {
 	client := &mockMatrixClient{}
 	p := NewProcessor(testLog, client)
@@ -252,6 +419,33 @@ func TestProcessor_LocationMessage(t *testing.T) {
 	}
 }
 
+func TestProcessor_LocationMessageInvalidCoordinates(t *testing.T) {
+	p := NewProcessor(testLog, &mockMatrixClient{})
+
+	tests := []struct {
+		name     string
+		location *wechat.LocationInfo
+		wantBody string
+	}{
+		{"zero", &wechat.LocationInfo{Label: "Beijing, China", Poiname: "Tiananmen Square"}, "Tiananmen Square - Beijing, China"},
+		{"latitude out of range", &wechat.LocationInfo{Latitude: -120, Longitude: 116.4074, Label: "Beijing, China"}, "Beijing, China"},
+		{"longitude out of range", &wechat.LocationInfo{Latitude: 39.9042, Longitude: 360}, "[Location]"},
+	}
+	for _, tc := range tests {
+		msg := &wechat.Message{MsgID: "msg006", Type: wechat.MsgLocation, Location: tc.location}
+		content, err := p.WeChatToMatrix(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("%s: convert: %v", tc.name, err)
+		}
+		if content.Content["msgtype"] != "m.text" {
+			t.Errorf("%s: msgtype: %v", tc.name, content.Content["msgtype"])
+		}
+		if content.Content["body"] != tc.wantBody {
+			t.Errorf("%s: body = %v, want %q", tc.name, content.Content["body"], tc.wantBody)
+		}
+	}
+}
+
 func TestProcessor_LinkMessage(t *testing.T) {
 	p := NewProcessor(testLog, &mockMatrixClient{})
 
@@ -492,6 +686,40 @@ func TestProcessor_MatrixTextToWeChat_WithReplyTo(t *testing.T) {
 	}
 }
 
+func TestProcessor_MatrixTextToWeChat_Edit(t *testing.T) {
+	p := NewProcessor(testLog, &mockMatrixClient{})
+
+	evt := &bridge.MatrixEvent{
+		ID:     "$evt004",
+		Type:   "m.room.message",
+		RoomID: "!room:test",
+		Sender: "@user:test",
+		Content: map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    "* corrected",
+			"m.new_content": map[string]interface{}{
+				"msgtype": "m.text",
+				"body":    "corrected",
+			},
+			"m.relates_to": map[string]interface{}{
+				"rel_type": "m.replace",
+				"event_id": "$original_event",
+			},
+		},
+	}
+
+	action, err := p.MatrixToWeChat(context.Background(), evt)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if !action.IsEdit || action.OriginalMsgID != "$original_event" {
+		t.Fatalf("edit: %v %s", action.IsEdit, action.OriginalMsgID)
+	}
+	if action.Text != "corrected" {
+		t.Fatalf("text: %s", action.Text)
+	}
+}
+
 func TestProcessor_MatrixImageToWeChat(t *testing.T) {
 	p := NewProcessor(testLog, &mockMatrixClient{})
 
@@ -17,6 +17,10 @@ import (
 type CallbackHandler struct {
 	log     *slog.Logger
 	handler wechat.MessageHandler
+
+	// onSessionEnded, when set, is called before a login_status callback
+	// reporting that WeChat ended the session is passed to the handler.
+	onSessionEnded func(evt *wechat.LoginEvent)
 }
 
 // NewCallbackHandler creates a new callback handler.
@@ -71,6 +75,8 @@ func (ch *CallbackHandler) dispatch(ctx context.Context, payload map[string]inte
 		ch.handleGroupMemberUpdate(ctx, payload)
 	case "friend_request":
 		ch.handleFriendRequest(ctx, payload)
+	case "contact_added":
+		ch.handleContactAdded(ctx, payload)
 	case "revoke":
 		ch.handleRevoke(ctx, payload)
 	case "typing":
@@ -158,39 +164,57 @@ func (ch *CallbackHandler) handleGroupMemberUpdate(ctx context.Context, data map
 
 // handleFriendRequest processes incoming friend requests.
 func (ch *CallbackHandler) handleFriendRequest(ctx context.Context, data map[string]interface{}) {
-	fromUser, _ := data["from_user"].(string)
-	content, _ := data["content"].(string)
-
-	ch.log.Info("friend request received", "from", fromUser, "content", content)
-
-	// Emit as a contact update with pending status
-	contact := &wechat.ContactInfo{
-		UserID:   fromUser,
-		Nickname: fromUser,
+	req := &wechat.FriendRequest{}
+	req.FromUser, _ = data["from_user"].(string)
+	req.Content, _ = data["content"].(string)
+	req.XML, _ = data["xml"].(string)
+	req.Ticket, _ = data["ticket"].(string)
+	req.Nickname, _ = data["nickname"].(string)
+	if req.FromUser == "" {
+		return
 	}
-	if nickname, ok := data["nickname"].(string); ok {
-		contact.Nickname = nickname
+	if req.Nickname == "" {
+		req.Nickname = req.FromUser
 	}
-	if avatarURL, ok := data["avatar_url"].(string); ok {
-		contact.AvatarURL = avatarURL
+	// Older API versions send the request XML as the content
+	if req.XML == "" && strings.HasPrefix(strings.TrimSpace(req.Content), "<") {
+		req.XML = req.Content
 	}
 
-	if err := ch.handler.OnContactUpdate(ctx, contact); err != nil {
+	ch.log.Info("friend request received", "from", req.FromUser, "content", req.Content)
+
+	if err := ch.handler.OnFriendRequest(ctx, req); err != nil {
 		ch.log.Error("handle friend request failed", "error", err)
 	}
 }
 
+// handleContactAdded processes contacts added without a friend request,
+// e.g. after they scanned the account's QR code.
+func (ch *CallbackHandler) handleContactAdded(ctx context.Context, data map[string]interface{}) {
+	contact := ch.parseContact(data)
+	if contact == nil {
+		return
+	}
+
+	ch.log.Info("contact added", "user_id", contact.UserID)
+
+	if err := ch.handler.OnContactAdded(ctx, contact); err != nil {
+		ch.log.Error("handle contact added failed", "error", err, "user_id", contact.UserID)
+	}
+}
+
 // handleRevoke processes message revocation events.
 func (ch *CallbackHandler) handleRevoke(ctx context.Context, data map[string]interface{}) {
+	chatID, _ := data["chat_id"].(string)
 	msgID, _ := data["msg_id"].(string)
 	replaceTip, _ := data["replace_tip"].(string)
 	if msgID == "" {
 		return
 	}
 
-	ch.log.Debug("message revoke", "msg_id", msgID)
+	ch.log.Debug("message revoke", "msg_id", msgID, "chat_id", chatID)
 
-	if err := ch.handler.OnRevoke(ctx, msgID, replaceTip); err != nil {
+	if err := ch.handler.OnRevoke(ctx, chatID, msgID, replaceTip); err != nil {
 		ch.log.Error("handle revoke failed", "error", err, "msg_id", msgID)
 	}
 }
@@ -242,6 +266,11 @@ func (ch *CallbackHandler) handleLoginStatus(ctx context.Context, data map[strin
 	case -1:
 		evt.State = wechat.LoginStateError
 		evt.Error, _ = data["error"].(string)
+	case loginStatusEnded:
+		evt = loginEndedEvent(data)
+		if ch.onSessionEnded != nil {
+			ch.onSessionEnded(evt)
+		}
 	default:
 		ch.log.Warn("unknown login status", "status", int(statusCode))
 		return
@@ -305,10 +334,15 @@ func (ch *CallbackHandler) parseMessage(data map[string]interface{}) *wechat.Mes
 	if isGroup, ok := data["is_group"].(bool); ok {
 		msg.IsGroup = isGroup
 	}
-	// Infer group message from GroupID
+	// Infer group message from GroupID, or from a group ID reported as the
+	// sender, in which case the member wxid is prefixed to the content.
+	if msg.GroupID == "" && wechat.IsGroupID(msg.FromUser) {
+		msg.GroupID = msg.FromUser
+	}
 	if msg.GroupID != "" {
 		msg.IsGroup = true
 	}
+	wechat.ExtractGroupSender(msg)
 
 	// Location
 	if lat, ok := data["latitude"].(float64); ok {
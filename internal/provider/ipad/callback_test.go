@@ -23,6 +23,8 @@ type testHandler struct {
 	revokes  []revokeEvent
 	typings  []typingEvent
 	presence []presenceEvent
+	friends  []*wechat.FriendRequest
+	added    []*wechat.ContactInfo
 }
 
 type groupMemberUpdate struct {
@@ -31,6 +33,7 @@ type groupMemberUpdate struct {
 }
 
 type revokeEvent struct {
+	ChatID     string
 	MsgID      string
 	ReplaceTip string
 }
@@ -69,8 +72,24 @@ func (h *testHandler) OnTyping(_ context.Context, userID string, chatID string)
 	h.typings = append(h.typings, typingEvent{UserID: userID, ChatID: chatID})
 	return nil
 }
-func (h *testHandler) OnRevoke(_ context.Context, msgID string, replaceTip string) error {
-	h.revokes = append(h.revokes, revokeEvent{MsgID: msgID, ReplaceTip: replaceTip})
+func (h *testHandler) OnRevoke(_ context.Context, chatID, msgID, replaceTip string) error {
+	h.revokes = append(h.revokes, revokeEvent{ChatID: chatID, MsgID: msgID, ReplaceTip: replaceTip})
+	return nil
+}
+
+func (h *testHandler) OnFriendRequest(_ context.Context, req *wechat.FriendRequest) error {
+	h.friends = append(h.friends, req)
+	return nil
+}
+
+func (h *testHandler) OnSendAck(context.Context, string) error { return nil }
+
+func (h *testHandler) OnMessageReaction(context.Context, *wechat.MessageReaction) error {
+	return nil
+}
+
+func (h *testHandler) OnContactAdded(_ context.Context, c *wechat.ContactInfo) error {
+	h.added = append(h.added, c)
 	return nil
 }
 
@@ -223,6 +242,30 @@ func TestCallbackHandler_GroupMessage(t *testing.T) {
 	}
 }
 
+func TestCallbackHandler_GroupMessageSenderPrefix(t *testing.T) {
+	h := &testHandler{}
+	ch := NewCallbackHandler(testCallbackLog, h)
+
+	postCallback(ch, map[string]interface{}{
+		"type":      "message",
+		"msg_id":    "msg_005",
+		"msg_type":  float64(1),
+		"from_user": "12345678@chatroom",
+		"content":   "wxid_sender:\nGroup hello",
+	})
+
+	if len(h.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(h.messages))
+	}
+	msg := h.messages[0]
+	if !msg.IsGroup || msg.GroupID != "12345678@chatroom" {
+		t.Fatalf("group flags wrong: %+v", msg)
+	}
+	if msg.FromUser != "wxid_sender" || msg.Content != "Group hello" {
+		t.Fatalf("sender/content = %q, %q", msg.FromUser, msg.Content)
+	}
+}
+
 func TestCallbackHandler_LinkMessage(t *testing.T) {
 	h := &testHandler{}
 	ch := NewCallbackHandler(testCallbackLog, h)
@@ -351,6 +394,7 @@ func TestCallbackHandler_Revoke(t *testing.T) {
 
 	postCallback(ch, map[string]interface{}{
 		"type":        "revoke",
+		"chat_id":     "wxid_friend",
 		"msg_id":      "msg_to_revoke",
 		"replace_tip": "Message has been recalled",
 	})
@@ -362,6 +406,9 @@ func TestCallbackHandler_Revoke(t *testing.T) {
 	if h.revokes[0].MsgID != "msg_to_revoke" {
 		t.Fatalf("msg_id: %s", h.revokes[0].MsgID)
 	}
+	if h.revokes[0].ChatID != "wxid_friend" {
+		t.Fatalf("chat_id: %s", h.revokes[0].ChatID)
+	}
 	if h.revokes[0].ReplaceTip != "Message has been recalled" {
 		t.Fatalf("replace_tip: %s", h.revokes[0].ReplaceTip)
 	}
@@ -436,6 +483,29 @@ func TestCallbackHandler_LoginStatus(t *testing.T) {
 	}
 }
 
+func TestCallbackHandler_LoginStatusEnded(t *testing.T) {
+	h := &testHandler{}
+	ch := NewCallbackHandler(testCallbackLog, h)
+	var ended *wechat.LoginEvent
+	ch.onSessionEnded = func(evt *wechat.LoginEvent) { ended = evt }
+
+	postCallback(ch, map[string]interface{}{
+		"type":   "login_status",
+		"status": float64(4),
+		"error":  "logged in on another device",
+	})
+
+	if len(h.logins) != 1 {
+		t.Fatalf("expected 1 login event, got %d", len(h.logins))
+	}
+	if evt := h.logins[0]; evt.State != wechat.LoginStateLoggedOut || evt.Error != "logged in on another device" {
+		t.Fatalf("unexpected login event: %+v", evt)
+	}
+	if ended != h.logins[0] {
+		t.Fatal("onSessionEnded not called with the login event")
+	}
+}
+
 func TestCallbackHandler_MethodNotAllowed(t *testing.T) {
 	h := &testHandler{}
 	ch := NewCallbackHandler(testCallbackLog, h)
@@ -520,18 +590,44 @@ func TestCallbackHandler_FriendRequest(t *testing.T) {
 		"nickname":   "Stranger",
 		"avatar_url": "https://example.com/stranger.jpg",
 		"content":    "Hi, I want to be friends",
+		"xml":        `<msg fromusername="wxid_stranger" encryptusername="v3_enc" ticket="v4_ticket"/>`,
+		"ticket":     "v4_ticket",
 	})
 
-	if len(h.contacts) != 1 {
-		t.Fatalf("expected 1 contact, got %d", len(h.contacts))
+	if len(h.friends) != 1 {
+		t.Fatalf("expected 1 friend request, got %d", len(h.friends))
+	}
+	if len(h.contacts) != 0 {
+		t.Fatalf("a pending request should not be a contact update: %v", h.contacts)
 	}
 
-	c := h.contacts[0]
-	if c.UserID != "wxid_stranger" {
-		t.Fatalf("user_id: %s", c.UserID)
+	req := h.friends[0]
+	if req.FromUser != "wxid_stranger" || req.Nickname != "Stranger" {
+		t.Fatalf("request from %s (%s)", req.FromUser, req.Nickname)
 	}
-	if c.Nickname != "Stranger" {
-		t.Fatalf("nickname: %s", c.Nickname)
+	if req.Content != "Hi, I want to be friends" || req.Ticket != "v4_ticket" {
+		t.Fatalf("content %q ticket %q", req.Content, req.Ticket)
+	}
+	if !strings.Contains(req.XML, `encryptusername="v3_enc"`) {
+		t.Fatalf("xml: %s", req.XML)
+	}
+}
+
+func TestCallbackHandler_ContactAdded(t *testing.T) {
+	h := &testHandler{}
+	ch := NewCallbackHandler(testCallbackLog, h)
+
+	postCallback(ch, map[string]interface{}{
+		"type":     "contact_added",
+		"user_id":  "wxid_scanner",
+		"nickname": "Scanner",
+	})
+
+	if len(h.added) != 1 || h.added[0].UserID != "wxid_scanner" || h.added[0].Nickname != "Scanner" {
+		t.Fatalf("added = %+v, want wxid_scanner", h.added)
+	}
+	if len(h.friends) != 0 || len(h.contacts) != 0 {
+		t.Fatalf("friends = %v, contacts = %v; want only the added contact", h.friends, h.contacts)
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -42,7 +43,6 @@ type Provider struct {
 	riskControl     *RiskControl
 	reconnector     *Reconnector
 	callbackHandler *CallbackHandler
-	voiceConverter  *VoiceConverter
 }
 
 // --- Lifecycle ---
@@ -50,7 +50,7 @@ type Provider struct {
 func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandler) error {
 	p.cfg = cfg
 	p.handler = handler
-	p.client = &http.Client{Timeout: 30 * time.Second}
+	p.client = &http.Client{Timeout: p.httpTimeout()}
 	p.stopCh = make(chan struct{})
 	p.log = slog.Default().With("provider", "ipad")
 
@@ -82,16 +82,7 @@ func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandle
 		p.log.With("component", "callback"),
 		handler,
 	)
-
-	// Initialize voice converter (optional — graceful degradation if ffmpeg missing)
-	vc, err := NewVoiceConverter("")
-	if err != nil {
-		p.log.Warn("voice converter not available, silk transcoding disabled", "error", err)
-	} else {
-		p.voiceConverter = vc
-		p.log.Info("voice converter initialized",
-			"can_encode", vc.CanEncode())
-	}
+	p.callbackHandler.onSessionEnded = p.endSession
 
 	return nil
 }
@@ -163,7 +154,7 @@ func (p *Provider) IsRunning() bool {
 func (p *Provider) Name() string { return "ipad" }
 func (p *Provider) Tier() int    { return 2 }
 func (p *Provider) Capabilities() wechat.Capability {
-	return wechat.Capability{
+	return p.cfg.OverrideCapabilities(wechat.Capability{
 		SendText:       true,
 		SendImage:      true,
 		SendVideo:      true,
@@ -182,7 +173,7 @@ func (p *Provider) Capabilities() wechat.Capability {
 		Reaction:       false,
 		ReadReceipt:    false,
 		Typing:         false,
-	}
+	})
 }
 
 // --- Authentication ---
@@ -230,10 +221,46 @@ func (p *Provider) Login(ctx context.Context) error {
 	return nil
 }
 
+// RestoreSession resumes the session GeWeChat still holds, so a restarted
+// bridge doesn't request a QR code and sign the phone out. A resumed session
+// is reported with the same LoginEvent as a QR login.
+func (p *Provider) RestoreSession(ctx context.Context) (bool, error) {
+	resp, err := p.apiCall(ctx, "/login/reconnect", p.reconnectPayload(ctx))
+	if err != nil {
+		return false, fmt.Errorf("restore session: %w", err)
+	}
+	status, _ := resp["status"].(float64)
+	userID, _ := resp["user_id"].(string)
+	if int(status) != 3 || userID == "" {
+		return false, nil
+	}
+	name, _ := resp["nickname"].(string)
+	avatar, _ := resp["avatar"].(string)
+
+	p.mu.Lock()
+	p.loginState = wechat.LoginStateLoggedIn
+	p.self = &wechat.ContactInfo{UserID: userID, Nickname: name, AvatarURL: avatar}
+	p.mu.Unlock()
+	p.reconnector.MarkConnected()
+
+	if p.handler != nil {
+		p.handler.OnLoginEvent(ctx, &wechat.LoginEvent{
+			State:  wechat.LoginStateLoggedIn,
+			UserID: userID,
+			Name:   name,
+			Avatar: avatar,
+		})
+	}
+	p.saveSession(ctx, resp)
+	p.log.Info("restored session", "user_id", userID)
+	return true, nil
+}
+
 func (p *Provider) Logout(ctx context.Context) error {
 	_, err := p.apiCall(ctx, "/login/logout", nil)
 	p.setLoginState(wechat.LoginStateLoggedOut)
 	p.self = nil
+	p.forgetSession(ctx)
 	p.reconnector.MarkDisconnected()
 	return err
 }
@@ -256,6 +283,7 @@ func (p *Provider) SendText(ctx context.Context, toUser string, text string) (st
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
 	resp, err := p.apiCall(ctx, "/message/send/text", map[string]interface{}{
 		"to_user": toUser,
@@ -272,8 +300,9 @@ func (p *Provider) SendImage(ctx context.Context, toUser string, data io.Reader,
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	body, err := io.ReadAll(data)
+	body, err := wechat.ReadMedia(data, p.maxMediaSize())
 	if err != nil {
 		return "", fmt.Errorf("read image data: %w", err)
 	}
@@ -293,8 +322,9 @@ func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader,
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	body, err := io.ReadAll(data)
+	body, err := wechat.ReadMedia(data, p.maxMediaSize())
 	if err != nil {
 		return "", fmt.Errorf("read video data: %w", err)
 	}
@@ -304,7 +334,7 @@ func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader,
 		"filename": filename,
 	}
 	if thumb != nil {
-		thumbData, err := io.ReadAll(thumb)
+		thumbData, err := wechat.ReadMedia(thumb, p.maxMediaSize())
 		if err != nil {
 			return "", fmt.Errorf("read video thumbnail: %w", err)
 		}
@@ -318,26 +348,19 @@ func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader,
 	return msgID, nil
 }
 
+// SendVoice sends voice data as received; the bridge converts Matrix audio
+// to silk first when media.voice_converter is enabled.
 func (p *Provider) SendVoice(ctx context.Context, toUser string, data io.Reader, duration int) (string, error) {
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	body, err := io.ReadAll(data)
+	body, err := wechat.ReadMedia(data, p.maxMediaSize())
 	if err != nil {
 		return "", fmt.Errorf("read voice data: %w", err)
 	}
 
-	// Convert ogg/opus to silk if voice converter is available
-	if p.voiceConverter != nil && p.voiceConverter.CanEncode() {
-		silkData, convErr := p.voiceConverter.OggToSilk(bytes.NewReader(body))
-		if convErr == nil {
-			body = silkData
-		} else {
-			p.log.Warn("voice conversion failed, sending original", "error", convErr)
-		}
-	}
-
 	resp, err := p.apiCall(ctx, "/message/send/voice", map[string]interface{}{
 		"to_user":  toUser,
 		"data":     body,
@@ -354,8 +377,9 @@ func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader,
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	body, err := io.ReadAll(data)
+	body, err := wechat.ReadMedia(data, p.maxMediaSize())
 	if err != nil {
 		return "", fmt.Errorf("read file data: %w", err)
 	}
@@ -375,6 +399,7 @@ func (p *Provider) SendLocation(ctx context.Context, toUser string, loc *wechat.
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
 	resp, err := p.apiCall(ctx, "/message/send/location", map[string]interface{}{
 		"to_user":   toUser,
@@ -394,6 +419,7 @@ func (p *Provider) SendLink(ctx context.Context, toUser string, link *wechat.Lin
 	if err := p.checkMessageRisk(); err != nil {
 		return "", err
 	}
+	defer p.observeSend(time.Now())
 
 	resp, err := p.apiCall(ctx, "/message/send/link", map[string]interface{}{
 		"to_user":     toUser,
@@ -417,6 +443,21 @@ func (p *Provider) RevokeMessage(ctx context.Context, msgID string, toUser strin
 	return err
 }
 
+// SendPat is not supported by the iPad protocol API.
+func (p *Provider) SendPat(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("ipad: pats %w", wechat.ErrNotSupported)
+}
+
+func (p *Provider) MarkRead(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("ipad: read receipts %w", wechat.ErrNotSupported)
+}
+
+// SendTyping is a no-op: the iPad protocol API only reports the typing of
+// others.
+func (p *Provider) SendTyping(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
 // --- Contacts ---
 
 func (p *Provider) GetContactList(ctx context.Context) ([]*wechat.ContactInfo, error) {
@@ -479,7 +520,7 @@ func (p *Provider) GetUserAvatar(ctx context.Context, userID string) ([]byte, st
 
 func (p *Provider) AcceptFriendRequest(ctx context.Context, xml string) error {
 	if !p.riskControl.CheckFriendOperation() {
-		return fmt.Errorf("friend operation rate limit exceeded")
+		return fmt.Errorf("friend operation %w", wechat.ErrRateLimited)
 	}
 
 	_, err := p.apiCall(ctx, "/contact/accept", map[string]interface{}{
@@ -528,7 +569,7 @@ func (p *Provider) GetGroupInfo(ctx context.Context, groupID string) (*wechat.Co
 
 func (p *Provider) CreateGroup(ctx context.Context, name string, members []string) (string, error) {
 	if !p.riskControl.CheckGroupOperation() {
-		return "", fmt.Errorf("group operation rate limit exceeded")
+		return "", fmt.Errorf("group operation %w", wechat.ErrRateLimited)
 	}
 
 	resp, err := p.apiCall(ctx, "/group/create", map[string]interface{}{
@@ -544,7 +585,7 @@ func (p *Provider) CreateGroup(ctx context.Context, name string, members []strin
 
 func (p *Provider) InviteToGroup(ctx context.Context, groupID string, userIDs []string) error {
 	if !p.riskControl.CheckGroupOperation() {
-		return fmt.Errorf("group operation rate limit exceeded")
+		return fmt.Errorf("group operation %w", wechat.ErrRateLimited)
 	}
 
 	_, err := p.apiCall(ctx, "/group/invite", map[string]interface{}{
@@ -585,36 +626,97 @@ func (p *Provider) LeaveGroup(ctx context.Context, groupID string) error {
 	return err
 }
 
+// RespondGroupInvite is not supported by the iPad protocol API.
+func (p *Provider) RespondGroupInvite(_ context.Context, _ *wechat.GroupInvite, _ bool) error {
+	return fmt.Errorf("ipad: group invites %w", wechat.ErrNotSupported)
+}
+
 // --- Media ---
 
 func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
 	if len(msg.MediaData) > 0 {
+		if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxMediaSize()); err != nil {
+			return nil, "", err
+		}
 		return io.NopCloser(bytes.NewReader(msg.MediaData)), "application/octet-stream", nil
 	}
 
 	if msg.MediaURL != "" {
-		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, msg.MediaURL, nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("create media request: %w", err)
-		}
-		resp, err := p.client.Do(httpReq)
-		if err != nil {
-			return nil, "", fmt.Errorf("download media: %w", err)
-		}
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			resp.Body.Close()
-			return nil, "", fmt.Errorf("download media HTTP %d", resp.StatusCode)
-		}
-		mimeType := resp.Header.Get("Content-Type")
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
-		}
-		return resp.Body, mimeType, nil
+		return p.downloadMediaURL(ctx, msg.MediaURL)
 	}
 
 	return nil, "", fmt.Errorf("no media available")
 }
 
+func (p *Provider) downloadMediaURL(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create media request: %w", err)
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("download media: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		if wechat.IsMediaExpiredStatus(resp.StatusCode) {
+			return nil, "", fmt.Errorf("download media HTTP %d: %w", resp.StatusCode, wechat.ErrMediaExpired)
+		}
+		return nil, "", fmt.Errorf("download media HTTP %d", resp.StatusCode)
+	}
+	if err := wechat.CheckMediaSize(resp.ContentLength, p.maxMediaSize()); err != nil {
+		resp.Body.Close()
+		return nil, "", err
+	}
+	mimeType := resp.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return wechat.LimitMedia(resp.Body, p.maxMediaSize()), mimeType, nil
+}
+
+// RefetchMedia downloads a message's media by message ID, for when its
+// media URL has expired. The API answers 404 or 410 for messages whose media
+// it no longer has, which fails with wechat.ErrMediaExpired.
+func (p *Provider) RefetchMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
+	if msg.MsgID == "" {
+		return nil, "", fmt.Errorf("refetch media: no message ID: %w", wechat.ErrMediaExpired)
+	}
+	resp, err := p.apiCall(ctx, "/message/download", map[string]interface{}{
+		"msg_id": msg.MsgID,
+	})
+	if status := wechat.HTTPStatus(err); status == http.StatusNotFound || status == http.StatusGone {
+		return nil, "", fmt.Errorf("media of message %s is no longer available on WeChat: %w", msg.MsgID, wechat.ErrMediaExpired)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("refetch media: %w", err)
+	}
+	encoded, _ := resp["data"].(string)
+	if encoded == "" {
+		return nil, "", fmt.Errorf("refetch media: %w", wechat.ErrMediaExpired)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode refetched media: %w", err)
+	}
+	if err := wechat.CheckMediaSize(int64(len(data)), p.maxMediaSize()); err != nil {
+		return nil, "", err
+	}
+	mimeType, _ := resp["mime_type"].(string)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return io.NopCloser(bytes.NewReader(data)), mimeType, nil
+}
+
+// maxMediaSize returns the configured media size limit, 0 meaning none.
+func (p *Provider) maxMediaSize() int64 {
+	if p.cfg == nil {
+		return 0
+	}
+	return p.cfg.MaxMediaSize
+}
+
 // --- Internal: Risk Control ---
 
 // checkMessageRisk validates the message against risk control and applies required delay.
@@ -622,11 +724,14 @@ func (p *Provider) checkMessageRisk() error {
 	delay, allowed := p.riskControl.CheckMessage()
 	if !allowed {
 		if p.riskControl.IsInSilencePeriod() {
-			return fmt.Errorf("account is in silence period (new account protection)")
+			return fmt.Errorf("account is in silence period (new account protection): %w", wechat.ErrRateLimited)
 		}
-		return fmt.Errorf("daily message limit reached (%d remaining)", p.riskControl.RemainingMessages())
+		return fmt.Errorf("daily message limit reached (%d remaining): %w", p.riskControl.RemainingMessages(), wechat.ErrRateLimited)
 	}
 
+	if p.cfg.Sends != nil {
+		p.cfg.Sends.ObserveRiskControlDelay(delay)
+	}
 	if delay > 0 {
 		p.log.Debug("risk control delay", "delay", delay)
 		time.Sleep(delay)
@@ -635,9 +740,30 @@ func (p *Provider) checkMessageRisk() error {
 	return nil
 }
 
+// observeSend reports the duration of a send started at start, after its
+// risk-control delay, to the send observer.
+func (p *Provider) observeSend(start time.Time) {
+	if p.cfg.Sends != nil {
+		p.cfg.Sends.ObserveWeChatSend(time.Since(start))
+	}
+}
+
+// httpTimeout returns the API request timeout from http_timeout_s, defaulting to 30s.
+func (p *Provider) httpTimeout() time.Duration {
+	if v, ok := p.cfg.Extra["http_timeout_s"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 30 * time.Second
+}
+
 // buildRiskControlConfig creates a RiskControlConfig from provider configuration.
 func (p *Provider) buildRiskControlConfig() RiskControlConfig {
-	cfg := RiskControlConfig{}
+	cfg := RiskControlConfig{
+		Store:    p.cfg.RiskCounters,
+		StoreKey: "ipad",
+	}
 
 	if p.cfg.Extra != nil {
 		if v, ok := p.cfg.Extra["max_messages_per_day"]; ok {
@@ -688,15 +814,24 @@ func (p *Provider) doReconnect(ctx context.Context) error {
 	p.log.Info("attempting to reconnect to GeWeChat")
 
 	// Try to restore session via API
-	resp, err := p.apiCall(ctx, "/login/reconnect", nil)
+	resp, err := p.apiCall(ctx, "/login/reconnect", p.reconnectPayload(ctx))
 	if err != nil {
 		return fmt.Errorf("reconnect api call: %w", err)
 	}
 
 	status, _ := resp["status"].(float64)
+	if int(status) == loginStatusEnded {
+		evt := loginEndedEvent(resp)
+		p.endSession(evt)
+		if p.handler != nil {
+			p.handler.OnLoginEvent(ctx, evt)
+		}
+		return fmt.Errorf("reconnect: %w (%s)", errLoginEnded, evt.State)
+	}
 	if int(status) != 3 {
 		return fmt.Errorf("reconnect returned status %d, expected 3", int(status))
 	}
+	p.saveSession(ctx, resp)
 
 	// Update self info if available
 	if userID, ok := resp["user_id"].(string); ok && userID != "" {
@@ -716,6 +851,73 @@ func (p *Provider) doReconnect(ctx context.Context) error {
 	return nil
 }
 
+// ipadSession is the session the provider persists through cfg.Sessions.
+type ipadSession struct {
+	SessionToken string `json:"session_token"`
+}
+
+// sessionStoreTimeout bounds a single load or save of the session.
+const sessionStoreTimeout = 5 * time.Second
+
+// reconnectPayload returns the /login/reconnect payload: the session token
+// GeWeChat handed out at the last login, if one was saved, so it can resume
+// a session it no longer holds, e.g. after GeWeChat restarted as well.
+func (p *Provider) reconnectPayload(ctx context.Context) map[string]interface{} {
+	if p.cfg.Sessions == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	data, err := p.cfg.Sessions.LoadSession(ctx)
+	if err != nil {
+		p.log.Warn("failed to load session", "error", err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	var sess ipadSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		p.log.Warn("ignoring unreadable saved session", "error", err)
+		return nil
+	}
+	if sess.SessionToken == "" {
+		return nil
+	}
+	return map[string]interface{}{"session_token": sess.SessionToken}
+}
+
+// saveSession persists the session token of a login or reconnect response,
+// if it has one.
+func (p *Provider) saveSession(ctx context.Context, resp map[string]interface{}) {
+	token, _ := resp["session_token"].(string)
+	if token == "" || p.cfg.Sessions == nil {
+		return
+	}
+	data, err := json.Marshal(ipadSession{SessionToken: token})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	if err := p.cfg.Sessions.SaveSession(ctx, data); err != nil {
+		p.log.Warn("failed to save session", "error", err)
+	}
+}
+
+// forgetSession deletes the saved session, so the next start needs a new
+// login.
+func (p *Provider) forgetSession(ctx context.Context) {
+	if p.cfg.Sessions == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	if err := p.cfg.Sessions.DeleteSession(ctx); err != nil {
+		p.log.Warn("failed to delete session", "error", err)
+	}
+}
+
 // --- Internal: API & Callback ---
 
 // apiCall makes an HTTP API call to the GeWeChat service.
@@ -742,18 +944,26 @@ func (p *Provider) apiCall(ctx context.Context, path string, payload map[string]
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("api call %s: %w", path, err)
+		return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("api call %s: %w", path, err))
 	}
 	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response from %s: %w", path, err)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response from %s: %w", path, err)
 	}
 
+	var result map[string]interface{}
 	if resp.StatusCode != http.StatusOK {
-		errMsg, _ := result["error"].(string)
-		return nil, fmt.Errorf("api %s returned %d: %s", path, resp.StatusCode, errMsg)
+		// Error pages of the server's router aren't JSON
+		errMsg := string(data)
+		if json.Unmarshal(data, &result) == nil {
+			errMsg, _ = result["error"].(string)
+		}
+		return nil, wechat.WrapHTTPStatus(resp.StatusCode, data, fmt.Errorf("api %s returned %d: %s", path, resp.StatusCode, errMsg))
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("decode response from %s: %w", path, err)
 	}
 
 	return result, nil
@@ -818,6 +1028,15 @@ func (p *Provider) pollLoginStatus(ctx context.Context, stopCh chan struct{}) {
 						Avatar: avatar,
 					})
 				}
+				// Saved once the login event linked the account to its bridge user
+				p.saveSession(ctx, resp)
+				return
+			case loginStatusEnded:
+				evt := loginEndedEvent(resp)
+				p.endSession(evt)
+				if p.handler != nil {
+					p.handler.OnLoginEvent(ctx, evt)
+				}
 				return
 			case -1: // error / expired
 				errMsg, _ := resp["error"].(string)
@@ -829,11 +1048,46 @@ func (p *Provider) pollLoginStatus(ctx context.Context, stopCh chan struct{}) {
 					})
 				}
 				return
+			default:
+				p.log.Warn("unknown login status", "status", int(statusCode))
 			}
 		}
 	}
 }
 
+// loginStatusEnded is the status GeWeChat reports, both when polled and in
+// login_status callbacks, once WeChat has ended the session itself: the
+// account logged in on another device, or it was banned.
+const loginStatusEnded = 4
+
+// errLoginEnded is returned by doReconnect when WeChat has ended the session.
+// Reconnecting can't restore it, so the reconnector stops retrying.
+var errLoginEnded = errors.New("wechat ended the session")
+
+// loginEndedEvent builds the login event for a loginStatusEnded payload. The
+// session is banned when the payload says so and logged out otherwise, with
+// GeWeChat's explanation as the event error.
+func loginEndedEvent(data map[string]interface{}) *wechat.LoginEvent {
+	evt := &wechat.LoginEvent{State: wechat.LoginStateLoggedOut}
+	evt.Error, _ = data["error"].(string)
+	if banned, _ := data["banned"].(bool); banned {
+		evt.State = wechat.LoginStateBanned
+	}
+	return evt
+}
+
+// endSession records that WeChat ended the session, as described by evt, and
+// keeps the reconnector from retrying until the next successful login.
+func (p *Provider) endSession(evt *wechat.LoginEvent) {
+	p.log.Warn("wechat ended the session", "state", evt.State, "reason", evt.Error)
+	p.mu.Lock()
+	p.loginState = evt.State
+	p.self = nil
+	p.mu.Unlock()
+	p.reconnector.MarkEnded()
+	p.forgetSession(context.Background())
+}
+
 // prepareCallbackServer binds the HTTP server used to receive GeWeChat callbacks.
 func (p *Provider) prepareCallbackServer() error {
 	mux := http.NewServeMux()
@@ -889,6 +1143,11 @@ func (p *Provider) GetRiskControlStats() (messages, groups, friends int) {
 	return p.riskControl.GetStats()
 }
 
+// RiskLimits implements wechat.RiskLimitReporter.
+func (p *Provider) RiskLimits() []wechat.RiskLimit {
+	return p.riskControl.Limits()
+}
+
 // GetReconnectStats returns reconnection statistics.
 func (p *Provider) GetReconnectStats() ReconnectStats {
 	return p.reconnector.Stats()
@@ -915,6 +1174,7 @@ func parseContact(data map[string]interface{}) (*wechat.ContactInfo, error) {
 	if mc, ok := data["member_count"].(float64); ok {
 		c.MemberCount = int(mc)
 	}
+	c.Announcement, _ = data["announcement"].(string)
 	return c, nil
 }
 
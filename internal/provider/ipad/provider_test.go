@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -45,9 +46,22 @@ func (h *loginCaptureHandler) OnContactUpdate(context.Context, *wechat.ContactIn
 func (h *loginCaptureHandler) OnGroupMemberUpdate(context.Context, string, []*wechat.GroupMember) error {
 	return nil
 }
-func (h *loginCaptureHandler) OnPresence(context.Context, string, bool) error { return nil }
-func (h *loginCaptureHandler) OnTyping(context.Context, string, string) error { return nil }
-func (h *loginCaptureHandler) OnRevoke(context.Context, string, string) error { return nil }
+func (h *loginCaptureHandler) OnPresence(context.Context, string, bool) error         { return nil }
+func (h *loginCaptureHandler) OnTyping(context.Context, string, string) error         { return nil }
+func (h *loginCaptureHandler) OnRevoke(context.Context, string, string, string) error { return nil }
+func (h *loginCaptureHandler) OnFriendRequest(context.Context, *wechat.FriendRequest) error {
+	return nil
+}
+
+func (h *loginCaptureHandler) OnSendAck(context.Context, string) error { return nil }
+
+func (h *loginCaptureHandler) OnMessageReaction(context.Context, *wechat.MessageReaction) error {
+	return nil
+}
+
+func (h *loginCaptureHandler) OnContactAdded(context.Context, *wechat.ContactInfo) error {
+	return nil
+}
 
 func (h *loginCaptureHandler) OnLoginEvent(_ context.Context, evt *wechat.LoginEvent) error {
 	copyEvt := *evt
@@ -232,6 +246,199 @@ func TestProvider_Login_DecodesQRCodeAndCompletesLogin(t *testing.T) {
 	}
 }
 
+func TestProvider_RestoreSession(t *testing.T) {
+	status := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login/reconnect" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"status":%d,"user_id":"wxid_self","nickname":"Bridge Bot"}`, status)
+	}))
+	defer server.Close()
+
+	handler := newLoginCaptureHandler()
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL}, handler); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	if restored, err := p.RestoreSession(context.Background()); err != nil || restored {
+		t.Fatalf("RestoreSession while logged out = %v, %v", restored, err)
+	}
+
+	status = 3
+	if restored, err := p.RestoreSession(context.Background()); err != nil || !restored {
+		t.Fatalf("RestoreSession = %v, %v", restored, err)
+	}
+	if p.GetLoginState() != wechat.LoginStateLoggedIn {
+		t.Fatalf("login state = %v", p.GetLoginState())
+	}
+	if self := p.GetSelf(); self == nil || self.UserID != "wxid_self" || self.Nickname != "Bridge Bot" {
+		t.Fatalf("unexpected self: %+v", self)
+	}
+	// The bridge hears of the restored session like of a QR login
+	if len(handler.logins) != 1 || handler.logins[0].State != wechat.LoginStateLoggedIn ||
+		handler.logins[0].UserID != "wxid_self" || handler.logins[0].Name != "Bridge Bot" {
+		t.Fatalf("login events = %+v, want one logged-in event", handler.logins)
+	}
+}
+
+// memorySessionStore is an in-memory wechat.SessionStore that outlives the
+// providers created against it.
+type memorySessionStore struct {
+	mu   sync.Mutex
+	data json.RawMessage
+}
+
+func (s *memorySessionStore) LoadSession(context.Context) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func (s *memorySessionStore) SaveSession(_ context.Context, data json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+func (s *memorySessionStore) DeleteSession(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = nil
+	return nil
+}
+
+func TestProvider_SessionTokenResumesSessionAfterRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/qrcode":
+			_, _ = w.Write([]byte(`{"qr_url":"https://example.com/scan"}`))
+		case "/login/status":
+			_, _ = w.Write([]byte(`{"status":2,"user_id":"wxid_self","nickname":"Bridge Bot","session_token":"tok-1"}`))
+		case "/login/reconnect":
+			// GeWeChat only resumes the session it is given the token of
+			var payload map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			if payload["session_token"] != "tok-1" {
+				_, _ = w.Write([]byte(`{"status":0}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":3,"user_id":"wxid_self","nickname":"Bridge Bot"}`))
+		case "/login/logout":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := &memorySessionStore{}
+	newProvider := func(handler wechat.MessageHandler) *Provider {
+		p := &Provider{}
+		if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL, Sessions: store}, handler); err != nil {
+			t.Fatalf("init: %v", err)
+		}
+		return p
+	}
+
+	handler := newLoginCaptureHandler()
+	p := newProvider(handler)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Login(ctx); err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+	if handler.waitForState(wechat.LoginStateLoggedIn, 3*time.Second) == nil {
+		t.Fatal("expected logged-in event")
+	}
+	if data, _ := store.LoadSession(ctx); string(data) != `{"session_token":"tok-1"}` {
+		t.Fatalf("saved session = %s, want the token", data)
+	}
+
+	// A restarted bridge resumes the session with the saved token
+	restarted := newProvider(newLoginCaptureHandler())
+	if restored, err := restarted.RestoreSession(ctx); err != nil || !restored {
+		t.Fatalf("RestoreSession after restart = %v, %v", restored, err)
+	}
+	if self := restarted.GetSelf(); self == nil || self.UserID != "wxid_self" {
+		t.Fatalf("unexpected self: %+v", self)
+	}
+
+	// Logging out forgets the token, so the next start needs a new login
+	if err := restarted.Logout(ctx); err != nil {
+		t.Fatalf("Logout error: %v", err)
+	}
+	if data, _ := store.LoadSession(ctx); data != nil {
+		t.Fatalf("session after logout = %s, want none", data)
+	}
+	if restored, err := newProvider(newLoginCaptureHandler()).RestoreSession(ctx); err != nil || restored {
+		t.Fatalf("RestoreSession after logout = %v, %v", restored, err)
+	}
+}
+
+func TestProvider_Login_BannedStopsReconnecting(t *testing.T) {
+	handler := newLoginCaptureHandler()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/qrcode":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"qr_url":"https://example.com/scan"}`))
+		case "/login/status":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status":4,"banned":true,"error":"account frozen"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL}, handler); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.Login(ctx); err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+
+	banned := handler.waitForState(wechat.LoginStateBanned, 3*time.Second)
+	if banned == nil {
+		t.Fatal("expected banned login event")
+	}
+	if banned.Error != "account frozen" {
+		t.Fatalf("banned reason = %q", banned.Error)
+	}
+	if p.GetLoginState() != wechat.LoginStateBanned {
+		t.Fatalf("login state = %v", p.GetLoginState())
+	}
+	p.reconnector.mu.Lock()
+	state := p.reconnector.state
+	p.reconnector.mu.Unlock()
+	if state != stateEnded {
+		t.Fatalf("reconnector state = %v, want stateEnded", state)
+	}
+}
+
+func TestLoginEndedEvent(t *testing.T) {
+	evt := loginEndedEvent(map[string]interface{}{"status": float64(4), "error": "logged in on another device"})
+	if evt.State != wechat.LoginStateLoggedOut || evt.Error != "logged in on another device" {
+		t.Fatalf("kicked event = %+v", evt)
+	}
+	evt = loginEndedEvent(map[string]interface{}{"status": float64(4), "banned": true})
+	if evt.State != wechat.LoginStateBanned {
+		t.Fatalf("banned event state = %v", evt.State)
+	}
+}
+
 func TestProvider_SendImageAndFile_IncludePayload(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -287,6 +494,30 @@ func TestProvider_SendImageAndFile_IncludePayload(t *testing.T) {
 	}
 }
 
+func TestProvider_Init_HTTPTimeout(t *testing.T) {
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: "http://127.0.0.1:1",
+		Extra:       map[string]string{"http_timeout_s": "45"},
+	}, nil); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if p.client.Timeout != 45*time.Second {
+		t.Errorf("client timeout = %v, want 45s", p.client.Timeout)
+	}
+
+	p = &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: "http://127.0.0.1:1",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if p.client.Timeout != 30*time.Second {
+		t.Errorf("default client timeout = %v, want 30s", p.client.Timeout)
+	}
+}
+
 func TestProvider_SendVideo_ReadThumbnailError(t *testing.T) {
 	p := &Provider{}
 	if err := p.Init(&wechat.ProviderConfig{
@@ -465,6 +696,118 @@ func TestProvider_DownloadMedia_PrefersEmbeddedBytesOverBrokenURL(t *testing.T)
 	}
 }
 
+func TestProvider_DownloadMedia_EnforcesSizeLimit(t *testing.T) {
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint:  "http://127.0.0.1:1",
+		MaxMediaSize: 8,
+		Extra:        map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	p.client = &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        make(http.Header),
+				ContentLength: -1,
+				Body:          io.NopCloser(strings.NewReader("much-too-large-media")),
+			}, nil
+		}),
+	}
+
+	reader, _, err := p.DownloadMedia(context.Background(), &wechat.Message{MediaURL: "http://media.local/big"})
+	if err != nil {
+		t.Fatalf("DownloadMedia error: %v", err)
+	}
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("read error = %v, want ErrMediaTooLarge", err)
+	}
+
+	if _, _, err := p.DownloadMedia(context.Background(), &wechat.Message{MediaData: []byte("embedded-too-large")}); !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("embedded media error = %v, want ErrMediaTooLarge", err)
+	}
+}
+
+func TestProvider_DownloadMedia_ExpiredURLAndRefetch(t *testing.T) {
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: "http://api.local",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	var refetchBody string
+	p.client = &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/message/download" {
+				body, _ := io.ReadAll(req.Body)
+				refetchBody = string(body)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader(`{"data":"cmVmZXRjaGVk","mime_type":"image/jpeg"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusGone,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader("gone")),
+			}, nil
+		}),
+	}
+
+	msg := &wechat.Message{MsgID: "m42", MediaURL: "http://media.local/expired"}
+	if _, _, err := p.DownloadMedia(context.Background(), msg); !errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("DownloadMedia error = %v, want ErrMediaExpired", err)
+	}
+
+	reader, mimeType, err := p.RefetchMedia(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("RefetchMedia: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "refetched" || mimeType != "image/jpeg" {
+		t.Fatalf("refetched %q %s", data, mimeType)
+	}
+	if !strings.Contains(refetchBody, `"msg_id":"m42"`) {
+		t.Fatalf("refetch request body %s", refetchBody)
+	}
+}
+
+func TestProvider_RefetchMedia_GoneMessage(t *testing.T) {
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: "http://api.local",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	status := http.StatusNotFound
+	p.client = &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(`{"error":"message not found"}`)),
+			}, nil
+		}),
+	}
+
+	msg := &wechat.Message{MsgID: "m42", MediaURL: "http://media.local/expired"}
+	if _, _, err := p.RefetchMedia(context.Background(), msg); !errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("RefetchMedia error = %v, want ErrMediaExpired", err)
+	}
+
+	status = http.StatusBadGateway
+	_, _, err := p.RefetchMedia(context.Background(), msg)
+	if err == nil || errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("RefetchMedia error = %v, want a temporary failure", err)
+	}
+}
+
 func TestProvider_GetUserAvatar_RejectsHTTPError(t *testing.T) {
 	var serverURL string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -3,6 +3,7 @@ package ipad
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math"
 	"sync"
@@ -43,6 +44,7 @@ const (
 	stateDisconnected
 	stateReconnecting
 	stateStopped
+	stateEnded // WeChat ended the session; waiting for a new login
 )
 
 // ReconnectorConfig holds configuration for the reconnector.
@@ -129,6 +131,22 @@ func (r *Reconnector) MarkConnected() {
 	r.reconnectCount = 0
 }
 
+// MarkEnded marks the session as ended by WeChat, for example because the
+// account was banned. Reconnecting can't restore such a session, so no
+// attempts are made until MarkConnected is called after a new login.
+func (r *Reconnector) MarkEnded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == stateStopped {
+		return
+	}
+	if r.state == stateConnected {
+		r.lastDisconnected = time.Now()
+	}
+	r.state = stateEnded
+}
+
 // MarkDisconnected marks the connection as lost.
 func (r *Reconnector) MarkDisconnected() {
 	r.mu.Lock()
@@ -192,7 +210,7 @@ func (r *Reconnector) checkAndReconnect(stopCh chan struct{}) {
 	state := r.state
 	r.mu.Unlock()
 
-	if state == stateStopped || state == stateReconnecting {
+	if state == stateStopped || state == stateReconnecting || state == stateEnded {
 		return
 	}
 
@@ -215,7 +233,7 @@ func (r *Reconnector) checkAndReconnect(stopCh chan struct{}) {
 // reconnectWithBackoff attempts to reconnect with exponential backoff.
 func (r *Reconnector) reconnectWithBackoff(stopCh chan struct{}) {
 	r.mu.Lock()
-	if r.state == stateReconnecting || r.state == stateStopped {
+	if r.state == stateReconnecting || r.state == stateStopped || r.state == stateEnded {
 		r.mu.Unlock()
 		return
 	}
@@ -261,6 +279,13 @@ func (r *Reconnector) reconnectWithBackoff(stopCh chan struct{}) {
 			return
 		}
 
+		if errors.Is(err, errLoginEnded) {
+			r.log.Error("session ended by wechat, giving up reconnecting",
+				"attempt", attempt+1, "error", err)
+			r.MarkEnded()
+			return
+		}
+
 		r.log.Error("reconnection failed",
 			"attempt", attempt+1, "error", err)
 		attempt++
@@ -257,6 +257,51 @@ func TestReconnector_ReconnectWithRetry(t *testing.T) {
 	}
 }
 
+func TestReconnector_StopsWhenSessionEnded(t *testing.T) {
+	var attempts atomic.Int32
+
+	r := NewReconnector(ReconnectorConfig{
+		Log:               testReconnectLog,
+		HeartbeatInterval: 10 * time.Millisecond,
+		BaseBackoff:       5 * time.Millisecond,
+		MaxBackoff:        20 * time.Millisecond,
+		DoReconnect: func(ctx context.Context) error {
+			attempts.Add(1)
+			return fmt.Errorf("reconnect: %w", errLoginEnded)
+		},
+	})
+	r.Start()
+	defer r.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("reconnect attempts = %d, want 1", n)
+	}
+	if r.IsConnected() {
+		t.Fatal("should not be connected after the session ended")
+	}
+
+	// A new login resumes health checks.
+	r.MarkConnected()
+	if !r.IsConnected() {
+		t.Fatal("MarkConnected should leave the ended state")
+	}
+}
+
+func TestReconnector_MarkEndedAfterStop(t *testing.T) {
+	r := NewReconnector(ReconnectorConfig{Log: testReconnectLog})
+	r.Start()
+	r.Stop()
+	r.MarkEnded()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != stateStopped {
+		t.Fatalf("state = %v, want stateStopped", r.state)
+	}
+}
+
 func TestSessionData_Marshal(t *testing.T) {
 	sd := &SessionData{
 		UserID:    "wxid_test123",
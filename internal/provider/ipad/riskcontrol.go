@@ -1,11 +1,18 @@
 package ipad
 
 import (
+	"context"
+	"log/slog"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
+// riskCounterSaveTimeout bounds a single load or save of persisted counters.
+const riskCounterSaveTimeout = 5 * time.Second
+
 // RiskControl enforces anti-ban policies for iPad protocol accounts.
 // It tracks daily counters and enforces delays between operations
 // to mimic natural human behavior.
@@ -27,6 +34,22 @@ type RiskControl struct {
 	groupCount    int
 	friendCount   int
 	lastMessageAt time.Time
+
+	// Optional persistence so a restart does not reset the daily counters.
+	// Counters are snapshotted under mu and written after it is released;
+	// saveMu orders the writes so an older snapshot never overwrites a newer.
+	store     wechat.RiskCounterStore
+	storeKey  string
+	saveMu    sync.Mutex
+	snapshots uint64
+	savedSeq  uint64
+	log       *slog.Logger
+}
+
+// riskCounterSnapshot is a copy of the daily counters taken under mu.
+type riskCounterSnapshot struct {
+	seq      uint64
+	counters wechat.RiskCounters
 }
 
 // RiskControlConfig holds risk control configuration.
@@ -38,6 +61,10 @@ type RiskControlConfig struct {
 	MessageIntervalMs     int
 	RandomDelay           bool
 	AccountCreatedAt      time.Time
+
+	// Store, if set, persists the daily counters under StoreKey.
+	Store    wechat.RiskCounterStore
+	StoreKey string
 }
 
 // NewRiskControl creates a new risk control engine.
@@ -62,7 +89,7 @@ func NewRiskControl(cfg RiskControlConfig) *RiskControl {
 		cfg.AccountCreatedAt = time.Now().AddDate(-1, 0, 0)
 	}
 
-	return &RiskControl{
+	rc := &RiskControl{
 		newAccountSilenceDays: cfg.NewAccountSilenceDays,
 		maxMessagesPerDay:     cfg.MaxMessagesPerDay,
 		maxGroupsPerDay:       cfg.MaxGroupsPerDay,
@@ -71,24 +98,30 @@ func NewRiskControl(cfg RiskControlConfig) *RiskControl {
 		randomDelay:           cfg.RandomDelay,
 		accountCreatedAt:      cfg.AccountCreatedAt,
 		counterDate:           today(),
+		store:                 cfg.Store,
+		storeKey:              cfg.StoreKey,
+		log:                   slog.Default().With("provider", "ipad", "component", "risk_control"),
 	}
+	rc.load()
+	return rc
 }
 
 // CheckMessage checks if sending a message is allowed and returns the
 // required delay before sending. Returns (delay, allowed).
 func (rc *RiskControl) CheckMessage() (time.Duration, bool) {
 	rc.mu.Lock()
-	defer rc.mu.Unlock()
 
 	rc.resetIfNewDay()
 
 	// Check silence period for new accounts
 	if rc.isInSilencePeriod() {
+		rc.mu.Unlock()
 		return 0, false
 	}
 
 	// Check daily limit
 	if rc.messageCount >= rc.maxMessagesPerDay {
+		rc.mu.Unlock()
 		return 0, false
 	}
 
@@ -97,45 +130,48 @@ func (rc *RiskControl) CheckMessage() (time.Duration, bool) {
 
 	rc.messageCount++
 	rc.lastMessageAt = time.Now()
+	snap := rc.snapshot()
+	rc.mu.Unlock()
 
+	rc.save(snap)
 	return delay, true
 }
 
 // CheckGroupOperation checks if a group operation is allowed.
 func (rc *RiskControl) CheckGroupOperation() bool {
 	rc.mu.Lock()
-	defer rc.mu.Unlock()
 
 	rc.resetIfNewDay()
 
-	if rc.isInSilencePeriod() {
-		return false
-	}
-
-	if rc.groupCount >= rc.maxGroupsPerDay {
+	if rc.isInSilencePeriod() || rc.groupCount >= rc.maxGroupsPerDay {
+		rc.mu.Unlock()
 		return false
 	}
 
 	rc.groupCount++
+	snap := rc.snapshot()
+	rc.mu.Unlock()
+
+	rc.save(snap)
 	return true
 }
 
 // CheckFriendOperation checks if a friend operation is allowed.
 func (rc *RiskControl) CheckFriendOperation() bool {
 	rc.mu.Lock()
-	defer rc.mu.Unlock()
 
 	rc.resetIfNewDay()
 
-	if rc.isInSilencePeriod() {
-		return false
-	}
-
-	if rc.friendCount >= rc.maxFriendsPerDay {
+	if rc.isInSilencePeriod() || rc.friendCount >= rc.maxFriendsPerDay {
+		rc.mu.Unlock()
 		return false
 	}
 
 	rc.friendCount++
+	snap := rc.snapshot()
+	rc.mu.Unlock()
+
+	rc.save(snap)
 	return true
 }
 
@@ -149,6 +185,16 @@ func (rc *RiskControl) GetStats() (messages, groups, friends int) {
 	return rc.messageCount, rc.groupCount, rc.friendCount
 }
 
+// Limits returns today's usage of each daily limit.
+func (rc *RiskControl) Limits() []wechat.RiskLimit {
+	msgs, groups, friends := rc.GetStats()
+	return []wechat.RiskLimit{
+		{Name: "messages", Used: msgs, Limit: rc.maxMessagesPerDay},
+		{Name: "groups", Used: groups, Limit: rc.maxGroupsPerDay},
+		{Name: "friends", Used: friends, Limit: rc.maxFriendsPerDay},
+	}
+}
+
 // IsInSilencePeriod returns whether the account is in its new-account silence period.
 func (rc *RiskControl) IsInSilencePeriod() bool {
 	rc.mu.Lock()
@@ -215,6 +261,81 @@ func (rc *RiskControl) resetIfNewDay() {
 	}
 }
 
+// load restores today's counters from the store. Counters saved on an
+// earlier day are ignored, so the midnight reset still applies across restarts.
+func (rc *RiskControl) load() {
+	if rc.store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), riskCounterSaveTimeout)
+	defer cancel()
+
+	saved, err := rc.store.LoadRiskCounters(ctx, rc.storeKey)
+	if err != nil {
+		rc.log.Warn("failed to load risk control counters", "error", err)
+		return
+	}
+	if saved == nil || !sameDay(saved.Date, rc.counterDate) {
+		return
+	}
+
+	rc.messageCount = saved.Messages
+	rc.groupCount = saved.Groups
+	rc.friendCount = saved.Friends
+	rc.log.Info("restored risk control counters",
+		"messages", rc.messageCount, "groups", rc.groupCount, "friends", rc.friendCount)
+}
+
+// snapshot copies the current counters for save.
+// Must be called with rc.mu held.
+func (rc *RiskControl) snapshot() *riskCounterSnapshot {
+	if rc.store == nil {
+		return nil
+	}
+	rc.snapshots++
+	return &riskCounterSnapshot{
+		seq: rc.snapshots,
+		counters: wechat.RiskCounters{
+			Date:     rc.counterDate,
+			Messages: rc.messageCount,
+			Groups:   rc.groupCount,
+			Friends:  rc.friendCount,
+		},
+	}
+}
+
+// save flushes a snapshot to the store, unless a newer one was already
+// flushed. Must be called without rc.mu held, so a slow store does not
+// block the checks.
+func (rc *RiskControl) save(snap *riskCounterSnapshot) {
+	if snap == nil {
+		return
+	}
+
+	rc.saveMu.Lock()
+	defer rc.saveMu.Unlock()
+	if snap.seq <= rc.savedSeq {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), riskCounterSaveTimeout)
+	defer cancel()
+
+	if err := rc.store.SaveRiskCounters(ctx, rc.storeKey, &snap.counters); err != nil {
+		rc.log.Warn("failed to save risk control counters", "error", err)
+		return
+	}
+	rc.savedSeq = snap.seq
+}
+
+// sameDay compares calendar dates, ignoring time of day and location.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
 func today() time.Time {
 	now := time.Now()
 	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
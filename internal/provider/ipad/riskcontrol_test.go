@@ -1,10 +1,43 @@
 package ipad
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
+// memoryRiskCounterStore is an in-memory wechat.RiskCounterStore that
+// outlives the RiskControl instances created against it.
+type memoryRiskCounterStore struct {
+	mu    sync.Mutex
+	saved map[string]wechat.RiskCounters
+	saves int
+}
+
+func (s *memoryRiskCounterStore) LoadRiskCounters(_ context.Context, key string) (*wechat.RiskCounters, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.saved[key]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (s *memoryRiskCounterStore) SaveRiskCounters(_ context.Context, key string, c *wechat.RiskCounters) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved == nil {
+		s.saved = make(map[string]wechat.RiskCounters)
+	}
+	s.saved[key] = *c
+	s.saves++
+	return nil
+}
+
 func TestRiskControl_DefaultConfig(t *testing.T) {
 	rc := NewRiskControl(RiskControlConfig{})
 
@@ -248,3 +281,93 @@ func TestToday(t *testing.T) {
 		t.Fatal("today() should be midnight")
 	}
 }
+
+func TestRiskControl_CountersSurviveRestart(t *testing.T) {
+	store := &memoryRiskCounterStore{}
+	cfg := RiskControlConfig{
+		MaxMessagesPerDay: 5,
+		Store:             store,
+		StoreKey:          "ipad",
+	}
+
+	rc := NewRiskControl(cfg)
+	for i := 0; i < 3; i++ {
+		if _, allowed := rc.CheckMessage(); !allowed {
+			t.Fatalf("message %d should be allowed", i+1)
+		}
+	}
+	if !rc.CheckGroupOperation() {
+		t.Fatal("group operation should be allowed")
+	}
+	if store.saves != 4 {
+		t.Fatalf("expected a flush per operation, got %d saves", store.saves)
+	}
+
+	// Simulate a restart: a fresh RiskControl on the same store.
+	restarted := NewRiskControl(cfg)
+	messages, groups, friends := restarted.GetStats()
+	if messages != 3 || groups != 1 || friends != 0 {
+		t.Fatalf("stats after restart = %d/%d/%d, want 3/1/0", messages, groups, friends)
+	}
+	if restarted.RemainingMessages() != 2 {
+		t.Fatalf("remaining after restart: %d", restarted.RemainingMessages())
+	}
+}
+
+func TestRiskControl_IgnoresCountersFromPreviousDay(t *testing.T) {
+	store := &memoryRiskCounterStore{saved: map[string]wechat.RiskCounters{
+		"ipad": {Date: today().AddDate(0, 0, -1), Messages: 500, Groups: 10, Friends: 20},
+	}}
+
+	rc := NewRiskControl(RiskControlConfig{Store: store, StoreKey: "ipad"})
+	messages, groups, friends := rc.GetStats()
+	if messages != 0 || groups != 0 || friends != 0 {
+		t.Fatalf("stale counters restored: %d/%d/%d", messages, groups, friends)
+	}
+}
+
+// blockingRiskCounterStore holds every save until release is closed.
+type blockingRiskCounterStore struct {
+	memoryRiskCounterStore
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingRiskCounterStore) SaveRiskCounters(ctx context.Context, key string, c *wechat.RiskCounters) error {
+	s.saving <- struct{}{}
+	<-s.release
+	return s.memoryRiskCounterStore.SaveRiskCounters(ctx, key, c)
+}
+
+func TestRiskControl_SlowSaveDoesNotBlockChecks(t *testing.T) {
+	store := &blockingRiskCounterStore{saving: make(chan struct{}, 2), release: make(chan struct{})}
+	rc := NewRiskControl(RiskControlConfig{Store: store, StoreKey: "ipad"})
+
+	done := make(chan struct{})
+	go func() {
+		rc.CheckMessage()
+		close(done)
+	}()
+	<-store.saving
+
+	// The first save is stuck in the store; the counters stay available
+	checked := make(chan int)
+	go func() {
+		messages, _, _ := rc.GetStats()
+		checked <- messages
+	}()
+	select {
+	case messages := <-checked:
+		if messages != 1 {
+			t.Fatalf("messages = %d, want 1", messages)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetStats blocked behind a pending save")
+	}
+
+	close(store.release)
+	<-done
+	if store.saved["ipad"].Messages != 1 {
+		t.Fatalf("saved = %+v, want the message counted", store.saved["ipad"])
+	}
+}
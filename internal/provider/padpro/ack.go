@@ -0,0 +1,72 @@
+package padpro
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// sendAckTTL is how long a sent message waits for its sync echo before it is
+// forgotten without an ack.
+const sendAckTTL = 10 * time.Minute
+
+// ackingHandler reports OnSendAck for messages the bridge sent. WeChat syncs
+// every message the account sends back to WeChatPadPro, with the msg ID the
+// send returned; that echo means WeChat's servers accepted and delivered the
+// message. Echoes are passed on to the bridge like any other message.
+type ackingHandler struct {
+	wechat.MessageHandler
+	log *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]time.Time // msg ID → when it was sent
+	now     func() time.Time
+}
+
+func newAckingHandler(handler wechat.MessageHandler, log *slog.Logger) *ackingHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &ackingHandler{
+		MessageHandler: handler,
+		log:            log,
+		pending:        make(map[string]time.Time),
+		now:            time.Now,
+	}
+}
+
+// sent records the msg ID of a message the bridge sent, to be acked when its
+// echo arrives. It returns msgID.
+func (h *ackingHandler) sent(msgID string) string {
+	if h == nil || msgID == "" {
+		return msgID
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	for id, at := range h.pending {
+		if now.Sub(at) > sendAckTTL {
+			delete(h.pending, id)
+		}
+	}
+	h.pending[msgID] = now
+	return msgID
+}
+
+// OnMessage acks msg if it is the echo of a message the bridge sent.
+func (h *ackingHandler) OnMessage(ctx context.Context, msg *wechat.Message) error {
+	h.mu.Lock()
+	_, acked := h.pending[msg.MsgID]
+	delete(h.pending, msg.MsgID)
+	h.mu.Unlock()
+
+	if acked {
+		if err := h.MessageHandler.OnSendAck(ctx, msg.MsgID); err != nil {
+			h.log.Warn("handle send ack failed", "error", err, "msg_id", msg.MsgID)
+		}
+	}
+	return h.MessageHandler.OnMessage(ctx, msg)
+}
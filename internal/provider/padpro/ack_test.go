@@ -0,0 +1,76 @@
+package padpro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestAckingHandler_AcksEchoOnce(t *testing.T) {
+	th := &testHandler{}
+	h := newAckingHandler(th, nil)
+	now := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return now }
+
+	h.sent("33")
+	h.sent("44")
+	for _, id := range []string{"33", "33", "55"} {
+		if err := h.OnMessage(context.Background(), &wechat.Message{MsgID: id}); err != nil {
+			t.Fatalf("OnMessage: %v", err)
+		}
+	}
+	if len(th.acks) != 1 || th.acks[0] != "33" {
+		t.Fatalf("acks = %v, want only the first echo of 33", th.acks)
+	}
+	if len(th.messages) != 3 {
+		t.Fatalf("passed on %d messages, want every message", len(th.messages))
+	}
+
+	// Sends whose echo never came are forgotten
+	now = now.Add(sendAckTTL + time.Second)
+	h.sent("66")
+	if _, ok := h.pending["44"]; ok {
+		t.Fatal("expired send still pending")
+	}
+}
+
+func TestProvider_SendText_AckedBySyncEcho(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"msg_id":11,"new_msg_id":33}}`))
+	}))
+	defer server.Close()
+
+	th := &testHandler{}
+	p := &Provider{}
+	cfg := &wechat.ProviderConfig{APIEndpoint: server.URL, APIToken: "token", Extra: map[string]string{"reorder_window_ms": "-1"}}
+	if err := p.Init(cfg, th); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+	if !p.Capabilities().SendAck {
+		t.Fatal("padpro should report send acks")
+	}
+
+	msgID, err := p.SendText(context.Background(), "wxid_target", "hello")
+	if err != nil || msgID != "33" {
+		t.Fatalf("SendText = %q, %v", msgID, err)
+	}
+	if len(th.acks) != 0 {
+		t.Fatalf("acked before the echo: %v", th.acks)
+	}
+	p.ws.dispatchMessage(wsMessage{
+		MsgID:        11,
+		NewMsgID:     33,
+		MsgType:      int(wechat.MsgText),
+		FromUserName: strField{Str: "wxid_self"},
+		ToUserName:   strField{Str: "wxid_target"},
+		Content:      strField{Str: "hello"},
+	})
+	if len(th.acks) != 1 || th.acks[0] != "33" {
+		t.Fatalf("acks = %v, want the sent message", th.acks)
+	}
+}
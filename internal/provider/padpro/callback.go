@@ -64,17 +64,25 @@ func (wh *WebhookHandler) dispatch(ctx context.Context, raw wsMessage) {
 		if msg == nil {
 			return
 		}
-		if err := wh.handler.OnRevoke(ctx, msg.MsgID, raw.PushContent); err != nil {
+		if err := wh.handler.OnRevoke(ctx, revokeChatID(msg), msg.MsgID, raw.PushContent); err != nil {
 			wh.log.Error("handle revoke failed", "error", err)
 		}
-	case wechat.MsgSystem:
-		wh.log.Debug("system message via webhook", "content", raw.Content.Str)
 	default:
 		msg := convertWSMessage(raw)
 		if msg == nil {
 			wh.log.Warn("webhook message missing from_user_name")
 			return
 		}
+		if reaction := parseReaction(msg); reaction != nil {
+			if err := wh.handler.OnMessageReaction(ctx, reaction); err != nil {
+				wh.log.Error("handle reaction failed", "error", err, "msg_id", reaction.MsgID)
+			}
+			return
+		}
+		if !bridgedSystemMessage(msg) {
+			wh.log.Debug("system message via webhook", "content", msg.Content)
+			return
+		}
 		if err := wh.handler.OnMessage(ctx, msg); err != nil {
 			wh.log.Error("handle message failed", "error", err, "msg_id", msg.MsgID)
 		}
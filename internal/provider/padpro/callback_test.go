@@ -13,8 +13,10 @@ import (
 )
 
 type testHandler struct {
-	messages []*wechat.Message
-	revokes  []string
+	messages  []*wechat.Message
+	revokes   []string
+	acks      []string
+	reactions []*wechat.MessageReaction
 }
 
 func (h *testHandler) OnMessage(_ context.Context, msg *wechat.Message) error {
@@ -42,11 +44,29 @@ func (h *testHandler) OnTyping(_ context.Context, _ string, _ string) error {
 	return nil
 }
 
-func (h *testHandler) OnRevoke(_ context.Context, msgID string, _ string) error {
+func (h *testHandler) OnRevoke(_ context.Context, _, msgID, _ string) error {
 	h.revokes = append(h.revokes, msgID)
 	return nil
 }
 
+func (h *testHandler) OnFriendRequest(_ context.Context, _ *wechat.FriendRequest) error {
+	return nil
+}
+
+func (h *testHandler) OnSendAck(_ context.Context, msgID string) error {
+	h.acks = append(h.acks, msgID)
+	return nil
+}
+
+func (h *testHandler) OnMessageReaction(_ context.Context, reaction *wechat.MessageReaction) error {
+	h.reactions = append(h.reactions, reaction)
+	return nil
+}
+
+func (h *testHandler) OnContactAdded(_ context.Context, _ *wechat.ContactInfo) error {
+	return nil
+}
+
 func TestWebhookHandler_RequiresHandler(t *testing.T) {
 	handler := NewWebhookHandler(slog.Default(), nil)
 
@@ -118,3 +138,29 @@ func TestWebhookHandler_DispatchesRevoke(t *testing.T) {
 		t.Fatalf("revoke id = %s", th.revokes[0])
 	}
 }
+
+func TestWebhookHandler_DispatchesSystemMessage(t *testing.T) {
+	th := &testHandler{}
+	handler := NewWebhookHandler(slog.Default(), th)
+
+	body, err := json.Marshal(wsMessage{
+		NewMsgID:     789,
+		MsgType:      int(wechat.MsgSystem),
+		FromUserName: strField{Str: "12345@chatroom"},
+		Content:      strField{Str: `你被"Alice"移出群聊`},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/callback", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if len(th.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(th.messages))
+	}
+	if msg := th.messages[0]; msg.Type != wechat.MsgSystem || msg.GroupID != "12345@chatroom" {
+		t.Fatalf("unexpected system message: %+v", msg)
+	}
+}
@@ -10,16 +10,21 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
 // Client wraps the WeChatPadPro REST API.
 // All endpoints are authenticated via ?key=<authKey> query parameter.
 //
 // API reference:
-//   - Login:    /login/GetLoginQrCodeNew, /login/CheckLoginStatus, /login/LogOut
+//   - Login:    /login/GetLoginQrCodeNew, /login/CheckLoginStatus, /login/GetLoginStatus,
+//               /login/LogOut
 //   - Message:  /message/SendTextMessage, /message/SendImageMessage, /message/SendVoice,
-//               /message/CdnUploadVideo, /message/RevokeMsg, /message/sendFile
-//   - Contact:  /friend/GetFriendList, /friend/GetContactDetailsList, /friend/AgreeAdd
+//               /message/CdnUploadVideo, /message/RevokeMsg, /message/sendFile,
+//               /message/SendLocation, /message/GetMediaUrl, /message/GetChatHistory
+//   - Contact:  /friend/GetFriendList, /friend/GetContactDetailsList, /friend/AgreeAdd,
+//               /friend/SendFriendRequest
 //   - Group:    /group/CreateChatRoom, /group/AddChatRoomMembers, /group/GetChatRoomInfo
 //   - SNS:      /sns/GetSnsSync, /sns/SendFriendCircle, /sns/SendSnsComment
 //   - Finder:   /finder/FinderSearch, /finder/FinderFollow
@@ -37,15 +42,27 @@ type apiResponse struct {
 	Data json.RawMessage `json:"data,omitempty"`
 }
 
+// defaultHTTPTimeout applies when http_timeout_s is not configured.
+const defaultHTTPTimeout = 30 * time.Second
+
+// defaultContactFetchConcurrency applies when contact_fetch_concurrency is
+// not configured.
+const defaultContactFetchConcurrency = 3
+
 // NewClient creates a new WeChatPadPro API client.
 func NewClient(baseURL, authKey string) *Client {
 	return &Client{
 		baseURL: baseURL,
 		authKey: authKey,
-		httpCli: &http.Client{Timeout: 30 * time.Second},
+		httpCli: &http.Client{Timeout: defaultHTTPTimeout},
 	}
 }
 
+// SetTimeout changes the timeout applied to every API request.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.httpCli.Timeout = d
+}
+
 // buildURL constructs the full URL with ?key= auth parameter.
 func (c *Client) buildURL(path string) string {
 	u, err := url.Parse(c.baseURL + path)
@@ -91,7 +108,7 @@ func (c *Client) PostJSON(ctx context.Context, path string, body interface{}) (*
 func (c *Client) do(req *http.Request) (*apiResponse, error) {
 	resp, err := c.httpCli.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("HTTP request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -101,7 +118,7 @@ func (c *Client) do(req *http.Request) (*apiResponse, error) {
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(data))
+		return nil, wechat.WrapHTTPStatus(resp.StatusCode, data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(data)))
 	}
 
 	var apiResp apiResponse
@@ -151,6 +168,20 @@ func (c *Client) CheckLoginStatus(ctx context.Context) (*loginStatusResponse, er
 	return &data, nil
 }
 
+// GetLoginStatus reports whether the account behind the auth key is still
+// logged in, e.g. after the bridge restarted.
+func (c *Client) GetLoginStatus(ctx context.Context) (*onlineStatusResponse, error) {
+	resp, err := c.Get(ctx, "/login/GetLoginStatus")
+	if err != nil {
+		return nil, fmt.Errorf("get login status: %w", err)
+	}
+	var data onlineStatusResponse
+	if err := c.ParseData(resp, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
 // Logout terminates the current session.
 func (c *Client) Logout(ctx context.Context) error {
 	_, err := c.Get(ctx, "/login/LogOut")
@@ -198,6 +229,20 @@ func (c *Client) SendVoice(ctx context.Context, req *sendVoiceRequest) (*sendMsg
 	return &data, nil
 }
 
+// SendLocationMessage sends a native location card. Servers without the
+// endpoint answer with an error wrapping wechat.ErrNotSupported.
+func (c *Client) SendLocationMessage(ctx context.Context, req *sendLocationRequest) (*sendMsgResponse, error) {
+	resp, err := c.PostJSON(ctx, "/message/SendLocation", req)
+	if err != nil {
+		return nil, err
+	}
+	var data sendMsgResponse
+	if err := c.ParseData(resp, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
 // CdnUploadVideo uploads and sends a video.
 func (c *Client) CdnUploadVideo(ctx context.Context, req *sendVideoRequest) (*sendMsgResponse, error) {
 	resp, err := c.PostJSON(ctx, "/message/CdnUploadVideo", req)
@@ -224,12 +269,51 @@ func (c *Client) SendFile(ctx context.Context, req *sendFileRequest) (*sendMsgRe
 	return &data, nil
 }
 
+// GetMediaURL requests a fresh CDN download URL for a message's media ID. It
+// returns "" if the media is no longer available.
+func (c *Client) GetMediaURL(ctx context.Context, mediaID string) (string, error) {
+	resp, err := c.PostJSON(ctx, "/message/GetMediaUrl", &mediaURLRequest{MediaID: mediaID})
+	if err != nil {
+		return "", err
+	}
+	if resp.Data == nil {
+		return "", nil
+	}
+	var data mediaURLResponse
+	if err := c.ParseData(resp, &data); err != nil {
+		return "", err
+	}
+	return data.URL, nil
+}
+
+// GetChatHistory returns up to count of a chat's newest messages.
+func (c *Client) GetChatHistory(ctx context.Context, userName string, count int) ([]wsMessage, error) {
+	resp, err := c.PostJSON(ctx, "/message/GetChatHistory", &chatHistoryRequest{
+		UserName: userName,
+		Count:    count,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var data chatHistoryResponse
+	if err := c.ParseData(resp, &data); err != nil {
+		return nil, err
+	}
+	return data.Messages, nil
+}
+
 // RevokeMsg revokes a sent message.
 func (c *Client) RevokeMsg(ctx context.Context, req *revokeRequest) error {
 	_, err := c.PostJSON(ctx, "/message/RevokeMsg", req)
 	return err
 }
 
+// SendPat pats a user (拍一拍) in a chat.
+func (c *Client) SendPat(ctx context.Context, req *sendPatRequest) error {
+	_, err := c.PostJSON(ctx, "/message/SendPat", req)
+	return err
+}
+
 // --- Contact API ---
 
 // GetFriendList returns the list of friend wxid strings.
@@ -270,6 +354,18 @@ func (c *Client) AgreeAdd(ctx context.Context, encryptUserName, ticket string, s
 	return err
 }
 
+// SendFriendRequest asks a stranger, identified by their encrypted user name
+// and verification ticket, to become a friend.
+func (c *Client) SendFriendRequest(ctx context.Context, encryptUserName, ticket string, scene int, content string) error {
+	_, err := c.PostJSON(ctx, "/friend/SendFriendRequest", &verifyUserRequest{
+		EncryptUserName: encryptUserName,
+		Ticket:          ticket,
+		Scene:           scene,
+		Content:         content,
+	})
+	return err
+}
+
 // SetRemark sets a remark name for a contact.
 func (c *Client) SetRemark(ctx context.Context, userName, remark string) error {
 	_, err := c.PostJSON(ctx, "/friend/SetRemark", &setRemarkRequest{
@@ -355,6 +451,14 @@ func (c *Client) QuitChatRoom(ctx context.Context, chatRoomName string) error {
 	return err
 }
 
+// ScanIntoURLGroup joins a group via an invite link from a group invite card.
+func (c *Client) ScanIntoURLGroup(ctx context.Context, url string) error {
+	_, err := c.PostJSON(ctx, "/group/ScanIntoUrlGroup", &scanIntoURLGroupRequest{
+		URL: url,
+	})
+	return err
+}
+
 // --- Webhook API ---
 
 // ConfigureWebhook sets up the webhook callback endpoint.
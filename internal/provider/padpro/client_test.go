@@ -97,15 +97,15 @@ func TestClientAPIWrappers(t *testing.T) {
 			_, _ = io.WriteString(w, `{"code":0,"data":{"status":2,"user_name":"wxid_user","nick_name":"Alice","head_url":"https://example.com/a.jpg"}}`)
 		case "/login/LogOut":
 			_, _ = io.WriteString(w, `{"code":0,"data":{}}`)
-		case "/message/SendTextMessage", "/message/SendImageMessage", "/message/SendVoice", "/message/CdnUploadVideo", "/message/sendFile":
+		case "/message/SendTextMessage", "/message/SendImageMessage", "/message/SendVoice", "/message/CdnUploadVideo", "/message/sendFile", "/message/SendLocation":
 			_, _ = io.WriteString(w, `{"code":0,"data":{"msg_id":11,"new_msg_id":22}}`)
-		case "/message/RevokeMsg":
+		case "/message/RevokeMsg", "/message/SendPat":
 			_, _ = io.WriteString(w, `{"code":0,"data":{}}`)
 		case "/friend/GetFriendList":
 			_, _ = io.WriteString(w, `{"code":0,"data":{"friends":["wxid1","wxid2"]}}`)
 		case "/friend/GetContactDetailsList":
 			_, _ = io.WriteString(w, `{"code":0,"data":{"contacts":[{"user_name":{"str":"wxid1"},"nick_name":{"str":"Alice"}}]}}`)
-		case "/friend/AgreeAdd", "/friend/SetRemark":
+		case "/friend/AgreeAdd", "/friend/SendFriendRequest", "/friend/SetRemark":
 			_, _ = io.WriteString(w, `{"code":0,"data":{}}`)
 		case "/group/GetChatRoomInfo":
 			_, _ = io.WriteString(w, `{"code":0,"data":{"chat_room_name":{"str":"group@chatroom"},"nick_name":{"str":"Group"},"member_count":1,"members":[]}}`)
@@ -144,6 +144,9 @@ func TestClientAPIWrappers(t *testing.T) {
 	if _, err := c.SendVoice(ctx, &sendVoiceRequest{}); err != nil {
 		t.Fatalf("SendVoice error: %v", err)
 	}
+	if _, err := c.SendLocationMessage(ctx, &sendLocationRequest{}); err != nil {
+		t.Fatalf("SendLocationMessage error: %v", err)
+	}
 	if _, err := c.CdnUploadVideo(ctx, &sendVideoRequest{}); err != nil {
 		t.Fatalf("CdnUploadVideo error: %v", err)
 	}
@@ -153,6 +156,9 @@ func TestClientAPIWrappers(t *testing.T) {
 	if err := c.RevokeMsg(ctx, &revokeRequest{}); err != nil {
 		t.Fatalf("RevokeMsg error: %v", err)
 	}
+	if err := c.SendPat(ctx, &sendPatRequest{}); err != nil {
+		t.Fatalf("SendPat error: %v", err)
+	}
 	friends, err := c.GetFriendList(ctx)
 	if err != nil || len(friends) != 2 {
 		t.Fatalf("GetFriendList error=%v friends=%v", err, friends)
@@ -164,6 +170,9 @@ func TestClientAPIWrappers(t *testing.T) {
 	if err := c.AgreeAdd(ctx, "enc", "ticket", 1); err != nil {
 		t.Fatalf("AgreeAdd error: %v", err)
 	}
+	if err := c.SendFriendRequest(ctx, "v3_enc", "v4_ticket", 17, "hi"); err != nil {
+		t.Fatalf("SendFriendRequest error: %v", err)
+	}
 	if err := c.SetRemark(ctx, "wxid1", "remark"); err != nil {
 		t.Fatalf("SetRemark error: %v", err)
 	}
@@ -1,6 +1,7 @@
 package padpro
 
 import (
+	"encoding/xml"
 	"strconv"
 	"strings"
 
@@ -39,20 +40,24 @@ func convertWSMessage(raw wsMessage) *wechat.Message {
 	}
 
 	// Detect group messages: group IDs end with @chatroom
-	if strings.HasSuffix(fromUser, "@chatroom") {
+	if wechat.IsGroupID(fromUser) {
 		msg.IsGroup = true
 		msg.GroupID = fromUser
 		// In group messages, the actual sender wxid is prefixed in content: "wxid_xxx:\n<real content>"
-		if idx := strings.Index(msg.Content, ":\n"); idx > 0 {
-			msg.FromUser = msg.Content[:idx]
-			msg.Content = msg.Content[idx+2:]
-		}
-	} else if strings.HasSuffix(toUser, "@chatroom") {
+		wechat.ExtractGroupSender(msg)
+	} else if wechat.IsGroupID(toUser) {
 		// Outgoing group message (sent by self)
 		msg.IsGroup = true
 		msg.GroupID = toUser
 	}
 
+	switch msg.Type {
+	case wechat.MsgLink:
+		msg.Channels = parseFinderShare(msg.Content)
+	case wechat.MsgContact, wechat.MsgRecommend:
+		msg.Card = parseContactCard(msg.Content)
+	}
+
 	// Preserve raw fields for debugging and advanced processing
 	if raw.MsgSource != "" {
 		msg.Extra["msg_source"] = raw.MsgSource
@@ -63,10 +68,23 @@ func convertWSMessage(raw wsMessage) *wechat.Message {
 	if raw.MsgID != 0 {
 		msg.Extra["original_msg_id"] = strconv.FormatInt(raw.MsgID, 10)
 	}
+	if raw.MediaID != "" {
+		msg.Extra[wechat.ExtraMediaID] = raw.MediaID
+	}
 
 	return msg
 }
 
+// revokeChatID returns the chat a recall happened in: the group, or the
+// contact that recalled a message. A recall from the account's own phone
+// names the account itself, which the bridge treats as an unknown chat.
+func revokeChatID(msg *wechat.Message) string {
+	if msg.IsGroup {
+		return msg.GroupID
+	}
+	return msg.FromUser
+}
+
 // convertContactEntry transforms a WeChatPadPro contact entry to wechat.ContactInfo.
 func convertContactEntry(entry contactEntry) *wechat.ContactInfo {
 	return &wechat.ContactInfo{
@@ -136,3 +154,84 @@ func convertFinderVideo(v finderVideo) *wechat.ChannelsVideo {
 		Timestamp:   v.CreateTime * 1000,
 	}
 }
+
+// appMsgTypeFinderFeed is the <appmsg><type> of a shared Channels video.
+const appMsgTypeFinderFeed = 51
+
+// parseFinderShare extracts the video from a shared Channels (视频号) post.
+// Its <title> only asks to upgrade WeChat, so the video is read from the
+// <finderFeed> element. Returns nil for any other app message.
+func parseFinderShare(content string) *wechat.ChannelsVideo {
+	if !strings.Contains(content, "<finderFeed") {
+		return nil
+	}
+	var parsed finderShareXML
+	if err := xml.Unmarshal([]byte(content), &parsed); err != nil {
+		return nil
+	}
+	if parsed.AppMsg.Type != appMsgTypeFinderFeed {
+		return nil
+	}
+
+	feed := parsed.AppMsg.FinderFeed
+	video := &wechat.ChannelsVideo{
+		VideoID:     feed.ObjectID,
+		AuthorID:    feed.Username,
+		AuthorName:  strings.TrimSpace(feed.Nickname),
+		Description: strings.TrimSpace(feed.Desc),
+	}
+	// Channels posts have no separate title; the first line of the
+	// description serves as one.
+	video.Title, _, _ = strings.Cut(video.Description, "\n")
+	if len(feed.MediaList.Media) > 0 {
+		media := feed.MediaList.Media[0]
+		video.CoverURL = media.CoverURL
+		if video.CoverURL == "" {
+			video.CoverURL = media.ThumbURL
+		}
+		video.VideoURL = media.URL
+		video.Duration = media.VideoPlayDuration
+	}
+	return video
+}
+
+// parseContactCard extracts the contact from a shared contact card (名片,
+// type 42) or a contact recommendation (朋友推荐, type 40). Both are a single
+// <msg> element whose attributes describe the contact, but recommendations
+// name them with from* attributes. Returns nil if content isn't one.
+func parseContactCard(content string) *wechat.ContactCard {
+	var parsed contactCardXML
+	if err := xml.Unmarshal([]byte(content), &parsed); err != nil {
+		return nil
+	}
+	card := &wechat.ContactCard{
+		UserID:    firstNonEmpty(parsed.Username, parsed.FromUsername),
+		Nickname:  firstNonEmpty(parsed.Nickname, parsed.FromNickname),
+		Alias:     parsed.Alias,
+		AvatarURL: firstNonEmpty(parsed.BigHeadImgURL, parsed.SmallHeadImgURL),
+		Region:    strings.TrimSpace(parsed.Province + " " + parsed.City),
+		Ticket:    firstNonEmpty(parsed.Ticket, parsed.AntispamTicket),
+		Scene:     parsed.Scene,
+	}
+	// Strangers are named by an encrypted ID, which is the one a friend
+	// request must be sent to.
+	if parsed.EncryptUsername != "" {
+		card.UserID = parsed.EncryptUsername
+	}
+	if parsed.FromUsername != "" {
+		card.Reason = strings.TrimSpace(parsed.Content)
+	}
+	if card.UserID == "" {
+		return nil
+	}
+	return card
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,6 +1,10 @@
 package padpro
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
 
 func TestConvertWSMessage_GroupIncoming(t *testing.T) {
 	msg := convertWSMessage(wsMessage{
@@ -28,6 +32,18 @@ func TestConvertWSMessage_GroupIncoming(t *testing.T) {
 	}
 }
 
+func TestConvertWSMessage_GroupSystemNoticeKeepsGroupSender(t *testing.T) {
+	msg := convertWSMessage(wsMessage{
+		NewMsgID:     100,
+		MsgType:      10000,
+		FromUserName: strField{Str: "group@chatroom"},
+		Content:      strField{Str: "\"Alice\" invited you to the group chat:\nwelcome"},
+	})
+	if msg.FromUser != "group@chatroom" || msg.Content != "\"Alice\" invited you to the group chat:\nwelcome" {
+		t.Fatalf("system notice was split: %+v", msg)
+	}
+}
+
 func TestConvertWSMessage_OutgoingGroupAndMissingSender(t *testing.T) {
 	msg := convertWSMessage(wsMessage{
 		MsgID:        12,
@@ -104,3 +120,78 @@ func TestConvertSnsAndFinderObjects(t *testing.T) {
 		t.Fatalf("unexpected video: %+v", video)
 	}
 }
+
+func TestConvertWSMessage_FinderShare(t *testing.T) {
+	msg := convertWSMessage(wsMessage{
+		NewMsgID:     101,
+		MsgType:      49,
+		FromUserName: strField{Str: "group@chatroom"},
+		Content: strField{Str: "wxid_sender:\n<msg><appmsg appid=\"\" sdkver=\"0\"><title>当前微信版本不支持展示该内容，请升级至最新版本。</title>" +
+			"<type>51</type><finderFeed><objectId>1435</objectId><nickname>Travel Diary</nickname>" +
+			"<username>v2_abc@finder</username><desc>Sunset at the pier\n#travel</desc><mediaList><media>" +
+			"<thumbUrl>https://finder.example.com/thumb.jpg</thumbUrl><coverUrl>https://finder.example.com/cover.jpg</coverUrl>" +
+			"<url>https://finder.example.com/video</url><videoPlayDuration>42</videoPlayDuration></media></mediaList>" +
+			"</finderFeed></appmsg></msg>"},
+	})
+	video := msg.Channels
+	if video == nil {
+		t.Fatalf("expected channels video: %+v", msg)
+	}
+	if video.VideoID != "1435" || video.AuthorID != "v2_abc@finder" || video.AuthorName != "Travel Diary" {
+		t.Fatalf("unexpected author/id: %+v", video)
+	}
+	if video.Title != "Sunset at the pier" || video.CoverURL != "https://finder.example.com/cover.jpg" || video.Duration != 42 {
+		t.Fatalf("unexpected video: %+v", video)
+	}
+
+	link := convertWSMessage(wsMessage{
+		MsgType:      49,
+		FromUserName: strField{Str: "wxid_friend"},
+		Content:      strField{Str: "<msg><appmsg><title>Article</title><type>5</type><url>https://example.com</url></appmsg></msg>"},
+	})
+	if link.Channels != nil {
+		t.Fatalf("plain link parsed as channels: %+v", link.Channels)
+	}
+}
+
+func TestConvertWSMessage_ContactRecommendation(t *testing.T) {
+	msg := convertWSMessage(wsMessage{
+		NewMsgID:     102,
+		MsgType:      40,
+		FromUserName: strField{Str: "fmessage"},
+		ToUserName:   strField{Str: "wxid_me"},
+		Content: strField{Str: `<msg fromusername="wxid_bob" encryptusername="v3_020b3826fd@stranger" fromnickname="Bob" ` +
+			`content="You may know Bob from your phone contacts" fullpy="bob" shortpy="B" imagestatus="3" scene="10" ` +
+			`country="CN" province="Guangdong" city="Shenzhen" sign="" percard="1" sex="1" alias="bob_88" weibo="" ` +
+			`albumflag="0" albumstyle="0" albumbgimgid="" snsflag="1" snsbgimgid="" snsbgobjectid="0" ` +
+			`mhash="" mfullhash="" bigheadimgurl="https://wx.qlogo.cn/bob/0" smallheadimgurl="https://wx.qlogo.cn/bob/132" ` +
+			`ticket="v4_000b708f0b@stranger" opcode="0" googlecontact="" qrticket="" chatroomusername="" sourceusername="" ` +
+			`sourcenickname=""><brandlist count="0" ver="0"></brandlist></msg>`},
+	})
+	if msg.Type != wechat.MsgRecommend {
+		t.Fatalf("type = %v", msg.Type)
+	}
+	card := msg.Card
+	if card == nil {
+		t.Fatalf("expected contact card: %+v", msg)
+	}
+	if card.UserID != "v3_020b3826fd@stranger" || card.Nickname != "Bob" || card.Alias != "bob_88" {
+		t.Fatalf("unexpected contact: %+v", card)
+	}
+	if card.Ticket != "v4_000b708f0b@stranger" || card.Scene != 10 || card.Region != "Guangdong Shenzhen" {
+		t.Fatalf("unexpected ticket/scene/region: %+v", card)
+	}
+	if card.Reason != "You may know Bob from your phone contacts" || card.AvatarURL != "https://wx.qlogo.cn/bob/0" {
+		t.Fatalf("unexpected reason/avatar: %+v", card)
+	}
+
+	shared := convertWSMessage(wsMessage{
+		MsgType:      42,
+		FromUserName: strField{Str: "wxid_friend"},
+		Content: strField{Str: `<msg bigheadimgurl="https://wx.qlogo.cn/carol/0" username="wxid_carol" nickname="Carol" ` +
+			`alias="" province="" city="" sex="2" antispamticket="v4_carol@stranger" />`},
+	})
+	if shared.Card == nil || shared.Card.UserID != "wxid_carol" || shared.Card.Ticket != "v4_carol@stranger" || shared.Card.Reason != "" {
+		t.Fatalf("unexpected shared card: %+v", shared.Card)
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/n42/mautrix-wechat/pkg/wechat"
@@ -52,8 +55,30 @@ type Provider struct {
 	stopCh     chan struct{}
 	log        *slog.Logger
 
+	// httpTimeout bounds REST API calls and media downloads (http_timeout_s).
+	httpTimeout time.Duration
+
+	// contactFetchConcurrency bounds parallel contact detail batches in
+	// GetContactList (contact_fetch_concurrency).
+	contactFetchConcurrency int
+
+	// reorder delays WebSocket and webhook messages by reorder_window_ms to
+	// deliver them in timestamp order; nil when disabled.
+	reorder *reorderingHandler
+	// acks reports the sync echoes of sent messages as send acks; nil
+	// without a handler.
+	acks *ackingHandler
+
+	// locationUnsupportedUntil is when, in unix nanoseconds, SendLocation
+	// tries the location endpoint again after the server answered that it
+	// has none; until then it sends text right away.
+	locationUnsupportedUntil atomic.Int64
+	now                      func() time.Time
+
 	// Risk control engine
 	riskControl *RiskControl
+	// sends is told about risk-control delays and send durations; may be nil
+	sends wechat.SendObserver
 
 	// Extended APIs
 	moments  *MomentsAPI
@@ -71,6 +96,7 @@ func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandle
 	p.handler = handler
 	p.stopCh = make(chan struct{})
 	p.log = slog.Default().With("provider", "padpro")
+	p.now = time.Now
 
 	if cfg.APIEndpoint == "" {
 		return fmt.Errorf("padpro provider: api_endpoint is required")
@@ -87,7 +113,10 @@ func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandle
 	}
 
 	// Initialize REST API client
+	p.httpTimeout = time.Duration(parseIntOr(cfg.Extra, "http_timeout_s", int(defaultHTTPTimeout/time.Second))) * time.Second
 	p.api = NewClient(cfg.APIEndpoint, authKey)
+	p.api.SetTimeout(p.httpTimeout)
+	p.contactFetchConcurrency = parseIntOr(cfg.Extra, "contact_fetch_concurrency", defaultContactFetchConcurrency)
 
 	// Derive WebSocket endpoint from API endpoint if not explicitly set
 	wsEndpoint := cfg.Extra["ws_endpoint"]
@@ -97,11 +126,28 @@ func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandle
 		wsEndpoint = strings.Replace(wsEndpoint, "http://", "ws://", 1)
 	}
 
+	// Messages pushed over the WebSocket or webhook pass through a short
+	// reordering window; reorder_window_ms of -1 disables it. Echoes of
+	// sent messages are acked after the window, by which time the bridge
+	// has stored their msg IDs.
+	inbound := handler
+	if handler != nil {
+		p.acks = newAckingHandler(handler, p.log.With("component", "acks"))
+		inbound = p.acks
+	}
+	reorderMs := parseIntOr(cfg.Extra, "reorder_window_ms", defaultReorderWindowMs)
+	if handler != nil && cfg.Extra["reorder_window_ms"] != "-1" {
+		p.reorder = newReorderingHandler(inbound, time.Duration(reorderMs)*time.Millisecond, p.log.With("component", "reorder"))
+		inbound = p.reorder
+	}
+
 	// Initialize WebSocket client for real-time message sync
-	p.ws = newWSClient(wsEndpoint, authKey, handler, p.log.With("component", "websocket"))
+	p.ws = newWSClient(wsEndpoint, authKey, inbound, p.log.With("component", "websocket"))
+	p.ws.observer = cfg.Connection
 
 	// Initialize risk control engine
 	p.riskControl = NewRiskControl(cfg)
+	p.sends = cfg.Sends
 	p.log.Info("risk control initialized",
 		"max_messages_per_day", p.riskControl.maxMessagesPerDay,
 		"max_media_per_day", p.riskControl.maxMediaPerDay,
@@ -166,9 +212,8 @@ func (p *Provider) Start(ctx context.Context) error {
 
 func (p *Provider) Stop() error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	if !p.running {
+		p.mu.Unlock()
 		return nil
 	}
 
@@ -188,6 +233,13 @@ func (p *Provider) Stop() error {
 
 	p.running = false
 	p.loginState = wechat.LoginStateLoggedOut
+	p.mu.Unlock()
+
+	// Deliver messages still held for reordering. The bridge may call back
+	// into the provider while handling them, so not under p.mu.
+	if p.reorder != nil {
+		p.reorder.close()
+	}
 	p.log.Info("PadPro provider stopped")
 	return nil
 }
@@ -203,7 +255,7 @@ func (p *Provider) IsRunning() bool {
 func (p *Provider) Name() string { return "padpro" }
 func (p *Provider) Tier() int    { return 2 }
 func (p *Provider) Capabilities() wechat.Capability {
-	return wechat.Capability{
+	return p.cfg.OverrideCapabilities(wechat.Capability{
 		SendText:       true,
 		SendImage:      true,
 		SendVideo:      true,
@@ -222,10 +274,13 @@ func (p *Provider) Capabilities() wechat.Capability {
 		VoiceCall:      false,
 		VideoCall:      false,
 		Revoke:         true,
-		Reaction:       false,
+		Reaction:       true, // Receives emoji reactions; see parseReaction
 		ReadReceipt:    false,
 		Typing:         false,
-	}
+		GroupInvite:    true,
+		Pat:            true,
+		SendAck:        true, // Sync echoes of sent messages; see ackingHandler
+	})
 }
 
 // --- Authentication ---
@@ -333,6 +388,8 @@ func (p *Provider) pollLoginStatus(ctx context.Context, stopCh chan struct{}) {
 						Avatar: status.HeadURL,
 					})
 				}
+				// Saved once the login event linked the account to its bridge user
+				p.saveSession(ctx, status.UserName)
 				p.log.Info("login successful", "user_id", status.UserName, "nickname", status.NickName)
 				return
 			case 3:
@@ -352,6 +409,46 @@ func (p *Provider) pollLoginStatus(ctx context.Context, stopCh chan struct{}) {
 	}
 }
 
+// RestoreSession resumes the session WeChatPadPro still holds for the auth
+// key, so a restarted bridge doesn't request a QR code and sign the phone
+// out. A session of another account than the saved one is not resumed: the
+// auth key was logged in again elsewhere, e.g. after a node was reassigned.
+// A resumed session is reported with the same LoginEvent as a QR login.
+// Uses: GET /login/GetLoginStatus
+func (p *Provider) RestoreSession(ctx context.Context) (bool, error) {
+	status, err := p.api.GetLoginStatus(ctx)
+	if err != nil {
+		return false, fmt.Errorf("restore session: %w", err)
+	}
+	if !status.Online || status.UserName == "" {
+		return false, nil
+	}
+	if saved := p.loadSession(ctx); saved != nil && saved.UserName != status.UserName {
+		p.log.Warn("not restoring session of another account",
+			"user_id", status.UserName, "saved_user_id", saved.UserName)
+		return false, nil
+	}
+	p.mu.Lock()
+	p.loginState = wechat.LoginStateLoggedIn
+	p.self = &wechat.ContactInfo{
+		UserID:    status.UserName,
+		Nickname:  status.NickName,
+		AvatarURL: status.HeadURL,
+	}
+	p.mu.Unlock()
+	if p.handler != nil {
+		p.handler.OnLoginEvent(ctx, &wechat.LoginEvent{
+			State:  wechat.LoginStateLoggedIn,
+			UserID: status.UserName,
+			Name:   status.NickName,
+			Avatar: status.HeadURL,
+		})
+	}
+	p.saveSession(ctx, status.UserName)
+	p.log.Info("restored session", "user_id", status.UserName, "nickname", status.NickName)
+	return true, nil
+}
+
 // Logout terminates the current WeChatPadPro session.
 // Uses: GET /login/LogOut
 func (p *Provider) Logout(ctx context.Context) error {
@@ -362,6 +459,7 @@ func (p *Provider) Logout(ctx context.Context) error {
 	p.loginState = wechat.LoginStateLoggedOut
 	p.self = nil
 	p.mu.Unlock()
+	p.forgetSession(ctx)
 	return nil
 }
 
@@ -383,43 +481,48 @@ func (p *Provider) GetSelf() *wechat.ContactInfo {
 
 // SendText sends a text message via POST /message/SendTextMessage.
 func (p *Provider) SendText(ctx context.Context, toUser string, text string) (string, error) {
+	return p.sendText(ctx, toUser, text, nil)
+}
+
+// SendTextMentions implements wechat.MentionSender: it sends text to a group
+// with userIDs in its at-user list.
+func (p *Provider) SendTextMentions(ctx context.Context, groupID string, text string, userIDs []string) (string, error) {
+	return p.sendText(ctx, groupID, text, userIDs)
+}
+
+func (p *Provider) sendText(ctx context.Context, toUser string, text string, atUserIDs []string) (string, error) {
 	delay, ok := p.riskControl.CheckMessage()
 	if !ok {
-		return "", fmt.Errorf("send text: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send text: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
 	resp, err := p.api.SendTextMessage(ctx, &sendTextRequest{
 		ToUserName: toUser,
 		Content:    text,
+		AtWxIDList: atUserIDs,
 	})
 	if err != nil {
 		return "", fmt.Errorf("send text: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
 // SendImage sends an image via POST /message/SendImageMessage.
 func (p *Provider) SendImage(ctx context.Context, toUser string, data io.Reader, filename string) (string, error) {
 	delay, ok := p.riskControl.CheckMedia()
 	if !ok {
-		return "", fmt.Errorf("send image: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send image: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	b64, err := EncodeMediaToBase64(data)
+	b64, err := EncodeMediaToBase64(p.limitMedia(data))
 	if err != nil {
 		return "", fmt.Errorf("encode image: %w", err)
 	}
@@ -430,34 +533,33 @@ func (p *Provider) SendImage(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("send image: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
-// SendVideo sends a video via POST /message/CdnUploadVideo.
+// SendVideo sends a video via POST /message/CdnUploadVideo. The play length
+// WeChat shows on the video card is read from the MP4 header.
 func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader, filename string, thumb io.Reader) (string, error) {
 	delay, ok := p.riskControl.CheckMedia()
 	if !ok {
-		return "", fmt.Errorf("send video: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send video: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	videoB64, err := EncodeMediaToBase64(data)
+	video, err := wechat.ReadMedia(data, p.maxMediaSize())
 	if err != nil {
-		return "", fmt.Errorf("encode video: %w", err)
+		return "", fmt.Errorf("read video: %w", err)
 	}
 
 	req := &sendVideoRequest{
 		ToUserName: toUser,
-		VideoData:  videoB64,
+		VideoData:  base64.StdEncoding.EncodeToString(video),
+		PlayLength: mp4DurationSeconds(video),
 	}
 	if thumb != nil {
-		thumbB64, err := EncodeMediaToBase64(thumb)
+		thumbB64, err := EncodeMediaToBase64(p.limitMedia(thumb))
 		if err != nil {
 			return "", fmt.Errorf("encode video thumbnail: %w", err)
 		}
@@ -468,24 +570,21 @@ func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("send video: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
 // SendVoice sends a voice message via POST /message/SendVoice.
 func (p *Provider) SendVoice(ctx context.Context, toUser string, data io.Reader, duration int) (string, error) {
 	delay, ok := p.riskControl.CheckMedia()
 	if !ok {
-		return "", fmt.Errorf("send voice: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send voice: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	b64, err := EncodeMediaToBase64(data)
+	b64, err := EncodeMediaToBase64(p.limitMedia(data))
 	if err != nil {
 		return "", fmt.Errorf("encode voice: %w", err)
 	}
@@ -497,24 +596,21 @@ func (p *Provider) SendVoice(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("send voice: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
 // SendFile sends a file via POST /message/sendFile.
 func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader, filename string) (string, error) {
 	delay, ok := p.riskControl.CheckMedia()
 	if !ok {
-		return "", fmt.Errorf("send file: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send file: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
-	fileB64, err := EncodeMediaToBase64(data)
+	fileB64, err := EncodeMediaToBase64(p.limitMedia(data))
 	if err != nil {
 		return "", fmt.Errorf("encode file: %w", err)
 	}
@@ -527,23 +623,45 @@ func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("send file: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
-// SendLocation sends a location message. WeChatPadPro doesn't have a dedicated
-// location endpoint, so we format it as a text message with coordinates.
+// locationRetryInterval is how long SendLocation sends text before trying
+// the location endpoint again on a server that didn't have it.
+const locationRetryInterval = time.Hour
+
+// SendLocation sends a native location card via POST /message/SendLocation.
+// Servers without that endpoint get a text message with the coordinates
+// instead; after such an answer the endpoint is tried again only once
+// locationRetryInterval has passed, in case the server was upgraded.
 // Note: delegates to the API directly (not via p.SendText) to avoid double risk control counting.
 func (p *Provider) SendLocation(ctx context.Context, toUser string, loc *wechat.LocationInfo) (string, error) {
 	delay, ok := p.riskControl.CheckMessage()
 	if !ok {
-		return "", fmt.Errorf("send location: rate limited (%s)", p.riskControl.StatsString())
-	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
+		return "", fmt.Errorf("send location: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
+	}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
+	}
+	defer p.observeSend(time.Now())
+
+	if p.now().UnixNano() >= p.locationUnsupportedUntil.Load() {
+		resp, err := p.api.SendLocationMessage(ctx, &sendLocationRequest{
+			ToUserName: toUser,
+			Latitude:   loc.Latitude,
+			Longitude:  loc.Longitude,
+			Label:      loc.Label,
+			Poiname:    loc.Poiname,
+		})
+		if err == nil {
+			return p.acks.sent(formatMsgID(resp)), nil
 		}
+		if !errors.Is(err, wechat.ErrNotSupported) {
+			return "", fmt.Errorf("send location: %w", err)
+		}
+		p.log.Info("location endpoint not available, sending locations as text",
+			"error", err, "retry_in", locationRetryInterval)
+		p.locationUnsupportedUntil.Store(p.now().Add(locationRetryInterval).UnixNano())
 	}
 
 	text := fmt.Sprintf("[Location] %s\n%s\nhttps://uri.amap.com/marker?position=%f,%f",
@@ -555,7 +673,7 @@ func (p *Provider) SendLocation(ctx context.Context, toUser string, loc *wechat.
 	if err != nil {
 		return "", fmt.Errorf("send location: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
 }
 
 // SendLink sends a link card message. WeChatPadPro doesn't have a direct link card
@@ -564,15 +682,12 @@ func (p *Provider) SendLocation(ctx context.Context, toUser string, loc *wechat.
 func (p *Provider) SendLink(ctx context.Context, toUser string, link *wechat.LinkCardInfo) (string, error) {
 	delay, ok := p.riskControl.CheckMessage()
 	if !ok {
-		return "", fmt.Errorf("send link: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("send link: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
-	if delay > 0 {
-		select {
-		case <-time.After(delay):
-		case <-ctx.Done():
-			return "", ctx.Err()
-		}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return "", err
 	}
+	defer p.observeSend(time.Now())
 
 	text := fmt.Sprintf("[Link] %s\n%s\n%s", link.Title, link.Description, link.URL)
 	resp, err := p.api.SendTextMessage(ctx, &sendTextRequest{
@@ -582,7 +697,32 @@ func (p *Provider) SendLink(ctx context.Context, toUser string, link *wechat.Lin
 	if err != nil {
 		return "", fmt.Errorf("send link: %w", err)
 	}
-	return formatMsgID(resp), nil
+	return p.acks.sent(formatMsgID(resp)), nil
+}
+
+// waitRiskDelay waits out a delay imposed by risk control before a send,
+// reporting it to the send observer.
+func (p *Provider) waitRiskDelay(ctx context.Context, delay time.Duration) error {
+	if p.sends != nil {
+		p.sends.ObserveRiskControlDelay(delay)
+	}
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observeSend reports the duration of a send started at start, after its
+// risk-control delay, to the send observer.
+func (p *Provider) observeSend(start time.Time) {
+	if p.sends != nil {
+		p.sends.ObserveWeChatSend(time.Since(start))
+	}
 }
 
 // RevokeMessage revokes a sent message via POST /message/RevokeMsg.
@@ -594,6 +734,78 @@ func (p *Provider) RevokeMessage(ctx context.Context, msgID string, toUser strin
 	})
 }
 
+// SendPat pats a user via POST /message/SendPat. In a private chat the
+// chat partner is patted.
+func (p *Provider) SendPat(ctx context.Context, chatID string, userID string) error {
+	if userID == "" {
+		userID = chatID
+	}
+	delay, ok := p.riskControl.CheckMessage()
+	if !ok {
+		return fmt.Errorf("send pat: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
+	}
+	if err := p.waitRiskDelay(ctx, delay); err != nil {
+		return err
+	}
+	defer p.observeSend(time.Now())
+
+	if err := p.api.SendPat(ctx, &sendPatRequest{
+		ChatUserName: chatID,
+		PatUserName:  userID,
+	}); err != nil {
+		return fmt.Errorf("send pat: %w", err)
+	}
+	return nil
+}
+
+// MarkRead is not supported by WeChatPadPro; the bridge skips it because
+// Capabilities().ReadReceipt is false.
+func (p *Provider) MarkRead(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("padpro: read receipts %w", wechat.ErrNotSupported)
+}
+
+// SendTyping is a no-op: WeChatPadPro has no endpoint for the typing
+// indicator, so Capabilities().Typing is false.
+func (p *Provider) SendTyping(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+// --- History ---
+
+// GetRecentMessages returns up to limit of a chat's newest messages, oldest
+// first.
+// Uses: POST /message/GetChatHistory
+func (p *Provider) GetRecentMessages(ctx context.Context, chatID string, limit int) ([]*wechat.Message, error) {
+	raws, err := p.api.GetChatHistory(ctx, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get chat history: %w", err)
+	}
+	messages := make([]*wechat.Message, 0, len(raws))
+	for _, raw := range raws {
+		if msg := convertWSMessage(raw); msg != nil {
+			messages = append(messages, msg)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp < messages[j].Timestamp
+	})
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+// --- Moments ---
+
+// GetMoments returns the newest entries of the account's Moments feed.
+// Uses: POST /sns/GetSnsSync
+func (p *Provider) GetMoments(ctx context.Context) ([]*wechat.MomentEntry, error) {
+	if p.moments == nil {
+		return nil, fmt.Errorf("padpro provider not initialized")
+	}
+	return p.moments.GetTimeline(ctx)
+}
+
 // --- Contacts ---
 // Uses WeChatPadPro's /friend/* endpoints with nested {str:""} response format.
 
@@ -608,30 +820,80 @@ func (p *Provider) GetContactList(ctx context.Context) ([]*wechat.ContactInfo, e
 	if len(friendIDs) == 0 {
 		return nil, nil
 	}
+	return p.getContactDetails(ctx, friendIDs), nil
+}
 
-	// Batch fetch details (WeChatPadPro limits batch size, process in chunks)
-	const batchSize = 50
-	var contacts []*wechat.ContactInfo
+// ForEachContactPage fetches the friend wxid list once, then the details of
+// pageSize friends at a time, so only one page of details is held in memory.
+func (p *Provider) ForEachContactPage(ctx context.Context, pageSize int, fn func([]*wechat.ContactInfo) error) error {
+	friendIDs, err := p.api.GetFriendList(ctx)
+	if err != nil {
+		return fmt.Errorf("get friend list: %w", err)
+	}
+	if pageSize <= 0 {
+		pageSize = len(friendIDs)
+	}
 
-	for i := 0; i < len(friendIDs); i += batchSize {
-		end := i + batchSize
+	for start := 0; start < len(friendIDs); start += pageSize {
+		end := start + pageSize
 		if end > len(friendIDs) {
 			end = len(friendIDs)
 		}
-		batch := friendIDs[i:end]
+		if err := fn(p.getContactDetails(ctx, friendIDs[start:end])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		entries, err := p.api.GetContactDetailsList(ctx, batch)
-		if err != nil {
-			p.log.Warn("batch contact detail fetch failed", "error", err, "batch_start", i)
-			continue
+// getContactDetails batch-fetches the details of the given friends.
+// Uses: POST /friend/GetContactDetailsList
+func (p *Provider) getContactDetails(ctx context.Context, friendIDs []string) []*wechat.ContactInfo {
+	// Batch fetch details (WeChatPadPro limits batch size, process in chunks).
+	// Batches run concurrently up to contactFetchConcurrency; a failed batch
+	// is logged and skipped without affecting the others.
+	const batchSize = 50
+	numBatches := (len(friendIDs) + batchSize - 1) / batchSize
+	results := make([][]contactEntry, numBatches)
+
+	concurrency := p.contactFetchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultContactFetchConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for b := 0; b < numBatches; b++ {
+		start := b * batchSize
+		end := start + batchSize
+		if end > len(friendIDs) {
+			end = len(friendIDs)
 		}
+		batch := friendIDs[start:end]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(b, start int, batch []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			entries, err := p.api.GetContactDetailsList(ctx, batch)
+			if err != nil {
+				p.log.Warn("batch contact detail fetch failed", "error", err, "batch_start", start)
+				return
+			}
+			results[b] = entries
+		}(b, start, batch)
+	}
+	wg.Wait()
 
+	var contacts []*wechat.ContactInfo
+	for _, entries := range results {
 		for _, entry := range entries {
 			contacts = append(contacts, convertContactEntry(entry))
 		}
 	}
-
-	return contacts, nil
+	return contacts
 }
 
 // GetContactInfo returns info for a specific contact.
@@ -691,11 +953,32 @@ func (p *Provider) GetUserAvatar(ctx context.Context, userID string) ([]byte, st
 // Uses: POST /friend/AgreeAdd
 func (p *Provider) AcceptFriendRequest(ctx context.Context, xml string) error {
 	if !p.riskControl.CheckFriendOperation() {
-		return fmt.Errorf("accept friend: rate limited (%s)", p.riskControl.StatsString())
+		return fmt.Errorf("accept friend: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
 	return p.api.AgreeAdd(ctx, xml, "", 3)
 }
 
+// defaultFriendRequestScene is the scene sent with a friend request when
+// the contact card didn't name one: 17 means "added via a contact card".
+const defaultFriendRequestScene = 17
+
+// AddFriend sends a friend request to a contact shared as a card or
+// recommended by WeChat.
+// Uses: POST /friend/SendFriendRequest
+func (p *Provider) AddFriend(ctx context.Context, card *wechat.ContactCard, greeting string) error {
+	if card.UserID == "" || card.Ticket == "" {
+		return fmt.Errorf("add friend: contact card has no verification ticket")
+	}
+	if !p.riskControl.CheckFriendOperation() {
+		return fmt.Errorf("add friend: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
+	}
+	scene := card.Scene
+	if scene == 0 {
+		scene = defaultFriendRequestScene
+	}
+	return p.api.SendFriendRequest(ctx, card.UserID, card.Ticket, scene, greeting)
+}
+
 // SetContactRemark sets the remark name for a contact.
 // Uses: POST /friend/SetRemark
 func (p *Provider) SetContactRemark(ctx context.Context, userID string, remark string) error {
@@ -750,10 +1033,11 @@ func (p *Provider) GetGroupInfo(ctx context.Context, groupID string) (*wechat.Co
 		return nil, fmt.Errorf("get group info: %w", err)
 	}
 	return &wechat.ContactInfo{
-		UserID:      info.ChatRoomName.Str,
-		Nickname:    info.NickName.Str,
-		IsGroup:     true,
-		MemberCount: info.MemberCount,
+		UserID:       info.ChatRoomName.Str,
+		Nickname:     info.NickName.Str,
+		IsGroup:      true,
+		MemberCount:  info.MemberCount,
+		Announcement: info.Announcement,
 	}, nil
 }
 
@@ -762,7 +1046,7 @@ func (p *Provider) GetGroupInfo(ctx context.Context, groupID string) (*wechat.Co
 // Note: WeChat requires at least 3 members (including self) to create a group.
 func (p *Provider) CreateGroup(ctx context.Context, name string, members []string) (string, error) {
 	if !p.riskControl.CheckGroupOperation() {
-		return "", fmt.Errorf("create group: rate limited (%s)", p.riskControl.StatsString())
+		return "", fmt.Errorf("create group: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
 
 	resp, err := p.api.CreateChatRoom(ctx, members)
@@ -784,7 +1068,7 @@ func (p *Provider) CreateGroup(ctx context.Context, name string, members []strin
 // Uses: POST /group/AddChatRoomMembers
 func (p *Provider) InviteToGroup(ctx context.Context, groupID string, userIDs []string) error {
 	if !p.riskControl.CheckGroupOperation() {
-		return fmt.Errorf("invite to group: rate limited (%s)", p.riskControl.StatsString())
+		return fmt.Errorf("invite to group: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
 	return p.api.AddChatRoomMembers(ctx, groupID, userIDs)
 }
@@ -793,7 +1077,7 @@ func (p *Provider) InviteToGroup(ctx context.Context, groupID string, userIDs []
 // Uses: POST /group/DelChatRoomMembers
 func (p *Provider) RemoveFromGroup(ctx context.Context, groupID string, userIDs []string) error {
 	if !p.riskControl.CheckGroupOperation() {
-		return fmt.Errorf("remove from group: rate limited (%s)", p.riskControl.StatsString())
+		return fmt.Errorf("remove from group: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
 	}
 	return p.api.DelChatRoomMembers(ctx, groupID, userIDs)
 }
@@ -816,12 +1100,31 @@ func (p *Provider) LeaveGroup(ctx context.Context, groupID string) error {
 	return p.api.QuitChatRoom(ctx, groupID)
 }
 
+// RespondGroupInvite joins a group by following its invite link. WeChat has
+// no decline operation; an unanswered invitation simply expires.
+// Uses: POST /group/ScanIntoUrlGroup
+func (p *Provider) RespondGroupInvite(ctx context.Context, invite *wechat.GroupInvite, accept bool) error {
+	if !accept {
+		return nil
+	}
+	if invite.URL == "" {
+		return fmt.Errorf("accept group invite: missing invite URL")
+	}
+	if !p.riskControl.CheckGroupOperation() {
+		return fmt.Errorf("accept group invite: %w (%s)", wechat.ErrRateLimited, p.riskControl.StatsString())
+	}
+	return p.api.ScanIntoURLGroup(ctx, invite.URL)
+}
+
 // --- Media ---
 
 // DownloadMedia downloads media from a message.
 // For WeChatPadPro, media URLs are typically CDN URLs that can be fetched directly.
 func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
 	if len(msg.MediaData) > 0 {
+		if err := wechat.CheckMediaSize(int64(len(msg.MediaData)), p.maxMediaSize()); err != nil {
+			return nil, "", err
+		}
 		return io.NopCloser(bytes.NewReader(msg.MediaData)), guessMimeType(msg), nil
 	}
 
@@ -829,12 +1132,20 @@ func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.R
 		return nil, "", fmt.Errorf("no media URL in message")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, msg.MediaURL, nil)
+	return p.downloadMediaURL(ctx, msg, msg.MediaURL)
+}
+
+func (p *Provider) downloadMediaURL(ctx context.Context, msg *wechat.Message, url string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, "", err
 	}
 
-	httpCli := &http.Client{Timeout: 60 * time.Second}
+	timeout := p.httpTimeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	httpCli := &http.Client{Timeout: timeout}
 	resp, err := httpCli.Do(req)
 	if err != nil {
 		return nil, "", fmt.Errorf("download media: %w", err)
@@ -842,15 +1153,68 @@ func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.R
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		resp.Body.Close()
+		if wechat.IsMediaExpiredStatus(resp.StatusCode) {
+			return nil, "", fmt.Errorf("media download HTTP %d: %w", resp.StatusCode, wechat.ErrMediaExpired)
+		}
 		return nil, "", fmt.Errorf("media download HTTP %d", resp.StatusCode)
 	}
+	if err := wechat.CheckMediaSize(resp.ContentLength, p.maxMediaSize()); err != nil {
+		resp.Body.Close()
+		return nil, "", err
+	}
 
 	contentType := resp.Header.Get("Content-Type")
 	if contentType == "" {
 		contentType = guessMimeType(msg)
 	}
 
-	return resp.Body, contentType, nil
+	return wechat.LimitMedia(resp.Body, p.maxMediaSize()), contentType, nil
+}
+
+// RefetchMedia implements wechat.MediaRefetcher. It downloads a message
+// whose CDN URL expired from a fresh URL requested for its media ID. The API
+// returns no URL, or answers 404 or 410, for media WeChat no longer has,
+// which fails with wechat.ErrMediaExpired.
+func (p *Provider) RefetchMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
+	mediaID := msg.Extra[wechat.ExtraMediaID]
+	if mediaID == "" {
+		return nil, "", fmt.Errorf("refetch media: no media ID: %w", wechat.ErrMediaExpired)
+	}
+	if p.api == nil {
+		return nil, "", fmt.Errorf("refetch media: provider not initialized")
+	}
+	url, err := p.api.GetMediaURL(ctx, mediaID)
+	if status := wechat.HTTPStatus(err); status == http.StatusNotFound || status == http.StatusGone {
+		url, err = "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("refresh media URL: %w", err)
+	}
+	if url == "" {
+		return nil, "", fmt.Errorf("media %s is no longer available on WeChat: %w", mediaID, wechat.ErrMediaExpired)
+	}
+	p.log.Debug("refreshed expired media URL", "msg_id", msg.MsgID, "media_id", mediaID)
+	return p.downloadMediaURL(ctx, msg, url)
+}
+
+// maxMediaSize returns the configured media size limit, 0 meaning none.
+func (p *Provider) maxMediaSize() int64 {
+	if p.cfg == nil {
+		return 0
+	}
+	return p.cfg.MaxMediaSize
+}
+
+// limitMedia caps media read from r at the configured size limit.
+func (p *Provider) limitMedia(r io.Reader) io.Reader {
+	return wechat.LimitMedia(io.NopCloser(r), p.maxMediaSize())
+}
+
+// --- Stats ---
+
+// RiskLimits implements wechat.RiskLimitReporter.
+func (p *Provider) RiskLimits() []wechat.RiskLimit {
+	return p.riskControl.Limits()
 }
 
 // --- Internal helpers ---
@@ -860,9 +1224,7 @@ func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.R
 func (p *Provider) wsEventLoop(stopCh chan struct{}) {
 	p.log.Info("WebSocket event loop started")
 
-	backoff := time.Second
-	maxBackoff := 30 * time.Second
-
+	backoff := wsMinBackoff
 	for {
 		select {
 		case <-stopCh:
@@ -871,33 +1233,67 @@ func (p *Provider) wsEventLoop(stopCh chan struct{}) {
 		default:
 		}
 
-		if err := p.ws.connect(stopCh); err != nil {
-			p.log.Error("WebSocket connection error, reconnecting",
-				"error", err, "backoff", backoff)
+		connectedAt := time.Now()
+		err := p.ws.connect(stopCh)
+		select {
+		case <-stopCh:
+			p.log.Info("WebSocket event loop stopped")
+			return
+		default:
+		}
 
-			select {
-			case <-stopCh:
-				return
-			case <-time.After(backoff):
-			}
+		var wait time.Duration
+		wait, backoff = nextWSBackoff(backoff, time.Since(connectedAt))
+		p.log.Error("WebSocket connection lost, reconnecting",
+			"error", err, "backoff", wait)
 
-			// Exponential backoff
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
-			}
-		} else {
-			// Reset backoff on successful connection
-			backoff = time.Second
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(wait):
 		}
+		if p.ws.observer != nil {
+			p.ws.observer.WebSocketReconnecting()
+		}
+	}
+}
+
+const (
+	wsMinBackoff = time.Second
+	wsMaxBackoff = 30 * time.Second
+
+	// wsStableUptime is how long a connection must stay up before the
+	// reconnect backoff starts over.
+	wsStableUptime = 60 * time.Second
+)
+
+// nextWSBackoff returns how long to wait before reconnecting after a
+// connection that lasted uptime, and the backoff for the attempt after that.
+// Connections that drop right after connecting keep growing the backoff so
+// a server that accepts and immediately closes can't cause a reconnect storm.
+func nextWSBackoff(backoff, uptime time.Duration) (wait, next time.Duration) {
+	if uptime >= wsStableUptime {
+		backoff = wsMinBackoff
+	}
+	next = backoff * 2
+	if next > wsMaxBackoff {
+		next = wsMaxBackoff
 	}
+	return backoff, next
 }
 
 // prepareCallbackServer binds the local HTTP server used for webhook callbacks.
 func (p *Provider) prepareCallbackServer(port int) error {
+	var handler wechat.MessageHandler = p.handler
+	if p.acks != nil {
+		handler = p.acks
+	}
+	if p.reorder != nil {
+		handler = p.reorder
+	}
 	webhookHandler := NewWebhookHandler(
 		p.log.With("component", "webhook"),
-		p.handler,
+		handler,
 	)
 
 	mux := http.NewServeMux()
@@ -1,9 +1,12 @@
 package padpro
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -33,9 +36,22 @@ func (h *asyncLoginHandler) OnContactUpdate(context.Context, *wechat.ContactInfo
 func (h *asyncLoginHandler) OnGroupMemberUpdate(context.Context, string, []*wechat.GroupMember) error {
 	return nil
 }
-func (h *asyncLoginHandler) OnPresence(context.Context, string, bool) error { return nil }
-func (h *asyncLoginHandler) OnTyping(context.Context, string, string) error { return nil }
-func (h *asyncLoginHandler) OnRevoke(context.Context, string, string) error { return nil }
+func (h *asyncLoginHandler) OnPresence(context.Context, string, bool) error         { return nil }
+func (h *asyncLoginHandler) OnTyping(context.Context, string, string) error         { return nil }
+func (h *asyncLoginHandler) OnRevoke(context.Context, string, string, string) error { return nil }
+func (h *asyncLoginHandler) OnFriendRequest(context.Context, *wechat.FriendRequest) error {
+	return nil
+}
+
+func (h *asyncLoginHandler) OnSendAck(context.Context, string) error { return nil }
+
+func (h *asyncLoginHandler) OnMessageReaction(context.Context, *wechat.MessageReaction) error {
+	return nil
+}
+
+func (h *asyncLoginHandler) OnContactAdded(context.Context, *wechat.ContactInfo) error {
+	return nil
+}
 
 func (h *asyncLoginHandler) OnLoginEvent(_ context.Context, evt *wechat.LoginEvent) error {
 	copyEvt := *evt
@@ -110,6 +126,215 @@ func TestProvider_Init_UsesAuthKeyFallback(t *testing.T) {
 	}
 }
 
+func TestProvider_Init_HTTPTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra map[string]string
+		want  time.Duration
+	}{
+		{"default", map[string]string{}, 30 * time.Second},
+		{"configured", map[string]string{"http_timeout_s": "90"}, 90 * time.Second},
+		{"invalid", map[string]string{"http_timeout_s": "abc"}, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{}
+			err := p.Init(&wechat.ProviderConfig{
+				APIEndpoint: "http://padpro.example.com:1239",
+				APIToken:    "token",
+				Extra:       tt.extra,
+			}, nil)
+			if err != nil {
+				t.Fatalf("Init error: %v", err)
+			}
+			if p.httpTimeout != tt.want {
+				t.Errorf("httpTimeout = %v, want %v", p.httpTimeout, tt.want)
+			}
+			if p.api.httpCli.Timeout != tt.want {
+				t.Errorf("api client timeout = %v, want %v", p.api.httpCli.Timeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_GetContactList_BoundedConcurrentBatches(t *testing.T) {
+	const friends = 260 // six batches of up to 50
+	var friendIDs []string
+	for i := 0; i < friends; i++ {
+		friendIDs = append(friendIDs, fmt.Sprintf("wxid_%03d", i))
+	}
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/friend/GetFriendList":
+			data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"friends": friendIDs}})
+			w.Write(data)
+		case "/friend/GetContactDetailsList":
+			var req contactDetailRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+			mu.Lock()
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+
+			var contacts []map[string]interface{}
+			for _, id := range req.UserNames {
+				contacts = append(contacts, map[string]interface{}{"user_name": map[string]string{"str": id}})
+			}
+			data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"contacts": contacts}})
+			w.Write(data)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{"contact_fetch_concurrency": "2"},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	contacts, err := p.GetContactList(context.Background())
+	if err != nil {
+		t.Fatalf("GetContactList error: %v", err)
+	}
+	if len(contacts) != friends {
+		t.Fatalf("got %d contacts, want %d", len(contacts), friends)
+	}
+	for i, c := range contacts {
+		if c.UserID != friendIDs[i] {
+			t.Fatalf("contacts[%d] = %s, want %s", i, c.UserID, friendIDs[i])
+		}
+	}
+	if peak > 2 {
+		t.Fatalf("peak concurrent batches = %d, want at most 2", peak)
+	}
+	if peak < 2 {
+		t.Fatalf("peak concurrent batches = %d, batches were not fetched in parallel", peak)
+	}
+}
+
+func TestProvider_GetContactList_FailedBatchIsSkipped(t *testing.T) {
+	var friendIDs []string
+	for i := 0; i < 120; i++ {
+		friendIDs = append(friendIDs, fmt.Sprintf("wxid_%03d", i))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/friend/GetFriendList" {
+			data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"friends": friendIDs}})
+			w.Write(data)
+			return
+		}
+		var req contactDetailRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.UserNames[0] == "wxid_050" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var contacts []map[string]interface{}
+		for _, id := range req.UserNames {
+			contacts = append(contacts, map[string]interface{}{"user_name": map[string]string{"str": id}})
+		}
+		data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"contacts": contacts}})
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	contacts, err := p.GetContactList(context.Background())
+	if err != nil {
+		t.Fatalf("GetContactList error: %v", err)
+	}
+	// The second batch (wxid_050..wxid_099) fails; the other 70 survive.
+	if len(contacts) != 70 || contacts[49].UserID != "wxid_049" || contacts[50].UserID != "wxid_100" {
+		t.Fatalf("got %d contacts, want the 70 from the successful batches", len(contacts))
+	}
+}
+
+func TestProvider_ForEachContactPage_FetchesPagesOnDemand(t *testing.T) {
+	var friendIDs []string
+	for i := 0; i < 260; i++ {
+		friendIDs = append(friendIDs, fmt.Sprintf("wxid_%03d", i))
+	}
+
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/friend/GetFriendList" {
+			data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"friends": friendIDs}})
+			w.Write(data)
+			return
+		}
+		var req contactDetailRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requested = append(requested, req.UserNames...)
+		mu.Unlock()
+		var contacts []map[string]interface{}
+		for _, id := range req.UserNames {
+			contacts = append(contacts, map[string]interface{}{"user_name": map[string]string{"str": id}})
+		}
+		data, _ := json.Marshal(map[string]interface{}{"code": 0, "data": map[string]interface{}{"contacts": contacts}})
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	errStop := errors.New("stop")
+	var pages []int
+	err := p.ForEachContactPage(context.Background(), 100, func(page []*wechat.ContactInfo) error {
+		pages = append(pages, len(page))
+		if len(pages) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("ForEachContactPage error = %v, want the callback's error", err)
+	}
+	if len(pages) != 2 || pages[0] != 100 || pages[1] != 100 {
+		t.Fatalf("pages = %v, want two pages of 100", pages)
+	}
+	// Details past the second page are never fetched.
+	if len(requested) != 200 {
+		t.Fatalf("fetched details of %d friends, want 200", len(requested))
+	}
+}
+
 func TestFormatMsgID_PrefersNewMsgID(t *testing.T) {
 	id := formatMsgID(&sendMsgResponse{MsgID: 11, NewMsgID: 22})
 	if id != "22" {
@@ -346,7 +571,59 @@ func TestProvider_Login_DecodesQRCodeAndCompletesLogin(t *testing.T) {
 	}
 }
 
+func TestProvider_RestoreSession(t *testing.T) {
+	online := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login/GetLoginStatus" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !online {
+			_, _ = w.Write([]byte(`{"code":0,"data":{"online":false}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{"online":true,"user_name":"wxid_self","nick_name":"Bridge Bot"}}`))
+	}))
+	defer server.Close()
+
+	handler := newAsyncLoginHandler()
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{},
+	}, handler); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	online = false
+	if restored, err := p.RestoreSession(context.Background()); err != nil || restored {
+		t.Fatalf("RestoreSession while logged out = %v, %v", restored, err)
+	}
+	if p.GetLoginState() == wechat.LoginStateLoggedIn {
+		t.Fatal("logged out session was restored")
+	}
+
+	online = true
+	if restored, err := p.RestoreSession(context.Background()); err != nil || !restored {
+		t.Fatalf("RestoreSession = %v, %v", restored, err)
+	}
+	if p.GetLoginState() != wechat.LoginStateLoggedIn {
+		t.Fatalf("login state = %v", p.GetLoginState())
+	}
+	if self := p.GetSelf(); self == nil || self.UserID != "wxid_self" || self.Nickname != "Bridge Bot" {
+		t.Fatalf("unexpected self: %+v", self)
+	}
+	// The bridge hears of the restored session like of a QR login
+	if len(handler.events) != 1 || handler.events[0].State != wechat.LoginStateLoggedIn ||
+		handler.events[0].UserID != "wxid_self" || handler.events[0].Name != "Bridge Bot" {
+		t.Fatalf("login events = %+v, want one logged-in event", handler.events)
+	}
+}
+
 func TestProvider_SendVideo_EncodesMediaAndThumbnail(t *testing.T) {
+	video := testMP4(1000, 11_500)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/message/CdnUploadVideo" {
 			t.Fatalf("path = %s", r.URL.Path)
@@ -359,9 +636,12 @@ func TestProvider_SendVideo_EncodesMediaAndThumbnail(t *testing.T) {
 		if req.ToUserName != "wxid_target" {
 			t.Fatalf("to_user_name = %s", req.ToUserName)
 		}
-		if req.VideoData != base64.StdEncoding.EncodeToString([]byte("video-bytes")) {
+		if req.VideoData != base64.StdEncoding.EncodeToString(video) {
 			t.Fatalf("video_data = %s", req.VideoData)
 		}
+		if req.PlayLength != 12 {
+			t.Fatalf("play_length = %d", req.PlayLength)
+		}
 		if req.ThumbData != base64.StdEncoding.EncodeToString([]byte("thumb-bytes")) {
 			t.Fatalf("thumb_data = %s", req.ThumbData)
 		}
@@ -380,7 +660,7 @@ func TestProvider_SendVideo_EncodesMediaAndThumbnail(t *testing.T) {
 		t.Fatalf("Init error: %v", err)
 	}
 
-	msgID, err := p.SendVideo(context.Background(), "wxid_target", strings.NewReader("video-bytes"), "clip.mp4", strings.NewReader("thumb-bytes"))
+	msgID, err := p.SendVideo(context.Background(), "wxid_target", bytes.NewReader(video), "clip.mp4", strings.NewReader("thumb-bytes"))
 	if err != nil {
 		t.Fatalf("SendVideo error: %v", err)
 	}
@@ -389,6 +669,161 @@ func TestProvider_SendVideo_EncodesMediaAndThumbnail(t *testing.T) {
 	}
 }
 
+func TestProvider_SendTextMentions_SendsAtUserList(t *testing.T) {
+	var got sendTextRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message/SendTextMessage" {
+			t.Fatalf("path = %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"msg_id":11,"new_msg_id":33}}`))
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL, APIToken: "token", Extra: map[string]string{}}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	var sender wechat.MentionSender = p
+	if _, err := sender.SendTextMentions(context.Background(), "123@chatroom", "@所有人 meeting at 3", []string{"notify@all"}); err != nil {
+		t.Fatalf("SendTextMentions error: %v", err)
+	}
+	if got.ToUserName != "123@chatroom" || len(got.AtWxIDList) != 1 || got.AtWxIDList[0] != "notify@all" {
+		t.Fatalf("request = %+v", got)
+	}
+}
+
+func TestProvider_SendLocation_SendsNativeCard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message/SendLocation" {
+			t.Fatalf("path = %s", r.URL.Path)
+		}
+		var req sendLocationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		want := sendLocationRequest{ToUserName: "wxid_target", Latitude: 23.1291, Longitude: 113.2644, Label: "Tianhe, Guangzhou", Poiname: "Canton Tower"}
+		if req != want {
+			t.Fatalf("request = %+v, want %+v", req, want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"msg_id":11,"new_msg_id":33}}`))
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL, APIToken: "token", Extra: map[string]string{}}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	msgID, err := p.SendLocation(context.Background(), "wxid_target", &wechat.LocationInfo{
+		Latitude: 23.1291, Longitude: 113.2644, Label: "Tianhe, Guangzhou", Poiname: "Canton Tower",
+	})
+	if err != nil {
+		t.Fatalf("SendLocation error: %v", err)
+	}
+	if msgID != "33" {
+		t.Fatalf("msgID = %s", msgID)
+	}
+}
+
+func TestProvider_SendLocation_FallsBackToTextWithoutEndpoint(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/message/SendTextMessage" {
+			http.NotFound(w, r)
+			return
+		}
+		var req sendTextRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if !strings.HasPrefix(req.Content, "[Location] Canton Tower\n") || !strings.Contains(req.Content, "position=113.264400,23.129100") {
+			t.Fatalf("content = %q", req.Content)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"msg_id":11,"new_msg_id":44}}`))
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{"message_interval_ms": "1"},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	loc := &wechat.LocationInfo{Latitude: 23.1291, Longitude: 113.2644, Label: "Tianhe, Guangzhou", Poiname: "Canton Tower"}
+	for i := 0; i < 2; i++ {
+		msgID, err := p.SendLocation(context.Background(), "wxid_target", loc)
+		if err != nil {
+			t.Fatalf("SendLocation error: %v", err)
+		}
+		if msgID != "44" {
+			t.Fatalf("msgID = %s", msgID)
+		}
+	}
+
+	want := []string{"/message/SendLocation", "/message/SendTextMessage", "/message/SendTextMessage"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Fatalf("requests = %v, want %v", paths, want)
+	}
+
+	// The endpoint is tried again once the retry interval has passed
+	now := time.Now().Add(locationRetryInterval + time.Minute)
+	p.now = func() time.Time { return now }
+	paths = nil
+	if _, err := p.SendLocation(context.Background(), "wxid_target", loc); err != nil {
+		t.Fatalf("SendLocation error: %v", err)
+	}
+	want = []string{"/message/SendLocation", "/message/SendTextMessage"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Fatalf("requests after the retry interval = %v, want %v", paths, want)
+	}
+}
+
+type recordingSendObserver struct {
+	delays []time.Duration
+	sends  []time.Duration
+}
+
+func (o *recordingSendObserver) ObserveRiskControlDelay(d time.Duration) {
+	o.delays = append(o.delays, d)
+}
+func (o *recordingSendObserver) ObserveWeChatSend(d time.Duration) { o.sends = append(o.sends, d) }
+
+func TestProvider_SendText_ObservesRiskDelayAndSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"msg_id":11,"new_msg_id":33}}`))
+	}))
+	defer server.Close()
+
+	obs := &recordingSendObserver{}
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{APIEndpoint: server.URL, APIToken: "token", Sends: obs, Extra: map[string]string{}}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	if _, err := p.SendText(context.Background(), "wxid_target", "hello"); err != nil {
+		t.Fatalf("SendText error: %v", err)
+	}
+	if len(obs.delays) != 1 {
+		t.Fatalf("risk control delays = %v, want one", obs.delays)
+	}
+	if len(obs.sends) != 1 || obs.sends[0] < 20*time.Millisecond {
+		t.Fatalf("send durations = %v, want one of at least 20ms", obs.sends)
+	}
+}
+
 func TestProvider_SendFile_EncodesData(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/message/sendFile" {
@@ -460,6 +895,161 @@ func TestProvider_DownloadMedia_UsesEmbeddedBytes(t *testing.T) {
 	}
 }
 
+func TestProvider_DownloadMedia_EnforcesSizeLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// No Content-Length, so the limit is only hit while reading
+			w.(http.Flusher).Flush()
+		}
+		w.Write(bytes.Repeat([]byte("x"), 64))
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint:  "http://127.0.0.1:1",
+		APIToken:     "token",
+		MaxMediaSize: 16,
+		Extra:        map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	if _, _, err := p.DownloadMedia(context.Background(), &wechat.Message{MediaURL: server.URL + "/sized"}); !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("sized download error = %v, want ErrMediaTooLarge", err)
+	}
+
+	reader, _, err := p.DownloadMedia(context.Background(), &wechat.Message{MediaURL: server.URL + "/chunked"})
+	if err != nil {
+		t.Fatalf("DownloadMedia error: %v", err)
+	}
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("chunked read error = %v, want ErrMediaTooLarge", err)
+	}
+}
+
+func TestProvider_RefetchMedia_RefreshesExpiredURL(t *testing.T) {
+	var serverURL string
+	var refreshed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/message/GetMediaUrl":
+			var req mediaURLRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			refreshed = append(refreshed, req.MediaID)
+			w.Header().Set("Content-Type", "application/json")
+			switch req.MediaID {
+			case "purged":
+				_, _ = w.Write([]byte(`{"code":0,"data":{"url":""}}`))
+				return
+			case "unknown":
+				http.Error(w, "no such media", http.StatusNotFound)
+				return
+			case "flaky":
+				http.Error(w, "try again", http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":0,"data":{"url":"` + serverURL + `/fresh"}}`))
+		case "/fresh":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("fresh"))
+		default:
+			http.Error(w, "gone", http.StatusGone)
+		}
+	}))
+	serverURL = server.URL
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	msg := &wechat.Message{
+		MediaURL: server.URL + "/expired",
+		Extra:    map[string]string{wechat.ExtraMediaID: "media-1"},
+	}
+	if _, _, err := p.DownloadMedia(context.Background(), msg); !errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("DownloadMedia error = %v, want ErrMediaExpired", err)
+	}
+	reader, mimeType, err := p.RefetchMedia(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("RefetchMedia error: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "fresh" || mimeType != "image/png" {
+		t.Fatalf("downloaded %q %s", data, mimeType)
+	}
+
+	for _, mediaID := range []string{"purged", "unknown"} {
+		_, _, err = p.RefetchMedia(context.Background(), &wechat.Message{
+			MediaURL: server.URL + "/expired",
+			Extra:    map[string]string{wechat.ExtraMediaID: mediaID},
+		})
+		if !errors.Is(err, wechat.ErrMediaExpired) || !strings.Contains(err.Error(), "no longer available") {
+			t.Fatalf("RefetchMedia(%s) error = %v, want permanently gone", mediaID, err)
+		}
+	}
+	_, _, err = p.RefetchMedia(context.Background(), &wechat.Message{
+		MediaURL: server.URL + "/expired",
+		Extra:    map[string]string{wechat.ExtraMediaID: "flaky"},
+	})
+	if err == nil || errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("RefetchMedia(flaky) error = %v, want a temporary failure", err)
+	}
+
+	if _, _, err := p.RefetchMedia(context.Background(), &wechat.Message{MediaURL: server.URL + "/expired"}); !errors.Is(err, wechat.ErrMediaExpired) {
+		t.Fatalf("RefetchMedia without media ID error = %v, want ErrMediaExpired", err)
+	}
+	if len(refreshed) != 4 || refreshed[0] != "media-1" || refreshed[1] != "purged" {
+		t.Fatalf("refreshed media IDs = %v", refreshed)
+	}
+}
+
+func TestProvider_GetRecentMessages(t *testing.T) {
+	var req chatHistoryRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message/GetChatHistory" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"data":{"messages":[
+			{"new_msg_id":3,"from_user_name":{"str":"wxid_bob"},"to_user_name":{"str":"wxid_me"},"msg_type":1,"content":{"str":"third"},"create_time":300},
+			{"new_msg_id":2,"from_user_name":{"str":"wxid_bob"},"to_user_name":{"str":"wxid_me"},"msg_type":1,"content":{"str":"second"},"create_time":200},
+			{"new_msg_id":1,"from_user_name":{"str":""},"msg_type":1,"create_time":100}
+		]}}`))
+	}))
+	defer server.Close()
+
+	p := &Provider{}
+	if err := p.Init(&wechat.ProviderConfig{
+		APIEndpoint: server.URL,
+		APIToken:    "token",
+		Extra:       map[string]string{},
+	}, nil); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	messages, err := p.GetRecentMessages(context.Background(), "wxid_bob", 20)
+	if err != nil {
+		t.Fatalf("GetRecentMessages error: %v", err)
+	}
+	if req.UserName != "wxid_bob" || req.Count != 20 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(messages) != 2 || messages[0].Content != "second" || messages[1].Content != "third" {
+		t.Fatalf("messages should be the valid ones, oldest first: %+v", messages)
+	}
+}
+
 func TestProvider_GetUserAvatar_RejectsHTTPError(t *testing.T) {
 	var serverURL string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,69 @@
+package padpro
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// emojiReactionXML is the system message WeChat syncs when someone reacts
+// to a message with an emoji (表情回应) or withdraws the reaction:
+//
+//	<sysmsg type="emojireaction">
+//	  <emojireaction>
+//	    <fromusername>wxid_bob</fromusername>
+//	    <newmsgid>1234567890</newmsgid>
+//	    <emoji>👍</emoji>
+//	    <optype>1</optype>
+//	  </emojireaction>
+//	</sysmsg>
+//
+// optype is 1 when the reaction is added and 2 when it is withdrawn.
+type emojiReactionXML struct {
+	Type     string `xml:"type,attr"`
+	Reaction struct {
+		FromUsername string `xml:"fromusername"`
+		NewMsgID     string `xml:"newmsgid"`
+		Emoji        string `xml:"emoji"`
+		OpType       int    `xml:"optype"`
+	} `xml:"emojireaction"`
+}
+
+// Values of emojiReactionXML's optype.
+const (
+	reactionOpAdd    = 1
+	reactionOpRemove = 2
+)
+
+// parseReaction returns the emoji reaction a system message reports, or nil
+// for any other message.
+func parseReaction(msg *wechat.Message) *wechat.MessageReaction {
+	if msg.Type != wechat.MsgSystem {
+		return nil
+	}
+	// Group system messages may carry a "chatroom:\n" prefix
+	start := strings.Index(msg.Content, "<sysmsg")
+	if start < 0 {
+		return nil
+	}
+
+	var parsed emojiReactionXML
+	if err := xml.Unmarshal([]byte(msg.Content[start:]), &parsed); err != nil || parsed.Type != "emojireaction" {
+		return nil
+	}
+	r := parsed.Reaction
+	if r.FromUsername == "" || r.NewMsgID == "" || r.Emoji == "" {
+		return nil
+	}
+	if r.OpType != reactionOpAdd && r.OpType != reactionOpRemove {
+		return nil
+	}
+	return &wechat.MessageReaction{
+		MsgID:   r.NewMsgID,
+		ChatID:  revokeChatID(msg),
+		UserID:  r.FromUsername,
+		Emoji:   r.Emoji,
+		Removed: r.OpType == reactionOpRemove,
+	}
+}
@@ -0,0 +1,89 @@
+package padpro
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// reactionWebhookFixture is a group emoji reaction as WeChatPadPro's webhook
+// delivers it.
+const reactionWebhookFixture = `{
+	"msg_id": 1027,
+	"new_msg_id": 7260917453829138455,
+	"from_user_name": {"str": "12345@chatroom"},
+	"to_user_name": {"str": "wxid_me"},
+	"msg_type": 10000,
+	"content": {"str": "12345@chatroom:\n<sysmsg type=\"emojireaction\"><emojireaction><fromusername>wxid_bob</fromusername><newmsgid>4611686018427387904</newmsgid><emoji>👍</emoji><optype>1</optype></emojireaction></sysmsg>"},
+	"create_time": 1700000000
+}`
+
+func TestWebhookHandler_DispatchesReaction(t *testing.T) {
+	th := &testHandler{}
+	handler := NewWebhookHandler(slog.Default(), th)
+
+	req := httptest.NewRequest(http.MethodPost, "/callback", bytes.NewBufferString(reactionWebhookFixture))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if len(th.messages) != 0 {
+		t.Fatalf("reaction bridged as %d messages", len(th.messages))
+	}
+	want := wechat.MessageReaction{MsgID: "4611686018427387904", ChatID: "12345@chatroom", UserID: "wxid_bob", Emoji: "👍"}
+	if len(th.reactions) != 1 || *th.reactions[0] != want {
+		t.Fatalf("reactions = %+v, want %+v", th.reactions, want)
+	}
+}
+
+func TestParseReaction(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *wechat.Message
+		want *wechat.MessageReaction
+	}{
+		{
+			name: "withdrawn in a direct chat",
+			msg: &wechat.Message{
+				Type:     wechat.MsgSystem,
+				FromUser: "wxid_bob",
+				Content:  `<sysmsg type="emojireaction"><emojireaction><fromusername>wxid_bob</fromusername><newmsgid>42</newmsgid><emoji>❤️</emoji><optype>2</optype></emojireaction></sysmsg>`,
+			},
+			want: &wechat.MessageReaction{MsgID: "42", ChatID: "wxid_bob", UserID: "wxid_bob", Emoji: "❤️", Removed: true},
+		},
+		{
+			name: "pat",
+			msg: &wechat.Message{
+				Type:     wechat.MsgSystem,
+				FromUser: "wxid_bob",
+				Content:  `<sysmsg type="pat"><pat><fromusername>wxid_bob</fromusername><pattedusername>wxid_me</pattedusername></pat></sysmsg>`,
+			},
+		},
+		{
+			name: "unknown operation",
+			msg: &wechat.Message{
+				Type:     wechat.MsgSystem,
+				FromUser: "wxid_bob",
+				Content:  `<sysmsg type="emojireaction"><emojireaction><fromusername>wxid_bob</fromusername><newmsgid>42</newmsgid><emoji>❤️</emoji><optype>9</optype></emojireaction></sysmsg>`,
+			},
+		},
+		{
+			name: "text",
+			msg:  &wechat.Message{Type: wechat.MsgText, FromUser: "wxid_bob", Content: `<sysmsg type="emojireaction"/>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseReaction(tt.msg)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("parseReaction = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package padpro
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// defaultReorderWindowMs applies when reorder_window_ms is not configured.
+const defaultReorderWindowMs = 300
+
+// reorderingHandler holds incoming messages, recalls and reactions for a
+// short window and delivers them ordered by message time. WeChatPadPro may
+// push messages slightly out of order, mostly while catching up after a
+// reconnect. Other callbacks pass straight through.
+type reorderingHandler struct {
+	wechat.MessageHandler
+	log    *slog.Logger
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []*reorderItem // ordered by ts, then arrival
+	seq     uint64
+	timer   *time.Timer
+
+	// Serializes deliveries so that consecutive flushes stay in order.
+	deliverMu sync.Mutex
+}
+
+type reorderItem struct {
+	ts       int64 // message time in milliseconds
+	seq      uint64
+	deadline time.Time
+	deliver  func()
+}
+
+func newReorderingHandler(handler wechat.MessageHandler, window time.Duration, log *slog.Logger) *reorderingHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &reorderingHandler{
+		MessageHandler: handler,
+		log:            log,
+		window:         window,
+	}
+}
+
+// OnMessage buffers msg; the error of the delayed delivery is logged.
+func (h *reorderingHandler) OnMessage(ctx context.Context, msg *wechat.Message) error {
+	// Webhook request contexts end before the message is delivered.
+	ctx = context.WithoutCancel(ctx)
+	h.add(msg.Timestamp, func() {
+		if err := h.MessageHandler.OnMessage(ctx, msg); err != nil {
+			h.log.Error("handle message failed", "error", err, "msg_id", msg.MsgID)
+		}
+	})
+	return nil
+}
+
+// OnRevoke buffers a recall behind any message it may refer to that is
+// still held.
+func (h *reorderingHandler) OnRevoke(ctx context.Context, chatID, msgID, replaceMsg string) error {
+	ctx = context.WithoutCancel(ctx)
+	h.add(time.Now().UnixMilli(), func() {
+		if err := h.MessageHandler.OnRevoke(ctx, chatID, msgID, replaceMsg); err != nil {
+			h.log.Error("handle revoke failed", "error", err, "msg_id", msgID)
+		}
+	})
+	return nil
+}
+
+// OnMessageReaction buffers a reaction behind the message it refers to, if
+// that is still held.
+func (h *reorderingHandler) OnMessageReaction(ctx context.Context, reaction *wechat.MessageReaction) error {
+	ctx = context.WithoutCancel(ctx)
+	h.add(time.Now().UnixMilli(), func() {
+		if err := h.MessageHandler.OnMessageReaction(ctx, reaction); err != nil {
+			h.log.Error("handle reaction failed", "error", err, "msg_id", reaction.MsgID)
+		}
+	})
+	return nil
+}
+
+func (h *reorderingHandler) add(ts int64, deliver func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	item := &reorderItem{ts: ts, seq: h.seq, deadline: time.Now().Add(h.window), deliver: deliver}
+	i := sort.Search(len(h.pending), func(i int) bool { return h.pending[i].ts > ts })
+	h.pending = append(h.pending, nil)
+	copy(h.pending[i+1:], h.pending[i:])
+	h.pending[i] = item
+
+	if h.timer == nil {
+		h.timer = time.AfterFunc(h.window, h.flush)
+	}
+}
+
+// flush delivers every held item whose window has passed, together with
+// all items older than it.
+func (h *reorderingHandler) flush() {
+	h.deliverMu.Lock()
+	defer h.deliverMu.Unlock()
+
+	h.mu.Lock()
+	now := time.Now()
+	cut := 0
+	for i, item := range h.pending {
+		if !item.deadline.After(now) {
+			cut = i + 1
+		}
+	}
+	ready := h.pending[:cut:cut]
+	h.pending = append([]*reorderItem(nil), h.pending[cut:]...)
+	h.timer = nil
+	if len(h.pending) > 0 {
+		next := h.pending[0].deadline
+		for _, item := range h.pending[1:] {
+			if item.deadline.Before(next) {
+				next = item.deadline
+			}
+		}
+		h.timer = time.AfterFunc(next.Sub(now), h.flush)
+	}
+	h.mu.Unlock()
+
+	for _, item := range ready {
+		item.deliver()
+	}
+}
+
+// close delivers everything still held without waiting for the window.
+func (h *reorderingHandler) close() {
+	h.deliverMu.Lock()
+	defer h.deliverMu.Unlock()
+
+	h.mu.Lock()
+	ready := h.pending
+	h.pending = nil
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	h.mu.Unlock()
+
+	for _, item := range ready {
+		item.deliver()
+	}
+}
@@ -0,0 +1,123 @@
+package padpro
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// orderHandler records the order messages and revokes are delivered in.
+type orderHandler struct {
+	testHandler
+	mu        sync.Mutex
+	delivered []string
+	done      chan struct{}
+	want      int
+}
+
+func (h *orderHandler) OnMessage(_ context.Context, msg *wechat.Message) error {
+	h.record(msg.MsgID)
+	return nil
+}
+
+func (h *orderHandler) OnRevoke(_ context.Context, _, msgID, _ string) error {
+	h.record("revoke " + msgID)
+	return nil
+}
+
+func (h *orderHandler) record(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delivered = append(h.delivered, id)
+	if len(h.delivered) == h.want {
+		close(h.done)
+	}
+}
+
+func TestReorderingHandler_DeliversInTimestampOrder(t *testing.T) {
+	h := &orderHandler{done: make(chan struct{}), want: 5}
+	r := newReorderingHandler(h, 50*time.Millisecond, slog.Default())
+
+	base := time.Now().UnixMilli() - 10_000
+	for _, m := range []struct {
+		id string
+		ts int64
+	}{
+		{"3", base + 3000},
+		{"1", base + 1000},
+		{"4", base + 4000},
+		{"2", base + 1000}, // same time as 1: arrival order is kept
+	} {
+		if err := r.OnMessage(context.Background(), &wechat.Message{MsgID: m.id, Timestamp: m.ts}); err != nil {
+			t.Fatalf("OnMessage: %v", err)
+		}
+	}
+	r.OnRevoke(context.Background(), "wxid_bob", "4", "")
+
+	h.mu.Lock()
+	if len(h.delivered) != 0 {
+		t.Fatalf("delivered %v before the window passed", h.delivered)
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("buffered messages were not released")
+	}
+
+	want := []string{"1", "2", "3", "4", "revoke 4"}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range want {
+		if h.delivered[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", h.delivered, want)
+		}
+	}
+}
+
+func TestReorderingHandler_CloseFlushesImmediately(t *testing.T) {
+	h := &orderHandler{done: make(chan struct{}), want: 2}
+	r := newReorderingHandler(h, time.Hour, slog.Default())
+
+	r.OnMessage(context.Background(), &wechat.Message{MsgID: "b", Timestamp: 2000})
+	r.OnMessage(context.Background(), &wechat.Message{MsgID: "a", Timestamp: 1000})
+	r.close()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.delivered) != 2 || h.delivered[0] != "a" || h.delivered[1] != "b" {
+		t.Fatalf("delivered %v, want [a b]", h.delivered)
+	}
+}
+
+func TestProvider_InitReorderWindow(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultReorderWindowMs * time.Millisecond},
+		{"1000", time.Second},
+		{"-1", 0},
+	} {
+		p := &Provider{}
+		cfg := &wechat.ProviderConfig{APIEndpoint: "http://localhost:1239", APIToken: "key", Extra: map[string]string{}}
+		if tc.value != "" {
+			cfg.Extra["reorder_window_ms"] = tc.value
+		}
+		if err := p.Init(cfg, &testHandler{}); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		got := time.Duration(0)
+		if p.reorder != nil {
+			got = p.reorder.window
+		}
+		if got != tc.want {
+			t.Errorf("reorder_window_ms %q: window = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
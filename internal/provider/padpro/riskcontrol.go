@@ -169,6 +169,17 @@ func (rc *RiskControl) GetStats() (messages, media, groups, friends int) {
 	return rc.messageCount, rc.mediaCount, rc.groupCount, rc.friendCount
 }
 
+// Limits returns today's usage of each daily limit.
+func (rc *RiskControl) Limits() []wechat.RiskLimit {
+	msgs, media, groups, friends := rc.GetStats()
+	return []wechat.RiskLimit{
+		{Name: "messages", Used: msgs, Limit: rc.maxMessagesPerDay},
+		{Name: "media", Used: media, Limit: rc.maxMediaPerDay},
+		{Name: "groups", Used: groups, Limit: rc.maxGroupsPerDay},
+		{Name: "friends", Used: friends, Limit: rc.maxFriendsPerDay},
+	}
+}
+
 // IsInSilencePeriod returns whether the account is in its new-account silence window.
 func (rc *RiskControl) IsInSilencePeriod() bool {
 	rc.mu.Lock()
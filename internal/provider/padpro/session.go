@@ -0,0 +1,67 @@
+package padpro
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// padproSession is the session the provider persists through cfg.Sessions:
+// the account that was logged in on the auth key.
+type padproSession struct {
+	UserName string `json:"user_name"`
+}
+
+// sessionStoreTimeout bounds a single load or save of the session.
+const sessionStoreTimeout = 5 * time.Second
+
+// loadSession returns the saved session, or nil if there is none.
+func (p *Provider) loadSession(ctx context.Context) *padproSession {
+	if p.cfg == nil || p.cfg.Sessions == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	data, err := p.cfg.Sessions.LoadSession(ctx)
+	if err != nil {
+		p.log.Warn("failed to load session", "error", err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	var sess padproSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		p.log.Warn("ignoring unreadable saved session", "error", err)
+		return nil
+	}
+	return &sess
+}
+
+// saveSession persists the account logged in on the auth key.
+func (p *Provider) saveSession(ctx context.Context, userName string) {
+	if p.cfg == nil || p.cfg.Sessions == nil {
+		return
+	}
+	data, err := json.Marshal(padproSession{UserName: userName})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	if err := p.cfg.Sessions.SaveSession(ctx, data); err != nil {
+		p.log.Warn("failed to save session", "error", err)
+	}
+}
+
+// forgetSession deletes the saved session.
+func (p *Provider) forgetSession(ctx context.Context) {
+	if p.cfg == nil || p.cfg.Sessions == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, sessionStoreTimeout)
+	defer cancel()
+	if err := p.cfg.Sessions.DeleteSession(ctx); err != nil {
+		p.log.Warn("failed to delete session", "error", err)
+	}
+}
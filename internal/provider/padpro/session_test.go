@@ -0,0 +1,101 @@
+package padpro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// memorySessionStore is an in-memory wechat.SessionStore.
+type memorySessionStore struct {
+	mu   sync.Mutex
+	data json.RawMessage
+}
+
+func (s *memorySessionStore) LoadSession(context.Context) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func (s *memorySessionStore) SaveSession(_ context.Context, data json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+func (s *memorySessionStore) DeleteSession(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = nil
+	return nil
+}
+
+func TestProvider_RestoreSession_OnlyResumesSavedAccount(t *testing.T) {
+	userName := "wxid_self"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/GetLoginStatus":
+			_, _ = w.Write([]byte(`{"code":0,"data":{"online":true,"user_name":"` + userName + `","nick_name":"Bridge Bot"}}`))
+		case "/login/LogOut":
+			_, _ = w.Write([]byte(`{"code":0}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := &memorySessionStore{}
+	newProvider := func() *Provider {
+		p := &Provider{}
+		if err := p.Init(&wechat.ProviderConfig{
+			APIEndpoint: server.URL,
+			APIToken:    "token",
+			Sessions:    store,
+			Extra:       map[string]string{},
+		}, nil); err != nil {
+			t.Fatalf("Init error: %v", err)
+		}
+		return p
+	}
+	ctx := context.Background()
+
+	// Without a saved session, the account online on the auth key is resumed
+	// and saved
+	if restored, err := newProvider().RestoreSession(ctx); err != nil || !restored {
+		t.Fatalf("RestoreSession = %v, %v", restored, err)
+	}
+	if string(store.data) != `{"user_name":"wxid_self"}` {
+		t.Fatalf("saved session = %s", store.data)
+	}
+
+	// Another account logged in on the auth key is not taken over
+	userName = "wxid_other"
+	p := newProvider()
+	if restored, err := p.RestoreSession(ctx); err != nil || restored {
+		t.Fatalf("RestoreSession of another account = %v, %v", restored, err)
+	}
+	if p.GetLoginState() == wechat.LoginStateLoggedIn {
+		t.Fatal("session of another account was restored")
+	}
+
+	// Logging out forgets the session
+	userName = "wxid_self"
+	p = newProvider()
+	if restored, err := p.RestoreSession(ctx); err != nil || !restored {
+		t.Fatalf("RestoreSession = %v, %v", restored, err)
+	}
+	if err := p.Logout(ctx); err != nil {
+		t.Fatalf("Logout error: %v", err)
+	}
+	if store.data != nil {
+		t.Fatalf("session after logout = %s, want none", store.data)
+	}
+}
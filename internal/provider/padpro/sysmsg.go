@@ -0,0 +1,55 @@
+package padpro
+
+import (
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+// bridgedSysmsgTypes are the <sysmsg type="..."> system messages the bridge
+// handles: pats (拍一拍), bridged as a notice or reaction.
+var bridgedSysmsgTypes = map[string]bool{
+	"pat": true,
+}
+
+// bridgedSystemTexts match the plain-text system messages the bridge
+// handles: the account being removed from a group, which ends bridging of
+// the group, and the end of a live location share.
+var bridgedSystemTexts = []*regexp.Regexp{
+	regexp.MustCompile(`^你被.*移出(了)?群聊`),
+	regexp.MustCompile(`(?i)^you (were|have been) removed from (the )?group chat`),
+	regexp.MustCompile(`(?i)\bremoved you from (the )?group chat`),
+	regexp.MustCompile(`位置共享已(经)?结束`),
+	regexp.MustCompile(`(?i)location sharing (has )?ended`),
+}
+
+// bridgedSystemMessage reports whether a system message is of a kind the
+// bridge handles. WeChatPadPro syncs many system messages (type 10000) that
+// are bookkeeping for the WeChat client, such as
+// <sysmsg type="ClientCheckConsistency"> or "以上是打招呼的内容"; those are
+// dropped. Emoji reactions are reported by parseReaction before this filter.
+// Messages of other types are always bridged.
+func bridgedSystemMessage(msg *wechat.Message) bool {
+	if msg.Type != wechat.MsgSystem {
+		return true
+	}
+	// Group system messages may carry a "chatroom:\n" prefix
+	if start := strings.Index(msg.Content, "<sysmsg"); start >= 0 {
+		var parsed struct {
+			Type string `xml:"type,attr"`
+		}
+		if err := xml.Unmarshal([]byte(msg.Content[start:]), &parsed); err != nil {
+			return false
+		}
+		return bridgedSysmsgTypes[parsed.Type]
+	}
+	content := strings.TrimSpace(msg.Content)
+	for _, re := range bridgedSystemTexts {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
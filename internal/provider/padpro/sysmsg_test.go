@@ -0,0 +1,63 @@
+package padpro
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
+)
+
+func TestBridgedSystemMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"pat", "12345@chatroom:\n<sysmsg type=\"pat\"><pat><fromusername>wxid_bob</fromusername><pattedusername>wxid_me</pattedusername></pat></sysmsg>", true},
+		{"group removal", `你被"Alice"移出群聊`, true},
+		{"group removal in English", `You were removed from the group chat by "Alice"`, true},
+		{"live location ended", "位置共享已经结束", true},
+		{"client bookkeeping", `<sysmsg type="ClientCheckConsistency"><clientcheckconsistency/></sysmsg>`, false},
+		{"greeting marker", "以上是打招呼的内容", false},
+		{"malformed sysmsg", "<sysmsg type=", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &wechat.Message{Type: wechat.MsgSystem, Content: tt.content}
+			if got := bridgedSystemMessage(msg); got != tt.want {
+				t.Fatalf("bridgedSystemMessage(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+
+	if !bridgedSystemMessage(&wechat.Message{Type: wechat.MsgText, Content: "以上是打招呼的内容"}) {
+		t.Fatal("text messages should always be bridged")
+	}
+}
+
+func TestWebhookHandler_DropsUnhandledSystemMessage(t *testing.T) {
+	th := &testHandler{}
+	handler := NewWebhookHandler(slog.Default(), th)
+
+	body, err := json.Marshal(wsMessage{
+		NewMsgID:     790,
+		MsgType:      int(wechat.MsgSystem),
+		FromUserName: strField{Str: "wxid_bob"},
+		Content:      strField{Str: "以上是打招呼的内容"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/callback", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if len(th.messages) != 0 {
+		t.Fatalf("unhandled system message was bridged: %+v", th.messages[0])
+	}
+}
@@ -20,6 +20,7 @@ type wsMessage struct {
 	MsgSource    string   `json:"msg_source"`
 	PushContent  string   `json:"push_content"`
 	NewMsgID     int64    `json:"new_msg_id"`
+	MediaID      string   `json:"media_id"`
 }
 
 // --- Login API ---
@@ -37,11 +38,19 @@ type loginStatusResponse struct {
 	HeadURL  string `json:"head_url"`
 }
 
+type onlineStatusResponse struct {
+	Online   bool   `json:"online"`
+	UserName string `json:"user_name"`
+	NickName string `json:"nick_name"`
+	HeadURL  string `json:"head_url"`
+}
+
 // --- Message send API ---
 
 type sendTextRequest struct {
-	ToUserName string `json:"to_user_name"`
-	Content    string `json:"content"`
+	ToUserName string   `json:"to_user_name"`
+	Content    string   `json:"content"`
+	AtWxIDList []string `json:"at_wxid_list,omitempty"` // group members to @mention
 }
 
 type sendImageRequest struct {
@@ -55,7 +64,8 @@ type sendVideoRequest struct {
 	VideoURL   string `json:"video_url,omitempty"`
 	VideoData  string `json:"video_data,omitempty"` // base64 encoded
 	ThumbURL   string `json:"thumb_url,omitempty"`
-	ThumbData  string `json:"thumb_data,omitempty"` // base64 encoded
+	ThumbData  string `json:"thumb_data,omitempty"`  // base64 encoded
+	PlayLength int    `json:"play_length,omitempty"` // seconds
 }
 
 type sendVoiceRequest struct {
@@ -88,12 +98,34 @@ type sendLinkRequest struct {
 	ThumbURL    string `json:"thumb_url"`
 }
 
+type mediaURLRequest struct {
+	MediaID string `json:"media_id"`
+}
+
+type mediaURLResponse struct {
+	URL string `json:"url"`
+}
+
+type chatHistoryRequest struct {
+	UserName string `json:"user_name"`
+	Count    int    `json:"count"`
+}
+
+type chatHistoryResponse struct {
+	Messages []wsMessage `json:"messages"`
+}
+
 type revokeRequest struct {
 	ToUserName string `json:"to_user_name"`
 	MsgID      string `json:"msg_id"`
 	NewMsgID   string `json:"new_msg_id"`
 }
 
+type sendPatRequest struct {
+	ChatUserName string `json:"chat_user_name"` // group or private chat
+	PatUserName  string `json:"pat_user_name"`
+}
+
 type sendMsgResponse struct {
 	MsgID    int64  `json:"msg_id"`
 	NewMsgID int64  `json:"new_msg_id"`
@@ -183,6 +215,10 @@ type quitChatRoomRequest struct {
 	ChatRoomName string `json:"chat_room_name"`
 }
 
+type scanIntoURLGroupRequest struct {
+	URL string `json:"url"`
+}
+
 // --- SNS (Moments) API ---
 
 type snsTimelineResponse struct {
@@ -245,6 +281,47 @@ type finderVideo struct {
 	CreateTime int64  `json:"create_time"`
 }
 
+// finderShareXML is the app message (appmsg type 51) WeChat sends when a
+// Channels video is shared into a chat.
+type finderShareXML struct {
+	AppMsg struct {
+		Type       int `xml:"type"`
+		FinderFeed struct {
+			ObjectID  string `xml:"objectId"`
+			Nickname  string `xml:"nickname"`
+			Username  string `xml:"username"`
+			Desc      string `xml:"desc"`
+			MediaList struct {
+				Media []struct {
+					ThumbURL          string `xml:"thumbUrl"`
+					CoverURL          string `xml:"coverUrl"`
+					URL               string `xml:"url"`
+					VideoPlayDuration int    `xml:"videoPlayDuration"`
+				} `xml:"media"`
+			} `xml:"mediaList"`
+		} `xml:"finderFeed"`
+	} `xml:"appmsg"`
+}
+
+// contactCardXML is the <msg> of a shared contact card (type 42) or a
+// contact recommendation (type 40).
+type contactCardXML struct {
+	Username        string `xml:"username,attr"`
+	Nickname        string `xml:"nickname,attr"`
+	FromUsername    string `xml:"fromusername,attr"`
+	FromNickname    string `xml:"fromnickname,attr"`
+	EncryptUsername string `xml:"encryptusername,attr"`
+	Alias           string `xml:"alias,attr"`
+	BigHeadImgURL   string `xml:"bigheadimgurl,attr"`
+	SmallHeadImgURL string `xml:"smallheadimgurl,attr"`
+	Province        string `xml:"province,attr"`
+	City            string `xml:"city,attr"`
+	Content         string `xml:"content,attr"`
+	Ticket          string `xml:"ticket,attr"`
+	AntispamTicket  string `xml:"antispamticket,attr"`
+	Scene           int    `xml:"scene,attr"`
+}
+
 // --- Webhook config API ---
 
 type webhookConfigRequest struct {
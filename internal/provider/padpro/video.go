@@ -0,0 +1,66 @@
+package padpro
+
+import "encoding/binary"
+
+// mp4DurationSeconds reads the play length of an MP4/MOV video from its
+// movie header (moov/mvhd), rounded up to whole seconds. It returns 0 when
+// the data has no readable header, e.g. for other containers.
+func mp4DurationSeconds(data []byte) int {
+	moov, ok := findMP4Box(data, "moov")
+	if !ok {
+		return 0
+	}
+	mvhd, ok := findMP4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 4 {
+		return 0
+	}
+
+	var timescale, duration uint64
+	switch mvhd[0] { // version
+	case 0:
+		if len(mvhd) < 20 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case 1:
+		if len(mvhd) < 32 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	default:
+		return 0
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return int((duration + timescale - 1) / timescale)
+}
+
+// findMP4Box returns the payload of the first box of the given type directly
+// inside data.
+func findMP4Box(data []byte, boxType string) ([]byte, bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		header := uint64(8)
+		switch size {
+		case 0: // box extends to the end
+			size = uint64(len(data))
+		case 1: // 64-bit size follows the type
+			if len(data) < 16 {
+				return nil, false
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, false
+		}
+		if string(data[4:8]) == boxType {
+			return data[header:size], true
+		}
+		data = data[size:]
+	}
+	return nil, false
+}
@@ -0,0 +1,66 @@
+package padpro
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// mp4Box builds an MP4 box with a 32-bit size.
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], boxType)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// testMP4 returns a minimal MP4 whose version 0 movie header has the given
+// timescale and duration.
+func testMP4(timescale, duration uint32) []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+	return append(
+		mp4Box("ftyp", []byte("isom")),
+		mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("trak"))...,
+	)
+}
+
+func TestMP4DurationSeconds(t *testing.T) {
+	mvhdV1 := make([]byte, 32)
+	mvhdV1[0] = 1
+	binary.BigEndian.PutUint32(mvhdV1[20:], 1000)
+	binary.BigEndian.PutUint64(mvhdV1[24:], 90_000)
+
+	// A 64-bit sized mdat before moov, as written by many encoders.
+	largeMdat := make([]byte, 16, 20)
+	binary.BigEndian.PutUint32(largeMdat, 1)
+	copy(largeMdat[4:], "mdat")
+	binary.BigEndian.PutUint64(largeMdat[8:], 20)
+	largeMdat = append(largeMdat, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"whole seconds", testMP4(600, 6000), 10},
+		{"rounds up", testMP4(1000, 2500), 3},
+		{"version 1 header", mp4Box("moov", mp4Box("mvhd", mvhdV1)), 90},
+		{"after 64-bit box", append(largeMdat, testMP4(1, 7)...), 7},
+		{"no moov", mp4Box("ftyp", []byte("isom")), 0},
+		{"not mp4", []byte("definitely not a video"), 0},
+		{"truncated", testMP4(600, 6000)[:30], 0},
+	}
+	for _, tc := range tests {
+		if got := mp4DurationSeconds(tc.data); got != tc.want {
+			t.Errorf("%s: mp4DurationSeconds = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -22,6 +22,9 @@ type wsClient struct {
 	handler  wechat.MessageHandler
 	log      *slog.Logger
 	conn     *websocket.Conn
+
+	// observer, if set, is told when connections open and close
+	observer wechat.ConnectionObserver
 }
 
 func newWSClient(endpoint, authKey string, handler wechat.MessageHandler, log *slog.Logger) *wsClient {
@@ -48,6 +51,10 @@ func (ws *wsClient) connect(stopCh chan struct{}) error {
 	}
 	ws.conn = conn
 	ws.log.Info("WebSocket connected")
+	if ws.observer != nil {
+		ws.observer.WebSocketConnected()
+		defer ws.observer.WebSocketDisconnected()
+	}
 
 	return ws.readLoop(stopCh)
 }
@@ -97,13 +104,21 @@ func (ws *wsClient) dispatchMessage(raw wsMessage) {
 	switch msgType {
 	case wechat.MsgRevoke:
 		ws.handleRevoke(ctx, raw)
-	case wechat.MsgSystem:
-		ws.log.Debug("system message", "content", raw.Content.Str, "from", raw.FromUserName.Str)
 	default:
 		msg := convertWSMessage(raw)
 		if msg == nil {
 			return
 		}
+		if reaction := parseReaction(msg); reaction != nil {
+			if err := ws.handler.OnMessageReaction(ctx, reaction); err != nil {
+				ws.log.Error("handle reaction failed", "error", err, "msg_id", reaction.MsgID)
+			}
+			return
+		}
+		if !bridgedSystemMessage(msg) {
+			ws.log.Debug("system message", "content", msg.Content, "from", msg.FromUser)
+			return
+		}
 		if err := ws.handler.OnMessage(ctx, msg); err != nil {
 			ws.log.Error("handle message failed", "error", err, "msg_id", msg.MsgID)
 		}
@@ -120,7 +135,7 @@ func (ws *wsClient) handleRevoke(ctx context.Context, raw wsMessage) {
 	if msg == nil {
 		return
 	}
-	if err := ws.handler.OnRevoke(ctx, msg.MsgID, raw.PushContent); err != nil {
+	if err := ws.handler.OnRevoke(ctx, revokeChatID(msg), msg.MsgID, raw.PushContent); err != nil {
 		ws.log.Error("handle revoke failed", "error", err, "msg_id", msg.MsgID)
 	}
 }
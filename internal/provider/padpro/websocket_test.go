@@ -2,7 +2,13 @@ package padpro
 
 import (
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
@@ -27,3 +33,57 @@ func TestWSClient_DispatchMessage_NoHandler(t *testing.T) {
 		Content:      strField{Str: "hello"},
 	})
 }
+
+type testConnObserver struct {
+	connected, disconnected, reconnecting int
+}
+
+func (o *testConnObserver) WebSocketConnected()    { o.connected++ }
+func (o *testConnObserver) WebSocketDisconnected() { o.disconnected++ }
+func (o *testConnObserver) WebSocketReconnecting() { o.reconnecting++ }
+
+func TestWSClient_ConnectReportsToObserver(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	ws := newWSClient("ws"+strings.TrimPrefix(server.URL, "http"), "secret-key", nil, slog.Default())
+	observer := &testConnObserver{}
+	ws.observer = observer
+
+	if err := ws.connect(make(chan struct{})); err == nil {
+		t.Fatal("expected an error once the server closes the connection")
+	}
+	if observer.connected != 1 || observer.disconnected != 1 {
+		t.Fatalf("observer = %+v, want one connect and one disconnect", observer)
+	}
+}
+
+func TestNextWSBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  time.Duration
+		uptime   time.Duration
+		wantWait time.Duration
+		wantNext time.Duration
+	}{
+		{"short-lived connection keeps growing", 4 * time.Second, time.Second, 4 * time.Second, 8 * time.Second},
+		{"capped", 20 * time.Second, 0, 20 * time.Second, wsMaxBackoff},
+		{"stable connection starts over", wsMaxBackoff, wsStableUptime, wsMinBackoff, 2 * wsMinBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, next := nextWSBackoff(tt.backoff, tt.uptime)
+			if wait != tt.wantWait || next != tt.wantNext {
+				t.Fatalf("nextWSBackoff(%v, %v) = %v, %v; want %v, %v",
+					tt.backoff, tt.uptime, wait, next, tt.wantWait, tt.wantNext)
+			}
+		})
+	}
+}
@@ -220,13 +220,29 @@ func (h *recordingHandler) OnTyping(ctx context.Context, userID string, chatID s
 	return nil
 }
 
-func (h *recordingHandler) OnRevoke(ctx context.Context, msgID string, replaceTip string) error {
+func (h *recordingHandler) OnRevoke(ctx context.Context, chatID, msgID, replaceTip string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.revokedMsgIDs = append(h.revokedMsgIDs, msgID)
 	return nil
 }
 
+func (h *recordingHandler) OnFriendRequest(ctx context.Context, req *wechat.FriendRequest) error {
+	return nil
+}
+
+func (h *recordingHandler) OnSendAck(ctx context.Context, msgID string) error {
+	return nil
+}
+
+func (h *recordingHandler) OnMessageReaction(ctx context.Context, reaction *wechat.MessageReaction) error {
+	return nil
+}
+
+func (h *recordingHandler) OnContactAdded(ctx context.Context, contact *wechat.ContactInfo) error {
+	return nil
+}
+
 func TestProviderRPCBackedLifecycleAndOperations(t *testing.T) {
 	tempDir := t.TempDir()
 	avatarPath := filepath.Join(tempDir, "avatar.png")
@@ -34,7 +34,7 @@ func parseRawMessage(data json.RawMessage, log *slog.Logger) (*wechat.Message, e
 	msg := &wechat.Message{
 		MsgID:     raw.MsgID,
 		Type:      wechat.MsgType(raw.Type),
-		Timestamp: raw.Timestamp,
+		Timestamp: raw.Timestamp * 1000, // seconds → milliseconds
 		Content:   raw.Content,
 		Extra:     make(map[string]string),
 	}
@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -45,8 +46,18 @@ type Provider struct {
 
 	// tempDir for received media files
 	tempDir string
+	// tempMaxAge is how long files may stay in tempDir before the cleanup
+	// loop removes them (temp_max_age_s).
+	tempMaxAge time.Duration
 }
 
+const (
+	// defaultTempMaxAge applies when temp_max_age_s is not configured.
+	defaultTempMaxAge = time.Hour
+	// tempCleanupInterval is how often tempDir is swept for old files.
+	tempCleanupInterval = 10 * time.Minute
+)
+
 type rpcClient interface {
 	Connect(ctx context.Context) error
 	Close() error
@@ -78,6 +89,10 @@ func (p *Provider) Init(cfg *wechat.ProviderConfig, handler wechat.MessageHandle
 	if cfg.DataDir != "" {
 		os.MkdirAll(p.tempDir, 0750)
 	}
+	p.tempMaxAge = defaultTempMaxAge
+	if v, err := strconv.Atoi(cfg.Extra["temp_max_age_s"]); err == nil && v > 0 {
+		p.tempMaxAge = time.Duration(v) * time.Second
+	}
 
 	return nil
 }
@@ -116,8 +131,9 @@ func (p *Provider) Start(ctx context.Context) error {
 		return nil
 	}
 
-	// Start heartbeat goroutine
+	// Start heartbeat and temp media cleanup goroutines
 	go p.heartbeatLoop()
+	go p.tempCleanupLoop()
 
 	p.running = true
 	p.log.Info("pchook provider started", "endpoint", p.cfg.RPCPort)
@@ -155,7 +171,7 @@ func (p *Provider) Name() string { return "pchook" }
 func (p *Provider) Tier() int    { return 3 }
 
 func (p *Provider) Capabilities() wechat.Capability {
-	return wechat.Capability{
+	return p.cfg.OverrideCapabilities(wechat.Capability{
 		SendText:       true,
 		SendImage:      true,
 		SendVideo:      false, // limited support
@@ -174,7 +190,7 @@ func (p *Provider) Capabilities() wechat.Capability {
 		Reaction:       false,
 		ReadReceipt:    false,
 		Typing:         false,
-	}
+	})
 }
 
 // --- Authentication ---
@@ -191,7 +207,7 @@ func (p *Provider) Login(ctx context.Context) error {
 				Error: "WeChat PC client is not logged in; please log in via the desktop client first",
 			})
 		}
-		return fmt.Errorf("WeChat PC client is not logged in")
+		return fmt.Errorf("WeChat PC client is %w", wechat.ErrLoggedOut)
 	}
 
 	return nil
@@ -238,6 +254,7 @@ func (p *Provider) SendImage(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("save image: %w", err)
 	}
+	defer p.removeTemp(localPath)
 
 	result, err := p.rpc.Call(ctx, "send_image", sendImageParams{
 		ToUser: toUser,
@@ -255,11 +272,11 @@ func (p *Provider) SendImage(ctx context.Context, toUser string, data io.Reader,
 }
 
 func (p *Provider) SendVideo(ctx context.Context, toUser string, data io.Reader, filename string, thumb io.Reader) (string, error) {
-	return "", fmt.Errorf("pchook: video sending not supported")
+	return "", fmt.Errorf("pchook: video sending %w", wechat.ErrNotSupported)
 }
 
 func (p *Provider) SendVoice(ctx context.Context, toUser string, data io.Reader, duration int) (string, error) {
-	return "", fmt.Errorf("pchook: voice sending not supported")
+	return "", fmt.Errorf("pchook: voice sending %w", wechat.ErrNotSupported)
 }
 
 func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader, filename string) (string, error) {
@@ -267,6 +284,7 @@ func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader,
 	if err != nil {
 		return "", fmt.Errorf("save file: %w", err)
 	}
+	defer p.removeTemp(localPath)
 
 	result, err := p.rpc.Call(ctx, "send_file", sendFileParams{
 		ToUser: toUser,
@@ -284,11 +302,11 @@ func (p *Provider) SendFile(ctx context.Context, toUser string, data io.Reader,
 }
 
 func (p *Provider) SendLocation(ctx context.Context, toUser string, loc *wechat.LocationInfo) (string, error) {
-	return "", fmt.Errorf("pchook: location sending not supported")
+	return "", fmt.Errorf("pchook: location sending %w", wechat.ErrNotSupported)
 }
 
 func (p *Provider) SendLink(ctx context.Context, toUser string, link *wechat.LinkCardInfo) (string, error) {
-	return "", fmt.Errorf("pchook: link card sending not supported")
+	return "", fmt.Errorf("pchook: link card sending %w", wechat.ErrNotSupported)
 }
 
 func (p *Provider) RevokeMessage(ctx context.Context, msgID string, toUser string) error {
@@ -299,6 +317,21 @@ func (p *Provider) RevokeMessage(ctx context.Context, msgID string, toUser strin
 	return err
 }
 
+// SendPat is not supported by the PC hook RPC interface.
+func (p *Provider) SendPat(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("pchook: pats %w", wechat.ErrNotSupported)
+}
+
+func (p *Provider) MarkRead(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("pchook: read receipts %w", wechat.ErrNotSupported)
+}
+
+// SendTyping is a no-op: the PC hook RPC interface can't send typing
+// indicators.
+func (p *Provider) SendTyping(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
 // --- Contacts ---
 
 func (p *Provider) GetContactList(ctx context.Context) ([]*wechat.ContactInfo, error) {
@@ -457,12 +490,17 @@ func (p *Provider) LeaveGroup(ctx context.Context, groupID string) error {
 	return err
 }
 
+// RespondGroupInvite is not supported by the PC hook RPC interface.
+func (p *Provider) RespondGroupInvite(_ context.Context, _ *wechat.GroupInvite, _ bool) error {
+	return fmt.Errorf("pchook: group invites %w", wechat.ErrNotSupported)
+}
+
 // --- Media ---
 
 func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
 	// Try media_path from Extra (local file on the Windows host)
 	if mediaPath, ok := msg.Extra["media_path"]; ok && mediaPath != "" {
-		data, err := os.Open(mediaPath)
+		data, err := p.openMedia(mediaPath)
 		if err != nil {
 			return nil, "", fmt.Errorf("open media file: %w", err)
 		}
@@ -481,7 +519,7 @@ func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.R
 		return nil, "", fmt.Errorf("parse media path: %w", err)
 	}
 
-	data, err := os.Open(filePath)
+	data, err := p.openMedia(filePath)
 	if err != nil {
 		return nil, "", fmt.Errorf("open downloaded media: %w", err)
 	}
@@ -489,6 +527,27 @@ func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.R
 	return data, detectMimeType(filePath), nil
 }
 
+// openMedia opens a local media file, refusing files larger than the
+// configured media size limit.
+func (p *Provider) openMedia(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var max int64
+	if p.cfg != nil {
+		max = p.cfg.MaxMediaSize
+	}
+	if info, err := f.Stat(); err == nil {
+		if err := wechat.CheckMediaSize(info.Size(), max); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	// The file may still be growing while WeChat writes it
+	return wechat.LimitMedia(f, max), nil
+}
+
 // --- Internal ---
 
 // handleNotification processes push notifications from WeChatFerry.
@@ -520,6 +579,7 @@ func (p *Provider) handleNotification(method string, params json.RawMessage) {
 
 	case "on_revoke":
 		var data struct {
+			ChatID     string `json:"chat_id"`
 			MsgID      string `json:"msg_id"`
 			ReplaceTip string `json:"replace_tip"`
 		}
@@ -528,7 +588,7 @@ func (p *Provider) handleNotification(method string, params json.RawMessage) {
 			return
 		}
 		if p.handler != nil {
-			p.handler.OnRevoke(ctx, data.MsgID, data.ReplaceTip)
+			p.handler.OnRevoke(ctx, data.ChatID, data.MsgID, data.ReplaceTip)
 		}
 
 	default:
@@ -651,6 +711,64 @@ func (p *Provider) saveToTemp(r io.Reader, filename string) (string, error) {
 	return filePath, nil
 }
 
+// removeTemp deletes a temp file once WeChatFerry is done with it.
+func (p *Provider) removeTemp(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		p.log.Warn("failed to remove temp media file", "error", err, "path", path)
+	}
+}
+
+func (p *Provider) tempCleanupLoop() {
+	ticker := time.NewTicker(tempCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case now := <-ticker.C:
+			p.cleanupTemp(now)
+		}
+	}
+}
+
+// cleanupTemp removes files in tempDir last modified more than tempMaxAge
+// before now, and returns how many were removed. The shared system temp
+// directory is never swept.
+func (p *Provider) cleanupTemp(now time.Time) int {
+	if p.tempDir == "" || p.tempDir == os.TempDir() || p.tempMaxAge <= 0 {
+		return 0
+	}
+
+	entries, err := os.ReadDir(p.tempDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			p.log.Warn("failed to list temp media directory", "error", err, "dir", p.tempDir)
+		}
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < p.tempMaxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.tempDir, entry.Name())); err != nil {
+			p.log.Warn("failed to remove old temp media file", "error", err, "file", entry.Name())
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		p.log.Debug("cleaned up temp media", "removed", removed, "dir", p.tempDir)
+	}
+	return removed
+}
+
 // detectMimeType guesses the MIME type from a file extension.
 func detectMimeType(path string) string {
 	ext := filepath.Ext(path)
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -230,6 +232,9 @@ func TestParseRawMessage_TextDM(t *testing.T) {
 	if msg.Content != "hello world" {
 		t.Errorf("Content: %s", msg.Content)
 	}
+	if msg.Timestamp != 1700000000000 {
+		t.Errorf("Timestamp should be in milliseconds: %d", msg.Timestamp)
+	}
 	if msg.IsGroup {
 		t.Error("should not be group")
 	}
@@ -600,3 +605,78 @@ func TestProvider_HeartbeatStepReconnectsAndRefreshesSelf(t *testing.T) {
 		t.Fatalf("unexpected self: %+v", self)
 	}
 }
+
+func TestProvider_CleanupTempRemovesOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	p := &Provider{
+		tempDir:    dir,
+		tempMaxAge: time.Hour,
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	oldPath := filepath.Join(dir, "old.jpg")
+	newPath := filepath.Join(dir, "new.jpg")
+	for _, path := range []string{oldPath, newPath} {
+		if err := os.WriteFile(path, []byte("media"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(oldPath, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	if removed := p.cleanupTemp(now); removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatalf("old file still present: %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Fatalf("new file removed: %v", err)
+	}
+}
+
+func TestProvider_SendFileRemovesTempFile(t *testing.T) {
+	dir := t.TempDir()
+	rpc := &fakeRPCClient{
+		callFunc: func(context.Context, string, interface{}) (json.RawMessage, error) {
+			return json.RawMessage(`"msg1"`), nil
+		},
+	}
+	p := &Provider{
+		rpc:     rpc,
+		tempDir: dir,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	if _, err := p.SendFile(context.Background(), "wxid_friend", strings.NewReader("data"), "doc.pdf"); err != nil {
+		t.Fatalf("SendFile: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("temp dir not empty after send: %d files", len(entries))
+	}
+}
+
+func TestProvider_DownloadMediaRejectsOversizedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.mp4")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	msg := &wechat.Message{Extra: map[string]string{"media_path": path}}
+
+	p := &Provider{cfg: &wechat.ProviderConfig{MaxMediaSize: 4}}
+	if _, _, err := p.DownloadMedia(context.Background(), msg); !errors.Is(err, wechat.ErrMediaTooLarge) {
+		t.Fatalf("DownloadMedia error = %v, want ErrMediaTooLarge", err)
+	}
+
+	p.cfg.MaxMediaSize = 10
+	data, _, err := p.DownloadMediaToBytes(context.Background(), msg)
+	if err != nil || string(data) != "0123456789" {
+		t.Fatalf("DownloadMediaToBytes at limit = %q, %v", data, err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/n42/mautrix-wechat/pkg/wechat"
 )
 
 // RPCRequest represents a JSON-RPC request sent to WeChatFerry.
@@ -168,13 +170,13 @@ func (c *RPCClient) Call(ctx context.Context, method string, params interface{})
 	c.mu.Lock()
 	if c.conn == nil {
 		c.mu.Unlock()
-		return nil, fmt.Errorf("not connected")
+		return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("not connected"))
 	}
 	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 	_, err = c.conn.Write(data)
 	c.mu.Unlock()
 	if err != nil {
-		return nil, fmt.Errorf("write request: %w", err)
+		return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("write request: %w", err))
 	}
 
 	// Wait for response
@@ -183,14 +185,14 @@ func (c *RPCClient) Call(ctx context.Context, method string, params interface{})
 		return nil, ctx.Err()
 	case resp, ok := <-respCh:
 		if !ok {
-			return nil, fmt.Errorf("connection closed")
+			return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("connection closed"))
 		}
 		if resp.Error != nil {
 			return nil, resp.Error
 		}
 		return resp.Result, nil
 	case <-time.After(30 * time.Second):
-		return nil, fmt.Errorf("rpc call %s timed out", method)
+		return nil, wechat.WrapError(wechat.ErrTransient, fmt.Errorf("rpc call %s timed out", method))
 	}
 }
 
@@ -246,7 +246,7 @@ func (cs *CallbackServer) dispatchImageMessage(ctx context.Context, msg *Callbac
 		MediaURL:  msg.PicURL,
 		Timestamp: msg.CreateTime * 1000,
 		Extra: map[string]string{
-			"media_id": msg.MediaID,
+			wechat.ExtraMediaID: msg.MediaID,
 		},
 	})
 }
@@ -262,8 +262,8 @@ func (cs *CallbackServer) dispatchVoiceMessage(ctx context.Context, msg *Callbac
 		ToUser:    msg.ToUserName,
 		Timestamp: msg.CreateTime * 1000,
 		Extra: map[string]string{
-			"media_id": msg.MediaID,
-			"format":   msg.Format,
+			wechat.ExtraMediaID: msg.MediaID,
+			"format":            msg.Format,
 		},
 	}
 
@@ -286,8 +286,8 @@ func (cs *CallbackServer) dispatchVideoMessage(ctx context.Context, msg *Callbac
 		ToUser:    msg.ToUserName,
 		Timestamp: msg.CreateTime * 1000,
 		Extra: map[string]string{
-			"media_id":       msg.MediaID,
-			"thumb_media_id": msg.ThumbMediaID,
+			wechat.ExtraMediaID: msg.MediaID,
+			"thumb_media_id":    msg.ThumbMediaID,
 		},
 	})
 }
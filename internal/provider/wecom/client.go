@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"sync"
 	"time"
@@ -165,46 +166,59 @@ func (c *Client) UploadMedia(ctx context.Context, mediaType string, filename str
 	return &result, nil
 }
 
-// DownloadMedia downloads a media file by media_id.
-func (c *Client) DownloadMedia(ctx context.Context, mediaID string) (io.ReadCloser, string, error) {
-	token, err := c.GetToken(ctx)
-	if err != nil {
-		return nil, "", err
-	}
+// GetMedia downloads a temporary media file, such as a received image, voice
+// message or video, by media_id, returning its content and MIME type. An
+// expired access token is refreshed and the download retried.
+// Uses: GET /cgi-bin/media/get
+func (c *Client) GetMedia(ctx context.Context, mediaID string) (io.ReadCloser, string, error) {
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		token, err := c.GetToken(ctx)
+		if err != nil {
+			return nil, "", err
+		}
 
-	url := fmt.Sprintf("%s/cgi-bin/media/get?access_token=%s&media_id=%s",
-		baseURL, token, mediaID)
+		url := fmt.Sprintf("%s/cgi-bin/media/get?access_token=%s&media_id=%s",
+			baseURL, token, neturl.QueryEscape(mediaID))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, "", fmt.Errorf("create download request: %w", err)
-	}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("create download request: %w", err)
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, "", fmt.Errorf("download media: %w", err)
-	}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, "", fmt.Errorf("download media: %w", err)
+		}
 
-	contentType := resp.Header.Get("Content-Type")
+		contentType := resp.Header.Get("Content-Type")
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		defer resp.Body.Close()
-		return nil, "", fmt.Errorf("download media HTTP %d", resp.StatusCode)
-	}
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			resp.Body.Close()
+			return nil, "", fmt.Errorf("download media HTTP %d", resp.StatusCode)
+		}
 
-	// If response is JSON, it's an error
-	if strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/plain") {
-		defer resp.Body.Close()
-		var apiResp APIResponse
-		json.NewDecoder(resp.Body).Decode(&apiResp)
-		return nil, "", fmt.Errorf("download media failed: [%d] %s", apiResp.ErrCode, apiResp.ErrMsg)
-	}
+		// If response is JSON, it's an error
+		if strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/plain") {
+			var apiResp APIResponse
+			json.NewDecoder(resp.Body).Decode(&apiResp)
+			resp.Body.Close()
+			if apiResp.ErrCode == errCodeTokenExpired || apiResp.ErrCode == errCodeTokenInvalid {
+				c.log.Warn("access token expired, refreshing",
+					"errcode", apiResp.ErrCode, "attempt", attempt)
+				c.invalidateToken()
+				continue
+			}
+			return nil, "", fmt.Errorf("download media failed: [%d] %s", apiResp.ErrCode, apiResp.ErrMsg)
+		}
+
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
 
-	if contentType == "" {
-		contentType = "application/octet-stream"
+		return resp.Body, contentType, nil
 	}
 
-	return resp.Body, contentType, nil
+	return nil, "", fmt.Errorf("max retries exceeded downloading media %s", mediaID)
 }
 
 // doWithRetry executes an API request with automatic token retry on expiry.
@@ -258,7 +258,7 @@ func TestFormatMsgID(t *testing.T) {
 	}
 }
 
-func TestClientDownloadMedia_UsesStatusAndMimeFallback(t *testing.T) {
+func TestClientGetMedia_UsesStatusAndMimeFallback(t *testing.T) {
 	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 	c := NewClient("corp123", "secret456", 1000001, log)
 	c.accessToken = "token_1"
@@ -290,9 +290,9 @@ func TestClientDownloadMedia_UsesStatusAndMimeFallback(t *testing.T) {
 		}),
 	}
 
-	reader, mimeType, err := c.DownloadMedia(context.Background(), "headerless")
+	reader, mimeType, err := c.GetMedia(context.Background(), "headerless")
 	if err != nil {
-		t.Fatalf("DownloadMedia error: %v", err)
+		t.Fatalf("GetMedia error: %v", err)
 	}
 	data, err := io.ReadAll(reader)
 	if err != nil {
@@ -303,14 +303,54 @@ func TestClientDownloadMedia_UsesStatusAndMimeFallback(t *testing.T) {
 		t.Fatalf("unexpected media: %q %s", string(data), mimeType)
 	}
 
-	if _, _, err := c.DownloadMedia(context.Background(), "missing"); err == nil || err.Error() != "download media HTTP 404" {
+	if _, _, err := c.GetMedia(context.Background(), "missing"); err == nil || err.Error() != "download media HTTP 404" {
 		t.Fatalf("expected HTTP error, got %v", err)
 	}
-	if _, _, err := c.DownloadMedia(context.Background(), "json_error"); err == nil || err.Error() != "download media failed: [40007] invalid media_id" {
+	if _, _, err := c.GetMedia(context.Background(), "json_error"); err == nil || err.Error() != "download media failed: [40007] invalid media_id" {
 		t.Fatalf("expected JSON API error, got %v", err)
 	}
 }
 
+func TestClientGetMedia_RefreshesExpiredToken(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	c := NewClient("corp123", "secret456", 1000001, log)
+	c.accessToken = "stale"
+	c.tokenExpiry = farFuture()
+	c.httpClient = &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/cgi-bin/gettoken" {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"errcode":0,"access_token":"fresh","expires_in":7200}`)),
+				}, nil
+			}
+			if req.URL.Query().Get("access_token") != "fresh" {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"errcode":42001,"errmsg":"access_token expired"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"audio/amr"}},
+				Body:       io.NopCloser(strings.NewReader("voice:" + req.URL.Query().Get("media_id"))),
+			}, nil
+		}),
+	}
+
+	reader, mimeType, err := c.GetMedia(context.Background(), "voice_1")
+	if err != nil {
+		t.Fatalf("GetMedia error: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "voice:voice_1" || mimeType != "audio/amr" {
+		t.Fatalf("unexpected media: %q %s", data, mimeType)
+	}
+}
+
 func farFuture() time.Time {
 	return time.Now().Add(time.Hour)
 }
@@ -405,6 +445,22 @@ func (m *mockHandler) OnTyping(ctx context.Context, userID string, chatID string
 	return nil
 }
 
-func (m *mockHandler) OnRevoke(ctx context.Context, msgID string, replaceTip string) error {
+func (m *mockHandler) OnRevoke(ctx context.Context, chatID, msgID, replaceTip string) error {
+	return nil
+}
+
+func (m *mockHandler) OnFriendRequest(ctx context.Context, req *wechat.FriendRequest) error {
+	return nil
+}
+
+func (m *mockHandler) OnSendAck(ctx context.Context, msgID string) error {
+	return nil
+}
+
+func (m *mockHandler) OnMessageReaction(ctx context.Context, reaction *wechat.MessageReaction) error {
+	return nil
+}
+
+func (m *mockHandler) OnContactAdded(ctx context.Context, contact *wechat.ContactInfo) error {
 	return nil
 }
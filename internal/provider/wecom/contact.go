@@ -376,6 +376,12 @@ func (p *Provider) LeaveGroup(ctx context.Context, groupID string) error {
 	return fmt.Errorf("wecom: leaving groups not supported via API")
 }
 
+// RespondGroupInvite is not applicable for WeCom; app chats are joined by
+// the enterprise, not by invitation.
+func (p *Provider) RespondGroupInvite(ctx context.Context, invite *wechat.GroupInvite, accept bool) error {
+	return fmt.Errorf("wecom: group invites not supported")
+}
+
 // --- Helpers ---
 
 // getAppChat fetches app chat info.
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/n42/mautrix-wechat/pkg/wechat"
@@ -294,14 +296,75 @@ func (p *Provider) RevokeMessage(ctx context.Context, msgID string, toUser strin
 	return nil
 }
 
-// DownloadMedia downloads media from WeCom by media_id.
+// SendPat is not applicable for WeCom, which has no pat feature.
+func (p *Provider) SendPat(_ context.Context, _ string, _ string) error {
+	return fmt.Errorf("wecom: pats not supported")
+}
+
+// MarkRead is a no-op for WeCom: messages delivered to the application
+// callback are already treated as read, and the API has no read-state endpoint.
+func (p *Provider) MarkRead(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+// SendTyping is a no-op for WeCom, whose application messages have no typing
+// indicator.
+func (p *Provider) SendTyping(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+// DownloadMedia downloads a received message's media. Images come with a
+// CDN URL, which is tried first; voice messages and videos only carry a
+// media_id, which is downloaded via /cgi-bin/media/get.
 func (p *Provider) DownloadMedia(ctx context.Context, msg *wechat.Message) (io.ReadCloser, string, error) {
-	mediaID := msg.Extra["media_id"]
+	mediaID := msg.Extra[wechat.ExtraMediaID]
+
+	if msg.MediaURL != "" {
+		rc, mimeType, err := p.downloadMediaURL(ctx, msg.MediaURL)
+		if err == nil || mediaID == "" {
+			return rc, mimeType, err
+		}
+		p.log.Debug("media URL download failed, using media_id",
+			"error", err, "msg_id", msg.MsgID)
+	}
+
 	if mediaID == "" {
 		mediaID = msg.MsgID
 	}
+	rc, mimeType, err := p.client.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, "", err
+	}
+	// Voice messages are AMR (or Speex), named by the callback's Format
+	if mimeType == "application/octet-stream" && msg.Type == wechat.MsgVoice && msg.Extra["format"] != "" {
+		mimeType = "audio/" + strings.ToLower(msg.Extra["format"])
+	}
+	return wechat.LimitMedia(rc, p.cfg.MaxMediaSize), mimeType, nil
+}
 
-	return p.client.DownloadMedia(ctx, mediaID)
+// downloadMediaURL downloads media from a CDN URL, such as an image's PicURL.
+func (p *Provider) downloadMediaURL(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create media request: %w", err)
+	}
+	resp, err := p.client.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("download media: %w", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("download media HTTP %d", resp.StatusCode)
+	}
+	if err := wechat.CheckMediaSize(resp.ContentLength, p.cfg.MaxMediaSize); err != nil {
+		resp.Body.Close()
+		return nil, "", err
+	}
+	mimeType := resp.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return wechat.LimitMedia(resp.Body, p.cfg.MaxMediaSize), mimeType, nil
 }
 
 // makeMessageID generates a unique message ID for tracking purposes.
@@ -148,7 +148,7 @@ func (p *Provider) Name() string { return "wecom" }
 func (p *Provider) Tier() int    { return 1 }
 
 func (p *Provider) Capabilities() wechat.Capability {
-	return wechat.Capability{
+	return p.cfg.OverrideCapabilities(wechat.Capability{
 		SendText:       true,
 		SendImage:      true,
 		SendVideo:      true,
@@ -167,7 +167,7 @@ func (p *Provider) Capabilities() wechat.Capability {
 		Reaction:       false,
 		ReadReceipt:    true,
 		Typing:         false,
-	}
+	})
 }
 
 // --- Authentication ---
@@ -287,6 +287,11 @@ func newProviderAPIMock(t *testing.T) *providerAPIMock {
 			http.Error(w, "missing", http.StatusNotFound)
 			return
 		}
+		if mediaID == "voice_media" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte("media:" + mediaID))
+			return
+		}
 		w.Header().Set("Content-Type", "image/png")
 		_, _ = w.Write([]byte("media:" + mediaID))
 	})
@@ -552,6 +557,55 @@ func TestProviderGetUserAvatarRejectsHTTPError(t *testing.T) {
 	}
 }
 
+func TestProviderDownloadMedia_URLAndMediaID(t *testing.T) {
+	mock := newProviderAPIMock(t)
+	defer mock.close()
+
+	provider, _ := newMockProvider(t, mock)
+	ctx := context.Background()
+
+	read := func(msg *wechat.Message) (string, string) {
+		t.Helper()
+		reader, mimeType, err := provider.DownloadMedia(ctx, msg)
+		if err != nil {
+			t.Fatalf("DownloadMedia: %v", err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("read media: %v", err)
+		}
+		return string(data), mimeType
+	}
+
+	// Images are fetched from their PicURL
+	if data, _ := read(&wechat.Message{
+		Type:     wechat.MsgImage,
+		MediaURL: "https://wework.qpic.cn/avatar.jpg",
+		Extra:    map[string]string{wechat.ExtraMediaID: "image_media"},
+	}); data != "avatar-bytes" {
+		t.Fatalf("image should come from its URL, got %q", data)
+	}
+
+	// A broken PicURL falls back to the media_id
+	if data, _ := read(&wechat.Message{
+		Type:     wechat.MsgImage,
+		MediaURL: "https://wework.qpic.cn/avatar_missing.jpg",
+		Extra:    map[string]string{wechat.ExtraMediaID: "image_media"},
+	}); data != "media:image_media" {
+		t.Fatalf("broken URL should fall back to media_id, got %q", data)
+	}
+
+	// Voice messages only carry a media_id
+	data, mimeType := read(&wechat.Message{
+		Type:  wechat.MsgVoice,
+		Extra: map[string]string{wechat.ExtraMediaID: "voice_media", "format": "AMR"},
+	})
+	if data != "media:voice_media" || mimeType != "audio/amr" {
+		t.Fatalf("unexpected voice media: %q %s", data, mimeType)
+	}
+}
+
 func TestProviderMessageAndMediaOperations(t *testing.T) {
 	mock := newProviderAPIMock(t)
 	defer mock.close()
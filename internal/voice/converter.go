@@ -1,4 +1,4 @@
-package ipad
+package voice
 
 import (
 	"bytes"
@@ -10,9 +10,9 @@ import (
 	"strings"
 )
 
-// VoiceConverter handles conversion between WeChat silk format and standard audio formats.
+// Converter handles conversion between WeChat silk format and standard audio formats.
 // WeChat uses silk v3 encoding for voice messages, while Matrix expects ogg/opus.
-type VoiceConverter struct {
+type Converter struct {
 	// ffmpegPath is the path to the ffmpeg binary.
 	ffmpegPath string
 	// silkDecoderPath is the path to the silk_v3_decoder binary.
@@ -23,10 +23,10 @@ type VoiceConverter struct {
 	tempDir string
 }
 
-// NewVoiceConverter creates a new voice converter.
+// NewConverter creates a new voice converter.
 // It validates that required external tools are available.
-func NewVoiceConverter(tempDir string) (*VoiceConverter, error) {
-	vc := &VoiceConverter{
+func NewConverter(tempDir string) (*Converter, error) {
+	vc := &Converter{
 		tempDir: tempDir,
 	}
 
@@ -56,7 +56,7 @@ func NewVoiceConverter(tempDir string) (*VoiceConverter, error) {
 
 // SilkToOgg converts a silk v3 audio stream to ogg/opus format.
 // Returns the converted audio data and any error.
-func (vc *VoiceConverter) SilkToOgg(silkData io.Reader) ([]byte, error) {
+func (vc *Converter) SilkToOgg(silkData io.Reader) ([]byte, error) {
 	raw, err := io.ReadAll(silkData)
 	if err != nil {
 		return nil, fmt.Errorf("read silk data: %w", err)
@@ -71,8 +71,29 @@ func (vc *VoiceConverter) SilkToOgg(silkData io.Reader) ([]byte, error) {
 	return vc.silkToOggViaFFmpeg(raw)
 }
 
+// AmrToOgg converts an AMR-NB voice stream (as sent by some WeChat clients
+// and the PadPro API) to ogg/opus format via ffmpeg.
+func (vc *Converter) AmrToOgg(amrData io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(amrData)
+	if err != nil {
+		return nil, fmt.Errorf("read amr data: %w", err)
+	}
+
+	result, err := vc.ffmpegConvert(raw, []string{
+		"-f", "amr",
+	}, []string{
+		"-c:a", "libopus",
+		"-b:a", "64k",
+		"-f", "ogg",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("amr to ogg: %w", err)
+	}
+	return result, nil
+}
+
 // OggToSilk converts an ogg/opus audio stream to silk v3 format for sending to WeChat.
-func (vc *VoiceConverter) OggToSilk(oggData io.Reader) ([]byte, error) {
+func (vc *Converter) OggToSilk(oggData io.Reader) ([]byte, error) {
 	if vc.silkEncoderPath == "" {
 		return nil, fmt.Errorf("silk_v3_encoder not found — cannot convert to silk")
 	}
@@ -124,18 +145,18 @@ func (vc *VoiceConverter) OggToSilk(oggData io.Reader) ([]byte, error) {
 }
 
 // IsAvailable returns whether the converter has the minimum required tools.
-func (vc *VoiceConverter) IsAvailable() bool {
+func (vc *Converter) IsAvailable() bool {
 	return vc.ffmpegPath != ""
 }
 
 // CanEncode returns whether the converter can encode to silk (for Matrix→WeChat).
-func (vc *VoiceConverter) CanEncode() bool {
+func (vc *Converter) CanEncode() bool {
 	return vc.silkEncoderPath != ""
 }
 
 // silkToOggViaDedicated uses the dedicated silk_v3_decoder binary.
 // Flow: silk → PCM (via silk_v3_decoder) → ogg/opus (via ffmpeg)
-func (vc *VoiceConverter) silkToOggViaDedicated(silkData []byte) ([]byte, error) {
+func (vc *Converter) silkToOggViaDedicated(silkData []byte) ([]byte, error) {
 	// Write silk data to temp file
 	silkFile, err := writeTempFile(vc.tempDir, "silk_*.silk", silkData)
 	if err != nil {
@@ -173,7 +194,7 @@ func (vc *VoiceConverter) silkToOggViaDedicated(silkData []byte) ([]byte, error)
 // silkToOggViaFFmpeg attempts to convert silk to ogg purely via ffmpeg.
 // This requires ffmpeg to be compiled with silk support or uses a fallback
 // by trying to decode with the raw silk format hint.
-func (vc *VoiceConverter) silkToOggViaFFmpeg(silkData []byte) ([]byte, error) {
+func (vc *Converter) silkToOggViaFFmpeg(silkData []byte) ([]byte, error) {
 	// Try direct ffmpeg conversion (works if ffmpeg has silk demuxer)
 	result, err := vc.ffmpegConvert(silkData, []string{
 		"-f", "silk",
@@ -200,7 +221,7 @@ func (vc *VoiceConverter) silkToOggViaFFmpeg(silkData []byte) ([]byte, error) {
 }
 
 // ffmpegConvert runs ffmpeg to convert audio data.
-func (vc *VoiceConverter) ffmpegConvert(input []byte, inputArgs, outputArgs []string) ([]byte, error) {
+func (vc *Converter) ffmpegConvert(input []byte, inputArgs, outputArgs []string) ([]byte, error) {
 	args := make([]string, 0, len(inputArgs)+len(outputArgs)+6)
 	args = append(args, "-y", "-hide_banner", "-loglevel", "error")
 
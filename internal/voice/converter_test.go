@@ -1,4 +1,4 @@
-package ipad
+package voice
 
 import (
 	"bytes"
@@ -83,10 +83,10 @@ func TestWriteTempFile(t *testing.T) {
 	// Here we just verify the file was created successfully.
 }
 
-func TestNewVoiceConverter_FFmpegCheck(t *testing.T) {
+func TestNewConverter_FFmpegCheck(t *testing.T) {
 	// This test checks whether ffmpeg is available on the system.
 	// It's not a failure if ffmpeg is missing — we just verify graceful degradation.
-	vc, err := NewVoiceConverter("")
+	vc, err := NewConverter("")
 	if err != nil {
 		t.Logf("ffmpeg not available (expected in CI): %v", err)
 		return
@@ -0,0 +1,73 @@
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Mimetypes of the voice formats DetectMimeType tells apart.
+const (
+	MimeSilk = "audio/silk"
+	MimeAMR  = "audio/amr"
+	MimeOgg  = "audio/ogg"
+)
+
+var (
+	silkMagic = []byte("#!SILK_V3")
+	amrMagic  = []byte("#!AMR\n")
+)
+
+// amrFrameSizes is the AMR-NB frame payload size in bytes for each frame
+// type, excluding the one-byte frame header. Each frame is 20ms of audio.
+var amrFrameSizes = [16]int{12, 13, 15, 17, 19, 20, 26, 31, 5, 0, 0, 0, 0, 0, 0, 0}
+
+// DetectMimeType identifies silk and AMR voice data by their magic
+// headers. WeChat prefixes silk data with a 0x02 byte. Anything else is
+// assumed to already be playable ogg.
+func DetectMimeType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, silkMagic), len(data) > 0 && bytes.HasPrefix(data[1:], silkMagic):
+		return MimeSilk
+	case bytes.HasPrefix(data, amrMagic):
+		return MimeAMR
+	default:
+		return MimeOgg
+	}
+}
+
+// DurationMs computes the duration of silk or AMR audio from its frame
+// count, or returns 0 if the format is unknown.
+func DurationMs(data []byte, mimeType string) int {
+	switch mimeType {
+	case MimeSilk:
+		idx := bytes.Index(data, silkMagic)
+		if idx < 0 {
+			return 0
+		}
+		rest := data[idx+len(silkMagic):]
+		frames := 0
+		for len(rest) >= 2 {
+			n := int(binary.LittleEndian.Uint16(rest))
+			if n == 0xFFFF || len(rest) < 2+n {
+				break
+			}
+			frames++
+			rest = rest[2+n:]
+		}
+		return frames * 20
+	case MimeAMR:
+		rest := data[len(amrMagic):]
+		frames := 0
+		for len(rest) > 0 {
+			size := amrFrameSizes[(rest[0]>>3)&0x0F]
+			if len(rest) < 1+size {
+				break
+			}
+			frames++
+			rest = rest[1+size:]
+		}
+		return frames * 20
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,50 @@
+package voice
+
+import "testing"
+
+// testSilkData builds a WeChat-style silk stream with the given number of
+// 20ms frames.
+func testSilkData(frames int) []byte {
+	data := append([]byte{0x02}, silkMagic...)
+	for i := 0; i < frames; i++ {
+		data = append(data, 0x03, 0x00, 0xAA, 0xBB, 0xCC)
+	}
+	return append(data, 0xFF, 0xFF)
+}
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{testSilkData(1), MimeSilk},
+		{append([]byte(nil), silkMagic...), MimeSilk},
+		{append([]byte("#!AMR\n"), 0x3C), MimeAMR},
+		{[]byte("OggS"), MimeOgg},
+	}
+	for _, tt := range tests {
+		if got := DetectMimeType(tt.data); got != tt.want {
+			t.Errorf("DetectMimeType(%q) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDurationMs(t *testing.T) {
+	if got := DurationMs(testSilkData(50), MimeSilk); got != 1000 {
+		t.Errorf("silk duration = %d, want 1000", got)
+	}
+
+	// Mode 7 (12.2 kbit/s) frames: header byte 0x3C followed by 31 bytes.
+	amr := []byte("#!AMR\n")
+	for i := 0; i < 25; i++ {
+		amr = append(amr, 0x3C)
+		amr = append(amr, make([]byte, 31)...)
+	}
+	if got := DurationMs(amr, MimeAMR); got != 500 {
+		t.Errorf("amr duration = %d, want 500", got)
+	}
+
+	if got := DurationMs([]byte("OggS"), MimeOgg); got != 0 {
+		t.Errorf("ogg duration = %d, want 0", got)
+	}
+}
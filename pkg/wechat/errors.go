@@ -0,0 +1,107 @@
+package wechat
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Provider errors. Providers wrap their failures with one of these so the
+// bridge can decide between retrying, re-logging in and giving up; test with
+// errors.Is. Errors that wrap none of them are treated like ErrTransient.
+var (
+	// ErrRateLimited means WeChat or the provider's risk control refused the
+	// call. Retrying right away only makes it worse.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrLoggedOut means the account's session is gone and it has to log in
+	// again before the call can succeed.
+	ErrLoggedOut = errors.New("not logged in")
+
+	// ErrNotSupported means the provider can't perform the call at all.
+	ErrNotSupported = errors.New("not supported")
+
+	// ErrTransient means the call failed for a temporary reason, such as a
+	// network error or a server error, and may succeed when repeated.
+	ErrTransient = errors.New("temporary failure")
+)
+
+// WrapError marks err as belonging to kind, one of the provider errors above,
+// without changing its message. It returns nil if err is nil.
+func WrapError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &providerError{kind: kind, err: err}
+}
+
+type providerError struct {
+	kind error
+	err  error
+}
+
+func (e *providerError) Error() string   { return e.err.Error() }
+func (e *providerError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// WrapHTTPStatus classifies err, returned for an unsuccessful HTTP response
+// from a provider's API, by the response status and body: 401 means the
+// session is gone, 429 is rate limiting and 5xx is temporary. A 404 or 405
+// means the API lacks the endpoint only when the server's router answered it,
+// and 501 always does; a 404 the API itself returned, for a contact or
+// message that doesn't exist, stays unclassified like other statuses. The
+// status can be read back with HTTPStatus.
+func WrapHTTPStatus(status int, body []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	err = &httpStatusError{status: status, err: err}
+	switch {
+	case status == http.StatusUnauthorized:
+		return WrapError(ErrLoggedOut, err)
+	case status == http.StatusTooManyRequests:
+		return WrapError(ErrRateLimited, err)
+	case endpointMissing(status, body):
+		return WrapError(ErrNotSupported, err)
+	case status >= http.StatusInternalServerError:
+		return WrapError(ErrTransient, err)
+	}
+	return err
+}
+
+// endpointMissing reports whether a response says the API has no such
+// endpoint, rather than that the endpoint failed. Routers answer unknown
+// paths with a plain-text page, or like Spring Boot with an error object
+// naming the path; API answers are JSON objects without one.
+func endpointMissing(status int, body []byte) bool {
+	switch status {
+	case http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+	default:
+		return false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return true
+	}
+	_, hasPath := obj["path"]
+	return hasPath
+}
+
+// HTTPStatus returns the status of the unsuccessful API response err was
+// returned for by WrapHTTPStatus, or 0 if there is none.
+func HTTPStatus(err error) int {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status
+	}
+	return 0
+}
+
+type httpStatusError struct {
+	status int
+	err    error
+}
+
+func (e *httpStatusError) Error() string { return e.err.Error() }
+func (e *httpStatusError) Unwrap() error { return e.err }
@@ -0,0 +1,70 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapError(t *testing.T) {
+	if WrapError(ErrTransient, nil) != nil {
+		t.Fatal("WrapError(nil) should be nil")
+	}
+
+	cause := fmt.Errorf("HTTP request failed: %w", context.DeadlineExceeded)
+	err := fmt.Errorf("send text: %w", WrapError(ErrTransient, cause))
+
+	if err.Error() != "send text: HTTP request failed: context deadline exceeded" {
+		t.Fatalf("message changed: %q", err)
+	}
+	if !errors.Is(err, ErrTransient) {
+		t.Fatal("expected ErrTransient")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the cause to stay reachable")
+	}
+	if errors.Is(err, ErrLoggedOut) {
+		t.Fatal("unexpected ErrLoggedOut")
+	}
+}
+
+func TestWrapHTTPStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{401, "", ErrLoggedOut},
+		{404, "404 page not found\n", ErrNotSupported},
+		{404, `{"timestamp":"2024-01-01T00:00:00Z","status":404,"error":"Not Found","path":"/message/postLocation"}`, ErrNotSupported},
+		{405, "", ErrNotSupported},
+		{429, "", ErrRateLimited},
+		{501, "", ErrNotSupported},
+		{502, "", ErrTransient},
+	}
+	for _, tc := range tests {
+		err := WrapHTTPStatus(tc.status, []byte(tc.body), fmt.Errorf("HTTP %d", tc.status))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("status %d %q: got %v, want %v", tc.status, tc.body, err, tc.want)
+		}
+	}
+
+	// A 404 the API answered itself is about the request, not the endpoint
+	for _, status := range []int{400, 404} {
+		err := WrapHTTPStatus(status, []byte(`{"code":404,"msg":"contact not found"}`), fmt.Errorf("HTTP %d", status))
+		for _, kind := range []error{ErrLoggedOut, ErrRateLimited, ErrNotSupported, ErrTransient} {
+			if errors.Is(err, kind) {
+				t.Errorf("status %d classified as %v", status, kind)
+			}
+		}
+	}
+
+	err := WrapHTTPStatus(400, nil, fmt.Errorf("HTTP 400"))
+	if got := HTTPStatus(fmt.Errorf("send: %w", err)); got != 400 {
+		t.Errorf("HTTPStatus = %d, want 400", got)
+	}
+	if got := HTTPStatus(errors.New("network down")); got != 0 {
+		t.Errorf("HTTPStatus without a response = %d", got)
+	}
+}
@@ -0,0 +1,57 @@
+package wechat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chat type entries of a ChatFilter.
+const (
+	ChatFilterGroups = "type:group"
+	ChatFilterDirect = "type:direct"
+)
+
+// ChatFilter matches WeChat chats by exact ID ("wxid_abc"), by ID prefix
+// ("gh_*") or by type (ChatFilterGroups, ChatFilterDirect).
+type ChatFilter struct {
+	entry  string
+	id     string // exact ID, or ID prefix when prefix is set
+	prefix bool
+}
+
+// ParseChatFilter parses a chat filter entry.
+func ParseChatFilter(entry string) (ChatFilter, error) {
+	entry = strings.TrimSpace(entry)
+	f := ChatFilter{entry: entry}
+	switch {
+	case entry == ChatFilterGroups || entry == ChatFilterDirect:
+		return f, nil
+	case entry == "" || entry == "*":
+		return f, fmt.Errorf("empty chat filter entry %q", entry)
+	case strings.HasPrefix(entry, "type:"):
+		return f, fmt.Errorf("unknown chat type in %q, want %q or %q", entry, ChatFilterGroups, ChatFilterDirect)
+	case strings.Contains(strings.TrimSuffix(entry, "*"), "*"):
+		return f, fmt.Errorf("chat filter %q may only end in *", entry)
+	}
+	f.id, f.prefix = strings.CutSuffix(entry, "*")
+	return f, nil
+}
+
+// String returns the entry f was parsed from.
+func (f ChatFilter) String() string {
+	return f.entry
+}
+
+// Matches reports whether the chat with the given ID matches f.
+func (f ChatFilter) Matches(chatID string) bool {
+	switch f.entry {
+	case ChatFilterGroups:
+		return IsGroupID(chatID)
+	case ChatFilterDirect:
+		return !IsGroupID(chatID)
+	}
+	if f.prefix {
+		return strings.HasPrefix(chatID, f.id)
+	}
+	return chatID == f.id
+}
@@ -0,0 +1,37 @@
+package wechat
+
+import "testing"
+
+func TestChatFilter_Matches(t *testing.T) {
+	tests := []struct {
+		entry  string
+		chatID string
+		want   bool
+	}{
+		{"gh_*", "gh_3dfda90e39d6", true},
+		{"gh_*", "wxid_gh", false},
+		{"weixin", "weixin", true},
+		{"weixin", "weixin2", false},
+		{"type:group", "123@chatroom", true},
+		{"type:group", "wxid_alice", false},
+		{"type:direct", "wxid_alice", true},
+		{"type:direct", "123@chatroom", false},
+	}
+	for _, tt := range tests {
+		f, err := ParseChatFilter(tt.entry)
+		if err != nil {
+			t.Fatalf("ParseChatFilter(%q): %v", tt.entry, err)
+		}
+		if got := f.Matches(tt.chatID); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.entry, tt.chatID, got, tt.want)
+		}
+	}
+}
+
+func TestParseChatFilter_Invalid(t *testing.T) {
+	for _, entry := range []string{"", "*", "type:channel", "gh_*_x"} {
+		if _, err := ParseChatFilter(entry); err == nil {
+			t.Errorf("ParseChatFilter(%q) succeeded, want error", entry)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package wechat
+
+// FriendRequest is an incoming friend request awaiting approval.
+type FriendRequest struct {
+	FromUser string // requester's WeChat ID
+	Nickname string
+	Content  string // greeting the requester wrote
+	XML      string // raw request payload, passed back to AcceptFriendRequest
+	Ticket   string // verification ticket, if the provider delivers one
+}
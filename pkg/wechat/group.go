@@ -0,0 +1,75 @@
+package wechat
+
+import "strings"
+
+// GroupIDSuffix marks a WeChat ID as a group chat.
+const GroupIDSuffix = "@chatroom"
+
+// IsGroupID reports whether id is a group chat ID.
+func IsGroupID(id string) bool {
+	return strings.HasSuffix(id, GroupIDSuffix)
+}
+
+// OfficialAccountIDPrefix marks a WeChat ID as an official account (公众号).
+const OfficialAccountIDPrefix = "gh_"
+
+// IsOfficialAccountID reports whether id belongs to an official account.
+func IsOfficialAccountID(id string) bool {
+	return strings.HasPrefix(id, OfficialAccountIDPrefix)
+}
+
+// GroupInvite is an invitation to a group that the account must confirm
+// before joining, as sent by WeChat for groups with invite approval or more
+// than 40 members.
+type GroupInvite struct {
+	InviterID string            // WeChat ID of the member who sent the invite
+	GroupName string            // Group name, when the invite card carries one
+	URL       string            // Invite link the provider follows to join
+	Extra     map[string]string // Extension fields
+}
+
+// SplitGroupSender splits the "wxid_xxx:\n" sender prefix that WeChat packs
+// into the content of messages received in a group. ok is false when content
+// carries no such prefix, e.g. system notices or the account's own messages.
+func SplitGroupSender(content string) (sender, body string, ok bool) {
+	idx := strings.Index(content, ":\n")
+	if idx <= 0 || !isWeChatID(content[:idx]) {
+		return "", content, false
+	}
+	return content[:idx], content[idx+2:], true
+}
+
+// ExtractGroupSender moves the member wxid of a group message from its
+// content prefix into FromUser, for providers that report the group itself
+// as the sender. Messages that already name the member are only stripped of
+// a matching prefix.
+func ExtractGroupSender(msg *Message) {
+	if !msg.IsGroup {
+		return
+	}
+	sender, body, ok := SplitGroupSender(msg.Content)
+	if !ok {
+		return
+	}
+	if msg.FromUser == sender || msg.FromUser == msg.GroupID || IsGroupID(msg.FromUser) {
+		msg.FromUser = sender
+		msg.Content = body
+	}
+}
+
+// isWeChatID reports whether s looks like a wxid, custom WeChat ID or
+// open-IM ID ("xxx@openim"), as opposed to arbitrary text ending in a colon.
+func isWeChatID(s string) bool {
+	if len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '@', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package wechat
+
+import "testing"
+
+func TestSplitGroupSender(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantSender string
+		wantBody   string
+		wantOK     bool
+	}{
+		{"text", "wxid_abc123:\nhello", "wxid_abc123", "hello", true},
+		{"xml body", "alice-01:\n<msg><img/></msg>", "alice-01", "<msg><img/></msg>", true},
+		{"openim", "12345@openim:\nhi", "12345@openim", "hi", true},
+		{"no prefix", "hello", "", "hello", false},
+		{"colon in text", "note to self:\nbuy milk", "", "note to self:\nbuy milk", false},
+		{"system xml", "<sysmsg type=\"revokemsg\">a:\nb</sysmsg>", "", "<sysmsg type=\"revokemsg\">a:\nb</sysmsg>", false},
+		{"leading separator", ":\nhello", "", ":\nhello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, body, ok := SplitGroupSender(tt.content)
+			if sender != tt.wantSender || body != tt.wantBody || ok != tt.wantOK {
+				t.Errorf("SplitGroupSender(%q) = %q, %q, %v", tt.content, sender, body, ok)
+			}
+		})
+	}
+}
+
+func TestExtractGroupSender(t *testing.T) {
+	fromGroup := &Message{IsGroup: true, GroupID: "g@chatroom", FromUser: "g@chatroom", Content: "wxid_bob:\nhi"}
+	ExtractGroupSender(fromGroup)
+	if fromGroup.FromUser != "wxid_bob" || fromGroup.Content != "hi" {
+		t.Errorf("group sender not extracted: %+v", fromGroup)
+	}
+
+	fromMember := &Message{IsGroup: true, GroupID: "g@chatroom", FromUser: "wxid_bob", Content: "wxid_bob:\nhi"}
+	ExtractGroupSender(fromMember)
+	if fromMember.FromUser != "wxid_bob" || fromMember.Content != "hi" {
+		t.Errorf("matching prefix not stripped: %+v", fromMember)
+	}
+
+	quoted := &Message{IsGroup: true, GroupID: "g@chatroom", FromUser: "wxid_me", Content: "wxid_bob:\nhi"}
+	ExtractGroupSender(quoted)
+	if quoted.FromUser != "wxid_me" || quoted.Content != "wxid_bob:\nhi" {
+		t.Errorf("content of a message from another member was rewritten: %+v", quoted)
+	}
+
+	direct := &Message{FromUser: "wxid_bob", Content: "wxid_bob:\nhi"}
+	ExtractGroupSender(direct)
+	if direct.Content != "wxid_bob:\nhi" {
+		t.Errorf("direct message was rewritten: %+v", direct)
+	}
+}
@@ -0,0 +1,80 @@
+package wechat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrMediaTooLarge is returned while reading media that exceeds the
+// configured size limit. It is not retryable.
+var ErrMediaTooLarge = errors.New("media too large")
+
+// ErrMediaExpired means WeChat no longer serves a message's media, e.g.
+// because its download URL expired.
+var ErrMediaExpired = errors.New("media expired")
+
+// ExtraMediaID is the Message.Extra key of a media message's media ID, with
+// which providers can request a fresh download URL once MediaURL expired.
+const ExtraMediaID = "media_id"
+
+// IsMediaExpiredStatus reports whether an HTTP status from a media download
+// means the media is gone rather than temporarily unavailable.
+func IsMediaExpiredStatus(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusGone || status == http.StatusForbidden
+}
+
+// LimitMedia wraps rc so that reading more than max bytes fails with
+// ErrMediaTooLarge instead of silently truncating. A max of 0 or less
+// disables the limit and returns rc unchanged.
+func LimitMedia(rc io.ReadCloser, max int64) io.ReadCloser {
+	if max <= 0 {
+		return rc
+	}
+	return &limitedMedia{rc: rc, left: max, max: max}
+}
+
+// ReadMedia reads all of r, failing with ErrMediaTooLarge once more than max
+// bytes have been read. A max of 0 or less reads without a limit.
+func ReadMedia(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	return io.ReadAll(&limitedMedia{rc: io.NopCloser(r), left: max, max: max})
+}
+
+// CheckMediaSize fails with ErrMediaTooLarge when a known media size, e.g. a
+// Content-Length, exceeds max. Unknown sizes (negative) and max <= 0 pass.
+func CheckMediaSize(size, max int64) error {
+	if max > 0 && size > max {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrMediaTooLarge, size, max)
+	}
+	return nil
+}
+
+type limitedMedia struct {
+	rc   io.ReadCloser
+	left int64
+	max  int64
+}
+
+func (l *limitedMedia) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, fmt.Errorf("%w: limit is %d bytes", ErrMediaTooLarge, l.max)
+	}
+	// Read one byte past the limit to tell "exactly max" from "more"
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.rc.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n + int(l.left), fmt.Errorf("%w: limit is %d bytes", ErrMediaTooLarge, l.max)
+	}
+	return n, err
+}
+
+func (l *limitedMedia) Close() error {
+	return l.rc.Close()
+}
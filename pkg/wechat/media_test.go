@@ -0,0 +1,49 @@
+package wechat
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadMedia(t *testing.T) {
+	data, err := ReadMedia(strings.NewReader("12345"), 5)
+	if err != nil || string(data) != "12345" {
+		t.Fatalf("ReadMedia at limit = %q, %v", data, err)
+	}
+
+	if _, err := ReadMedia(strings.NewReader("123456"), 5); !errors.Is(err, ErrMediaTooLarge) {
+		t.Fatalf("ReadMedia over limit error = %v, want ErrMediaTooLarge", err)
+	}
+
+	data, err = ReadMedia(strings.NewReader("123456"), 0)
+	if err != nil || string(data) != "123456" {
+		t.Fatalf("ReadMedia without limit = %q, %v", data, err)
+	}
+}
+
+func TestLimitMedia(t *testing.T) {
+	rc := LimitMedia(io.NopCloser(strings.NewReader(strings.Repeat("x", 100))), 10)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if !errors.Is(err, ErrMediaTooLarge) {
+		t.Fatalf("error = %v, want ErrMediaTooLarge", err)
+	}
+	if len(data) > 10 {
+		t.Fatalf("read %d bytes past a 10 byte limit", len(data))
+	}
+}
+
+func TestCheckMediaSize(t *testing.T) {
+	if err := CheckMediaSize(11, 10); !errors.Is(err, ErrMediaTooLarge) {
+		t.Errorf("CheckMediaSize(11, 10) = %v", err)
+	}
+	if err := CheckMediaSize(-1, 10); err != nil {
+		t.Errorf("unknown size should pass, got %v", err)
+	}
+	if err := CheckMediaSize(11, 0); err != nil {
+		t.Errorf("no limit should pass, got %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package wechat
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"time"
 )
 
 // MessageHandler is the callback interface that the bridge core implements
@@ -14,7 +16,21 @@ type MessageHandler interface {
 	OnGroupMemberUpdate(ctx context.Context, groupID string, members []*GroupMember) error
 	OnPresence(ctx context.Context, userID string, online bool) error
 	OnTyping(ctx context.Context, userID string, chatID string) error
-	OnRevoke(ctx context.Context, msgID string, replaceTip string) error
+	// OnRevoke reports a recalled message. chatID is the chat it was sent
+	// in, or empty if the provider doesn't report it.
+	OnRevoke(ctx context.Context, chatID, msgID, replaceTip string) error
+	OnFriendRequest(ctx context.Context, req *FriendRequest) error
+	// OnContactAdded reports a contact added without a friend request
+	// passing through the bridge, e.g. after they scanned the account's QR
+	// code.
+	OnContactAdded(ctx context.Context, contact *ContactInfo) error
+	// OnMessageReaction reports an emoji reaction to a message being added
+	// or withdrawn, on WeChat versions that support them.
+	OnMessageReaction(ctx context.Context, reaction *MessageReaction) error
+	// OnSendAck reports that WeChat delivered a message the bridge sent,
+	// identified by the msg ID its Send method returned. Only providers
+	// with Capability.SendAck call it.
+	OnSendAck(ctx context.Context, msgID string) error
 }
 
 // Provider is the core interface that all WeChat access methods must implement.
@@ -70,6 +86,18 @@ type Provider interface {
 	SendLink(ctx context.Context, toUser string, link *LinkCardInfo) (string, error)
 	// RevokeMessage revokes (recalls) a previously sent message.
 	RevokeMessage(ctx context.Context, msgID string, toUser string) error
+	// SendPat pats (拍一拍) userID in the given chat. In a private chat
+	// userID is the chat partner. Only called when Capabilities().Pat is true.
+	SendPat(ctx context.Context, chatID string, userID string) error
+	// MarkRead marks the chat as read up to and including the given message.
+	// An empty msgID marks the whole chat read, clearing its unread badge.
+	// Only called when Capabilities().ReadReceipt is true.
+	MarkRead(ctx context.Context, chatID string, msgID string) error
+	// SendTyping shows or clears the account's typing indicator in the chat.
+	// Only called when Capabilities().Typing is true; providers that can't
+	// send typing indicators do nothing. None of the bundled providers can
+	// yet, so Matrix typing doesn't reach WeChat.
+	SendTyping(ctx context.Context, chatID string, typing bool) error
 
 	// Contacts
 
@@ -104,6 +132,9 @@ type Provider interface {
 	SetGroupAnnouncement(ctx context.Context, groupID string, text string) error
 	// LeaveGroup leaves a group.
 	LeaveGroup(ctx context.Context, groupID string) error
+	// RespondGroupInvite accepts or declines an invitation to a group.
+	// Only called when Capabilities().GroupInvite is true.
+	RespondGroupInvite(ctx context.Context, invite *GroupInvite, accept bool) error
 
 	// Media
 
@@ -129,6 +160,32 @@ type ProviderConfig struct {
 	APIToken    string
 	CallbackURL string
 
+	// RiskCounters persists daily risk-control counters across restarts.
+	// Optional; counters are kept in memory only when nil.
+	RiskCounters RiskCounterStore
+
+	// Sessions persists the session a provider gets at login, so it can
+	// resume the session after a restart. Optional.
+	Sessions SessionStore
+
+	// MaxMediaSize caps the size of media downloaded by DownloadMedia or read
+	// for sending, in bytes. Larger media fails with ErrMediaTooLarge; 0
+	// disables the limit.
+	MaxMediaSize int64
+
+	// Connection is told about the provider's push connection, e.g. the
+	// padpro WebSocket. Optional.
+	Connection ConnectionObserver
+
+	// Sends is told how long each send waited on risk control and how long
+	// the send itself took. Optional.
+	Sends SendObserver
+
+	// Capabilities overrides the provider's default Capabilities, keyed by
+	// snake_case field name, for backends that support more (or less) than
+	// the provider assumes. Optional.
+	Capabilities map[string]bool
+
 	// PC Hook (Tier 3)
 	WeChatPath string
 	DLLPath    string
@@ -137,3 +194,134 @@ type ProviderConfig struct {
 	// Extension fields
 	Extra map[string]string
 }
+
+// OverrideCapabilities applies the configured capability overrides to a
+// provider's defaults. It is safe to call on a nil config, i.e. before Init.
+func (cfg *ProviderConfig) OverrideCapabilities(defaults Capability) Capability {
+	if cfg == nil {
+		return defaults
+	}
+	return defaults.WithOverrides(cfg.Capabilities)
+}
+
+// MediaRefetcher is optionally implemented by providers that can download a
+// message's media again by message ID once DownloadMedia fails with
+// ErrMediaExpired.
+type MediaRefetcher interface {
+	RefetchMedia(ctx context.Context, msg *Message) (io.ReadCloser, string, error)
+}
+
+// MentionSender is optionally implemented by providers that can send group
+// text with an at-user list, which makes WeChat notify the listed members.
+// "notify@all" in userIDs mentions everyone (@所有人). Callers fall back to
+// SendText otherwise.
+type MentionSender interface {
+	SendTextMentions(ctx context.Context, groupID string, text string, userIDs []string) (string, error)
+}
+
+// ContactPager is optionally implemented by providers that can fetch the
+// contact list a page at a time, so a large list is never held in memory
+// all at once. Callers fall back to GetContactList otherwise.
+type ContactPager interface {
+	// ForEachContactPage calls fn with successive pages of at most pageSize
+	// contacts. It stops and returns fn's error as soon as fn fails.
+	ForEachContactPage(ctx context.Context, pageSize int, fn func([]*ContactInfo) error) error
+}
+
+// MomentsReader is optionally implemented by providers that can read the
+// account's Moments (朋友圈) feed. Only used when Capabilities().MomentRead
+// is true.
+type MomentsReader interface {
+	// GetMoments returns the newest entries of the Moments feed.
+	GetMoments(ctx context.Context) ([]*MomentEntry, error)
+}
+
+// HistoryReader is optionally implemented by providers that can fetch a
+// chat's recent messages, used to backfill newly created rooms. Providers
+// that can only read some chats' history return ErrNotSupported for others.
+type HistoryReader interface {
+	// GetRecentMessages returns up to limit of the chat's newest messages,
+	// oldest first.
+	GetRecentMessages(ctx context.Context, chatID string, limit int) ([]*Message, error)
+}
+
+// FriendAdder is optionally implemented by providers that can send a friend
+// request to a contact shared as a card or recommended by WeChat.
+type FriendAdder interface {
+	// AddFriend sends card's contact a friend request with the given
+	// greeting, using card.Ticket.
+	AddFriend(ctx context.Context, card *ContactCard, greeting string) error
+}
+
+// SessionRestorer is optionally implemented by providers whose service keeps
+// the account logged in across bridge restarts. Starting a new Login while
+// that session is still valid can sign the phone-authorized session out, so
+// the bridge resumes it instead.
+type SessionRestorer interface {
+	// RestoreSession asks the service whether the account is still logged
+	// in and, if so, resumes the session: GetLoginState reports
+	// LoginStateLoggedIn and GetSelf the account afterwards. It reports
+	// false, without error, when the account is logged out.
+	RestoreSession(ctx context.Context) (bool, error)
+}
+
+// RiskLimitReporter is optionally implemented by providers with risk
+// control, to show users how close the account is to its daily limits.
+type RiskLimitReporter interface {
+	// RiskLimits returns today's usage of each daily limit.
+	RiskLimits() []RiskLimit
+}
+
+// RiskLimit is one daily risk-control limit and how much of it was used
+// today.
+type RiskLimit struct {
+	Name  string // "messages", "media", "groups" or "friends"
+	Used  int
+	Limit int
+}
+
+// RiskCounters is a snapshot of an account's daily risk-control counters.
+type RiskCounters struct {
+	Date     time.Time // local day the counters belong to
+	Messages int
+	Groups   int
+	Friends  int
+}
+
+// RiskCounterStore loads and saves risk-control counters, keyed by account.
+// LoadRiskCounters returns nil, nil when nothing has been saved yet.
+type RiskCounterStore interface {
+	LoadRiskCounters(ctx context.Context, key string) (*RiskCounters, error)
+	SaveRiskCounters(ctx context.Context, key string, counters *RiskCounters) error
+}
+
+// SessionStore persists the session of the bridge user a provider serves.
+// The session data is the provider's own JSON. LoadSession returns nil when
+// nothing has been saved, or when it was saved by another provider.
+type SessionStore interface {
+	LoadSession(ctx context.Context) (json.RawMessage, error)
+	SaveSession(ctx context.Context, data json.RawMessage) error
+	DeleteSession(ctx context.Context) error
+}
+
+// ConnectionObserver follows the health of providers' push connections.
+// Several providers may report to the same observer.
+type ConnectionObserver interface {
+	// WebSocketConnected and WebSocketDisconnected bracket each connection.
+	WebSocketConnected()
+	WebSocketDisconnected()
+	// WebSocketReconnecting is called before each attempt to reconnect.
+	WebSocketReconnecting()
+}
+
+// SendObserver times providers' sends to WeChat. Risk-control delay is
+// reported apart from the send so that a throttled account can be told apart
+// from a slow network.
+type SendObserver interface {
+	// ObserveRiskControlDelay is called with each delay risk control imposes
+	// before a send.
+	ObserveRiskControlDelay(d time.Duration)
+	// ObserveWeChatSend is called with the duration of each send, excluding
+	// risk-control delay.
+	ObserveWeChatSend(d time.Duration)
+}
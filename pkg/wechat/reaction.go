@@ -0,0 +1,11 @@
+package wechat
+
+// MessageReaction is an emoji reaction (表情回应) to a message, added or
+// withdrawn. Pats are not reactions; they arrive as system messages.
+type MessageReaction struct {
+	MsgID   string // ID of the message reacted to
+	ChatID  string
+	UserID  string // who reacted
+	Emoji   string
+	Removed bool // the reaction was withdrawn
+}
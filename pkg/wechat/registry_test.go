@@ -116,6 +116,15 @@ func (m *mockProvider) SendLink(_ context.Context, _ string, _ *LinkCardInfo) (s
 func (m *mockProvider) RevokeMessage(_ context.Context, _ string, _ string) error {
 	return nil
 }
+func (m *mockProvider) SendPat(_ context.Context, _ string, _ string) error {
+	return nil
+}
+func (m *mockProvider) MarkRead(_ context.Context, _ string, _ string) error {
+	return nil
+}
+func (m *mockProvider) SendTyping(_ context.Context, _ string, _ bool) error {
+	return nil
+}
 func (m *mockProvider) GetContactList(_ context.Context) ([]*ContactInfo, error) {
 	return nil, nil
 }
@@ -158,6 +167,9 @@ func (m *mockProvider) SetGroupAnnouncement(_ context.Context, _ string, _ strin
 func (m *mockProvider) LeaveGroup(_ context.Context, _ string) error {
 	return nil
 }
+func (m *mockProvider) RespondGroupInvite(_ context.Context, _ *GroupInvite, _ bool) error {
+	return nil
+}
 func (m *mockProvider) DownloadMedia(_ context.Context, _ *Message) (io.ReadCloser, string, error) {
 	return nil, "", nil
 }
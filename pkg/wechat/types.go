@@ -6,18 +6,20 @@ import "io"
 type MsgType int
 
 const (
-	MsgText     MsgType = 1
-	MsgImage    MsgType = 3
-	MsgVoice    MsgType = 34
-	MsgContact  MsgType = 42
-	MsgVideo    MsgType = 43
-	MsgEmoji    MsgType = 47
-	MsgLocation MsgType = 48
-	MsgLink     MsgType = 49
-	MsgFile     MsgType = 4903
-	MsgMiniApp  MsgType = 4933
-	MsgSystem   MsgType = 10000
-	MsgRevoke   MsgType = 10002
+	MsgText      MsgType = 1
+	MsgImage     MsgType = 3
+	MsgVoice     MsgType = 34
+	MsgRecommend MsgType = 40 // Contact recommendation (朋友推荐消息)
+	MsgContact   MsgType = 42
+	MsgVideo     MsgType = 43
+	MsgEmoji     MsgType = 47
+	MsgLocation  MsgType = 48
+	MsgLink      MsgType = 49
+	MsgFile      MsgType = 4903
+	MsgMiniApp   MsgType = 4933
+	MsgSystem    MsgType = 10000
+	MsgRevoke    MsgType = 10002
+	MsgPat       MsgType = 10003 // Bridge-internal: outgoing pat (拍一拍)
 )
 
 // String returns the string representation of a MsgType.
@@ -29,6 +31,8 @@ func (t MsgType) String() string {
 		return "image"
 	case MsgVoice:
 		return "voice"
+	case MsgRecommend:
+		return "recommendation"
 	case MsgContact:
 		return "contact"
 	case MsgVideo:
@@ -47,6 +51,8 @@ func (t MsgType) String() string {
 		return "system"
 	case MsgRevoke:
 		return "revoke"
+	case MsgPat:
+		return "pat"
 	default:
 		return "unknown"
 	}
@@ -61,6 +67,7 @@ const (
 	LoginStateConfirming            // QR scanned, waiting for confirmation
 	LoginStateLoggedIn              // Successfully logged in
 	LoginStateError                 // Login error
+	LoginStateBanned                // Account banned by WeChat
 )
 
 // String returns the string representation of a LoginState.
@@ -76,6 +83,8 @@ func (s LoginState) String() string {
 		return "logged_in"
 	case LoginStateError:
 		return "error"
+	case LoginStateBanned:
+		return "banned"
 	default:
 		return "unknown"
 	}
@@ -86,7 +95,7 @@ type LoginEvent struct {
 	State  LoginState
 	QRCode []byte // QR code image data (PNG)
 	QRURL  string // QR code URL
-	Error  string // Error message (when State == LoginStateError)
+	Error  string // Error message or logout reason (when State == LoginStateError, LoginStateLoggedOut or LoginStateBanned)
 	UserID string // WeChat user ID (when State == LoginStateLoggedIn)
 	Name   string // WeChat nickname
 	Avatar string // Avatar URL
@@ -107,6 +116,8 @@ type Message struct {
 	Thumbnail []byte            // Thumbnail data
 	Location  *LocationInfo     // Location info
 	LinkInfo  *LinkCardInfo     // Link card info
+	Channels  *ChannelsVideo    // Shared Channels video, if any
+	Card      *ContactCard      // Shared or recommended contact, if any
 	ReplyTo   string            // Reply-to message ID
 	Timestamp int64             // Timestamp in milliseconds
 	IsGroup   bool              // Whether this is a group message
@@ -122,6 +133,16 @@ type LocationInfo struct {
 	Poiname   string
 }
 
+// HasValidCoordinates reports whether the location can be shown as a map pin:
+// latitude and longitude are in range and not both zero, which providers
+// send when the coordinates are missing.
+func (l *LocationInfo) HasValidCoordinates() bool {
+	if l.Latitude == 0 && l.Longitude == 0 {
+		return false
+	}
+	return l.Latitude >= -90 && l.Latitude <= 90 && l.Longitude >= -180 && l.Longitude <= 180
+}
+
 // LinkCardInfo contains link card (article/share) information.
 type LinkCardInfo struct {
 	Title       string
@@ -132,17 +153,19 @@ type LinkCardInfo struct {
 
 // ContactInfo represents a WeChat contact or group.
 type ContactInfo struct {
-	UserID      string // WeChat ID (wxid_xxx)
-	Alias       string // WeChat alias
-	Nickname    string // Display name
-	Remark      string // Remark name set by the user
-	AvatarURL   string // Avatar URL
-	Gender      int    // 0: unknown, 1: male, 2: female
-	Province    string
-	City        string
-	Signature   string // Personal signature
-	IsGroup     bool   // Whether this is a group
-	MemberCount int    // Number of group members
+	UserID       string // WeChat ID (wxid_xxx)
+	Alias        string // WeChat alias
+	Nickname     string // Display name
+	Remark       string // Remark name set by the user
+	AvatarURL    string // Avatar URL
+	Gender       int    // 0: unknown, 1: male, 2: female
+	Province     string
+	City         string
+	Signature    string // Personal signature
+	IsGroup      bool   // Whether this is a group
+	MemberCount  int    // Number of group members
+	Announcement string // Group announcement (groups only)
+	PreviousID   string // ID the group had before WeChat re-created it, if known (groups only)
 }
 
 // GroupMember represents a member of a WeChat group.
@@ -180,6 +203,59 @@ type Capability struct {
 	Reaction       bool
 	ReadReceipt    bool
 	Typing         bool
+	GroupInvite    bool // Accept or decline group invitations that need confirmation
+	Pat            bool // Send pats (拍一拍)
+	SendAck        bool // Confirm delivery of sent messages via OnSendAck
+}
+
+// capabilityFields maps the snake_case names used in configuration to the
+// fields of c.
+func capabilityFields(c *Capability) map[string]*bool {
+	return map[string]*bool{
+		"send_text":       &c.SendText,
+		"send_image":      &c.SendImage,
+		"send_video":      &c.SendVideo,
+		"send_voice":      &c.SendVoice,
+		"send_file":       &c.SendFile,
+		"send_location":   &c.SendLocation,
+		"send_link":       &c.SendLink,
+		"send_mini_app":   &c.SendMiniApp,
+		"receive_message": &c.ReceiveMessage,
+		"group_manage":    &c.GroupManage,
+		"contact_manage":  &c.ContactManage,
+		"moment_access":   &c.MomentAccess,
+		"moment_read":     &c.MomentRead,
+		"moment_write":    &c.MomentWrite,
+		"channels_read":   &c.ChannelsRead,
+		"voice_call":      &c.VoiceCall,
+		"video_call":      &c.VideoCall,
+		"revoke":          &c.Revoke,
+		"reaction":        &c.Reaction,
+		"read_receipt":    &c.ReadReceipt,
+		"typing":          &c.Typing,
+		"group_invite":    &c.GroupInvite,
+		"pat":             &c.Pat,
+		"send_ack":        &c.SendAck,
+	}
+}
+
+// IsCapabilityName reports whether name, e.g. "read_receipt", names a
+// Capability field that can be overridden.
+func IsCapabilityName(name string) bool {
+	_, ok := capabilityFields(&Capability{})[name]
+	return ok
+}
+
+// WithOverrides returns c with the capabilities named in overrides set to
+// the given values. Unknown names are ignored.
+func (c Capability) WithOverrides(overrides map[string]bool) Capability {
+	fields := capabilityFields(&c)
+	for name, enabled := range overrides {
+		if field, ok := fields[name]; ok {
+			*field = enabled
+		}
+	}
+	return c
 }
 
 // MomentEntry represents a single Moments (朋友圈) feed entry.
@@ -197,6 +273,20 @@ type MomentEntry struct {
 	Extra       map[string]string // Extension fields
 }
 
+// ContactCard describes a contact shared as a card (名片) or recommended by
+// WeChat (朋友推荐). Ticket, when set, lets the account send them a friend
+// request.
+type ContactCard struct {
+	UserID    string // WeChat ID, or an encrypted ID (v3_...) for strangers
+	Nickname  string
+	Alias     string // Custom WeChat ID (微信号), if set
+	AvatarURL string
+	Region    string // e.g. "Guangdong Shenzhen"
+	Reason    string // Why WeChat recommends them, recommendations only
+	Ticket    string // Verification ticket (v4_...) for adding them
+	Scene     int    // Friend request scene WeChat expects with Ticket
+}
+
 // ChannelsVideo represents a shared Channels (视频号) video.
 type ChannelsVideo struct {
 	VideoID     string // Channels video ID
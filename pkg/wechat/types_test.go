@@ -0,0 +1,37 @@
+package wechat
+
+import "testing"
+
+func TestCapability_WithOverrides(t *testing.T) {
+	defaults := Capability{SendText: true, ReadReceipt: true}
+	got := defaults.WithOverrides(map[string]bool{"reaction": true, "read_receipt": false, "unknown": true})
+
+	want := Capability{SendText: true, Reaction: true}
+	if got != want {
+		t.Fatalf("WithOverrides = %+v, want %+v", got, want)
+	}
+	if !defaults.ReadReceipt {
+		t.Fatal("WithOverrides modified the defaults")
+	}
+}
+
+func TestProviderConfig_OverrideCapabilities(t *testing.T) {
+	defaults := Capability{SendText: true}
+
+	var cfg *ProviderConfig
+	if got := cfg.OverrideCapabilities(defaults); got != defaults {
+		t.Fatalf("nil config: got %+v, want the defaults", got)
+	}
+	cfg = &ProviderConfig{Capabilities: map[string]bool{"pat": true}}
+	if got := cfg.OverrideCapabilities(defaults); !got.Pat || !got.SendText {
+		t.Fatalf("got %+v, want pat enabled over the defaults", got)
+	}
+}
+
+func TestIsCapabilityName(t *testing.T) {
+	for name, want := range map[string]bool{"send_ack": true, "moment_read": true, "SendAck": false, "": false} {
+		if got := IsCapabilityName(name); got != want {
+			t.Errorf("IsCapabilityName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}